@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
+	"os"
 	"os/signal"
 	"syscall"
 	"time"
@@ -12,12 +14,15 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/tempizhere/goshorty/internal/app"
 	"github.com/tempizhere/goshorty/internal/config"
+	"github.com/tempizhere/goshorty/internal/events"
+	"github.com/tempizhere/goshorty/internal/features"
 	grpcserver "github.com/tempizhere/goshorty/internal/grpc"
 	"github.com/tempizhere/goshorty/internal/grpc/proto"
 	"github.com/tempizhere/goshorty/internal/log"
 	"github.com/tempizhere/goshorty/internal/middleware"
 	"github.com/tempizhere/goshorty/internal/repository"
 	"github.com/tempizhere/goshorty/internal/service"
+	"github.com/tempizhere/goshorty/internal/ui"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 )
@@ -28,9 +33,19 @@ var buildDate string
 var buildCommit string
 
 func main() {
-	// Выводим информацию о сборке
-	printBuildInfo()
+	if code := run(); code != 0 {
+		exit(code)
+	}
+}
+
+// exit завершает процесс с кодом code; os.Exit не вызывается в main напрямую (см. анализатор noexit)
+func exit(code int) {
+	os.Exit(code)
+}
 
+// run запускает сервер или проверку хранилища и возвращает код выхода процесса
+// Отложенные вызовы (закрытие базы) выполняются до выхода
+func run() int {
 	// Получаем конфигурацию
 	cfg, err := config.NewConfig()
 	if err != nil {
@@ -38,17 +53,44 @@ func main() {
 		logger.Fatal("Failed to initialize configuration", zap.Error(err))
 	}
 
+	// Выводим информацию о сборке; в режиме проверки stdout занят JSON-отчётом
+	if !cfg.VerifyStorage {
+		printBuildInfo()
+	}
+
 	// Инициализация логгера
 	logger := log.NewLogger()
 
+	switch cfg.BaseURLCheck {
+	case config.BaseURLDerived:
+		logger.Info("Base URL derived from server address", zap.String("base_url", cfg.BaseURL), zap.String("address", cfg.RunAddr))
+	case config.BaseURLMismatch:
+		logger.Warn("Base URL port differs from server address port; short links may point to the wrong port",
+			zap.String("base_url", cfg.BaseURL), zap.String("address", cfg.RunAddr),
+			zap.String("hint", "set -b (BASE_URL) to the public URL; ignore if a proxy serves the base URL"))
+	}
+
 	// Инициализация базы данных
+	// Если база недоступна, но настроен снимок URL, сервер стартует и обслуживает редиректы из снимка
+	var dbErr error
 	db, err := app.NewDB(cfg.DatabaseDSN)
 	if err != nil {
-		logger.Fatal("Failed to initialize database", zap.Error(err))
+		if cfg.SnapshotPath == "" {
+			logger.Fatal("Failed to initialize database", zap.Error(err))
+		}
+		dbErr = err
+	}
+	// Приложение и gRPC-сервер видят базу через держатель: если она недоступна при старте,
+	// подключение появится в нём после восстановления (см. connectPostgres)
+	var dbHolder *repository.DatabaseHolder
+	var appDB repository.Database
+	if cfg.DatabaseDSN != "" {
+		dbHolder = repository.NewDatabaseHolder(db)
+		appDB = dbHolder
 	}
 	defer func() {
-		if db != nil {
-			if closeErr := db.Close(); closeErr != nil {
+		if dbHolder != nil {
+			if closeErr := dbHolder.Close(); closeErr != nil {
 				logger.Error("Failed to close database", zap.Error(closeErr))
 			}
 		}
@@ -56,74 +98,211 @@ func main() {
 
 	// Создаём репозиторий
 	var repo repository.Repository
-	if cfg.DatabaseDSN != "" && db != nil {
-		repo, err = repository.NewPostgresRepository(db, logger)
-		if err != nil {
-			logger.Fatal("Failed to initialize PostgreSQL repository", zap.Error(err))
+	var fileRepo *repository.FileRepository
+	var snapshotRepo *repository.SnapshotRepository
+	var offlineRepo *repository.OfflineRepository
+	var repoOpts []repository.Option
+	if cfg.DisableReverseIndex {
+		// В PostgreSQL original_url уникален по схеме, поэтому отключить дедупликацию там нельзя: не запускаемся молча с ней
+		if cfg.DatabaseDSN != "" {
+			logger.Fatal("Disabling the reverse index is not supported by PostgreSQL storage; unset DISABLE_REVERSE_INDEX")
+		}
+		repoOpts = append(repoOpts, repository.DisableReverseIndex())
+	}
+	if cfg.DatabaseDSN != "" {
+		if db != nil {
+			// Запросы репозитория логируются с длительностью; медленные — с уровнем warn
+			loggingDB := repository.NewLoggingDatabase(db, cfg.DBSlowQueryThreshold, logger)
+			pgRepo, err := repository.NewPostgresRepository(loggingDB, logger)
+			if err != nil {
+				if cfg.SnapshotPath == "" {
+					logger.Fatal("Failed to initialize PostgreSQL repository", zap.Error(err))
+				}
+				dbErr = err
+			} else {
+				repo = pgRepo
+				logger.Info("Using PostgreSQL repository")
+			}
+		}
+		if dbErr != nil {
+			offlineRepo = repository.NewOfflineRepository("postgres", dbErr)
+			repo = offlineRepo
+			logger.Error("PostgreSQL is unavailable, serving redirects from URL snapshot until it is reachable",
+				zap.String("path", cfg.SnapshotPath), zap.Error(dbErr))
 		}
-		logger.Info("Using PostgreSQL repository")
 	} else if cfg.FileStoragePath != "" {
-		repo, err = repository.NewFileRepository(cfg.FileStoragePath, logger)
+		// Проверка хранилища должна увидеть файл таким, какой он есть
+		if cfg.FileRepairOnLoad && !cfg.VerifyStorage {
+			repoOpts = append(repoOpts, repository.RepairOnLoad())
+		}
+		repoOpts = append(repoOpts, repository.WithWriteRetry(cfg.FileWriteAttempts, cfg.FileWriteBackoff))
+		repoOpts = append(repoOpts, repository.WithTempFileMaxAge(cfg.FileTempMaxAge))
+		if cfg.DisableFileSelfHeal {
+			repoOpts = append(repoOpts, repository.DisableSelfHeal())
+		}
+		fileRepo, err = repository.NewFileRepository(cfg.FileStoragePath, logger, repoOpts...)
 		if err != nil {
 			logger.Fatal("Failed to initialize file repository", zap.Error(err))
 		}
+		repo = fileRepo
 		logger.Info("Using file repository", zap.String("path", cfg.FileStoragePath))
 	} else {
-		repo = repository.NewMemoryRepository()
-		logger.Info("Using memory repository")
+		repoOpts = append(repoOpts,
+			repository.WithMaxURLs(cfg.MemoryMaxURLs, repository.EvictionPolicy(cfg.MemoryEviction)),
+			repository.WithLogger(logger),
+		)
+		repo = repository.NewMemoryRepository(repoOpts...)
+		logger.Info("Using memory repository", zap.Int("max_urls", cfg.MemoryMaxURLs), zap.String("eviction", cfg.MemoryEviction))
+	}
+
+	// Учёт источников переходов есть не во всех хранилищах: без него TRACK_REFERRERS молча ничего бы не делал
+	if _, tracks := repo.(repository.ReferrerStore); cfg.TrackReferrers && !tracks && dbErr == nil {
+		logger.Fatal("Referrer tracking is not supported by storage; disable TRACK_REFERRERS", zap.String("storage", repo.Name()))
+	}
+	if _, tracks := repo.(repository.ClickStore); cfg.TrackClicks && !tracks && dbErr == nil {
+		logger.Fatal("Click tracking is not supported by storage; disable TRACK_CLICKS", zap.String("storage", repo.Name()))
+	}
+
+	// В режиме проверки хранилище проверяется до подключения кешей и сбоев, а сервер не запускается
+	if cfg.VerifyStorage {
+		return verifyStorage(repo, cfg.VerifyRepair, logger)
+	}
+
+	// Прогреваем кеш чтений из снимка, чтобы после рестарта редиректы не нагружали базу
+	if cfg.DatabaseDSN != "" && cfg.SnapshotPath != "" {
+		snapshotRepo = repository.NewSnapshotRepository(repo, cfg.SnapshotPath, cfg.SnapshotMaxAge, cfg.SnapshotMaxURLs, logger)
+		repo = snapshotRepo
+		logger.Info("Using URL snapshot", zap.String("path", cfg.SnapshotPath), zap.Duration("interval", cfg.SnapshotInterval))
+	}
+
+	// Внедрение сбоев хранилища доступно только при явном включении в конфигурации
+	var faultRepo *repository.FaultRepository
+	if cfg.EnableFaultInjection {
+		faultRepo = repository.WithFaults(repo, repository.FaultConfig{})
+		repo = faultRepo
+		logger.Warn("Storage fault injection enabled")
+	}
+
+	// Последние ошибки хранилища доступны через /api/internal/errors; внедрённые сбои тоже в них попадают
+	instrumentedRepo := repository.Instrument(repo)
+	repo = instrumentedRepo
+
+	// Переходы копятся в памяти и записываются пачками, чтобы редирект не ждал хранилище
+	var clickBuffer *repository.ClickBuffer
+	if cfg.TrackClicks {
+		clickBuffer = repository.NewClickBuffer(instrumentedRepo, logger)
+	}
+
+	// Загружаем каталоги сообщений HTML-страниц; непереведённый ключ не даёт сервису стартовать
+	pages, err := ui.NewPages(cfg.DefaultLanguage)
+	if err != nil {
+		logger.Fatal("Failed to load UI message catalogs", zap.Error(err))
+	}
+
+	// Некорректный алфавит коротких ID не заменяется молча стандартным
+	if cfg.IDAlphabet != "" {
+		if err := service.ValidateIDAlphabet(cfg.IDAlphabet); err != nil {
+			logger.Fatal("Invalid short ID alphabet", zap.Error(err))
+		}
+	}
+
+	// Путь проверки готовности не должен перехватывать короткие ID
+	if cfg.HealthPath != "" {
+		if err := app.ValidateHealthPath(cfg.HealthPath); err != nil {
+			logger.Fatal("Invalid health path", zap.Error(err))
+		}
+	}
+	if err := app.ValidateFieldNaming(cfg.ResponseFieldNaming); err != nil {
+		logger.Fatal("Invalid response field naming", zap.Error(err))
+	}
+	if err := app.ValidateShortenResponse(cfg.ShortenResponseMode); err != nil {
+		logger.Fatal("Invalid shorten response mode", zap.Error(err))
+	}
+	if err := service.ValidateShortURLTemplate(cfg.ShortURLTemplate); err != nil {
+		logger.Fatal("Invalid short URL template", zap.Error(err))
 	}
 
 	// Создаём зависимости
-	svc := service.NewService(repo, cfg.BaseURL, cfg.JWTSecret)
-	appInstance := app.NewApp(svc, db, logger)
+	svc := service.NewService(repo, cfg.BaseURL, cfg.JWTSecret,
+		service.WithUserIDEncoding(service.UserIDEncoding(cfg.UserIDEncoding)),
+		service.WithIDAlphabet(cfg.IDAlphabet),
+		service.WithShortIDLength(cfg.ShortIDLength),
+		service.WithShortURLTemplate(cfg.ShortURLTemplate),
+		service.WithPIIMode(service.PIIMode(cfg.LogPIIMode)),
+		service.WithIssuedUserPersistence(cfg.PersistUsers),
+		service.WithReferrerTracking(cfg.TrackReferrers),
+		service.WithMaxDescriptionLength(cfg.MaxDescriptionLength),
+		service.WithBatchConcurrency(cfg.MaxConcurrentBatches, service.BatchLimitPolicy(cfg.BatchLimitPolicy)),
+		service.WithClickRateLimit(cfg.ClickRateLimit, cfg.HotLinksCapacity),
+		service.WithClickRecorder(clickRecorder(clickBuffer)),
+		service.WithNotifier(events.NewNotifier(events.DefaultCapacity)),
+	)
+	appInstance := app.NewApp(svc, appDB, logger,
+		app.WithRefQueryKey(cfg.RefQueryKey),
+		app.WithEnabledEndpoints(cfg.EnabledEndpoints),
+		app.WithDisabledFeatures(cfg.DisabledEndpoints),
+		app.WithRobotsPolicy(cfg.RobotsPolicy),
+		app.WithShortURLHeader(cfg.ShortURLHeader),
+		app.WithStrictJSON(cfg.StrictJSON),
+		app.WithStrictPlainContentType(cfg.StrictPlainContentType),
+		app.WithPages(pages),
+		app.WithFaultInjection(faultRepo),
+		app.WithStorageErrors(instrumentedRepo),
+		app.WithCookieMaxAge(cfg.CookieMaxAge),
+		app.WithMissDelay(cfg.RedirectMissDelay),
+		app.WithForwardedHosts(cfg.AllowedForwardedHosts),
+		app.WithTrustedSubnet(cfg.TrustedSubnet),
+		app.WithClientIPHeader(cfg.TrustClientIPHeader),
+		app.WithInternalTokens(cfg.InternalAPITokens...),
+		app.WithMaxDeleteBatch(cfg.MaxDeleteBatch),
+		app.WithDedupStatus(cfg.DedupStatus),
+		app.WithRedirectMemo(!cfg.DisableRedirectMemo),
+		app.WithHealthPath(cfg.HealthPath),
+		app.WithResponseFieldNaming(cfg.ResponseFieldNaming),
+		app.WithShortenResponse(cfg.ShortenResponseMode),
+	)
 
 	// Создаём маршрутизатор
 	r := chi.NewRouter()
 
+	// Маршруты, которые продолжают работать, даже если выдать идентификатор пользователя не удалось
+	optionalIdentityPaths := []string{
+		"/{id}",
+		"/api/expand/{id}",
+		"/ping",
+		"/readyz",
+		"/api/internal/stats",
+		"/api/internal/resolve",
+	}
+	if cfg.HealthPath != "" {
+		optionalIdentityPaths = append(optionalIdentityPaths, cfg.HealthPath)
+	}
+
 	// Применение middleware
-	r.Use(middleware.GzipMiddleware)
-	r.Use(middleware.LoggingMiddleware(logger))
-	r.Use(middleware.AuthMiddleware(svc, logger))
-
-	// Регистрируем обработчики
-	r.Post("/", func(w http.ResponseWriter, r *http.Request) {
-		appInstance.HandlePostURL(w, r)
-	})
-	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-	})
-	r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
-		appInstance.HandleGetURL(w, r)
-	})
-	r.Post("/api/shorten", func(w http.ResponseWriter, r *http.Request) {
-		appInstance.HandleJSONShorten(w, r)
-	})
-	r.Get("/api/shorten", func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-	})
-	r.Get("/api/expand/{id}", func(w http.ResponseWriter, r *http.Request) {
-		appInstance.HandleJSONExpand(w, r)
-	})
-	r.Get("/ping", func(w http.ResponseWriter, r *http.Request) {
-		appInstance.HandlePing(w, r)
-	})
-	r.Post("/api/shorten/batch", func(w http.ResponseWriter, r *http.Request) {
-		appInstance.HandleBatchShorten(w, r)
-	})
-	r.Get("/api/user/urls", func(w http.ResponseWriter, r *http.Request) {
-		appInstance.HandleUserURLs(w, r)
-	})
-	r.Delete("/api/user/urls", func(w http.ResponseWriter, r *http.Request) {
-		appInstance.HandleBatchDeleteURLs(w, r)
-	})
-
-	// Маршрут для статистики с проверкой доверенной подсети
-	r.Route("/api/internal", func(r chi.Router) {
-		r.Use(middleware.TrustedSubnetMiddleware(cfg.TrustedSubnet, logger))
-		r.Get("/stats", func(w http.ResponseWriter, r *http.Request) {
-			appInstance.HandleStats(w, r)
-		})
-	})
+	r.Use(middleware.MaxHeaderBytesMiddleware(cfg.MaxHeaderBytes, logger))
+	var gzipOpts []middleware.GzipOption
+	if cfg.ForceGzip {
+		// Внутренние клиенты в доверенной сети принимают gzip, не присылая Accept-Encoding
+		gzipOpts = append(gzipOpts, middleware.WithForceGzip("/api/internal/"))
+	}
+	r.Use(middleware.NewGzipMiddleware(gzipOpts...))
+	r.Use(middleware.LoggingMiddleware(logger, "/favicon.ico", "/robots.txt"))
+	r.Use(middleware.AuthMiddleware(svc, logger,
+		middleware.WithCookieMaxAge(cfg.CookieMaxAge),
+		middleware.WithExpiredIdentityWindow(cfg.ReuseExpiredIdentityWindow),
+		// Выход не должен выдавать новый идентификатор перед удалением cookie
+		middleware.WithAnonymousPaths("/favicon.ico", "/robots.txt", "/api/user/logout"),
+		middleware.WithOptionalIdentity(optionalIdentityPaths...),
+	))
+	if cfg.CSRFProtection {
+		r.Use(middleware.CSRFMiddleware(cfg.JWTSecret))
+	}
+
+	// Регистрируем обработчики; отключённые в конфигурации эндпоинты не регистрируются
+	appInstance.RegisterRoutes(r, middleware.TrustedSubnetMiddleware(cfg.TrustedSubnet, logger,
+		middleware.WithInternalTokens(cfg.InternalAPITokens...),
+		middleware.WithClientIPHeader(cfg.TrustClientIPHeader),
+	))
 
 	// Создаём HTTP сервер с настройками для graceful shutdown
 	server := &http.Server{
@@ -132,20 +311,38 @@ func main() {
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
+		// Жёсткий предел net/http с запасом: превышение cfg.MaxHeaderBytes отклоняет и записывает в журнал middleware
+		MaxHeaderBytes: 2 * cfg.MaxHeaderBytes,
+	}
+
+	// HTTP-сервер, перенаправляющий клиентов на HTTPS, поднимается только вместе с HTTPS
+	var redirectServer *http.Server
+	if cfg.HTTPSRedirect && cfg.EnableHTTPS {
+		redirectServer = &http.Server{
+			Addr:         cfg.HTTPSRedirectAddr,
+			Handler:      app.HTTPSRedirectHandler(cfg.RunAddr),
+			ReadTimeout:  15 * time.Second,
+			WriteTimeout: 15 * time.Second,
+			IdleTimeout:  60 * time.Second,
+		}
+	} else if cfg.HTTPSRedirect {
+		logger.Warn("HTTPS redirect requires HTTPS to be enabled, redirect server is not started")
 	}
 
 	// Создаём gRPC сервер если включен
 	var grpcSrv *grpc.Server
 	if cfg.EnableGRPC {
-		grpcService := grpcserver.NewServer(svc, db, logger)
+		grpcService := grpcserver.NewServer(svc, appDB, logger)
 
-		grpcSrv = grpc.NewServer(
+		grpcSrv = grpc.NewServer(append(grpcserver.Options(cfg),
 			grpc.ChainUnaryInterceptor(
+				grpcserver.RequestIDInterceptor(cfg.GRPCRequestIDKey, logger),
 				grpcserver.LoggingInterceptor(logger),
+				grpcserver.DisabledFeaturesInterceptor(features.NewSet(cfg.DisabledEndpoints)),
 				grpcserver.AuthInterceptor(svc, logger),
-				grpcserver.TrustedSubnetInterceptor(cfg.TrustedSubnet, logger),
+				grpcserver.TrustedSubnetInterceptor(cfg.TrustedSubnet, grpcserver.RealIPKey(cfg), logger, cfg.InternalAPITokens...),
 			),
-		)
+		)...)
 
 		proto.RegisterShortenerServiceServer(grpcSrv, grpcService)
 	}
@@ -155,6 +352,41 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 	defer stop()
 
+	// Следим за заменой файла хранилища извне (например, восстановлением из бэкапа)
+	if fileRepo != nil {
+		go fileRepo.Watch(ctx, cfg.FileWatchInterval, cfg.FileReloadOnChange)
+		// Переписываем файл в фоне, когда в нём накопилось много надгробий
+		go fileRepo.RunCompaction(ctx, repository.DefaultCompactInterval)
+	}
+
+	// Периодически обновляем снимок URL для быстрого холодного старта
+	// Без базы снимок только читается: перезапись оставила бы файл пустым
+	if snapshotRepo != nil && dbErr == nil {
+		go snapshotRepo.Run(ctx, cfg.SnapshotInterval)
+	}
+
+	// Пока PostgreSQL недоступен, пробуем подключиться заново и после успеха возвращаемся к базе
+	if offlineRepo != nil {
+		go func() {
+			if offlineRepo.Run(ctx, repository.DefaultOfflineRetryInterval, connectPostgres(cfg, dbHolder, logger), logger) && snapshotRepo != nil {
+				snapshotRepo.Run(ctx, cfg.SnapshotInterval)
+			}
+		}()
+	}
+
+	if clickBuffer != nil {
+		go clickBuffer.Run(ctx, repository.DefaultClickFlushInterval)
+	}
+
+	// Предупреждаем, когда пространство коротких ID заполняется и растёт число коллизий
+	go appInstance.WatchIDSpace(ctx, app.DefaultIDSpaceCheckInterval, cfg.IDSpaceWarnRatio)
+
+	// Следим за соединением с PostgreSQL и сбрасываем пул, если адрес базы сменился
+	go appInstance.WatchDatabase(ctx, app.DefaultDBHealthInterval, cfg.DBResetThreshold)
+
+	// Сбрасываем запомненные редиректы при удалении и изменении ссылок
+	go appInstance.WatchRedirectMemo(ctx)
+
 	// Запускаем HTTP сервер в горутине
 	go func() {
 		var err error
@@ -170,6 +402,15 @@ func main() {
 		}
 	}()
 
+	if redirectServer != nil {
+		go func() {
+			logger.Info("Starting HTTPS redirect server", zap.String("address", cfg.HTTPSRedirectAddr))
+			if err := redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Fatal("HTTPS redirect server error", zap.Error(err))
+			}
+		}()
+	}
+
 	// Запускаем gRPC сервер в горутине если включен
 	if grpcSrv != nil {
 		go func() {
@@ -189,25 +430,68 @@ func main() {
 	logger.Info("Received shutdown signal, starting graceful shutdown...")
 
 	// Создаем контекст с таймаутом для graceful shutdown
-	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second+cfg.PreShutdownDelay)
 	defer cancel()
 
+	// Даём балансировщику время исключить экземпляр: /readyz отвечает 503, остальные запросы обслуживаются
+	appInstance.Drain(shutdownCtx, cfg.PreShutdownDelay)
+
 	// Graceful shutdown HTTP сервера
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		logger.Error("HTTP server shutdown error", zap.Error(err))
 	}
 
+	if redirectServer != nil {
+		if err := redirectServer.Shutdown(shutdownCtx); err != nil {
+			logger.Error("HTTPS redirect server shutdown error", zap.Error(err))
+		}
+	}
+
 	// Graceful shutdown gRPC сервера
 	if grpcSrv != nil {
 		grpcSrv.GracefulStop()
 	}
 
+	// Записываем переходы, накопленные после последней записи и во время остановки серверов
+	if clickBuffer != nil {
+		clickBuffer.Flush()
+	}
+
 	// Закрываем репозиторий
 	if err := repo.Close(); err != nil {
 		logger.Error("Failed to close repository", zap.Error(err))
 	}
 
 	logger.Info("Graceful shutdown completed")
+	return 0
+}
+
+// connectPostgres возвращает функцию подключения к PostgreSQL для выхода OfflineRepository из режима недоступности
+// Новое подключение передаётся в holder, чтобы /ping, gRPC Ping и WatchDatabase видели восстановленную базу
+func connectPostgres(cfg *config.Config, holder *repository.DatabaseHolder, logger *zap.Logger) func() (repository.Repository, error) {
+	return func() (repository.Repository, error) {
+		db, err := app.NewDB(cfg.DatabaseDSN)
+		if err != nil {
+			return nil, err
+		}
+		pgRepo, err := repository.NewPostgresRepository(repository.NewLoggingDatabase(db, cfg.DBSlowQueryThreshold, logger), logger)
+		if err != nil {
+			if closeErr := db.Close(); closeErr != nil {
+				logger.Warn("Failed to close database", zap.Error(closeErr))
+			}
+			return nil, err
+		}
+		holder.Set(db)
+		return pgRepo, nil
+	}
+}
+
+// clickRecorder возвращает buffer как получателя переходов; без буфера — nil, чтобы сервис не записывал переходы
+func clickRecorder(buffer *repository.ClickBuffer) service.ClickRecorder {
+	if buffer == nil {
+		return nil
+	}
+	return buffer
 }
 
 // printBuildInfo выводит информацию о сборке в stdout
@@ -231,3 +515,32 @@ func printBuildInfo() {
 	fmt.Printf("Build date: %s\n", date)
 	fmt.Printf("Build commit: %s\n", commit)
 }
+
+// verifyStorage проверяет хранилище, выводит отчёт в JSON в stdout и возвращает код выхода процесса
+// Код выхода: 0 — нарушений нет или все исправлены, 1 — остались нарушения, 2 — проверка не выполнена
+// Хранилище намеренно не закрывается: закрытие файлового хранилища переписывает файл
+func verifyStorage(repo repository.Repository, repair bool, logger *zap.Logger) int {
+	verifier, ok := repo.(repository.Verifier)
+	if !ok {
+		logger.Error("Storage does not support verification", zap.String("backend", repo.Name()))
+		return 2
+	}
+	report, err := verifier.Verify(repair)
+	if err != nil {
+		logger.Error("Failed to verify storage", zap.Error(err))
+		return 2
+	}
+	if report.Violations == nil {
+		report.Violations = []repository.Violation{}
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		logger.Error("Failed to write verification report", zap.Error(err))
+		return 2
+	}
+	if report.Failed() {
+		return 1
+	}
+	return 0
+}
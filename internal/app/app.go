@@ -1,64 +1,249 @@
 package app
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"expvar"
+	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/tempizhere/goshorty/internal/features"
 	"github.com/tempizhere/goshorty/internal/middleware"
 	"github.com/tempizhere/goshorty/internal/models"
 	"github.com/tempizhere/goshorty/internal/repository"
 	"github.com/tempizhere/goshorty/internal/service"
+	"github.com/tempizhere/goshorty/internal/ui"
 	"go.uber.org/zap"
 )
 
-// Создаём структуры для JSON
-// ShortenRequest представляет запрос на сокращение URL в JSON формате
-type ShortenRequest struct {
-	URL string `json:"url"` // Оригинальный URL для сокращения
+// Типы тела запросов и ответов сокращения определены в models; псевдонимы сохраняют прежние имена пакета app
+type (
+	ShortenRequest    = models.ShortenRequest    // Запрос на сокращение URL в JSON формате
+	ShortenResponse   = models.ShortenResponse   // Ответ с сокращённым URL в JSON формате
+	ShortenIDResponse = models.ShortenIDResponse // Ответ в режиме ?response=id
+	ExpandResponse    = models.ExpandResponse    // Ответ с оригинальным URL в JSON формате
+)
+
+// SwitchUserRequest представляет запрос на выдачу токена от имени пользователя
+type SwitchUserRequest struct {
+	UserID string `json:"user_id"` // Идентификатор пользователя, от имени которого выдаётся токен
+}
+
+// ClaimURLRequest представляет запрос на передачу анонимного URL текущему пользователю
+type ClaimURLRequest struct {
+	ClaimToken string `json:"claim_token"` // Токен владения, выданный при создании URL
+}
+
+// FlagNSFWRequest представляет запрос модерации на пометку ссылки как NSFW и ответ на него
+type FlagNSFWRequest struct {
+	ID   string `json:"id"`   // Короткий идентификатор URL
+	NSFW *bool  `json:"nsfw"` // Установить (true, по умолчанию) или снять (false) пометку
+}
+
+// UpdateURLRequest представляет запрос на задание адреса назначения зарезервированного кода
+type UpdateURLRequest struct {
+	URL string `json:"url"` // Оригинальный URL, на который будет вести код
+}
+
+// ReserveRequest представляет запрос на резервирование коротких ID без адреса назначения
+type ReserveRequest struct {
+	Count  int    `json:"count"`   // Количество резервируемых ID
+	UserID string `json:"user_id"` // Пользователь, который сможет задать адреса назначения
+}
+
+// ReserveResponse представляет ответ со списком зарезервированных коротких ID
+type ReserveResponse struct {
+	UserID string   `json:"user_id"` // Владелец зарезервированных ID
+	IDs    []string `json:"ids"`     // Зарезервированные короткие ID
+}
+
+// URLOwnersResponse представляет ответ со списком пользователей, создавших ссылки на URL
+type URLOwnersResponse struct {
+	URL     string   `json:"url"`      // Оригинальный URL из запроса
+	UserIDs []string `json:"user_ids"` // Идентификаторы (или их хеши) пользователей в порядке возрастания
+}
+
+// RotateUserResponse представляет ответ с новым идентификатором пользователя после ротации
+type RotateUserResponse struct {
+	UserID string `json:"user_id"` // Новый идентификатор пользователя
+	Token  string `json:"token"`   // JWT для нового идентификатора (также выдаётся в cookie jwt)
+	URLs   int    `json:"urls"`    // Количество URL, переданных новому идентификатору
 }
 
-// ShortenResponse представляет ответ с сокращённым URL в JSON формате
-type ShortenResponse struct {
-	Result string `json:"result"` // Сокращённый URL
+// SwitchUserResponse представляет ответ с токеном для выбранного пользователя
+type SwitchUserResponse struct {
+	UserID string `json:"user_id"` // Идентификатор пользователя
+	Token  string `json:"token"`   // JWT для cookie jwt
 }
 
-// ExpandResponse представляет ответ с оригинальным URL в JSON формате
-type ExpandResponse struct {
-	URL string `json:"url"` // Оригинальный URL
+// DeleteByHostResponse представляет ответ на удаление URL пользователя по хосту
+type DeleteByHostResponse struct {
+	Deleted int `json:"deleted"` // Количество удалённых URL
+}
+
+// ErrorResponse представляет ответ с описанием ошибки в JSON формате
+type ErrorResponse struct {
+	Error  string       `json:"error"`            // Описание ошибки
+	Fields []FieldError `json:"fields,omitempty"` // Ошибки в отдельных полях тела запроса
 }
 
 // App содержит HTTP хендлеры и зависимости для обработки запросов к сервису сокращения URL
 type App struct {
-	svc    *service.Service    // Сервис для бизнес-логики
-	db     repository.Database // Интерфейс для работы с базой данных
-	logger *zap.Logger         // Логгер для записи событий
+	svc         *service.Service    // Сервис для бизнес-логики
+	db          repository.Database // Интерфейс для работы с базой данных
+	logger      *zap.Logger         // Логгер для записи событий
+	refQueryKey string              // Имя query-параметра для метки кампании
+	draining    atomic.Bool         // Флаг остановки: /readyz отвечает 503
+
+	enabledEndpoints map[string]struct{}         // Включённые эндпоинты; пустой набор означает все
+	robotsPolicy     string                      // Политика индексации для /robots.txt
+	shortURLHeader   string                      // Заголовок ответа с созданным коротким URL
+	strictJSON       bool                        // Отклонять неизвестные поля в JSON-запросах
+	strictPlainType  bool                        // Требовать text/plain или application/x-gzip для POST /
+	pages            *ui.Pages                   // Локализованные HTML-страницы ошибок для браузеров; nil — только текстовые ответы
+	faults           *repository.FaultRepository // Управляемые сбои хранилища; nil — внедрение сбоев выключено
+	cookieMaxAge     time.Duration               // Время жизни cookie с JWT, выдаваемой обработчиками
+	missDelay        time.Duration               // Верхняя граница выравнивания времени ответа на редирект; 0 — без задержки
+	forwardedHosts   map[string]struct{}         // Хосты из X-Forwarded-Host, для которых короткие URL строятся на домене запроса
+	maxDeleteBatch   int                         // Максимальное число ID в запросе пакетного удаления; 0 — без ограничения
+	healthPath       string                      // Дополнительный путь проверки готовности; пустой — только /readyz
+	eventsHeartbeat  time.Duration               // Интервал пульсов в потоке событий /api/internal/events/stream
+	fieldNaming      string                      // Именование полей в JSON-ответах (FieldNamingSnake или FieldNamingCamel)
+	sleep            func(ctx context.Context, d time.Duration)
+
+	disabledFeatures features.Set // Отключённые возможности, маршруты которых не регистрируются
+	dedupStatus      int          // Статус ответа на сокращение уже существующего URL
+	shortenResponse  string       // Режим ответа POST /api/shorten (ShortenResponseBody или ShortenResponseLocation)
+
+	redirectMemo *redirectMemo // Память повторов редиректа; nil — каждый редирект обращается к хранилищу
+
+	trustedSubnet string                           // Подсеть, которой доступны сведения о чужих ссылках; пустая — только владельцу
+	trustedOpts   []middleware.TrustedSubnetOption // Проверки доверенной подсети: источник IP и токены X-Internal-Token
+
+	referrerSlots chan struct{} // Слоты фоновых записей источников переходов
+
+	storageErrors *repository.InstrumentedRepository // Журнал последних ошибок хранилища; nil — эндпоинт /api/internal/errors выключен
+
+	dbWatched  atomic.Bool  // За соединением с базой данных наблюдает WatchDatabase
+	dbFailures atomic.Int64 // Неудачные проверки соединения с базой данных подряд
+}
+
+// DefaultShortURLHeader — заголовок ответа с созданным коротким URL по умолчанию
+const DefaultShortURLHeader = "X-Short-URL"
+
+// NewApp создаёт новый экземпляр App с указанными зависимостями и необязательными параметрами
+func NewApp(svc *service.Service, db repository.Database, logger *zap.Logger, opts ...Option) *App {
+	a := &App{
+		svc:            svc,
+		db:             db,
+		logger:         logger,
+		refQueryKey:    "ref",
+		robotsPolicy:   RobotsPolicyDeny,
+		shortURLHeader: DefaultShortURLHeader,
+		cookieMaxAge:   middleware.DefaultCookieMaxAge,
+		sleep:          sleepContext,
+
+		eventsHeartbeat: DefaultEventsHeartbeat,
+		fieldNaming:     FieldNamingSnake,
+		dedupStatus:     http.StatusConflict,
+		shortenResponse: ShortenResponseBody,
+
+		referrerSlots: make(chan struct{}, maxPendingReferrers),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	// Без UI браузеры получают те же текстовые ответы, что и API-клиенты
+	if a.disabledFeatures.Disabled(features.UI) {
+		a.pages = nil
+	}
+	return a
+}
+
+// createShortURL создаёт короткий URL и возвращает его ID и сам URL или ошибку
+func (a *App) createShortURL(originalURL string, userID string) (string, string, error) {
+	return a.createTaggedShortURL(originalURL, userID, nil, "")
+}
+
+// createTaggedShortURL создаёт короткий URL с необязательными метками и описанием и возвращает его ID и сам URL или ошибку
+func (a *App) createTaggedShortURL(originalURL string, userID string, tags []string, description string) (string, string, error) {
+	if originalURL == "" {
+		return "", "", service.ErrEmptyURL
+	}
+	originalURL = a.normalizeURL(originalURL)
+	if _, err := url.ParseRequestURI(originalURL); err != nil {
+		return "", "", service.ErrInvalidURL
+	}
+	return a.svc.CreateShortURLWithDetails(originalURL, userID, tags, description)
 }
 
-// NewApp создаёт новый экземпляр App с указанными зависимостями
-func NewApp(svc *service.Service, db repository.Database, logger *zap.Logger) *App {
-	return &App{
-		svc:    svc,
-		db:     db,
-		logger: logger,
+// createForceNewShortURL создаёт новый короткий URL, даже если URL уже сокращён; claimable выдаёт токен владения
+func (a *App) createForceNewShortURL(originalURL string, userID string, tags []string, description string, claimable bool) (string, string, string, error) {
+	if originalURL == "" {
+		return "", "", "", service.ErrEmptyURL
+	}
+	originalURL = a.normalizeURL(originalURL)
+	if _, err := url.ParseRequestURI(originalURL); err != nil {
+		return "", "", "", service.ErrInvalidURL
 	}
+	return a.svc.CreateShortURLForceNew(originalURL, userID, tags, description, claimable)
 }
 
-// createShortURL создаёт короткий URL и возвращает его или ошибку
-func (a *App) createShortURL(originalURL string, userID string) (string, error) {
+// createClaimableShortURL создаёт короткий URL с токеном владения после валидации оригинального URL
+func (a *App) createClaimableShortURL(originalURL string, userID string, tags []string, description string) (string, string, string, error) {
 	if originalURL == "" {
-		return "", errors.New("empty URL")
+		return "", "", "", service.ErrEmptyURL
 	}
+	originalURL = a.normalizeURL(originalURL)
 	if _, err := url.ParseRequestURI(originalURL); err != nil {
-		return "", errors.New("invalid URL")
+		return "", "", "", service.ErrInvalidURL
+	}
+	return a.svc.CreateClaimableShortURL(originalURL, userID, tags, description)
+}
+
+// setShortURLHeader дублирует короткий URL в заголовке ответа, чтобы клиентам не нужно было разбирать тело
+func (a *App) setShortURLHeader(w http.ResponseWriter, shortURL string) {
+	w.Header().Set(a.shortURLHeader, shortURL)
+}
+
+// rebaseShortURL переносит короткий URL на домен из X-Forwarded-Host, если тот разрешён WithForwardedHosts
+// Путь базового URL сохраняется; схема берётся из X-Forwarded-Proto (http или https), иначе из базового URL
+func (a *App) rebaseShortURL(r *http.Request, shortURL string) string {
+	if len(a.forwardedHosts) == 0 || shortURL == "" {
+		return shortURL
+	}
+	// Цепочка прокси перечисляет хосты через запятую; хост клиента — первый
+	host, _, _ := strings.Cut(r.Header.Get("X-Forwarded-Host"), ",")
+	host = strings.ToLower(strings.TrimSpace(host))
+	if _, allowed := a.forwardedHosts[host]; !allowed {
+		return shortURL
+	}
+	urls := a.svc.URLBuilder()
+	id, err := urls.Parse(shortURL)
+	if err != nil {
+		return shortURL
 	}
-	shortURL, err := a.svc.CreateShortURL(originalURL, userID)
-	return shortURL, err
+	base, err := url.Parse(urls.Base())
+	if err != nil {
+		return shortURL
+	}
+	base.Host = host
+	if proto := strings.ToLower(strings.TrimSpace(r.Header.Get("X-Forwarded-Proto"))); proto == "http" || proto == "https" {
+		base.Scheme = proto
+	}
+	return urls.WithBase(base.String()).Build(id)
 }
 
 // HandlePostURL обрабатывает POST-запросы на "/" для сокращения URL через plain text
@@ -68,11 +253,8 @@ func (a *App) HandlePostURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Проверяем Content-Type для сжатых запросов
-	if r.Header.Get("Content-Encoding") == "gzip" &&
-		!strings.Contains(r.Header.Get("Content-Type"), "text/plain") &&
-		!strings.Contains(r.Header.Get("Content-Type"), "application/x-gzip") {
-		http.Error(w, "Invalid Content-Type for gzip request", http.StatusBadRequest)
+	if a.strictPlainType && !isPlainContentType(r.Header.Get("Content-Type")) {
+		http.Error(w, "Content-Type must be text/plain", http.StatusBadRequest)
 		return
 	}
 
@@ -87,20 +269,28 @@ func (a *App) HandlePostURL(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to read request body", http.StatusBadRequest)
 		return
 	}
+	body, err = decodeBody(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		http.Error(w, err.Error(), charsetErrorStatus(err))
+		return
+	}
 	originalURL := strings.TrimSpace(string(body))
-	shortURL, err := a.createShortURL(originalURL, userID)
+	_, shortURL, err := a.createShortURL(originalURL, userID)
+	shortURL = a.rebaseShortURL(r, shortURL)
 	if err != nil {
 		if errors.Is(err, repository.ErrURLExists) {
+			a.setShortURLHeader(w, shortURL)
 			w.Header().Set("Content-Type", "text/plain")
-			w.WriteHeader(http.StatusConflict)
+			w.WriteHeader(a.dedupStatus)
 			if _, writeErr := w.Write([]byte(shortURL)); writeErr != nil {
 				http.Error(w, "Failed to write response", http.StatusInternalServerError)
 			}
 			return
 		}
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		a.writeServiceError(w, err)
 		return
 	}
+	a.setShortURLHeader(w, shortURL)
 	w.Header().Set("Content-Type", "text/plain")
 	w.WriteHeader(http.StatusCreated)
 	if _, err := w.Write([]byte(shortURL)); err != nil {
@@ -109,31 +299,165 @@ func (a *App) HandlePostURL(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// HandleGetURL обрабатывает GET-запросы на "/{id}" для получения оригинального URL по короткому ID
+// isPlainContentType проверяет, что Content-Type допустим для POST / в строгом режиме
+func isPlainContentType(contentType string) bool {
+	return strings.Contains(contentType, "text/plain") || strings.Contains(contentType, "application/x-gzip")
+}
+
+// reservedRefSuffixes содержит метки, которые нельзя использовать в адресе вида /{id}+{suffix},
+// чтобы они не путались со служебными путями ссылки вроде /{id}/info
+var reservedRefSuffixes = map[string]struct{}{
+	"info": {},
+}
+
+// maxRefSuffixLen ограничивает длину метки кампании в адресе вида /{id}+{suffix}
+const maxRefSuffixLen = 32
+
+// splitRefSuffix отделяет метку кампании от короткого ID в адресе вида {id}+{suffix}
+func splitRefSuffix(param string) (id string, suffix string, hasSuffix bool) {
+	id, suffix, hasSuffix = strings.Cut(param, "+")
+	return id, suffix, hasSuffix
+}
+
+// isValidRefSuffix проверяет, что метка кампании состоит только из латинских букв и цифр и не длиннее maxRefSuffixLen
+func isValidRefSuffix(suffix string) bool {
+	if suffix == "" || len(suffix) > maxRefSuffixLen {
+		return false
+	}
+	if _, reserved := reservedRefSuffixes[strings.ToLower(suffix)]; reserved {
+		return false
+	}
+	for _, c := range suffix {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// appendRefQuery добавляет метку кампании в query оригинального URL, сохраняя существующие параметры
+func appendRefQuery(originalURL, key, suffix string) (string, error) {
+	u, err := url.Parse(originalURL)
+	if err != nil {
+		return "", err
+	}
+	param := url.QueryEscape(key) + "=" + url.QueryEscape(suffix)
+	if u.RawQuery == "" {
+		u.RawQuery = param
+	} else {
+		u.RawQuery += "&" + param
+	}
+	return u.String(), nil
+}
+
+// HandleGetURL обрабатывает GET-запросы на "/{id}" (или путь по шаблону коротких URL сервиса) для получения оригинального URL по короткому ID
+// Адрес вида "/{id}+{suffix}" перенаправляет на оригинальный URL с меткой кампании в query-параметре
 func (a *App) HandleGetURL(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusBadRequest)
 		return
 	}
-	id := chi.URLParam(r, "id")
+	id, suffix, hasSuffix := splitRefSuffix(chi.URLParam(r, "id"))
 	if id == "" {
 		http.Error(w, "Missing URL ID", http.StatusBadRequest)
 		return
 	}
-	originalURL, exists := a.svc.GetOriginalURL(id)
-	if !exists {
-		u, found := a.svc.Get(id)
-		if found && u.DeletedFlag {
+	if hasSuffix && !isValidRefSuffix(suffix) {
+		http.Error(w, "Invalid ref suffix", http.StatusBadRequest)
+		return
+	}
+	u, found, err := a.lookupRedirect(r, id)
+	if err != nil {
+		// Сбой хранилища не выдаётся за отсутствие ссылки, чтобы кеши не запомнили промах
+		a.writeServiceError(w, err)
+		return
+	}
+	if !found || u.DeletedFlag {
+		a.padResponse(r, start)
+		if found {
+			if a.writeErrorPage(w, r, http.StatusGone) {
+				return
+			}
 			http.Error(w, "URL is deleted", http.StatusGone)
 			return
 		}
+		if a.writeErrorPage(w, r, http.StatusNotFound) {
+			return
+		}
 		http.Error(w, "URL not found", http.StatusBadRequest)
 		return
 	}
+	originalURL := u.OriginalURL
+	if hasSuffix {
+		target, err := appendRefQuery(originalURL, a.refQueryKey, suffix)
+		if err != nil {
+			a.logger.Error("Failed to append ref suffix", zap.String("short_id", id), zap.Error(err))
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		a.logger.Info("Redirect with ref suffix",
+			zap.String("short_id", id),
+			zap.String("ref", suffix))
+		originalURL = target
+	}
+	a.svc.TrackClick(id, suffix)
+	if referrer := r.Referer(); referrer != "" && a.svc.TracksReferrers() {
+		a.recordReferrerAsync(id, referrer)
+	}
+	a.padResponse(r, start)
+	if u.NSFW {
+		a.writeNSFWInterstitial(w, r, id, originalURL)
+		return
+	}
 	w.Header().Set("Location", originalURL)
 	w.WriteHeader(http.StatusTemporaryRedirect)
 }
 
+// writeNSFWInterstitial отвечает страницей с предупреждением вместо редиректа на ссылку, помеченную как NSFW
+// Без HTML-страниц (WithPages) предупреждение и адрес отдаются текстом
+func (a *App) writeNSFWInterstitial(w http.ResponseWriter, r *http.Request, id, target string) {
+	if a.pages != nil {
+		err := a.pages.WriteNSFWInterstitial(w, r, target)
+		if err == nil {
+			return
+		}
+		a.logger.Error("Failed to render NSFW interstitial", zap.String("short_id", id), zap.Error(err))
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprintf(w, "This link is marked as NSFW.\nContinue: %s\n", target)
+}
+
+// padResponse задерживает ответ на редирект до случайного момента от missDelay/2 до missDelay после start
+// Выравниваются и попадания, и промахи: иначе существующий ID отличался бы от несуществующего по времени ответа
+func (a *App) padResponse(r *http.Request, start time.Time) {
+	if a.missDelay <= 0 {
+		return
+	}
+	half := a.missDelay / 2
+	floor := half + time.Duration(rand.Int63n(int64(a.missDelay-half)+1))
+	if d := floor - time.Since(start); d > 0 {
+		a.sleep(r.Context(), d)
+	}
+}
+
+// sleepContext ждёт d или отмены контекста
+func sleepContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// writeErrorPage отвечает локализованной HTML-страницей ошибки, если страницы включены и клиент ожидает HTML
+func (a *App) writeErrorPage(w http.ResponseWriter, r *http.Request, status int) bool {
+	return a.pages != nil && ui.AcceptsHTML(r) && a.pages.WriteError(w, r, status)
+}
+
 // HandleJSONShorten обрабатывает POST-запросы на "/api/shorten" для сокращения URL через JSON API
 func (a *App) HandleJSONShorten(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -144,14 +468,29 @@ func (a *App) HandleJSONShorten(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
 		return
 	}
-	// Проверяем, что запрос не сжат некорректно
-	if r.Header.Get("Content-Encoding") == "gzip" && !strings.Contains(r.Header.Get("Content-Type"), "application/json") {
-		http.Error(w, "Invalid Content-Type for gzip request", http.StatusBadRequest)
+	mode, ok := shortenModeOf(r)
+	if !ok {
+		http.Error(w, "Invalid mode: want "+ShortenModeCreateOnly+" or "+ShortenModeForceNew, http.StatusBadRequest)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	body, err = decodeBody(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		http.Error(w, err.Error(), charsetErrorStatus(err))
 		return
 	}
 	var reqBody ShortenRequest
-	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if err := decodeJSONObject(bytes.NewReader(body), &reqBody, a.strictJSON); err != nil {
+		a.writeRequestError(w, err)
+		return
+	}
+	reqBody.URL = a.normalizeURL(reqBody.URL)
+	if err := validateShortenRequest(reqBody); err != nil {
+		a.writeRequestError(w, err)
 		return
 	}
 
@@ -161,22 +500,64 @@ func (a *App) HandleJSONShorten(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	shortURL, err := a.createShortURL(reqBody.URL, userID)
+	// Анонимный пользователь теряет cookie вместе с сессией, поэтому получает токен для передачи ссылки себе позже
+	var id, shortURL, claimToken string
+	switch {
+	case mode == ShortenModeForceNew:
+		id, shortURL, claimToken, err = a.createForceNewShortURL(reqBody.URL, userID, reqBody.Tags, reqBody.Description, middleware.IsNewIdentity(r))
+	case middleware.IsNewIdentity(r):
+		id, shortURL, claimToken, err = a.createClaimableShortURL(reqBody.URL, userID, reqBody.Tags, reqBody.Description)
+	default:
+		id, shortURL, err = a.createTaggedShortURL(reqBody.URL, userID, reqBody.Tags, reqBody.Description)
+	}
+	shortURL = a.rebaseShortURL(r, shortURL)
 	if err != nil {
 		if errors.Is(err, repository.ErrURLExists) {
-			respBody := ShortenResponse{
-				Result: shortURL,
+			if mode == ShortenModeCreateOnly {
+				a.writeShortenResponse(w, r, http.StatusConflict, shortURL, id, "", ErrorCodeCreateOnly)
+				return
 			}
-			a.writeJSONResponse(w, http.StatusConflict, respBody)
+			a.writeShortenResponse(w, r, a.dedupStatus, shortURL, id, "", "")
 			return
 		}
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		a.writeServiceError(w, err)
+		return
+	}
+	a.writeShortenResponse(w, r, http.StatusCreated, shortURL, id, claimToken, "")
+}
+
+// writeShortenResponse отвечает на "/api/shorten" полным коротким URL или, если клиент запросил режим ответа id, только кодом
+// Заголовок с коротким URL передаётся в обоих режимах. В режиме ShortenResponseLocation тела нет:
+// короткий URL передаётся в Location, токен владения — в ClaimTokenHeader, а код ошибки errorCode — в ErrorCodeHeader
+func (a *App) writeShortenResponse(w http.ResponseWriter, r *http.Request, status int, shortURL, id, claimToken, errorCode string) {
+	a.setShortURLHeader(w, shortURL)
+	if a.shortenResponse == ShortenResponseLocation {
+		w.Header().Set("Location", shortURL)
+		if claimToken != "" {
+			w.Header().Set(ClaimTokenHeader, claimToken)
+		}
+		if errorCode != "" {
+			w.Header().Set(ErrorCodeHeader, errorCode)
+		}
+		w.WriteHeader(status)
+		return
+	}
+	if wantsIDResponse(r) {
+		a.writeJSONResponse(w, status, ShortenIDResponse{ID: id, ClaimToken: claimToken, Error: errorCode})
 		return
 	}
-	respBody := ShortenResponse{
-		Result: shortURL,
+	a.writeJSONResponse(w, status, ShortenResponse{Result: shortURL, ClaimToken: claimToken, Error: errorCode})
+}
+
+// responseModeID — режим ответа, в котором эндпоинты сокращения возвращают короткий ID вместо полного URL
+const responseModeID = "id"
+
+// wantsIDResponse сообщает, запросил ли клиент режим ответа id параметром ?response=id или заголовком Prefer: response=id
+func wantsIDResponse(r *http.Request) bool {
+	if r.URL.Query().Get("response") == responseModeID {
+		return true
 	}
-	a.writeJSONResponse(w, http.StatusCreated, respBody)
+	return hasPreference(r, "response="+responseModeID)
 }
 
 // HandleJSONExpand обрабатывает GET-запросы на "/api/expand/{id}" для получения оригинального URL через JSON API
@@ -186,19 +567,84 @@ func (a *App) HandleJSONExpand(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	id := chi.URLParam(r, "id")
-	originalURL, exists := a.svc.GetOriginalURL(id)
-	if !exists {
-		a.writeJSONResponse(w, http.StatusBadRequest, struct {
-			Error string `json:"error"`
-		}{Error: "URL not found"})
+	u, found, err := a.svc.Get(id)
+	if err != nil {
+		a.writeServiceError(w, err)
+		return
+	}
+	if !found || u.DeletedFlag {
+		if found {
+			a.writeJSONResponse(w, http.StatusGone, ErrorResponse{Error: "URL is deleted"})
+			return
+		}
+		a.writeJSONResponse(w, http.StatusNotFound, ErrorResponse{Error: "URL not found"})
 		return
 	}
 	respBody := ExpandResponse{
-		URL: originalURL,
+		URL:  u.OriginalURL,
+		NSFW: u.NSFW,
+	}
+	// Анонимному запросу владение не сообщается
+	if _, ok := knownUserID(r); ok {
+		owned := a.ownsURL(r, u)
+		respBody.Owned = &owned
+	}
+	if u.NSFW {
+		w.Header().Set("X-Robots-Tag", "noindex, nofollow")
 	}
 	a.writeJSONResponse(w, http.StatusOK, respBody)
 }
 
+// HandleLinkInfo обрабатывает GET-запросы на "/{id}/info" и возвращает сведения о ссылке строками "ключ: значение"
+// в text/plain для скриптов. Сведения доступны владельцу ссылки и запросам из доверенной подсети, остальным — 403
+func (a *App) HandleLinkInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, _, hasSuffix := splitRefSuffix(chi.URLParam(r, "id"))
+	if id == "" || hasSuffix {
+		http.Error(w, "Invalid URL ID", http.StatusBadRequest)
+		return
+	}
+	u, found, err := a.svc.Get(id)
+	if err != nil {
+		a.writeServiceError(w, err)
+		return
+	}
+	if !found {
+		http.Error(w, "URL not found", http.StatusNotFound)
+		return
+	}
+	if !a.ownsURL(r, u) && !a.fromTrustedSubnet(r) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = fmt.Fprintf(w, "original_url: %s\ncreated_at: %s\ndeleted: %t\nhits: %d\n",
+		u.OriginalURL, u.CreatedAt.UTC().Format(time.RFC3339), u.DeletedFlag, a.svc.Hits(id))
+}
+
+// ownsURL проверяет, что ссылка создана пользователем запроса; только что выданный идентификатор владельцем не считается
+func (a *App) ownsURL(r *http.Request, u models.URL) bool {
+	userID, ok := knownUserID(r)
+	return ok && userID == u.UserID
+}
+
+// knownUserID возвращает идентификатор пользователя запроса, если он не выдан только что, то есть пользователь не анонимен
+func knownUserID(r *http.Request) (string, bool) {
+	userID, ok := middleware.GetUserID(r)
+	return userID, ok && userID != "" && !middleware.IsNewIdentity(r)
+}
+
+// fromTrustedSubnet проверяет запрос по тем же правилам, что и /api/internal: X-Real-IP (или адрес соединения,
+// см. WithClientIPHeader) входит в подсеть WithTrustedSubnet, а с WithInternalTokens передан действующий токен
+func (a *App) fromTrustedSubnet(r *http.Request) bool {
+	return middleware.TrustedRequest(r, a.trustedSubnet, a.trustedOpts...)
+}
+
 // HandlePing обрабатывает GET-запросы на "/ping" для проверки соединения с базой данных
 func (a *App) HandlePing(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -216,7 +662,102 @@ func (a *App) HandlePing(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// Политики индексации для /robots.txt
+const (
+	RobotsPolicyDeny = "deny" // запрещает индексацию всего сервиса
+	RobotsPolicyUI   = "ui"   // разрешает индексацию только главной страницы
+)
+
+// robotsBodies содержит тело /robots.txt для каждой политики
+var robotsBodies = map[string]string{
+	RobotsPolicyDeny: "User-agent: *\nDisallow: /\n",
+	RobotsPolicyUI:   "User-agent: *\nAllow: /$\nDisallow: /\n",
+}
+
+// HandleRobots обрабатывает GET-запросы на "/robots.txt", запрещая поисковикам индексировать короткие ссылки
+func (a *App) HandleRobots(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, ok := robotsBodies[a.robotsPolicy]
+	if !ok {
+		body = robotsBodies[RobotsPolicyDeny]
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(body))
+}
+
+// HandleFavicon обрабатывает GET-запросы на "/favicon.ico" без обращения к хранилищу
+func (a *App) HandleFavicon(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleReadyz обрабатывает GET-запросы на "/readyz" для проверки готовности принимать трафик
+// Во время остановки сервера или при рассогласовании хранилища возвращает 503, чтобы балансировщик исключил экземпляр
+func (a *App) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.draining.Load() {
+		http.Error(w, "Shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	if !a.svc.StorageHealthy() {
+		http.Error(w, "Storage is stale", http.StatusServiceUnavailable)
+		return
+	}
+	if a.dbWatched.Load() {
+		a.writeDBHealth(w)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// ErrInvalidHealthPath возвращается, если путь проверки готовности может совпасть с коротким ID или служебным путём
+var ErrInvalidHealthPath = errors.New("invalid health path")
+
+// ValidateHealthPath проверяет дополнительный путь проверки готовности
+// Путь вида "/{prefix}/..." не совпадает с адресами "/{id}", только если prefix зарезервирован под служебные пути (например, api)
+func ValidateHealthPath(path string) error {
+	rest, ok := strings.CutPrefix(path, "/")
+	if !ok {
+		return fmt.Errorf("%w: %q must start with /", ErrInvalidHealthPath, path)
+	}
+	prefix, tail, nested := strings.Cut(rest, "/")
+	if !nested || tail == "" || !service.IsReservedID(prefix) {
+		return fmt.Errorf("%w: %q must start with a reserved prefix such as /api/", ErrInvalidHealthPath, path)
+	}
+	if strings.ContainsAny(path, "{}*?#") || strings.Contains(path, "//") {
+		return fmt.Errorf("%w: %q must be a plain path", ErrInvalidHealthPath, path)
+	}
+	return nil
+}
+
+// Drain переводит /readyz в состояние 503 и ждёт delay, не прерывая обработку остальных запросов
+// Возвращается раньше, если контекст отменён
+func (a *App) Drain(ctx context.Context, delay time.Duration) {
+	a.draining.Store(true)
+	if delay <= 0 {
+		return
+	}
+	a.logger.Info("Draining connections before shutdown", zap.Duration("delay", delay))
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
 // HandleBatchShorten обрабатывает POST-запросы на "/api/shorten/batch" для пакетного сокращения URL
+// Ответы возвращаются в порядке запросов с теми же correlation_id
 func (a *App) HandleBatchShorten(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusBadRequest)
@@ -226,24 +767,17 @@ func (a *App) HandleBatchShorten(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
 		return
 	}
-	var reqBody []models.BatchRequest
-	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	reqBody, err := decodeJSONArray[models.BatchRequest](r.Body, a.strictJSON)
+	if err != nil {
+		a.writeRequestError(w, err)
 		return
 	}
-	if len(reqBody) == 0 {
-		http.Error(w, "Empty batch", http.StatusBadRequest)
-		return
+	for i := range reqBody {
+		reqBody[i].OriginalURL = a.normalizeURL(reqBody[i].OriginalURL)
 	}
-	for _, req := range reqBody {
-		if req.CorrelationID == "" {
-			http.Error(w, "Missing correlation_id", http.StatusBadRequest)
-			return
-		}
-		if _, err := url.ParseRequestURI(req.OriginalURL); err != nil {
-			http.Error(w, "Invalid URL", http.StatusBadRequest)
-			return
-		}
+	if err := validateBatchRequests(reqBody); err != nil {
+		a.writeRequestError(w, err)
+		return
 	}
 
 	userID, ok := middleware.GetUserID(r)
@@ -252,55 +786,155 @@ func (a *App) HandleBatchShorten(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respBody, err := a.svc.BatchShorten(reqBody, userID)
+	respBody, err := a.svc.BatchShortenContext(r.Context(), reqBody, userID)
+	idOnly := wantsIDResponse(r)
+	for i := range respBody {
+		if idOnly {
+			respBody[i].ShortURL = ""
+			continue
+		}
+		respBody[i].ShortURL = a.rebaseShortURL(r, respBody[i].ShortURL)
+	}
 	if err != nil {
+		// Клиент закрыл соединение: ответ никто не прочитает
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			a.logger.Info("Batch shorten aborted", zap.String("user_id", userID), zap.Error(err))
+			return
+		}
 		if errors.Is(err, repository.ErrURLExists) {
-			a.writeJSONResponse(w, http.StatusConflict, respBody)
+			a.writeBatchResponse(w, http.StatusConflict, respBody)
+			return
+		}
+		a.writeServiceError(w, err)
+		return
+	}
+	a.writeBatchResponse(w, http.StatusCreated, respBody)
+}
+
+// writeBatchResponse потоково кодирует ответ пакетного сокращения в JSON-массив,
+// не собирая весь JSON в памяти, чтобы расход памяти не рос вместе с размером пакета
+func (a *App) writeBatchResponse(w http.ResponseWriter, status int, items []models.BatchResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	bw := bufio.NewWriterSize(w, batchWriteBufferSize)
+	var item bytes.Buffer
+	encoder := json.NewEncoder(&item)
+	encoder.SetEscapeHTML(false)
+
+	if err := bw.WriteByte('['); err != nil {
+		a.logger.Warn("Failed to write batch response", zap.Error(err))
+		return
+	}
+	for i := range items {
+		if i > 0 {
+			if err := bw.WriteByte(','); err != nil {
+				a.logger.Warn("Failed to write batch response", zap.Error(err))
+				return
+			}
+		}
+		item.Reset()
+		if err := encoder.Encode(&items[i]); err != nil {
+			a.logger.Error("Failed to encode batch response item", zap.Error(err))
 			return
 		}
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		// Убираем перенос строки, который добавляет json.Encoder
+		data, err := a.applyFieldNaming(bytes.TrimSuffix(item.Bytes(), []byte{'\n'}))
+		if err != nil {
+			a.logger.Error("Failed to encode batch response item", zap.Error(err))
+			return
+		}
+		if _, err := bw.Write(data); err != nil {
+			a.logger.Warn("Failed to write batch response", zap.Error(err))
+			return
+		}
+	}
+	if err := bw.WriteByte(']'); err != nil {
+		a.logger.Warn("Failed to write batch response", zap.Error(err))
 		return
 	}
-	a.writeJSONResponse(w, http.StatusCreated, respBody)
+	if err := bw.Flush(); err != nil {
+		a.logger.Warn("Failed to write batch response", zap.Error(err))
+	}
 }
 
 // HandleUserURLs обрабатывает GET-запросы на "/api/user/urls" для получения всех URL пользователя
+// Параметр запроса tag ограничивает выдачу ссылками с указанной меткой,
+// параметр fields (например, fields=short_url,short_id) — поля каждой ссылки в ответе
 func (a *App) HandleUserURLs(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusBadRequest)
 		return
 	}
 
+	var fields []string
+	if raw := r.URL.Query().Get("fields"); raw != "" {
+		var err error
+		if fields, err = userURLFields.parse(raw); err != nil {
+			http.Error(w, "Invalid fields: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	urls, err := a.svc.GetURLsByUserID(userID)
+	// Ревизию берём до выборки: запись, попавшая между ними, сменит ETag следующего ответа
+	var etag string
+	if revision, ok := a.svc.UserURLsRevision(userID); ok {
+		etag = userURLsETag(revision, userID, r)
+		if etagMatches(r.Header.Get("If-None-Match"), etag) {
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	var urls []models.ShortURLResponse
+	var err error
+	if tag := r.URL.Query().Get("tag"); tag != "" {
+		urls, err = a.svc.GetURLsByUserAndTag(userID, tag)
+	} else {
+		urls, err = a.svc.GetURLsByUserIDContext(r.Context(), userID)
+	}
 	if err != nil {
+		// Запрос отменён или истёк его срок: ответ никто не прочитает
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			a.logger.Info("User URLs request aborted", zap.String("user_id", userID), zap.Error(err))
+			return
+		}
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
 	if len(urls) == 0 {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
+	for i := range urls {
+		urls[i].ShortURL = a.rebaseShortURL(r, urls[i].ShortURL)
+	}
 
+	if fields != nil {
+		a.writeJSONResponse(w, http.StatusOK, userURLFields.project(urls, fields))
+		return
+	}
 	a.writeJSONResponse(w, http.StatusOK, urls)
 }
 
 // HandleBatchDeleteURLs обрабатывает DELETE-запросы на "/api/user/urls" для пакетного удаления URL пользователя
+// С параметром domain удаляет все URL пользователя на этом хосте синхронно и возвращает их количество
 func (a *App) HandleBatchDeleteURLs(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		http.Error(w, "Method not allowed", http.StatusBadRequest)
 		return
 	}
-	if !strings.Contains(r.Header.Get("Content-Type"), "application/json") {
-		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
-		return
-	}
 
 	userID, ok := middleware.GetUserID(r)
 	if !ok {
@@ -308,9 +942,23 @@ func (a *App) HandleBatchDeleteURLs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var ids []string
-	if err := json.NewDecoder(r.Body).Decode(&ids); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if query := r.URL.Query(); query.Has("domain") {
+		a.deleteByHost(w, userID, query.Get("domain"))
+		return
+	}
+
+	if !strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+		return
+	}
+
+	ids, err := decodeJSONArray[string](r.Body, a.strictJSON)
+	if err != nil {
+		a.writeRequestError(w, err)
+		return
+	}
+	if err := validateShortIDs(ids, a.maxDeleteBatch); err != nil {
+		a.writeRequestError(w, err)
 		return
 	}
 
@@ -320,6 +968,249 @@ func (a *App) HandleBatchDeleteURLs(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusAccepted)
 }
 
+// deleteByHost удаляет URL пользователя, ведущие на хост, и отвечает количеством удалённых
+func (a *App) deleteByHost(w http.ResponseWriter, userID, host string) {
+	if host == "" {
+		a.writeRequestError(w, &requestError{message: validationFailedMessage, fields: []FieldError{{Field: "domain", Error: "required"}}})
+		return
+	}
+
+	deleted, err := a.svc.DeleteByHost(userID, host)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidHost) {
+			a.writeRequestError(w, &requestError{message: validationFailedMessage, fields: []FieldError{{Field: "domain", Error: err.Error()}}})
+			return
+		}
+		a.logger.Error("Failed to delete URLs by host", zap.String("user_id", userID), zap.String("host", host), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	a.writeJSONResponse(w, http.StatusOK, DeleteByHostResponse{Deleted: deleted})
+}
+
+// HandleUserStats обрабатывает GET-запросы на "/api/user/stats" для получения статистики пользователя
+func (a *App) HandleUserStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	stats, err := a.svc.GetUserStats(userID)
+	if err != nil {
+		a.logger.Error("Failed to get user stats", zap.String("user_id", userID), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	a.writeJSONResponse(w, http.StatusOK, stats)
+}
+
+// HandleLogout обрабатывает POST-запросы на "/api/user/logout": удаляет cookie с JWT,
+// чтобы следующий запрос получил новый идентификатор пользователя
+func (a *App) HandleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	middleware.ExpireAuthCookie(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleRotateUser обрабатывает POST-запросы на "/api/user/rotate": выдаёт пользователю новый идентификатор,
+// передаёт ему все URL и устанавливает cookie с новым JWT
+// Прежний токен остаётся валидным, но указывает на пользователя без URL, поэтому утёкший токен теряет доступ к ссылкам
+func (a *App) HandleRotateUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := middleware.GetUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	newUserID, moved, err := a.svc.RotateUserID(userID)
+	if err != nil {
+		a.writeServiceError(w, err)
+		return
+	}
+	token, err := a.svc.GenerateJWT(newUserID)
+	if err != nil {
+		a.logger.Error("Failed to generate JWT for rotated user", zap.String("user_id", newUserID), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	a.logger.Named("audit").Info("User identity rotated",
+		zap.String("old_user_id", userID),
+		zap.String("new_user_id", newUserID),
+		zap.Int("urls", moved),
+		zap.String("remote_addr", r.RemoteAddr),
+	)
+
+	middleware.SetAuthCookie(w, token, a.cookieMaxAge)
+	a.writeJSONResponse(w, http.StatusOK, RotateUserResponse{UserID: newUserID, Token: token, URLs: moved})
+}
+
+// HandleClaimURL обрабатывает POST-запросы на "/api/urls/{id}/claim": передаёт анонимный URL текущему пользователю
+// по токену владения, выданному при создании. Токен одноразовый и не попадает в журналы
+func (a *App) HandleClaimURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := knownUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var reqBody ClaimURLRequest
+	if err := decodeJSONObject(r.Body, &reqBody, a.strictJSON); err != nil {
+		a.writeRequestError(w, err)
+		return
+	}
+	if reqBody.ClaimToken == "" {
+		a.writeRequestError(w, &requestError{message: validationFailedMessage, fields: []FieldError{{Field: "claim_token", Error: "required"}}})
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	resp, err := a.svc.ClaimURL(id, reqBody.ClaimToken, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrClaimRejected) {
+			a.writeJSONResponse(w, http.StatusForbidden, ErrorResponse{Error: "Invalid claim token"})
+			return
+		}
+		a.writeServiceError(w, err)
+		return
+	}
+
+	a.logger.Named("audit").Info("URL claimed",
+		zap.String("short_id", id),
+		zap.String("user_id", userID),
+		zap.String("remote_addr", r.RemoteAddr),
+	)
+
+	resp.ShortURL = a.rebaseShortURL(r, resp.ShortURL)
+	a.writeJSONResponse(w, http.StatusOK, resp)
+}
+
+// HandleUpdateURL обрабатывает PUT-запросы на "/api/urls/{id}": задаёт адрес назначения коду,
+// зарезервированному за текущим пользователем через "/api/internal/reserve"
+// Чужой или несуществующий код даёт 404, уже активированный — 409
+func (a *App) HandleUpdateURL(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := knownUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var reqBody UpdateURLRequest
+	if err := decodeJSONObject(r.Body, &reqBody, a.strictJSON); err != nil {
+		a.writeRequestError(w, err)
+		return
+	}
+	if reqBody.URL == "" {
+		a.writeRequestError(w, &requestError{message: validationFailedMessage, fields: []FieldError{{Field: "url", Error: "required"}}})
+		return
+	}
+	if _, err := url.ParseRequestURI(reqBody.URL); err != nil {
+		a.writeServiceError(w, service.ErrInvalidURL)
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	shortURL, err := a.svc.ActivateReservedURL(id, reqBody.URL, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrURLNotFound):
+			a.writeJSONResponse(w, http.StatusNotFound, ErrorResponse{Error: "URL not found"})
+		case errors.Is(err, repository.ErrNotReserved):
+			a.writeJSONResponse(w, http.StatusConflict, ErrorResponse{Error: "URL is already active"})
+		case errors.Is(err, repository.ErrURLExists):
+			a.writeJSONResponse(w, http.StatusConflict, ErrorResponse{Error: "URL already exists"})
+		default:
+			a.writeServiceError(w, err)
+		}
+		return
+	}
+
+	a.logger.Named("audit").Info("Reserved URL activated",
+		zap.String("short_id", id),
+		zap.String("user_id", userID),
+		zap.String("remote_addr", r.RemoteAddr),
+	)
+
+	shortURL = a.rebaseShortURL(r, shortURL)
+	a.setShortURLHeader(w, shortURL)
+	a.writeJSONResponse(w, http.StatusOK, ShortenResponse{Result: shortURL})
+}
+
+// HandleSwitchUser обрабатывает POST-запросы на "/api/user/switch": выдаёт JWT для указанного пользователя,
+// чтобы сотрудник поддержки мог действовать от его имени
+// Доступ ограничивается middleware доверенной подсети, каждая выдача записывается в журнал аудита
+func (a *App) HandleSwitchUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+		return
+	}
+
+	var reqBody SwitchUserRequest
+	if err := decodeJSONObject(r.Body, &reqBody, a.strictJSON); err != nil {
+		a.writeRequestError(w, err)
+		return
+	}
+	if reqBody.UserID == "" {
+		a.writeRequestError(w, &requestError{message: validationFailedMessage, fields: []FieldError{{Field: "user_id", Error: "required"}}})
+		return
+	}
+
+	token, err := a.svc.GenerateJWT(reqBody.UserID)
+	if err != nil {
+		a.logger.Error("Failed to generate JWT for user switch", zap.String("user_id", reqBody.UserID), zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	actorID, _ := middleware.GetUserID(r)
+	a.logger.Named("audit").Info("User impersonation",
+		zap.String("actor_user_id", actorID),
+		zap.String("target_user_id", reqBody.UserID),
+		zap.String("remote_addr", r.RemoteAddr),
+		zap.String("x_real_ip", r.Header.Get("X-Real-IP")),
+	)
+
+	a.writeJSONResponse(w, http.StatusOK, SwitchUserResponse{UserID: reqBody.UserID, Token: token})
+}
+
 // HandleStats обрабатывает GET-запросы на "/api/internal/stats" для получения статистики сервиса
 func (a *App) HandleStats(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -328,22 +1219,230 @@ func (a *App) HandleStats(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Получаем статистику через сервис
-	urls, users, err := a.svc.GetStats()
+	respBody, err := a.svc.GetDetailedStatsContext(r.Context())
 	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			a.logger.Info("Stats request aborted", zap.Error(err))
+			return
+		}
 		a.logger.Error("Failed to get stats", zap.Error(err))
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	// Формируем ответ
-	respBody := models.StatsResponse{
-		URLs:  urls,
-		Users: users,
+	a.writeJSONResponse(w, http.StatusOK, respBody)
+}
+
+// HandleTopUsers обрабатывает GET-запросы на "/api/internal/users/top?limit=N" для рейтинга пользователей по числу активных URL
+// Без limit возвращается service.DefaultTopUsersLimit пользователей, значения больше service.MaxTopUsersLimit ограничиваются
+func (a *App) HandleTopUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
 	}
 
-	a.writeJSONResponse(w, http.StatusOK, respBody)
+	limit := 0
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	users, err := a.svc.TopUsers(limit)
+	if err != nil {
+		a.logger.Error("Failed to get top users", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if users == nil {
+		users = []models.UserURLCount{}
+	}
+
+	a.writeJSONResponse(w, http.StatusOK, users)
+}
+
+// HandleURLOwners обрабатывает GET-запросы на "/api/internal/url-owners?url=..." и возвращает пользователей,
+// создавших ссылки на указанный URL. Имеет смысл при дедупликации по пользователю или без неё
+func (a *App) HandleURLOwners(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	originalURL := r.URL.Query().Get("url")
+	if originalURL == "" {
+		a.writeRequestError(w, &requestError{message: validationFailedMessage, fields: []FieldError{{Field: "url", Error: "required"}}})
+		return
+	}
+
+	userIDs, err := a.svc.URLOwners(originalURL)
+	if err != nil {
+		a.logger.Error("Failed to get URL owners", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if userIDs == nil {
+		userIDs = []string{}
+	}
+
+	a.writeJSONResponse(w, http.StatusOK, URLOwnersResponse{URL: originalURL, UserIDs: userIDs})
+}
+
+// HandleFlagNSFW обрабатывает POST-запросы на "/api/internal/flag-nsfw": модерация помечает ссылку как NSFW
+// (или снимает пометку), и вместо мгновенного редиректа по ней показывается страница с предупреждением
+func (a *App) HandleFlagNSFW(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+		return
+	}
+
+	var reqBody FlagNSFWRequest
+	if err := decodeJSONObject(r.Body, &reqBody, a.strictJSON); err != nil {
+		a.writeRequestError(w, err)
+		return
+	}
+	if reqBody.ID == "" {
+		a.writeRequestError(w, &requestError{message: validationFailedMessage, fields: []FieldError{{Field: "id", Error: "required"}}})
+		return
+	}
+	nsfw := reqBody.NSFW == nil || *reqBody.NSFW
+
+	if err := a.svc.SetNSFW(reqBody.ID, nsfw); err != nil {
+		if errors.Is(err, repository.ErrURLNotFound) {
+			a.writeJSONResponse(w, http.StatusNotFound, ErrorResponse{Error: "URL not found"})
+			return
+		}
+		a.writeServiceError(w, err)
+		return
+	}
+
+	a.logger.Named("audit").Info("URL NSFW flag changed",
+		zap.String("short_id", reqBody.ID),
+		zap.Bool("nsfw", nsfw),
+		zap.String("remote_addr", r.RemoteAddr),
+	)
+	a.writeJSONResponse(w, http.StatusOK, FlagNSFWRequest{ID: reqBody.ID, NSFW: &nsfw})
+}
+
+// maxReserveCount ограничивает число коротких ID, резервируемых одним запросом
+const maxReserveCount = 10000
+
+// HandleReserve обрабатывает POST-запросы на "/api/internal/reserve": резервирует короткие ID за пользователем
+// без адреса назначения, например для заранее напечатанных QR-кодов. До активации через PUT "/api/urls/{id}"
+// коды отвечают 404 и не учитываются в статистике
+func (a *App) HandleReserve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+		return
+	}
+
+	var reqBody ReserveRequest
+	if err := decodeJSONObject(r.Body, &reqBody, a.strictJSON); err != nil {
+		a.writeRequestError(w, err)
+		return
+	}
+	var fields []FieldError
+	if reqBody.Count <= 0 || reqBody.Count > maxReserveCount {
+		fields = append(fields, FieldError{Field: "count", Error: fmt.Sprintf("must be between 1 and %d", maxReserveCount)})
+	}
+	if reqBody.UserID == "" {
+		fields = append(fields, FieldError{Field: "user_id", Error: "required"})
+	}
+	if len(fields) > 0 {
+		a.writeRequestError(w, &requestError{message: validationFailedMessage, fields: fields})
+		return
+	}
+
+	ids, err := a.svc.ReserveShortIDs(reqBody.Count, reqBody.UserID)
+	if err != nil {
+		a.writeServiceError(w, err)
+		return
+	}
+
+	a.logger.Named("audit").Info("Short IDs reserved",
+		zap.String("user_id", reqBody.UserID),
+		zap.Int("count", len(ids)),
+		zap.String("remote_addr", r.RemoteAddr),
+	)
+	a.writeJSONResponse(w, http.StatusCreated, ReserveResponse{UserID: reqBody.UserID, IDs: ids})
+}
+
+// HandleHotLinks обрабатывает GET-запросы на "/api/internal/hotlinks" и возвращает ссылки,
+// переходы по которым записываются выборочно, с коэффициентом выборки
+func (a *App) HandleHotLinks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	links := a.svc.HotLinks()
+	if links == nil {
+		links = []models.HotLink{}
+	}
+	a.writeJSONResponse(w, http.StatusOK, links)
+}
+
+// HandleMetrics обрабатывает GET-запросы на "/api/internal/metrics" и отдаёт все счётчики expvar
+// (id_generation_retries, redirect_memo_hits, memory_evictions и другие) в формате /debug/vars
+func (a *App) HandleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	expvar.Handler().ServeHTTP(w, r)
+}
+
+// maxResolveBatch ограничивает число коротких ID, проверяемых одним запросом; больший пакет получает 413
+const maxResolveBatch = 10000
+
+// HandleResolve обрабатывает POST-запросы на "/api/internal/resolve" для проверки разрешения списка коротких ID
+func (a *App) HandleResolve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+		return
+	}
+
+	var ids []string
+	if err := decodeJSON(r.Body, &ids, false); err != nil {
+		http.Error(w, jsonErrorMessage(err), http.StatusBadRequest)
+		return
+	}
+	if len(ids) == 0 {
+		http.Error(w, "Empty batch", http.StatusBadRequest)
+		return
+	}
+	if len(ids) > maxResolveBatch {
+		http.Error(w, fmt.Sprintf("Batch too large: at most %d IDs allowed", maxResolveBatch), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	results, err := a.svc.Resolve(ids)
+	if err != nil {
+		a.logger.Error("Failed to resolve IDs", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	a.writeJSONResponse(w, http.StatusOK, results)
 }
 
+// batchWriteBufferSize задаёт размер буфера при потоковой записи пакетного ответа
+const batchWriteBufferSize = 4096
+
 // Пул буферов для JSON кодирования
 var jsonBufferPool = sync.Pool{
 	New: func() interface{} {
@@ -351,6 +1450,22 @@ var jsonBufferPool = sync.Pool{
 	},
 }
 
+// jsonBufferMaxPooledCap — ёмкость буфера, больше которой он не возвращается в пул:
+// иначе буфер одного огромного ответа удерживался бы в памяти ради последующих маленьких
+const jsonBufferMaxPooledCap = 64 << 10
+
+// jsonBufferDiscards считает буферы JSON-ответов, не возвращённые в пул из-за размера
+var jsonBufferDiscards = expvar.NewInt("json_buffer_pool_discards")
+
+// putJSONBuffer возвращает буфер в пул, если его ёмкость не превышает jsonBufferMaxPooledCap
+func putJSONBuffer(buf *strings.Builder) {
+	if buf.Cap() > jsonBufferMaxPooledCap {
+		jsonBufferDiscards.Add(1)
+		return
+	}
+	jsonBufferPool.Put(buf)
+}
+
 // writeJSONResponse пишет JSON-ответ с проверкой ошибок
 func (a *App) writeJSONResponse(w http.ResponseWriter, status int, v interface{}) {
 	w.Header().Set("Content-Type", "application/json")
@@ -359,7 +1474,7 @@ func (a *App) writeJSONResponse(w http.ResponseWriter, status int, v interface{}
 	// Используем пул буферов для уменьшения аллокаций
 	buf := jsonBufferPool.Get().(*strings.Builder)
 	buf.Reset()
-	defer jsonBufferPool.Put(buf)
+	defer putJSONBuffer(buf)
 
 	encoder := json.NewEncoder(buf)
 	encoder.SetIndent("", "")
@@ -370,8 +1485,12 @@ func (a *App) writeJSONResponse(w http.ResponseWriter, status int, v interface{}
 	}
 
 	// Убираем перенос строки, который добавляет json.Encoder
-	jsonStr := strings.TrimSpace(buf.String())
-	if _, err := w.Write([]byte(jsonStr)); err != nil {
+	data, err := a.applyFieldNaming([]byte(strings.TrimSpace(buf.String())))
+	if err != nil {
+		http.Error(w, "Failed to encode JSON", http.StatusInternalServerError)
+		return
+	}
+	if _, err := w.Write(data); err != nil {
 		http.Error(w, "Failed to write response", http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,60 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+)
+
+// failingTokenService имитирует невозможность выдать идентификатор пользователя
+type failingTokenService struct{}
+
+func (failingTokenService) ParseJWT(string) (string, error) {
+	return "", errors.New("invalid token")
+}
+
+func (failingTokenService) GenerateUserID() (string, error) {
+	return "", errors.New("entropy exhausted")
+}
+
+func (failingTokenService) GenerateJWT(string) (string, error) {
+	return "", errors.New("entropy exhausted")
+}
+
+func TestAuthMiddleware_DegradesWhenIdentityUnavailable(t *testing.T) {
+	_, repo, _, appInstance, logger, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	_, err := repo.Save("testID", "https://example.com", "user1")
+	assert.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware(failingTokenService{}, logger, middleware.WithOptionalIdentity("/{id}")))
+	r.Post("/", appInstance.HandlePostURL)
+	r.Get("/{id}", appInstance.HandleGetURL)
+
+	t.Run("Redirect works without identity", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/testID", nil))
+
+		assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+		assert.Equal(t, "https://example.com", rr.Header().Get("Location"))
+		assert.Empty(t, rr.Result().Cookies(), "No JWT cookie should be issued")
+	})
+
+	t.Run("Shorten returns structured 500", func(t *testing.T) {
+		req := createTestRequest(http.MethodPost, "/", "text/plain", strings.NewReader("https://new.example.com"))
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusInternalServerError, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+		assert.JSONEq(t, `{"error":"failed to issue user identity"}`, rr.Body.String())
+	})
+}
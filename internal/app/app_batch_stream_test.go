@@ -0,0 +1,130 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/models"
+	"go.uber.org/zap"
+)
+
+// discardResponseWriter отбрасывает тело ответа, подсчитывая записанные байты
+type discardResponseWriter struct {
+	header  http.Header
+	written int
+}
+
+func (d *discardResponseWriter) Header() http.Header { return d.header }
+func (d *discardResponseWriter) WriteHeader(int)     {}
+func (d *discardResponseWriter) Write(b []byte) (int, error) {
+	d.written += len(b)
+	return len(b), nil
+}
+
+// makeBatchResponse создаёт ответ пакетного сокращения из n элементов
+func makeBatchResponse(n int) []models.BatchResponse {
+	items := make([]models.BatchResponse, n)
+	for i := range items {
+		items[i] = models.BatchResponse{
+			CorrelationID: fmt.Sprintf("corr-%d", i),
+			ShortURL:      fmt.Sprintf("http://localhost:8080/id%06d", i),
+		}
+	}
+	return items
+}
+
+func TestApp_WriteBatchResponse_Format(t *testing.T) {
+	appInstance := NewApp(nil, nil, zap.NewNop())
+	items := makeBatchResponse(3)
+
+	rr := httptest.NewRecorder()
+	appInstance.writeBatchResponse(rr, http.StatusCreated, items)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	expected, err := json.Marshal(items)
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), rr.Body.String(), "Streamed JSON should match json.Marshal output")
+
+	rr = httptest.NewRecorder()
+	appInstance.writeBatchResponse(rr, http.StatusCreated, nil)
+	assert.Equal(t, "[]", rr.Body.String())
+}
+
+func TestApp_WriteBatchResponse_BoundedMemory(t *testing.T) {
+	if raceEnabled {
+		t.Skip("Race detector inflates allocations")
+	}
+	appInstance := NewApp(nil, nil, zap.NewNop())
+	items := makeBatchResponse(5000)
+
+	// Прогреваем пулы кодировщика
+	appInstance.writeBatchResponse(&discardResponseWriter{header: http.Header{}}, http.StatusCreated, items[:10])
+
+	w := &discardResponseWriter{header: http.Header{}}
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	appInstance.writeBatchResponse(w, http.StatusCreated, items)
+	runtime.ReadMemStats(&after)
+
+	allocated := after.TotalAlloc - before.TotalAlloc
+	t.Logf("response size: %d bytes, allocated: %d bytes", w.written, allocated)
+	assert.Greater(t, w.written, 256*1024, "Response should be large enough for the check to be meaningful")
+	assert.Less(t, allocated, uint64(w.written/4), "Streaming should not buffer the whole response")
+}
+
+func TestApp_HandleBatchShorten_ClientClosed(t *testing.T) {
+	_, repo, svc, appInstance, logger, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	r := createTestRouter(svc, logger, map[string]http.HandlerFunc{
+		"/api/shorten/batch": appInstance.HandleBatchShorten,
+	})
+
+	var body strings.Builder
+	body.WriteString("[")
+	for i := 0; i < 100; i++ {
+		if i > 0 {
+			body.WriteString(",")
+		}
+		fmt.Fprintf(&body, `{"correlation_id":"%d","original_url":"https://example.com/%d"}`, i, i)
+	}
+	body.WriteString("]")
+
+	// Клиент уже закрыл соединение к моменту обработки
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := createTestRequest(http.MethodPost, "/api/shorten/batch", "application/json", strings.NewReader(body.String())).WithContext(ctx)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	assert.Empty(t, rr.Body.String(), "Aborted request should not write a response")
+	urls, err := repo.GetURLsByUserID(userIDFromCookies(t, svc, rr))
+	assert.NoError(t, err)
+	assert.Empty(t, urls, "Aborted batch should not be saved")
+	count, _, err := repo.GetStats()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+// userIDFromCookies извлекает идентификатор пользователя из выданной middleware cookie
+func userIDFromCookies(t *testing.T, svc interface {
+	ParseJWT(string) (string, error)
+}, rr *httptest.ResponseRecorder) string {
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == "jwt" && c.Value != "" {
+			userID, err := svc.ParseJWT(c.Value)
+			assert.NoError(t, err)
+			return userID
+		}
+	}
+	return ""
+}
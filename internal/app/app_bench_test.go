@@ -0,0 +1,30 @@
+package app
+
+import (
+	"net/http"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// BenchmarkApp_WriteJSONResponse измеряет запись JSON-ответов типичного размера через пул буферов
+func BenchmarkApp_WriteJSONResponse(b *testing.B) {
+	appInstance := NewApp(nil, nil, zap.NewNop())
+	for _, bc := range []struct {
+		name  string
+		items int
+	}{
+		{name: "Single", items: 1},
+		{name: "Batch100", items: 100},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			items := makeBatchResponse(bc.items)
+			w := &discardResponseWriter{header: http.Header{}}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				appInstance.writeJSONResponse(w, http.StatusOK, items)
+			}
+		})
+	}
+}
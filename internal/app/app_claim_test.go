@@ -0,0 +1,89 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/models"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestApp_HandleClaimURL(t *testing.T) {
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+	core, logs := observer.New(zapcore.DebugLevel)
+	r := newSessionRouter(svc, zap.New(core))
+
+	// Анонимный пользователь получает токен владения вместе с короткой ссылкой
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, createTestRequest(http.MethodPost, "/api/shorten", "application/json", strings.NewReader(`{"url":"https://example.com/claim"}`)))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var created ShortenResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.ClaimToken)
+	id := strings.TrimPrefix(created.Result, "http://localhost:8080/")
+	creator := authCookie(rr)
+	assert.NotNil(t, creator)
+
+	// Пользователь с сессией токен не получает
+	req := createTestRequest(http.MethodPost, "/api/shorten", "application/json", strings.NewReader(`{"url":"https://example.com/owned"}`))
+	req.AddCookie(creator)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "claim_token")
+
+	// Новая личность получает сессию отдельным запросом
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/user/stats", nil))
+	claimer := authCookie(rr)
+	assert.NotNil(t, claimer)
+
+	claim := func(cookie *http.Cookie, token string) *httptest.ResponseRecorder {
+		req := createTestRequest(http.MethodPost, "/api/urls/"+id+"/claim", "application/json", strings.NewReader(`{"claim_token":"`+token+`"}`))
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, claim(nil, created.ClaimToken).Code, "Claim requires an existing session")
+	assert.Equal(t, http.StatusBadRequest, claim(claimer, "").Code)
+	assert.Equal(t, http.StatusForbidden, claim(claimer, "wrong").Code)
+
+	rr = claim(claimer, created.ClaimToken)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var claimed models.ShortURLResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &claimed))
+	assert.Equal(t, created.Result, claimed.ShortURL)
+	assert.Equal(t, "https://example.com/claim", claimed.OriginalURL)
+
+	claimerID, err := svc.ParseJWT(claimer.Value)
+	assert.NoError(t, err)
+	urls, err := svc.GetURLsByUserID(claimerID)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ShortURLResponse{claimed}, urls)
+
+	// Токен одноразовый
+	rr = claim(claimer, created.ClaimToken)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Invalid claim token")
+
+	for _, entry := range logs.All() {
+		assert.NotContains(t, entry.Message, created.ClaimToken)
+		for _, value := range entry.ContextMap() {
+			if s, ok := value.(string); ok {
+				assert.NotContains(t, s, created.ClaimToken, "Claim token must never be logged")
+			}
+		}
+	}
+}
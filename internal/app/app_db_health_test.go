@@ -0,0 +1,137 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+// flakyDatabase не отвечает на первые failPings проверок, затем восстанавливается; считает сбросы соединений
+type flakyDatabase struct {
+	mockDatabase
+	failPings int32
+	pings     atomic.Int32
+	resets    atomic.Int32
+}
+
+func (f *flakyDatabase) Ping() error {
+	if f.pings.Add(1) <= f.failPings {
+		return errors.New("dial tcp 10.0.0.1:5432: connect: connection refused")
+	}
+	return nil
+}
+
+func (f *flakyDatabase) ResetConnections() {
+	f.resets.Add(1)
+}
+
+func TestApp_WatchDatabase(t *testing.T) {
+	tests := []struct {
+		name       string
+		failPings  int32
+		threshold  int
+		wantResets int32
+	}{
+		{name: "healthy", failPings: 0, threshold: 3, wantResets: 0},
+		{name: "below threshold", failPings: 2, threshold: 3, wantResets: 0},
+		{name: "recovers after reset", failPings: 4, threshold: 3, wantResets: 1},
+		{name: "repeated resets", failPings: 7, threshold: 3, wantResets: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &flakyDatabase{failPings: tt.failPings}
+			svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+			appInstance := NewApp(svc, db, zap.NewNop())
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				appInstance.WatchDatabase(ctx, time.Millisecond, tt.threshold)
+				close(done)
+			}()
+			// Ждём первой удачной проверки после сбоев
+			assert.Eventually(t, func() bool {
+				return db.pings.Load() > tt.failPings && appInstance.dbFailures.Load() == 0
+			}, 2*time.Second, time.Millisecond)
+			cancel()
+			<-done
+
+			assert.Equal(t, tt.wantResets, db.resets.Load())
+		})
+	}
+}
+
+func TestApp_ReadyzReportsDBFailures(t *testing.T) {
+	db := &flakyDatabase{failPings: 1000}
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+	appInstance := NewApp(svc, db, zap.NewNop())
+
+	readyz := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		appInstance.HandleReadyz(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rr
+	}
+
+	// Без наблюдения за базой ответ прежний
+	rr := readyz()
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Body.String())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go appInstance.WatchDatabase(ctx, time.Millisecond, 3)
+	assert.Eventually(t, func() bool {
+		return appInstance.dbFailures.Load() >= 2
+	}, 2*time.Second, time.Millisecond)
+
+	rr = readyz()
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Regexp(t, `^db_consecutive_failures: [1-9]\d*\n$`, rr.Body.String())
+}
+
+func TestApp_DatabaseHolderReconnect(t *testing.T) {
+	holder := repository.NewDatabaseHolder(nil)
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+	appInstance := NewApp(svc, holder, zap.NewNop())
+
+	ping := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		appInstance.HandlePing(rr, httptest.NewRequest(http.MethodGet, "/ping", nil))
+		return rr
+	}
+
+	// База недоступна при старте: /ping сообщает о сбое соединения, а наблюдатель считает неудачи
+	rr := ping()
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Database connection failed")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		appInstance.WatchDatabase(ctx, time.Millisecond, 3)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool {
+		return appInstance.dbFailures.Load() > 0
+	}, 2*time.Second, time.Millisecond)
+
+	// После переподключения приложение видит новую базу
+	db := &flakyDatabase{}
+	holder.Set(db)
+	assert.Eventually(t, func() bool {
+		return appInstance.dbFailures.Load() == 0
+	}, 2*time.Second, time.Millisecond)
+	assert.Equal(t, http.StatusOK, ping().Code)
+	cancel()
+	<-done
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+)
+
+func TestApp_DedupStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []Option
+		wantStatus int
+	}{
+		{name: "Default conflict", wantStatus: http.StatusConflict},
+		{name: "OK for idempotent clients", opts: []Option{WithDedupStatus(http.StatusOK)}, wantStatus: http.StatusOK},
+		{name: "Unsupported status keeps conflict", opts: []Option{WithDedupStatus(http.StatusAccepted)}, wantStatus: http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, repo, svc, _, logger, cleanup := setupTestEnvironment(t)
+			defer cleanup()
+			_, err := repo.Save("existing", "https://example.com", "user1")
+			assert.NoError(t, err)
+			appInstance := NewApp(svc, nil, logger, tt.opts...)
+			r := createTestRouter(svc, logger, map[string]http.HandlerFunc{
+				"POST /":            appInstance.HandlePostURL,
+				"POST /api/shorten": appInstance.HandleJSONShorten,
+			})
+			token, err := svc.GenerateJWT("user1")
+			assert.NoError(t, err)
+
+			req := createTestRequest(http.MethodPost, "/", "text/plain", strings.NewReader("https://example.com"))
+			req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: token})
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			assert.Equal(t, "http://localhost:8080/existing", rr.Body.String())
+
+			req = createTestRequest(http.MethodPost, "/api/shorten", "application/json", strings.NewReader(`{"url":"https://example.com"}`))
+			req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: token})
+			rr = httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			assert.Equal(t, tt.wantStatus, rr.Code)
+			var resp ShortenResponse
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Equal(t, "http://localhost:8080/existing", resp.Result)
+
+			// Новый URL по-прежнему создаётся с 201
+			req = createTestRequest(http.MethodPost, "/api/shorten", "application/json", strings.NewReader(`{"url":"https://new.example.com"}`))
+			req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: token})
+			rr = httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusCreated, rr.Code)
+		})
+	}
+}
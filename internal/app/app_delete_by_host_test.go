@@ -0,0 +1,64 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+func TestApp_HandleBatchDeleteURLs_Domain(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	svc := service.NewService(repo, "http://localhost:8080", "secret")
+	logger := zap.NewNop()
+	appInstance := NewApp(svc, nil, logger)
+	r := createTestRouter(svc, logger, map[string]http.HandlerFunc{"/api/user/urls": appInstance.HandleBatchDeleteURLs})
+
+	token, err := svc.GenerateJWT("user1")
+	assert.NoError(t, err)
+	for id, u := range map[string][2]string{
+		"id1": {"https://old.example.com/a", "user1"},
+		"id2": {"https://old.example.com/b", "user1"},
+		"id3": {"https://new.example.com/c", "user1"},
+		"id4": {"https://old.example.com/d", "user2"},
+	} {
+		_, err := repo.Save(id, u[0], u[1])
+		assert.NoError(t, err)
+	}
+
+	deleteByDomain := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/api/user/urls"+query, nil)
+		req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: token})
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := deleteByDomain("?domain=")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.JSONEq(t, `{"error":"Validation failed","fields":[{"field":"domain","error":"required"}]}`, rr.Body.String())
+
+	rr = deleteByDomain("?domain=https://old.example.com")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.JSONEq(t, `{"error":"Validation failed","fields":[{"field":"domain","error":"invalid host"}]}`, rr.Body.String())
+
+	rr = deleteByDomain("?domain=old.example.com")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"deleted":2}`, rr.Body.String())
+
+	// Удалены только URL пользователя на указанном хосте
+	for id, wantDeleted := range map[string]bool{"id1": true, "id2": true, "id3": false, "id4": false} {
+		u, exists, _ := repo.Get(id)
+		assert.True(t, exists)
+		assert.Equal(t, wantDeleted, u.DeletedFlag, id)
+	}
+
+	rr = deleteByDomain("?domain=old.example.com")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"deleted":0}`, rr.Body.String())
+}
@@ -0,0 +1,73 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/models"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+func TestApp_DescriptionRoundTrip(t *testing.T) {
+	backends := map[string]func(t *testing.T) repository.Repository{
+		"memory": func(t *testing.T) repository.Repository {
+			return repository.NewMemoryRepository()
+		},
+		"file": func(t *testing.T) repository.Repository {
+			repo, err := repository.NewFileRepository(filepath.Join(t.TempDir(), "storage.json"), zap.NewNop())
+			assert.NoError(t, err)
+			return repo
+		},
+	}
+
+	for name, newRepo := range backends {
+		t.Run(name, func(t *testing.T) {
+			logger := zap.NewNop()
+			svc := service.NewService(newRepo(t), "http://localhost:8080", "secret", service.WithMaxDescriptionLength(20))
+			appInstance := NewApp(svc, nil, logger)
+			r := createTestRouter(svc, logger, map[string]http.HandlerFunc{
+				"POST /api/shorten":  appInstance.HandleJSONShorten,
+				"GET /api/user/urls": appInstance.HandleUserURLs,
+			})
+			token, err := svc.GenerateJWT("user1")
+			assert.NoError(t, err)
+			do := func(req *http.Request) *httptest.ResponseRecorder {
+				req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: token})
+				rr := httptest.NewRecorder()
+				r.ServeHTTP(rr, req)
+				return rr
+			}
+
+			rr := do(createTestRequest(http.MethodPost, "/api/shorten", "application/json",
+				strings.NewReader(`{"url":"https://example.com","description":"  Spring promo  "}`)))
+			assert.Equal(t, http.StatusCreated, rr.Code)
+			rr = do(createTestRequest(http.MethodPost, "/api/shorten", "application/json",
+				strings.NewReader(`{"url":"https://example.org"}`)))
+			assert.Equal(t, http.StatusCreated, rr.Code)
+
+			// Описание длиннее настроенного предела отклоняется
+			rr = do(createTestRequest(http.MethodPost, "/api/shorten", "application/json",
+				strings.NewReader(`{"url":"https://example.net","description":"`+strings.Repeat("д", 21)+`"}`)))
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+			rr = do(httptest.NewRequest(http.MethodGet, "/api/user/urls", nil))
+			assert.Equal(t, http.StatusOK, rr.Code)
+			var urls []models.ShortURLResponse
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &urls))
+			descriptions := make(map[string]string, len(urls))
+			for _, u := range urls {
+				descriptions[u.OriginalURL] = u.Description
+			}
+			assert.Equal(t, map[string]string{"https://example.com": "Spring promo", "https://example.org": ""}, descriptions)
+			assert.NotContains(t, rr.Body.String(), `"description":""`)
+		})
+	}
+}
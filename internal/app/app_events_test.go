@@ -0,0 +1,148 @@
+package app
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/events"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+// sseMessage — разобранное сообщение Server-Sent Events
+type sseMessage struct {
+	id, event, data, comment string
+}
+
+// readSSE читает из потока одно сообщение до пустой строки
+func readSSE(t *testing.T, reader *bufio.Reader) sseMessage {
+	var msg sseMessage
+	for {
+		line, err := reader.ReadString('\n')
+		if !assert.NoError(t, err) {
+			return msg
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			return msg
+		case strings.HasPrefix(line, "id: "):
+			msg.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			msg.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			msg.data = strings.TrimPrefix(line, "data: ")
+		case strings.HasPrefix(line, ": "):
+			msg.comment = strings.TrimPrefix(line, ": ")
+		}
+	}
+}
+
+func newEventsServer(t *testing.T, opts ...Option) (*service.Service, *httptest.Server) {
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret",
+		service.WithNotifier(events.NewNotifier(events.DefaultCapacity)))
+	logger := zap.NewNop()
+	r := chi.NewRouter()
+	r.Use(middleware.GzipMiddleware)
+	r.Use(middleware.LoggingMiddleware(logger))
+	r.Use(middleware.AuthMiddleware(svc, logger))
+	NewApp(svc, nil, logger, opts...).RegisterRoutes(r, middleware.TrustedSubnetMiddleware("10.0.0.0/8", logger))
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return svc, server
+}
+
+func openStream(t *testing.T, ctx context.Context, url, realIP, lastEventID string) *http.Response {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url+"/api/internal/events/stream", nil)
+	assert.NoError(t, err)
+	req.Header.Set("X-Real-IP", realIP)
+	req.Header.Set("Accept-Encoding", "gzip")
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	return resp
+}
+
+func TestApp_EventsStream(t *testing.T) {
+	svc, server := newEventsServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp := openStream(t, ctx, server.URL, "10.0.0.5", "")
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+
+	_, shortURL, err := svc.CreateShortURL("https://example.com/a", "user1")
+	assert.NoError(t, err)
+	id := strings.TrimPrefix(shortURL, "http://localhost:8080/")
+	assert.NoError(t, svc.BatchDelete("user1", []string{id, "missing1"}))
+
+	reader := bufio.NewReader(resp.Body)
+	created := readSSE(t, reader)
+	assert.Equal(t, "1", created.id)
+	assert.Equal(t, "created", created.event)
+	assert.Contains(t, created.data, `"short_id":"`+id+`"`)
+
+	deleted := readSSE(t, reader)
+	assert.Equal(t, "2", deleted.id)
+	assert.Equal(t, "deleted", deleted.event)
+	assert.Contains(t, deleted.data, `"short_id":"`+id+`"`)
+}
+
+func TestApp_EventsStream_Replay(t *testing.T) {
+	svc, server := newEventsServer(t)
+	for _, u := range []string{"https://example.com/1", "https://example.com/2", "https://example.com/3"} {
+		_, _, err := svc.CreateShortURL(u, "user1")
+		assert.NoError(t, err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp := openStream(t, ctx, server.URL, "10.0.0.5", "1")
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	reader := bufio.NewReader(resp.Body)
+	assert.Equal(t, "2", readSSE(t, reader).id)
+	assert.Equal(t, "3", readSSE(t, reader).id)
+
+	bad := openStream(t, ctx, server.URL, "10.0.0.5", "abc")
+	defer bad.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, bad.StatusCode)
+}
+
+func TestApp_EventsStream_Heartbeat(t *testing.T) {
+	_, server := newEventsServer(t, func(a *App) { a.eventsHeartbeat = 10 * time.Millisecond })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	resp := openStream(t, ctx, server.URL, "10.0.0.5", "")
+	defer resp.Body.Close()
+	assert.Equal(t, "heartbeat", readSSE(t, bufio.NewReader(resp.Body)).comment)
+}
+
+func TestApp_EventsStream_Forbidden(t *testing.T) {
+	_, server := newEventsServer(t)
+	resp := openStream(t, context.Background(), server.URL, "192.168.1.1", "")
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestApp_EventsStream_Disabled(t *testing.T) {
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+	rr := httptest.NewRecorder()
+	NewApp(svc, nil, zap.NewNop()).HandleEventsStream(rr, httptest.NewRequest(http.MethodGet, "/api/internal/events/stream", nil))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/features"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+// newFaultsRouter создаёт маршрутизатор с доверенной подсетью 10.0.0.0/8 поверх хранилища repo
+func newFaultsRouter(repo repository.Repository, opts ...Option) *chi.Mux {
+	logger := zap.NewNop()
+	svc := service.NewService(repo, "http://localhost:8080", "secret")
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware(svc, logger))
+	NewApp(svc, nil, logger, opts...).RegisterRoutes(r, middleware.TrustedSubnetMiddleware("10.0.0.0/8", logger))
+	return r
+}
+
+// postFaults отправляет настройки сбоев из доверенной подсети
+func postFaults(r http.Handler, body string) *httptest.ResponseRecorder {
+	req := createTestRequest(http.MethodPost, "/api/internal/faults", "application/json", strings.NewReader(body))
+	req.Header.Set("X-Real-IP", "10.0.0.5")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestApp_ShortenWithStorageFaults(t *testing.T) {
+	faults := repository.WithFaults(repository.NewMemoryRepository(), repository.FaultConfig{
+		Seed:    1,
+		Methods: map[string]repository.FaultRule{"Save": {ErrorRate: 1}, "SaveURL": {ErrorRate: 1}, "BatchSave": {ErrorRate: 1}},
+	})
+	r := newFaultsRouter(faults)
+
+	requests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+	}{
+		{name: "Plain", target: "/", contentType: "text/plain", body: "https://example.com"},
+		{name: "JSON", target: "/api/shorten", contentType: "application/json", body: `{"url":"https://example.com"}`},
+		{name: "Batch", target: "/api/shorten/batch", contentType: "application/json", body: `[{"correlation_id":"1","original_url":"https://example.com"}]`},
+	}
+	for _, tt := range requests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, createTestRequest(http.MethodPost, tt.target, tt.contentType, strings.NewReader(tt.body)))
+			assert.Equal(t, http.StatusServiceUnavailable, rr.Code, rr.Body.String())
+			assert.Equal(t, "5", rr.Header().Get("Retry-After"))
+			assert.NotContains(t, rr.Body.String(), repository.ErrInjectedFault.Error())
+		})
+	}
+
+	// После снятия сбоя те же запросы проходят
+	assert.NoError(t, faults.SetConfig(repository.FaultConfig{}))
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, createTestRequest(http.MethodPost, "/", "text/plain", strings.NewReader("https://example.com")))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+}
+
+func TestApp_HandleFaults(t *testing.T) {
+	faults := repository.WithFaults(repository.NewMemoryRepository(), repository.FaultConfig{})
+	r := newFaultsRouter(faults, WithFaultInjection(faults))
+
+	rr := postFaults(r, `{"seed":7,"methods":{"SaveURL":{"error_rate":1,"latency":"1ms"}}}`)
+	assert.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	assert.JSONEq(t, `{"seed":7,"methods":{"SaveURL":{"error_rate":1,"latency":"1ms"}}}`, rr.Body.String())
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, createTestRequest(http.MethodPost, "/api/shorten", "application/json", strings.NewReader(`{"url":"https://example.com"}`)))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	// Некорректные настройки отклоняются и не заменяют действующие
+	for _, body := range []string{
+		`{"methods":{"Drop":{"error_rate":1}}}`,
+		`{"methods":{"Save":{"error_rate":2}}}`,
+		`{"methods":{"Save":{"latency":"soon"}}}`,
+		`{"methods":{},"extra":true}`,
+	} {
+		rr = postFaults(r, body)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+	}
+	assert.Equal(t, 1.0, faults.Config().Methods["SaveURL"].ErrorRate)
+
+	// Вне доверенной подсети настройки недоступны
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, createTestRequest(http.MethodPost, "/api/internal/faults", "application/json", strings.NewReader(`{"methods":{}}`)))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	rr = postFaults(r, `{"methods":{}}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, faults.Config().Methods)
+}
+
+func TestApp_HandleFaults_Disabled(t *testing.T) {
+	// Без WithFaultInjection (ENABLE_FAULT_INJECTION не включён) эндпоинт не регистрируется
+	faults := repository.WithFaults(repository.NewMemoryRepository(), repository.FaultConfig{})
+	r := newFaultsRouter(faults)
+
+	rr := postFaults(r, `{"methods":{"*":{"error_rate":1}}}`)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Empty(t, faults.Config().Methods)
+
+	// Явный список эндпоинтов тоже может выключить настройку сбоев
+	r = newFaultsRouter(faults, WithFaultInjection(faults), WithEnabledEndpoints([]string{features.EndpointInternalStats}))
+	rr = postFaults(r, `{"methods":{"*":{"error_rate":1}}}`)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,97 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+func TestCamelFieldName(t *testing.T) {
+	assert.Equal(t, "shortUrl", camelFieldName("short_url"))
+	assert.Equal(t, "longUrl", camelFieldName("original_url"))
+	assert.Equal(t, "correlationId", camelFieldName("correlation_id"))
+	assert.Equal(t, "createdLast30d", camelFieldName("created_last_30d"))
+	assert.Equal(t, "result", camelFieldName("result"))
+}
+
+func TestRenameJSONKeys(t *testing.T) {
+	in := `{"user_id":"u1","urls":[{"short_url":"a","n":12345678901234567890}],"nested":{"is_deleted":false,"x":null},"text":"<short_url>"}`
+	out, err := renameJSONKeys([]byte(in), camelFieldName)
+	assert.NoError(t, err)
+	// Порядок полей, большие числа и строковые значения не меняются
+	assert.Equal(t, `{"userId":"u1","urls":[{"shortUrl":"a","n":12345678901234567890}],"nested":{"isDeleted":false,"x":null},"text":"<short_url>"}`, string(out))
+
+	_, err = renameJSONKeys([]byte(`{"a":`), camelFieldName)
+	assert.Error(t, err)
+}
+
+func TestValidateFieldNaming(t *testing.T) {
+	assert.NoError(t, ValidateFieldNaming(FieldNamingSnake))
+	assert.NoError(t, ValidateFieldNaming(FieldNamingCamel))
+	assert.Error(t, ValidateFieldNaming("kebab-case"))
+}
+
+func TestApp_ResponseFieldNaming(t *testing.T) {
+	tests := []struct {
+		name      string
+		naming    string
+		wantBatch string
+		wantURLs  string
+	}{
+		{
+			name:      "Default snake_case",
+			naming:    "",
+			wantBatch: `[{"correlation_id":"1","short_url":"http://localhost:8080/`,
+			wantURLs:  `[{"short_url":"http://localhost:8080/`,
+		},
+		{
+			name:      "camelCase",
+			naming:    FieldNamingCamel,
+			wantBatch: `[{"correlationId":"1","shortUrl":"http://localhost:8080/`,
+			wantURLs:  `[{"shortUrl":"http://localhost:8080/`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+			logger := zap.NewNop()
+			appInstance := NewApp(svc, nil, logger, WithResponseFieldNaming(tt.naming))
+			r := createTestRouter(svc, logger, map[string]http.HandlerFunc{
+				"/api/shorten/batch": appInstance.HandleBatchShorten,
+				"/api/user/urls":     appInstance.HandleUserURLs,
+			})
+			token, err := svc.GenerateJWT("user1")
+			assert.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/shorten/batch",
+				strings.NewReader(`[{"correlation_id":"1","original_url":"https://example.com"}]`))
+			req.Header.Set("Content-Type", "application/json")
+			req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: token})
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusCreated, rr.Code)
+			assert.True(t, strings.HasPrefix(rr.Body.String(), tt.wantBatch), rr.Body.String())
+
+			req = httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+			req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: token})
+			rr = httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.True(t, strings.HasPrefix(rr.Body.String(), tt.wantURLs), rr.Body.String())
+			if tt.naming == FieldNamingCamel {
+				assert.Contains(t, rr.Body.String(), `"longUrl":"https://example.com"`)
+				assert.NotContains(t, rr.Body.String(), "original_url")
+			} else {
+				assert.Contains(t, rr.Body.String(), `"original_url":"https://example.com"`)
+			}
+		})
+	}
+}
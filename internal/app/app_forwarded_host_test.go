@@ -0,0 +1,117 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/models"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+func TestApp_ForwardedHost(t *testing.T) {
+	svc := service.NewService(repository.NewMemoryRepository(), "https://sho.rt/s/", "secret")
+	logger := zap.NewNop()
+	appInstance := NewApp(svc, nil, logger, WithForwardedHosts([]string{"go.a.com", "GO.B.COM"}))
+	r := createTestRouter(svc, logger, map[string]http.HandlerFunc{
+		"/":            appInstance.HandlePostURL,
+		"/api/shorten": appInstance.HandleJSONShorten,
+	})
+
+	// Создаём URL заранее: дальше каждый запрос получает конфликт с тем же коротким ID
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, createTestRequest(http.MethodPost, "/", "text/plain", strings.NewReader("https://example.com")))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	id := strings.TrimPrefix(rr.Body.String(), "https://sho.rt/s/")
+	assert.NotEmpty(t, id)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{name: "Allowed host", headers: map[string]string{"X-Forwarded-Host": "go.a.com"}, want: "https://go.a.com/s/"},
+		{name: "Allowed host case-insensitive", headers: map[string]string{"X-Forwarded-Host": "Go.B.com"}, want: "https://go.b.com/s/"},
+		{name: "First host of proxy chain", headers: map[string]string{"X-Forwarded-Host": "go.a.com, internal.lb"}, want: "https://go.a.com/s/"},
+		{name: "Forwarded proto", headers: map[string]string{"X-Forwarded-Host": "go.a.com", "X-Forwarded-Proto": "http"}, want: "http://go.a.com/s/"},
+		{name: "Invalid proto ignored", headers: map[string]string{"X-Forwarded-Host": "go.a.com", "X-Forwarded-Proto": "javascript"}, want: "https://go.a.com/s/"},
+		{name: "Disallowed host", headers: map[string]string{"X-Forwarded-Host": "evil.com"}, want: "https://sho.rt/s/"},
+		{name: "No header", want: "https://sho.rt/s/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := tt.want + id
+			req := createTestRequest(http.MethodPost, "/", "text/plain", strings.NewReader("https://example.com"))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusConflict, rr.Code)
+			assert.Equal(t, want, rr.Body.String())
+			assert.Equal(t, want, rr.Header().Get(DefaultShortURLHeader))
+
+			req = createTestRequest(http.MethodPost, "/api/shorten", "application/json", strings.NewReader(`{"url":"https://example.com"}`))
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rr = httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			var resp ShortenResponse
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Equal(t, want, resp.Result)
+		})
+	}
+}
+
+func TestApp_ForwardedHost_UserURLs(t *testing.T) {
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+	logger := zap.NewNop()
+	appInstance := NewApp(svc, nil, logger, WithForwardedHosts([]string{"go.a.com"}))
+	r := createTestRouter(svc, logger, map[string]http.HandlerFunc{
+		"/api/shorten/batch": appInstance.HandleBatchShorten,
+		"/api/user/urls":     appInstance.HandleUserURLs,
+	})
+
+	req := createTestRequest(http.MethodPost, "/api/shorten/batch", "application/json",
+		strings.NewReader(`[{"correlation_id":"1","original_url":"https://example.com/1"}]`))
+	req.Header.Set("X-Forwarded-Host", "go.a.com")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var batch []models.BatchResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &batch))
+	assert.Len(t, batch, 1)
+	if len(batch) == 1 {
+		assert.True(t, strings.HasPrefix(batch[0].ShortURL, "http://go.a.com/"), batch[0].ShortURL)
+	}
+
+	// Список URL пользователя строится на домене текущего запроса, а не того, где ссылка создана
+	var cookie *http.Cookie
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == middleware.AuthCookieName {
+			cookie = c
+		}
+	}
+	assert.NotNil(t, cookie)
+	if cookie == nil {
+		return
+	}
+	req = createTestRequest(http.MethodGet, "/api/user/urls", "", nil)
+	req.AddCookie(cookie)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var urls []models.ShortURLResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &urls))
+	assert.Len(t, urls, 1)
+	if len(urls) == 1 {
+		assert.True(t, strings.HasPrefix(urls[0].ShortURL, "http://localhost:8080/"), urls[0].ShortURL)
+	}
+}
@@ -0,0 +1,102 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/models"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+// countingRecorder считает записанные переходы и их суммарный вес
+type countingRecorder struct {
+	mu      sync.Mutex
+	records int
+	weight  int
+}
+
+func (c *countingRecorder) RecordClick(_, _ string, weight int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.records++
+	c.weight += weight
+}
+
+func TestApp_HotLinks(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	_, err := repo.Save("viral", "https://example.com", "user1")
+	assert.NoError(t, err)
+
+	const limit = 5
+	const requests = 200
+	recorder := &countingRecorder{}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	logger := zap.NewNop()
+	svc := service.NewService(repo, "http://localhost:8080", "secret",
+		service.WithClock(func() time.Time { return now }),
+		service.WithClickRecorder(recorder),
+		service.WithClickRateLimit(limit, 10),
+	)
+	r := chi.NewRouter()
+	NewApp(svc, nil, logger).RegisterRoutes(r, middleware.TrustedSubnetMiddleware("10.0.0.0/8", logger))
+
+	// Все редиректы проходят, а записывается не больше лимита
+	var wg sync.WaitGroup
+	codes := make([]int, requests)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/viral", nil))
+			codes[i] = rr.Code
+		}(i)
+	}
+	wg.Wait()
+	for _, code := range codes {
+		assert.Equal(t, http.StatusTemporaryRedirect, code)
+	}
+	assert.Equal(t, limit, recorder.records)
+	assert.Equal(t, limit, recorder.weight)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/internal/hotlinks", nil)
+	req.Header.Set("X-Real-IP", "10.0.0.1")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var links []models.HotLink
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &links))
+	assert.Equal(t, []models.HotLink{{ShortID: "viral", Clicks: requests, Recorded: limit, SampleFactor: float64(requests) / limit}}, links)
+
+	// Через секунду пропущенные переходы переходят в вес следующей записи
+	now = now.Add(time.Second)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/viral", nil))
+	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	assert.Equal(t, requests+1, recorder.weight)
+
+	// Доступ только из доверенной подсети
+	req = httptest.NewRequest(http.MethodGet, "/api/internal/hotlinks", nil)
+	req.Header.Set("X-Real-IP", "192.168.0.1")
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestApp_HotLinks_Disabled(t *testing.T) {
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+	appInstance := NewApp(svc, nil, zap.NewNop())
+	rr := httptest.NewRecorder()
+	appInstance.HandleHotLinks(rr, httptest.NewRequest(http.MethodGet, "/api/internal/hotlinks", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `[]`, rr.Body.String())
+}
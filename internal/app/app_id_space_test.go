@@ -0,0 +1,56 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestApp_WatchIDSpace(t *testing.T) {
+	// 16^2 = 256 возможных ID
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret",
+		service.WithIDAlphabet("0123456789abcdef"), service.WithShortIDLength(2))
+	core, logs := observer.New(zap.WarnLevel)
+	a := NewApp(svc, nil, zap.New(core))
+
+	for i := 0; i < 20; i++ {
+		_, _, err := svc.CreateShortURLWithID(fmt.Sprintf("https://example.com/%d", i), fmt.Sprintf("%02x", i), "user1")
+		assert.NoError(t, err)
+	}
+	a.checkIDSpace(0.5)
+	assert.Zero(t, logs.Len())
+
+	for i := 20; i < 200; i++ {
+		_, _, err := svc.CreateShortURLWithID(fmt.Sprintf("https://example.com/%d", i), fmt.Sprintf("%02x", i), "user1")
+		assert.NoError(t, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		a.WatchIDSpace(ctx, time.Hour, 0.5)
+		close(done)
+	}()
+	assert.Eventually(t, func() bool { return logs.Len() > 0 }, time.Second, 5*time.Millisecond)
+	cancel()
+	<-done
+
+	entry := logs.All()[0]
+	assert.Equal(t, zapcore.WarnLevel, entry.Level)
+	assert.Contains(t, entry.Message, "increase ShortIDLength")
+	fields := entry.ContextMap()
+	assert.InDelta(t, 200.0/256, fields["fill_ratio"], 1e-9)
+	assert.Equal(t, int64(2), fields["short_id_length"])
+
+	// Нулевой порог отключает проверку
+	logs.TakeAll()
+	a.WatchIDSpace(context.Background(), time.Hour, 0)
+	assert.Zero(t, logs.Len())
+}
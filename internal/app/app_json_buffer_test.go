@@ -0,0 +1,29 @@
+package app
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestApp_WriteJSONResponse_DiscardsLargeBuffers(t *testing.T) {
+	appInstance := NewApp(nil, nil, zap.NewNop())
+	before := jsonBufferDiscards.Value()
+
+	// Буфер большого ответа не возвращается в пул
+	w := &discardResponseWriter{header: http.Header{}}
+	appInstance.writeJSONResponse(w, http.StatusOK, makeBatchResponse(5000))
+	assert.Greater(t, w.written, jsonBufferMaxPooledCap)
+	assert.Equal(t, before+1, jsonBufferDiscards.Value())
+
+	buf := jsonBufferPool.Get().(*strings.Builder)
+	assert.LessOrEqual(t, buf.Cap(), jsonBufferMaxPooledCap, "Pooled buffer must not retain a large response")
+	jsonBufferPool.Put(buf)
+
+	// Буферы обычных ответов переиспользуются
+	appInstance.writeJSONResponse(&discardResponseWriter{header: http.Header{}}, http.StatusOK, makeBatchResponse(10))
+	assert.Equal(t, before+1, jsonBufferDiscards.Value())
+}
@@ -0,0 +1,220 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+func TestDecodeJSON_TrailingData(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		wantErr error
+	}{
+		{name: "Single object", body: `{"url":"https://example.com"}`},
+		{name: "Trailing whitespace", body: "{\"url\":\"https://example.com\"}\n\t "},
+		{name: "Second object", body: `{"url":"https://example.com"}{"url":"https://example.org"}`, wantErr: errTrailingData},
+		{name: "Trailing garbage", body: `{"url":"https://example.com"}garbage`, wantErr: errTrailingData},
+		{name: "Trailing brace", body: `{"url":"https://example.com"}}`, wantErr: errTrailingData},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req ShortenRequest
+			err := decodeJSON(strings.NewReader(tt.body), &req, false)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "https://example.com", req.URL)
+		})
+	}
+}
+
+func TestApp_JSONTrailingData(t *testing.T) {
+	_, repo, svc, appInstance, logger, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	r := createTestRouter(svc, logger, map[string]http.HandlerFunc{
+		"/api/shorten":          appInstance.HandleJSONShorten,
+		"/api/shorten/batch":    appInstance.HandleBatchShorten,
+		"/api/user/urls":        appInstance.HandleBatchDeleteURLs,
+		"/api/internal/resolve": appInstance.HandleResolve,
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{name: "Shorten", method: http.MethodPost, path: "/api/shorten", body: `{"url":"https://example.com"}{"url":"https://example.org"}`},
+		{name: "Batch", method: http.MethodPost, path: "/api/shorten/batch", body: `[{"correlation_id":"1","original_url":"https://example.com"}] []`},
+		{name: "Delete", method: http.MethodDelete, path: "/api/user/urls", body: `["id1"]garbage`},
+		{name: "Resolve", method: http.MethodPost, path: "/api/internal/resolve", body: `["id1"]["id2"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, createTestRequest(tt.method, tt.path, "application/json", strings.NewReader(tt.body)))
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			assert.Contains(t, rr.Body.String(), "unexpected trailing data")
+		})
+	}
+
+	count, _, err := repo.GetStats()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count, "Requests with trailing data should not be processed")
+}
+
+func TestApp_JSONFieldErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		strict     bool
+		method     string
+		path       string
+		body       string
+		wantError  string
+		wantFields []FieldError
+	}{
+		{
+			name:      "Shorten syntax error",
+			method:    http.MethodPost,
+			path:      "/api/shorten",
+			body:      `{"url": "https://example.com",}`,
+			wantError: "Invalid JSON",
+			wantFields: []FieldError{
+				{Field: "", Error: "syntax error at offset 31: invalid character '}' looking for beginning of object key string"},
+			},
+		},
+		{
+			name:       "Shorten type error",
+			method:     http.MethodPost,
+			path:       "/api/shorten",
+			body:       `{"url": 42}`,
+			wantError:  "Invalid JSON",
+			wantFields: []FieldError{{Field: "url", Error: "expected string, got number"}},
+		},
+		{
+			name:       "Shorten invalid URL",
+			method:     http.MethodPost,
+			path:       "/api/shorten",
+			body:       `{"url": "not a url"}`,
+			wantError:  "Validation failed",
+			wantFields: []FieldError{{Field: "url", Error: "invalid URL"}},
+		},
+		{
+			name:   "Shorten unknown field ignored",
+			method: http.MethodPost,
+			path:   "/api/shorten",
+			body:   `{"url": "https://example.com/lenient", "extra": 1}`,
+		},
+		{
+			name:       "Shorten unknown field strict",
+			strict:     true,
+			method:     http.MethodPost,
+			path:       "/api/shorten",
+			body:       `{"url": "https://example.com", "extra": 1}`,
+			wantError:  "Invalid JSON",
+			wantFields: []FieldError{{Field: "extra", Error: "unknown field"}},
+		},
+		{
+			name:       "Batch not an array",
+			method:     http.MethodPost,
+			path:       "/api/shorten/batch",
+			body:       `{"correlation_id": "1"}`,
+			wantError:  "Invalid JSON",
+			wantFields: []FieldError{{Field: "", Error: "expected array, got object"}},
+		},
+		{
+			name:   "Batch type errors",
+			method: http.MethodPost,
+			path:   "/api/shorten/batch",
+			body:   `[{"correlation_id":"1","original_url":"https://a.com"},{"correlation_id":2,"original_url":"https://b.com"},{"correlation_id":"3","original_url":true}]`,
+			wantFields: []FieldError{
+				{Field: "[1].correlation_id", Error: "expected string, got number"},
+				{Field: "[2].original_url", Error: "expected string, got bool"},
+			},
+			wantError: "Invalid JSON",
+		},
+		{
+			name:   "Batch unknown field strict",
+			strict: true,
+			method: http.MethodPost,
+			path:   "/api/shorten/batch",
+			body:   `[{"correlation_id":"1","original_url":"https://a.com"},{"correlation_id":"2","original_url":"https://b.com","url":"x"}]`,
+			wantFields: []FieldError{
+				{Field: "[1].url", Error: "unknown field"},
+			},
+			wantError: "Invalid JSON",
+		},
+		{
+			name:   "Batch semantic errors",
+			method: http.MethodPost,
+			path:   "/api/shorten/batch",
+			body:   `[{"correlation_id":"1","original_url":"https://a.com"},{"correlation_id":"","original_url":""},{"correlation_id":"1","original_url":"invalid-url"}]`,
+			wantFields: []FieldError{
+				{Field: "[1].correlation_id", Error: "required"},
+				{Field: "[1].original_url", Error: "required"},
+				{Field: "[2].correlation_id", Error: "duplicate"},
+				{Field: "[2].original_url", Error: "invalid URL"},
+			},
+			wantError: "Validation failed",
+		},
+		{
+			name:   "Delete type and semantic errors",
+			method: http.MethodDelete,
+			path:   "/api/user/urls",
+			body:   `["id1", 2]`,
+			wantFields: []FieldError{
+				{Field: "[1]", Error: "expected string, got number"},
+			},
+			wantError: "Invalid JSON",
+		},
+		{
+			name:       "Delete empty ID",
+			method:     http.MethodDelete,
+			path:       "/api/user/urls",
+			body:       `["id1", ""]`,
+			wantFields: []FieldError{{Field: "[1]", Error: "required"}},
+			wantError:  "Validation failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+			logger := zap.NewNop()
+			appInstance := NewApp(svc, nil, logger, WithStrictJSON(tt.strict))
+			r := createTestRouter(svc, logger, map[string]http.HandlerFunc{
+				"/api/shorten":       appInstance.HandleJSONShorten,
+				"/api/shorten/batch": appInstance.HandleBatchShorten,
+				"/api/user/urls":     appInstance.HandleBatchDeleteURLs,
+			})
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, createTestRequest(tt.method, tt.path, "application/json", strings.NewReader(tt.body)))
+
+			if tt.wantError == "" {
+				assert.Less(t, rr.Code, http.StatusBadRequest, rr.Body.String())
+				return
+			}
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+			var resp ErrorResponse
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Equal(t, tt.wantError, resp.Error)
+			assert.Equal(t, tt.wantFields, resp.Fields)
+		})
+	}
+}
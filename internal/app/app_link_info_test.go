@@ -0,0 +1,176 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+func TestApp_HandleLinkInfo(t *testing.T) {
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+	logger := zap.NewNop()
+	appInstance := NewApp(svc, nil, logger, WithTrustedSubnet("10.0.0.0/8"))
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware(svc, logger))
+	appInstance.RegisterRoutes(r)
+
+	_, shortURL, err := svc.CreateShortURL("https://example.com/info", "owner")
+	assert.NoError(t, err)
+	id := strings.TrimPrefix(shortURL, "http://localhost:8080/")
+	svc.TrackClick(id, "")
+	svc.TrackClick(id, "")
+	u, _, _ := svc.Get(id)
+
+	ownerToken, err := svc.GenerateJWT("owner")
+	assert.NoError(t, err)
+	strangerToken, err := svc.GenerateJWT("stranger")
+	assert.NoError(t, err)
+
+	expected := "original_url: https://example.com/info\n" +
+		"created_at: " + u.CreatedAt.UTC().Format(time.RFC3339) + "\n" +
+		"deleted: false\n" +
+		"hits: 2\n"
+
+	tests := []struct {
+		name     string
+		path     string
+		setup    func(req *http.Request)
+		wantCode int
+		wantBody string
+	}{
+		{
+			name: "owner cookie",
+			path: "/" + id + "/info",
+			setup: func(req *http.Request) {
+				req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: ownerToken})
+			},
+			wantCode: http.StatusOK,
+			wantBody: expected,
+		},
+		{
+			name:     "owner bearer",
+			path:     "/" + id + "/info",
+			setup:    func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+ownerToken) },
+			wantCode: http.StatusOK,
+			wantBody: expected,
+		},
+		{
+			name:     "stranger",
+			path:     "/" + id + "/info",
+			setup:    func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+strangerToken) },
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "anonymous",
+			path:     "/" + id + "/info",
+			setup:    func(req *http.Request) {},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "trusted IP",
+			path:     "/" + id + "/info",
+			setup:    func(req *http.Request) { req.Header.Set("X-Real-IP", "10.1.2.3") },
+			wantCode: http.StatusOK,
+			wantBody: expected,
+		},
+		{
+			name:     "untrusted IP",
+			path:     "/" + id + "/info",
+			setup:    func(req *http.Request) { req.Header.Set("X-Real-IP", "192.168.1.1") },
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "unknown id",
+			path:     "/unknown/info",
+			setup:    func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+ownerToken) },
+			wantCode: http.StatusNotFound,
+		},
+		{
+			name:     "ref suffix",
+			path:     "/" + id + "+promo/info",
+			setup:    func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+ownerToken) },
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			tt.setup(req)
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			assert.Equal(t, tt.wantCode, rr.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, "text/plain; charset=utf-8", rr.Header().Get("Content-Type"))
+				assert.Equal(t, tt.wantBody, rr.Body.String())
+			}
+		})
+	}
+
+	// Метка "info" зарезервирована и не используется как метка кампании
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+id+"+info", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestApp_HandleLinkInfo_IgnoreClientIPHeader(t *testing.T) {
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+	logger := zap.NewNop()
+	appInstance := NewApp(svc, nil, logger, WithTrustedSubnet("10.0.0.0/8"), WithClientIPHeader(false))
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware(svc, logger))
+	appInstance.RegisterRoutes(r)
+
+	_, shortURL, err := svc.CreateShortURL("https://example.com/info", "owner")
+	assert.NoError(t, err)
+	path := strings.TrimPrefix(shortURL, "http://localhost:8080") + "/info"
+
+	// Подделанный заголовок не даёт доступа
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = "203.0.113.5:41000"
+	req.Header.Set("X-Real-IP", "10.1.2.3")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// Проверяется настоящий адрес соединения
+	req = httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = "10.1.2.3:41000"
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestApp_HandleLinkInfo_InternalTokens(t *testing.T) {
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+	logger := zap.NewNop()
+	appInstance := NewApp(svc, nil, logger, WithTrustedSubnet("10.0.0.0/8"), WithInternalTokens("current", "next"))
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware(svc, logger))
+	appInstance.RegisterRoutes(r)
+
+	_, shortURL, err := svc.CreateShortURL("https://example.com/info", "owner")
+	assert.NoError(t, err)
+	path := strings.TrimPrefix(shortURL, "http://localhost:8080") + "/info"
+
+	// В строгом режиме подсети недостаточно, как и для /api/internal
+	for token, wantCode := range map[string]int{"": http.StatusForbidden, "wrong": http.StatusForbidden, "next": http.StatusOK} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-Real-IP", "10.1.2.3")
+		if token != "" {
+			req.Header.Set(middleware.InternalTokenHeader, token)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		assert.Equal(t, wantCode, rr.Code, token)
+	}
+}
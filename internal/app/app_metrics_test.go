@@ -0,0 +1,58 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/models"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+func TestApp_HandleMetrics(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	_, err := repo.Save("taken", "https://taken.com", "user1")
+	assert.NoError(t, err)
+	ids := []string{"taken", "fresh"}
+	logger := zap.NewNop()
+	svc := service.NewService(repo, "http://localhost:8080", "secret",
+		service.WithIDGenerator(func(int) (string, error) {
+			id := ids[0]
+			ids = ids[1:]
+			return id, nil
+		}))
+	r := chi.NewRouter()
+	NewApp(svc, nil, logger).RegisterRoutes(r, middleware.TrustedSubnetMiddleware("10.0.0.0/8", logger))
+
+	readRetries := func() float64 {
+		req := httptest.NewRequest(http.MethodGet, "/api/internal/metrics", nil)
+		req.Header.Set("X-Real-IP", "10.0.0.1")
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var vars map[string]any
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &vars))
+		retries, ok := vars["id_generation_retries"].(float64)
+		assert.True(t, ok, "Counter should be exported")
+		return retries
+	}
+
+	// Коллизия сгенерированного ID видна в счётчике
+	before := readRetries()
+	_, err = svc.BatchShorten([]models.BatchRequest{{CorrelationID: "1", OriginalURL: "https://example.com"}}, "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, before+1, readRetries())
+
+	// Доступ только из доверенной подсети
+	req := httptest.NewRequest(http.MethodGet, "/api/internal/metrics", nil)
+	req.Header.Set("X-Real-IP", "192.168.0.1")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
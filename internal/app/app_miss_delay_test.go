@@ -0,0 +1,89 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+func TestApp_HandleGetURL_MissDelay(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	_, err := repo.Save("known", "https://example.com", "user1")
+	assert.NoError(t, err)
+	_, err = repo.Save("gone", "https://example.org", "user1")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.BatchDelete("user1", []string{"gone"}))
+	svc := service.NewService(repo, "http://localhost:8080", "secret")
+
+	tests := []struct {
+		name      string
+		maxDelay  time.Duration
+		id        string
+		wantCode  int
+		wantDelay bool
+	}{
+		{name: "Miss with delay", maxDelay: 100 * time.Millisecond, id: "unknown", wantCode: http.StatusBadRequest, wantDelay: true},
+		{name: "Deleted with delay", maxDelay: 100 * time.Millisecond, id: "gone", wantCode: http.StatusGone, wantDelay: true},
+		{name: "Hit with the same delay", maxDelay: 100 * time.Millisecond, id: "known", wantCode: http.StatusTemporaryRedirect, wantDelay: true},
+		{name: "Miss disabled by default", id: "unknown", wantCode: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appInstance := NewApp(svc, nil, zap.NewNop(), WithMissDelay(tt.maxDelay))
+			var delays []time.Duration
+			appInstance.sleep = func(_ context.Context, d time.Duration) { delays = append(delays, d) }
+			r := createTestRouter(svc, zap.NewNop(), map[string]http.HandlerFunc{"/{id}": appInstance.HandleGetURL})
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/"+tt.id, nil))
+			assert.Equal(t, tt.wantCode, rr.Code)
+			if !tt.wantDelay {
+				assert.Empty(t, delays)
+				return
+			}
+			assert.Len(t, delays, 1)
+			// Задержка отсчитывается от начала обработки, поэтому может быть чуть меньше maxDelay/2
+			for _, d := range delays {
+				assert.GreaterOrEqual(t, d, tt.maxDelay/2-10*time.Millisecond)
+				assert.LessOrEqual(t, d, tt.maxDelay)
+			}
+		})
+	}
+}
+
+func TestApp_HandleGetURL_MissDelayTiming(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	_, err := repo.Save("known", "https://example.com", "user1")
+	assert.NoError(t, err)
+	svc := service.NewService(repo, "http://localhost:8080", "secret")
+	appInstance := NewApp(svc, nil, zap.NewNop(), WithMissDelay(40*time.Millisecond))
+	r := createTestRouter(svc, zap.NewNop(), map[string]http.HandlerFunc{"/{id}": appInstance.HandleGetURL})
+
+	start := time.Now()
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	// Попадание выравнивается к тому же нижнему порогу
+	start = time.Now()
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/known", nil))
+	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+
+	// Отмена запроса прерывает задержку
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start = time.Now()
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/unknown", nil).WithContext(ctx))
+	assert.Less(t, time.Since(start), 20*time.Millisecond)
+}
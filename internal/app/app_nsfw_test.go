@@ -0,0 +1,101 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"github.com/tempizhere/goshorty/internal/ui"
+	"go.uber.org/zap"
+)
+
+func TestApp_NSFWFlag(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	for _, id := range []string{"flagged", "clean"} {
+		_, err := repo.Save(id, "https://example.com/"+id, "user1")
+		assert.NoError(t, err)
+	}
+	svc := service.NewService(repo, "http://localhost:8080", "secret")
+	logger := zap.NewNop()
+	pages, err := ui.NewPages("en")
+	assert.NoError(t, err)
+	r := chi.NewRouter()
+	NewApp(svc, nil, logger, WithPages(pages)).RegisterRoutes(r, middleware.TrustedSubnetMiddleware("10.0.0.0/8", logger))
+
+	flag := func(body, realIP string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/internal/flag-nsfw", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Real-IP", realIP)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", accept)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	assert.Equal(t, http.StatusForbidden, flag(`{"id":"flagged"}`, "192.168.1.1").Code)
+	assert.Equal(t, http.StatusNotFound, flag(`{"id":"missing"}`, "10.0.0.1").Code)
+	assert.Equal(t, http.StatusBadRequest, flag(`{"nsfw":true}`, "10.0.0.1").Code)
+
+	rr := flag(`{"id":"flagged"}`, "10.0.0.1")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"id":"flagged","nsfw":true}`, rr.Body.String())
+
+	// Помеченная ссылка показывает предупреждение вместо редиректа
+	rr = get("/flagged", "text/html")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get("Location"))
+	assert.Equal(t, "noindex, nofollow", rr.Header().Get("X-Robots-Tag"))
+	assert.Contains(t, rr.Body.String(), "Sensitive content warning")
+	assert.Contains(t, rr.Body.String(), `href="https://example.com/flagged"`)
+
+	rr = get("/api/expand/flagged", "application/json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"url":"https://example.com/flagged","nsfw":true}`, rr.Body.String())
+	assert.Equal(t, "noindex, nofollow", rr.Header().Get("X-Robots-Tag"))
+
+	// Непомеченные ссылки работают как прежде
+	rr = get("/clean", "text/html")
+	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	assert.Equal(t, "https://example.com/clean", rr.Header().Get("Location"))
+	assert.Empty(t, rr.Header().Get("X-Robots-Tag"))
+	rr = get("/api/expand/clean", "application/json")
+	assert.JSONEq(t, `{"url":"https://example.com/clean"}`, rr.Body.String())
+	assert.Empty(t, rr.Header().Get("X-Robots-Tag"))
+
+	// Снятие пометки возвращает мгновенный редирект
+	rr = flag(`{"id":"flagged","nsfw":false}`, "10.0.0.1")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"id":"flagged","nsfw":false}`, rr.Body.String())
+	rr = get("/flagged", "text/html")
+	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	assert.Equal(t, "https://example.com/flagged", rr.Header().Get("Location"))
+}
+
+func TestApp_NSFWInterstitialWithoutPages(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	_, err := repo.Save("flagged", "https://example.com/flagged", "user1")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.SetNSFW("flagged", true))
+	svc := service.NewService(repo, "http://localhost:8080", "secret")
+	r := chi.NewRouter()
+	NewApp(svc, nil, zap.NewNop()).RegisterRoutes(r)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/flagged", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get("Location"))
+	assert.Equal(t, "noindex, nofollow", rr.Header().Get("X-Robots-Tag"))
+	assert.Contains(t, rr.Body.String(), "Continue: https://example.com/flagged")
+}
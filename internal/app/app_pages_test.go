@@ -0,0 +1,57 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"github.com/tempizhere/goshorty/internal/ui"
+	"go.uber.org/zap"
+)
+
+func TestApp_HandleGetURL_ErrorPages(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	_, err := repo.Save("deleted", "https://example.com/old", "user1")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.BatchDelete("user1", []string{"deleted"}))
+
+	svc := service.NewService(repo, "http://localhost:8080", "secret")
+	pages, err := ui.NewPages("en")
+	assert.NoError(t, err)
+	appInstance := NewApp(svc, nil, zap.NewNop(), WithPages(pages))
+	r := chi.NewRouter()
+	r.Get("/{id}", appInstance.HandleGetURL)
+
+	tests := []struct {
+		name           string
+		path           string
+		accept         string
+		acceptLanguage string
+		wantCode       int
+		wantBody       string
+	}{
+		{name: "Not found ru", path: "/missing", accept: "text/html", acceptLanguage: "ru-RU,ru;q=0.9,en;q=0.8", wantCode: http.StatusNotFound, wantBody: "Ссылка не найдена"},
+		{name: "Not found en", path: "/missing", accept: "text/html", acceptLanguage: "en-GB", wantCode: http.StatusNotFound, wantBody: "Link not found"},
+		{name: "Gone ru", path: "/deleted", accept: "text/html,application/xhtml+xml", acceptLanguage: "ru", wantCode: http.StatusGone, wantBody: "Ссылка удалена"},
+		{name: "Gone default language", path: "/deleted", accept: "text/html", acceptLanguage: "fr", wantCode: http.StatusGone, wantBody: "Link removed"},
+		// API-клиенты получают прежние текстовые ответы на английском
+		{name: "Not found API", path: "/missing", acceptLanguage: "ru", wantCode: http.StatusBadRequest, wantBody: "URL not found\n"},
+		{name: "Gone API", path: "/deleted", accept: "*/*", acceptLanguage: "ru", wantCode: http.StatusGone, wantBody: "URL is deleted\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.Header.Set("Accept", tt.accept)
+			req.Header.Set("Accept-Language", tt.acceptLanguage)
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			assert.Equal(t, tt.wantCode, rr.Code)
+			assert.Contains(t, rr.Body.String(), tt.wantBody)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/models"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+func TestCleanPastedURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		raw         string
+		want        string
+		wantChanged bool
+	}{
+		// Корректные URL не меняются, даже если оканчиваются на знаки препинания
+		{name: "Valid", raw: "https://example.com/path?q=1", want: "https://example.com/path?q=1"},
+		{name: "Valid trailing dot", raw: "https://example.com/file.", want: "https://example.com/file."},
+		{name: "Valid trailing paren", raw: "https://en.wikipedia.org/wiki/Go_(programming_language)", want: "https://en.wikipedia.org/wiki/Go_(programming_language)"},
+		{name: "Valid trailing comma", raw: "https://example.com/a,b,", want: "https://example.com/a,b,"},
+		{name: "Valid quote inside", raw: `https://example.com/search?q="go"`, want: `https://example.com/search?q="go"`},
+
+		// Вставки из почты, мессенджеров и документов
+		{name: "Double quotes", raw: `"https://example.com/page"`, want: "https://example.com/page", wantChanged: true},
+		{name: "Single quotes", raw: "'https://example.com/page'", want: "https://example.com/page", wantChanged: true},
+		{name: "Backticks", raw: "`https://example.com/page`", want: "https://example.com/page", wantChanged: true},
+		{name: "Angle brackets from email", raw: "<https://example.com/page>", want: "https://example.com/page", wantChanged: true},
+		{name: "Parentheses", raw: "(https://example.com/page)", want: "https://example.com/page", wantChanged: true},
+		{name: "Square brackets", raw: "[https://example.com/page]", want: "https://example.com/page", wantChanged: true},
+		{name: "Typographic quotes", raw: "“https://example.com/page”", want: "https://example.com/page", wantChanged: true},
+		{name: "Guillemets", raw: "«https://example.com/page»", want: "https://example.com/page", wantChanged: true},
+		{name: "Trailing space", raw: "https://example.com/page ", want: "https://example.com/page", wantChanged: true},
+		{name: "Leading tab", raw: "\thttps://example.com/page", want: "https://example.com/page", wantChanged: true},
+		{name: "Spaces inside quotes", raw: `" https://example.com/page "`, want: "https://example.com/page", wantChanged: true},
+		{name: "Quotes then comma", raw: `"https://example.com/page",`, want: "https://example.com/page", wantChanged: true},
+		{name: "Brackets then period", raw: "<https://example.com/page>.", want: "https://example.com/page", wantChanged: true},
+		{name: "Sentence in parentheses", raw: "(https://example.com/page).", want: "https://example.com/page", wantChanged: true},
+		{name: "Nested wrappers", raw: `("https://example.com/page");`, want: "https://example.com/page", wantChanged: true},
+		{name: "Paren inside brackets", raw: "<https://en.wikipedia.org/wiki/Go_(programming_language)>", want: "https://en.wikipedia.org/wiki/Go_(programming_language)", wantChanged: true},
+		{name: "Invalid port with period", raw: "https://example.com:8080.", want: "https://example.com:8080", wantChanged: true},
+
+		// Если очистка не даёт корректного URL, строка остаётся как есть и отклоняется проверкой
+		{name: "Not a URL", raw: `"not a url"`, want: `"not a url"`},
+		{name: "Unmatched quote", raw: `"https://example.com/page`, want: `"https://example.com/page`},
+		{name: "Mismatched wrappers", raw: "<https://example.com/page)", want: "<https://example.com/page)"},
+		{name: "Empty quotes", raw: `""`, want: `""`},
+		{name: "Only punctuation", raw: ".,;)", want: ".,;)"},
+		{name: "Empty", raw: "", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := cleanPastedURL(tt.raw)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantChanged, changed)
+		})
+	}
+}
+
+func TestApp_PastedURLCleanup(t *testing.T) {
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+	logger := zap.NewNop()
+	appInstance := NewApp(svc, nil, logger)
+	r := createTestRouter(svc, logger, map[string]http.HandlerFunc{
+		"/":                  appInstance.HandlePostURL,
+		"/api/shorten":       appInstance.HandleJSONShorten,
+		"/api/shorten/batch": appInstance.HandleBatchShorten,
+		"/api/user/urls":     appInstance.HandleUserURLs,
+	})
+	token, err := svc.GenerateJWT("user1")
+	assert.NoError(t, err)
+	post := func(target, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: token})
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	before := pastedURLCleanups.Value()
+
+	assert.Equal(t, http.StatusCreated, post("/", "text/plain", `"https://example.com/plain"`).Code)
+	assert.Equal(t, http.StatusCreated, post("/api/shorten", "application/json", `{"url":"<https://example.com/json>"}`).Code)
+	rr := post("/api/shorten/batch", "application/json",
+		`[{"correlation_id":"1","original_url":"(https://example.com/batch)."},{"correlation_id":"2","original_url":"https://example.com/valid."}]`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, before+3, pastedURLCleanups.Value())
+
+	// Очищенный URL совпадает с уже сохранённым и даёт конфликт
+	assert.Equal(t, http.StatusConflict, post("/", "text/plain", "https://example.com/json").Code)
+
+	// Мусор по-прежнему отклоняется
+	rr = post("/api/shorten/batch", "application/json", `[{"correlation_id":"1","original_url":"\"not a url\""}]`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "invalid URL")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+	req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: token})
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	var urls []models.ShortURLResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &urls))
+	var originals []string
+	for _, u := range urls {
+		originals = append(originals, u.OriginalURL)
+	}
+	assert.ElementsMatch(t, []string{
+		"https://example.com/plain",
+		"https://example.com/json",
+		"https://example.com/batch",
+		"https://example.com/valid.",
+	}, originals)
+}
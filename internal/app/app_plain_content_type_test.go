@@ -0,0 +1,94 @@
+package app
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+func TestApp_HandlePostURL_ContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		strict      bool
+		contentType string
+		wantCode    int
+		wantBody    string
+	}{
+		{name: "Lenient text/plain", contentType: "text/plain; charset=utf-8", wantCode: http.StatusCreated},
+		{name: "Lenient JSON", contentType: "application/json", wantCode: http.StatusCreated},
+		{name: "Lenient empty", contentType: "", wantCode: http.StatusCreated},
+		{name: "Strict text/plain", strict: true, contentType: "text/plain; charset=utf-8", wantCode: http.StatusCreated},
+		{name: "Strict x-gzip", strict: true, contentType: "application/x-gzip", wantCode: http.StatusCreated},
+		{name: "Strict JSON", strict: true, contentType: "application/json", wantCode: http.StatusBadRequest, wantBody: "Content-Type must be text/plain\n"},
+		{name: "Strict empty", strict: true, contentType: "", wantCode: http.StatusBadRequest, wantBody: "Content-Type must be text/plain\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := repository.NewMemoryRepository()
+			svc := service.NewService(repo, "http://localhost:8080", "secret")
+			logger := zap.NewNop()
+			appInstance := NewApp(svc, nil, logger, WithStrictPlainContentType(tt.strict))
+			r := createTestRouter(svc, logger, map[string]http.HandlerFunc{"/": appInstance.HandlePostURL})
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, createTestRequest(http.MethodPost, "/", tt.contentType, strings.NewReader("https://example.com")))
+			assert.Equal(t, tt.wantCode, rr.Code)
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, rr.Body.String())
+			}
+
+			count, _, err := repo.GetStats()
+			assert.NoError(t, err)
+			if tt.wantCode == http.StatusCreated {
+				assert.Equal(t, 1, count)
+			} else {
+				assert.Equal(t, 0, count, "Rejected request should not be stored")
+			}
+		})
+	}
+}
+
+func TestApp_HandlePostURL_GzipContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		strict      bool
+		contentType string
+		wantCode    int
+	}{
+		{name: "Lenient x-gzip", contentType: "application/x-gzip", wantCode: http.StatusCreated},
+		{name: "Lenient octet-stream", contentType: "application/octet-stream", wantCode: http.StatusCreated},
+		{name: "Strict text/plain", strict: true, contentType: "text/plain", wantCode: http.StatusCreated},
+		{name: "Strict octet-stream", strict: true, contentType: "application/octet-stream", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := repository.NewMemoryRepository()
+			svc := service.NewService(repo, "http://localhost:8080", "secret")
+			logger := zap.NewNop()
+			appInstance := NewApp(svc, nil, logger, WithStrictPlainContentType(tt.strict))
+			r := chi.NewRouter()
+			r.Use(middleware.GzipMiddleware)
+			r.Use(middleware.AuthMiddleware(svc, logger))
+			r.Post("/", appInstance.HandlePostURL)
+
+			body, err := compressData([]byte("https://example.com"))
+			assert.NoError(t, err)
+			req := createTestRequest(http.MethodPost, "/", tt.contentType, bytes.NewReader(body))
+			req.Header.Set("Content-Encoding", "gzip")
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			assert.Equal(t, tt.wantCode, rr.Code, rr.Body.String())
+		})
+	}
+}
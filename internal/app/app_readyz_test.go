@@ -0,0 +1,141 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+func TestApp_HandleReadyz_Drain(t *testing.T) {
+	_, repo, _, appInstance, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	_, err := repo.Save("testID", "https://example.com", "user1")
+	assert.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Get("/readyz", appInstance.HandleReadyz)
+	r.Get("/{id}", appInstance.HandleGetURL)
+
+	get := func(path string) int {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr.Code
+	}
+
+	// До остановки экземпляр готов
+	assert.Equal(t, http.StatusOK, get("/readyz"))
+
+	delay := 200 * time.Millisecond
+	done := make(chan struct{})
+	start := time.Now()
+	go func() {
+		appInstance.Drain(context.Background(), delay)
+		close(done)
+	}()
+
+	// Во время задержки /readyz отвечает 503, а остальные маршруты продолжают работать
+	assert.Eventually(t, func() bool {
+		return get("/readyz") == http.StatusServiceUnavailable
+	}, delay/2, 5*time.Millisecond)
+	assert.Equal(t, http.StatusTemporaryRedirect, get("/testID"))
+
+	select {
+	case <-done:
+		assert.GreaterOrEqual(t, time.Since(start), delay, "Drain should wait for the configured delay")
+	case <-time.After(2 * time.Second):
+		t.Fatal("Drain did not return after delay")
+	}
+}
+
+func TestApp_Drain_ContextCanceled(t *testing.T) {
+	_, _, _, appInstance, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	appInstance.Drain(ctx, time.Minute)
+	assert.Less(t, time.Since(start), time.Second, "Drain should return when context is canceled")
+}
+
+func TestApp_HandleReadyz_StaleStorage(t *testing.T) {
+	cfg, repo, _, appInstance, _, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	fileRepo, ok := repo.(*repository.FileRepository)
+	assert.True(t, ok, "Test environment should use file repository")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go fileRepo.Watch(ctx, 5*time.Millisecond, false)
+
+	readyz := func() int {
+		rr := httptest.NewRecorder()
+		appInstance.HandleReadyz(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rr.Code
+	}
+	assert.Equal(t, http.StatusOK, readyz())
+
+	// Подменяем файл хранилища, как при восстановлении из бэкапа
+	restored := cfg.FileStoragePath + ".restore"
+	assert.NoError(t, os.WriteFile(restored, []byte("{}\n"), 0644))
+	assert.NoError(t, os.Rename(restored, cfg.FileStoragePath))
+
+	assert.Eventually(t, func() bool {
+		return readyz() == http.StatusServiceUnavailable
+	}, time.Second, 5*time.Millisecond, "/readyz should report stale storage")
+}
+
+func TestApp_HealthPath(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	_, err := repo.Save("healthz", "https://example.com", "user1")
+	assert.NoError(t, err)
+	svc := service.NewService(repo, "http://localhost:8080", "secret")
+	appInstance := NewApp(svc, nil, zap.NewNop(), WithHealthPath("/api/healthz"))
+	r := chi.NewRouter()
+	appInstance.RegisterRoutes(r)
+
+	get := func(path string) int {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr.Code
+	}
+	assert.Equal(t, http.StatusOK, get("/api/healthz"))
+	assert.Equal(t, http.StatusOK, get("/readyz"))
+	// Короткий ID с тем же именем по-прежнему перенаправляет
+	assert.Equal(t, http.StatusTemporaryRedirect, get("/healthz"))
+
+	appInstance.Drain(context.Background(), 0)
+	assert.Equal(t, http.StatusServiceUnavailable, get("/api/healthz"))
+}
+
+func TestApp_HealthPath_Collision(t *testing.T) {
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+	r := chi.NewRouter()
+	NewApp(svc, nil, zap.NewNop(), WithHealthPath("/api/user/urls")).RegisterRoutes(r)
+
+	// Существующий маршрут не перекрывается проверкой готовности
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/user/urls", nil))
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
+func TestValidateHealthPath(t *testing.T) {
+	for _, path := range []string{"/api/healthz", "/api/internal/health", "/readyz/live"} {
+		assert.NoError(t, ValidateHealthPath(path), path)
+	}
+	for _, path := range []string{"", "healthz", "/healthz", "/api", "/api/", "/status/health", "/api/{id}", "/api//health"} {
+		assert.ErrorIs(t, ValidateHealthPath(path), ErrInvalidHealthPath, path)
+	}
+}
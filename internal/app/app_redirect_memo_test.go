@@ -0,0 +1,151 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/events"
+	"github.com/tempizhere/goshorty/internal/models"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+// newRedirectMemoTestApp создаёт приложение с памятью повторов, время в которой не идёт,
+// чтобы записи не истекали во время теста
+func newRedirectMemoTestApp(t *testing.T, enabled bool) (*countingRepository, *service.Service, *App, http.Handler) {
+	repo := &countingRepository{Repository: repository.NewMemoryRepository()}
+	_, err := repo.Save("abc", "https://example.com", "user1")
+	assert.NoError(t, err)
+	svc := service.NewService(repo, "http://localhost:8080", "secret", service.WithNotifier(events.NewNotifier(0)))
+	appInstance := NewApp(svc, nil, zap.NewNop(), WithRedirectMemo(enabled))
+	if appInstance.redirectMemo != nil {
+		frozen := time.Now()
+		appInstance.redirectMemo.now = func() time.Time { return frozen }
+	}
+	r := createTestRouter(svc, zap.NewNop(), map[string]http.HandlerFunc{"/{id}": appInstance.HandleGetURL})
+	return repo, svc, appInstance, r
+}
+
+func redirectFrom(r http.Handler, id, ip string) int {
+	req := httptest.NewRequest(http.MethodGet, "/"+id, nil)
+	req.Header.Set("X-Real-IP", ip)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr.Code
+}
+
+func TestApp_RedirectMemo_Burst(t *testing.T) {
+	repo, _, _, r := newRedirectMemoTestApp(t, true)
+	hits := redirectMemoHits.Value()
+
+	const burst = 50
+	codes := make([]int, burst)
+	var wg sync.WaitGroup
+	for i := range burst {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = redirectFrom(r, "abc", "203.0.113.7")
+		}()
+	}
+	wg.Wait()
+
+	for _, code := range codes {
+		assert.Equal(t, http.StatusTemporaryRedirect, code)
+	}
+	assert.Equal(t, int32(1), repo.lookups.Load())
+	assert.Equal(t, int64(burst-1), redirectMemoHits.Value()-hits)
+
+	// Другой клиент разрешает ссылку заново
+	assert.Equal(t, http.StatusTemporaryRedirect, redirectFrom(r, "abc", "198.51.100.1"))
+	assert.Equal(t, int32(2), repo.lookups.Load())
+}
+
+func TestApp_RedirectMemo_MissNotMemoized(t *testing.T) {
+	repo, _, _, r := newRedirectMemoTestApp(t, true)
+
+	assert.Equal(t, http.StatusBadRequest, redirectFrom(r, "unknown", "203.0.113.7"))
+	assert.Equal(t, http.StatusBadRequest, redirectFrom(r, "unknown", "203.0.113.7"))
+	assert.Equal(t, int32(2), repo.lookups.Load())
+}
+
+func TestApp_RedirectMemo_InvalidatedOnDelete(t *testing.T) {
+	_, svc, appInstance, r := newRedirectMemoTestApp(t, true)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		appInstance.WatchRedirectMemo(ctx)
+		close(done)
+	}()
+
+	// Дожидаемся подписки наблюдателя: запомненная запись сбрасывается событием изменения ссылки
+	assert.Equal(t, http.StatusTemporaryRedirect, redirectFrom(r, "abc", "203.0.113.7"))
+	assert.Eventually(t, func() bool {
+		assert.NoError(t, svc.SetNSFW("abc", false))
+		return appInstance.redirectMemo.len() == 0
+	}, 2*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, http.StatusTemporaryRedirect, redirectFrom(r, "abc", "203.0.113.7"))
+	assert.NoError(t, svc.BatchDelete("user1", []string{"abc"}))
+	// Время в памяти остановлено, поэтому 410 возможен только после сброса записи по событию удаления
+	assert.Eventually(t, func() bool {
+		return redirectFrom(r, "abc", "203.0.113.7") == http.StatusGone
+	}, 2*time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
+
+func TestApp_RedirectMemo_Disabled(t *testing.T) {
+	repo, _, appInstance, r := newRedirectMemoTestApp(t, false)
+	assert.Nil(t, appInstance.redirectMemo)
+
+	for range 3 {
+		assert.Equal(t, http.StatusTemporaryRedirect, redirectFrom(r, "abc", "203.0.113.7"))
+	}
+	assert.Equal(t, int32(3), repo.lookups.Load())
+	// Без памяти наблюдатель сразу завершается
+	appInstance.WatchRedirectMemo(context.Background())
+}
+
+func TestRedirectMemo_Capacity(t *testing.T) {
+	memo := newRedirectMemo(time.Second, 2)
+	now := time.Now()
+	memo.now = func() time.Time { return now }
+	lookups := 0
+	lookup := func(id string) (models.URL, bool, error) {
+		lookups++
+		return models.URL{ShortID: id, OriginalURL: "https://example.com/" + id}, true, nil
+	}
+
+	for _, ip := range []string{"203.0.113.1", "203.0.113.2", "203.0.113.3"} {
+		_, found, err := memo.resolve("abc", ip, lookup)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		now = now.Add(100 * time.Millisecond)
+	}
+	// При заполненной памяти забывается разрешение, которое истекло бы первым
+	assert.Equal(t, 2, memo.len())
+	assert.Equal(t, 2, memo.expiry.Len())
+	_, _, _ = memo.resolve("abc", "203.0.113.3", lookup)
+	assert.Equal(t, 3, lookups)
+	_, _, _ = memo.resolve("abc", "203.0.113.1", lookup)
+	assert.Equal(t, 4, lookups)
+
+	// Истёкшие записи удаляются с начала очереди
+	now = now.Add(time.Hour)
+	_, _, _ = memo.resolve("xyz", "203.0.113.9", lookup)
+	assert.Equal(t, 1, memo.len())
+	assert.Equal(t, 1, memo.expiry.Len())
+
+	memo.invalidate("xyz")
+	assert.Zero(t, memo.len())
+	assert.Zero(t, memo.expiry.Len())
+}
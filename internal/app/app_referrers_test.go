@@ -0,0 +1,105 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/models"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+func TestApp_RedirectRecordsReferrer(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		repo := repository.NewMemoryRepository()
+		_, err := repo.Save("abc", "https://example.com", "user1")
+		assert.NoError(t, err)
+		svc := service.NewService(repo, "http://localhost:8080", "secret", service.WithReferrerTracking(enabled))
+		logger := zap.NewNop()
+		appInstance := NewApp(svc, nil, logger)
+
+		r := chi.NewRouter()
+		r.Use(middleware.AuthMiddleware(svc, logger))
+		r.Get("/{id}", appInstance.HandleGetURL)
+		r.Get("/api/user/stats", appInstance.HandleUserStats)
+
+		for _, referrer := range []string{"https://news.example/story", "https://news.example/other", ""} {
+			req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+			if referrer != "" {
+				req.Header.Set("Referer", referrer)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+		}
+
+		token, err := svc.GenerateJWT("user1")
+		assert.NoError(t, err)
+		userStats := func() models.UserStats {
+			req := httptest.NewRequest(http.MethodGet, "/api/user/stats", nil)
+			req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: token})
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			var stats models.UserStats
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &stats))
+			return stats
+		}
+
+		if !enabled {
+			// Выключенный учёт не пишет в хранилище и не меняет ответ статистики
+			top, err := repo.TopReferrers([]string{"abc"}, 5)
+			assert.NoError(t, err)
+			assert.Empty(t, top)
+			assert.Nil(t, userStats().TopReferrers)
+			continue
+		}
+
+		// Запись асинхронная: ждём её в хранилище, прежде чем статистика попадёт в кеш сервиса
+		assert.Eventually(t, func() bool {
+			top, err := repo.TopReferrers([]string{"abc"}, 5)
+			return err == nil && len(top["abc"]) == 1 && top["abc"][0].Clicks == 2
+		}, time.Second, 5*time.Millisecond)
+		assert.Equal(t, []models.LinkReferrers{
+			{ShortID: "abc", Referrers: []models.ReferrerCount{{Referrer: "news.example", Clicks: 2}}},
+		}, userStats().TopReferrers)
+	}
+}
+
+func TestApp_RecordReferrerBounded(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	_, err := repo.Save("abc", "https://example.com", "user1")
+	assert.NoError(t, err)
+	svc := service.NewService(repo, "http://localhost:8080", "secret", service.WithReferrerTracking(true))
+	appInstance := NewApp(svc, nil, zap.NewNop())
+
+	// Все слоты заняты медленными записями: новый переход не порождает горутину и не учитывается
+	for i := 0; i < maxPendingReferrers; i++ {
+		appInstance.referrerSlots <- struct{}{}
+	}
+	dropped := referrerDrops.Value()
+	req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	req.Header.Set("Referer", "https://news.example/story")
+	rr := httptest.NewRecorder()
+	r := chi.NewRouter()
+	r.Get("/{id}", appInstance.HandleGetURL)
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	assert.Equal(t, dropped+1, referrerDrops.Value())
+
+	// После освобождения слота переходы снова учитываются
+	<-appInstance.referrerSlots
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Eventually(t, func() bool {
+		top, err := repo.TopReferrers([]string{"abc"}, 5)
+		return err == nil && len(top["abc"]) == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, dropped+1, referrerDrops.Value())
+}
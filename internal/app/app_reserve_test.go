@@ -0,0 +1,110 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+func TestApp_ReserveAndActivate(t *testing.T) {
+	// Генератор повторяет ID, чтобы обычное сокращение наткнулось на зарезервированные коды;
+	// идентификаторы пользователей (12 символов hex) последовательность не расходуют
+	sequence := []string{"code0001", "code0002", "code0001", "code0002", "code0003"}
+	next, users := 0, 0
+	generate := func(length int) (string, error) {
+		if length == 12 {
+			users++
+			return fmt.Sprintf("%012x", users), nil
+		}
+		id := sequence[next%len(sequence)]
+		next++
+		return id, nil
+	}
+	repo := repository.NewMemoryRepository()
+	svc := service.NewService(repo, "http://localhost:8080", "secret",
+		service.WithIDGenerator(generate), service.WithUserIDEncoding(service.UserIDHex))
+	logger := zap.NewNop()
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware(svc, logger))
+	NewApp(svc, nil, logger).RegisterRoutes(r, middleware.TrustedSubnetMiddleware("10.0.0.0/8", logger))
+
+	reserve := func(body, realIP string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/internal/reserve", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Real-IP", realIP)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	update := func(id, body, userID string) *httptest.ResponseRecorder {
+		token, err := svc.GenerateJWT(userID)
+		assert.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPut, "/api/urls/"+id, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: token})
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	assert.Equal(t, http.StatusForbidden, reserve(`{"count":2,"user_id":"printer"}`, "192.168.1.1").Code)
+	assert.Equal(t, http.StatusBadRequest, reserve(`{"count":0,"user_id":"printer"}`, "10.0.0.1").Code)
+	assert.Equal(t, http.StatusBadRequest, reserve(`{"count":2}`, "10.0.0.1").Code)
+
+	rr := reserve(`{"count":2,"user_id":"printer"}`, "10.0.0.1")
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var resp ReserveResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, ReserveResponse{UserID: "printer", IDs: []string{"code0001", "code0002"}}, resp)
+
+	// До активации код не ведёт никуда и не попадает в статистику и список ссылок владельца
+	assert.Equal(t, http.StatusBadRequest, get("/code0001").Code)
+	assert.Equal(t, http.StatusNotFound, get("/api/expand/code0001").Code)
+	urls, err := svc.GetURLsByUserID("printer")
+	assert.NoError(t, err)
+	assert.Empty(t, urls)
+	urlCount, userCount, err := svc.GetStats()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, urlCount)
+	assert.Equal(t, 0, userCount)
+
+	// Обычное сокращение не занимает зарезервированные коды
+	_, shortURL, err := svc.CreateShortURL("https://example.com/regular", "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/code0003", shortURL)
+
+	// Задать адрес может только владелец резерва
+	assert.Equal(t, http.StatusNotFound, update("code0001", `{"url":"https://example.com/poster"}`, "stranger").Code)
+	assert.Equal(t, http.StatusNotFound, update("missing", `{"url":"https://example.com/poster"}`, "printer").Code)
+	assert.Equal(t, http.StatusBadRequest, update("code0001", `{"url":"not a url"}`, "printer").Code)
+	assert.Equal(t, http.StatusBadRequest, update("code0001", `{}`, "printer").Code)
+
+	rr = update("code0001", `{"url":"https://example.com/poster"}`, "printer")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"result":"http://localhost:8080/code0001"}`, rr.Body.String())
+	assert.Equal(t, http.StatusConflict, update("code0001", `{"url":"https://example.com/other"}`, "printer").Code)
+	assert.Equal(t, http.StatusConflict, update("code0002", `{"url":"https://example.com/regular"}`, "printer").Code)
+
+	rr = get("/code0001")
+	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	assert.Equal(t, "https://example.com/poster", rr.Header().Get("Location"))
+	urlCount, userCount, err = svc.GetStats()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, urlCount)
+	assert.Equal(t, 2, userCount)
+}
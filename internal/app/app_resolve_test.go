@@ -0,0 +1,99 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/models"
+)
+
+func TestApp_HandleResolve(t *testing.T) {
+	_, repo, _, appInstance, logger, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	// Подготавливаем активную и удалённую ссылки
+	_, err := repo.Save("activeID", "https://active.com", "user1")
+	assert.NoError(t, err)
+	_, err = repo.Save("deletedID", "https://deleted.com", "user1")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.BatchDelete("user1", []string{"deletedID"}))
+
+	r := chi.NewRouter()
+	r.Route("/api/internal", func(r chi.Router) {
+		r.Use(middleware.TrustedSubnetMiddleware("192.168.1.0/24", logger))
+		r.Post("/resolve", appInstance.HandleResolve)
+	})
+
+	tests := []struct {
+		name           string
+		clientIP       string
+		body           string
+		expectedStatus int
+		expected       []models.ResolveResult
+	}{
+		{
+			name:           "Untrusted IP - should deny access",
+			clientIP:       "10.0.0.1",
+			body:           `["activeID"]`,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Missing X-Real-IP - should deny access",
+			body:           `["activeID"]`,
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:           "Trusted IP - returns statuses in request order",
+			clientIP:       "192.168.1.100",
+			body:           `["deletedID","unknownID","activeID"]`,
+			expectedStatus: http.StatusOK,
+			expected: []models.ResolveResult{
+				{ID: "deletedID", Status: models.ResolveStatusDeleted, URL: "https://deleted.com"},
+				{ID: "unknownID", Status: models.ResolveStatusNotFound},
+				{ID: "activeID", Status: models.ResolveStatusOK, URL: "https://active.com"},
+			},
+		},
+		{
+			name:           "Empty batch",
+			clientIP:       "192.168.1.100",
+			body:           `[]`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Invalid JSON",
+			clientIP:       "192.168.1.100",
+			body:           `{"id":"activeID"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "Batch too large",
+			clientIP:       "192.168.1.100",
+			body:           `[` + strings.Repeat(`"activeID",`, maxResolveBatch) + `"activeID"]`,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := createTestRequest(http.MethodPost, "/api/internal/resolve", "application/json", strings.NewReader(tt.body))
+			if tt.clientIP != "" {
+				req.Header.Set("X-Real-IP", tt.clientIP)
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+			if tt.expected != nil {
+				var resp []models.ResolveResult
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+				assert.Equal(t, tt.expected, resp)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/models"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+func TestWantsIDResponse(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		prefer string
+		want   bool
+	}{
+		{name: "Default", target: "/api/shorten", want: false},
+		{name: "Query", target: "/api/shorten?response=id", want: true},
+		{name: "Other query value", target: "/api/shorten?response=url", want: false},
+		{name: "Prefer", target: "/api/shorten", prefer: "response=id", want: true},
+		{name: "Prefer among others", target: "/api/shorten", prefer: "respond-async, response=id", want: true},
+		{name: "Other Prefer", target: "/api/shorten", prefer: "return=minimal", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.target, nil)
+			if tt.prefer != "" {
+				req.Header.Set("Prefer", tt.prefer)
+			}
+			assert.Equal(t, tt.want, wantsIDResponse(req))
+		})
+	}
+}
+
+func TestApp_ResponseID(t *testing.T) {
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+	logger := zap.NewNop()
+	appInstance := NewApp(svc, nil, logger)
+	r := createTestRouter(svc, logger, map[string]http.HandlerFunc{
+		"/api/shorten":       appInstance.HandleJSONShorten,
+		"/api/shorten/batch": appInstance.HandleBatchShorten,
+		"/api/user/urls":     appInstance.HandleUserURLs,
+	})
+	token, err := svc.GenerateJWT("user1")
+	assert.NoError(t, err)
+	post := func(target, body string, prefer string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if prefer != "" {
+			req.Header.Set("Prefer", prefer)
+		}
+		req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: token})
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Режим id: тело содержит только код, заголовок по-прежнему содержит полный URL
+	rr := post("/api/shorten?response=id", `{"url":"https://example.com"}`, "")
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var idResp map[string]string
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &idResp))
+	id := idResp["id"]
+	assert.NotEmpty(t, id)
+	assert.NotContains(t, idResp, "result")
+	assert.Equal(t, "http://localhost:8080/"+id, rr.Header().Get(DefaultShortURLHeader))
+
+	// Конфликт в режиме id возвращает код существующей ссылки
+	rr = post("/api/shorten", `{"url":"https://example.com"}`, "response=id")
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.JSONEq(t, `{"id":"`+id+`"}`, rr.Body.String())
+
+	// Режим по умолчанию не меняется
+	rr = post("/api/shorten", `{"url":"https://example.com"}`, "")
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.JSONEq(t, `{"result":"http://localhost:8080/`+id+`"}`, rr.Body.String())
+
+	// Пакет: short_id передаётся всегда, short_url — только в режиме по умолчанию
+	rr = post("/api/shorten/batch", `[{"correlation_id":"1","original_url":"https://example.org"}]`, "")
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var batch []models.BatchResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &batch))
+	assert.Len(t, batch, 1)
+	assert.NotEmpty(t, batch[0].ShortID)
+	assert.Equal(t, "http://localhost:8080/"+batch[0].ShortID, batch[0].ShortURL)
+
+	rr = post("/api/shorten/batch?response=id", `[{"correlation_id":"2","original_url":"https://example.net"}]`, "")
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var idBatch []map[string]string
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &idBatch))
+	assert.Len(t, idBatch, 1)
+	assert.Equal(t, "2", idBatch[0]["correlation_id"])
+	assert.NotEmpty(t, idBatch[0]["short_id"])
+	assert.NotContains(t, idBatch[0], "short_url")
+
+	// Список ссылок пользователя содержит short_id рядом с short_url
+	req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+	req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: token})
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var urls []models.ShortURLResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &urls))
+	assert.Len(t, urls, 3)
+	for _, u := range urls {
+		assert.NotEmpty(t, u.ShortID)
+		assert.Equal(t, "http://localhost:8080/"+u.ShortID, u.ShortURL)
+	}
+}
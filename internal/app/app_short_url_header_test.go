@@ -0,0 +1,63 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+func TestApp_ShortURLHeader(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []Option
+		wantHeader string
+	}{
+		{name: "Default", wantHeader: DefaultShortURLHeader},
+		{name: "Custom", opts: []Option{WithShortURLHeader("X-Custom-Link")}, wantHeader: "X-Custom-Link"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+			logger := zap.NewNop()
+			appInstance := NewApp(svc, nil, logger, tt.opts...)
+			r := createTestRouter(svc, logger, map[string]http.HandlerFunc{
+				"/":            appInstance.HandlePostURL,
+				"/api/shorten": appInstance.HandleJSONShorten,
+			})
+
+			// Plain text: заголовок совпадает с телом, в том числе при конфликте
+			for _, wantCode := range []int{http.StatusCreated, http.StatusConflict} {
+				rr := httptest.NewRecorder()
+				r.ServeHTTP(rr, createTestRequest(http.MethodPost, "/", "text/plain", strings.NewReader("https://example.com")))
+				assert.Equal(t, wantCode, rr.Code)
+				assert.NotEmpty(t, rr.Body.String())
+				assert.Equal(t, rr.Body.String(), rr.Header().Get(tt.wantHeader))
+			}
+
+			// JSON: заголовок совпадает с полем result
+			for _, wantCode := range []int{http.StatusCreated, http.StatusConflict} {
+				rr := httptest.NewRecorder()
+				r.ServeHTTP(rr, createTestRequest(http.MethodPost, "/api/shorten", "application/json", strings.NewReader(`{"url":"https://example.org"}`)))
+				assert.Equal(t, wantCode, rr.Code)
+				var resp ShortenResponse
+				assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+				assert.NotEmpty(t, resp.Result)
+				assert.Equal(t, resp.Result, rr.Header().Get(tt.wantHeader))
+			}
+
+			// При ошибке заголовок не выставляется
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, createTestRequest(http.MethodPost, "/", "text/plain", strings.NewReader("not a url")))
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			assert.Empty(t, rr.Header().Get(tt.wantHeader))
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+func TestApp_ShortURLTemplate_RoundTrip(t *testing.T) {
+	for _, template := range []string{"{base}/go/{id}", "{base}/{id}.html"} {
+		t.Run(template, func(t *testing.T) {
+			logger := zap.NewNop()
+			svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret",
+				service.WithShortURLTemplate(template))
+			appInstance := NewApp(svc, nil, logger)
+			r := chi.NewRouter()
+			r.Use(middleware.AuthMiddleware(svc, logger))
+			appInstance.RegisterRoutes(r)
+
+			req := createTestRequest(http.MethodPost, "/api/shorten", "application/json",
+				strings.NewReader(`{"url":"https://example.com/landing"}`))
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusCreated, rr.Code)
+			var resp ShortenResponse
+			assert.NoError(t, decodeJSON(rr.Body, &resp, false))
+			prefix, suffix := svc.URLBuilder().Path()
+			assert.True(t, strings.HasPrefix(resp.Result, "http://localhost:8080"+prefix), resp.Result)
+			assert.True(t, strings.HasSuffix(resp.Result, suffix), resp.Result)
+
+			// Короткий URL разрешается по пути из шаблона
+			rr = httptest.NewRecorder()
+			r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(resp.Result, "http://localhost:8080"), nil))
+			assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+			assert.Equal(t, "https://example.com/landing", rr.Header().Get("Location"))
+
+			// Ответ в режиме ID выделяет ID из URL по шаблону
+			id, err := svc.URLBuilder().Parse(resp.Result)
+			assert.NoError(t, err)
+			rr = httptest.NewRecorder()
+			r.ServeHTTP(rr, createTestRequest(http.MethodPost, "/api/shorten?response=id", "application/json",
+				strings.NewReader(`{"url":"https://example.com/landing"}`)))
+			assert.Equal(t, http.StatusConflict, rr.Code)
+			assert.Contains(t, rr.Body.String(), `"id":"`+id+`"`)
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+func TestApp_HandleJSONShorten_Modes(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	_, err := repo.Save("existing", "https://example.com", "user1")
+	assert.NoError(t, err)
+	svc := service.NewService(repo, "http://localhost:8080", "secret")
+	logger := zap.NewNop()
+	appInstance := NewApp(svc, nil, logger, WithDedupStatus(http.StatusOK))
+	r := createTestRouter(svc, logger, map[string]http.HandlerFunc{"POST /api/shorten": appInstance.HandleJSONShorten})
+	token, err := svc.GenerateJWT("user1")
+	assert.NoError(t, err)
+
+	shorten := func(target string, prefer string) (*httptest.ResponseRecorder, ShortenResponse) {
+		req := createTestRequest(http.MethodPost, target, "application/json", strings.NewReader(`{"url":"https://example.com"}`))
+		req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: token})
+		if prefer != "" {
+			req.Header.Set("Prefer", prefer)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		var resp ShortenResponse
+		if rr.Header().Get("Content-Type") == "application/json" {
+			assert.NoError(t, decodeJSON(rr.Body, &resp, false))
+		}
+		return rr, resp
+	}
+
+	// По умолчанию возвращается существующая ссылка со статусом дедупликации
+	rr, resp := shorten("/api/shorten", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "http://localhost:8080/existing", resp.Result)
+	assert.Empty(t, resp.Error)
+
+	// create_only всегда отвечает 409 с отдельным кодом и ничего не создаёт
+	for _, tc := range []struct{ target, prefer string }{
+		{target: "/api/shorten?mode=create_only"},
+		{target: "/api/shorten", prefer: "create-only"},
+		{target: "/api/shorten", prefer: "response=full, create-only"},
+	} {
+		rr, resp = shorten(tc.target, tc.prefer)
+		assert.Equal(t, http.StatusConflict, rr.Code, tc)
+		assert.Equal(t, "http://localhost:8080/existing", resp.Result, tc)
+		assert.Equal(t, ErrorCodeCreateOnly, resp.Error, tc)
+	}
+	count, err := repo.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	// force_new создаёт новую ссылку на тот же URL
+	rr, resp = shorten("/api/shorten?mode=force_new", "")
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.NotEqual(t, "http://localhost:8080/existing", resp.Result)
+	id := strings.TrimPrefix(resp.Result, "http://localhost:8080/")
+	u, found, err := repo.Get(id)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "https://example.com", u.OriginalURL)
+	assert.Equal(t, "user1", u.UserID)
+
+	rr, _ = shorten("/api/shorten?mode=always", "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Invalid mode")
+}
+
+func TestApp_HandleJSONShorten_ModesLocation(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	_, err := repo.Save("existing", "https://example.com", "user1")
+	assert.NoError(t, err)
+	svc := service.NewService(repo, "http://localhost:8080", "secret")
+	logger := zap.NewNop()
+	appInstance := NewApp(svc, nil, logger, WithShortenResponse(ShortenResponseLocation))
+	r := createTestRouter(svc, logger, map[string]http.HandlerFunc{"POST /api/shorten": appInstance.HandleJSONShorten})
+
+	// Без тела ответа код ошибки передаётся в заголовке
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, createTestRequest(http.MethodPost, "/api/shorten?mode=create_only", "application/json",
+		strings.NewReader(`{"url":"https://example.com"}`)))
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Equal(t, "http://localhost:8080/existing", rr.Header().Get("Location"))
+	assert.Equal(t, ErrorCodeCreateOnly, rr.Header().Get(ErrorCodeHeader))
+
+	// Анонимный пользователь получает токен владения и для принудительно созданной ссылки
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, createTestRequest(http.MethodPost, "/api/shorten?mode=force_new", "application/json",
+		strings.NewReader(`{"url":"https://example.com"}`)))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.NotEqual(t, "http://localhost:8080/existing", rr.Header().Get("Location"))
+	assert.NotEmpty(t, rr.Header().Get(ClaimTokenHeader))
+	assert.Empty(t, rr.Header().Get(ErrorCodeHeader))
+}
+
+func TestApp_HandleJSONShorten_ForceNewUnsupported(t *testing.T) {
+	_, repo, svc, appInstance, logger, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	_, err := repo.Save("existing", "https://example.com", "user1")
+	assert.NoError(t, err)
+	r := createTestRouter(svc, logger, map[string]http.HandlerFunc{"POST /api/shorten": appInstance.HandleJSONShorten})
+
+	// Файловое хранилище держит один ID на URL, поэтому force_new отклоняется
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, createTestRequest(http.MethodPost, "/api/shorten?mode=force_new", "application/json",
+		strings.NewReader(`{"url":"https://example.com"}`)))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), service.ErrDuplicatesUnsupported.Error())
+}
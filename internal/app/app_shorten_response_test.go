@@ -0,0 +1,82 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+)
+
+func TestApp_ShortenResponseLocation(t *testing.T) {
+	_, repo, svc, _, logger, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	_, err := repo.Save("existing", "https://example.com", "user1")
+	assert.NoError(t, err)
+	appInstance := NewApp(svc, nil, logger, WithShortenResponse(ShortenResponseLocation))
+	r := createTestRouter(svc, logger, map[string]http.HandlerFunc{"POST /api/shorten": appInstance.HandleJSONShorten})
+	token, err := svc.GenerateJWT("user1")
+	assert.NoError(t, err)
+
+	shorten := func(body string, authenticated bool) *httptest.ResponseRecorder {
+		req := createTestRequest(http.MethodPost, "/api/shorten", "application/json", strings.NewReader(body))
+		if authenticated {
+			req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: token})
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := shorten(`{"url":"https://new.example.com"}`, true)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	location := rr.Header().Get("Location")
+	assert.True(t, strings.HasPrefix(location, "http://localhost:8080/"))
+	assert.Equal(t, location, rr.Header().Get(DefaultShortURLHeader))
+	assert.Empty(t, rr.Body.String())
+	assert.Empty(t, rr.Header().Get(ClaimTokenHeader))
+	u, found, err := svc.Get(strings.TrimPrefix(location, "http://localhost:8080/"))
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "https://new.example.com", u.OriginalURL)
+
+	// Уже сокращённый URL: статус дедупликации и Location существующей ссылки
+	rr = shorten(`{"url":"https://example.com"}`, true)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Equal(t, "http://localhost:8080/existing", rr.Header().Get("Location"))
+	assert.Empty(t, rr.Body.String())
+
+	// Анонимный пользователь получает токен владения в заголовке, раз тела нет
+	rr = shorten(`{"url":"https://anon.example.com"}`, false)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.NotEmpty(t, rr.Header().Get("Location"))
+	assert.NotEmpty(t, rr.Header().Get(ClaimTokenHeader))
+	assert.Empty(t, rr.Body.String())
+}
+
+func TestApp_ShortenResponseBodyDefault(t *testing.T) {
+	_, _, svc, appInstance, logger, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	r := createTestRouter(svc, logger, map[string]http.HandlerFunc{"POST /api/shorten": appInstance.HandleJSONShorten})
+	token, err := svc.GenerateJWT("user1")
+	assert.NoError(t, err)
+
+	req := createTestRequest(http.MethodPost, "/api/shorten", "application/json", strings.NewReader(`{"url":"https://example.com"}`))
+	req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: token})
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Empty(t, rr.Header().Get("Location"))
+	var resp ShortenResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.True(t, strings.HasPrefix(resp.Result, "http://localhost:8080/"))
+}
+
+func TestValidateShortenResponse(t *testing.T) {
+	assert.NoError(t, ValidateShortenResponse(ShortenResponseBody))
+	assert.NoError(t, ValidateShortenResponse(ShortenResponseLocation))
+	assert.Error(t, ValidateShortenResponse("header"))
+}
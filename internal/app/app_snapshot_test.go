@@ -0,0 +1,61 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/models"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+// unavailableDB имитирует базу данных, недоступную сразу после рестарта
+type unavailableDB struct {
+	repository.Repository
+}
+
+func (unavailableDB) Get(id string) (models.URL, bool, error) {
+	return models.URL{}, false, fmt.Errorf("%w: connection refused", repository.ErrUnavailable)
+}
+
+func (unavailableDB) BatchGet(ids []string) (map[string]models.URL, error) {
+	return nil, errors.New("database is unavailable")
+}
+
+func TestApp_RedirectFromSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	logger := zap.NewNop()
+
+	// Работающий экземпляр записывает снимок
+	source := repository.NewMemoryRepository()
+	_, err := source.Save("abc123", "https://example.com/page", "user1")
+	assert.NoError(t, err)
+	assert.NoError(t, repository.NewSnapshotRepository(source, path, time.Hour, 0, logger).WriteSnapshot(context.Background()))
+
+	// Новый экземпляр поднимается с кешем из снимка при недоступной базе
+	repo := repository.NewSnapshotRepository(unavailableDB{}, path, time.Hour, 0, logger)
+	svc := service.NewService(repo, "http://localhost:8080", "secret")
+	appInstance := NewApp(svc, nil, logger)
+	r := chi.NewRouter()
+	r.Get("/{id}", appInstance.HandleGetURL)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/abc123", nil))
+	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	assert.Equal(t, "https://example.com/page", rr.Header().Get("Location"))
+
+	// Промах уходит в базу, и её недоступность не выдаётся за отсутствие URL
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.NotEmpty(t, rr.Header().Get("Retry-After"))
+}
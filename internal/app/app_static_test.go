@@ -0,0 +1,89 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/models"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+// countingRepository считает обращения к хранилищу за URL
+type countingRepository struct {
+	repository.Repository
+	lookups atomic.Int32
+}
+
+func (c *countingRepository) Get(id string) (models.URL, bool, error) {
+	c.lookups.Add(1)
+	return c.Repository.Get(id)
+}
+
+func (c *countingRepository) BatchGet(ids []string) (map[string]models.URL, error) {
+	c.lookups.Add(1)
+	return c.Repository.BatchGet(ids)
+}
+
+func TestApp_StaticFiles(t *testing.T) {
+	repo := &countingRepository{Repository: repository.NewMemoryRepository()}
+	svc := service.NewService(repo, "http://localhost:8080", "secret")
+	logger := zap.NewNop()
+
+	tests := []struct {
+		name        string
+		policy      string
+		path        string
+		wantCode    int
+		wantBody    string
+		contentType string
+	}{
+		{
+			name:     "Favicon",
+			path:     "/favicon.ico",
+			wantCode: http.StatusNoContent,
+		},
+		{
+			name:        "Robots default policy",
+			path:        "/robots.txt",
+			wantCode:    http.StatusOK,
+			wantBody:    "User-agent: *\nDisallow: /\n",
+			contentType: "text/plain; charset=utf-8",
+		},
+		{
+			name:        "Robots UI policy",
+			policy:      RobotsPolicyUI,
+			path:        "/robots.txt",
+			wantCode:    http.StatusOK,
+			wantBody:    "User-agent: *\nAllow: /$\nDisallow: /\n",
+			contentType: "text/plain; charset=utf-8",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appInstance := NewApp(svc, nil, logger, WithRobotsPolicy(tt.policy))
+			r := chi.NewRouter()
+			r.Use(middleware.AuthMiddleware(svc, logger, middleware.WithAnonymousPaths("/favicon.ico", "/robots.txt")))
+			appInstance.RegisterRoutes(r)
+
+			before := repo.lookups.Load()
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			assert.Equal(t, tt.wantCode, rr.Code)
+			assert.Equal(t, tt.wantBody, rr.Body.String())
+			if tt.contentType != "" {
+				assert.Equal(t, tt.contentType, rr.Header().Get("Content-Type"))
+			}
+			assert.Equal(t, before, repo.lookups.Load(), "No repository lookup expected for %s", tt.path)
+			assert.Empty(t, rr.Result().Cookies(), "No auth cookie expected for %s", tt.path)
+		})
+	}
+}
@@ -1,13 +1,22 @@
 package app
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 
+	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/models"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
 )
 
 func TestApp_HandleStats(t *testing.T) {
@@ -148,3 +157,92 @@ func TestApp_HandleStats_WithMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestApp_HandleStats_Backend(t *testing.T) {
+	logger := zap.NewNop()
+
+	tests := []struct {
+		name            string
+		setup           func(t *testing.T) repository.Repository
+		expectedBackend string
+		expectIndexes   bool
+	}{
+		{
+			name: "Memory repository",
+			setup: func(t *testing.T) repository.Repository {
+				return repository.NewMemoryRepository()
+			},
+			expectedBackend: "memory",
+			expectIndexes:   true,
+		},
+		{
+			name: "File repository",
+			setup: func(t *testing.T) repository.Repository {
+				repo, err := repository.NewFileRepository(filepath.Join(t.TempDir(), "storage.json"), logger)
+				assert.NoError(t, err)
+				return repo
+			},
+			expectedBackend: "file",
+			expectIndexes:   true,
+		},
+		{
+			name: "Postgres repository",
+			setup: func(t *testing.T) repository.Repository {
+				db, mock, err := sqlmock.New()
+				assert.NoError(t, err)
+				t.Cleanup(func() {
+					_ = db.Close()
+				})
+				mock.ExpectExec("ALTER TABLE urls ADD COLUMN IF NOT EXISTS user_id").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("ALTER TABLE urls ADD COLUMN IF NOT EXISTS is_deleted").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("ALTER TABLE urls ADD COLUMN IF NOT EXISTS tags").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("ALTER TABLE urls ADD COLUMN IF NOT EXISTS claim_token_hash").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("ALTER TABLE urls ADD COLUMN IF NOT EXISTS nsfw").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("ALTER TABLE urls ADD COLUMN IF NOT EXISTS description").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("CREATE TABLE IF NOT EXISTS url_reservations").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("CREATE TABLE IF NOT EXISTS users").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("CREATE TABLE IF NOT EXISTS url_referrers").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec("CREATE TABLE IF NOT EXISTS url_clicks").WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM urls").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+				mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM \\(SELECT user_id FROM urls .* UNION SELECT user_id FROM users\\)").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+				repo, err := repository.NewPostgresRepository(db, logger)
+				assert.NoError(t, err)
+				return repo
+			},
+			expectedBackend: "postgres",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := tt.setup(t)
+			svc := service.NewService(repo, "http://localhost:8080", "test-secret")
+			appInstance := NewApp(svc, nil, logger)
+
+			r := chi.NewRouter()
+			r.Route("/api/internal", func(r chi.Router) {
+				r.Use(middleware.TrustedSubnetMiddleware("192.168.1.0/24", logger))
+				r.Get("/stats", appInstance.HandleStats)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/internal/stats", nil)
+			req.Header.Set("X-Real-IP", "192.168.1.100")
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusOK, rr.Code)
+			var resp models.StatsResponse
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expectedBackend, resp.Backend)
+			assert.Equal(t, runtime.Version(), resp.GoVersion)
+			assert.Equal(t, os.Getpid(), resp.PID)
+			assert.GreaterOrEqual(t, resp.UptimeSeconds, int64(0))
+			// Размеры индексов сообщают только хранилища, держащие индексы в памяти
+			if tt.expectIndexes {
+				assert.Contains(t, rr.Body.String(), `{"name":"user_index","entries":0,"bytes":0}`)
+			} else {
+				assert.Empty(t, resp.Indexes)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/repository"
+)
+
+func TestApp_StorageErrors(t *testing.T) {
+	repo := repository.Instrument(repository.WithFaults(repository.NewMemoryRepository(), repository.FaultConfig{
+		Methods: map[string]repository.FaultRule{"SaveURL": {ErrorRate: 1}},
+	}))
+	r := newFaultsRouter(repo, WithStorageErrors(repo))
+
+	call := func(method, ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/internal/errors", nil)
+		req.Header.Set("X-Real-IP", ip)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	list := func() []StorageError {
+		rr := call(http.MethodGet, "10.0.0.5")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var items []StorageError
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &items))
+		return items
+	}
+
+	assert.Empty(t, list())
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, createTestRequest(http.MethodPost, "/api/shorten", "application/json", strings.NewReader(`{"url":"https://example.com"}`)))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	items := list()
+	if assert.Len(t, items, 1) {
+		assert.Equal(t, "SaveURL", items[0].Method)
+		assert.Equal(t, repository.ErrInjectedFault.Error(), items[0].Error)
+		assert.NotEmpty(t, items[0].Duration)
+		assert.False(t, items[0].Time.IsZero())
+	}
+
+	// Вне доверенной подсети журнал недоступен и не очищается
+	assert.Equal(t, http.StatusForbidden, call(http.MethodGet, "192.168.1.1").Code)
+	assert.Equal(t, http.StatusForbidden, call(http.MethodDelete, "192.168.1.1").Code)
+	assert.Len(t, list(), 1)
+
+	assert.Equal(t, http.StatusNoContent, call(http.MethodDelete, "10.0.0.5").Code)
+	assert.Empty(t, list())
+}
+
+func TestApp_StorageErrors_DisabledWithoutOption(t *testing.T) {
+	r := newFaultsRouter(repository.NewMemoryRepository())
+	req := httptest.NewRequest(http.MethodGet, "/api/internal/errors", nil)
+	req.Header.Set("X-Real-IP", "10.0.0.5")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
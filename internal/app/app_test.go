@@ -10,8 +10,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
@@ -45,17 +47,13 @@ func compressData(data []byte) ([]byte, error) {
 
 // setupTestEnvironment создаёт тестовое окружение с временным файлом и зависимостями
 func setupTestEnvironment(t *testing.T) (*config.Config, repository.Repository, *service.Service, *App, *zap.Logger, func()) {
-	tempFile, err := os.CreateTemp("", "test_storage_*.json")
-	assert.NoError(t, err, "Failed to create temp file")
-
-	cleanup := func() {
-		_ = os.Remove(tempFile.Name())
-	}
+	// Каждый тест получает собственную директорию, поэтому тесты с общим окружением могут идти параллельно
+	cleanup := func() {}
 
 	cfg := &config.Config{
 		RunAddr:         ":8080",
 		BaseURL:         "http://localhost:8080",
-		FileStoragePath: tempFile.Name(),
+		FileStoragePath: filepath.Join(t.TempDir(), "storage.json"),
 		JWTSecret:       "test-secret",
 	}
 
@@ -132,7 +130,7 @@ func assertURLStored(t *testing.T, repo repository.Repository, responseBody, bas
 			id = responseBody[strings.LastIndex(responseBody, "/")+1:]
 		}
 
-		_, exists := repo.Get(id)
+		_, exists, _ := repo.Get(id)
 		assert.True(t, exists, "Expected URL to be stored")
 		if expectedCode != http.StatusConflict {
 			assert.Contains(t, responseBody, baseURL, "Expected short URL to contain BaseURL")
@@ -149,7 +147,7 @@ func assertBatchResponse(t *testing.T, rr *httptest.ResponseRecorder, repo repos
 
 	for _, r := range resp {
 		id := r.ShortURL[strings.LastIndex(r.ShortURL, "/")+1:]
-		_, exists := repo.Get(id)
+		_, exists, _ := repo.Get(id)
 		assert.True(t, exists, "URL should be stored")
 		assert.Contains(t, r.ShortURL, baseURL, "Short URL should contain BaseURL")
 	}
@@ -157,6 +155,7 @@ func assertBatchResponse(t *testing.T, rr *httptest.ResponseRecorder, repo repos
 
 // TestHandlePostURL тестирует обработку POST запросов для создания коротких URL
 func TestHandlePostURL(t *testing.T) {
+	t.Parallel()
 	cfg, repo, svc, appInstance, logger, cleanup := setupTestEnvironment(t)
 	defer cleanup()
 
@@ -269,6 +268,7 @@ func TestHandlePostURL(t *testing.T) {
 
 // TestHandleJSONShorten тестирует обработку JSON запросов для создания коротких URL
 func TestHandleJSONShorten(t *testing.T) {
+	t.Parallel()
 	cfg, repo, svc, appInstance, logger, cleanup := setupTestEnvironment(t)
 	defer cleanup()
 
@@ -316,7 +316,7 @@ func TestHandleJSONShorten(t *testing.T) {
 			body:           strings.NewReader(`{invalid json}`),
 			storeSetup:     func() {},
 			expectedCode:   http.StatusBadRequest,
-			expectedBody:   "Invalid JSON\n",
+			expectedBody:   `"error":"Invalid JSON"`,
 			expectedStored: false,
 		},
 		{
@@ -327,7 +327,7 @@ func TestHandleJSONShorten(t *testing.T) {
 			body:           strings.NewReader(`{"url":""}`),
 			storeSetup:     func() {},
 			expectedCode:   http.StatusBadRequest,
-			expectedBody:   "empty URL\n",
+			expectedBody:   `{"error":"Validation failed","fields":[{"field":"url","error":"required"}]}`,
 			expectedStored: false,
 		},
 	}
@@ -362,6 +362,7 @@ func TestHandleJSONShorten(t *testing.T) {
 
 // TestHandleGzipRequests тестирует обработку запросов с Gzip сжатием
 func TestHandleGzipRequests(t *testing.T) {
+	t.Parallel()
 	cfg, repo, svc, appInstance, logger, cleanup := setupTestEnvironment(t)
 	defer cleanup()
 
@@ -455,6 +456,7 @@ func TestHandleGzipRequests(t *testing.T) {
 
 // TestHandleGzipResponses тестирует обработку ответов с Gzip сжатием
 func TestHandleGzipResponses(t *testing.T) {
+	t.Parallel()
 	cfg, repo, svc, appInstance, logger, cleanup := setupTestEnvironment(t)
 	defer cleanup()
 
@@ -556,7 +558,7 @@ func TestHandleGzipResponses(t *testing.T) {
 						return
 					}
 
-					shortURL, err := appInstance.createShortURL(reqBody.URL, userID)
+					_, shortURL, err := appInstance.createShortURL(reqBody.URL, userID)
 					if err != nil {
 						if errors.Is(err, repository.ErrURLExists) {
 							respBody := ShortenResponse{
@@ -647,7 +649,7 @@ func TestHandleGzipResponses(t *testing.T) {
 					err := json.Unmarshal([]byte(responseString), &resp)
 					assert.NoError(t, err, "Failed to unmarshal JSON response")
 					id := resp.Result[strings.LastIndex(resp.Result, "/")+1:]
-					_, exists := repo.Get(id)
+					_, exists, _ := repo.Get(id)
 					assert.True(t, exists, "Expected URL to be stored")
 					if tt.expectedCode != http.StatusConflict {
 						assert.Contains(t, responseString, cfg.BaseURL, "Expected short URL to contain BaseURL")
@@ -655,7 +657,7 @@ func TestHandleGzipResponses(t *testing.T) {
 				} else {
 					// Для text/plain ответа извлекаем ID напрямую
 					id := responseString[strings.LastIndex(responseString, "/")+1:]
-					_, exists := repo.Get(id)
+					_, exists, _ := repo.Get(id)
 					assert.True(t, exists, "Expected URL to be stored")
 					assert.Contains(t, responseString, cfg.BaseURL, "Expected short URL to contain BaseURL")
 				}
@@ -666,6 +668,7 @@ func TestHandleGzipResponses(t *testing.T) {
 
 // TestHandleGetURL тестирует обработку GET запросов для получения оригинальных URL
 func TestHandleGetURL(t *testing.T) {
+	t.Parallel()
 	_, repo, _, appInstance, _, cleanup := setupTestEnvironment(t)
 	defer cleanup()
 
@@ -764,6 +767,7 @@ func TestHandleGetURL(t *testing.T) {
 
 // TestHandleJSONExpand тестирует обработку JSON запросов для получения оригинальных URL
 func TestHandleJSONExpand(t *testing.T) {
+	t.Parallel()
 	_, repo, _, appInstance, _, cleanup := setupTestEnvironment(t)
 	defer cleanup()
 
@@ -791,9 +795,21 @@ func TestHandleJSONExpand(t *testing.T) {
 			method:       http.MethodGet,
 			path:         "/api/expand/unknownID",
 			storeSetup:   func() {},
-			expectedCode: http.StatusBadRequest,
+			expectedCode: http.StatusNotFound,
 			expectedBody: `{"error":"URL not found"}`,
 		},
+		{
+			name:   "Deleted",
+			method: http.MethodGet,
+			path:   "/api/expand/deletedID",
+			storeSetup: func() {
+				_, err := repo.Save("deletedID", "https://deleted.com", "testUser")
+				assert.NoError(t, err, "Failed to save URL in storeSetup")
+				assert.NoError(t, repo.BatchDelete("testUser", []string{"deletedID"}))
+			},
+			expectedCode: http.StatusGone,
+			expectedBody: `{"error":"URL is deleted"}`,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -832,6 +848,41 @@ func TestHandleJSONExpand(t *testing.T) {
 	}
 }
 
+func TestHandleJSONExpand_Owned(t *testing.T) {
+	t.Parallel()
+	_, repo, svc, appInstance, logger, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	_, err := repo.Save("ownedID", "https://example.com", "owner")
+	assert.NoError(t, err)
+	r := createTestRouter(svc, logger, map[string]http.HandlerFunc{
+		"/api/expand/{id}": appInstance.HandleJSONExpand,
+	})
+
+	tests := []struct {
+		name         string
+		userID       string
+		expectedBody string
+	}{
+		{name: "Owner", userID: "owner", expectedBody: `{"url":"https://example.com","owned":true}`},
+		{name: "NotOwner", userID: "stranger", expectedBody: `{"url":"https://example.com","owned":false}`},
+		{name: "Anonymous", expectedBody: `{"url":"https://example.com"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/expand/ownedID", nil)
+			if tt.userID != "" {
+				token, err := svc.GenerateJWT(tt.userID)
+				assert.NoError(t, err)
+				req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: token})
+			}
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Equal(t, tt.expectedBody, rr.Body.String())
+		})
+	}
+}
+
 // mockDatabase - простой мок для Database интерфейса
 type mockDatabase struct {
 	pingErr error
@@ -937,6 +988,7 @@ func TestHandlePing(t *testing.T) {
 
 // TestHandleBatchShortenSuccess тестирует успешную обработку пакетных запросов
 func TestHandleBatchShortenSuccess(t *testing.T) {
+	t.Parallel()
 	cfg, repo, svc, appInstance, logger, cleanup := setupTestEnvironment(t)
 	defer cleanup()
 
@@ -964,6 +1016,7 @@ func TestHandleBatchShortenSuccess(t *testing.T) {
 
 // TestHandleBatchShortenValidation тестирует валидацию пакетных запросов
 func TestHandleBatchShortenValidation(t *testing.T) {
+	t.Parallel()
 	_, repo, svc, appInstance, logger, cleanup := setupTestEnvironment(t)
 	defer cleanup()
 
@@ -997,7 +1050,7 @@ func TestHandleBatchShortenValidation(t *testing.T) {
 			body:         strings.NewReader(`{invalid json}`),
 			contentType:  "application/json",
 			expectedCode: http.StatusBadRequest,
-			expectedBody: "Invalid JSON\n",
+			expectedBody: `{"error":"Invalid JSON","fields":[{"field":"","error":"syntax error at offset 2: invalid character 'i' looking for beginning of object key string"}]}`,
 		},
 		{
 			name:         "EmptyBatch",
@@ -1005,7 +1058,7 @@ func TestHandleBatchShortenValidation(t *testing.T) {
 			body:         strings.NewReader(`[]`),
 			contentType:  "application/json",
 			expectedCode: http.StatusBadRequest,
-			expectedBody: "Empty batch\n",
+			expectedBody: `{"error":"Empty batch"}`,
 		},
 		{
 			name:         "MissingCorrelationID",
@@ -1013,7 +1066,7 @@ func TestHandleBatchShortenValidation(t *testing.T) {
 			body:         strings.NewReader(`[{"correlation_id":"","original_url":"https://example.com"}]`),
 			contentType:  "application/json",
 			expectedCode: http.StatusBadRequest,
-			expectedBody: "Missing correlation_id\n",
+			expectedBody: `{"error":"Validation failed","fields":[{"field":"[0].correlation_id","error":"required"}]}`,
 		},
 		{
 			name:         "InvalidURL",
@@ -1021,7 +1074,7 @@ func TestHandleBatchShortenValidation(t *testing.T) {
 			body:         strings.NewReader(`[{"correlation_id":"1","original_url":"invalid-url"}]`),
 			contentType:  "application/json",
 			expectedCode: http.StatusBadRequest,
-			expectedBody: "Invalid URL\n",
+			expectedBody: `{"error":"Validation failed","fields":[{"field":"[0].original_url","error":"invalid URL"}]}`,
 		},
 	}
 
@@ -1055,6 +1108,7 @@ func TestHandleBatchShortenValidation(t *testing.T) {
 
 // TestHandleBatchShortenGzip тестирует обработку пакетных запросов с Gzip сжатием
 func TestHandleBatchShortenGzip(t *testing.T) {
+	t.Parallel()
 	cfg, repo, svc, appInstance, logger, cleanup := setupTestEnvironment(t)
 	defer cleanup()
 
@@ -1092,7 +1146,7 @@ func TestHandleBatchShortenGzip(t *testing.T) {
 
 	for _, r := range resp {
 		id := r.ShortURL[strings.LastIndex(r.ShortURL, "/")+1:]
-		_, exists := repo.Get(id)
+		_, exists, _ := repo.Get(id)
 		assert.True(t, exists, "URL should be stored")
 		assert.Contains(t, r.ShortURL, cfg.BaseURL, "Short URL should contain BaseURL")
 	}
@@ -1140,6 +1194,101 @@ func TestHandleBatchDeleteURLsSuccess(t *testing.T) {
 	assert.Equal(t, http.StatusAccepted, rr.Code, "Status code mismatch")
 }
 
+// TestHandleBatchDeleteURLsGzip тестирует удаление URL по сжатому JSON-массиву ID через маршрутизатор как в main
+func TestHandleBatchDeleteURLsGzip(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	svc := service.NewService(repo, "http://localhost:8080", "secret")
+	logger := zap.NewNop()
+	r := chi.NewRouter()
+	r.Use(middleware.GzipMiddleware)
+	r.Use(middleware.AuthMiddleware(svc, logger))
+	NewApp(svc, nil, logger).RegisterRoutes(r)
+
+	for _, id := range []string{"id1", "id2", "id3"} {
+		_, err := repo.Save(id, "https://example.com/"+id, "user1")
+		assert.NoError(t, err)
+	}
+	token, err := svc.GenerateJWT("user1")
+	assert.NoError(t, err)
+
+	deleteGzipped := func(contentType, body string) *httptest.ResponseRecorder {
+		compressed, err := compressData([]byte(body))
+		assert.NoError(t, err)
+		req := httptest.NewRequest(http.MethodDelete, "/api/user/urls", bytes.NewReader(compressed))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Content-Encoding", "gzip")
+		req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: token})
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := deleteGzipped("application/json", `["id1","id2"]`)
+	assert.Equal(t, http.StatusAccepted, rr.Code, rr.Body.String())
+	assert.Eventually(t, func() bool {
+		u1, _, _ := repo.Get("id1")
+		u2, _, _ := repo.Get("id2")
+		return u1.DeletedFlag && u2.DeletedFlag
+	}, time.Second, 5*time.Millisecond, "Gzipped IDs should be deleted")
+	u, _, _ := repo.Get("id3")
+	assert.False(t, u.DeletedFlag)
+
+	// Content-Type проверяется и для сжатого тела
+	rr = deleteGzipped("text/plain", `["id3"]`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+// deleteRecorder передаёт в канал каждый пакет ID, удалённый в хранилище
+type deleteRecorder struct {
+	repository.Repository
+	batches chan []string
+}
+
+func (d *deleteRecorder) BatchDelete(userID string, ids []string) error {
+	err := d.Repository.BatchDelete(userID, ids)
+	d.batches <- ids
+	return err
+}
+
+// TestHandleBatchDeleteURLsMaxBatch тестирует ограничение числа ID в запросе удаления на границе лимита
+func TestHandleBatchDeleteURLsMaxBatch(t *testing.T) {
+	repo := &deleteRecorder{Repository: repository.NewMemoryRepository(), batches: make(chan []string, 2)}
+	svc := service.NewService(repo, "http://localhost:8080", "secret")
+	logger := zap.NewNop()
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware(svc, logger))
+	NewApp(svc, nil, logger, WithMaxDeleteBatch(3)).RegisterRoutes(r)
+
+	for _, id := range []string{"id1", "id2", "id3", "id4"} {
+		_, err := repo.Save(id, "https://example.com/"+id, "user1")
+		assert.NoError(t, err)
+	}
+	token, err := svc.GenerateJWT("user1")
+	assert.NoError(t, err)
+
+	deleteIDs := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodDelete, "/api/user/urls", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: token})
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// На один ID больше лимита: запрос отклоняется целиком, ничего не удаляется
+	rr := deleteIDs(`["id1","id2","id3","id4"]`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "too many IDs: 4, at most 3 allowed")
+
+	// Ровно лимит принимается; в хранилище попадает только этот пакет
+	rr = deleteIDs(`["id1","id2","id3"]`)
+	assert.Equal(t, http.StatusAccepted, rr.Code, rr.Body.String())
+	assert.Equal(t, []string{"id1", "id2", "id3"}, <-repo.batches)
+	assert.Empty(t, repo.batches, "Rejected batch must not be dispatched")
+	u, _, _ := repo.Get("id4")
+	assert.False(t, u.DeletedFlag)
+}
+
 // TestHandleBatchDeleteURLsValidation тестирует валидацию пакетных запросов для удаления URL
 func TestHandleBatchDeleteURLsValidation(t *testing.T) {
 	tempFile, err := os.CreateTemp("", "test_storage_*.json")
@@ -1214,3 +1363,276 @@ func TestHandleBatchDeleteURLsValidation(t *testing.T) {
 		})
 	}
 }
+
+// TestHandleUserURLsTagFilter тестирует создание ссылок с метками и фильтрацию списка по метке
+func TestHandleUserURLsTagFilter(t *testing.T) {
+	t.Parallel()
+	_, _, svc, appInstance, logger, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware(svc, logger))
+	r.Post("/api/shorten", appInstance.HandleJSONShorten)
+	r.Get("/api/user/urls", appInstance.HandleUserURLs)
+
+	userID, err := svc.GenerateUserID()
+	assert.NoError(t, err)
+	token, err := svc.GenerateJWT(userID)
+	assert.NoError(t, err)
+	cookie := &http.Cookie{Name: "jwt", Value: token}
+
+	for _, body := range []string{
+		`{"url":"https://example.com/tagged","tags":["work"]}`,
+		`{"url":"https://example.com/other","tags":["personal"]}`,
+		`{"url":"https://example.com/plain"}`,
+	} {
+		req := createTestRequest(http.MethodPost, "/api/shorten", "application/json", strings.NewReader(body))
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		assertResponseCode(t, rr, http.StatusCreated)
+	}
+
+	tests := []struct {
+		name          string
+		url           string
+		expectedCode  int
+		expectedCount int
+	}{
+		{name: "no filter", url: "/api/user/urls", expectedCode: http.StatusOK, expectedCount: 3},
+		{name: "filter by tag", url: "/api/user/urls?tag=work", expectedCode: http.StatusOK, expectedCount: 1},
+		{name: "unknown tag", url: "/api/user/urls?tag=unknown", expectedCode: http.StatusNoContent, expectedCount: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.url, nil)
+			req.AddCookie(cookie)
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			assertResponseCode(t, rr, tt.expectedCode)
+			if tt.expectedCount == 0 {
+				return
+			}
+			var resp []models.ShortURLResponse
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+			assert.Len(t, resp, tt.expectedCount)
+			if tt.name == "filter by tag" {
+				assert.Equal(t, "https://example.com/tagged", resp[0].OriginalURL)
+			}
+		})
+	}
+}
+
+// TestHandleGetURLRefSuffix тестирует редирект с меткой кампании из адреса вида /{id}+{suffix}
+func TestHandleGetURLRefSuffix(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	svc := service.NewService(repo, "http://localhost:8080", "test-secret")
+
+	_, err := repo.Save("plainID", "https://example.com/page", "testUser")
+	assert.NoError(t, err)
+	_, err = repo.Save("queryID", "https://example.com/search?q=go#top", "testUser")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		refQueryKey  string
+		path         string
+		expectedCode int
+		expectedLoc  string
+	}{
+		{
+			name:         "Plain ID without suffix",
+			path:         "/plainID",
+			expectedCode: http.StatusTemporaryRedirect,
+			expectedLoc:  "https://example.com/page",
+		},
+		{
+			name:         "Suffix propagated as ref",
+			path:         "/plainID+newsletter",
+			expectedCode: http.StatusTemporaryRedirect,
+			expectedLoc:  "https://example.com/page?ref=newsletter",
+		},
+		{
+			name:         "Suffix appended to existing query",
+			path:         "/queryID+mail2024",
+			expectedCode: http.StatusTemporaryRedirect,
+			expectedLoc:  "https://example.com/search?q=go&ref=mail2024#top",
+		},
+		{
+			name:         "Configured query key",
+			refQueryKey:  "utm_campaign",
+			path:         "/plainID+spring",
+			expectedCode: http.StatusTemporaryRedirect,
+			expectedLoc:  "https://example.com/page?utm_campaign=spring",
+		},
+		{
+			name:         "Empty suffix",
+			path:         "/plainID+",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Non-alphanumeric suffix",
+			path:         "/plainID+news-letter",
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Too long suffix",
+			path:         "/plainID+" + strings.Repeat("a", 33),
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Unknown ID with suffix",
+			path:         "/unknownID+newsletter",
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appInstance := NewApp(svc, nil, zap.NewNop(), WithRefQueryKey(tt.refQueryKey))
+			r := chi.NewRouter()
+			r.Get("/{id}", appInstance.HandleGetURL)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			assert.Equal(t, tt.expectedCode, rr.Code, "Status code mismatch")
+			assert.Equal(t, tt.expectedLoc, rr.Header().Get("Location"), "Location mismatch")
+		})
+	}
+}
+
+// TestHandleGetURLRefSuffixRecorded тестирует, что метка кампании записывается в учёт переходов отдельно
+func TestHandleGetURLRefSuffixRecorded(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	clicks := repository.NewClickBuffer(repo, zap.NewNop())
+	svc := service.NewService(repo, "http://localhost:8080", "test-secret", service.WithClickRecorder(clicks))
+	_, err := repo.Save("plainID", "https://example.com/page", "testUser")
+	assert.NoError(t, err)
+
+	appInstance := NewApp(svc, nil, zap.NewNop())
+	r := chi.NewRouter()
+	r.Get("/{id}", appInstance.HandleGetURL)
+	for _, path := range []string{"/plainID", "/plainID+newsletter", "/plainID+newsletter", "/plainID+spring"} {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusTemporaryRedirect, rr.Code, path)
+	}
+	clicks.Flush()
+
+	counts, err := repo.ClickCounts([]string{"plainID"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"": 1, "newsletter": 2, "spring": 1}, counts["plainID"])
+}
+
+// TestHandlePostURLCharset тестирует обработку параметра charset и проверку UTF-8 при сокращении URL
+func TestHandlePostURLCharset(t *testing.T) {
+	tests := []struct {
+		name         string
+		path         string
+		contentType  string
+		body         []byte
+		expectedCode int
+		expectedBody string
+		expectedURL  string
+	}{
+		{
+			name:         "UTF-8 by default",
+			path:         "/",
+			contentType:  "text/plain",
+			body:         []byte("https://example.com/café"),
+			expectedCode: http.StatusCreated,
+			expectedURL:  "https://example.com/café",
+		},
+		{
+			name:         "Explicit us-ascii",
+			path:         "/",
+			contentType:  "text/plain; charset=US-ASCII",
+			body:         []byte("https://example.com/ascii"),
+			expectedCode: http.StatusCreated,
+			expectedURL:  "https://example.com/ascii",
+		},
+		{
+			name:         "ISO-8859-1 is transcoded",
+			path:         "/",
+			contentType:  "text/plain; charset=iso-8859-1",
+			body:         []byte("https://example.com/caf\xe9"),
+			expectedCode: http.StatusCreated,
+			expectedURL:  "https://example.com/café",
+		},
+		{
+			name:         "windows-1251 is rejected",
+			path:         "/",
+			contentType:  "text/plain; charset=windows-1251",
+			body:         []byte("https://example.com/\xef\xf0\xe8"),
+			expectedCode: http.StatusUnsupportedMediaType,
+			expectedBody: "unsupported charset\n",
+		},
+		{
+			name:         "UTF-16 is rejected",
+			path:         "/",
+			contentType:  "text/plain; charset=utf-16",
+			body:         []byte{0xff, 0xfe, 'h', 0, 't', 0},
+			expectedCode: http.StatusUnsupportedMediaType,
+			expectedBody: "unsupported charset\n",
+		},
+		{
+			name:         "Invalid UTF-8 body",
+			path:         "/",
+			contentType:  "text/plain; charset=utf-8",
+			body:         []byte("https://example.com/\xff\xfe"),
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "invalid_encoding\n",
+		},
+		{
+			name:         "Invalid UTF-8 in JSON",
+			path:         "/api/shorten",
+			contentType:  "application/json",
+			body:         []byte("{\"url\":\"https://example.com/\xff\"}"),
+			expectedCode: http.StatusBadRequest,
+			expectedBody: "invalid_encoding\n",
+		},
+		{
+			name:         "ISO-8859-1 JSON is transcoded",
+			path:         "/api/shorten",
+			contentType:  "application/json; charset=iso-8859-1",
+			body:         []byte("{\"url\":\"https://example.com/na\xefve\"}"),
+			expectedCode: http.StatusCreated,
+			expectedURL:  "https://example.com/naïve",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, repo, svc, appInstance, logger, cleanup := setupTestEnvironment(t)
+			defer cleanup()
+
+			r := createTestRouter(svc, logger, map[string]http.HandlerFunc{
+				"/":            appInstance.HandlePostURL,
+				"/api/shorten": appInstance.HandleJSONShorten,
+			})
+			req := createTestRequest(http.MethodPost, tt.path, tt.contentType, bytes.NewReader(tt.body))
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, req)
+
+			assertResponseCode(t, rr, tt.expectedCode)
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, rr.Body.String())
+			}
+			if tt.expectedURL != "" {
+				shortURL := rr.Body.String()
+				if tt.path == "/api/shorten" {
+					var resp ShortenResponse
+					assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+					shortURL = resp.Result
+				}
+				u, exists, _ := repo.Get(shortURL[strings.LastIndex(shortURL, "/")+1:])
+				assert.True(t, exists, "URL should be stored")
+				assert.Equal(t, tt.expectedURL, u.OriginalURL)
+			}
+		})
+	}
+}
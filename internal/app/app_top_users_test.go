@@ -0,0 +1,73 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/models"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+func TestApp_HandleTopUsers(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	for id, userID := range map[string]string{"id1": "user1", "id2": "user2", "id3": "user2", "id4": "user3", "id5": "user3"} {
+		_, err := repo.Save(id, "https://example.com/"+id, userID)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, repo.BatchDelete("user3", []string{"id5"}))
+
+	newRouter := func(opts ...service.Option) *chi.Mux {
+		logger := zap.NewNop()
+		svc := service.NewService(repo, "http://localhost:8080", "secret", opts...)
+		r := chi.NewRouter()
+		NewApp(svc, nil, logger).RegisterRoutes(r, middleware.TrustedSubnetMiddleware("10.0.0.0/8", logger))
+		return r
+	}
+	get := func(r *chi.Mux, target, realIP string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("X-Real-IP", realIP)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	r := newRouter()
+	rr := get(r, "/api/internal/users/top", "10.0.0.5")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var users []models.UserURLCount
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &users))
+	// user1 и user3 делят второе место и упорядочены по user_id
+	assert.Equal(t, []models.UserURLCount{
+		{UserID: "user2", URLs: 2},
+		{UserID: "user1", URLs: 1},
+		{UserID: "user3", URLs: 1, Deleted: 1},
+	}, users)
+
+	rr = get(r, "/api/internal/users/top?limit=1", "10.0.0.5")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `[{"user_id":"user2","urls":2,"deleted":0}]`, rr.Body.String())
+
+	rr = get(r, "/api/internal/users/top?limit=100000", "10.0.0.5")
+	assert.Equal(t, http.StatusOK, rr.Code, "Large limit should be capped, not rejected")
+
+	for _, limit := range []string{"0", "-1", "abc"} {
+		rr = get(r, "/api/internal/users/top?limit="+limit, "10.0.0.5")
+		assert.Equal(t, http.StatusBadRequest, rr.Code, limit)
+	}
+
+	rr = get(r, "/api/internal/users/top", "192.168.1.1")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// В режиме hashed идентификаторы пользователей не раскрываются
+	rr = get(newRouter(service.WithPIIMode(service.PIIModeHashed)), "/api/internal/users/top?limit=1", "10.0.0.5")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "user2")
+	assert.Contains(t, rr.Body.String(), service.HashUserID("user2"))
+}
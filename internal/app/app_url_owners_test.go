@@ -0,0 +1,67 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+func TestApp_HandleURLOwners(t *testing.T) {
+	// Без обратного индекса один URL могут сократить несколько пользователей
+	repo := repository.NewMemoryRepository(repository.DisableReverseIndex())
+	for id, userID := range map[string]string{"id1": "user2", "id2": "user1", "id3": "user2", "id4": ""} {
+		_, err := repo.Save(id, "https://spam.example.com", userID)
+		assert.NoError(t, err)
+	}
+	_, err := repo.Save("id5", "https://example.com", "user3")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.BatchDelete("user1", []string{"id2"}))
+
+	newRouter := func(opts ...service.Option) *chi.Mux {
+		logger := zap.NewNop()
+		svc := service.NewService(repo, "http://localhost:8080", "secret", opts...)
+		r := chi.NewRouter()
+		NewApp(svc, nil, logger).RegisterRoutes(r, middleware.TrustedSubnetMiddleware("10.0.0.0/8", logger))
+		return r
+	}
+	get := func(r *chi.Mux, originalURL, realIP string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/internal/url-owners?url="+url.QueryEscape(originalURL), nil)
+		req.Header.Set("X-Real-IP", realIP)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	r := newRouter()
+	rr := get(r, "https://spam.example.com", "10.0.0.5")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp URLOwnersResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	// Удалённые ссылки учитываются, анонимные без пользователя — нет
+	assert.Equal(t, URLOwnersResponse{URL: "https://spam.example.com", UserIDs: []string{"user1", "user2"}}, resp)
+
+	rr = get(r, "https://unknown.example.com", "10.0.0.5")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"url":"https://unknown.example.com","user_ids":[]}`, rr.Body.String())
+
+	rr = get(r, "", "10.0.0.5")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = get(r, "https://spam.example.com", "192.168.1.1")
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	// В режиме hashed идентификаторы пользователей не раскрываются
+	rr = get(newRouter(service.WithPIIMode(service.PIIModeHashed)), "https://example.com", "10.0.0.5")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "user3")
+	assert.Contains(t, rr.Body.String(), service.HashUserID("user3"))
+}
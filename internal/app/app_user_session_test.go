@@ -0,0 +1,217 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// newSessionRouter создаёт маршрутизатор с настройками аутентификации как в main
+func newSessionRouter(svc *service.Service, logger *zap.Logger) *chi.Mux {
+	appInstance := NewApp(svc, nil, logger)
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware(svc, logger, middleware.WithAnonymousPaths("/api/user/logout")))
+	appInstance.RegisterRoutes(r, middleware.TrustedSubnetMiddleware("10.0.0.0/8", logger))
+	return r
+}
+
+// authCookie возвращает cookie с JWT из ответа
+func authCookie(rr *httptest.ResponseRecorder) *http.Cookie {
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == middleware.AuthCookieName {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestApp_HandleLogout(t *testing.T) {
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+	r := newSessionRouter(svc, zap.NewNop())
+
+	// Первый запрос выдаёт идентификатор
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, createTestRequest(http.MethodPost, "/api/shorten", "application/json", strings.NewReader(`{"url":"https://example.com"}`)))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	first := authCookie(rr)
+	assert.NotNil(t, first)
+	firstUserID, err := svc.ParseJWT(first.Value)
+	assert.NoError(t, err)
+
+	// Выход удаляет cookie и не выдаёт новую
+	req := httptest.NewRequest(http.MethodPost, "/api/user/logout", nil)
+	req.AddCookie(first)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Len(t, rr.Result().Cookies(), 1, "Logout should only expire the cookie")
+	expired := authCookie(rr)
+	assert.NotNil(t, expired)
+	assert.Empty(t, expired.Value)
+	assert.Less(t, expired.MaxAge, 0, "Cookie should be sent with Max-Age=0")
+	assert.Contains(t, rr.Header().Get("Set-Cookie"), "Max-Age=0")
+
+	// Браузер больше не отправляет cookie, и следующий запрос получает новый идентификатор
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/user/stats", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	second := authCookie(rr)
+	assert.NotNil(t, second)
+	secondUserID, err := svc.ParseJWT(second.Value)
+	assert.NoError(t, err)
+	assert.NotEqual(t, firstUserID, secondUserID)
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/user/logout", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
+
+func TestApp_HandleSwitchUser(t *testing.T) {
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+	core, logs := observer.New(zap.InfoLevel)
+	r := newSessionRouter(svc, zap.New(core))
+
+	switchUser := func(realIP, body string) *httptest.ResponseRecorder {
+		req := createTestRequest(http.MethodPost, "/api/user/switch", "application/json", strings.NewReader(body))
+		req.Header.Set("X-Real-IP", realIP)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Вне доверенной подсети выдача токена запрещена и не попадает в аудит
+	rr := switchUser("192.168.1.1", `{"user_id":"customer42"}`)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Equal(t, 0, logs.FilterMessage("User impersonation").Len())
+
+	// Пустой user_id отклоняется с указанием поля
+	rr = switchUser("10.0.0.5", `{"user_id":""}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `{"field":"user_id","error":"required"}`)
+
+	rr = switchUser("10.0.0.5", `{"user_id":"customer42"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp SwitchUserResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, "customer42", resp.UserID)
+	userID, err := svc.ParseJWT(resp.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, "customer42", userID)
+
+	// Выдача токена записана в журнал аудита
+	audit := logs.FilterMessage("User impersonation").All()
+	assert.Len(t, audit, 1)
+	assert.Equal(t, "audit", audit[0].LoggerName)
+	fields := audit[0].ContextMap()
+	assert.Equal(t, "customer42", fields["target_user_id"])
+	assert.Equal(t, "10.0.0.5", fields["x_real_ip"])
+	assert.NotEmpty(t, fields["actor_user_id"])
+
+	// Выданный токен действует от имени выбранного пользователя
+	req := httptest.NewRequest(http.MethodGet, "/api/user/stats", nil)
+	req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: resp.Token})
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Nil(t, authCookie(rr), "Valid switched token should be accepted as is")
+}
+
+func TestApp_HandleRotateUser(t *testing.T) {
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+	core, logs := observer.New(zap.InfoLevel)
+	r := newSessionRouter(svc, zap.New(core))
+
+	// Создаём URL под исходным идентификатором
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, createTestRequest(http.MethodPost, "/api/shorten", "application/json", strings.NewReader(`{"url":"https://example.com"}`)))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	oldCookie := authCookie(rr)
+	assert.NotNil(t, oldCookie)
+	oldUserID, err := svc.ParseJWT(oldCookie.Value)
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/user/rotate", nil)
+	req.AddCookie(oldCookie)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var resp RotateUserResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.NotEqual(t, oldUserID, resp.UserID)
+	assert.Equal(t, 1, resp.URLs)
+
+	newCookie := authCookie(rr)
+	assert.NotNil(t, newCookie)
+	assert.Equal(t, resp.Token, newCookie.Value)
+	assert.Positive(t, newCookie.MaxAge)
+	newUserID, err := svc.ParseJWT(newCookie.Value)
+	assert.NoError(t, err)
+	assert.Equal(t, resp.UserID, newUserID)
+
+	userURLs := func(cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Утёкший токен по-прежнему валиден, но указывает на пользователя без URL
+	rr = userURLs(oldCookie)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Nil(t, authCookie(rr), "Old token should still parse and not be replaced")
+
+	rr = userURLs(newCookie)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), "https://example.com")
+
+	audit := logs.FilterMessage("User identity rotated").All()
+	assert.Len(t, audit, 1)
+	assert.Equal(t, "audit", audit[0].LoggerName)
+	assert.Equal(t, oldUserID, audit[0].ContextMap()["old_user_id"])
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/user/rotate", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+}
+
+func TestApp_PersistIssuedUsers(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret",
+			service.WithIssuedUserPersistence(enabled))
+		r := newSessionRouter(svc, zap.NewNop())
+
+		// Двое анонимных клиентов получают JWT, но ссылок не создают
+		var cookie *http.Cookie
+		for i := 0; i < 2; i++ {
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/user/urls", nil))
+			cookie = authCookie(rr)
+			assert.NotNil(t, cookie)
+		}
+		// Повторный запрос с выданной cookie нового пользователя не добавляет
+		if cookie != nil {
+			req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+			req.AddCookie(cookie)
+			r.ServeHTTP(httptest.NewRecorder(), req)
+		}
+
+		_, users, err := svc.GetStats()
+		assert.NoError(t, err)
+		if enabled {
+			assert.Equal(t, 2, users, "issued users should be counted when persistence is on")
+		} else {
+			assert.Zero(t, users, "issued users should not be counted when persistence is off")
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/models"
+)
+
+func TestApp_HandleUserStats(t *testing.T) {
+	_, repo, svc, appInstance, logger, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	const userID = "stats_user"
+	_, err := repo.Save("id1", "https://example1.com", userID)
+	assert.NoError(t, err)
+	_, err = repo.Save("id2", "https://example2.com", userID)
+	assert.NoError(t, err)
+	_, err = repo.Save("id3", "https://example3.com", userID)
+	assert.NoError(t, err)
+	_, err = repo.Save("id4", "https://example4.com", "other_user")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.BatchDelete(userID, []string{"id3"}))
+
+	token, err := svc.GenerateJWT(userID)
+	assert.NoError(t, err)
+
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware(svc, logger))
+	r.Get("/api/user/stats", appInstance.HandleUserStats)
+
+	t.Run("User with active and deleted links", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/stats", nil)
+		req.AddCookie(&http.Cookie{Name: "jwt", Value: token})
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+		var stats models.UserStats
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &stats))
+		assert.Equal(t, models.UserStats{URLs: 2, Deleted: 1, ClicksTotal: 0, CreatedLast30d: 3}, stats)
+	})
+
+	t.Run("New anonymous user gets zeros", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/user/stats", nil))
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.JSONEq(t, `{"urls":0,"deleted":0,"clicks_total":0,"created_last_30d":0}`, rr.Body.String())
+	})
+
+	t.Run("POST request - should return Method Not Allowed", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		appInstance.HandleUserStats(rr, httptest.NewRequest(http.MethodPost, "/api/user/stats", nil))
+		assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	})
+}
@@ -0,0 +1,93 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+func TestApp_HandleUserURLs_Fields(t *testing.T) {
+	logger := zap.NewNop()
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+	appInstance := NewApp(svc, nil, logger)
+	r := createTestRouter(svc, logger, map[string]http.HandlerFunc{
+		"GET /api/user/urls": appInstance.HandleUserURLs,
+	})
+	_, _, err := svc.CreateShortURLWithDetails("https://example.com", "user1", nil, "Spring promo")
+	assert.NoError(t, err)
+	token, err := svc.GenerateJWT("user1")
+	assert.NoError(t, err)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/urls"+query, nil)
+		req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: token})
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+	decode := func(rr *httptest.ResponseRecorder) []map[string]any {
+		var items []map[string]any
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &items))
+		return items
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		wantKeys []string
+	}{
+		{name: "all fields", query: "", wantKeys: []string{"short_url", "original_url", "short_id", "description", "created_at"}},
+		{name: "single field", query: "?fields=short_url", wantKeys: []string{"short_url"}},
+		{name: "multiple fields", query: "?fields=short_id,%20description,short_id", wantKeys: []string{"short_id", "description"}},
+		{name: "created_at", query: "?fields=short_url,created_at", wantKeys: []string{"short_url", "created_at"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := get(tt.query)
+			assert.Equal(t, http.StatusOK, rr.Code)
+			items := decode(rr)
+			if assert.Len(t, items, 1) {
+				// Невыбранные поля отсутствуют в JSON, а не приходят пустыми строками
+				assert.Len(t, items[0], len(tt.wantKeys))
+				for _, key := range tt.wantKeys {
+					assert.NotEmpty(t, items[0][key], "field %s", key)
+				}
+			}
+		})
+	}
+
+	t.Run("created_at is RFC 3339", func(t *testing.T) {
+		items := decode(get("?fields=short_url,created_at"))
+		if assert.Len(t, items, 1) {
+			createdAt, err := time.Parse(time.RFC3339, items[0]["created_at"].(string))
+			assert.NoError(t, err)
+			assert.WithinDuration(t, time.Now(), createdAt, time.Minute)
+		}
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		rr := get("?fields=short_url,password")
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"password"`)
+	})
+
+	t.Run("empty description omitted", func(t *testing.T) {
+		_, _, err := svc.CreateShortURL("https://example.org", "user1")
+		assert.NoError(t, err)
+		rr := get("?fields=original_url,description")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		for _, item := range decode(rr) {
+			if item["original_url"] == "https://example.org" {
+				assert.NotContains(t, item, "description")
+			}
+		}
+	})
+}
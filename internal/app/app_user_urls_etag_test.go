@@ -0,0 +1,86 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+func TestApp_HandleUserURLs_ETag(t *testing.T) {
+	t.Parallel()
+	logger := zap.NewNop()
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+	appInstance := NewApp(svc, nil, logger)
+	r := createTestRouter(svc, logger, map[string]http.HandlerFunc{
+		"GET /api/user/urls": appInstance.HandleUserURLs,
+	})
+	_, _, err := svc.CreateShortURLWithDetails("https://a.example/1", "userA", nil, "")
+	assert.NoError(t, err)
+	_, _, err = svc.CreateShortURLWithDetails("https://b.example/1", "userB", nil, "")
+	assert.NoError(t, err)
+
+	get := func(userID, query, ifNoneMatch string) *httptest.ResponseRecorder {
+		token, err := svc.GenerateJWT(userID)
+		assert.NoError(t, err)
+		req := httptest.NewRequest(http.MethodGet, "/api/user/urls"+query, nil)
+		req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: token})
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	first := get("userB", "", "")
+	assert.Equal(t, http.StatusOK, first.Code)
+	etagB := first.Header().Get("ETag")
+	assert.NotEmpty(t, etagB)
+
+	notModified := get("userB", "", etagB)
+	assert.Equal(t, http.StatusNotModified, notModified.Code)
+	assert.Empty(t, notModified.Body.String())
+	assert.Equal(t, etagB, notModified.Header().Get("ETag"))
+
+	// ETag зависит от представления списка и от пользователя, а не только от ревизии
+	assert.NotEqual(t, etagB, get("userB", "?fields=short_url", "").Header().Get("ETag"))
+	assert.NotEqual(t, etagB, get("userA", "", "").Header().Get("ETag"))
+
+	etagA := get("userA", "", "").Header().Get("ETag")
+	_, _, err = svc.CreateShortURLWithDetails("https://a.example/2", "userA", nil, "")
+	assert.NoError(t, err)
+
+	// Запись пользователя A меняет только его ETag
+	assert.NotEqual(t, etagA, get("userA", "", "").Header().Get("ETag"))
+	assert.Equal(t, http.StatusOK, get("userA", "", etagA).Code)
+	assert.Equal(t, etagB, get("userB", "", "").Header().Get("ETag"))
+	assert.Equal(t, http.StatusNotModified, get("userB", "", etagB).Code)
+}
+
+func TestEtagMatches(t *testing.T) {
+	t.Parallel()
+	etag := `W/"rev-abc"`
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		want        bool
+	}{
+		{name: "Empty", ifNoneMatch: "", want: false},
+		{name: "Exact", ifNoneMatch: `W/"rev-abc"`, want: true},
+		{name: "Strong", ifNoneMatch: `"rev-abc"`, want: true},
+		{name: "List", ifNoneMatch: `"other", W/"rev-abc"`, want: true},
+		{name: "Wildcard", ifNoneMatch: "*", want: true},
+		{name: "Other", ifNoneMatch: `W/"rev-abd"`, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, etagMatches(tt.ifNoneMatch, etag))
+		})
+	}
+}
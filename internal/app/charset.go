@@ -0,0 +1,54 @@
+package app
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// errUnsupportedCharset возвращается для кодировок, которые сервис не принимает
+var errUnsupportedCharset = errors.New("unsupported charset")
+
+// errInvalidEncoding возвращается, если тело запроса не является корректным UTF-8
+var errInvalidEncoding = errors.New("invalid_encoding")
+
+// decodeBody приводит тело запроса к UTF-8 согласно параметру charset из Content-Type
+// utf-8 и us-ascii принимаются как есть, iso-8859-1 перекодируется, остальные кодировки отклоняются
+func decodeBody(contentType string, body []byte) ([]byte, error) {
+	charset := ""
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		charset = strings.ToLower(strings.TrimSpace(params["charset"]))
+	}
+
+	switch charset {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+	case "iso-8859-1", "iso8859-1", "latin1":
+		body = latin1ToUTF8(body)
+	default:
+		return nil, errUnsupportedCharset
+	}
+
+	if !utf8.Valid(body) {
+		return nil, errInvalidEncoding
+	}
+	return body, nil
+}
+
+// latin1ToUTF8 перекодирует байты ISO-8859-1 в UTF-8: каждый байт соответствует кодовой точке Unicode
+func latin1ToUTF8(body []byte) []byte {
+	buf := make([]byte, 0, len(body)*2)
+	for _, b := range body {
+		buf = utf8.AppendRune(buf, rune(b))
+	}
+	return buf
+}
+
+// charsetErrorStatus возвращает HTTP-статус для ошибки декодирования тела запроса
+func charsetErrorStatus(err error) int {
+	if errors.Is(err, errUnsupportedCharset) {
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusBadRequest
+}
@@ -3,11 +3,21 @@ package app
 import (
 	"database/sql"
 	"fmt"
+	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/tempizhere/goshorty/internal/repository"
 )
 
+// Параметры пула соединений с базой данных
+const (
+	// DefaultConnMaxLifetime — время жизни соединения: пул переподключается, заново разрешая имя хоста из DSN,
+	// поэтому после смены адреса базы (например, при переключении на реплику) старые соединения не живут вечно
+	DefaultConnMaxLifetime = 5 * time.Minute
+	// dbMaxIdleConns — число простаивающих соединений пула, как по умолчанию в database/sql
+	dbMaxIdleConns = 2
+)
+
 // DB представляет подключение к базе данных
 type DB struct {
 	conn *sql.DB
@@ -23,6 +33,8 @@ func NewDB(dsn string) (repository.Database, error) {
 	if err != nil {
 		return nil, err
 	}
+	conn.SetConnMaxLifetime(DefaultConnMaxLifetime)
+	conn.SetMaxIdleConns(dbMaxIdleConns)
 
 	if err := conn.Ping(); err != nil {
 		if closeErr := conn.Close(); closeErr != nil {
@@ -66,6 +78,15 @@ func NewDB(dsn string) (repository.Database, error) {
 			return nil, err
 		}
 
+		// Добавляем столбец tags, если он не существует
+		_, err = conn.Exec("ALTER TABLE urls ADD COLUMN IF NOT EXISTS tags JSONB")
+		if err != nil {
+			if closeErr := conn.Close(); closeErr != nil {
+				return nil, fmt.Errorf("failed to close connection after exec error: %v (original error: %v)", closeErr, err)
+			}
+			return nil, err
+		}
+
 		// Проверяем наличие уникального индекса на original_url
 		var indexExists bool
 		err = conn.QueryRow(`
@@ -102,6 +123,12 @@ func (db *DB) Ping() error {
 	return db.conn.Ping()
 }
 
+// ResetConnections закрывает простаивающие соединения пула; следующие запросы подключаются заново
+func (db *DB) ResetConnections() {
+	db.conn.SetMaxIdleConns(0)
+	db.conn.SetMaxIdleConns(dbMaxIdleConns)
+}
+
 // Close закрывает соединение с базой данных
 func (db *DB) Close() error {
 	if db == nil || db.conn == nil {
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Параметры наблюдения за соединением с базой данных
+const (
+	DefaultDBHealthInterval = 5 * time.Second // Период проверки соединения с базой данных
+	DefaultDBResetThreshold = 3               // Число неудачных проверок подряд, после которого соединения сбрасываются
+)
+
+// connResetter — необязательная возможность Database: закрыть простаивающие соединения пула,
+// чтобы следующие запросы заново разрешили имя хоста и подключились к новому адресу
+type connResetter interface {
+	ResetConnections()
+}
+
+// WatchDatabase сразу и затем раз в interval проверяет соединение с базой данных до отмены контекста
+// После threshold неудачных проверок подряд (и затем каждые threshold проверок) сбрасывает соединения пула,
+// если Database это поддерживает. Без базы данных или при неположительных параметрах ничего не делает
+func (a *App) WatchDatabase(ctx context.Context, interval time.Duration, threshold int) {
+	if a.db == nil || interval <= 0 || threshold <= 0 {
+		return
+	}
+	a.dbWatched.Store(true)
+	a.checkDatabase(threshold)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.checkDatabase(threshold)
+		}
+	}
+}
+
+// checkDatabase проверяет соединение с базой данных и сбрасывает пул после threshold неудач подряд
+func (a *App) checkDatabase(threshold int) {
+	err := a.db.Ping()
+	if err == nil {
+		if failures := a.dbFailures.Swap(0); failures > 0 {
+			a.logger.Info("Database connection recovered", zap.Int64("failed_pings", failures))
+		}
+		return
+	}
+	failures := a.dbFailures.Add(1)
+	if failures%int64(threshold) != 0 {
+		a.logger.Warn("Database ping failed", zap.Int64("consecutive_failures", failures), zap.Error(err))
+		return
+	}
+	resetter, ok := a.db.(connResetter)
+	if !ok {
+		a.logger.Error("Database unreachable", zap.Int64("consecutive_failures", failures), zap.Error(err))
+		return
+	}
+	a.logger.Error("Database unreachable, resetting connections to re-resolve the host",
+		zap.Int64("consecutive_failures", failures), zap.Error(err))
+	resetter.ResetConnections()
+}
+
+// writeDBHealth отвечает на /readyz 200 с числом неудачных проверок базы данных подряд из WatchDatabase
+func (a *App) writeDBHealth(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte("db_consecutive_failures: " + strconv.FormatInt(a.dbFailures.Load(), 10) + "\n")); err != nil {
+		a.logger.Warn("Failed to write readiness detail", zap.Error(err))
+	}
+}
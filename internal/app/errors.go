@@ -0,0 +1,63 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+// retryAfter — через сколько клиенту стоит повторить запрос, если хранилище недоступно или заполнено
+const retryAfter = 5 * time.Second
+
+// clientErrors перечисляет ошибки сервиса, вызванные данными запроса
+var clientErrors = []error{
+	service.ErrEmptyURL,
+	service.ErrInvalidURL,
+	service.ErrEmptyID,
+	service.ErrReservedID,
+	service.ErrIDAlreadyExists,
+	service.ErrEmptyBatch,
+	service.ErrDuplicateCorrID,
+	service.ErrInvalidHost,
+	service.ErrDescriptionTooLong,
+	service.ErrDuplicatesUnsupported,
+}
+
+// isClientError сообщает, вызвана ли ошибка сервиса некорректными данными запроса
+// Ошибки сравниваются только с типизированными значениями clientErrors: текст ошибки хранилища на ответ не влияет
+// Остальные ошибки (сбой соединения с базой, заполненное хранилище и т.д.) считаются временными сбоями инфраструктуры
+func isClientError(err error) bool {
+	for _, target := range clientErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// writeServiceError отвечает на ошибку сервиса: 400 для ошибок во входных данных,
+// 503 с Retry-After для сбоев хранилища, текст которых клиенту не раскрывается,
+// и для пакетов, отклонённых из-за лимита одновременных пакетов
+func (a *App) writeServiceError(w http.ResponseWriter, err error) {
+	if isClientError(err) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+	if errors.Is(err, service.ErrBatchLimit) {
+		a.logger.Warn("Batch rejected", zap.Error(err))
+		http.Error(w, "Too many concurrent batch requests", http.StatusServiceUnavailable)
+		return
+	}
+	message := "Service temporarily unavailable"
+	if errors.Is(err, repository.ErrStorageFull) {
+		message = "Storage is full"
+	}
+	a.logger.Error("Storage error", zap.Error(err))
+	http.Error(w, message, http.StatusServiceUnavailable)
+}
@@ -0,0 +1,126 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/models"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+// failingRepository возвращает заданную ошибку при сохранении
+type failingRepository struct {
+	repository.Repository
+	err error
+}
+
+func (f failingRepository) SaveURL(u models.URL) (string, error) {
+	return "", f.err
+}
+
+func (f failingRepository) BatchSave(items []models.BatchItem, userID string) error {
+	return f.err
+}
+
+func TestIsClientError(t *testing.T) {
+	assert.True(t, isClientError(service.ErrEmptyURL))
+	assert.True(t, isClientError(service.ErrInvalidURL))
+	assert.True(t, isClientError(fmt.Errorf("parse: %w", service.ErrInvalidURL)))
+	assert.False(t, isClientError(errors.New("invalid URL")), "Only the typed sentinel is a client error")
+	assert.True(t, isClientError(service.ErrDuplicateCorrID))
+	assert.False(t, isClientError(repository.ErrStorageFull))
+	assert.False(t, isClientError(errors.New("dial tcp 127.0.0.1:5432: connect: connection refused")))
+}
+
+func TestApp_ShortenStorageErrors(t *testing.T) {
+	dbErr := errors.New("dial tcp 127.0.0.1:5432: connect: connection refused")
+
+	tests := []struct {
+		name        string
+		repoErr     error
+		path        string
+		contentType string
+		body        string
+		wantCode    int
+		wantBody    string
+	}{
+		{name: "Plain DB error", repoErr: dbErr, path: "/", contentType: "text/plain", body: "https://example.com", wantCode: http.StatusServiceUnavailable, wantBody: "Service temporarily unavailable\n"},
+		{name: "JSON DB error", repoErr: dbErr, path: "/api/shorten", contentType: "application/json", body: `{"url":"https://example.com"}`, wantCode: http.StatusServiceUnavailable, wantBody: "Service temporarily unavailable\n"},
+		{name: "Batch DB error", repoErr: dbErr, path: "/api/shorten/batch", contentType: "application/json", body: `[{"correlation_id":"1","original_url":"https://example.com"}]`, wantCode: http.StatusServiceUnavailable, wantBody: "Service temporarily unavailable\n"},
+		{name: "Plain storage full", repoErr: repository.ErrStorageFull, path: "/", contentType: "text/plain", body: "https://example.com", wantCode: http.StatusServiceUnavailable, wantBody: "Storage is full\n"},
+		{name: "Batch storage full", repoErr: repository.ErrStorageFull, path: "/api/shorten/batch", contentType: "application/json", body: `[{"correlation_id":"1","original_url":"https://example.com"}]`, wantCode: http.StatusServiceUnavailable, wantBody: "Storage is full\n"},
+		// Ошибка хранилища с тем же текстом, что и у ошибки валидации, остаётся сбоем сервера
+		{name: "Plain DB error with client-like text", repoErr: errors.New("invalid URL"), path: "/", contentType: "text/plain", body: "https://example.com", wantCode: http.StatusServiceUnavailable, wantBody: "Service temporarily unavailable\n"},
+		{name: "JSON DB error with client-like text", repoErr: errors.New("empty URL"), path: "/api/shorten", contentType: "application/json", body: `{"url":"https://example.com"}`, wantCode: http.StatusServiceUnavailable, wantBody: "Service temporarily unavailable\n"},
+		{name: "Plain empty URL", repoErr: dbErr, path: "/", contentType: "text/plain", body: "", wantCode: http.StatusBadRequest, wantBody: "empty URL\n"},
+		{name: "Plain invalid URL", repoErr: dbErr, path: "/", contentType: "text/plain", body: "not a url", wantCode: http.StatusBadRequest, wantBody: "invalid URL\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := failingRepository{Repository: repository.NewMemoryRepository(), err: tt.repoErr}
+			svc := service.NewService(repo, "http://localhost:8080", "secret")
+			logger := zap.NewNop()
+			appInstance := NewApp(svc, nil, logger)
+			r := createTestRouter(svc, logger, map[string]http.HandlerFunc{
+				"/":                  appInstance.HandlePostURL,
+				"/api/shorten":       appInstance.HandleJSONShorten,
+				"/api/shorten/batch": appInstance.HandleBatchShorten,
+			})
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, createTestRequest(http.MethodPost, tt.path, tt.contentType, strings.NewReader(tt.body)))
+			assert.Equal(t, tt.wantCode, rr.Code)
+			assert.Equal(t, tt.wantBody, rr.Body.String())
+			if tt.wantCode == http.StatusServiceUnavailable {
+				assert.Equal(t, "5", rr.Header().Get("Retry-After"))
+			} else {
+				assert.Empty(t, rr.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestApp_LookupStorageErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		repo     repository.Repository
+		path     string
+		wantCode int
+	}{
+		{name: "Redirect DB error", repo: unavailableDB{}, path: "/abc123", wantCode: http.StatusServiceUnavailable},
+		{name: "Expand DB error", repo: unavailableDB{}, path: "/api/expand/abc123", wantCode: http.StatusServiceUnavailable},
+		{name: "Info DB error", repo: unavailableDB{}, path: "/abc123/info", wantCode: http.StatusServiceUnavailable},
+		// Настоящий промах по-прежнему отличается от сбоя хранилища
+		{name: "Redirect not found", repo: repository.NewMemoryRepository(), path: "/abc123", wantCode: http.StatusBadRequest},
+		{name: "Expand not found", repo: repository.NewMemoryRepository(), path: "/api/expand/abc123", wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := service.NewService(tt.repo, "http://localhost:8080", "secret")
+			appInstance := NewApp(svc, nil, zap.NewNop())
+			r := chi.NewRouter()
+			r.Get("/{id}", appInstance.HandleGetURL)
+			r.Get("/{id}/info", appInstance.HandleLinkInfo)
+			r.Get("/api/expand/{id}", appInstance.HandleJSONExpand)
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, tt.wantCode, rr.Code)
+			if tt.wantCode == http.StatusServiceUnavailable {
+				assert.Equal(t, "5", rr.Header().Get("Retry-After"))
+			} else {
+				assert.Empty(t, rr.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
@@ -17,13 +17,21 @@ import (
 	"go.uber.org/zap"
 )
 
-// ExampleApp_HandlePostURL демонстрирует обработку POST запроса для сокращения URL через plain text
-func ExampleApp_HandlePostURL() {
-	// Создаём зависимости
-	repo := repository.NewMemoryRepository()
-	svc := service.NewService(repo, "http://localhost:8080", "test-secret")
+// newExample создаёт зависимости примеров: сервис на хранилище в памяти, приложение
+// и маршрутизатор с middleware аутентификации, на котором пример регистрирует свой обработчик
+func newExample(opts ...service.Option) (*service.Service, *app.App, *chi.Mux) {
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "test-secret", opts...)
 	logger := zap.NewNop()
 	appInstance := app.NewApp(svc, nil, logger)
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware(svc, logger))
+	return svc, appInstance, r
+}
+
+// ExampleApp_HandlePostURL демонстрирует обработку POST запроса для сокращения URL через plain text
+func ExampleApp_HandlePostURL() {
+	// Создаём зависимости и маршрутизатор с middleware аутентификации
+	_, appInstance, r := newExample()
 
 	// Создаём HTTP запрос
 	body := strings.NewReader("https://example.com/very-long-url")
@@ -33,12 +41,8 @@ func ExampleApp_HandlePostURL() {
 	// Создаём response recorder
 	w := httptest.NewRecorder()
 
-	// Создаём маршрутизатор с middleware
-	r := chi.NewRouter()
-	r.Use(middleware.AuthMiddleware(svc, logger))
-	r.Post("/", func(w http.ResponseWriter, r *http.Request) {
-		appInstance.HandlePostURL(w, r)
-	})
+	// Регистрируем обработчик
+	r.Post("/", appInstance.HandlePostURL)
 
 	// Выполняем запрос
 	r.ServeHTTP(w, req)
@@ -57,11 +61,8 @@ func ExampleApp_HandlePostURL() {
 
 // ExampleApp_HandleJSONShorten демонстрирует обработку POST запроса для сокращения URL через JSON API
 func ExampleApp_HandleJSONShorten() {
-	// Создаём зависимости
-	repo := repository.NewMemoryRepository()
-	svc := service.NewService(repo, "http://localhost:8080", "test-secret")
-	logger := zap.NewNop()
-	appInstance := app.NewApp(svc, nil, logger)
+	// Создаём зависимости и маршрутизатор с middleware аутентификации
+	_, appInstance, r := newExample()
 
 	// Создаём JSON запрос
 	requestBody := app.ShortenRequest{
@@ -76,12 +77,8 @@ func ExampleApp_HandleJSONShorten() {
 	// Создаём response recorder
 	w := httptest.NewRecorder()
 
-	// Создаём маршрутизатор с middleware
-	r := chi.NewRouter()
-	r.Use(middleware.AuthMiddleware(svc, logger))
-	r.Post("/api/shorten", func(w http.ResponseWriter, r *http.Request) {
-		appInstance.HandleJSONShorten(w, r)
-	})
+	// Регистрируем обработчик
+	r.Post("/api/shorten", appInstance.HandleJSONShorten)
 
 	// Выполняем запрос
 	r.ServeHTTP(w, req)
@@ -105,16 +102,13 @@ func ExampleApp_HandleJSONShorten() {
 
 // ExampleApp_HandleGetURL демонстрирует обработку GET запроса для получения оригинального URL
 func ExampleApp_HandleGetURL() {
-	// Создаём зависимости
-	repo := repository.NewMemoryRepository()
-	svc := service.NewService(repo, "http://localhost:8080", "test-secret")
-	logger := zap.NewNop()
-	appInstance := app.NewApp(svc, nil, logger)
+	// Создаём зависимости и маршрутизатор с middleware аутентификации
+	svc, appInstance, r := newExample()
 
 	// Сначала создаём короткий URL
 	originalURL := "https://example.com/very-long-url"
 	userID := "user-123"
-	shortURL, _ := svc.CreateShortURL(originalURL, userID)
+	_, shortURL, _ := svc.CreateShortURL(originalURL, userID)
 	shortID := shortURL[len("http://localhost:8080/"):]
 
 	// Создаём HTTP запрос для получения оригинального URL
@@ -123,12 +117,8 @@ func ExampleApp_HandleGetURL() {
 	// Создаём response recorder
 	w := httptest.NewRecorder()
 
-	// Создаём маршрутизатор с middleware
-	r := chi.NewRouter()
-	r.Use(middleware.AuthMiddleware(svc, logger))
-	r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
-		appInstance.HandleGetURL(w, r)
-	})
+	// Регистрируем обработчик
+	r.Get("/{id}", appInstance.HandleGetURL)
 
 	// Выполняем запрос
 	r.ServeHTTP(w, req)
@@ -144,16 +134,13 @@ func ExampleApp_HandleGetURL() {
 
 // ExampleApp_HandleJSONExpand демонстрирует обработку GET запроса для получения оригинального URL через JSON API
 func ExampleApp_HandleJSONExpand() {
-	// Создаём зависимости
-	repo := repository.NewMemoryRepository()
-	svc := service.NewService(repo, "http://localhost:8080", "test-secret")
-	logger := zap.NewNop()
-	appInstance := app.NewApp(svc, nil, logger)
+	// Создаём зависимости и маршрутизатор с middleware аутентификации
+	svc, appInstance, r := newExample()
 
 	// Сначала создаём короткий URL
 	originalURL := "https://example.com/very-long-url"
 	userID := "user-123"
-	shortURL, _ := svc.CreateShortURL(originalURL, userID)
+	_, shortURL, _ := svc.CreateShortURL(originalURL, userID)
 	shortID := shortURL[len("http://localhost:8080/"):]
 
 	// Создаём HTTP запрос
@@ -162,12 +149,8 @@ func ExampleApp_HandleJSONExpand() {
 	// Создаём response recorder
 	w := httptest.NewRecorder()
 
-	// Создаём маршрутизатор с middleware
-	r := chi.NewRouter()
-	r.Use(middleware.AuthMiddleware(svc, logger))
-	r.Get("/api/expand/{id}", func(w http.ResponseWriter, r *http.Request) {
-		appInstance.HandleJSONExpand(w, r)
-	})
+	// Регистрируем обработчик
+	r.Get("/api/expand/{id}", appInstance.HandleJSONExpand)
 
 	// Выполняем запрос
 	r.ServeHTTP(w, req)
@@ -189,11 +172,8 @@ func ExampleApp_HandleJSONExpand() {
 
 // ExampleApp_HandleBatchShorten демонстрирует обработку POST запроса для пакетного сокращения URL
 func ExampleApp_HandleBatchShorten() {
-	// Создаём зависимости
-	repo := repository.NewMemoryRepository()
-	svc := service.NewService(repo, "http://localhost:8080", "test-secret")
-	logger := zap.NewNop()
-	appInstance := app.NewApp(svc, nil, logger)
+	// Создаём зависимости и маршрутизатор с middleware аутентификации
+	_, appInstance, r := newExample()
 
 	// Создаём пакет запросов
 	requests := []models.BatchRequest{
@@ -216,12 +196,8 @@ func ExampleApp_HandleBatchShorten() {
 	// Создаём response recorder
 	w := httptest.NewRecorder()
 
-	// Создаём маршрутизатор с middleware
-	r := chi.NewRouter()
-	r.Use(middleware.AuthMiddleware(svc, logger))
-	r.Post("/api/shorten/batch", func(w http.ResponseWriter, r *http.Request) {
-		appInstance.HandleBatchShorten(w, r)
-	})
+	// Регистрируем обработчик
+	r.Post("/api/shorten/batch", appInstance.HandleBatchShorten)
 
 	// Выполняем запрос
 	r.ServeHTTP(w, req)
@@ -252,20 +228,17 @@ func ExampleApp_HandleBatchShorten() {
 
 // ExampleApp_HandleUserURLs демонстрирует обработку GET запроса для получения URL пользователя
 func ExampleApp_HandleUserURLs() {
-	// Создаём зависимости
-	repo := repository.NewMemoryRepository()
-	svc := service.NewService(repo, "http://localhost:8080", "test-secret")
-	logger := zap.NewNop()
-	appInstance := app.NewApp(svc, nil, logger)
+	// Создаём зависимости и маршрутизатор с middleware аутентификации
+	svc, appInstance, r := newExample()
 
 	// Создаём несколько URL для пользователя
 	// Используем тот же userID, который генерирует middleware
 	userID, _ := svc.GenerateUserID()
-	if _, err := svc.CreateShortURL("https://example.com/url1", userID); err != nil {
+	if _, _, err := svc.CreateShortURL("https://example.com/url1", userID); err != nil {
 		fmt.Printf("Ошибка при создании URL: %v\n", err)
 		return
 	}
-	if _, err := svc.CreateShortURL("https://example.com/url2", userID); err != nil {
+	if _, _, err := svc.CreateShortURL("https://example.com/url2", userID); err != nil {
 		fmt.Printf("Ошибка при создании URL: %v\n", err)
 		return
 	}
@@ -283,12 +256,8 @@ func ExampleApp_HandleUserURLs() {
 	// Создаём response recorder
 	w := httptest.NewRecorder()
 
-	// Создаём маршрутизатор с middleware
-	r := chi.NewRouter()
-	r.Use(middleware.AuthMiddleware(svc, logger))
-	r.Get("/api/user/urls", func(w http.ResponseWriter, r *http.Request) {
-		appInstance.HandleUserURLs(w, r)
-	})
+	// Регистрируем обработчик
+	r.Get("/api/user/urls", appInstance.HandleUserURLs)
 
 	// Выполняем запрос
 	r.ServeHTTP(w, req)
@@ -316,16 +285,13 @@ func ExampleApp_HandleUserURLs() {
 
 // ExampleApp_HandleBatchDeleteURLs демонстрирует обработку DELETE запроса для пакетного удаления URL
 func ExampleApp_HandleBatchDeleteURLs() {
-	// Создаём зависимости
-	repo := repository.NewMemoryRepository()
-	svc := service.NewService(repo, "http://localhost:8080", "test-secret")
-	logger := zap.NewNop()
-	appInstance := app.NewApp(svc, nil, logger)
+	// Создаём зависимости и маршрутизатор с middleware аутентификации
+	svc, appInstance, r := newExample()
 
 	// Создаём несколько URL для пользователя
 	userID := "user-123"
-	shortURL1, _ := svc.CreateShortURL("https://example.com/url1", userID)
-	shortURL2, _ := svc.CreateShortURL("https://example.com/url2", userID)
+	_, shortURL1, _ := svc.CreateShortURL("https://example.com/url1", userID)
+	_, shortURL2, _ := svc.CreateShortURL("https://example.com/url2", userID)
 
 	// Извлекаем ID из коротких URL
 	shortID1 := shortURL1[len("http://localhost:8080/"):]
@@ -342,12 +308,8 @@ func ExampleApp_HandleBatchDeleteURLs() {
 	// Создаём response recorder
 	w := httptest.NewRecorder()
 
-	// Создаём маршрутизатор с middleware
-	r := chi.NewRouter()
-	r.Use(middleware.AuthMiddleware(svc, logger))
-	r.Delete("/api/user/urls", func(w http.ResponseWriter, r *http.Request) {
-		appInstance.HandleBatchDeleteURLs(w, r)
-	})
+	// Регистрируем обработчик
+	r.Delete("/api/user/urls", appInstance.HandleBatchDeleteURLs)
 
 	// Выполняем запрос
 	r.ServeHTTP(w, req)
@@ -360,3 +322,103 @@ func ExampleApp_HandleBatchDeleteURLs() {
 	// Статус код: 202
 	// Удалено URL: 2
 }
+
+// ExampleApp_HandleStats демонстрирует запрос статистики сервиса к внутреннему API
+// Внутренние маршруты защищены middleware.TrustedSubnetMiddleware: запрос проходит,
+// только если IP клиента из заголовка X-Real-IP входит в доверенную подсеть
+func ExampleApp_HandleStats() {
+	// Создаём зависимости и наполняем хранилище
+	svc, appInstance, r := newExample()
+	for _, link := range []struct{ url, user string }{
+		{"https://example.com/url1", "user-1"},
+		{"https://example.com/url2", "user-1"},
+		{"https://example.com/url3", "user-2"},
+	} {
+		if _, _, err := svc.CreateShortURL(link.url, link.user); err != nil {
+			fmt.Printf("Ошибка при создании URL: %v\n", err)
+			return
+		}
+	}
+
+	// Регистрируем обработчик за проверкой доверенной подсети
+	r.With(middleware.TrustedSubnetMiddleware("10.0.0.0/8", zap.NewNop())).Get("/api/internal/stats", appInstance.HandleStats)
+
+	// Запрос без X-Real-IP отклоняется
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/internal/stats", nil))
+	fmt.Printf("Без X-Real-IP: %d\n", w.Code)
+
+	// Запрос из доверенной подсети получает статистику
+	req := httptest.NewRequest("GET", "/api/internal/stats", nil)
+	req.Header.Set("X-Real-IP", "10.0.0.5")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	fmt.Printf("Статус код: %d\n", w.Code)
+
+	var stats models.StatsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		fmt.Printf("Ошибка при разборе JSON: %v\n", err)
+		return
+	}
+	// Время работы, версия Go и PID зависят от процесса, поэтому не выводятся
+	fmt.Printf("URL: %d, пользователей: %d, хранилище: %s\n", stats.URLs, stats.Users, stats.Backend)
+	for _, index := range stats.Indexes {
+		fmt.Printf("Индекс %s: %d записей\n", index.Name, index.Entries)
+	}
+
+	// Output:
+	// Без X-Real-IP: 403
+	// Статус код: 200
+	// URL: 3, пользователей: 2, хранилище: memory
+	// Индекс store: 3 записей
+	// Индекс user_index: 2 записей
+	// Индекс users: 0 записей
+	// Индекс referrers: 0 записей
+	// Индекс clicks: 0 записей
+}
+
+// ExampleApp_HandleResolve демонстрирует проверку списка коротких ID через внутреннее API
+// Результаты возвращаются в порядке запроса
+func ExampleApp_HandleResolve() {
+	// Создаём зависимости; ID задаются генератором, чтобы вывод не зависел от случайных значений
+	// Когда заданные ID кончаются, генератор выдаёт идентификатор посетителя для middleware аутентификации
+	ids := []string{"active01", "gone0002"}
+	svc, appInstance, r := newExample(service.WithIDGenerator(func(int) (string, error) {
+		if len(ids) == 0 {
+			return "visitor1", nil
+		}
+		id := ids[0]
+		ids = ids[1:]
+		return id, nil
+	}))
+	if _, _, err := svc.CreateShortURL("https://example.com/active", "user-1"); err != nil {
+		fmt.Printf("Ошибка при создании URL: %v\n", err)
+		return
+	}
+	if _, _, err := svc.CreateShortURL("https://example.com/gone", "user-1"); err != nil {
+		fmt.Printf("Ошибка при создании URL: %v\n", err)
+		return
+	}
+	if err := svc.BatchDelete("user-1", []string{"gone0002"}); err != nil {
+		fmt.Printf("Ошибка при удалении URL: %v\n", err)
+		return
+	}
+
+	// Регистрируем обработчик за проверкой доверенной подсети
+	r.With(middleware.TrustedSubnetMiddleware("10.0.0.0/8", zap.NewNop())).Post("/api/internal/resolve", appInstance.HandleResolve)
+
+	// Создаём HTTP запрос из доверенной подсети
+	req := httptest.NewRequest("POST", "/api/internal/resolve", strings.NewReader(`["gone0002","active01","missing1"]`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Real-IP", "10.0.0.5")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	// Проверяем результат
+	fmt.Printf("Статус код: %d\n", w.Code)
+	fmt.Println(w.Body.String())
+
+	// Output:
+	// Статус код: 200
+	// [{"id":"gone0002","status":"deleted","url":"https://example.com/gone"},{"id":"active01","status":"ok","url":"https://example.com/active"},{"id":"missing1","status":"not_found"}]
+}
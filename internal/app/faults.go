@@ -0,0 +1,91 @@
+package app
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tempizhere/goshorty/internal/repository"
+	"go.uber.org/zap"
+)
+
+// FaultRuleRequest описывает сбои одного метода хранилища в запросе на "/api/internal/faults"
+type FaultRuleRequest struct {
+	ErrorRate  float64 `json:"error_rate"`            // Вероятность сбоя, от 0 до 1
+	ExistsRate float64 `json:"exists_rate,omitempty"` // Вероятность ErrURLExists для Save и SaveURL, от 0 до 1
+	Latency    string  `json:"latency,omitempty"`     // Задержка вызова, например "200ms"
+}
+
+// FaultsRequest представляет настройки внедрения сбоев; пустой Methods отключает сбои
+type FaultsRequest struct {
+	Seed    int64                       `json:"seed,omitempty"` // Начальное значение генератора для воспроизводимых сбоев
+	Methods map[string]FaultRuleRequest `json:"methods"`        // Правила по именам методов хранилища; "*" — для всех методов
+}
+
+// HandleFaults обрабатывает POST-запросы на "/api/internal/faults" для настройки сбоев хранилища
+// Отвечает действующими настройками; доступен, только если внедрение сбоев включено в конфигурации
+func (a *App) HandleFaults(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.Contains(r.Header.Get("Content-Type"), "application/json") {
+		http.Error(w, "Content-Type must be application/json", http.StatusBadRequest)
+		return
+	}
+
+	var reqBody FaultsRequest
+	if err := decodeJSON(r.Body, &reqBody, true); err != nil {
+		http.Error(w, jsonErrorMessage(err), http.StatusBadRequest)
+		return
+	}
+
+	cfg := repository.FaultConfig{Seed: reqBody.Seed, Methods: make(map[string]repository.FaultRule, len(reqBody.Methods))}
+	for method, rule := range reqBody.Methods {
+		var latency time.Duration
+		if rule.Latency != "" {
+			parsed, err := time.ParseDuration(rule.Latency)
+			if err != nil {
+				http.Error(w, "Invalid latency for "+method, http.StatusBadRequest)
+				return
+			}
+			latency = parsed
+		}
+		cfg.Methods[method] = repository.FaultRule{ErrorRate: rule.ErrorRate, ExistsRate: rule.ExistsRate, Latency: latency}
+	}
+
+	if err := a.faults.SetConfig(cfg); err != nil {
+		if errors.Is(err, repository.ErrInvalidFaultConfig) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		a.logger.Error("Failed to set fault config", zap.Error(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	a.logger.Warn("Storage fault injection configured", zap.Int64("seed", cfg.Seed), zap.Int("methods", len(cfg.Methods)))
+
+	a.writeJSONResponse(w, http.StatusOK, faultsResponse(a.faults.Config()))
+}
+
+// faultsResponse преобразует настройки сбоев в формат ответа
+func faultsResponse(cfg repository.FaultConfig) FaultsRequest {
+	resp := FaultsRequest{Seed: cfg.Seed, Methods: make(map[string]FaultRuleRequest, len(cfg.Methods))}
+	for method, rule := range cfg.Methods {
+		resp.Methods[method] = FaultRuleRequest{
+			ErrorRate:  rule.ErrorRate,
+			ExistsRate: rule.ExistsRate,
+			Latency:    latencyString(rule.Latency),
+		}
+	}
+	return resp
+}
+
+// latencyString возвращает задержку в формате time.Duration или пустую строку для нулевой задержки
+func latencyString(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
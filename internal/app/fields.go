@@ -0,0 +1,67 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/tempizhere/goshorty/internal/models"
+)
+
+// fieldProjection задаёт поля объекта T, которые можно запросить параметром fields, и способ получить каждое из них
+// Функция поля возвращает false, если поле пустое и, как при omitempty в полном ответе, не выводится
+type fieldProjection[T any] map[string]func(T) (any, bool)
+
+// parse разбирает список полей через запятую; неизвестное поле — ошибка, повторы отбрасываются
+func (p fieldProjection[T]) parse(raw string) ([]string, error) {
+	var fields []string
+	seen := make(map[string]struct{})
+	for _, field := range splitFields(raw) {
+		if _, ok := p[field]; !ok {
+			return nil, fmt.Errorf("unknown field %q", field)
+		}
+		if _, dup := seen[field]; dup {
+			continue
+		}
+		seen[field] = struct{}{}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no fields requested")
+	}
+	return fields, nil
+}
+
+// project оставляет в каждом объекте только поля fields; отсутствующие поля не попадают в JSON совсем
+func (p fieldProjection[T]) project(items []T, fields []string) []map[string]any {
+	projected := make([]map[string]any, len(items))
+	for i, item := range items {
+		obj := make(map[string]any, len(fields))
+		for _, field := range fields {
+			if value, ok := p[field](item); ok {
+				obj[field] = value
+			}
+		}
+		projected[i] = obj
+	}
+	return projected
+}
+
+// splitFields разбирает значение параметра fields, отбрасывая пробелы и пустые элементы
+func splitFields(raw string) []string {
+	var fields []string
+	for _, field := range strings.Split(raw, ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// userURLFields — поля ответа GET /api/user/urls, доступные для выборки параметром fields
+var userURLFields = fieldProjection[models.ShortURLResponse]{
+	"short_url":    func(u models.ShortURLResponse) (any, bool) { return u.ShortURL, true },
+	"original_url": func(u models.ShortURLResponse) (any, bool) { return u.OriginalURL, true },
+	"short_id":     func(u models.ShortURLResponse) (any, bool) { return u.ShortID, true },
+	"description":  func(u models.ShortURLResponse) (any, bool) { return u.Description, u.Description != "" },
+	"created_at":   func(u models.ShortURLResponse) (any, bool) { return u.CreatedAt, !u.CreatedAt.IsZero() },
+}
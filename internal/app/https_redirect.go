@@ -0,0 +1,39 @@
+package app
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HTTPSRedirectHandler возвращает обработчик HTTP-сервера, который перенаправляет любой запрос (301)
+// на тот же путь по HTTPS. Хост берётся из запроса, а порт — из адреса HTTPS-сервера httpsAddr;
+// стандартный порт 443 в адресе не указывается
+func HTTPSRedirectHandler(httpsAddr string) http.Handler {
+	_, port, err := net.SplitHostPort(httpsAddr)
+	if err != nil || port == "443" {
+		port = ""
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = strings.TrimSuffix(strings.TrimPrefix(r.Host, "["), "]")
+		}
+		if port != "" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+
+		target := url.URL{
+			Scheme:   "https",
+			Host:     host,
+			Path:     r.URL.Path,
+			RawPath:  r.URL.RawPath,
+			RawQuery: r.URL.RawQuery,
+		}
+		http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,38 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPSRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		httpsAddr string
+		host      string
+		method    string
+		target    string
+		want      string
+	}{
+		{name: "DefaultPort", httpsAddr: ":443", host: "short.example:80", method: http.MethodGet, target: "/abc123", want: "https://short.example/abc123"},
+		{name: "CustomPort", httpsAddr: ":8443", host: "short.example", method: http.MethodGet, target: "/api/user/urls?fields=short_url", want: "https://short.example:8443/api/user/urls?fields=short_url"},
+		{name: "POST", httpsAddr: "0.0.0.0:443", host: "short.example", method: http.MethodPost, target: "/api/shorten", want: "https://short.example/api/shorten"},
+		{name: "IPv6", httpsAddr: ":8443", host: "[::1]:8080", method: http.MethodGet, target: "/", want: "https://[::1]:8443/"},
+		{name: "IPv6DefaultPort", httpsAddr: ":443", host: "[::1]", method: http.MethodGet, target: "/x", want: "https://[::1]/x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://"+tt.host+tt.target, strings.NewReader("https://example.com"))
+			rr := httptest.NewRecorder()
+			HTTPSRedirectHandler(tt.httpsAddr).ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusMovedPermanently, rr.Code)
+			assert.Equal(t, tt.want, rr.Header().Get("Location"))
+		})
+	}
+}
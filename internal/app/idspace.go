@@ -0,0 +1,47 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultIDSpaceCheckInterval — период оценки заполненности пространства коротких ID
+const DefaultIDSpaceCheckInterval = time.Hour
+
+// WatchIDSpace сразу и затем раз в interval оценивает долю занятых коротких ID до отмены контекста
+// и логирует предупреждение, если она не меньше threshold; неположительный threshold отключает проверку
+func (a *App) WatchIDSpace(ctx context.Context, interval time.Duration, threshold float64) {
+	if interval <= 0 || threshold <= 0 {
+		return
+	}
+	a.checkIDSpace(threshold)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.checkIDSpace(threshold)
+		}
+	}
+}
+
+// checkIDSpace логирует предупреждение, если доля занятых коротких ID достигла threshold
+func (a *App) checkIDSpace(threshold float64) {
+	ratio, err := a.svc.IDSpaceFillRatio()
+	if err != nil {
+		a.logger.Error("Failed to estimate short ID space fill ratio", zap.Error(err))
+		return
+	}
+	if ratio < threshold {
+		return
+	}
+	a.logger.Warn("Short ID space is filling up, collision retries will grow; increase ShortIDLength",
+		zap.Float64("fill_ratio", ratio),
+		zap.Float64("threshold", threshold),
+		zap.Int("short_id_length", a.svc.ShortIDLength()),
+	)
+}
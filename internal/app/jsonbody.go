@@ -0,0 +1,210 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tempizhere/goshorty/internal/models"
+)
+
+// errTrailingData возвращается, если после JSON-значения в теле запроса остались данные
+var errTrailingData = errors.New("unexpected trailing data")
+
+// FieldError описывает ошибку в отдельном поле тела запроса
+type FieldError = models.FieldError
+
+// requestError описывает ошибку разбора или проверки тела запроса с перечнем полей
+type requestError struct {
+	message string
+	fields  []FieldError
+}
+
+// Error реализует интерфейс error
+func (e *requestError) Error() string {
+	return e.message
+}
+
+// decodeJSON декодирует ровно одно JSON-значение из тела запроса
+// Данные после значения (например, второй объект) отклоняются с errTrailingData,
+// в строгом режиме неизвестные поля объектов отклоняются
+func decodeJSON(r io.Reader, v interface{}, strict bool) error {
+	dec := json.NewDecoder(r)
+	if strict {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errTrailingData
+	}
+	return nil
+}
+
+// jsonErrorMessage возвращает текст ответа для ошибки декодирования тела запроса
+func jsonErrorMessage(err error) string {
+	if errors.Is(err, errTrailingData) {
+		return errTrailingData.Error()
+	}
+	return "Invalid JSON"
+}
+
+// decodeJSONObject декодирует объект из тела запроса, описывая ошибки через requestError
+func decodeJSONObject(r io.Reader, v interface{}, strict bool) error {
+	if err := decodeJSON(r, v, strict); err != nil {
+		return describeDecodeError(err, "")
+	}
+	return nil
+}
+
+// decodeJSONArray декодирует JSON-массив из тела запроса поэлементно,
+// чтобы ошибки типов и неизвестные поля указывали индекс элемента
+func decodeJSONArray[T any](r io.Reader, strict bool) ([]T, error) {
+	var raw []json.RawMessage
+	if err := decodeJSON(r, &raw, false); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, &requestError{message: "Invalid JSON", fields: []FieldError{{Error: "expected array, got " + typeErr.Value}}}
+		}
+		return nil, describeDecodeError(err, "")
+	}
+	items := make([]T, len(raw))
+	var fields []FieldError
+	for i, item := range raw {
+		if err := decodeJSON(bytes.NewReader(item), &items[i], strict); err != nil {
+			fields = append(fields, describeDecodeError(err, indexPath(i)).fields...)
+		}
+	}
+	if len(fields) > 0 {
+		return nil, &requestError{message: "Invalid JSON", fields: fields}
+	}
+	return items, nil
+}
+
+// describeDecodeError преобразует ошибку encoding/json в requestError с путём к полю
+// prefix добавляется к путям полей, например "[2]" для элемента массива
+func describeDecodeError(err error, prefix string) *requestError {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, errTrailingData):
+		return &requestError{message: errTrailingData.Error(), fields: []FieldError{{Field: prefix, Error: errTrailingData.Error()}}}
+	case errors.As(err, &syntaxErr):
+		return &requestError{message: "Invalid JSON", fields: []FieldError{{
+			Field: prefix,
+			Error: fmt.Sprintf("syntax error at offset %d: %s", syntaxErr.Offset, syntaxErr.Error()),
+		}}}
+	case errors.As(err, &typeErr):
+		return &requestError{message: "Invalid JSON", fields: []FieldError{{
+			Field: joinPath(prefix, typeErr.Field),
+			Error: fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value),
+		}}}
+	case errors.Is(err, io.EOF):
+		return &requestError{message: "Invalid JSON", fields: []FieldError{{Field: prefix, Error: "empty body"}}}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &requestError{message: "Invalid JSON", fields: []FieldError{{Field: prefix, Error: "unexpected end of JSON input"}}}
+	}
+	// encoding/json не экспортирует ошибку неизвестного поля, поэтому разбираем текст
+	if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		if unquoted, unquoteErr := strconv.Unquote(name); unquoteErr == nil {
+			name = unquoted
+		}
+		return &requestError{message: "Invalid JSON", fields: []FieldError{{Field: joinPath(prefix, name), Error: "unknown field"}}}
+	}
+	return &requestError{message: "Invalid JSON", fields: []FieldError{{Field: prefix, Error: err.Error()}}}
+}
+
+// indexPath возвращает путь к элементу массива верхнего уровня
+func indexPath(i int) string {
+	return "[" + strconv.Itoa(i) + "]"
+}
+
+// joinPath соединяет путь к элементу с именем поля
+func joinPath(prefix, field string) string {
+	switch {
+	case prefix == "":
+		return field
+	case field == "":
+		return prefix
+	default:
+		return prefix + "." + field
+	}
+}
+
+// writeRequestError отвечает 400 с описанием ошибки тела запроса
+func (a *App) writeRequestError(w http.ResponseWriter, err error) {
+	var reqErr *requestError
+	if !errors.As(err, &reqErr) {
+		reqErr = describeDecodeError(err, "")
+	}
+	a.writeJSONResponse(w, http.StatusBadRequest, ErrorResponse{Error: reqErr.message, Fields: reqErr.fields})
+}
+
+// validationFailedMessage — описание ошибки, если тело разобрано, но значения полей некорректны
+const validationFailedMessage = "Validation failed"
+
+// validateURLField проверяет обязательное поле с URL и добавляет ошибку в fields
+func validateURLField(fields []FieldError, path, value string) []FieldError {
+	if problem := models.CheckURL(value); problem != "" {
+		return append(fields, FieldError{Field: path, Error: problem})
+	}
+	return fields
+}
+
+// validateShortenRequest проверяет тело запроса на сокращение одного URL
+func validateShortenRequest(req ShortenRequest) error {
+	var validationErr *models.ValidationError
+	if err := req.Validate(); errors.As(err, &validationErr) {
+		return &requestError{message: validationFailedMessage, fields: validationErr.Fields}
+	}
+	return nil
+}
+
+// validateBatchRequests проверяет элементы пакетного запроса, указывая индекс каждого некорректного элемента
+func validateBatchRequests(reqs []models.BatchRequest) error {
+	if len(reqs) == 0 {
+		return &requestError{message: "Empty batch"}
+	}
+	var fields []FieldError
+	seen := make(map[string]struct{}, len(reqs))
+	for i, req := range reqs {
+		switch _, dup := seen[req.CorrelationID]; {
+		case req.CorrelationID == "":
+			fields = append(fields, FieldError{Field: joinPath(indexPath(i), "correlation_id"), Error: "required"})
+		case dup:
+			fields = append(fields, FieldError{Field: joinPath(indexPath(i), "correlation_id"), Error: "duplicate"})
+		}
+		seen[req.CorrelationID] = struct{}{}
+		fields = validateURLField(fields, joinPath(indexPath(i), "original_url"), req.OriginalURL)
+	}
+	if len(fields) > 0 {
+		return &requestError{message: validationFailedMessage, fields: fields}
+	}
+	return nil
+}
+
+// validateShortIDs проверяет список коротких ID для удаления; maxIDs > 0 ограничивает длину списка
+func validateShortIDs(ids []string, maxIDs int) error {
+	if maxIDs > 0 && len(ids) > maxIDs {
+		return &requestError{
+			message: validationFailedMessage,
+			fields:  []FieldError{{Field: "", Error: fmt.Sprintf("too many IDs: %d, at most %d allowed", len(ids), maxIDs)}},
+		}
+	}
+	var fields []FieldError
+	for i, id := range ids {
+		if id == "" {
+			fields = append(fields, FieldError{Field: indexPath(i), Error: "required"})
+		}
+	}
+	if len(fields) > 0 {
+		return &requestError{message: validationFailedMessage, fields: fields}
+	}
+	return nil
+}
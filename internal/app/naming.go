@@ -0,0 +1,152 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Режимы именования полей в JSON-ответах API
+const (
+	FieldNamingSnake = "snake_case" // short_url, original_url (по умолчанию)
+	FieldNamingCamel = "camelCase"  // shortUrl, longUrl — для внешних систем, ожидающих camelCase
+)
+
+// camelFieldOverrides задаёт имена camelCase, которые не выводятся из snake_case механически
+var camelFieldOverrides = map[string]string{
+	"original_url": "longUrl",
+}
+
+// camelFieldName переводит имя поля из snake_case в camelCase с учётом camelFieldOverrides
+func camelFieldName(name string) string {
+	if override, ok := camelFieldOverrides[name]; ok {
+		return override
+	}
+	if !strings.Contains(name, "_") {
+		return name
+	}
+	var b strings.Builder
+	b.Grow(len(name))
+	upper := false
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c == '_' {
+			upper = b.Len() > 0
+			continue
+		}
+		if upper && c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upper = false
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// ValidateFieldNaming проверяет, что режим именования полей поддерживается
+func ValidateFieldNaming(naming string) error {
+	switch naming {
+	case FieldNamingSnake, FieldNamingCamel:
+		return nil
+	}
+	return fmt.Errorf("unknown response field naming %q: want %s or %s", naming, FieldNamingSnake, FieldNamingCamel)
+}
+
+// renameJSONKeys переписывает ключи объектов в закодированном JSON функцией rename,
+// сохраняя порядок полей и значения (числа не проходят через float64)
+func renameJSONKeys(data []byte, rename func(string) string) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var out bytes.Buffer
+	out.Grow(len(data))
+	// Для каждого открытого контейнера: объект ли это и сколько токенов в нём уже записано
+	type container struct {
+		object bool
+		count  int
+	}
+	var stack []container
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if delim, ok := tok.(json.Delim); ok && (delim == '}' || delim == ']') {
+			stack = stack[:len(stack)-1]
+			out.WriteByte(byte(delim))
+			continue
+		}
+
+		isKey := false
+		if n := len(stack); n > 0 {
+			top := &stack[n-1]
+			if top.object {
+				// В объекте токены чередуются: ключ, значение, ключ, ...
+				isKey = top.count%2 == 0
+				if isKey && top.count > 0 {
+					out.WriteByte(',')
+				} else if !isKey {
+					out.WriteByte(':')
+				}
+			} else if top.count > 0 {
+				out.WriteByte(',')
+			}
+			top.count++
+		}
+
+		switch v := tok.(type) {
+		case json.Delim:
+			out.WriteByte(byte(v))
+			stack = append(stack, container{object: v == '{'})
+		case string:
+			if isKey {
+				v = rename(v)
+			}
+			if err := writeJSONString(&out, v); err != nil {
+				return nil, err
+			}
+		case json.Number:
+			out.WriteString(v.String())
+		case bool:
+			if v {
+				out.WriteString("true")
+			} else {
+				out.WriteString("false")
+			}
+		case nil:
+			out.WriteString("null")
+		}
+	}
+	if len(stack) > 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return out.Bytes(), nil
+}
+
+// writeJSONString кодирует строку так же, как writeJSONResponse: без экранирования HTML
+func writeJSONString(out *bytes.Buffer, s string) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(s); err != nil {
+		return err
+	}
+	// Убираем перенос строки, который добавляет json.Encoder
+	out.Truncate(out.Len() - 1)
+	return nil
+}
+
+// applyFieldNaming приводит ключи закодированного ответа к настроенному режиму именования
+// В режиме snake_case ответ возвращается без изменений
+func (a *App) applyFieldNaming(data []byte) ([]byte, error) {
+	if a.fieldNaming != FieldNamingCamel {
+		return data, nil
+	}
+	return renameJSONKeys(data, camelFieldName)
+}
@@ -0,0 +1,223 @@
+package app
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tempizhere/goshorty/internal/features"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/ui"
+)
+
+// Option настраивает необязательные параметры App
+type Option func(*App)
+
+// WithEnabledEndpoints задаёт список включённых эндпоинтов (см. константы features.Endpoint*)
+// Пустой список оставляет включёнными все эндпоинты
+func WithEnabledEndpoints(names []string) Option {
+	return func(a *App) {
+		if len(names) == 0 {
+			return
+		}
+		a.enabledEndpoints = make(map[string]struct{}, len(names))
+		for _, name := range names {
+			a.enabledEndpoints[name] = struct{}{}
+		}
+	}
+}
+
+// WithDisabledFeatures отключает маршруты указанных возможностей (см. константы пакета features)
+// Действует поверх WithEnabledEndpoints: маршрут регистрируется, только если он включён и его возможность не отключена
+func WithDisabledFeatures(names []string) Option {
+	return func(a *App) {
+		a.disabledFeatures = features.NewSet(names)
+	}
+}
+
+// WithRobotsPolicy задаёт политику индексации для /robots.txt (RobotsPolicyDeny или RobotsPolicyUI)
+// Пустое значение оставляет политику по умолчанию
+func WithRobotsPolicy(policy string) Option {
+	return func(a *App) {
+		if policy != "" {
+			a.robotsPolicy = policy
+		}
+	}
+}
+
+// WithRefQueryKey задаёт имя query-параметра, в который передаётся метка кампании из адреса вида /{id}+{suffix}
+func WithRefQueryKey(key string) Option {
+	return func(a *App) {
+		if key != "" {
+			a.refQueryKey = key
+		}
+	}
+}
+
+// WithShortURLHeader задаёт имя заголовка ответа, в котором дублируется созданный короткий URL
+// Пустое значение оставляет DefaultShortURLHeader
+func WithShortURLHeader(name string) Option {
+	return func(a *App) {
+		if name != "" {
+			a.shortURLHeader = name
+		}
+	}
+}
+
+// WithStrictJSON включает отклонение неизвестных полей в JSON-запросах на сокращение и удаление URL
+func WithStrictJSON(strict bool) Option {
+	return func(a *App) {
+		a.strictJSON = strict
+	}
+}
+
+// WithStrictPlainContentType включает проверку Content-Type для POST /:
+// принимаются только text/plain и application/x-gzip, остальные запросы получают 400
+func WithStrictPlainContentType(strict bool) Option {
+	return func(a *App) {
+		a.strictPlainType = strict
+	}
+}
+
+// WithPages включает локализованные HTML-страницы ошибок для клиентов, ожидающих HTML
+// API и клиенты без text/html в Accept по-прежнему получают текстовые ответы на английском
+func WithPages(pages *ui.Pages) Option {
+	return func(a *App) {
+		a.pages = pages
+	}
+}
+
+// WithFaultInjection включает эндпоинт POST /api/internal/faults, управляющий сбоями хранилища faults
+// Без этой опции эндпоинт не регистрируется
+func WithFaultInjection(faults *repository.FaultRepository) Option {
+	return func(a *App) {
+		a.faults = faults
+	}
+}
+
+// WithStorageErrors включает эндпоинты GET и DELETE /api/internal/errors с последними ошибками хранилища repo
+// Без этой опции эндпоинты не регистрируются
+func WithStorageErrors(repo *repository.InstrumentedRepository) Option {
+	return func(a *App) {
+		a.storageErrors = repo
+	}
+}
+
+// WithCookieMaxAge задаёт время жизни cookie с JWT, которую выдают обработчики (например, при ротации идентификатора)
+// Неположительное значение оставляет middleware.DefaultCookieMaxAge
+func WithCookieMaxAge(maxAge time.Duration) Option {
+	return func(a *App) {
+		if maxAge > 0 {
+			a.cookieMaxAge = maxAge
+		}
+	}
+}
+
+// WithMissDelay выравнивает время ответа на редирект: и существующий, и несуществующий короткий ID
+// отвечают не раньше случайного момента от maxDelay/2 до maxDelay после начала обработки
+// Неположительное значение отключает задержку
+func WithMissDelay(maxDelay time.Duration) Option {
+	return func(a *App) {
+		a.missDelay = maxDelay
+	}
+}
+
+// WithForwardedHosts разрешает строить короткие URL на домене из заголовка X-Forwarded-Host,
+// если он входит в hosts (без учёта регистра); для остальных запросов используется базовый URL сервиса
+func WithForwardedHosts(hosts []string) Option {
+	return func(a *App) {
+		if len(hosts) == 0 {
+			return
+		}
+		a.forwardedHosts = make(map[string]struct{}, len(hosts))
+		for _, host := range hosts {
+			a.forwardedHosts[strings.ToLower(host)] = struct{}{}
+		}
+	}
+}
+
+// WithTrustedSubnet открывает сведения о любых ссылках (/{id}/info) запросам, X-Real-IP которых входит в подсеть cidr
+// Пустая или некорректная подсеть оставляет сведения доступными только владельцу
+func WithTrustedSubnet(cidr string) Option {
+	return func(a *App) {
+		a.trustedSubnet = cidr
+	}
+}
+
+// WithClientIPHeader задаёт, доверять ли X-Real-IP при проверке доверенной подсети и определении клиента
+// для памяти повторов редиректа (по умолчанию доверять)
+// При trust = false подсеть проверяется по адресу соединения: без прокси клиент может подделать заголовок
+func WithClientIPHeader(trust bool) Option {
+	return func(a *App) {
+		a.trustedOpts = append(a.trustedOpts, middleware.WithClientIPHeader(trust))
+	}
+}
+
+// WithInternalTokens требует от доверенной подсети один из tokens в заголовке X-Internal-Token,
+// как и для /api/internal: без токена запрос получает сведения только о своих ссылках
+func WithInternalTokens(tokens ...string) Option {
+	return func(a *App) {
+		a.trustedOpts = append(a.trustedOpts, middleware.WithInternalTokens(tokens...))
+	}
+}
+
+// WithHealthPath монтирует проверку готовности (как /readyz) на дополнительный путь path для систем мониторинга
+// с фиксированным путём проб; путь должен проходить ValidateHealthPath. Пустое значение ничего не добавляет
+func WithHealthPath(path string) Option {
+	return func(a *App) {
+		a.healthPath = path
+	}
+}
+
+// WithMaxDeleteBatch ограничивает число ID в одном запросе DELETE /api/user/urls; запросы сверх лимита получают 400
+// Неположительное значение снимает ограничение
+func WithMaxDeleteBatch(maxIDs int) Option {
+	return func(a *App) {
+		a.maxDeleteBatch = maxIDs
+	}
+}
+
+// WithDedupStatus задаёт HTTP-статус ответа POST / и POST /api/shorten, когда URL уже сокращён
+// Поддерживаются http.StatusConflict (по умолчанию) и http.StatusOK для клиентов, считающих 409 ошибкой;
+// другие значения игнорируются. Существующий короткий URL возвращается в теле при любом статусе
+func WithDedupStatus(status int) Option {
+	return func(a *App) {
+		if status == http.StatusOK || status == http.StatusConflict {
+			a.dedupStatus = status
+		}
+	}
+}
+
+// WithRedirectMemo включает память повторов редиректа: успешное разрешение ссылки запоминается
+// на DefaultRedirectMemoTTL для пары (ID, IP клиента), и шквал одинаковых переходов обращается к хранилищу один раз.
+// Изменения ссылок сбрасывают память, пока запущен WatchRedirectMemo
+func WithRedirectMemo(enabled bool) Option {
+	return func(a *App) {
+		if enabled {
+			a.redirectMemo = newRedirectMemo(DefaultRedirectMemoTTL, DefaultRedirectMemoCapacity)
+		} else {
+			a.redirectMemo = nil
+		}
+	}
+}
+
+// WithShortenResponse задаёт режим ответа POST /api/shorten (ShortenResponseBody или ShortenResponseLocation)
+// Пустое значение оставляет ShortenResponseBody
+func WithShortenResponse(mode string) Option {
+	return func(a *App) {
+		if mode != "" {
+			a.shortenResponse = mode
+		}
+	}
+}
+
+// WithResponseFieldNaming задаёт именование полей в JSON-ответах API (FieldNamingSnake или FieldNamingCamel)
+// Пустое значение оставляет snake_case
+func WithResponseFieldNaming(naming string) Option {
+	return func(a *App) {
+		if naming != "" {
+			a.fieldNaming = naming
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package app
+
+import (
+	"expvar"
+	"net/url"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// pastedURLCleanups считает URL, принятые после очистки от обрамления и знаков препинания
+var pastedURLCleanups = expvar.NewInt("pasted_url_cleanups")
+
+// pastedURLWrappers перечисляет парные символы, которыми почтовые клиенты и мессенджеры обрамляют URL
+var pastedURLWrappers = [][2]string{
+	{`"`, `"`}, {"'", "'"}, {"`", "`"}, {"<", ">"}, {"(", ")"}, {"[", "]"},
+	{"“", "”"}, {"‘", "’"}, {"«", "»"},
+}
+
+// pastedURLTrailing перечисляет знаки препинания, которые попадают в конец URL из текста сообщения
+const pastedURLTrailing = ".,;)"
+
+// isParseableURL повторяет проверку URL, которую проходят запросы на сокращение
+func isParseableURL(s string) bool {
+	_, err := url.ParseRequestURI(s)
+	return err == nil
+}
+
+// cleanPastedURL убирает пробелы по краям, парное обрамление и знаки препинания в конце вставленного URL
+// Пробелы по краям не бывают частью URL и убираются всегда; остальная очистка выполняется, только если строка
+// не разбирается как URL, и только если её результат разбирается: корректный URL возвращается без изменений,
+// даже если оканчивается на точку или скобку — они могут быть частью адреса
+// Второе значение сообщает, была ли строка изменена
+func cleanPastedURL(raw string) (string, bool) {
+	s := strings.TrimSpace(raw)
+	for s != "" {
+		if isParseableURL(s) {
+			return s, s != raw
+		}
+		next := unwrapPastedURL(s)
+		if next == s && strings.ContainsAny(s[len(s)-1:], pastedURLTrailing) {
+			next = s[:len(s)-1]
+		}
+		if next == s {
+			break
+		}
+		s = strings.TrimSpace(next)
+	}
+	return raw, false
+}
+
+// unwrapPastedURL снимает один уровень парного обрамления; строка без обрамления возвращается как есть
+func unwrapPastedURL(s string) string {
+	for _, pair := range pastedURLWrappers {
+		if len(s) >= len(pair[0])+len(pair[1]) && strings.HasPrefix(s, pair[0]) && strings.HasSuffix(s, pair[1]) {
+			return s[len(pair[0]) : len(s)-len(pair[1])]
+		}
+	}
+	return s
+}
+
+// normalizeURL очищает вставленный пользователем URL и отмечает очистку в журнале и метриках
+func (a *App) normalizeURL(raw string) string {
+	cleaned, changed := cleanPastedURL(raw)
+	if changed {
+		pastedURLCleanups.Add(1)
+		a.logger.Debug("Pasted URL cleaned up", zap.String("raw", raw), zap.String("url", cleaned))
+	}
+	return cleaned
+}
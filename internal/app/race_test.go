@@ -0,0 +1,6 @@
+//go:build race
+
+package app
+
+// raceEnabled сообщает, что тесты собраны с детектором гонок, который многократно увеличивает выделения памяти
+const raceEnabled = true
@@ -0,0 +1,216 @@
+package app
+
+import (
+	"container/list"
+	"context"
+	"expvar"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tempizhere/goshorty/internal/events"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/models"
+)
+
+// redirectMemoHits считает редиректы, обслуженные из памяти повторов без обращения к хранилищу
+var redirectMemoHits = expvar.NewInt("redirect_memo_hits")
+
+// Параметры памяти повторов редиректа
+const (
+	DefaultRedirectMemoTTL      = time.Second // Сколько помнится успешное разрешение ссылки для одного клиента
+	DefaultRedirectMemoCapacity = 10000       // Максимальное число пар (ID, IP) в памяти
+)
+
+// redirectMemoKey — ссылка и IP-адрес клиента, для которого запомнено разрешение
+type redirectMemoKey struct {
+	id string
+	ip string
+}
+
+// redirectLookup — одно обращение к хранилищу, результат которого получают все одновременные повторы
+type redirectLookup struct {
+	done  chan struct{}
+	url   models.URL
+	found bool
+	err   error
+}
+
+// redirectMemoEntry — запомненное разрешение ссылки или обращение к хранилищу, которое ещё выполняется
+type redirectMemoEntry struct {
+	key       redirectMemoKey
+	lookup    *redirectLookup
+	expiresAt time.Time     // Нулевое значение, пока обращение не завершилось
+	elem      *list.Element // Элемент expiry; nil, пока обращение не завершилось
+}
+
+// redirectMemo коротко запоминает успешные разрешения ссылок по паре (ID, IP клиента), чтобы шквал одинаковых
+// запросов (например, от почтовых сканеров) обращался к хранилищу один раз. Промахи и удалённые ссылки не запоминаются
+type redirectMemo struct {
+	mu       sync.Mutex
+	entries  map[redirectMemoKey]*redirectMemoEntry
+	expiry   *list.List // Завершённые записи от истекающих раньше к истекающим позже: время жизни у всех одно
+	ttl      time.Duration
+	capacity int
+	now      func() time.Time
+}
+
+// newRedirectMemo создаёт память повторов с временем жизни записей ttl и не более capacity записями
+func newRedirectMemo(ttl time.Duration, capacity int) *redirectMemo {
+	return &redirectMemo{
+		entries:  make(map[redirectMemoKey]*redirectMemoEntry),
+		expiry:   list.New(),
+		ttl:      ttl,
+		capacity: capacity,
+		now:      time.Now,
+	}
+}
+
+// resolve возвращает запомненное разрешение ссылки для клиента или выполняет lookup, объединяя одновременные повторы
+func (m *redirectMemo) resolve(id, ip string, lookup func(string) (models.URL, bool, error)) (models.URL, bool, error) {
+	key := redirectMemoKey{id: id, ip: ip}
+	m.mu.Lock()
+	if e, ok := m.entries[key]; ok {
+		if e.expiresAt.IsZero() {
+			m.mu.Unlock()
+			<-e.lookup.done
+			redirectMemoHits.Add(1)
+			return e.lookup.url, e.lookup.found, e.lookup.err
+		}
+		if m.now().Before(e.expiresAt) {
+			m.mu.Unlock()
+			redirectMemoHits.Add(1)
+			return e.lookup.url, e.lookup.found, nil
+		}
+		m.remove(e)
+	}
+	m.purgeExpired()
+	if len(m.entries) >= m.capacity {
+		// Освобождаем место, забывая разрешение, которое истекло бы первым
+		if front := m.expiry.Front(); front != nil {
+			m.remove(front.Value.(*redirectMemoEntry))
+		}
+	}
+	if len(m.entries) >= m.capacity {
+		// Память заполнена одновременными клиентами: обслуживаем запрос без неё
+		m.mu.Unlock()
+		return lookup(id)
+	}
+	call := &redirectLookup{done: make(chan struct{})}
+	m.entries[key] = &redirectMemoEntry{key: key, lookup: call}
+	m.mu.Unlock()
+
+	call.url, call.found, call.err = lookup(id)
+
+	m.mu.Lock()
+	// Запись могла быть сброшена изменением ссылки, пока шло обращение: тогда результат не запоминается
+	if e, ok := m.entries[key]; ok && e.lookup == call {
+		if call.err == nil && call.found && !call.url.DeletedFlag {
+			e.expiresAt = m.now().Add(m.ttl)
+			e.elem = m.expiry.PushBack(e)
+		} else {
+			m.remove(e)
+		}
+	}
+	m.mu.Unlock()
+	close(call.done)
+	return call.url, call.found, call.err
+}
+
+// remove забывает запись; вызывается под m.mu
+func (m *redirectMemo) remove(e *redirectMemoEntry) {
+	delete(m.entries, e.key)
+	if e.elem != nil {
+		m.expiry.Remove(e.elem)
+	}
+}
+
+// purgeExpired удаляет записи с истёкшим сроком с начала expiry, не просматривая остальные; вызывается под m.mu
+func (m *redirectMemo) purgeExpired() {
+	now := m.now()
+	for front := m.expiry.Front(); front != nil; front = m.expiry.Front() {
+		e := front.Value.(*redirectMemoEntry)
+		if now.Before(e.expiresAt) {
+			return
+		}
+		m.remove(e)
+	}
+}
+
+// invalidate забывает разрешения ссылки id для всех клиентов
+func (m *redirectMemo) invalidate(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, e := range m.entries {
+		if key.id == id {
+			m.remove(e)
+		}
+	}
+}
+
+// clear забывает все разрешения
+func (m *redirectMemo) clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	clear(m.entries)
+	m.expiry.Init()
+}
+
+// len возвращает число запомненных и выполняющихся разрешений
+func (m *redirectMemo) len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries)
+}
+
+// lookupRedirect разрешает ссылку для редиректа, при включённой памяти повторов — через неё
+// Клиент определяется так же, как при проверке доверенной подсети (см. WithClientIPHeader)
+func (a *App) lookupRedirect(r *http.Request, id string) (models.URL, bool, error) {
+	if a.redirectMemo == nil {
+		return a.svc.Get(id)
+	}
+	return a.redirectMemo.resolve(id, middleware.ClientIP(r, a.trustedOpts...), a.svc.Get)
+}
+
+// WatchRedirectMemo сбрасывает запомненные разрешения ссылок по событиям их изменения до отмены контекста
+// Без памяти повторов (WithRedirectMemo) или рассылки событий сервиса ничего не делает:
+// тогда устаревшее разрешение живёт не дольше времени жизни записи
+func (a *App) WatchRedirectMemo(ctx context.Context) {
+	notifier := a.svc.Events()
+	if a.redirectMemo == nil || notifier == nil {
+		return
+	}
+	for {
+		_, changes, cancel := notifier.Subscribe(0)
+		a.applyLinkChanges(ctx, changes)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		// Подписка отстала и была закрыта: пропущенные события неизвестны, поэтому память сбрасывается целиком
+		a.redirectMemo.clear()
+	}
+}
+
+// applyLinkChanges сбрасывает разрешения изменённых ссылок, пока канал событий открыт и контекст не отменён
+func (a *App) applyLinkChanges(ctx context.Context, changes <-chan events.Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-changes:
+			if !ok {
+				return
+			}
+			switch {
+			case e.Type == events.Created:
+				// Промахи не запоминаются, поэтому новая ссылка ничего не сбрасывает
+			case e.ShortID != "":
+				a.redirectMemo.invalidate(e.ShortID)
+			default:
+				// Удаление по хосту не перечисляет ссылки
+				a.redirectMemo.clear()
+			}
+		}
+	}
+}
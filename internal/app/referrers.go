@@ -0,0 +1,36 @@
+package app
+
+import (
+	"expvar"
+
+	"go.uber.org/zap"
+)
+
+// maxPendingReferrers ограничивает число одновременных фоновых записей источников переходов,
+// чтобы поток редиректов при медленном хранилище не порождал неограниченное число горутин
+const maxPendingReferrers = 64
+
+// referrerDrops считает переходы, источник которых не записан из-за занятых слотов
+var referrerDrops = expvar.NewInt("referrer_writes_dropped")
+
+// recordReferrerAsync учитывает источник перехода в фоне, чтобы запись не задерживала редирект
+// Если все слоты заняты, переход не учитывается в статистике источников
+func (a *App) recordReferrerAsync(id, referrer string) {
+	select {
+	case a.referrerSlots <- struct{}{}:
+	default:
+		referrerDrops.Add(1)
+		return
+	}
+	go func() {
+		defer func() { <-a.referrerSlots }()
+		a.recordReferrer(id, referrer)
+	}()
+}
+
+// recordReferrer учитывает источник перехода
+func (a *App) recordReferrer(id, referrer string) {
+	if err := a.svc.RecordReferrer(id, referrer); err != nil {
+		a.logger.Warn("Failed to record referrer", zap.String("short_id", id), zap.Error(err))
+	}
+}
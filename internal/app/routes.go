@@ -0,0 +1,132 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/tempizhere/goshorty/internal/features"
+	"go.uber.org/zap"
+)
+
+// endpointEnabled проверяет, включён ли эндпоинт; пустой список включает все, а пустое имя включено всегда
+func (a *App) endpointEnabled(name string) bool {
+	if len(a.enabledEndpoints) == 0 || name == "" {
+		return true
+	}
+	_, ok := a.enabledEndpoints[name]
+	return ok
+}
+
+// routeEnabled проверяет по таблице features.Routes, что эндпоинт маршрута ("МЕТОД /полный/шаблон") включён,
+// а его возможность не отключена; маршрут, отсутствующий в таблице, включён
+func (a *App) routeEnabled(route string) bool {
+	entry := features.Routes[route]
+	return a.endpointEnabled(entry.Endpoint) && (entry.Feature == "" || !a.disabledFeatures.Disabled(entry.Feature))
+}
+
+// routeHandler — обработчик маршрута внутри группы
+type routeHandler struct {
+	method  string
+	pattern string
+	handler http.HandlerFunc
+}
+
+// handle регистрирует обработчик, если маршрут включён (см. routeEnabled)
+func (a *App) handle(r chi.Router, method, pattern string, h http.HandlerFunc) {
+	if a.routeEnabled(method + " " + pattern) {
+		r.Method(method, pattern, h)
+	}
+}
+
+// RegisterRoutes регистрирует обработчики App в маршрутизаторе, пропуская отключённые эндпоинты
+// Отключённые эндпоинты и маршруты отключённых возможностей не регистрируются вовсе, поэтому маршрутизатор
+// отвечает на них 404 (или 405, если по тому же пути остались другие методы)
+// internalMiddlewares применяются к группе /api/internal и к /api/user/switch (например, проверка доверенной подсети)
+func (a *App) RegisterRoutes(r chi.Router, internalMiddlewares ...func(http.Handler) http.Handler) {
+	for name := range a.enabledEndpoints {
+		if !features.KnownEndpoint(name) {
+			a.logger.Warn("Unknown endpoint in enabled endpoints list", zap.String("endpoint", name))
+		}
+	}
+	for _, name := range a.disabledFeatures.Unknown() {
+		a.logger.Warn("Unknown feature in disabled endpoints list", zap.String("feature", name))
+	}
+
+	methodNotAllowed := func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+
+	// Служебные файлы регистрируются до маршрута /{id}, чтобы не искать их в хранилище
+	a.handle(r, http.MethodGet, "/robots.txt", a.HandleRobots)
+	a.handle(r, http.MethodGet, "/favicon.ico", a.HandleFavicon)
+
+	a.handle(r, http.MethodPost, "/", a.HandlePostURL)
+	a.handle(r, http.MethodGet, "/", methodNotAllowed)
+	// Сведения о ссылке регистрируются до /{id}, а метка "info" зарезервирована в адресах /{id}+{suffix}
+	a.handle(r, http.MethodGet, "/{id}/info", a.HandleLinkInfo)
+	if a.routeEnabled("GET /{id}") {
+		// Путь редиректа повторяет шаблон коротких URL сервиса, по умолчанию /{id}
+		prefix, suffix := a.svc.URLBuilder().Path()
+		r.Get(prefix+"{id}"+suffix, a.HandleGetURL)
+	}
+	a.handle(r, http.MethodPost, "/api/shorten", a.HandleJSONShorten)
+	a.handle(r, http.MethodGet, "/api/shorten", methodNotAllowed)
+	a.handle(r, http.MethodGet, "/api/expand/{id}", a.HandleJSONExpand)
+	a.handle(r, http.MethodGet, "/ping", a.HandlePing)
+	a.handle(r, http.MethodGet, "/readyz", a.HandleReadyz)
+	a.handle(r, http.MethodPost, "/api/shorten/batch", a.HandleBatchShorten)
+	a.handle(r, http.MethodGet, "/api/user/urls", a.HandleUserURLs)
+	a.handle(r, http.MethodDelete, "/api/user/urls", a.HandleBatchDeleteURLs)
+	a.handle(r, http.MethodGet, "/api/user/stats", a.HandleUserStats)
+	a.handle(r, http.MethodPost, "/api/user/logout", a.HandleLogout)
+	a.handle(r, http.MethodPost, "/api/user/rotate", a.HandleRotateUser)
+	a.handle(r, http.MethodPost, "/api/urls/{id}/claim", a.HandleClaimURL)
+	a.handle(r, http.MethodPut, "/api/urls/{id}", a.HandleUpdateURL)
+	a.handle(r.With(internalMiddlewares...), http.MethodPost, "/api/user/switch", a.HandleSwitchUser)
+
+	// Маршруты для внутренних API с проверкой доверенной подсети; группа создаётся, только если включён хотя бы один из них
+	internal := []routeHandler{
+		{http.MethodGet, "/stats", a.HandleStats},
+		{http.MethodPost, "/resolve", a.HandleResolve},
+		{http.MethodGet, "/users/top", a.HandleTopUsers},
+		{http.MethodGet, "/hotlinks", a.HandleHotLinks},
+		{http.MethodGet, "/metrics", a.HandleMetrics},
+		{http.MethodGet, "/url-owners", a.HandleURLOwners},
+		{http.MethodPost, "/flag-nsfw", a.HandleFlagNSFW},
+		{http.MethodPost, "/reserve", a.HandleReserve},
+		{http.MethodGet, "/events/stream", a.HandleEventsStream},
+	}
+	if a.faults != nil {
+		internal = append(internal, routeHandler{http.MethodPost, "/faults", a.HandleFaults})
+	}
+	if a.storageErrors != nil {
+		internal = append(internal,
+			routeHandler{http.MethodGet, "/errors", a.HandleStorageErrors},
+			routeHandler{http.MethodDelete, "/errors", a.HandleClearStorageErrors})
+	}
+	var enabled []routeHandler
+	for _, rh := range internal {
+		if a.routeEnabled(rh.method + " /api/internal" + rh.pattern) {
+			enabled = append(enabled, rh)
+		}
+	}
+	if len(enabled) > 0 {
+		r.Route("/api/internal", func(r chi.Router) {
+			for _, mw := range internalMiddlewares {
+				r.Use(mw)
+			}
+			for _, rh := range enabled {
+				r.Method(rh.method, rh.pattern, rh.handler)
+			}
+		})
+	}
+
+	// Дополнительный путь проверки готовности регистрируется последним и не перекрывает существующие маршруты
+	if a.healthPath != "" {
+		if r.Match(chi.NewRouteContext(), http.MethodGet, a.healthPath) {
+			a.logger.Warn("Health path collides with an existing route, skipping", zap.String("path", a.healthPath))
+			return
+		}
+		r.Get(a.healthPath, a.HandleReadyz)
+	}
+}
@@ -0,0 +1,203 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/features"
+	"github.com/tempizhere/goshorty/internal/middleware"
+	"github.com/tempizhere/goshorty/internal/repository"
+)
+
+func TestApp_RegisterRoutes_EnabledEndpoints(t *testing.T) {
+	_, repo, svc, _, logger, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	_, err := repo.Save("testID", "https://example.com", "user1")
+	assert.NoError(t, err)
+
+	// Публичное зеркало только для чтения: включён лишь редирект
+	appInstance := NewApp(svc, nil, logger, WithEnabledEndpoints([]string{features.EndpointRedirect}))
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware(svc, logger))
+	appInstance.RegisterRoutes(r)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/testID", nil))
+	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code, "Redirect should stay enabled")
+	assert.Equal(t, "https://example.com", rr.Header().Get("Location"))
+
+	req := createTestRequest(http.MethodPost, "/api/shorten", "application/json", strings.NewReader(`{"url":"https://new.example.com"}`))
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Disabled POST /api/shorten should be unroutable")
+
+	req = createTestRequest(http.MethodPost, "/", "text/plain", strings.NewReader("https://new.example.com"))
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Disabled POST / should be unroutable")
+}
+
+func TestApp_RegisterRoutes_AllEnabledByDefault(t *testing.T) {
+	_, _, svc, appInstance, logger, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	r := chi.NewRouter()
+	r.Use(middleware.AuthMiddleware(svc, logger))
+	appInstance.RegisterRoutes(r)
+
+	req := createTestRequest(http.MethodPost, "/api/shorten", "application/json", strings.NewReader(`{"url":"https://new.example.com"}`))
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestApp_RegisterRoutes_FeatureTableCoverage(t *testing.T) {
+	_, repo, svc, _, logger, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	// Регистрируем все маршруты, включая необязательные эндпоинты сбоев и журнала ошибок хранилища
+	appInstance := NewApp(svc, nil, logger,
+		WithFaultInjection(repository.WithFaults(repo, repository.FaultConfig{})),
+		WithStorageErrors(repository.Instrument(repo)),
+	)
+	r := chi.NewRouter()
+	appInstance.RegisterRoutes(r)
+
+	registered := make(map[string]struct{})
+	err := chi.Walk(r, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		registered[method+" "+route] = struct{}{}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// Каждый шаблон маршрута chi обязан быть объявлен в таблице, а таблица не должна содержать несуществующих маршрутов
+	for route := range registered {
+		_, declared := features.Routes[route]
+		assert.True(t, declared, "route %q is missing from features.Routes", route)
+	}
+	for route, entry := range features.Routes {
+		_, ok := registered[route]
+		assert.True(t, ok, "features.Routes declares unregistered route %q", route)
+		if entry.Feature != "" {
+			_, known := features.Known[entry.Feature]
+			assert.True(t, known, "route %q refers to unknown feature %q", route, entry.Feature)
+		}
+	}
+}
+
+func TestApp_RegisterRoutes_RouteTable(t *testing.T) {
+	_, repo, svc, _, logger, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	walk := func(opts ...Option) map[string]struct{} {
+		opts = append(opts,
+			WithFaultInjection(repository.WithFaults(repo, repository.FaultConfig{})),
+			WithStorageErrors(repository.Instrument(repo)),
+		)
+		r := chi.NewRouter()
+		NewApp(svc, nil, logger, opts...).RegisterRoutes(r)
+		registered := make(map[string]struct{})
+		assert.NoError(t, chi.Walk(r, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+			registered[method+" "+route] = struct{}{}
+			return nil
+		}))
+		return registered
+	}
+
+	// Список включённых эндпоинтов и список отключённых возможностей применяются по одной таблице features.Routes
+	for route, entry := range features.Routes {
+		if entry.Endpoint != "" {
+			registered := walk(WithEnabledEndpoints([]string{entry.Endpoint}))
+			assert.Contains(t, registered, route, "endpoint %q should enable %q", entry.Endpoint, route)
+			for other := range registered {
+				if e := features.Routes[other].Endpoint; e != "" {
+					assert.Equal(t, entry.Endpoint, e, "endpoint %q should not enable %q", entry.Endpoint, other)
+				}
+			}
+		}
+		if entry.Feature != "" {
+			assert.NotContains(t, walk(WithDisabledFeatures([]string{entry.Feature})), route, "feature %q should disable %q", entry.Feature, route)
+		}
+	}
+}
+
+func TestApp_RegisterRoutes_DisabledFeatures(t *testing.T) {
+	_, repo, svc, _, logger, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	_, err := repo.Save("testID", "https://example.com", "user1")
+	assert.NoError(t, err)
+	token, err := svc.GenerateJWT("user1")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		disabled []string
+		want     map[string]int // "МЕТОД путь" -> ожидаемый статус
+	}{
+		{
+			name:     "Redirect-only instance",
+			disabled: []string{features.Shorten, features.Batch, features.Delete, features.UserURLs, features.Expand, features.Stats},
+			want: map[string]int{
+				"GET /testID":                 http.StatusTemporaryRedirect,
+				"POST /":                      http.StatusNotFound,
+				"POST /api/shorten":           http.StatusNotFound,
+				"POST /api/shorten/batch":     http.StatusNotFound,
+				"GET /api/user/urls":          http.StatusNotFound,
+				"DELETE /api/user/urls":       http.StatusNotFound,
+				"GET /api/expand/testID":      http.StatusNotFound,
+				"GET /api/user/stats":         http.StatusNotFound,
+				"POST /api/urls/testID/claim": http.StatusNotFound,
+				"PUT /api/urls/testID":        http.StatusNotFound,
+				"POST /api/internal/reserve":  http.StatusNotFound,
+				"GET /readyz":                 http.StatusOK,
+			},
+		},
+		{
+			name:     "Ingest node without deletion",
+			disabled: []string{features.Delete, "unknown_feature"},
+			want: map[string]int{
+				"POST /api/shorten":      http.StatusCreated,
+				"GET /api/user/urls":     http.StatusOK,
+				"DELETE /api/user/urls":  http.StatusMethodNotAllowed,
+				"GET /api/expand/testID": http.StatusOK,
+			},
+		},
+	}
+
+	bodies := map[string]string{
+		"POST /":                  "https://new.example.com",
+		"POST /api/shorten":       `{"url":"https://other.example.com"}`,
+		"POST /api/shorten/batch": `[{"correlation_id":"1","original_url":"https://batch.example.com"}]`,
+		"DELETE /api/user/urls":   `["testID"]`,
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appInstance := NewApp(svc, nil, logger, WithDisabledFeatures(tt.disabled))
+			r := chi.NewRouter()
+			r.Use(middleware.AuthMiddleware(svc, logger))
+			appInstance.RegisterRoutes(r)
+
+			for route, wantStatus := range tt.want {
+				method, path, _ := strings.Cut(route, " ")
+				req := createTestRequest(method, path, "application/json", strings.NewReader(bodies[route]))
+				if method == http.MethodPost && path == "/" {
+					req.Header.Set("Content-Type", "text/plain")
+				}
+				req.AddCookie(&http.Cookie{Name: middleware.AuthCookieName, Value: token})
+				rr := httptest.NewRecorder()
+				r.ServeHTTP(rr, req)
+				assert.Equal(t, wantStatus, rr.Code, route)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package app
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Режимы создания ссылки POST /api/shorten для уже сокращённого URL, задаются параметром ?mode=.
+// По умолчанию возвращается существующая ссылка со статусом WithDedupStatus.
+// URL сравнивается после очистки вставленного текста (см. cleanPastedURL) и больше никак не приводится:
+// адреса, отличающиеся регистром или завершающим слэшем, считаются разными
+const (
+	ShortenModeCreateOnly = "create_only" // Не создавать ссылку: 409 с существующей ссылкой и кодом ErrorCodeCreateOnly
+	ShortenModeForceNew   = "force_new"   // Всегда создавать новую ссылку; хранилище должно реализовать repository.DuplicateSaver
+)
+
+// preferCreateOnly — значение заголовка Prefer, равносильное ?mode=create_only
+const preferCreateOnly = "create-only"
+
+// ErrorCodeCreateOnly — код ошибки в ответе на сокращение существующего URL в режиме ShortenModeCreateOnly
+const ErrorCodeCreateOnly = "already_exists_create_only"
+
+// ErrorCodeHeader — заголовок с кодом ошибки сокращения в режиме ShortenResponseLocation, где нет тела ответа
+const ErrorCodeHeader = "X-Error-Code"
+
+// shortenModeOf возвращает режим создания из ?mode= или заголовка Prefer: create-only; пустая строка — режим по умолчанию
+// false, если режим в ?mode= неизвестен
+func shortenModeOf(r *http.Request) (string, bool) {
+	mode := r.URL.Query().Get("mode")
+	switch mode {
+	case "":
+		if hasPreference(r, preferCreateOnly) {
+			return ShortenModeCreateOnly, true
+		}
+		return "", true
+	case ShortenModeCreateOnly, ShortenModeForceNew:
+		return mode, true
+	}
+	return "", false
+}
+
+// hasPreference сообщает, передал ли клиент значение pref в одном из заголовков Prefer
+func hasPreference(r *http.Request, pref string) bool {
+	for _, header := range r.Header.Values("Prefer") {
+		for _, p := range strings.Split(header, ",") {
+			if strings.TrimSpace(p) == pref {
+				return true
+			}
+		}
+	}
+	return false
+}
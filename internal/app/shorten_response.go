@@ -0,0 +1,21 @@
+package app
+
+import "fmt"
+
+// Режимы ответа POST /api/shorten
+const (
+	ShortenResponseBody     = "body"     // JSON с коротким URL в теле (по умолчанию)
+	ShortenResponseLocation = "location" // Пустое тело, короткий URL в заголовке Location
+)
+
+// ClaimTokenHeader — заголовок с токеном владения анонимной ссылки в режиме ShortenResponseLocation, где нет тела ответа
+const ClaimTokenHeader = "X-Claim-Token"
+
+// ValidateShortenResponse проверяет, что режим ответа POST /api/shorten поддерживается
+func ValidateShortenResponse(mode string) error {
+	switch mode {
+	case ShortenResponseBody, ShortenResponseLocation:
+		return nil
+	}
+	return fmt.Errorf("unknown shorten response mode %q: want %s or %s", mode, ShortenResponseBody, ShortenResponseLocation)
+}
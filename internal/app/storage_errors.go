@@ -0,0 +1,39 @@
+package app
+
+import (
+	"net/http"
+	"time"
+)
+
+// StorageError описывает неудачный вызов хранилища в ответе "/api/internal/errors"
+type StorageError struct {
+	Time     time.Time `json:"time"`     // Время завершения вызова
+	Method   string    `json:"method"`   // Имя метода хранилища
+	Error    string    `json:"error"`    // Текст ошибки без URL и параметров подключения к базе
+	Duration string    `json:"duration"` // Длительность вызова, например "1.5ms"
+}
+
+// HandleStorageErrors обрабатывает GET-запросы на "/api/internal/errors" и возвращает последние ошибки хранилища
+// этого экземпляра от новых к старым
+func (a *App) HandleStorageErrors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	recent := a.storageErrors.RecentErrors()
+	resp := make([]StorageError, 0, len(recent))
+	for _, e := range recent {
+		resp = append(resp, StorageError{Time: e.Time, Method: e.Method, Error: e.Error, Duration: e.Duration.String()})
+	}
+	a.writeJSONResponse(w, http.StatusOK, resp)
+}
+
+// HandleClearStorageErrors обрабатывает DELETE-запросы на "/api/internal/errors" и очищает журнал ошибок хранилища
+func (a *App) HandleClearStorageErrors(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.storageErrors.ClearRecentErrors()
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,35 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// userURLsETag строит слабый ETag списка ссылок пользователя из ревизии его ссылок
+// В хеш входят пользователь и всё, что меняет представление списка без изменения ссылок:
+// параметры запроса (fields, tag) и заголовки прокси, по которым переписывается хост коротких URL
+func userURLsETag(revision, userID string, r *http.Request) string {
+	h := sha256.New()
+	for _, part := range []string{userID, r.URL.RawQuery, r.Header.Get("X-Forwarded-Host"), r.Header.Get("X-Forwarded-Proto")} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return `W/"` + revision + "-" + hex.EncodeToString(h.Sum(nil)[:8]) + `"`
+}
+
+// etagMatches сообщает, совпадает ли etag с одним из значений If-None-Match при слабом сравнении
+func etagMatches(ifNoneMatch, etag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
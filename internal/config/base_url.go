@@ -0,0 +1,66 @@
+package config
+
+import (
+	"net"
+	"net/url"
+)
+
+// BaseURLCheck — результат сверки BaseURL с адресом HTTP-сервера при запуске
+type BaseURLCheck int
+
+const (
+	BaseURLConsistent BaseURLCheck = iota // BaseURL совпадает с RunAddr по порту или сверка не требуется
+	BaseURLDerived                        // BaseURL не задан и выведен из заданного RunAddr
+	BaseURLMismatch                       // BaseURL и RunAddr заданы явно, но их порты расходятся
+)
+
+// baseURLSetExplicitly сообщает, задан ли BaseURL явно: переменной окружения, флагом или в файле конфигурации
+func baseURLSetExplicitly(envSet, flagSet bool, configFile *ConfigFile) bool {
+	return envSet || flagSet || (configFile != nil && configFile.BaseURL != "")
+}
+
+// reconcileBaseURL сверяет BaseURL с RunAddr. baseURLSet и runAddrSet сообщают, заданы ли значения явно
+// (см. baseURLSetExplicitly). Если задан только RunAddr, BaseURL выводится из него,
+// иначе расхождение портов лишь отмечается: за прокси оно бывает намеренным
+func reconcileBaseURL(baseURL, runAddr string, https, baseURLSet, runAddrSet bool) (string, BaseURLCheck) {
+	host, port, err := net.SplitHostPort(runAddr)
+	if err != nil || !runAddrSet {
+		return baseURL, BaseURLConsistent
+	}
+	if !baseURLSet {
+		if host == "" || net.ParseIP(host).IsUnspecified() {
+			host = "localhost"
+		}
+		scheme := "http"
+		if https {
+			scheme = "https"
+		}
+		derived := scheme + "://" + net.JoinHostPort(host, port)
+		if derived == baseURL {
+			return baseURL, BaseURLConsistent
+		}
+		return derived, BaseURLDerived
+	}
+	if basePort := urlPort(baseURL); basePort != "" && basePort != port {
+		return baseURL, BaseURLMismatch
+	}
+	return baseURL, BaseURLConsistent
+}
+
+// urlPort возвращает порт URL, для URL без порта — порт его схемы по умолчанию
+func urlPort(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	if port := u.Port(); port != "" {
+		return port
+	}
+	switch u.Scheme {
+	case "https":
+		return "443"
+	case "http":
+		return "80"
+	}
+	return ""
+}
@@ -8,32 +8,237 @@ import (
 	"flag"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Config содержит настройки приложения для сервиса сокращения URL
 type Config struct {
-	RunAddr         string // Адрес и порт для запуска HTTP сервера
-	GRPCAddr        string // Адрес и порт для запуска gRPC сервера
-	BaseURL         string // Базовый URL для генерации коротких ссылок
-	FileStoragePath string // Путь к файлу для хранения URL
-	DatabaseDSN     string // Строка подключения к базе данных PostgreSQL
-	JWTSecret       string // Секретный ключ для подписи JWT токенов
-	EnableHTTPS     bool   // Флаг включения HTTPS
-	EnableGRPC      bool   // Флаг включения gRPC сервера
-	TrustedSubnet   string // Доверенная подсеть в формате CIDR для доступа к внутренним API
+	RunAddr          string        // Адрес и порт для запуска HTTP сервера
+	GRPCAddr         string        // Адрес и порт для запуска gRPC сервера
+	BaseURL          string        // Базовый URL для генерации коротких ссылок
+	FileStoragePath  string        // Путь к файлу для хранения URL
+	DatabaseDSN      string        // Строка подключения к базе данных PostgreSQL
+	JWTSecret        string        // Секретный ключ для подписи JWT токенов
+	EnableHTTPS      bool          // Флаг включения HTTPS
+	EnableGRPC       bool          // Флаг включения gRPC сервера
+	TrustedSubnet    string        // Доверенная подсеть в формате CIDR для доступа к внутренним API
+	RefQueryKey      string        // Имя query-параметра для метки кампании из адреса вида /{id}+{suffix}
+	PreShutdownDelay time.Duration // Задержка перед остановкой сервера, в течение которой /readyz отвечает 503
+	CookieMaxAge     time.Duration // Время жизни cookie с JWT, не зависящее от срока действия токена
+	GRPCRealIPKey    string        // Ключ метаданных gRPC с IP-адресом клиента за прокси; игнорируется при TrustClientIPHeader=false
+	EnabledEndpoints []string      // Список включённых эндпоинтов; пустой список включает все
+
+	GRPCRequestIDKey string // Ключ метаданных gRPC с идентификатором запроса; без него идентификатор генерируется
+
+	DisabledEndpoints []string // Отключённые возможности (см. пакет features): их HTTP-маршруты не регистрируются, а методы gRPC отклоняются
+
+	ReuseExpiredIdentityWindow time.Duration // Сколько после истечения JWT его user_id ещё восстанавливается; 0 — не восстанавливается
+
+	FileWatchInterval  time.Duration // Период проверки файла хранилища на замену извне; 0 отключает проверку
+	FileReloadOnChange bool          // Перечитывать файл хранилища при его замене извне
+	FileRepairOnLoad   bool          // Переписать файл хранилища при загрузке, если в нём есть повторы short_id
+	FileWriteAttempts  int           // Число попыток дозаписи в файл хранилища при временных ошибках; 1 отключает повторы
+	FileWriteBackoff   time.Duration // Пауза перед первым повтором дозаписи, удваивается после каждой неудачи
+	FileTempMaxAge     time.Duration // Возраст, после которого брошенные временные файлы перезаписи удаляются при запуске
+
+	DisableReverseIndex bool // Не строить индекс original_url -> short_id; сохранение без дедупликации URL (только memory и file)
+	DisableFileSelfHeal bool // Не пересоздавать каталог файла хранилища, удалённый во время работы
+
+	MemoryMaxURLs  int    // Лимит записей in-memory хранилища; 0 — без ограничения
+	MemoryEviction string // Поведение при достижении лимита: reject или lru
+
+	RobotsPolicy string // Политика индексации для /robots.txt: deny или ui
+
+	ShortURLHeader string // Заголовок ответа, в котором дублируется созданный короткий URL
+	StrictJSON     bool   // Отклонять неизвестные поля в JSON-запросах
+	PersistUsers   bool   // Записывать в хранилище пользователей, которым выдан JWT, чтобы учитывать их до создания ссылок
+	UserIDEncoding string // Кодировка идентификаторов пользователей: base64url, hex или base62
+	IDAlphabet     string // Алфавит коротких ID; пустая строка — base64url
+
+	ShortURLTemplate string // Шаблон коротких URL с подстановками {base} и {id}, например {base}/go/{id}
+
+	ShortIDLength    int     // Длина генерируемых коротких ID
+	IDSpaceWarnRatio float64 // Доля занятых коротких ID, начиная с которой логируется предупреждение; 0 — без проверки
+
+	StrictPlainContentType bool // Требовать text/plain или application/x-gzip для POST /
+
+	SnapshotPath     string        // Файл снимка URL для прогрева кеша при рестарте с PostgreSQL; пустой путь отключает снимок
+	SnapshotInterval time.Duration // Период записи снимка
+	SnapshotMaxAge   time.Duration // Записи снимка старше этого окна не используются
+	SnapshotMaxURLs  int           // Лимит записей кеша снимка; давно не читавшиеся вытесняются
+
+	DefaultLanguage string // Язык HTML-страниц, если Accept-Language не совпал ни с одним каталогом: en или ru
+
+	LogPIIMode string // Выдача идентификаторов пользователей во внутренних отчётах: plain или hashed
+
+	DBSlowQueryThreshold time.Duration // Запросы к PostgreSQL дольше порога логируются с уровнем warn
+	DBResetThreshold     int           // Число неудачных проверок PostgreSQL подряд, после которого соединения пула сбрасываются
+
+	EnableFaultInjection bool // Разрешить внедрение сбоев хранилища через POST /api/internal/faults (только для тестовых стендов)
+
+	CSRFProtection bool // Требовать X-CSRF-Token для изменяющих запросов к /api/*, аутентифицированных cookie
+
+	RedirectMissDelay time.Duration // Верхняя граница случайного выравнивания времени ответа на редирект; 0 — без задержки
+
+	MaxDeleteBatch int // Максимальное число ID в одном запросе DELETE /api/user/urls
+
+	MaxConcurrentBatches int    // Максимальное число одновременных пакетных сокращений; 0 — без ограничения
+	BatchLimitPolicy     string // Поведение при достижении лимита пакетов: queue (ждать) или reject (503)
+
+	MaxHeaderBytes int // Максимальный размер строки запроса и заголовков HTTP-запроса в байтах
+
+	TrackReferrers bool // Учитывать источники переходов (заголовок Referer) и показывать их в статистике пользователя; файловое хранилище не поддерживает
+
+	TrackClicks bool // Записывать переходы по ссылкам в хранилище для статистики пользователя; файловое хранилище не поддерживает
+
+	ForceGzip bool // Сжимать ответы внутренних маршрутов /api/internal/ и без заголовка Accept-Encoding
+
+	DedupStatus int // HTTP-статус ответа на сокращение уже существующего URL: 409 (по умолчанию) или 200
+
+	MaxDescriptionLength int // Максимальная длина описания ссылки в символах
+
+	DisableRedirectMemo bool // Не запоминать разрешения ссылок для повторных редиректов одного клиента
+
+	HealthPath string // Дополнительный путь проверки готовности для систем мониторинга с фиксированным путём проб; пустой — не используется
+
+	ResponseFieldNaming string // Именование полей в JSON-ответах API: snake_case (по умолчанию) или camelCase
+	ShortenResponseMode string // Ответ POST /api/shorten: body (JSON в теле, по умолчанию) или location (201 с заголовком Location)
+
+	GRPCMaxRecvBytes         int           // Максимальный размер входящего gRPC-сообщения в байтах
+	GRPCMaxSendBytes         int           // Максимальный размер исходящего gRPC-сообщения в байтах
+	GRPCKeepaliveTime        time.Duration // Интервал keepalive-пингов gRPC сервера к простаивающему клиенту
+	GRPCKeepaliveTimeout     time.Duration // Время ожидания ответа на keepalive-пинг, после которого соединение закрывается
+	GRPCMaxConcurrentStreams int           // Лимит одновременных потоков (вызовов) на одно gRPC-соединение
+
+	ClickRateLimit   float64 // Переходов в секунду по одной ссылке, которые записываются в аналитику; 0 — без ограничения
+	HotLinksCapacity int     // Число ссылок, для которых хранится состояние ограничителя переходов
+
+	AllowedForwardedHosts []string // Хосты из X-Forwarded-Host, на домене которых строятся короткие URL; пустой список — всегда BaseURL
+
+	InternalAPITokens []string // Токены X-Internal-Token, которые внутренние API требуют вместе с доверенной подсетью; пустой список — только подсеть
+
+	TrustClientIPHeader bool // Брать IP клиента для проверки доверенной подсети из X-Real-IP (и метаданных GRPCRealIPKey); false — только из адреса соединения (без прокси)
+
+	HTTPSRedirect     bool   // При включённом HTTPS дополнительно слушать HTTP и перенаправлять все запросы на HTTPS (301)
+	HTTPSRedirectAddr string // Адрес HTTP-сервера, перенаправляющего запросы на HTTPS
+
+	BaseURLCheck BaseURLCheck // Результат сверки BaseURL с RunAddr для журнала при запуске
+
+	VerifyStorage bool // Проверить хранилище, вывести отчёт в JSON и завершиться вместо запуска сервера
+	VerifyRepair  bool // При проверке хранилища исправить нарушения, исправимые без потери данных
 }
 
 // ConfigFile представляет структуру для десериализации JSON-файла конфигурации
 type ConfigFile struct {
-	ServerAddress   string `json:"server_address"`
-	GRPCAddress     string `json:"grpc_address"`
-	BaseURL         string `json:"base_url"`
-	FileStoragePath string `json:"file_storage_path"`
-	DatabaseDSN     string `json:"database_dsn"`
-	EnableHTTPS     bool   `json:"enable_https"`
-	EnableGRPC      bool   `json:"enable_grpc"`
-	TrustedSubnet   string `json:"trusted_subnet"`
+	ServerAddress    string   `json:"server_address"`
+	GRPCAddress      string   `json:"grpc_address"`
+	BaseURL          string   `json:"base_url"`
+	FileStoragePath  string   `json:"file_storage_path"`
+	DatabaseDSN      string   `json:"database_dsn"`
+	EnableHTTPS      bool     `json:"enable_https"`
+	EnableGRPC       bool     `json:"enable_grpc"`
+	TrustedSubnet    string   `json:"trusted_subnet"`
+	RefQueryKey      string   `json:"ref_query_key"`
+	PreShutdownDelay string   `json:"pre_shutdown_delay"`
+	CookieMaxAge     string   `json:"cookie_max_age"`
+	GRPCRealIPKey    string   `json:"grpc_real_ip_key"`
+	EnabledEndpoints []string `json:"enabled_endpoints"`
+
+	GRPCRequestIDKey string `json:"grpc_request_id_key"`
+
+	DisabledEndpoints []string `json:"disabled_endpoints"`
+
+	ReuseExpiredIdentityWindow string `json:"reuse_expired_identity_window"`
+
+	FileWatchInterval  string `json:"file_watch_interval"`
+	FileReloadOnChange bool   `json:"file_reload_on_change"`
+	FileRepairOnLoad   bool   `json:"file_repair_on_load"`
+	FileWriteAttempts  int    `json:"file_write_attempts"`
+	FileWriteBackoff   string `json:"file_write_backoff"`
+	FileTempMaxAge     string `json:"file_temp_max_age"`
+
+	DisableReverseIndex bool `json:"disable_reverse_index"`
+	DisableFileSelfHeal bool `json:"disable_file_self_heal"`
+
+	MemoryMaxURLs  int    `json:"memory_max_urls"`
+	MemoryEviction string `json:"memory_eviction"`
+
+	RobotsPolicy string `json:"robots_policy"`
+
+	ShortURLHeader string `json:"short_url_header"`
+	StrictJSON     bool   `json:"strict_json"`
+	PersistUsers   bool   `json:"persist_users"`
+	UserIDEncoding string `json:"user_id_encoding"`
+	IDAlphabet     string `json:"id_alphabet"`
+
+	ShortURLTemplate string `json:"short_url_template"`
+
+	ShortIDLength    int     `json:"short_id_length"`
+	IDSpaceWarnRatio float64 `json:"id_space_warn_ratio"`
+
+	StrictPlainContentType bool `json:"strict_plain_content_type"`
+
+	SnapshotPath     string `json:"snapshot_path"`
+	SnapshotInterval string `json:"snapshot_interval"`
+	SnapshotMaxAge   string `json:"snapshot_max_age"`
+	SnapshotMaxURLs  int    `json:"snapshot_max_urls"`
+
+	DefaultLanguage string `json:"default_language"`
+
+	LogPIIMode string `json:"log_pii_mode"`
+
+	DBSlowQueryThreshold string `json:"db_slow_query_threshold"`
+	DBResetThreshold     int    `json:"db_reset_threshold"`
+
+	EnableFaultInjection bool `json:"enable_fault_injection"`
+
+	CSRFProtection bool `json:"csrf_protection"`
+
+	RedirectMissDelay string `json:"redirect_miss_delay"`
+
+	MaxDeleteBatch int `json:"max_delete_batch"`
+
+	MaxConcurrentBatches int    `json:"max_concurrent_batches"`
+	BatchLimitPolicy     string `json:"batch_limit_policy"`
+
+	MaxHeaderBytes int `json:"max_header_bytes"`
+
+	TrackReferrers bool `json:"track_referrers"`
+
+	TrackClicks bool `json:"track_clicks"`
+
+	ForceGzip bool `json:"force_gzip"`
+
+	DedupStatus int `json:"dedup_status"`
+
+	MaxDescriptionLength int `json:"max_description_length"`
+
+	DisableRedirectMemo bool `json:"disable_redirect_memo"`
+
+	HealthPath string `json:"health_path"`
+
+	ResponseFieldNaming string `json:"response_field_naming"`
+	ShortenResponseMode string `json:"shorten_response_mode"`
+
+	AllowedForwardedHosts []string `json:"allowed_forwarded_hosts"`
+
+	InternalAPIToken string `json:"internal_api_token"`
+
+	TrustClientIPHeader *bool `json:"trust_client_ip_header"` // nil — значение по умолчанию (true)
+
+	HTTPSRedirect     bool   `json:"https_redirect"`
+	HTTPSRedirectAddr string `json:"https_redirect_address"`
+
+	ClickRateLimit   float64 `json:"click_rate_limit"`
+	HotLinksCapacity int     `json:"hot_links_capacity"`
+
+	GRPCMaxRecvBytes         int    `json:"grpc_max_recv_bytes"`
+	GRPCMaxSendBytes         int    `json:"grpc_max_send_bytes"`
+	GRPCKeepaliveTime        string `json:"grpc_keepalive_time"`
+	GRPCKeepaliveTimeout     string `json:"grpc_keepalive_timeout"`
+	GRPCMaxConcurrentStreams int    `json:"grpc_max_concurrent_streams"`
 }
 
 // loadConfigFile загружает конфигурацию из JSON-файла
@@ -74,6 +279,45 @@ func NewConfig() (*Config, error) {
 		EnableHTTPS:     false,
 		EnableGRPC:      false,
 		TrustedSubnet:   "",
+		RefQueryKey:     "ref",
+		CookieMaxAge:    24 * time.Hour,
+		GRPCRealIPKey:   "x-real-ip",
+
+		GRPCRequestIDKey: "x-request-id",
+
+		TrustClientIPHeader: true,
+
+		HTTPSRedirectAddr: ":80",
+
+		FileWatchInterval: 5 * time.Second,
+
+		MemoryEviction: "reject",
+
+		BatchLimitPolicy: "queue",
+
+		RobotsPolicy: "deny",
+
+		ResponseFieldNaming: "snake_case",
+		ShortenResponseMode: "body",
+
+		ShortURLHeader: "X-Short-URL",
+		UserIDEncoding: "base64url",
+
+		ShortURLTemplate: "{base}/{id}",
+
+		ShortIDLength:    8,
+		IDSpaceWarnRatio: 0.1,
+
+		SnapshotInterval: time.Minute,
+		SnapshotMaxAge:   time.Hour,
+		SnapshotMaxURLs:  100000,
+
+		DefaultLanguage: "en",
+
+		LogPIIMode: "plain",
+
+		DBSlowQueryThreshold: 100 * time.Millisecond,
+		DBResetThreshold:     3,
 	}
 
 	// Регистрируем флаги
@@ -86,6 +330,72 @@ func NewConfig() (*Config, error) {
 	flagEnableHTTPS := flag.Bool("s", false, "enable HTTPS server")
 	flagEnableGRPC := flag.Bool("enable-grpc", false, "enable gRPC server")
 	flagTrustedSubnet := flag.String("t", "", "trusted subnet CIDR for internal API access")
+	flagRefQueryKey := flag.String("ref-query-key", "", "query parameter name for campaign suffix in /{id}+{suffix} links (default ref)")
+	flagPreShutdownDelay := flag.Duration("pre-shutdown-delay", 0, "delay before graceful shutdown while /readyz reports 503")
+	flagCookieMaxAge := flag.Duration("cookie-max-age", 0, "max age of the auth cookie (default 24h)")
+	flagReuseExpiredIdentityWindow := flag.Duration("reuse-expired-identity-window", 0, "keep the user ID of a validly signed JWT expired no longer than this ago (default 0, disabled)")
+	flagGRPCRealIPKey := flag.String("grpc-real-ip-key", "", "gRPC metadata key with client IP for trusted subnet check (default x-real-ip)")
+	flagGRPCRequestIDKey := flag.String("grpc-request-id-key", "", "gRPC metadata key with request ID; generated when missing (default x-request-id)")
+	flagEnabledEndpoints := flag.String("enabled-endpoints", "", "comma-separated list of enabled endpoints (default all)")
+	flagDisabledEndpoints := flag.String("disabled-endpoints", "", "comma-separated list of disabled features: shorten, batch, delete, user_urls, expand, stats, ui, grpc_write")
+	flagFileWatchInterval := flag.Duration("file-watch-interval", 0, "interval for checking the storage file for external replacement (default 5s)")
+	flagFileReloadOnChange := flag.Bool("file-reload-on-change", false, "reload storage file when it is replaced externally")
+	flagFileRepairOnLoad := flag.Bool("file-repair-on-load", false, "rewrite storage file on startup dropping records with duplicate short IDs (the first record wins)")
+	flagFileWriteAttempts := flag.Int("file-write-attempts", 0, "attempts to append to the storage file on transient errors such as ENOSPC (default 3)")
+	flagFileTempMaxAge := flag.Duration("file-temp-max-age", 0, "age after which leftover temp_*.json files in the storage directory are removed on startup (default 1h)")
+	flagFileWriteBackoff := flag.Duration("file-write-backoff", 0, "pause before the first storage file write retry, doubled on each failure (default 10ms)")
+	flagDisableFileSelfHeal := flag.Bool("disable-file-self-heal", false, "fail writes instead of recreating the storage directory when it is removed at runtime")
+	flagDisableReverseIndex := flag.Bool("disable-reverse-index", false, "do not index original URLs in memory/file storage (disables URL deduplication; not supported with PostgreSQL)")
+	flagMemoryMaxURLs := flag.Int("memory-max-urls", 0, "max number of URLs in memory storage, 0 means unlimited")
+	flagMemoryEviction := flag.String("memory-eviction", "", "behavior when memory storage is full: reject or lru (default reject)")
+	flagRobotsPolicy := flag.String("robots-policy", "", "robots.txt policy: deny or ui (default deny)")
+	flagShortURLTemplate := flag.String("short-url-template", "", "template of short URLs with {base} and {id} placeholders, e.g. {base}/go/{id} (default {base}/{id})")
+	flagShortURLHeader := flag.String("short-url-header", "", "response header carrying the created short URL (default X-Short-URL)")
+	flagStrictJSON := flag.Bool("strict-json", false, "reject unknown fields in JSON requests")
+	flagPersistUsers := flag.Bool("persist-users", false, "record users issued a JWT in storage so stats count them before they create links")
+	flagUserIDEncoding := flag.String("user-id-encoding", "", "encoding of generated user IDs: base64url, hex or base62 (default base64url)")
+	flagStrictPlainContentType := flag.Bool("strict-plain-content-type", false, "require text/plain or application/x-gzip Content-Type for POST /")
+	flagSnapshotPath := flag.String("snapshot-path", "", "path to URL snapshot file for warming the cache of PostgreSQL storage")
+	flagSnapshotInterval := flag.Duration("snapshot-interval", 0, "interval for writing the URL snapshot (default 1m)")
+	flagSnapshotMaxAge := flag.Duration("snapshot-max-age", 0, "ignore snapshot entries older than this window (default 1h)")
+	flagSnapshotMaxURLs := flag.Int("snapshot-max-urls", 0, "max number of URLs kept in the snapshot cache (default 100000)")
+	flagDefaultLanguage := flag.String("default-language", "", "language of HTML pages when Accept-Language does not match: en or ru (default en)")
+	flagShortIDLength := flag.Int("short-id-length", 0, "length of generated short IDs (default 8)")
+	flagIDSpaceWarnRatio := flag.Float64("id-space-warn-ratio", 0, "share of occupied short IDs at which a warning to increase the short ID length is logged (default 0.1)")
+	flagIDAlphabet := flag.String("id-alphabet", "", "alphabet of generated short IDs, at least 16 unique characters from A-Z, a-z, 0-9 and -_.~ (default base64url)")
+	flagLogPIIMode := flag.String("log-pii-mode", "", "user IDs in internal reports: plain or hashed (default plain)")
+	flagDBResetThreshold := flag.Int("db-reset-threshold", 0, "consecutive failed PostgreSQL pings after which pooled connections are reset to re-resolve the host (default 3)")
+	flagDBSlowQueryThreshold := flag.Duration("db-slow-query-threshold", 0, "log PostgreSQL queries slower than this with warn level (default 100ms)")
+	flagEnableFaultInjection := flag.Bool("enable-fault-injection", false, "allow injecting storage faults via POST /api/internal/faults (testing only)")
+	flagCSRFProtection := flag.Bool("csrf-protection", false, "require X-CSRF-Token matching the csrf_token cookie for cookie-authenticated non-GET /api/* requests")
+	flagRedirectMissDelay := flag.Duration("redirect-miss-delay", 0, "max random floor of redirect response time for known and unknown short IDs to hide timing differences (default 0, disabled)")
+	flagMaxDeleteBatch := flag.Int("max-delete-batch", 0, "max number of IDs in one DELETE /api/user/urls request (default 10000)")
+	flagMaxConcurrentBatches := flag.Int("max-concurrent-batches", 0, "max number of batch shorten requests processed at once (default 0, unlimited)")
+	flagBatchLimitPolicy := flag.String("batch-limit-policy", "", "behavior when concurrent batch limit is reached: queue or reject with 503 (default queue)")
+	flagTrackReferrers := flag.Bool("track-referrers", false, "record Referer hosts of redirects and report top referrers in user stats (adds a storage write per redirect; memory and PostgreSQL storage only)")
+	flagTrackClicks := flag.Bool("track-clicks", false, "record redirect clicks in storage and report them in user stats (written in batches; memory and PostgreSQL storage only)")
+	flagMaxDescriptionLength := flag.Int("max-description-length", 0, "max length of a link description in characters (default 500)")
+	flagDedupStatus := flag.Int("dedup-status", 0, "HTTP status for shortening an already shortened URL: 409 or 200 (default 409)")
+	flagDisableRedirectMemo := flag.Bool("disable-redirect-memo", false, "do not memoize link resolutions for repeated redirects of the same client (email scanner bursts)")
+	flagForceGzip := flag.Bool("force-gzip", false, "gzip large responses of /api/internal/ routes even when the request has no Accept-Encoding header")
+	flagMaxHeaderBytes := flag.Int("max-header-bytes", 0, "max size of HTTP request line and headers in bytes (default 64KiB)")
+	flagHealthPath := flag.String("health-path", "", "additional path of the readiness check, e.g. /api/healthz; must start with a reserved prefix such as /api/")
+	flagShortenResponseMode := flag.String("shorten-response-mode", "", "response of POST /api/shorten: body (JSON result) or location (201 with Location header and empty body) (default body)")
+	flagResponseFieldNaming := flag.String("response-field-naming", "", "naming of JSON response fields: snake_case or camelCase, e.g. shortUrl/longUrl (default snake_case)")
+	flagTrustClientIPHeader := flag.Bool("trust-client-ip-header", true, "take the client IP for trusted subnet checks from X-Real-IP; set to false without a proxy to use only the connection address")
+	flagHTTPSRedirect := flag.Bool("https-redirect", false, "with HTTPS enabled, also listen on plain HTTP and redirect all requests to HTTPS with 301")
+	flagHTTPSRedirectAddr := flag.String("https-redirect-addr", "", "address of the HTTP server redirecting to HTTPS (default :80)")
+	flagInternalAPIToken := flag.String("internal-api-token", "", "comma-separated shared secrets (current and next during rotation) required in X-Internal-Token for trusted subnet APIs")
+	flagAllowedForwardedHosts := flag.String("allowed-forwarded-hosts", "", "comma-separated X-Forwarded-Host values for which short URLs use the request domain instead of the base URL")
+	flagGRPCMaxRecvBytes := flag.Int("grpc-max-recv-bytes", 0, "max size of incoming gRPC message in bytes (default 16MiB)")
+	flagGRPCMaxSendBytes := flag.Int("grpc-max-send-bytes", 0, "max size of outgoing gRPC message in bytes (default 16MiB)")
+	flagGRPCKeepaliveTime := flag.Duration("grpc-keepalive-time", 0, "interval of gRPC server keepalive pings to idle clients (default 1m)")
+	flagGRPCKeepaliveTimeout := flag.Duration("grpc-keepalive-timeout", 0, "time to wait for keepalive ping ack before closing gRPC connection (default 20s)")
+	flagGRPCMaxConcurrentStreams := flag.Int("grpc-max-concurrent-streams", 0, "max concurrent streams per gRPC connection (default 1000)")
+	flagClickRateLimit := flag.Float64("click-rate-limit", 0, "clicks per second per link recorded in analytics, the rest are sampled (default 0, unlimited)")
+	flagHotLinksCapacity := flag.Int("hot-links-capacity", 0, "number of links tracked by the click rate limiter (default 1000)")
+	flagVerifyStorage := flag.Bool("verify-storage", false, "check storage invariants, print a JSON report and exit (non-zero on violations)")
+	flagVerifyRepair := flag.Bool("verify-repair", false, "with -verify-storage, repair violations that can be fixed without data loss")
 	flagConfigFile := flag.String("c", "", "path to configuration file")
 	flagConfigFileAlt := flag.String("config", "", "path to configuration file")
 	flag.Parse()
@@ -127,8 +437,228 @@ func NewConfig() (*Config, error) {
 		if configFile.TrustedSubnet != "" {
 			cfg.TrustedSubnet = configFile.TrustedSubnet
 		}
+		if configFile.RefQueryKey != "" {
+			cfg.RefQueryKey = configFile.RefQueryKey
+		}
+		if configFile.PreShutdownDelay != "" {
+			delay, err := time.ParseDuration(configFile.PreShutdownDelay)
+			if err != nil {
+				return nil, err
+			}
+			cfg.PreShutdownDelay = delay
+		}
+		if configFile.FileWatchInterval != "" {
+			interval, err := time.ParseDuration(configFile.FileWatchInterval)
+			if err != nil {
+				return nil, err
+			}
+			cfg.FileWatchInterval = interval
+		}
+		cfg.FileReloadOnChange = configFile.FileReloadOnChange
+		cfg.FileRepairOnLoad = configFile.FileRepairOnLoad
+		if configFile.FileWriteAttempts != 0 {
+			cfg.FileWriteAttempts = configFile.FileWriteAttempts
+		}
+		if configFile.FileWriteBackoff != "" {
+			backoff, err := time.ParseDuration(configFile.FileWriteBackoff)
+			if err != nil {
+				return nil, err
+			}
+			cfg.FileWriteBackoff = backoff
+		}
+		if configFile.FileTempMaxAge != "" {
+			maxAge, err := time.ParseDuration(configFile.FileTempMaxAge)
+			if err != nil {
+				return nil, err
+			}
+			cfg.FileTempMaxAge = maxAge
+		}
+		cfg.DisableReverseIndex = configFile.DisableReverseIndex
+		cfg.DisableFileSelfHeal = configFile.DisableFileSelfHeal
+		if configFile.MemoryMaxURLs != 0 {
+			cfg.MemoryMaxURLs = configFile.MemoryMaxURLs
+		}
+		if configFile.MemoryEviction != "" {
+			cfg.MemoryEviction = configFile.MemoryEviction
+		}
+		if configFile.RobotsPolicy != "" {
+			cfg.RobotsPolicy = configFile.RobotsPolicy
+		}
+		if configFile.ShortURLHeader != "" {
+			cfg.ShortURLHeader = configFile.ShortURLHeader
+		}
+		if configFile.ShortURLTemplate != "" {
+			cfg.ShortURLTemplate = configFile.ShortURLTemplate
+		}
+		cfg.StrictJSON = configFile.StrictJSON
+		cfg.PersistUsers = configFile.PersistUsers
+		if configFile.UserIDEncoding != "" {
+			cfg.UserIDEncoding = configFile.UserIDEncoding
+		}
+		if configFile.IDAlphabet != "" {
+			cfg.IDAlphabet = configFile.IDAlphabet
+		}
+		if configFile.ShortIDLength != 0 {
+			cfg.ShortIDLength = configFile.ShortIDLength
+		}
+		if configFile.IDSpaceWarnRatio != 0 {
+			cfg.IDSpaceWarnRatio = configFile.IDSpaceWarnRatio
+		}
+		cfg.StrictPlainContentType = configFile.StrictPlainContentType
+		if configFile.DefaultLanguage != "" {
+			cfg.DefaultLanguage = configFile.DefaultLanguage
+		}
+		if configFile.LogPIIMode != "" {
+			cfg.LogPIIMode = configFile.LogPIIMode
+		}
+		cfg.EnableFaultInjection = configFile.EnableFaultInjection
+		cfg.CSRFProtection = configFile.CSRFProtection
+		cfg.TrackReferrers = configFile.TrackReferrers
+		cfg.TrackClicks = configFile.TrackClicks
+		cfg.ForceGzip = configFile.ForceGzip
+		cfg.DisableRedirectMemo = configFile.DisableRedirectMemo
+		if configFile.RedirectMissDelay != "" {
+			delay, err := time.ParseDuration(configFile.RedirectMissDelay)
+			if err != nil {
+				return nil, err
+			}
+			cfg.RedirectMissDelay = delay
+		}
+		if configFile.MaxDeleteBatch != 0 {
+			cfg.MaxDeleteBatch = configFile.MaxDeleteBatch
+		}
+		if configFile.MaxConcurrentBatches != 0 {
+			cfg.MaxConcurrentBatches = configFile.MaxConcurrentBatches
+		}
+		if configFile.BatchLimitPolicy != "" {
+			cfg.BatchLimitPolicy = configFile.BatchLimitPolicy
+		}
+		if configFile.MaxHeaderBytes != 0 {
+			cfg.MaxHeaderBytes = configFile.MaxHeaderBytes
+		}
+		if configFile.DedupStatus != 0 {
+			cfg.DedupStatus = configFile.DedupStatus
+		}
+		if configFile.MaxDescriptionLength != 0 {
+			cfg.MaxDescriptionLength = configFile.MaxDescriptionLength
+		}
+		if configFile.HealthPath != "" {
+			cfg.HealthPath = configFile.HealthPath
+		}
+		if configFile.ResponseFieldNaming != "" {
+			cfg.ResponseFieldNaming = configFile.ResponseFieldNaming
+		}
+		if configFile.ShortenResponseMode != "" {
+			cfg.ShortenResponseMode = configFile.ShortenResponseMode
+		}
+		if configFile.DBSlowQueryThreshold != "" {
+			threshold, err := time.ParseDuration(configFile.DBSlowQueryThreshold)
+			if err != nil {
+				return nil, err
+			}
+			cfg.DBSlowQueryThreshold = threshold
+		}
+		if configFile.DBResetThreshold != 0 {
+			cfg.DBResetThreshold = configFile.DBResetThreshold
+		}
+		if configFile.SnapshotPath != "" {
+			cfg.SnapshotPath = configFile.SnapshotPath
+		}
+		if configFile.SnapshotInterval != "" {
+			interval, err := time.ParseDuration(configFile.SnapshotInterval)
+			if err != nil {
+				return nil, err
+			}
+			cfg.SnapshotInterval = interval
+		}
+		if configFile.SnapshotMaxAge != "" {
+			maxAge, err := time.ParseDuration(configFile.SnapshotMaxAge)
+			if err != nil {
+				return nil, err
+			}
+			cfg.SnapshotMaxAge = maxAge
+		}
+		if configFile.SnapshotMaxURLs != 0 {
+			cfg.SnapshotMaxURLs = configFile.SnapshotMaxURLs
+		}
+		if len(configFile.EnabledEndpoints) > 0 {
+			cfg.EnabledEndpoints = configFile.EnabledEndpoints
+		}
+		if len(configFile.DisabledEndpoints) > 0 {
+			cfg.DisabledEndpoints = configFile.DisabledEndpoints
+		}
+		if len(configFile.AllowedForwardedHosts) > 0 {
+			cfg.AllowedForwardedHosts = configFile.AllowedForwardedHosts
+		}
+		if configFile.InternalAPIToken != "" {
+			cfg.InternalAPITokens = splitList(configFile.InternalAPIToken)
+		}
+		if configFile.TrustClientIPHeader != nil {
+			cfg.TrustClientIPHeader = *configFile.TrustClientIPHeader
+		}
+		cfg.HTTPSRedirect = configFile.HTTPSRedirect
+		if configFile.HTTPSRedirectAddr != "" {
+			cfg.HTTPSRedirectAddr = configFile.HTTPSRedirectAddr
+		}
+		if configFile.GRPCMaxRecvBytes != 0 {
+			cfg.GRPCMaxRecvBytes = configFile.GRPCMaxRecvBytes
+		}
+		if configFile.GRPCMaxSendBytes != 0 {
+			cfg.GRPCMaxSendBytes = configFile.GRPCMaxSendBytes
+		}
+		if configFile.GRPCKeepaliveTime != "" {
+			keepaliveTime, err := time.ParseDuration(configFile.GRPCKeepaliveTime)
+			if err != nil {
+				return nil, err
+			}
+			cfg.GRPCKeepaliveTime = keepaliveTime
+		}
+		if configFile.GRPCKeepaliveTimeout != "" {
+			keepaliveTimeout, err := time.ParseDuration(configFile.GRPCKeepaliveTimeout)
+			if err != nil {
+				return nil, err
+			}
+			cfg.GRPCKeepaliveTimeout = keepaliveTimeout
+		}
+		if configFile.GRPCMaxConcurrentStreams != 0 {
+			cfg.GRPCMaxConcurrentStreams = configFile.GRPCMaxConcurrentStreams
+		}
+		if configFile.ClickRateLimit != 0 {
+			cfg.ClickRateLimit = configFile.ClickRateLimit
+		}
+		if configFile.HotLinksCapacity != 0 {
+			cfg.HotLinksCapacity = configFile.HotLinksCapacity
+		}
+		if configFile.GRPCRealIPKey != "" {
+			cfg.GRPCRealIPKey = configFile.GRPCRealIPKey
+		}
+		if configFile.GRPCRequestIDKey != "" {
+			cfg.GRPCRequestIDKey = configFile.GRPCRequestIDKey
+		}
+		if configFile.CookieMaxAge != "" {
+			maxAge, err := time.ParseDuration(configFile.CookieMaxAge)
+			if err != nil {
+				return nil, err
+			}
+			cfg.CookieMaxAge = maxAge
+		}
+		if configFile.ReuseExpiredIdentityWindow != "" {
+			window, err := time.ParseDuration(configFile.ReuseExpiredIdentityWindow)
+			if err != nil {
+				return nil, err
+			}
+			cfg.ReuseExpiredIdentityWindow = window
+		}
 	}
 
+	// Флаги, заданные явно: значения по умолчанию не считаются выбором пользователя
+	explicitFlags := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		explicitFlags[f.Name] = true
+	})
+	_, runAddrEnvSet := os.LookupEnv("SERVER_ADDRESS")
+	_, baseURLEnvSet := os.LookupEnv("BASE_URL")
+
 	// Проверяем переменные окружения
 	if addr, addrSet := os.LookupEnv("SERVER_ADDRESS"); addrSet {
 		cfg.RunAddr = addr
@@ -184,6 +714,507 @@ func NewConfig() (*Config, error) {
 		cfg.TrustedSubnet = *flagTrustedSubnet
 	}
 
+	if refQueryKey, refSet := os.LookupEnv("REF_QUERY_KEY"); refSet {
+		cfg.RefQueryKey = refQueryKey
+	} else if *flagRefQueryKey != "" {
+		cfg.RefQueryKey = *flagRefQueryKey
+	}
+
+	if delayStr, delaySet := os.LookupEnv("PRE_SHUTDOWN_DELAY"); delaySet {
+		delay, err := time.ParseDuration(delayStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.PreShutdownDelay = delay
+	} else if *flagPreShutdownDelay != 0 {
+		cfg.PreShutdownDelay = *flagPreShutdownDelay
+	}
+
+	if maxAgeStr, maxAgeSet := os.LookupEnv("COOKIE_MAX_AGE"); maxAgeSet {
+		maxAge, err := time.ParseDuration(maxAgeStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.CookieMaxAge = maxAge
+	} else if *flagCookieMaxAge != 0 {
+		cfg.CookieMaxAge = *flagCookieMaxAge
+	}
+
+	if windowStr, windowSet := os.LookupEnv("REUSE_EXPIRED_IDENTITY_WINDOW"); windowSet {
+		window, err := time.ParseDuration(windowStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ReuseExpiredIdentityWindow = window
+	} else if *flagReuseExpiredIdentityWindow != 0 {
+		cfg.ReuseExpiredIdentityWindow = *flagReuseExpiredIdentityWindow
+	}
+
+	if realIPKey, realIPSet := os.LookupEnv("GRPC_REAL_IP_KEY"); realIPSet {
+		cfg.GRPCRealIPKey = realIPKey
+	} else if *flagGRPCRealIPKey != "" {
+		cfg.GRPCRealIPKey = *flagGRPCRealIPKey
+	}
+
+	if requestIDKey, requestIDSet := os.LookupEnv("GRPC_REQUEST_ID_KEY"); requestIDSet {
+		cfg.GRPCRequestIDKey = requestIDKey
+	} else if *flagGRPCRequestIDKey != "" {
+		cfg.GRPCRequestIDKey = *flagGRPCRequestIDKey
+	}
+
+	if endpoints, endpointsSet := os.LookupEnv("ENABLED_ENDPOINTS"); endpointsSet {
+		cfg.EnabledEndpoints = splitList(endpoints)
+	} else if *flagEnabledEndpoints != "" {
+		cfg.EnabledEndpoints = splitList(*flagEnabledEndpoints)
+	}
+
+	if disabled, disabledSet := os.LookupEnv("DISABLED_ENDPOINTS"); disabledSet {
+		cfg.DisabledEndpoints = splitList(disabled)
+	} else if *flagDisabledEndpoints != "" {
+		cfg.DisabledEndpoints = splitList(*flagDisabledEndpoints)
+	}
+
+	if intervalStr, intervalSet := os.LookupEnv("FILE_WATCH_INTERVAL"); intervalSet {
+		interval, err := time.ParseDuration(intervalStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.FileWatchInterval = interval
+	} else if *flagFileWatchInterval != 0 {
+		cfg.FileWatchInterval = *flagFileWatchInterval
+	}
+
+	if reload, reloadSet := os.LookupEnv("FILE_RELOAD_ON_CHANGE"); reloadSet {
+		cfg.FileReloadOnChange = reload == "true"
+	} else if *flagFileReloadOnChange {
+		cfg.FileReloadOnChange = true
+	}
+
+	if repair, repairSet := os.LookupEnv("FILE_REPAIR_ON_LOAD"); repairSet {
+		cfg.FileRepairOnLoad = repair == "true"
+	} else if *flagFileRepairOnLoad {
+		cfg.FileRepairOnLoad = true
+	}
+
+	if attemptsStr, attemptsSet := os.LookupEnv("FILE_WRITE_ATTEMPTS"); attemptsSet {
+		attempts, err := strconv.Atoi(attemptsStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.FileWriteAttempts = attempts
+	} else if *flagFileWriteAttempts != 0 {
+		cfg.FileWriteAttempts = *flagFileWriteAttempts
+	}
+
+	if backoffStr, backoffSet := os.LookupEnv("FILE_WRITE_BACKOFF"); backoffSet {
+		backoff, err := time.ParseDuration(backoffStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.FileWriteBackoff = backoff
+	} else if *flagFileWriteBackoff != 0 {
+		cfg.FileWriteBackoff = *flagFileWriteBackoff
+	}
+
+	if maxAgeStr, maxAgeSet := os.LookupEnv("FILE_TEMP_MAX_AGE"); maxAgeSet {
+		maxAge, err := time.ParseDuration(maxAgeStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.FileTempMaxAge = maxAge
+	} else if *flagFileTempMaxAge != 0 {
+		cfg.FileTempMaxAge = *flagFileTempMaxAge
+	}
+
+	if disable, disableSet := os.LookupEnv("DISABLE_REVERSE_INDEX"); disableSet {
+		cfg.DisableReverseIndex = disable == "true"
+	} else if *flagDisableReverseIndex {
+		cfg.DisableReverseIndex = true
+	}
+
+	if disable, disableSet := os.LookupEnv("DISABLE_FILE_SELF_HEAL"); disableSet {
+		cfg.DisableFileSelfHeal = disable == "true"
+	} else if *flagDisableFileSelfHeal {
+		cfg.DisableFileSelfHeal = true
+	}
+
+	if maxStr, maxSet := os.LookupEnv("MEMORY_MAX_URLS"); maxSet {
+		maxURLs, err := strconv.Atoi(maxStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.MemoryMaxURLs = maxURLs
+	} else if *flagMemoryMaxURLs != 0 {
+		cfg.MemoryMaxURLs = *flagMemoryMaxURLs
+	}
+
+	if eviction, evictionSet := os.LookupEnv("MEMORY_EVICTION"); evictionSet {
+		cfg.MemoryEviction = eviction
+	} else if *flagMemoryEviction != "" {
+		cfg.MemoryEviction = *flagMemoryEviction
+	}
+
+	if policy, policySet := os.LookupEnv("ROBOTS_POLICY"); policySet {
+		cfg.RobotsPolicy = policy
+	} else if *flagRobotsPolicy != "" {
+		cfg.RobotsPolicy = *flagRobotsPolicy
+	}
+
+	if header, headerSet := os.LookupEnv("SHORT_URL_HEADER"); headerSet {
+		cfg.ShortURLHeader = header
+	} else if *flagShortURLHeader != "" {
+		cfg.ShortURLHeader = *flagShortURLHeader
+	}
+
+	if template, templateSet := os.LookupEnv("SHORT_URL_TEMPLATE"); templateSet {
+		cfg.ShortURLTemplate = template
+	} else if *flagShortURLTemplate != "" {
+		cfg.ShortURLTemplate = *flagShortURLTemplate
+	}
+
+	if strict, strictSet := os.LookupEnv("STRICT_JSON"); strictSet {
+		cfg.StrictJSON = strict == "true"
+	} else if *flagStrictJSON {
+		cfg.StrictJSON = true
+	}
+
+	if persist, persistSet := os.LookupEnv("PERSIST_USERS"); persistSet {
+		cfg.PersistUsers = persist == "true"
+	} else if *flagPersistUsers {
+		cfg.PersistUsers = true
+	}
+
+	if encoding, encodingSet := os.LookupEnv("USER_ID_ENCODING"); encodingSet {
+		cfg.UserIDEncoding = encoding
+	} else if *flagUserIDEncoding != "" {
+		cfg.UserIDEncoding = *flagUserIDEncoding
+	}
+
+	if alphabet, alphabetSet := os.LookupEnv("ID_ALPHABET"); alphabetSet {
+		cfg.IDAlphabet = alphabet
+	} else if *flagIDAlphabet != "" {
+		cfg.IDAlphabet = *flagIDAlphabet
+	}
+
+	if lengthStr, lengthSet := os.LookupEnv("SHORT_ID_LENGTH"); lengthSet {
+		length, err := strconv.Atoi(lengthStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ShortIDLength = length
+	} else if *flagShortIDLength != 0 {
+		cfg.ShortIDLength = *flagShortIDLength
+	}
+
+	if ratioStr, ratioSet := os.LookupEnv("ID_SPACE_WARN_RATIO"); ratioSet {
+		ratio, err := strconv.ParseFloat(ratioStr, 64)
+		if err != nil {
+			return nil, err
+		}
+		cfg.IDSpaceWarnRatio = ratio
+	} else if *flagIDSpaceWarnRatio != 0 {
+		cfg.IDSpaceWarnRatio = *flagIDSpaceWarnRatio
+	}
+
+	if strict, strictSet := os.LookupEnv("STRICT_PLAIN_CONTENT_TYPE"); strictSet {
+		cfg.StrictPlainContentType = strict == "true"
+	} else if *flagStrictPlainContentType {
+		cfg.StrictPlainContentType = true
+	}
+
+	if path, pathSet := os.LookupEnv("SNAPSHOT_PATH"); pathSet {
+		cfg.SnapshotPath = path
+	} else if *flagSnapshotPath != "" {
+		cfg.SnapshotPath = *flagSnapshotPath
+	}
+
+	if intervalStr, intervalSet := os.LookupEnv("SNAPSHOT_INTERVAL"); intervalSet {
+		interval, err := time.ParseDuration(intervalStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.SnapshotInterval = interval
+	} else if *flagSnapshotInterval != 0 {
+		cfg.SnapshotInterval = *flagSnapshotInterval
+	}
+
+	if maxAgeStr, maxAgeSet := os.LookupEnv("SNAPSHOT_MAX_AGE"); maxAgeSet {
+		maxAge, err := time.ParseDuration(maxAgeStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.SnapshotMaxAge = maxAge
+	} else if *flagSnapshotMaxAge != 0 {
+		cfg.SnapshotMaxAge = *flagSnapshotMaxAge
+	}
+
+	if maxStr, maxSet := os.LookupEnv("SNAPSHOT_MAX_URLS"); maxSet {
+		maxURLs, err := strconv.Atoi(maxStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.SnapshotMaxURLs = maxURLs
+	} else if *flagSnapshotMaxURLs != 0 {
+		cfg.SnapshotMaxURLs = *flagSnapshotMaxURLs
+	}
+
+	if lang, langSet := os.LookupEnv("DEFAULT_LANGUAGE"); langSet {
+		cfg.DefaultLanguage = lang
+	} else if *flagDefaultLanguage != "" {
+		cfg.DefaultLanguage = *flagDefaultLanguage
+	}
+
+	if mode, modeSet := os.LookupEnv("LOG_PII_MODE"); modeSet {
+		cfg.LogPIIMode = mode
+	} else if *flagLogPIIMode != "" {
+		cfg.LogPIIMode = *flagLogPIIMode
+	}
+
+	if thresholdStr, thresholdSet := os.LookupEnv("DB_SLOW_QUERY_THRESHOLD"); thresholdSet {
+		threshold, err := time.ParseDuration(thresholdStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.DBSlowQueryThreshold = threshold
+	} else if *flagDBSlowQueryThreshold != 0 {
+		cfg.DBSlowQueryThreshold = *flagDBSlowQueryThreshold
+	}
+
+	if resetStr, resetSet := os.LookupEnv("DB_RESET_THRESHOLD"); resetSet {
+		reset, err := strconv.Atoi(resetStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.DBResetThreshold = reset
+	} else if *flagDBResetThreshold != 0 {
+		cfg.DBResetThreshold = *flagDBResetThreshold
+	}
+
+	if faults, faultsSet := os.LookupEnv("ENABLE_FAULT_INJECTION"); faultsSet {
+		cfg.EnableFaultInjection = faults == "true"
+	} else if *flagEnableFaultInjection {
+		cfg.EnableFaultInjection = true
+	}
+
+	if csrf, csrfSet := os.LookupEnv("CSRF_PROTECTION"); csrfSet {
+		cfg.CSRFProtection = csrf == "true"
+	} else if *flagCSRFProtection {
+		cfg.CSRFProtection = true
+	}
+
+	if delayStr, delaySet := os.LookupEnv("REDIRECT_MISS_DELAY"); delaySet {
+		delay, err := time.ParseDuration(delayStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RedirectMissDelay = delay
+	} else if *flagRedirectMissDelay != 0 {
+		cfg.RedirectMissDelay = *flagRedirectMissDelay
+	}
+
+	if batchStr, batchSet := os.LookupEnv("MAX_DELETE_BATCH"); batchSet {
+		maxBatch, err := strconv.Atoi(batchStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.MaxDeleteBatch = maxBatch
+	} else if *flagMaxDeleteBatch != 0 {
+		cfg.MaxDeleteBatch = *flagMaxDeleteBatch
+	}
+
+	if batchesStr, batchesSet := os.LookupEnv("MAX_CONCURRENT_BATCHES"); batchesSet {
+		batches, err := strconv.Atoi(batchesStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.MaxConcurrentBatches = batches
+	} else if *flagMaxConcurrentBatches != 0 {
+		cfg.MaxConcurrentBatches = *flagMaxConcurrentBatches
+	}
+
+	if policy, policySet := os.LookupEnv("BATCH_LIMIT_POLICY"); policySet {
+		cfg.BatchLimitPolicy = policy
+	} else if *flagBatchLimitPolicy != "" {
+		cfg.BatchLimitPolicy = *flagBatchLimitPolicy
+	}
+
+	if track, trackSet := os.LookupEnv("TRACK_REFERRERS"); trackSet {
+		cfg.TrackReferrers = track == "true"
+	} else if *flagTrackReferrers {
+		cfg.TrackReferrers = true
+	}
+
+	if track, trackSet := os.LookupEnv("TRACK_CLICKS"); trackSet {
+		cfg.TrackClicks = track == "true"
+	} else if *flagTrackClicks {
+		cfg.TrackClicks = true
+	}
+
+	if force, forceSet := os.LookupEnv("FORCE_GZIP"); forceSet {
+		cfg.ForceGzip = force == "true"
+	} else if *flagForceGzip {
+		cfg.ForceGzip = true
+	}
+
+	if disable, disableSet := os.LookupEnv("DISABLE_REDIRECT_MEMO"); disableSet {
+		cfg.DisableRedirectMemo = disable == "true"
+	} else if *flagDisableRedirectMemo {
+		cfg.DisableRedirectMemo = true
+	}
+
+	if lengthStr, lengthSet := os.LookupEnv("MAX_DESCRIPTION_LENGTH"); lengthSet {
+		maxLength, err := strconv.Atoi(lengthStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.MaxDescriptionLength = maxLength
+	} else if *flagMaxDescriptionLength != 0 {
+		cfg.MaxDescriptionLength = *flagMaxDescriptionLength
+	}
+
+	if statusStr, statusSet := os.LookupEnv("DEDUP_STATUS"); statusSet {
+		status, err := strconv.Atoi(statusStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.DedupStatus = status
+	} else if *flagDedupStatus != 0 {
+		cfg.DedupStatus = *flagDedupStatus
+	}
+
+	if maxStr, maxSet := os.LookupEnv("MAX_HEADER_BYTES"); maxSet {
+		maxBytes, err := strconv.Atoi(maxStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.MaxHeaderBytes = maxBytes
+	} else if *flagMaxHeaderBytes != 0 {
+		cfg.MaxHeaderBytes = *flagMaxHeaderBytes
+	}
+
+	if healthPath, healthPathSet := os.LookupEnv("HEALTH_PATH"); healthPathSet {
+		cfg.HealthPath = healthPath
+	} else if *flagHealthPath != "" {
+		cfg.HealthPath = *flagHealthPath
+	}
+
+	if naming, namingSet := os.LookupEnv("RESPONSE_FIELD_NAMING"); namingSet {
+		cfg.ResponseFieldNaming = naming
+	} else if *flagResponseFieldNaming != "" {
+		cfg.ResponseFieldNaming = *flagResponseFieldNaming
+	}
+
+	if mode, modeSet := os.LookupEnv("SHORTEN_RESPONSE_MODE"); modeSet {
+		cfg.ShortenResponseMode = mode
+	} else if *flagShortenResponseMode != "" {
+		cfg.ShortenResponseMode = *flagShortenResponseMode
+	}
+
+	if hosts, hostsSet := os.LookupEnv("ALLOWED_FORWARDED_HOSTS"); hostsSet {
+		cfg.AllowedForwardedHosts = splitList(hosts)
+	} else if *flagAllowedForwardedHosts != "" {
+		cfg.AllowedForwardedHosts = splitList(*flagAllowedForwardedHosts)
+	}
+
+	if tokens, tokensSet := os.LookupEnv("INTERNAL_API_TOKEN"); tokensSet {
+		cfg.InternalAPITokens = splitList(tokens)
+	} else if *flagInternalAPIToken != "" {
+		cfg.InternalAPITokens = splitList(*flagInternalAPIToken)
+	}
+
+	// Флаг включён по умолчанию, поэтому переопределяет файл конфигурации, только если его выключили явно
+	if trust, trustSet := os.LookupEnv("TRUST_CLIENT_IP_HEADER"); trustSet {
+		cfg.TrustClientIPHeader = trust == "true"
+	} else if !*flagTrustClientIPHeader {
+		cfg.TrustClientIPHeader = false
+	}
+
+	if redirect, redirectSet := os.LookupEnv("HTTPS_REDIRECT"); redirectSet {
+		cfg.HTTPSRedirect = redirect == "true"
+	} else if *flagHTTPSRedirect {
+		cfg.HTTPSRedirect = true
+	}
+
+	if addr, addrSet := os.LookupEnv("HTTPS_REDIRECT_ADDRESS"); addrSet {
+		cfg.HTTPSRedirectAddr = addr
+	} else if *flagHTTPSRedirectAddr != "" {
+		cfg.HTTPSRedirectAddr = *flagHTTPSRedirectAddr
+	}
+
+	if maxStr, maxSet := os.LookupEnv("GRPC_MAX_RECV_BYTES"); maxSet {
+		maxBytes, err := strconv.Atoi(maxStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.GRPCMaxRecvBytes = maxBytes
+	} else if *flagGRPCMaxRecvBytes != 0 {
+		cfg.GRPCMaxRecvBytes = *flagGRPCMaxRecvBytes
+	}
+
+	if maxStr, maxSet := os.LookupEnv("GRPC_MAX_SEND_BYTES"); maxSet {
+		maxBytes, err := strconv.Atoi(maxStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.GRPCMaxSendBytes = maxBytes
+	} else if *flagGRPCMaxSendBytes != 0 {
+		cfg.GRPCMaxSendBytes = *flagGRPCMaxSendBytes
+	}
+
+	if timeStr, timeSet := os.LookupEnv("GRPC_KEEPALIVE_TIME"); timeSet {
+		keepaliveTime, err := time.ParseDuration(timeStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.GRPCKeepaliveTime = keepaliveTime
+	} else if *flagGRPCKeepaliveTime != 0 {
+		cfg.GRPCKeepaliveTime = *flagGRPCKeepaliveTime
+	}
+
+	if timeoutStr, timeoutSet := os.LookupEnv("GRPC_KEEPALIVE_TIMEOUT"); timeoutSet {
+		keepaliveTimeout, err := time.ParseDuration(timeoutStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.GRPCKeepaliveTimeout = keepaliveTimeout
+	} else if *flagGRPCKeepaliveTimeout != 0 {
+		cfg.GRPCKeepaliveTimeout = *flagGRPCKeepaliveTimeout
+	}
+
+	if streamsStr, streamsSet := os.LookupEnv("GRPC_MAX_CONCURRENT_STREAMS"); streamsSet {
+		streams, err := strconv.Atoi(streamsStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.GRPCMaxConcurrentStreams = streams
+	} else if *flagGRPCMaxConcurrentStreams != 0 {
+		cfg.GRPCMaxConcurrentStreams = *flagGRPCMaxConcurrentStreams
+	}
+
+	if rateStr, rateSet := os.LookupEnv("CLICK_RATE_LIMIT"); rateSet {
+		rate, err := strconv.ParseFloat(rateStr, 64)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClickRateLimit = rate
+	} else if *flagClickRateLimit != 0 {
+		cfg.ClickRateLimit = *flagClickRateLimit
+	}
+
+	if capacityStr, capacitySet := os.LookupEnv("HOT_LINKS_CAPACITY"); capacitySet {
+		capacity, err := strconv.Atoi(capacityStr)
+		if err != nil {
+			return nil, err
+		}
+		cfg.HotLinksCapacity = capacity
+	} else if *flagHotLinksCapacity != 0 {
+		cfg.HotLinksCapacity = *flagHotLinksCapacity
+	}
+
+	// Проверка хранилища — разовый режим запуска, поэтому задаётся только флагами
+	cfg.VerifyStorage = *flagVerifyStorage || *flagVerifyRepair
+	cfg.VerifyRepair = *flagVerifyRepair
+
 	// Валидация значений
 	if !strings.Contains(cfg.RunAddr, ":") {
 		cfg.RunAddr = ":" + cfg.RunAddr
@@ -191,9 +1222,126 @@ func NewConfig() (*Config, error) {
 	if !strings.Contains(cfg.GRPCAddr, ":") {
 		cfg.GRPCAddr = ":" + cfg.GRPCAddr
 	}
+	if !strings.Contains(cfg.HTTPSRedirectAddr, ":") {
+		cfg.HTTPSRedirectAddr = ":" + cfg.HTTPSRedirectAddr
+	}
+	if cfg.PreShutdownDelay < 0 {
+		cfg.PreShutdownDelay = 0
+	}
+	if cfg.CookieMaxAge <= 0 {
+		cfg.CookieMaxAge = 24 * time.Hour
+	}
+	if cfg.ReuseExpiredIdentityWindow < 0 {
+		cfg.ReuseExpiredIdentityWindow = 0
+	}
+	if cfg.SnapshotInterval <= 0 {
+		cfg.SnapshotInterval = time.Minute
+	}
+	if cfg.SnapshotMaxAge <= 0 {
+		cfg.SnapshotMaxAge = time.Hour
+	}
+	if cfg.SnapshotMaxURLs <= 0 {
+		cfg.SnapshotMaxURLs = 100000
+	}
+	if cfg.RedirectMissDelay < 0 {
+		cfg.RedirectMissDelay = 0
+	}
+	if cfg.MaxDeleteBatch <= 0 {
+		cfg.MaxDeleteBatch = 10000
+	}
+	if cfg.MaxHeaderBytes <= 0 {
+		cfg.MaxHeaderBytes = 64 << 10
+	}
+	if cfg.DedupStatus <= 0 {
+		cfg.DedupStatus = 409
+	}
+	if cfg.MaxDescriptionLength <= 0 {
+		cfg.MaxDescriptionLength = 500
+	}
+	if cfg.DBSlowQueryThreshold <= 0 {
+		cfg.DBSlowQueryThreshold = 100 * time.Millisecond
+	}
+	if cfg.DBResetThreshold <= 0 {
+		cfg.DBResetThreshold = 3
+	}
+	if cfg.GRPCMaxRecvBytes <= 0 {
+		cfg.GRPCMaxRecvBytes = 16 << 20
+	}
+	if cfg.GRPCMaxSendBytes <= 0 {
+		cfg.GRPCMaxSendBytes = 16 << 20
+	}
+	if cfg.GRPCKeepaliveTime <= 0 {
+		cfg.GRPCKeepaliveTime = time.Minute
+	}
+	if cfg.GRPCKeepaliveTimeout <= 0 {
+		cfg.GRPCKeepaliveTimeout = 20 * time.Second
+	}
+	if cfg.GRPCMaxConcurrentStreams <= 0 {
+		cfg.GRPCMaxConcurrentStreams = 1000
+	}
+	if cfg.ClickRateLimit < 0 {
+		cfg.ClickRateLimit = 0
+	}
+	if cfg.ShortIDLength <= 0 {
+		cfg.ShortIDLength = 8
+	}
+	if cfg.IDSpaceWarnRatio < 0 {
+		cfg.IDSpaceWarnRatio = 0
+	}
+	if cfg.HotLinksCapacity <= 0 {
+		cfg.HotLinksCapacity = 1000
+	}
+	if cfg.FileWriteAttempts <= 0 {
+		cfg.FileWriteAttempts = 3
+	}
+	if cfg.FileWriteBackoff <= 0 {
+		cfg.FileWriteBackoff = 10 * time.Millisecond
+	}
+	if cfg.FileTempMaxAge <= 0 {
+		cfg.FileTempMaxAge = time.Hour
+	}
+	if cfg.MemoryMaxURLs < 0 {
+		cfg.MemoryMaxURLs = 0
+	}
+	if cfg.MemoryEviction != "reject" && cfg.MemoryEviction != "lru" {
+		cfg.MemoryEviction = "reject"
+	}
+	if cfg.MaxConcurrentBatches < 0 {
+		cfg.MaxConcurrentBatches = 0
+	}
+	if cfg.BatchLimitPolicy != "queue" && cfg.BatchLimitPolicy != "reject" {
+		cfg.BatchLimitPolicy = "queue"
+	}
+	switch cfg.UserIDEncoding {
+	case "base64url", "hex", "base62":
+	default:
+		cfg.UserIDEncoding = "base64url"
+	}
+	if cfg.DefaultLanguage != "en" && cfg.DefaultLanguage != "ru" {
+		cfg.DefaultLanguage = "en"
+	}
+	if cfg.LogPIIMode != "plain" && cfg.LogPIIMode != "hashed" {
+		cfg.LogPIIMode = "plain"
+	}
+	if cfg.RobotsPolicy != "deny" && cfg.RobotsPolicy != "ui" {
+		cfg.RobotsPolicy = "deny"
+	}
+	if cfg.GRPCRealIPKey == "" {
+		cfg.GRPCRealIPKey = "x-real-ip"
+	}
+	cfg.GRPCRealIPKey = strings.ToLower(cfg.GRPCRealIPKey)
+	if cfg.GRPCRequestIDKey == "" {
+		cfg.GRPCRequestIDKey = "x-request-id"
+	}
+	cfg.GRPCRequestIDKey = strings.ToLower(cfg.GRPCRequestIDKey)
+	if cfg.RefQueryKey == "" {
+		cfg.RefQueryKey = "ref"
+	}
 	if !strings.HasPrefix(cfg.BaseURL, "http://") && !strings.HasPrefix(cfg.BaseURL, "https://") {
 		cfg.BaseURL = "http://" + cfg.BaseURL
 	}
+	cfg.BaseURL, cfg.BaseURLCheck = reconcileBaseURL(cfg.BaseURL, cfg.RunAddr, cfg.EnableHTTPS,
+		baseURLSetExplicitly(baseURLEnvSet, explicitFlags["b"], configFile), runAddrEnvSet || explicitFlags["a"])
 	if cfg.FileStoragePath != "" {
 		// Создаём директорию для файла, если она не существует
 		dir := filepath.Dir(cfg.FileStoragePath)
@@ -204,3 +1352,14 @@ func NewConfig() (*Config, error) {
 
 	return cfg, nil
 }
+
+// splitList разбирает список значений, разделённых запятыми, отбрасывая пустые элементы
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -481,3 +482,56 @@ func TestConfig_FileStoragePath(t *testing.T) {
 	_, err = os.Stat(dir)
 	assert.NoError(t, err, "Directory should be created")
 }
+
+// TestReconcileBaseURL_ConfigFileBaseURL проверяет, что base_url из файла конфигурации вместе с адресом сервера
+// из окружения или флага не заменяется выведенным из адреса
+func TestReconcileBaseURL_ConfigFileBaseURL(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	assert.NoError(t, os.WriteFile(configPath, []byte(`{"base_url": "https://short.example"}`), 0644))
+	configFile, err := loadConfigFile(configPath)
+	assert.NoError(t, err)
+
+	baseURLSet := baseURLSetExplicitly(false, false, configFile)
+	assert.True(t, baseURLSet)
+	gotURL, gotCheck := reconcileBaseURL(configFile.BaseURL, ":9090", false, baseURLSet, true)
+	assert.Equal(t, "https://short.example", gotURL)
+	assert.Equal(t, BaseURLMismatch, gotCheck)
+
+	// Без base_url в файле адрес по-прежнему выводится из SERVER_ADDRESS
+	assert.False(t, baseURLSetExplicitly(false, false, &ConfigFile{}))
+	assert.False(t, baseURLSetExplicitly(false, false, nil))
+	gotURL, gotCheck = reconcileBaseURL("http://localhost:8080", ":9090", false, baseURLSetExplicitly(false, false, nil), true)
+	assert.Equal(t, "http://localhost:9090", gotURL)
+	assert.Equal(t, BaseURLDerived, gotCheck)
+}
+
+func TestReconcileBaseURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		baseURL    string
+		runAddr    string
+		https      bool
+		baseURLSet bool
+		runAddrSet bool
+		wantURL    string
+		wantCheck  BaseURLCheck
+	}{
+		{name: "defaults", baseURL: "http://localhost:8080", runAddr: ":8080", wantURL: "http://localhost:8080", wantCheck: BaseURLConsistent},
+		{name: "derived from port", baseURL: "http://localhost:8080", runAddr: ":9090", runAddrSet: true, wantURL: "http://localhost:9090", wantCheck: BaseURLDerived},
+		{name: "derived from bound host", baseURL: "http://localhost:8080", runAddr: "127.0.0.1:9090", runAddrSet: true, wantURL: "http://127.0.0.1:9090", wantCheck: BaseURLDerived},
+		{name: "derived from unspecified host", baseURL: "http://localhost:8080", runAddr: "0.0.0.0:9090", runAddrSet: true, wantURL: "http://localhost:9090", wantCheck: BaseURLDerived},
+		{name: "derived with https", baseURL: "http://localhost:8080", runAddr: ":8443", https: true, runAddrSet: true, wantURL: "https://localhost:8443", wantCheck: BaseURLDerived},
+		{name: "explicit default address", baseURL: "http://localhost:8080", runAddr: ":8080", runAddrSet: true, wantURL: "http://localhost:8080", wantCheck: BaseURLConsistent},
+		{name: "both set consistent", baseURL: "http://short.example:9090", runAddr: ":9090", baseURLSet: true, runAddrSet: true, wantURL: "http://short.example:9090", wantCheck: BaseURLConsistent},
+		{name: "both set mismatch behind proxy", baseURL: "https://short.example", runAddr: ":9090", baseURLSet: true, runAddrSet: true, wantURL: "https://short.example", wantCheck: BaseURLMismatch},
+		{name: "only base URL set", baseURL: "https://short.example", runAddr: ":8080", baseURLSet: true, wantURL: "https://short.example", wantCheck: BaseURLConsistent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotURL, gotCheck := reconcileBaseURL(tt.baseURL, tt.runAddr, tt.https, tt.baseURLSet, tt.runAddrSet)
+			assert.Equal(t, tt.wantURL, gotURL)
+			assert.Equal(t, tt.wantCheck, gotCheck)
+		})
+	}
+}
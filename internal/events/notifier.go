@@ -0,0 +1,117 @@
+// Package events рассылает внутри процесса события об изменении коротких ссылок
+// (создание, удаление, изменение) подписчикам, например живой ленте панели администратора.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Type определяет вид события
+type Type string
+
+const (
+	// Created — короткая ссылка создана
+	Created Type = "created"
+	// Deleted — короткая ссылка помечена удалённой
+	Deleted Type = "deleted"
+	// Updated — у ссылки изменились адрес, владелец или пометки модерации
+	Updated Type = "updated"
+)
+
+// DefaultCapacity — число последних событий, которые хранятся для повторной отправки переподключившимся подписчикам
+const DefaultCapacity = 1000
+
+// subscriberBuffer — размер очереди подписчика; отстающий подписчик отключается и может переподключиться с Last-Event-ID
+const subscriberBuffer = 64
+
+// Event описывает одно изменение ссылки
+type Event struct {
+	ID      uint64    `json:"-"`                  // Порядковый номер события, начиная с 1
+	Type    Type      `json:"-"`                  // Вид события
+	ShortID string    `json:"short_id,omitempty"` // Короткий ID ссылки
+	Host    string    `json:"host,omitempty"`     // Хост при удалении всех ссылок пользователя на него
+	Count   int       `json:"count,omitempty"`    // Число ссылок, затронутых удалением по хосту
+	Time    time.Time `json:"time"`               // Время события
+}
+
+// Notifier хранит кольцевой буфер последних событий и рассылает новые события подписчикам
+// Методы nil-получателя ничего не делают, поэтому источники событий не проверяют, включена ли рассылка
+type Notifier struct {
+	mu          sync.Mutex
+	ring        []Event // Последние события в порядке ID; не длиннее capacity
+	capacity    int
+	lastID      uint64
+	subscribers map[chan Event]struct{}
+	now         func() time.Time
+}
+
+// NewNotifier создаёт Notifier, хранящий не более capacity последних событий; неположительное значение — DefaultCapacity
+func NewNotifier(capacity int) *Notifier {
+	if capacity <= 0 {
+		capacity = DefaultCapacity
+	}
+	return &Notifier{
+		ring:        make([]Event, 0, capacity),
+		capacity:    capacity,
+		subscribers: make(map[chan Event]struct{}),
+		now:         time.Now,
+	}
+}
+
+// Publish присваивает событию очередной ID и время и рассылает его подписчикам
+// Подписчик с заполненной очередью отключается: его канал закрывается без потери уже отправленных событий
+func (n *Notifier) Publish(e Event) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.lastID++
+	e.ID = n.lastID
+	if e.Time.IsZero() {
+		e.Time = n.now()
+	}
+	if len(n.ring) == n.capacity {
+		copy(n.ring, n.ring[1:])
+		n.ring = n.ring[:len(n.ring)-1]
+	}
+	n.ring = append(n.ring, e)
+
+	for ch := range n.subscribers {
+		select {
+		case ch <- e:
+		default:
+			delete(n.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe подписывает на новые события и возвращает хранящиеся события с ID больше lastID для повторной отправки
+// Канал закрывается после cancel или при отставании подписчика; cancel можно вызывать повторно
+func (n *Notifier) Subscribe(lastID uint64) ([]Event, <-chan Event, func()) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var replay []Event
+	if lastID > 0 {
+		for _, e := range n.ring {
+			if e.ID > lastID {
+				replay = append(replay, e)
+			}
+		}
+	}
+	ch := make(chan Event, subscriberBuffer)
+	n.subscribers[ch] = struct{}{}
+	cancel := func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		if _, ok := n.subscribers[ch]; ok {
+			delete(n.subscribers, ch)
+			close(ch)
+		}
+	}
+	return replay, ch, cancel
+}
@@ -0,0 +1,66 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotifier_Replay(t *testing.T) {
+	n := NewNotifier(3)
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		n.Publish(Event{Type: Created, ShortID: id})
+	}
+
+	// В кольце остались только три последних события
+	replay, _, cancel := n.Subscribe(1)
+	defer cancel()
+	assert.Len(t, replay, 3)
+	assert.Equal(t, uint64(3), replay[0].ID)
+	assert.Equal(t, "e", replay[2].ShortID)
+	assert.False(t, replay[2].Time.IsZero())
+
+	replay, _, cancel2 := n.Subscribe(4)
+	defer cancel2()
+	assert.Len(t, replay, 1)
+	assert.Equal(t, uint64(5), replay[0].ID)
+
+	// Без Last-Event-ID история не отправляется
+	replay, _, cancel3 := n.Subscribe(0)
+	defer cancel3()
+	assert.Empty(t, replay)
+}
+
+func TestNotifier_Subscribe(t *testing.T) {
+	n := NewNotifier(0)
+	_, ch, cancel := n.Subscribe(0)
+	n.Publish(Event{Type: Deleted, ShortID: "abc"})
+	e := <-ch
+	assert.Equal(t, uint64(1), e.ID)
+	assert.Equal(t, Deleted, e.Type)
+
+	cancel()
+	cancel()
+	_, ok := <-ch
+	assert.False(t, ok)
+}
+
+func TestNotifier_SlowSubscriberClosed(t *testing.T) {
+	n := NewNotifier(0)
+	_, ch, cancel := n.Subscribe(0)
+	defer cancel()
+	for i := 0; i < subscriberBuffer+1; i++ {
+		n.Publish(Event{Type: Created})
+	}
+
+	received := 0
+	for range ch {
+		received++
+	}
+	assert.Equal(t, subscriberBuffer, received)
+}
+
+func TestNotifier_NilPublish(t *testing.T) {
+	var n *Notifier
+	assert.NotPanics(t, func() { n.Publish(Event{Type: Created}) })
+}
@@ -0,0 +1,172 @@
+// Package features описывает именованные возможности сервиса, которые можно отключить настройкой DISABLED_ENDPOINTS,
+// эндпоинты для списка ENABLED_ENDPOINTS и единую таблицу их соответствия HTTP-маршрутам и методам gRPC
+package features
+
+import (
+	"sort"
+	"strings"
+)
+
+// Имена отключаемых возможностей
+const (
+	Shorten   = "shorten"    // Создание, резервирование, изменение и присвоение одиночных коротких ссылок
+	Batch     = "batch"      // Пакетное создание коротких ссылок
+	Delete    = "delete"     // Удаление ссылок пользователя
+	UserURLs  = "user_urls"  // Список ссылок пользователя
+	Expand    = "expand"     // Получение оригинального URL через API (редирект не затрагивается)
+	Stats     = "stats"      // Статистика сервиса и пользователя
+	UI        = "ui"         // Локализованные HTML-страницы для браузеров
+	GRPCWrite = "grpc_write" // Все изменяющие методы gRPC
+)
+
+// Known содержит все допустимые имена возможностей
+var Known = map[string]struct{}{
+	Shorten:   {},
+	Batch:     {},
+	Delete:    {},
+	UserURLs:  {},
+	Expand:    {},
+	Stats:     {},
+	UI:        {},
+	GRPCWrite: {},
+}
+
+// Имена эндпоинтов для списка EnabledEndpoints; пустой список включает все
+const (
+	EndpointShorten          = "shorten"            // POST /
+	EndpointRedirect         = "redirect"           // GET /{id}
+	EndpointLinkInfo         = "link_info"          // GET /{id}/info
+	EndpointShortenJSON      = "shorten_json"       // POST /api/shorten
+	EndpointShortenBatch     = "shorten_batch"      // POST /api/shorten/batch
+	EndpointExpand           = "expand"             // GET /api/expand/{id}
+	EndpointPing             = "ping"               // GET /ping
+	EndpointReadyz           = "readyz"             // GET /readyz
+	EndpointUserURLs         = "user_urls"          // GET и DELETE /api/user/urls
+	EndpointUserStats        = "user_stats"         // GET /api/user/stats
+	EndpointUserLogout       = "user_logout"        // POST /api/user/logout
+	EndpointUserSwitch       = "user_switch"        // POST /api/user/switch (доверенная подсеть)
+	EndpointUserRotate       = "user_rotate"        // POST /api/user/rotate
+	EndpointURLClaim         = "url_claim"          // POST /api/urls/{id}/claim
+	EndpointURLUpdate        = "url_update"         // PUT /api/urls/{id}
+	EndpointInternalStats    = "internal_stats"     // GET /api/internal/stats
+	EndpointInternalResolve  = "internal_resolve"   // POST /api/internal/resolve
+	EndpointInternalTopUsers = "internal_top_users" // GET /api/internal/users/top
+	EndpointInternalHotLinks = "internal_hot_links" // GET /api/internal/hotlinks
+	EndpointInternalMetrics  = "internal_metrics"   // GET /api/internal/metrics
+	EndpointInternalOwners   = "internal_owners"    // GET /api/internal/url-owners
+	EndpointInternalNSFW     = "internal_nsfw"      // POST /api/internal/flag-nsfw
+	EndpointInternalReserve  = "internal_reserve"   // POST /api/internal/reserve
+	EndpointInternalEvents   = "internal_events"    // GET /api/internal/events/stream
+	EndpointInternalFaults   = "internal_faults"    // POST /api/internal/faults (только при включённом внедрении сбоев)
+	EndpointInternalErrors   = "internal_errors"    // GET и DELETE /api/internal/errors
+)
+
+// Route описывает HTTP-маршрут в таблице Routes
+type Route struct {
+	Endpoint string // Эндпоинт для списка EnabledEndpoints; пустое имя — маршрут не выключается этим списком
+	Feature  string // Возможность для списка DisabledEndpoints; пустое имя — маршрут не отключается
+}
+
+// Routes — единая таблица HTTP-маршрутов ("МЕТОД /шаблон"): по ней применяются и список включённых эндпоинтов,
+// и список отключённых возможностей; новый маршрут обязан быть объявлен здесь
+var Routes = map[string]Route{
+	"GET /robots.txt":                 {},
+	"GET /favicon.ico":                {},
+	"POST /":                          {EndpointShorten, Shorten},
+	"GET /":                           {EndpointShorten, Shorten},
+	"GET /{id}/info":                  {EndpointLinkInfo, ""},
+	"GET /{id}":                       {EndpointRedirect, ""},
+	"POST /api/shorten":               {EndpointShortenJSON, Shorten},
+	"GET /api/shorten":                {EndpointShortenJSON, Shorten},
+	"GET /api/expand/{id}":            {EndpointExpand, Expand},
+	"GET /ping":                       {EndpointPing, ""},
+	"GET /readyz":                     {EndpointReadyz, ""},
+	"POST /api/shorten/batch":         {EndpointShortenBatch, Batch},
+	"GET /api/user/urls":              {EndpointUserURLs, UserURLs},
+	"DELETE /api/user/urls":           {EndpointUserURLs, Delete},
+	"GET /api/user/stats":             {EndpointUserStats, Stats},
+	"POST /api/user/logout":           {EndpointUserLogout, ""},
+	"POST /api/user/rotate":           {EndpointUserRotate, ""},
+	"POST /api/urls/{id}/claim":       {EndpointURLClaim, Shorten},
+	"PUT /api/urls/{id}":              {EndpointURLUpdate, Shorten},
+	"POST /api/user/switch":           {EndpointUserSwitch, ""},
+	"GET /api/internal/stats":         {EndpointInternalStats, Stats},
+	"POST /api/internal/resolve":      {EndpointInternalResolve, Expand},
+	"GET /api/internal/users/top":     {EndpointInternalTopUsers, Stats},
+	"GET /api/internal/hotlinks":      {EndpointInternalHotLinks, ""},
+	"GET /api/internal/metrics":       {EndpointInternalMetrics, ""},
+	"GET /api/internal/url-owners":    {EndpointInternalOwners, ""},
+	"POST /api/internal/flag-nsfw":    {EndpointInternalNSFW, ""},
+	"POST /api/internal/reserve":      {EndpointInternalReserve, Shorten},
+	"GET /api/internal/events/stream": {EndpointInternalEvents, ""},
+	"POST /api/internal/faults":       {EndpointInternalFaults, ""},
+	"GET /api/internal/errors":        {EndpointInternalErrors, ""},
+	"DELETE /api/internal/errors":     {EndpointInternalErrors, ""},
+}
+
+// KnownEndpoint сообщает, объявлен ли эндпоинт name хотя бы у одного маршрута в Routes
+func KnownEndpoint(name string) bool {
+	for _, route := range Routes {
+		if route.Endpoint != "" && route.Endpoint == name {
+			return true
+		}
+	}
+	return false
+}
+
+// GRPCMethods сопоставляет каждый метод сервиса gRPC возможностям, отключение любой из которых его запрещает
+// Новый метод обязан быть объявлен здесь
+var GRPCMethods = map[string][]string{
+	"CreateShortURL":  {Shorten, GRPCWrite},
+	"GetOriginalURL":  {Expand},
+	"ShortenURL":      {Shorten, GRPCWrite},
+	"ExpandURL":       {Expand},
+	"Ping":            nil,
+	"BatchShorten":    {Batch, GRPCWrite},
+	"GetUserURLs":     {UserURLs},
+	"BatchDeleteURLs": {Delete, GRPCWrite},
+	"GetStats":        {Stats},
+	"GetUserStats":    {Stats},
+	"GetTopUsers":     {Stats},
+}
+
+// Set — набор отключённых возможностей; пустой набор ничего не отключает
+type Set map[string]struct{}
+
+// NewSet создаёт набор отключённых возможностей из списка имён
+func NewSet(names []string) Set {
+	set := make(Set, len(names))
+	for _, name := range names {
+		set[name] = struct{}{}
+	}
+	return set
+}
+
+// Unknown возвращает имена из набора, не являющиеся известными возможностями
+func (s Set) Unknown() []string {
+	var unknown []string
+	for name := range s {
+		if _, ok := Known[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// Disabled сообщает, отключена ли возможность
+func (s Set) Disabled(name string) bool {
+	_, ok := s[name]
+	return ok
+}
+
+// GRPCMethodDisabled сообщает, отключён ли метод gRPC; fullMethod — полное имя вида /пакет.Сервис/Метод
+func (s Set) GRPCMethodDisabled(fullMethod string) bool {
+	method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	for _, name := range GRPCMethods[method] {
+		if s.Disabled(name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package grpc
+
+import (
+	"errors"
+
+	"github.com/tempizhere/goshorty/internal/grpc/proto"
+	"github.com/tempizhere/goshorty/internal/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Преобразования между типами models и proto собраны здесь, чтобы обработчики сервера не копировали поля вручную
+
+// createRequestToModel преобразует запрос CreateShortURL в общий запрос на сокращение
+func createRequestToModel(req *proto.CreateShortURLRequest) models.ShortenRequest {
+	return models.ShortenRequest{URL: req.OriginalURL, Tags: req.Tags}
+}
+
+// shortenRequestToModel преобразует запрос ShortenURL в общий запрос на сокращение
+func shortenRequestToModel(req *proto.ShortenURLRequest) models.ShortenRequest {
+	return models.ShortenRequest{URL: req.URL, Tags: req.Tags}
+}
+
+// batchRequestsToModel преобразует элементы пакетного запроса
+func batchRequestsToModel(reqs []*proto.BatchRequest) []models.BatchRequest {
+	result := make([]models.BatchRequest, len(reqs))
+	for i, r := range reqs {
+		result[i] = models.BatchRequest{CorrelationID: r.CorrelationID, OriginalURL: r.OriginalURL}
+	}
+	return result
+}
+
+// batchResponsesToProto преобразует элементы пакетного ответа
+func batchResponsesToProto(resps []models.BatchResponse) []*proto.BatchResponse {
+	result := make([]*proto.BatchResponse, len(resps))
+	for i, r := range resps {
+		result[i] = &proto.BatchResponse{CorrelationID: r.CorrelationID, ShortURL: r.ShortURL, ShortID: r.ShortID}
+	}
+	return result
+}
+
+// shortURLsToProto преобразует список ссылок пользователя
+func shortURLsToProto(urls []models.ShortURLResponse) []*proto.ShortURLResponse {
+	result := make([]*proto.ShortURLResponse, len(urls))
+	for i, u := range urls {
+		result[i] = &proto.ShortURLResponse{ShortURL: u.ShortURL, OriginalURL: u.OriginalURL, ShortID: u.ShortID}
+	}
+	return result
+}
+
+// statsToProto преобразует статистику сервиса
+func statsToProto(stats models.StatsResponse) *proto.GetStatsResponse {
+	return &proto.GetStatsResponse{
+		UrlsCount:     int32(stats.URLs),
+		UsersCount:    int32(stats.Users),
+		Backend:       stats.Backend,
+		UptimeSeconds: stats.UptimeSeconds,
+		GoVersion:     stats.GoVersion,
+		Pid:           int32(stats.PID),
+	}
+}
+
+// userStatsToProto преобразует статистику пользователя
+func userStatsToProto(stats models.UserStats) *proto.GetUserStatsResponse {
+	return &proto.GetUserStatsResponse{
+		Urls:           int32(stats.URLs),
+		Deleted:        int32(stats.Deleted),
+		ClicksTotal:    int32(stats.ClicksTotal),
+		CreatedLast30D: int32(stats.CreatedLast30d),
+	}
+}
+
+// userURLCountsToProto преобразует рейтинг пользователей
+func userURLCountsToProto(users []models.UserURLCount) []*proto.UserURLCount {
+	result := make([]*proto.UserURLCount, len(users))
+	for i, u := range users {
+		result[i] = &proto.UserURLCount{UserId: u.UserID, Urls: int32(u.URLs), Deleted: int32(u.Deleted)}
+	}
+	return result
+}
+
+// validationStatus преобразует ошибку проверки запроса в статус InvalidArgument; остальные ошибки возвращаются как есть
+func validationStatus(err error) error {
+	var validationErr *models.ValidationError
+	if errors.As(err, &validationErr) {
+		return status.Error(codes.InvalidArgument, validationErr.Error())
+	}
+	return err
+}
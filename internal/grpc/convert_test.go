@@ -0,0 +1,56 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/grpc/proto"
+	"github.com/tempizhere/goshorty/internal/models"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestConvert(t *testing.T) {
+	assert.Equal(t, models.ShortenRequest{URL: "https://example.com", Tags: []string{"a"}},
+		createRequestToModel(&proto.CreateShortURLRequest{OriginalURL: "https://example.com", Tags: []string{"a"}}))
+	assert.Equal(t, models.ShortenRequest{URL: "https://example.org"},
+		shortenRequestToModel(&proto.ShortenURLRequest{URL: "https://example.org"}))
+
+	assert.Equal(t, []models.BatchRequest{{CorrelationID: "1", OriginalURL: "https://example.com"}},
+		batchRequestsToModel([]*proto.BatchRequest{{CorrelationID: "1", OriginalURL: "https://example.com"}}))
+	assert.Equal(t, []*proto.BatchResponse{{CorrelationID: "1", ShortURL: "http://localhost/abc", ShortID: "abc"}},
+		batchResponsesToProto([]models.BatchResponse{{CorrelationID: "1", ShortURL: "http://localhost/abc", ShortID: "abc"}}))
+
+	// Пустой список передаётся пустым массивом, а не nil
+	assert.Equal(t, []*proto.ShortURLResponse{}, shortURLsToProto(nil))
+	assert.Equal(t, []*proto.ShortURLResponse{{ShortURL: "http://localhost/abc", OriginalURL: "https://example.com", ShortID: "abc"}},
+		shortURLsToProto([]models.ShortURLResponse{{ShortURL: "http://localhost/abc", OriginalURL: "https://example.com", ShortID: "abc"}}))
+
+	assert.Equal(t, &proto.GetStatsResponse{UrlsCount: 3, UsersCount: 2, Backend: "memory", UptimeSeconds: 10, GoVersion: "go1.24", Pid: 42},
+		statsToProto(models.StatsResponse{URLs: 3, Users: 2, Backend: "memory", UptimeSeconds: 10, GoVersion: "go1.24", PID: 42}))
+	assert.Equal(t, &proto.GetUserStatsResponse{Urls: 5, Deleted: 1, ClicksTotal: 7, CreatedLast30D: 2},
+		userStatsToProto(models.UserStats{URLs: 5, Deleted: 1, ClicksTotal: 7, CreatedLast30d: 2}))
+	assert.Equal(t, []*proto.UserURLCount{{UserId: "user1", Urls: 4, Deleted: 1}},
+		userURLCountsToProto([]models.UserURLCount{{UserID: "user1", URLs: 4, Deleted: 1}}))
+}
+
+func TestServer_ValidatesShortenRequests(t *testing.T) {
+	server := NewServer(service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret"), nil, zap.NewNop())
+	ctx := context.WithValue(context.Background(), userIDKey, "user1")
+
+	// Те же правила, что и у POST /api/shorten: ошибка проверки отдаётся как InvalidArgument с описанием поля
+	_, err := server.CreateShortURL(ctx, &proto.CreateShortURLRequest{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "url: required")
+
+	_, err = server.ShortenURL(ctx, &proto.ShortenURLRequest{URL: "not a url"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "url: invalid URL")
+
+	_, err = server.ShortenURL(ctx, &proto.ShortenURLRequest{URL: "https://example.com", Tags: make([]string, models.MaxTags+1)})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -7,6 +7,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/tempizhere/goshorty/internal/features"
+	"github.com/tempizhere/goshorty/internal/middleware"
 	"github.com/tempizhere/goshorty/internal/service"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
@@ -48,6 +50,8 @@ func AuthInterceptor(svc *service.Service, logger *zap.Logger) grpc.UnaryServerI
 				token := strings.TrimPrefix(authHeader, "Bearer ")
 				userID, err = svc.ParseJWT(token)
 				if err != nil {
+					// Идентификатор из истёкшего токена не используется
+					userID = ""
 					logger.Warn("Invalid JWT token", zap.Error(err))
 				}
 			}
@@ -74,6 +78,9 @@ func AuthInterceptor(svc *service.Service, logger *zap.Logger) grpc.UnaryServerI
 			}
 
 			logger.Info("Generated new JWT for gRPC", zap.String("user_id", userID))
+			if err := svc.RecordIssuedUser(userID); err != nil {
+				logger.Warn("Failed to record issued user", zap.String("user_id", userID), zap.Error(err))
+			}
 		}
 
 		ctx = context.WithValue(ctx, userIDKey, userID)
@@ -81,10 +88,42 @@ func AuthInterceptor(svc *service.Service, logger *zap.Logger) grpc.UnaryServerI
 	}
 }
 
+// clientIPFromContext возвращает IP-адрес клиента из метаданных realIPKey,
+// а при их отсутствии — адрес пира соединения
+func clientIPFromContext(ctx context.Context, realIPKey string) (string, bool) {
+	if realIPKey != "" {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(realIPKey); len(values) > 0 && values[0] != "" {
+				return strings.TrimSpace(values[0]), true
+			}
+		}
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	if tcpAddr, ok := p.Addr.(*net.TCPAddr); ok {
+		return tcpAddr.IP.String(), true
+	}
+	return p.Addr.String(), true
+}
+
+// trustedMethods содержит методы, доступные только из доверенной подсети
+var trustedMethods = map[string]struct{}{
+	"/shortener.v1.ShortenerService/GetStats":    {},
+	"/shortener.v1.ShortenerService/GetTopUsers": {},
+}
+
+// internalTokenKey — ключ метаданных с общим секретом внутренних API (аналог заголовка middleware.InternalTokenHeader)
+const internalTokenKey = "x-internal-token"
+
 // TrustedSubnetInterceptor создаёт интерцептор для проверки доверенной подсети
-func TrustedSubnetInterceptor(trustedSubnet string, logger *zap.Logger) grpc.UnaryServerInterceptor {
+// IP-адрес клиента берётся из метаданных realIPKey (если сервер стоит за L7-прокси), иначе из адреса пира.
+// Если заданы tokens, вызов дополнительно должен передать один из них в метаданных x-internal-token
+func TrustedSubnetInterceptor(trustedSubnet, realIPKey string, logger *zap.Logger, tokens ...string) grpc.UnaryServerInterceptor {
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
-		if info.FullMethod != "/shortener.v1.ShortenerService/GetStats" {
+		if _, ok := trustedMethods[info.FullMethod]; !ok {
 			return handler(ctx, req)
 		}
 
@@ -92,16 +131,11 @@ func TrustedSubnetInterceptor(trustedSubnet string, logger *zap.Logger) grpc.Una
 			return nil, status.Error(codes.PermissionDenied, "trusted subnet not configured")
 		}
 
-		p, ok := peer.FromContext(ctx)
+		clientIP, ok := clientIPFromContext(ctx, realIPKey)
 		if !ok {
 			return nil, status.Error(codes.PermissionDenied, "failed to get peer info")
 		}
 
-		clientIP := p.Addr.String()
-		if tcpAddr, ok := p.Addr.(*net.TCPAddr); ok {
-			clientIP = tcpAddr.IP.String()
-		}
-
 		_, subnet, err := net.ParseCIDR(trustedSubnet)
 		if err != nil {
 			logger.Error("Invalid trusted subnet", zap.String("subnet", trustedSubnet), zap.Error(err))
@@ -114,6 +148,30 @@ func TrustedSubnetInterceptor(trustedSubnet string, logger *zap.Logger) grpc.Una
 			return nil, status.Error(codes.PermissionDenied, "access denied")
 		}
 
+		if len(tokens) > 0 {
+			var presented string
+			if md, ok := metadata.FromIncomingContext(ctx); ok {
+				if values := md.Get(internalTokenKey); len(values) > 0 {
+					presented = values[0]
+				}
+			}
+			if !middleware.ValidInternalToken(presented, tokens) {
+				logger.Warn("Access denied: internal token is missing or invalid",
+					zap.String("ip", clientIP), zap.Bool("token_present", presented != ""))
+				return nil, status.Error(codes.PermissionDenied, "access denied")
+			}
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// DisabledFeaturesInterceptor отклоняет вызовы методов отключённых возможностей с кодом Unimplemented (см. features.GRPCMethods)
+func DisabledFeaturesInterceptor(disabled features.Set) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if disabled.GRPCMethodDisabled(info.FullMethod) {
+			return nil, status.Error(codes.Unimplemented, "method is disabled on this instance")
+		}
 		return handler(ctx, req)
 	}
 }
@@ -137,13 +195,17 @@ func LoggingInterceptor(logger *zap.Logger) grpc.UnaryServerInterceptor {
 			}
 		}
 
-		logger.Info("gRPC request",
+		fields := []zap.Field{
 			zap.String("method", info.FullMethod),
 			zap.String("client_ip", clientIP),
 			zap.String("status_code", code.String()),
 			zap.Duration("duration", time.Since(start)),
 			zap.Error(err),
-		)
+		}
+		if requestID, ok := RequestIDFromContext(ctx); ok {
+			fields = append(fields, zap.String("request_id", requestID))
+		}
+		logger.Info("gRPC request", fields...)
 
 		return resp, err
 	}
@@ -0,0 +1,239 @@
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/config"
+	"github.com/tempizhere/goshorty/internal/features"
+	"github.com/tempizhere/goshorty/internal/grpc/proto"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// jsonCodec сериализует сообщения в JSON, так как типы proto описаны вручную без protoc
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (jsonCodec) Name() string                       { return "json" }
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+// statsServiceDesc описывает только методы статистики для тестового gRPC сервера
+var statsServiceDesc = grpc.ServiceDesc{
+	ServiceName: "shortener.v1.ShortenerService",
+	HandlerType: (*proto.ShortenerServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetStats",
+			Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+				req := new(proto.GetStatsRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/shortener.v1.ShortenerService/GetStats"}
+				handler := func(ctx context.Context, req any) (any, error) {
+					return srv.(proto.ShortenerServiceServer).GetStats(ctx, req.(*proto.GetStatsRequest))
+				}
+				return interceptor(ctx, req, info, handler)
+			},
+		},
+		{
+			MethodName: "GetTopUsers",
+			Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+				req := new(proto.GetTopUsersRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/shortener.v1.ShortenerService/GetTopUsers"}
+				handler := func(ctx context.Context, req any) (any, error) {
+					return srv.(proto.ShortenerServiceServer).GetTopUsers(ctx, req.(*proto.GetTopUsersRequest))
+				}
+				return interceptor(ctx, req, info, handler)
+			},
+		},
+	},
+}
+
+// startBufconnServer запускает gRPC сервер поверх bufconn с TrustedSubnetInterceptor
+func startBufconnServer(t *testing.T, trustedSubnet, realIPKey string, tokens ...string) *grpc.ClientConn {
+	logger := zap.NewNop()
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+
+	listener := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer(grpc.UnaryInterceptor(TrustedSubnetInterceptor(trustedSubnet, realIPKey, logger, tokens...)))
+	srv.RegisterService(&statsServiceDesc, NewServer(svc, nil, logger))
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype("json")),
+	)
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return conn
+}
+
+func TestTrustedSubnetInterceptor_RealIPMetadata(t *testing.T) {
+	conn := startBufconnServer(t, "192.168.1.0/24", "x-real-ip")
+
+	tests := []struct {
+		name     string
+		md       metadata.MD
+		wantCode codes.Code
+	}{
+		{
+			name:     "Trusted IP in metadata",
+			md:       metadata.Pairs("x-real-ip", "192.168.1.10"),
+			wantCode: codes.OK,
+		},
+		{
+			name:     "Untrusted IP in metadata",
+			md:       metadata.Pairs("x-real-ip", "10.0.0.1"),
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "No metadata falls back to peer address",
+			md:       metadata.MD{},
+			wantCode: codes.PermissionDenied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewOutgoingContext(context.Background(), tt.md)
+			resp := new(proto.GetStatsResponse)
+			err := conn.Invoke(ctx, "/shortener.v1.ShortenerService/GetStats", &proto.GetStatsRequest{}, resp)
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			if tt.wantCode == codes.OK {
+				assert.Equal(t, "memory", resp.Backend)
+			}
+		})
+	}
+}
+
+func TestTrustedSubnetInterceptor_GetTopUsers(t *testing.T) {
+	conn := startBufconnServer(t, "192.168.1.0/24", "x-real-ip")
+
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("x-real-ip", "10.0.0.1"))
+	err := conn.Invoke(ctx, "/shortener.v1.ShortenerService/GetTopUsers", &proto.GetTopUsersRequest{Limit: 10}, new(proto.GetTopUsersResponse))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	ctx = metadata.NewOutgoingContext(context.Background(), metadata.Pairs("x-real-ip", "192.168.1.10"))
+	resp := new(proto.GetTopUsersResponse)
+	err = conn.Invoke(ctx, "/shortener.v1.ShortenerService/GetTopUsers", &proto.GetTopUsersRequest{Limit: 10}, resp)
+	assert.NoError(t, err)
+	assert.Empty(t, resp.Users)
+
+	err = conn.Invoke(ctx, "/shortener.v1.ShortenerService/GetTopUsers", &proto.GetTopUsersRequest{Limit: -1}, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestTrustedSubnetInterceptor_CustomMetadataKey(t *testing.T) {
+	conn := startBufconnServer(t, "192.168.1.0/24", "x-forwarded-client")
+
+	// Стандартный ключ игнорируется, если настроен другой
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("x-real-ip", "192.168.1.10"))
+	err := conn.Invoke(ctx, "/shortener.v1.ShortenerService/GetStats", &proto.GetStatsRequest{}, new(proto.GetStatsResponse))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	ctx = metadata.NewOutgoingContext(context.Background(), metadata.Pairs("x-forwarded-client", "192.168.1.10"))
+	err = conn.Invoke(ctx, "/shortener.v1.ShortenerService/GetStats", &proto.GetStatsRequest{}, new(proto.GetStatsResponse))
+	assert.NoError(t, err)
+}
+
+func TestTrustedSubnetInterceptor_ClientIPHeaderNotTrusted(t *testing.T) {
+	cfg := &config.Config{GRPCRealIPKey: "x-real-ip", TrustClientIPHeader: false}
+	conn := startBufconnServer(t, "192.168.1.0/24", RealIPKey(cfg))
+
+	// Без доверия к заголовку подделанные метаданные не дают доступа: решает только адрес пира
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("x-real-ip", "192.168.1.10"))
+	err := conn.Invoke(ctx, "/shortener.v1.ShortenerService/GetStats", &proto.GetStatsRequest{}, new(proto.GetStatsResponse))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	err = conn.Invoke(ctx, "/shortener.v1.ShortenerService/GetTopUsers", &proto.GetTopUsersRequest{Limit: 10}, new(proto.GetTopUsersResponse))
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestTrustedSubnetInterceptor_InternalToken(t *testing.T) {
+	conn := startBufconnServer(t, "192.168.1.0/24", "x-real-ip", "old", "new")
+
+	tests := []struct {
+		name     string
+		md       metadata.MD
+		wantCode codes.Code
+	}{
+		{name: "Subnet ok, token missing", md: metadata.Pairs("x-real-ip", "192.168.1.10"), wantCode: codes.PermissionDenied},
+		{name: "Subnet ok, token wrong", md: metadata.Pairs("x-real-ip", "192.168.1.10", "x-internal-token", "guess"), wantCode: codes.PermissionDenied},
+		{name: "Subnet bad, token ok", md: metadata.Pairs("x-real-ip", "10.0.0.1", "x-internal-token", "new"), wantCode: codes.PermissionDenied},
+		{name: "Both ok", md: metadata.Pairs("x-real-ip", "192.168.1.10", "x-internal-token", "new"), wantCode: codes.OK},
+		{name: "Rotation accepts old token", md: metadata.Pairs("x-real-ip", "192.168.1.10", "x-internal-token", "old"), wantCode: codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewOutgoingContext(context.Background(), tt.md)
+			err := conn.Invoke(ctx, "/shortener.v1.ShortenerService/GetStats", &proto.GetStatsRequest{}, new(proto.GetStatsResponse))
+			assert.Equal(t, tt.wantCode, status.Code(err))
+		})
+	}
+}
+
+func TestDisabledFeaturesInterceptor(t *testing.T) {
+	// Каждый метод сервиса обязан объявить возможности в общей таблице
+	serviceType := reflect.TypeOf((*proto.ShortenerServiceServer)(nil)).Elem()
+	assert.Len(t, features.GRPCMethods, serviceType.NumMethod())
+	for i := 0; i < serviceType.NumMethod(); i++ {
+		_, declared := features.GRPCMethods[serviceType.Method(i).Name]
+		assert.True(t, declared, "method %s is missing from features.GRPCMethods", serviceType.Method(i).Name)
+	}
+
+	interceptor := DisabledFeaturesInterceptor(features.NewSet([]string{features.GRPCWrite, features.Stats}))
+	handler := func(ctx context.Context, req any) (any, error) {
+		return "ok", nil
+	}
+	tests := []struct {
+		method   string
+		wantCode codes.Code
+	}{
+		{method: "CreateShortURL", wantCode: codes.Unimplemented},
+		{method: "ShortenURL", wantCode: codes.Unimplemented},
+		{method: "BatchShorten", wantCode: codes.Unimplemented},
+		{method: "BatchDeleteURLs", wantCode: codes.Unimplemented},
+		{method: "GetStats", wantCode: codes.Unimplemented},
+		{method: "ExpandURL", wantCode: codes.OK},
+		{method: "GetUserURLs", wantCode: codes.OK},
+		{method: "Ping", wantCode: codes.OK},
+	}
+	for _, tt := range tests {
+		info := &grpc.UnaryServerInfo{FullMethod: "/shortener.v1.ShortenerService/" + tt.method}
+		resp, err := interceptor(context.Background(), nil, info, handler)
+		assert.Equal(t, tt.wantCode, status.Code(err), tt.method)
+		if tt.wantCode == codes.OK {
+			assert.Equal(t, "ok", resp)
+		}
+	}
+}
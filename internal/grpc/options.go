@@ -0,0 +1,58 @@
+package grpc
+
+import (
+	"math"
+	"time"
+
+	"github.com/tempizhere/goshorty/internal/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+)
+
+// minClientKeepaliveTime — минимальный интервал keepalive-пингов клиента;
+// клиент, пингующий чаще, получает GOAWAY, чтобы пинги не нагружали сервер
+const minClientKeepaliveTime = 10 * time.Second
+
+// Options возвращает параметры gRPC сервера из конфигурации: лимиты размера сообщений,
+// keepalive и число одновременных потоков на соединение
+// Нулевые значения пропускаются, и для них действуют значения библиотеки по умолчанию
+// Сообщения больше лимита отклоняются с кодом ResourceExhausted ещё до вызова обработчика
+func Options(cfg *config.Config) []grpc.ServerOption {
+	var opts []grpc.ServerOption
+	if cfg.GRPCMaxRecvBytes > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(cfg.GRPCMaxRecvBytes))
+	}
+	if cfg.GRPCMaxSendBytes > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(cfg.GRPCMaxSendBytes))
+	}
+	if cfg.GRPCKeepaliveTime > 0 || cfg.GRPCKeepaliveTimeout > 0 {
+		opts = append(opts,
+			grpc.KeepaliveParams(keepalive.ServerParameters{
+				Time:    cfg.GRPCKeepaliveTime,
+				Timeout: cfg.GRPCKeepaliveTimeout,
+			}),
+			grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+				MinTime:             minClientKeepaliveTime,
+				PermitWithoutStream: true,
+			}),
+		)
+	}
+	if cfg.GRPCMaxConcurrentStreams > 0 {
+		streams := uint32(math.MaxUint32)
+		if uint64(cfg.GRPCMaxConcurrentStreams) < math.MaxUint32 {
+			streams = uint32(cfg.GRPCMaxConcurrentStreams)
+		}
+		opts = append(opts, grpc.MaxConcurrentStreams(streams))
+	}
+	return opts
+}
+
+// RealIPKey возвращает ключ метаданных с IP клиента для TrustedSubnetInterceptor
+// При выключенном TrustClientIPHeader возвращается пустая строка: метаданные задаёт сам клиент,
+// поэтому без прокси проверка доверенной подсети идёт только по адресу пира
+func RealIPKey(cfg *config.Config) string {
+	if !cfg.TrustClientIPHeader {
+		return ""
+	}
+	return cfg.GRPCRealIPKey
+}
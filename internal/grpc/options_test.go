@@ -0,0 +1,105 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/config"
+	"github.com/tempizhere/goshorty/internal/grpc/proto"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     config.Config
+		wantLen int
+	}{
+		{name: "Empty config keeps library defaults", cfg: config.Config{}, wantLen: 0},
+		{name: "Message limits", cfg: config.Config{GRPCMaxRecvBytes: 1024, GRPCMaxSendBytes: 2048}, wantLen: 2},
+		{name: "Keepalive adds enforcement policy", cfg: config.Config{GRPCKeepaliveTime: time.Minute}, wantLen: 2},
+		{name: "Concurrent streams", cfg: config.Config{GRPCMaxConcurrentStreams: 100}, wantLen: 1},
+		{
+			name: "All settings",
+			cfg: config.Config{
+				GRPCMaxRecvBytes:         1024,
+				GRPCMaxSendBytes:         2048,
+				GRPCKeepaliveTime:        time.Minute,
+				GRPCKeepaliveTimeout:     20 * time.Second,
+				GRPCMaxConcurrentStreams: 100,
+			},
+			wantLen: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Len(t, Options(&tt.cfg), tt.wantLen)
+		})
+	}
+}
+
+// startLimitedServer запускает тестовый gRPC сервер поверх bufconn с параметрами из cfg
+func startLimitedServer(t *testing.T, cfg *config.Config) *grpc.ClientConn {
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+	passthrough := func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(ctx, req)
+	}
+
+	listener := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer(append(Options(cfg), grpc.UnaryInterceptor(passthrough))...)
+	srv.RegisterService(&statsServiceDesc, NewServer(svc, nil, zap.NewNop()))
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype("json")),
+	)
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return conn
+}
+
+func TestOptions_MaxRecvBytes(t *testing.T) {
+	conn := startLimitedServer(t, &config.Config{GRPCMaxRecvBytes: 1024})
+
+	// Неизвестные поля codec отбрасывает, поэтому размер запроса задаётся произвольным полем
+	small := map[string]string{"padding": "x"}
+	err := conn.Invoke(context.Background(), "/shortener.v1.ShortenerService/GetStats", small, new(proto.GetStatsResponse))
+	assert.NoError(t, err)
+
+	large := map[string]string{"padding": strings.Repeat("x", 2048)}
+	err = conn.Invoke(context.Background(), "/shortener.v1.ShortenerService/GetStats", large, new(proto.GetStatsResponse))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "larger than max")
+
+	// После отклонённого сообщения соединение остаётся рабочим
+	err = conn.Invoke(context.Background(), "/shortener.v1.ShortenerService/GetStats", small, new(proto.GetStatsResponse))
+	assert.NoError(t, err)
+}
+
+func TestOptions_MaxSendBytes(t *testing.T) {
+	conn := startLimitedServer(t, &config.Config{GRPCMaxSendBytes: 16})
+
+	err := conn.Invoke(context.Background(), "/shortener.v1.ShortenerService/GetStats", &proto.GetStatsRequest{}, new(proto.GetStatsResponse))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "larger than max")
+}
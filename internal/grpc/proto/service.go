@@ -18,6 +18,8 @@ type ShortenerServiceServer interface {
 	GetUserURLs(ctx context.Context, req *GetUserURLsRequest) (*GetUserURLsResponse, error)
 	BatchDeleteURLs(ctx context.Context, req *BatchDeleteURLsRequest) (*BatchDeleteURLsResponse, error)
 	GetStats(ctx context.Context, req *GetStatsRequest) (*GetStatsResponse, error)
+	GetUserStats(ctx context.Context, req *GetUserStatsRequest) (*GetUserStatsResponse, error)
+	GetTopUsers(ctx context.Context, req *GetTopUsersRequest) (*GetTopUsersResponse, error)
 }
 
 // UnimplementedShortenerServiceServer предоставляет базовую реализацию интерфейса
@@ -68,6 +70,16 @@ func (UnimplementedShortenerServiceServer) GetStats(ctx context.Context, req *Ge
 	return nil, nil
 }
 
+// GetUserStats предоставляет базовую реализацию получения статистики пользователя
+func (UnimplementedShortenerServiceServer) GetUserStats(ctx context.Context, req *GetUserStatsRequest) (*GetUserStatsResponse, error) {
+	return nil, nil
+}
+
+// GetTopUsers предоставляет базовую реализацию получения рейтинга пользователей
+func (UnimplementedShortenerServiceServer) GetTopUsers(ctx context.Context, req *GetTopUsersRequest) (*GetTopUsersResponse, error) {
+	return nil, nil
+}
+
 // RegisterShortenerServiceServer регистрирует реализацию сервиса в gRPC сервере
 func RegisterShortenerServiceServer(s *grpc.Server, srv ShortenerServiceServer) {
 	// В реальном проекте это было бы автоматически сгенерировано protoc
@@ -3,13 +3,15 @@ package proto
 
 // CreateShortURLRequest представляет запрос на создание короткого URL
 type CreateShortURLRequest struct {
-	OriginalURL string `json:"original_url"`
+	OriginalURL string   `json:"original_url"`
+	Tags        []string `json:"tags,omitempty"`
 }
 
 // CreateShortURLResponse представляет ответ с созданным коротким URL
 type CreateShortURLResponse struct {
 	ShortURL  string `json:"short_url"`
 	URLExists bool   `json:"url_exists"`
+	ShortID   string `json:"short_id"`
 }
 
 // GetOriginalURLRequest представляет запрос на получение оригинального URL
@@ -26,7 +28,8 @@ type GetOriginalURLResponse struct {
 
 // ShortenURLRequest представляет JSON запрос на сокращение URL
 type ShortenURLRequest struct {
-	URL string `json:"url"`
+	URL  string   `json:"url"`
+	Tags []string `json:"tags,omitempty"`
 }
 
 // ShortenURLResponse представляет JSON ответ с коротким URL
@@ -64,6 +67,7 @@ type BatchRequest struct {
 type BatchResponse struct {
 	CorrelationID string `json:"correlation_id"`
 	ShortURL      string `json:"short_url"`
+	ShortID       string `json:"short_id"`
 }
 
 // BatchShortenRequest представляет запрос пакетного сокращения
@@ -84,6 +88,7 @@ type GetUserURLsRequest struct{}
 type ShortURLResponse struct {
 	ShortURL    string `json:"short_url"`
 	OriginalURL string `json:"original_url"`
+	ShortID     string `json:"short_id"`
 }
 
 // GetUserURLsResponse представляет ответ со списком URL пользователя
@@ -106,6 +111,38 @@ type GetStatsRequest struct{}
 
 // GetStatsResponse представляет ответ со статистикой
 type GetStatsResponse struct {
-	UrlsCount  int32 `json:"urls_count"`
-	UsersCount int32 `json:"users_count"`
+	UrlsCount     int32  `json:"urls_count"`
+	UsersCount    int32  `json:"users_count"`
+	Backend       string `json:"backend"`
+	UptimeSeconds int64  `json:"uptime_seconds"`
+	GoVersion     string `json:"go_version"`
+	Pid           int32  `json:"pid"`
+}
+
+// GetUserStatsRequest представляет запрос статистики пользователя
+type GetUserStatsRequest struct{}
+
+// GetUserStatsResponse представляет ответ со статистикой пользователя
+type GetUserStatsResponse struct {
+	Urls           int32 `json:"urls"`
+	Deleted        int32 `json:"deleted"`
+	ClicksTotal    int32 `json:"clicks_total"`
+	CreatedLast30D int32 `json:"created_last_30d"`
+}
+
+// GetTopUsersRequest представляет запрос рейтинга пользователей
+type GetTopUsersRequest struct {
+	Limit int32 `json:"limit"`
+}
+
+// UserURLCount представляет количество URL пользователя в рейтинге
+type UserURLCount struct {
+	UserId  string `json:"user_id"`
+	Urls    int32  `json:"urls"`
+	Deleted int32  `json:"deleted"`
+}
+
+// GetTopUsersResponse представляет ответ с рейтингом пользователей
+type GetTopUsersResponse struct {
+	Users []*UserURLCount `json:"users"`
 }
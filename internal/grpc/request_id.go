@@ -0,0 +1,73 @@
+package grpc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// requestIDKey — ключ контекста с идентификатором запроса
+const requestIDKey contextKey = "requestID"
+
+// maxRequestIDLen ограничивает длину идентификатора запроса, принятого от клиента
+const maxRequestIDLen = 128
+
+// RequestIDFromContext возвращает идентификатор запроса, сохранённый RequestIDInterceptor
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey).(string)
+	return id, ok && id != ""
+}
+
+// validRequestID сообщает, можно ли взять идентификатор клиента как есть: непустой,
+// не длиннее maxRequestIDLen и только из видимых символов ASCII, чтобы он не ломал строки логов
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID генерирует случайный идентификатор запроса
+func newRequestID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// RequestIDInterceptor создаёт интерцептор, который берёт идентификатор запроса из метаданных key,
+// а при его отсутствии или некорректном значении генерирует новый. Идентификатор сохраняется в контексте
+// (см. RequestIDFromContext) и возвращается клиенту в заголовке ответа с тем же ключом
+// Интерцептор должен стоять в цепочке перед LoggingInterceptor, чтобы идентификатор попал в журнал
+func RequestIDInterceptor(key string, logger *zap.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var id string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(key); len(values) > 0 && validRequestID(values[0]) {
+				id = values[0]
+			}
+		}
+		if id == "" {
+			var err error
+			if id, err = newRequestID(); err != nil {
+				logger.Error("Failed to generate request ID", zap.Error(err))
+				return handler(ctx, req)
+			}
+		}
+
+		if err := grpc.SetHeader(ctx, metadata.Pairs(key, id)); err != nil {
+			logger.Debug("Failed to set request ID header", zap.Error(err))
+		}
+		return handler(context.WithValue(ctx, requestIDKey, id), req)
+	}
+}
@@ -0,0 +1,104 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/grpc/proto"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// startRequestIDServer запускает gRPC сервер поверх bufconn с RequestIDInterceptor и LoggingInterceptor,
+// записывающим журнал в observer
+func startRequestIDServer(t *testing.T) (*grpc.ClientConn, *observer.ObservedLogs) {
+	core, logs := observer.New(zap.InfoLevel)
+	logger := zap.New(core)
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+
+	listener := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		RequestIDInterceptor("x-request-id", logger),
+		LoggingInterceptor(logger),
+	))
+	srv.RegisterService(&statsServiceDesc, NewServer(svc, nil, logger))
+	go func() {
+		_ = srv.Serve(listener)
+	}()
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.CallContentSubtype("json")),
+	)
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return conn, logs
+}
+
+func TestRequestIDInterceptor(t *testing.T) {
+	tests := []struct {
+		name     string
+		md       metadata.MD
+		wantID   string
+		generate bool // Идентификатор клиента не принимается, ожидается сгенерированный
+	}{
+		{name: "Provided", md: metadata.Pairs("x-request-id", "req-42"), wantID: "req-42"},
+		{name: "Missing", md: metadata.MD{}, generate: true},
+		{name: "WithSpaces", md: metadata.Pairs("x-request-id", "bad id"), generate: true},
+		{name: "TooLong", md: metadata.Pairs("x-request-id", strings.Repeat("a", maxRequestIDLen+1)), generate: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, logs := startRequestIDServer(t)
+
+			var header metadata.MD
+			ctx := metadata.NewOutgoingContext(context.Background(), tt.md)
+			err := conn.Invoke(ctx, "/shortener.v1.ShortenerService/GetStats", &proto.GetStatsRequest{}, new(proto.GetStatsResponse), grpc.Header(&header))
+			assert.NoError(t, err)
+
+			entries := logs.FilterMessage("gRPC request").All()
+			if !assert.Len(t, entries, 1) {
+				return
+			}
+			logged, ok := entries[0].ContextMap()["request_id"].(string)
+			assert.True(t, ok)
+			if tt.generate {
+				assert.Len(t, logged, 32)
+				assert.True(t, validRequestID(logged))
+			} else {
+				assert.Equal(t, tt.wantID, logged)
+			}
+			// Клиент получает тот же идентификатор в заголовке ответа
+			assert.Equal(t, []string{logged}, header.Get("x-request-id"))
+		})
+	}
+}
+
+func TestRequestIDInterceptor_GeneratesUniqueIDs(t *testing.T) {
+	conn, logs := startRequestIDServer(t)
+	for i := 0; i < 2; i++ {
+		err := conn.Invoke(context.Background(), "/shortener.v1.ShortenerService/GetStats", &proto.GetStatsRequest{}, new(proto.GetStatsResponse))
+		assert.NoError(t, err)
+	}
+
+	entries := logs.FilterMessage("gRPC request").All()
+	if assert.Len(t, entries, 2) {
+		assert.NotEqual(t, entries[0].ContextMap()["request_id"], entries[1].ContextMap()["request_id"])
+	}
+}
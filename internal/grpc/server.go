@@ -6,7 +6,6 @@ import (
 	"errors"
 
 	"github.com/tempizhere/goshorty/internal/grpc/proto"
-	"github.com/tempizhere/goshorty/internal/models"
 	"github.com/tempizhere/goshorty/internal/repository"
 	"github.com/tempizhere/goshorty/internal/service"
 	"go.uber.org/zap"
@@ -33,8 +32,9 @@ func NewServer(svc *service.Service, db repository.Database, logger *zap.Logger)
 
 // CreateShortURL обрабатывает создание короткого URL
 func (s *Server) CreateShortURL(ctx context.Context, req *proto.CreateShortURLRequest) (*proto.CreateShortURLResponse, error) {
-	if req.OriginalURL == "" {
-		return nil, status.Error(codes.InvalidArgument, "original URL is required")
+	shortenReq := createRequestToModel(req)
+	if err := shortenReq.Validate(); err != nil {
+		return nil, validationStatus(err)
 	}
 
 	userID, err := getUserIDFromContext(ctx)
@@ -42,12 +42,13 @@ func (s *Server) CreateShortURL(ctx context.Context, req *proto.CreateShortURLRe
 		return nil, err
 	}
 
-	shortURL, err := s.svc.CreateShortURL(req.OriginalURL, userID)
+	id, shortURL, err := s.svc.CreateShortURLWithTags(shortenReq.URL, userID, shortenReq.Tags)
 	if err != nil {
 		if errors.Is(err, repository.ErrURLExists) {
 			return &proto.CreateShortURLResponse{
 				ShortURL:  shortURL,
 				URLExists: true,
+				ShortID:   id,
 			}, nil
 		}
 		return nil, s.mapError(err)
@@ -56,6 +57,7 @@ func (s *Server) CreateShortURL(ctx context.Context, req *proto.CreateShortURLRe
 	return &proto.CreateShortURLResponse{
 		ShortURL:  shortURL,
 		URLExists: false,
+		ShortID:   id,
 	}, nil
 }
 
@@ -65,9 +67,15 @@ func (s *Server) GetOriginalURL(ctx context.Context, req *proto.GetOriginalURLRe
 		return nil, status.Error(codes.InvalidArgument, "short ID is required")
 	}
 
-	originalURL, exists := s.svc.GetOriginalURL(req.ShortID)
+	originalURL, exists, err := s.svc.GetOriginalURL(req.ShortID)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, "storage unavailable")
+	}
 	if !exists {
-		u, found := s.svc.Get(req.ShortID)
+		u, found, err := s.svc.Get(req.ShortID)
+		if err != nil {
+			return nil, status.Error(codes.Unavailable, "storage unavailable")
+		}
 		if found && u.DeletedFlag {
 			return &proto.GetOriginalURLResponse{
 				Found:     false,
@@ -88,8 +96,9 @@ func (s *Server) GetOriginalURL(ctx context.Context, req *proto.GetOriginalURLRe
 
 // ShortenURL обрабатывает JSON API для сокращения URL
 func (s *Server) ShortenURL(ctx context.Context, req *proto.ShortenURLRequest) (*proto.ShortenURLResponse, error) {
-	if req.URL == "" {
-		return nil, status.Error(codes.InvalidArgument, "URL is required")
+	shortenReq := shortenRequestToModel(req)
+	if err := shortenReq.Validate(); err != nil {
+		return nil, validationStatus(err)
 	}
 
 	userID, err := getUserIDFromContext(ctx)
@@ -97,7 +106,7 @@ func (s *Server) ShortenURL(ctx context.Context, req *proto.ShortenURLRequest) (
 		return nil, err
 	}
 
-	shortURL, err := s.svc.CreateShortURL(req.URL, userID)
+	_, shortURL, err := s.svc.CreateShortURLWithTags(shortenReq.URL, userID, shortenReq.Tags)
 	if err != nil {
 		if errors.Is(err, repository.ErrURLExists) {
 			return &proto.ShortenURLResponse{
@@ -120,7 +129,10 @@ func (s *Server) ExpandURL(ctx context.Context, req *proto.ExpandURLRequest) (*p
 		return nil, status.Error(codes.InvalidArgument, "short ID is required")
 	}
 
-	originalURL, exists := s.svc.GetOriginalURL(req.ShortID)
+	originalURL, exists, err := s.svc.GetOriginalURL(req.ShortID)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, "storage unavailable")
+	}
 	if !exists {
 		return &proto.ExpandURLResponse{
 			Found: false,
@@ -156,42 +168,22 @@ func (s *Server) BatchShorten(ctx context.Context, req *proto.BatchShortenReques
 		return nil, err
 	}
 
-	requests := make([]models.BatchRequest, len(req.BatchRequests))
-	for i, r := range req.BatchRequests {
-		requests[i] = models.BatchRequest{
-			CorrelationID: r.CorrelationID,
-			OriginalURL:   r.OriginalURL,
-		}
-	}
-
-	responses, err := s.svc.BatchShorten(requests, userID)
+	responses, err := s.svc.BatchShortenContext(ctx, batchRequestsToModel(req.BatchRequests), userID)
 	if err != nil {
 		if errors.Is(err, repository.ErrURLExists) {
-			protoResponses := make([]*proto.BatchResponse, len(responses))
-			for i, r := range responses {
-				protoResponses[i] = &proto.BatchResponse{
-					CorrelationID: r.CorrelationID,
-					ShortURL:      r.ShortURL,
-				}
-			}
 			return &proto.BatchShortenResponse{
-				BatchResponses: protoResponses,
+				BatchResponses: batchResponsesToProto(responses),
 				HasConflicts:   true,
 			}, nil
 		}
-		return nil, s.mapError(err)
-	}
-
-	protoResponses := make([]*proto.BatchResponse, len(responses))
-	for i, r := range responses {
-		protoResponses[i] = &proto.BatchResponse{
-			CorrelationID: r.CorrelationID,
-			ShortURL:      r.ShortURL,
+		if ctx.Err() != nil {
+			return nil, status.FromContextError(ctx.Err()).Err()
 		}
+		return nil, s.mapError(err)
 	}
 
 	return &proto.BatchShortenResponse{
-		BatchResponses: protoResponses,
+		BatchResponses: batchResponsesToProto(responses),
 		HasConflicts:   false,
 	}, nil
 }
@@ -203,24 +195,15 @@ func (s *Server) GetUserURLs(ctx context.Context, req *proto.GetUserURLsRequest)
 		return nil, err
 	}
 
-	urls, err := s.svc.GetURLsByUserID(userID)
+	urls, err := s.svc.GetURLsByUserIDContext(ctx, userID)
 	if err != nil {
-		return nil, status.Error(codes.Internal, "failed to get user URLs")
-	}
-
-	if len(urls) == 0 {
-		return &proto.GetUserURLsResponse{UserUrls: []*proto.ShortURLResponse{}}, nil
-	}
-
-	protoURLs := make([]*proto.ShortURLResponse, len(urls))
-	for i, u := range urls {
-		protoURLs[i] = &proto.ShortURLResponse{
-			ShortURL:    u.ShortURL,
-			OriginalURL: u.OriginalURL,
+		if ctx.Err() != nil {
+			return nil, status.FromContextError(ctx.Err()).Err()
 		}
+		return nil, status.Error(codes.Internal, "failed to get user URLs")
 	}
 
-	return &proto.GetUserURLsResponse{UserUrls: protoURLs}, nil
+	return &proto.GetUserURLsResponse{UserUrls: shortURLsToProto(urls)}, nil
 }
 
 // BatchDeleteURLs удаляет URL пакетно
@@ -234,23 +217,62 @@ func (s *Server) BatchDeleteURLs(ctx context.Context, req *proto.BatchDeleteURLs
 		return nil, err
 	}
 
-	s.svc.BatchDeleteAsync(userID, req.ShortIds)
+	// Дожидаемся результата, чтобы Success отражал фактическое удаление; отмена вызова не прерывает удаление
+	select {
+	case err := <-s.svc.BatchDeleteAsyncResult(userID, req.ShortIds):
+		if err != nil {
+			return nil, status.Error(codes.Internal, "failed to delete URLs")
+		}
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
 
 	return &proto.BatchDeleteURLsResponse{Success: true}, nil
 }
 
 // GetStats возвращает статистику сервиса
 func (s *Server) GetStats(ctx context.Context, req *proto.GetStatsRequest) (*proto.GetStatsResponse, error) {
-	urls, users, err := s.svc.GetStats()
+	stats, err := s.svc.GetDetailedStatsContext(ctx)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
 		s.logger.Error("Failed to get stats", zap.Error(err))
 		return nil, status.Error(codes.Internal, "failed to get statistics")
 	}
 
-	return &proto.GetStatsResponse{
-		UrlsCount:  int32(urls),
-		UsersCount: int32(users),
-	}, nil
+	return statsToProto(stats), nil
+}
+
+// GetUserStats возвращает статистику вызывающего пользователя
+func (s *Server) GetUserStats(ctx context.Context, req *proto.GetUserStatsRequest) (*proto.GetUserStatsResponse, error) {
+	userID, err := getUserIDFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := s.svc.GetUserStats(userID)
+	if err != nil {
+		s.logger.Error("Failed to get user stats", zap.String("user_id", userID), zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to get user statistics")
+	}
+
+	return userStatsToProto(stats), nil
+}
+
+// GetTopUsers возвращает пользователей с наибольшим числом активных URL
+func (s *Server) GetTopUsers(ctx context.Context, req *proto.GetTopUsersRequest) (*proto.GetTopUsersResponse, error) {
+	if req.Limit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid limit")
+	}
+
+	users, err := s.svc.TopUsers(int(req.Limit))
+	if err != nil {
+		s.logger.Error("Failed to get top users", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to get top users")
+	}
+
+	return &proto.GetTopUsersResponse{Users: userURLCountsToProto(users)}, nil
 }
 
 // getUserIDFromContext извлекает UserID из контекста
@@ -270,11 +292,15 @@ func (s *Server) mapError(err error) error {
 	switch {
 	case errors.Is(err, repository.ErrURLExists):
 		return status.Error(codes.AlreadyExists, "URL already exists")
+	case errors.Is(err, repository.ErrStorageFull):
+		return status.Error(codes.ResourceExhausted, "storage is full")
+	case errors.Is(err, service.ErrBatchLimit):
+		return status.Error(codes.ResourceExhausted, "too many concurrent batch operations")
 	case errors.Is(err, service.ErrEmptyURL):
 		return status.Error(codes.InvalidArgument, "empty URL provided")
 	case errors.Is(err, service.ErrEmptyID):
 		return status.Error(codes.InvalidArgument, "empty ID provided")
-	case err.Error() == "invalid URL":
+	case errors.Is(err, service.ErrInvalidURL):
 		return status.Error(codes.InvalidArgument, "invalid URL format")
 	default:
 		s.logger.Error("Unexpected error", zap.Error(err))
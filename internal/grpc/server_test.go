@@ -0,0 +1,90 @@
+package grpc
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/grpc/proto"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
+)
+
+func TestServer_ShortIDField(t *testing.T) {
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+	server := NewServer(svc, nil, zap.NewNop())
+	ctx := context.WithValue(context.Background(), userIDKey, "user1")
+
+	created, err := server.CreateShortURL(ctx, &proto.CreateShortURLRequest{OriginalURL: "https://example.com"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, created.ShortID)
+	assert.Equal(t, "http://localhost:8080/"+created.ShortID, created.ShortURL)
+
+	// При конфликте передаётся код существующей ссылки
+	existing, err := server.CreateShortURL(ctx, &proto.CreateShortURLRequest{OriginalURL: "https://example.com"})
+	assert.NoError(t, err)
+	assert.True(t, existing.URLExists)
+	assert.Equal(t, created.ShortID, existing.ShortID)
+
+	batch, err := server.BatchShorten(ctx, &proto.BatchShortenRequest{BatchRequests: []*proto.BatchRequest{
+		{CorrelationID: "1", OriginalURL: "https://example.org"},
+	}})
+	assert.NoError(t, err)
+	assert.Len(t, batch.BatchResponses, 1)
+	assert.Equal(t, "http://localhost:8080/"+batch.BatchResponses[0].ShortID, batch.BatchResponses[0].ShortURL)
+
+	urls, err := server.GetUserURLs(ctx, &proto.GetUserURLsRequest{})
+	assert.NoError(t, err)
+	assert.Len(t, urls.UserUrls, 2)
+	for _, u := range urls.UserUrls {
+		assert.Equal(t, "http://localhost:8080/"+u.ShortID, u.ShortURL)
+	}
+}
+
+func TestServer_CreateWithTags(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	svc := service.NewService(repo, "http://localhost:8080", "secret")
+	server := NewServer(svc, nil, zap.NewNop())
+	ctx := context.WithValue(context.Background(), userIDKey, "user1")
+
+	created, err := server.CreateShortURL(ctx, &proto.CreateShortURLRequest{
+		OriginalURL: "https://example.com",
+		Tags:        []string{" news ", "news", "", "promo"},
+	})
+	assert.NoError(t, err)
+	shortened, err := server.ShortenURL(ctx, &proto.ShortenURLRequest{URL: "https://example.org", Tags: []string{"docs"}})
+	assert.NoError(t, err)
+
+	// Метки нормализуются так же, как в HTTP API
+	stored, ok, err := repo.Get(created.ShortID)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"news", "promo"}, stored.Tags)
+	stored, ok, err = repo.Get(strings.TrimPrefix(shortened.Result, "http://localhost:8080/"))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"docs"}, stored.Tags)
+}
+
+func TestServer_PingDatabaseHolder(t *testing.T) {
+	holder := repository.NewDatabaseHolder(nil)
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "secret")
+	server := NewServer(svc, holder, zap.NewNop())
+
+	resp, err := server.Ping(context.Background(), &proto.PingRequest{})
+	assert.NoError(t, err)
+	assert.False(t, resp.DatabaseAvailable)
+
+	// Подключение, появившееся после старта, видно без пересоздания сервера
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	holder.Set(db)
+	resp, err = server.Ping(context.Background(), &proto.PingRequest{})
+	assert.NoError(t, err)
+	assert.True(t, resp.DatabaseAvailable)
+	mock.ExpectClose()
+	assert.NoError(t, holder.Close())
+}
@@ -4,10 +4,13 @@ package middleware
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
 	"net/http"
+	"strings"
 	"time"
 
-	"github.com/tempizhere/goshorty/internal/service"
 	"go.uber.org/zap"
 )
 
@@ -16,51 +19,263 @@ type contextKey string
 
 const userIDKey contextKey = "userID"
 
+// newIdentityKey помечает запросы, для которых идентификатор пользователя выдан только что
+const newIdentityKey contextKey = "newIdentity"
+
+// identityFailures считает запросы, отклонённые из-за невозможности выдать идентификатор пользователя
+var identityFailures = expvar.NewInt("auth_identity_failures")
+
+// TokenService описывает операции с идентификаторами и JWT, необходимые AuthMiddleware
+type TokenService interface {
+	ParseJWT(tokenString string) (string, error)
+	GenerateUserID() (string, error)
+	GenerateJWT(userID string) (string, error)
+}
+
+// IssuedUserRecorder — необязательное расширение TokenService: записывает идентификаторы,
+// выданные AuthMiddleware новым пользователям
+type IssuedUserRecorder interface {
+	RecordIssuedUser(userID string) error
+}
+
+// DefaultCookieMaxAge задаёт время жизни cookie с JWT по умолчанию
+const DefaultCookieMaxAge = 24 * time.Hour
+
+// AuthCookieName — имя cookie, в которой хранится JWT пользователя
+const AuthCookieName = "jwt"
+
+// ExpireAuthCookie удаляет cookie с JWT (Max-Age=0), чтобы браузер перестал её отправлять
+func ExpireAuthCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     AuthCookieName,
+		Value:    "",
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		HttpOnly: true,
+		Path:     "/",
+	})
+}
+
+// SetAuthCookie выдаёт cookie с JWT сроком на maxAge
+func SetAuthCookie(w http.ResponseWriter, token string, maxAge time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     AuthCookieName,
+		Value:    token,
+		Expires:  time.Now().Add(maxAge),
+		MaxAge:   int(maxAge.Seconds()),
+		HttpOnly: true,
+		Path:     "/",
+	})
+}
+
+// authSettings содержит настройки AuthMiddleware
+type authSettings struct {
+	cookieMaxAge   time.Duration
+	expiredWindow  time.Duration // Сколько после истечения JWT его user_id ещё можно восстановить; 0 — нельзя
+	optionalPaths  []string
+	anonymousPaths []string
+}
+
+// AuthOption настраивает AuthMiddleware
+type AuthOption func(*authSettings)
+
+// WithCookieMaxAge задаёт время жизни cookie независимо от срока действия JWT
+// Неположительное значение оставляет значение по умолчанию
+func WithCookieMaxAge(maxAge time.Duration) AuthOption {
+	return func(s *authSettings) {
+		if maxAge > 0 {
+			s.cookieMaxAge = maxAge
+		}
+	}
+}
+
+// WithExpiredIdentityWindow разрешает восстанавливать user_id из JWT с верной подписью, срок действия которого
+// истёк не более window назад: пользователь получает новый токен с прежним идентификатором и не теряет свои URL
+// Неположительное значение отключает восстановление
+func WithExpiredIdentityWindow(window time.Duration) AuthOption {
+	return func(s *authSettings) {
+		s.expiredWindow = window
+	}
+}
+
+// reusableExpired сообщает, можно ли восстановить user_id после ошибки разбора JWT
+// Подходят только токены, у которых истёк срок действия (ошибка с методом ExpiredFor), не позднее expiredWindow
+func (s authSettings) reusableExpired(err error) bool {
+	if s.expiredWindow <= 0 {
+		return false
+	}
+	var expired interface{ ExpiredFor() time.Duration }
+	return errors.As(err, &expired) && expired.ExpiredFor() <= s.expiredWindow
+}
+
+// WithOptionalIdentity задаёт маршруты, которым не обязателен идентификатор пользователя
+// Шаблоны задаются в стиле chi: сегмент вида {id} соответствует любому непустому сегменту пути
+// Если выдать идентификатор не удалось, такие запросы обрабатываются без него
+func WithOptionalIdentity(patterns ...string) AuthOption {
+	return func(s *authSettings) {
+		s.optionalPaths = append(s.optionalPaths, patterns...)
+	}
+}
+
+// WithAnonymousPaths задаёт маршруты, которые обслуживаются вовсе без идентификатора пользователя:
+// для них JWT не проверяется и cookie не выдаётся (например, /robots.txt и /favicon.ico)
+func WithAnonymousPaths(patterns ...string) AuthOption {
+	return func(s *authSettings) {
+		s.anonymousPaths = append(s.anonymousPaths, patterns...)
+	}
+}
+
+// anonymous проверяет, обслуживается ли путь без идентификатора пользователя
+func (s authSettings) anonymous(path string) bool {
+	for _, pattern := range s.anonymousPaths {
+		if matchPathPattern(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// identityOptional проверяет, может ли запрос по указанному пути обрабатываться без идентификатора
+func (s authSettings) identityOptional(path string) bool {
+	for _, pattern := range s.optionalPaths {
+		if matchPathPattern(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPathPattern сопоставляет путь с шаблоном посегментно
+func matchPathPattern(pattern, path string) bool {
+	patternSegments := strings.Split(strings.Trim(pattern, "/"), "/")
+	pathSegments := strings.Split(strings.Trim(path, "/"), "/")
+	if len(patternSegments) != len(pathSegments) {
+		return false
+	}
+	for i, segment := range patternSegments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if pathSegments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if segment != pathSegments[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// writeIdentityError отправляет ответ 500 с описанием ошибки в JSON формате
+func writeIdentityError(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	_ = json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+	}{Error: "failed to issue user identity"})
+}
+
 // AuthMiddleware создаёт middleware для аутентификации пользователей
 // Автоматически генерирует JWT токен для новых пользователей и проверяет существующие токены
-func AuthMiddleware(svc *service.Service, logger *zap.Logger) func(http.Handler) http.Handler {
+// Токен принимается из cookie или, для скриптов, из заголовка "Authorization: Bearer ..."
+// Невалидная или просроченная cookie явно удаляется перед выдачей новой
+// Если выдать идентификатор не удалось, маршруты из WithOptionalIdentity обрабатываются без него,
+// а остальные получают 500 с описанием ошибки в JSON
+func AuthMiddleware(svc TokenService, logger *zap.Logger, opts ...AuthOption) func(http.Handler) http.Handler {
+	settings := authSettings{cookieMaxAge: DefaultCookieMaxAge}
+	for _, opt := range opts {
+		opt(&settings)
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if settings.anonymous(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			var userID string
-			cookie, err := r.Cookie("jwt")
-			if err == nil {
-				userID, err = svc.ParseJWT(cookie.Value)
-				if err != nil {
+			tokenString, fromCookie := requestToken(r)
+			if tokenString != "" {
+				var err error
+				userID, err = svc.ParseJWT(tokenString)
+				if err != nil && settings.reusableExpired(err) {
+					// Продлеваем истёкший токен, сохраняя идентификатор и вместе с ним URL пользователя
+					var token string
+					if token, err = svc.GenerateJWT(userID); err != nil {
+						logger.Error("Failed to renew expired JWT", zap.Error(err))
+						userID = ""
+					} else {
+						SetAuthCookie(w, token, settings.cookieMaxAge)
+						logger.Info("Renewed expired JWT", zap.String("user_id", userID))
+					}
+				} else if err != nil {
 					logger.Warn("Invalid JWT", zap.Error(err))
+					userID = ""
 				}
 			}
 
+			ctx := r.Context()
 			if userID == "" {
+				if fromCookie {
+					// Удаляем устаревшую cookie, чтобы браузер не продолжал её отправлять
+					ExpireAuthCookie(w)
+				}
+				var token string
+				var err error
 				userID, err = svc.GenerateUserID()
 				if err != nil {
 					logger.Error("Failed to generate user ID", zap.Error(err))
-					http.Error(w, "Internal server error", http.StatusInternalServerError)
-					return
+				} else if token, err = svc.GenerateJWT(userID); err != nil {
+					logger.Error("Failed to generate JWT", zap.Error(err))
 				}
-				token, err := svc.GenerateJWT(userID)
 				if err != nil {
-					logger.Error("Failed to generate JWT", zap.Error(err))
-					http.Error(w, "Internal server error", http.StatusInternalServerError)
+					if settings.identityOptional(r.URL.Path) {
+						logger.Warn("Proceeding without user identity", zap.String("path", r.URL.Path))
+						next.ServeHTTP(w, r)
+						return
+					}
+					identityFailures.Add(1)
+					writeIdentityError(w)
 					return
 				}
-				http.SetCookie(w, &http.Cookie{
-					Name:     "jwt",
-					Value:    token,
-					Expires:  time.Now().Add(24 * time.Hour),
-					HttpOnly: true,
-					Path:     "/",
-				})
+				SetAuthCookie(w, token, settings.cookieMaxAge)
 				logger.Info("Generated new JWT", zap.String("user_id", userID))
+				if recorder, ok := svc.(IssuedUserRecorder); ok {
+					// Запрос обслуживается и без записи: пользователь лишь не попадёт в статистику
+					if err := recorder.RecordIssuedUser(userID); err != nil {
+						logger.Warn("Failed to record issued user", zap.String("user_id", userID), zap.Error(err))
+					}
+				}
+				ctx = context.WithValue(ctx, newIdentityKey, true)
 			}
 
-			ctx := context.WithValue(r.Context(), userIDKey, userID)
+			ctx = context.WithValue(ctx, userIDKey, userID)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// requestToken возвращает JWT из cookie или, если cookie нет, из заголовка "Authorization: Bearer ..."
+// fromCookie сообщает, что токен передан в cookie и её нужно удалить, если он невалиден
+func requestToken(r *http.Request) (token string, fromCookie bool) {
+	if cookie, err := r.Cookie(AuthCookieName); err == nil {
+		return cookie.Value, true
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return token, false
+	}
+	return "", false
+}
+
 // GetUserID извлекает UserID из контекста HTTP запроса
 func GetUserID(r *http.Request) (string, bool) {
 	userID, ok := r.Context().Value(userIDKey).(string)
 	return userID, ok
 }
+
+// IsNewIdentity сообщает, выдан ли идентификатор пользователя в этом запросе, то есть пользователь анонимен
+func IsNewIdentity(r *http.Request) bool {
+	isNew, _ := r.Context().Value(newIdentityKey).(bool)
+	return isNew
+}
@@ -2,10 +2,16 @@ package middleware
 
 import (
 	"context"
+	"errors"
+	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/repository"
+	"github.com/tempizhere/goshorty/internal/service"
+	"go.uber.org/zap"
 )
 
 func TestGetUserID(t *testing.T) {
@@ -28,3 +34,181 @@ func TestUserIDKey(t *testing.T) {
 	assert.IsType(t, contextKey(""), userIDKey)
 	assert.Equal(t, "userID", string(userIDKey))
 }
+
+func TestAuthMiddleware_ClearsInvalidCookie(t *testing.T) {
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "test_secret")
+	handler := AuthMiddleware(svc, zap.NewNop(), WithCookieMaxAge(time.Hour))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: "jwt", Value: "invalid.token.value"})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	cookies := rr.Result().Cookies()
+	assert.Len(t, cookies, 2, "Expected clearing cookie and new cookie")
+	if len(cookies) != 2 {
+		return
+	}
+
+	// Первая cookie удаляет невалидную
+	assert.Equal(t, "jwt", cookies[0].Name)
+	assert.Equal(t, "", cookies[0].Value)
+	assert.Equal(t, -1, cookies[0].MaxAge, "Invalid cookie should be expired")
+
+	// Вторая cookie содержит новый токен с заданным временем жизни
+	assert.Equal(t, "jwt", cookies[1].Name)
+	assert.NotEmpty(t, cookies[1].Value)
+	assert.Equal(t, int(time.Hour.Seconds()), cookies[1].MaxAge)
+}
+
+func TestAuthMiddleware_NoCookieNotCleared(t *testing.T) {
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "test_secret")
+	handler := AuthMiddleware(svc, zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	cookies := rr.Result().Cookies()
+	assert.Len(t, cookies, 1, "Only new cookie expected without incoming cookie")
+	if len(cookies) == 1 {
+		assert.Equal(t, int(DefaultCookieMaxAge.Seconds()), cookies[0].MaxAge)
+	}
+}
+
+func TestAuthMiddleware_IsNewIdentity(t *testing.T) {
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "test_secret")
+	var isNew bool
+	handler := AuthMiddleware(svc, zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		isNew = IsNewIdentity(r)
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.True(t, isNew, "Identity issued in this request must be marked as new")
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(rr.Result().Cookies()[0])
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.False(t, isNew, "Identity from a valid cookie must not be marked as new")
+}
+
+func TestAuthMiddleware_ExpiredIdentityWindow(t *testing.T) {
+	now := time.Now()
+	// Токен выдан 25 часов назад и истёк час назад
+	issuer := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "test_secret",
+		service.WithClock(func() time.Time { return now.Add(-25 * time.Hour) }))
+	expired, err := issuer.GenerateJWT("old_user")
+	assert.NoError(t, err)
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "test_secret",
+		service.WithClock(func() time.Time { return now }))
+
+	tests := []struct {
+		name     string
+		window   time.Duration
+		token    string
+		wantSame bool
+	}{
+		{name: "Within window", window: 7 * 24 * time.Hour, token: expired, wantSame: true},
+		{name: "Past window", window: 30 * time.Minute, token: expired},
+		{name: "Window disabled", token: expired},
+		{name: "Tampered token", window: 7 * 24 * time.Hour, token: expired[:len(expired)-2] + "xx"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var userID string
+			var isNew bool
+			handler := AuthMiddleware(svc, zap.NewNop(), WithExpiredIdentityWindow(tt.window))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				userID, _ = GetUserID(r)
+				isNew = IsNewIdentity(r)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: tt.token})
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if tt.wantSame {
+				assert.Equal(t, "old_user", userID)
+				assert.False(t, isNew)
+			} else {
+				assert.NotEqual(t, "old_user", userID)
+				assert.True(t, isNew)
+			}
+			// В обоих случаях клиент получает действующий токен для итогового идентификатора
+			cookies := rr.Result().Cookies()
+			if assert.NotEmpty(t, cookies) {
+				renewed, err := svc.ParseJWT(cookies[len(cookies)-1].Value)
+				assert.NoError(t, err)
+				assert.Equal(t, userID, renewed)
+			}
+		})
+	}
+}
+
+func TestMatchPathPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"/{id}", "/abc", true},
+		{"/{id}", "/", false},
+		{"/{id}", "/api/shorten", false},
+		{"/api/expand/{id}", "/api/expand/abc", true},
+		{"/ping", "/ping", true},
+		{"/ping", "/pong", false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, matchPathPattern(tt.pattern, tt.path), "%s vs %s", tt.pattern, tt.path)
+	}
+}
+
+func TestAuthMiddleware_IdentityFailureCounter(t *testing.T) {
+	before := identityFailures.Value()
+	handler := AuthMiddleware(failingTokens{}, zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Handler must not be called when identity is required")
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/shorten", nil))
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	assert.Equal(t, before+1, identityFailures.Value())
+}
+
+// failingTokens имитирует сбой генерации идентификатора
+type failingTokens struct{}
+
+func (failingTokens) ParseJWT(string) (string, error)    { return "", errors.New("invalid token") }
+func (failingTokens) GenerateUserID() (string, error)    { return "", errors.New("entropy exhausted") }
+func (failingTokens) GenerateJWT(string) (string, error) { return "", errors.New("entropy exhausted") }
+
+func TestAuthMiddleware_BearerToken(t *testing.T) {
+	svc := service.NewService(repository.NewMemoryRepository(), "http://localhost:8080", "test_secret")
+	token, err := svc.GenerateJWT("script_user")
+	assert.NoError(t, err)
+
+	var userID string
+	handler := AuthMiddleware(svc, zap.NewNop())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, _ = GetUserID(r)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, "script_user", userID)
+	assert.Empty(t, rr.Result().Cookies(), "Valid bearer token must not issue a cookie")
+
+	// Невалидный bearer-токен заменяется новым идентификатором без удаления cookie
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer invalid")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.NotEqual(t, "script_user", userID)
+	assert.Len(t, rr.Result().Cookies(), 1)
+}
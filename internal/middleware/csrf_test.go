@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// csrfCookie возвращает выданную cookie с CSRF-токеном
+func csrfCookie(rr *httptest.ResponseRecorder) *http.Cookie {
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == CSRFCookieName {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	handler := CSRFMiddleware("test_secret")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	jwtCookie := &http.Cookie{Name: AuthCookieName, Value: "token"}
+
+	// GET выдаёт cookie, доступную JavaScript
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/user/urls", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	issued := csrfCookie(rr)
+	assert.NotNil(t, issued)
+	if issued == nil {
+		return
+	}
+	assert.False(t, issued.HttpOnly, "UI must be able to read the CSRF cookie")
+	assert.Equal(t, http.SameSiteStrictMode, issued.SameSite)
+
+	post := func(header string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"https://example.com"}`))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		if header != "" {
+			req.Header.Set(CSRFHeaderName, header)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	tests := []struct {
+		name     string
+		rr       *httptest.ResponseRecorder
+		wantCode int
+	}{
+		{name: "Cookie auth without header", rr: post("", jwtCookie, issued), wantCode: http.StatusForbidden},
+		{name: "Cookie auth with header", rr: post(issued.Value, jwtCookie, issued), wantCode: http.StatusOK},
+		{name: "Cookie auth with mismatched header", rr: post(issued.Value+"x", jwtCookie, issued), wantCode: http.StatusForbidden},
+		{name: "Cookie auth without CSRF cookie", rr: post(issued.Value, jwtCookie), wantCode: http.StatusForbidden},
+		{name: "Forged unsigned cookie", rr: post("abc.def", jwtCookie, &http.Cookie{Name: CSRFCookieName, Value: "abc.def"}), wantCode: http.StatusForbidden},
+		{name: "No jwt cookie", rr: post(""), wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantCode, tt.rr.Code)
+		})
+	}
+
+	// Отклонённый запрос получает новую cookie, если прежней не было или она невалидна
+	assert.NotNil(t, csrfCookie(post("", jwtCookie)))
+	assert.Nil(t, csrfCookie(post(issued.Value, jwtCookie, issued)), "Valid cookie should not be reissued")
+}
+
+func TestCSRFMiddleware_Skipped(t *testing.T) {
+	handler := CSRFMiddleware("test_secret")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header map[string]string
+	}{
+		{name: "Bearer auth", method: http.MethodPost, path: "/api/shorten", header: map[string]string{"Authorization": "Bearer token"}},
+		{name: "API key", method: http.MethodDelete, path: "/api/user/urls", header: map[string]string{"X-Api-Key": "key"}},
+		{name: "Safe method", method: http.MethodHead, path: "/api/user/urls"},
+		{name: "Outside API", method: http.MethodPost, path: "/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: "token"})
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			assert.Equal(t, http.StatusOK, rr.Code)
+		})
+	}
+
+	// Basic-аутентификация не освобождает от проверки
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten", nil)
+	req.AddCookie(&http.Cookie{Name: AuthCookieName, Value: "token"})
+	req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
+func TestCSRFToken_Secret(t *testing.T) {
+	token, err := newCSRFToken([]byte("secret1"))
+	assert.NoError(t, err)
+	assert.True(t, validCSRFToken([]byte("secret1"), token))
+	assert.False(t, validCSRFToken([]byte("secret2"), token), "Token signed with another secret should be rejected")
+	assert.False(t, validCSRFToken([]byte("secret1"), ""))
+	assert.False(t, validCSRFToken([]byte("secret1"), strings.SplitN(token, ".", 2)[0]))
+}
@@ -7,11 +7,97 @@ import (
 	"strings"
 )
 
+// GzipOption настраивает NewGzipMiddleware
+type GzipOption func(*gzipSettings)
+
+// gzipSettings содержит настройки NewGzipMiddleware
+type gzipSettings struct {
+	allowedTypes map[string][]string // Префикс пути -> допустимые Content-Type сжатых запросов
+	forcePaths   []string            // Префиксы путей, ответы которых сжимаются и без Accept-Encoding
+}
+
+// WithGzipContentTypes ограничивает Content-Type сжатых запросов для путей с указанным префиксом
+// Сжатый запрос с другим Content-Type отклоняется с 400; при пересечении префиксов действует самый длинный
+func WithGzipContentTypes(pathPrefix string, contentTypes ...string) GzipOption {
+	return func(s *gzipSettings) {
+		if s.allowedTypes == nil {
+			s.allowedTypes = make(map[string][]string)
+		}
+		s.allowedTypes[pathPrefix] = contentTypes
+	}
+}
+
+// WithForceGzip сжимает ответы на запросы без заголовка Accept-Encoding для путей с указанными префиксами
+// Предназначено для доверенных внутренних маршрутов, клиенты которых принимают gzip, но не заявляют об этом;
+// явно переданный Accept-Encoding без gzip соблюдается как обычно
+func WithForceGzip(pathPrefixes ...string) GzipOption {
+	return func(s *gzipSettings) {
+		s.forcePaths = append(s.forcePaths, pathPrefixes...)
+	}
+}
+
+// acceptsGzip сообщает, можно ли сжать ответ на запрос
+func (s gzipSettings) acceptsGzip(r *http.Request) bool {
+	acceptEncoding, sent := r.Header["Accept-Encoding"]
+	if sent {
+		return strings.Contains(strings.Join(acceptEncoding, ","), "gzip")
+	}
+	for _, prefix := range s.forcePaths {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipContentTypeAllowed проверяет Content-Type сжатого запроса по политике самого длинного подходящего префикса
+func (s gzipSettings) gzipContentTypeAllowed(path, contentType string) bool {
+	matched := ""
+	var allowed []string
+	for prefix, types := range s.allowedTypes {
+		if strings.HasPrefix(path, prefix) && len(prefix) >= len(matched) {
+			matched, allowed = prefix, types
+		}
+	}
+	if allowed == nil {
+		return true
+	}
+	for _, t := range allowed {
+		if strings.Contains(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
+
 // GzipMiddleware обрабатывает Gzip-сжатие для запросов и ответов
+// Сжатое тело с любым Content-Type распаковывается и передаётся обработчику;
+// несоответствие заявленного типа содержимому проверяет сам обработчик
 func GzipMiddleware(next http.Handler) http.Handler {
+	return NewGzipMiddleware()(next)
+}
+
+// NewGzipMiddleware создаёт GzipMiddleware с дополнительной политикой для сжатых запросов
+func NewGzipMiddleware(opts ...GzipOption) func(http.Handler) http.Handler {
+	var settings gzipSettings
+	for _, opt := range opts {
+		opt(&settings)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return gzipHandler(next, settings)
+	}
+}
+
+// gzipHandler распаковывает сжатые запросы и сжимает ответы согласно настройкам
+func gzipHandler(next http.Handler, settings gzipSettings) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Обработка сжатого запроса
 		if strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
+			if !settings.gzipContentTypeAllowed(r.URL.Path, r.Header.Get("Content-Type")) {
+				http.Error(w, "Invalid Content-Type for gzip request", http.StatusBadRequest)
+				return
+			}
 			gz, err := gzip.NewReader(r.Body)
 			if err != nil {
 				http.Error(w, "Invalid gzip data", http.StatusBadRequest)
@@ -23,10 +109,14 @@ func GzipMiddleware(next http.Handler) http.Handler {
 				}
 			}()
 			r.Body = io.NopCloser(gz)
+			// Обработчик получает распакованное тело, поэтому заголовки сжатого тела к нему больше не относятся
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
 		}
 
 		// Проверка, поддерживает ли клиент сжатие ответа
-		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		if !settings.acceptsGzip(r) {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -45,38 +135,60 @@ func GzipMiddleware(next http.Handler) http.Handler {
 }
 
 // gzipResponseWriter оборачивает http.ResponseWriter для сжатия ответа
+// Статус откладывается до первой записи: Content-Encoding должен попасть в заголовки раньше, чем они уйдут клиенту
 type gzipResponseWriter struct {
 	http.ResponseWriter
 	gz          *gzip.Writer
 	isGzipValid bool
+	wroteRaw    bool // Часть ответа уже ушла без сжатия, поэтому сжимать остаток нельзя
+	status      int  // Отложенный статус ответа; 0 — обработчик его не задавал
+	wroteHeader bool // Заголовки уже отправлены исходному ResponseWriter
 }
 
-// WriteHeader устанавливает HTTP-статус код ответа
+// WriteHeader запоминает HTTP-статус код ответа; заголовки отправляются при первой записи тела
 func (w *gzipResponseWriter) WriteHeader(statusCode int) {
-	// Вызываем оригинальный WriteHeader
-	w.ResponseWriter.WriteHeader(statusCode)
+	if w.wroteHeader || w.status != 0 {
+		return
+	}
+	w.status = statusCode
 }
 
-// Write записывает данные в ответ с автоматическим сжатием при необходимости
-func (w *gzipResponseWriter) Write(b []byte) (int, error) {
-	// Проверяем Content-Type ответа
-	contentType := w.Header().Get("Content-Type")
-	if !strings.HasPrefix(contentType, "application/json") && !strings.HasPrefix(contentType, "text/html") {
-		w.isGzipValid = false
-		return w.ResponseWriter.Write(b)
+// sendHeader отправляет заголовки с отложенным статусом, если они ещё не отправлены
+func (w *gzipResponseWriter) sendHeader() {
+	if w.wroteHeader {
+		return
 	}
-
-	// Проверяем размер данных
-	if len(b) < 1400 {
-		w.isGzipValid = false
-		return w.ResponseWriter.Write(b)
+	w.wroteHeader = true
+	if w.status == 0 {
+		w.status = http.StatusOK
 	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
 
-	// Инициализируем gzip.Writer, если ещё не создан
+// Write записывает данные в ответ с автоматическим сжатием при необходимости
+func (w *gzipResponseWriter) Write(b []byte) (int, error) {
+	// Решение о сжатии принимается по первой записи и действует до конца ответа
 	if w.gz == nil {
+		if w.wroteRaw {
+			return w.ResponseWriter.Write(b)
+		}
+
+		// Проверяем Content-Type ответа и размер данных
+		contentType := w.Header().Get("Content-Type")
+		compressible := strings.HasPrefix(contentType, "application/json") || strings.HasPrefix(contentType, "text/html")
+		if !compressible || len(b) < 1400 {
+			w.isGzipValid = false
+			w.wroteRaw = true
+			w.sendHeader()
+			return w.ResponseWriter.Write(b)
+		}
+
 		w.gz = gzip.NewWriter(w.ResponseWriter)
 		w.isGzipValid = true
 		w.Header().Set("Content-Encoding", "gzip")
+		// Длина, заданная обработчиком, относится к несжатому телу
+		w.Header().Del("Content-Length")
+		w.sendHeader()
 	}
 
 	// Пишем сжатые данные
@@ -87,8 +199,33 @@ func (w *gzipResponseWriter) Write(b []byte) (int, error) {
 	return n, nil
 }
 
-// Close закрывает gzip.Writer
+// Flush отправляет клиенту уже сжатые данные, не дожидаясь конца ответа
+// Если до Flush сжатие ещё не начато, заголовки уходят без Content-Encoding, и остаток ответа пишется без сжатия
+func (w *gzipResponseWriter) Flush() {
+	if w.gz == nil {
+		w.wroteRaw = true
+	}
+	w.sendHeader()
+	if w.gz != nil {
+		if err := w.gz.Flush(); err != nil {
+			return
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap возвращает исходный http.ResponseWriter для http.ResponseController
+func (w *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Close отправляет отложенный статус ответа без тела и закрывает gzip.Writer
 func (w *gzipResponseWriter) Close() error {
+	if w.status != 0 {
+		w.sendHeader()
+	}
 	if w.gz != nil && w.isGzipValid {
 		if err := w.gz.Close(); err != nil {
 			return err
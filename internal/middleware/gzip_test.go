@@ -132,6 +132,8 @@ func TestGzipMiddleware_GzipRequest(t *testing.T) {
 		body, err := io.ReadAll(r.Body)
 		assert.NoError(t, err)
 		assert.Equal(t, "compressed data", string(body))
+		assert.Empty(t, r.Header.Get("Content-Encoding"), "Decompressed request should not keep Content-Encoding")
+		assert.Equal(t, int64(-1), r.ContentLength)
 		if _, err := w.Write([]byte("response")); err != nil {
 			t.Logf("Ошибка при записи в response: %v", err)
 		}
@@ -148,16 +150,182 @@ func TestGzipMiddleware_GzipRequest(t *testing.T) {
 	assert.Equal(t, "response", w.Body.String())
 }
 
+func TestNewGzipMiddleware_ContentTypes(t *testing.T) {
+	middleware := NewGzipMiddleware(
+		WithGzipContentTypes("/api/", "application/json"),
+		WithGzipContentTypes("/api/plain", "text/plain"),
+	)
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		wantCode    int
+	}{
+		{name: "Unrestricted path", path: "/", contentType: "application/octet-stream", wantCode: http.StatusOK},
+		{name: "Allowed type", path: "/api/shorten", contentType: "application/json; charset=utf-8", wantCode: http.StatusOK},
+		{name: "Rejected type", path: "/api/shorten", contentType: "text/plain", wantCode: http.StatusBadRequest},
+		{name: "Longest prefix wins", path: "/api/plain", contentType: "text/plain", wantCode: http.StatusOK},
+		{name: "Longest prefix rejects", path: "/api/plain", contentType: "application/json", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf strings.Builder
+			gw := gzip.NewWriter(&buf)
+			_, err := gw.Write([]byte("compressed data"))
+			assert.NoError(t, err)
+			assert.NoError(t, gw.Close())
+
+			handlerCalled := false
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				handlerCalled = true
+				body, err := io.ReadAll(r.Body)
+				assert.NoError(t, err)
+				assert.Equal(t, "compressed data", string(body))
+			})
+
+			req := httptest.NewRequest("POST", tt.path, strings.NewReader(buf.String()))
+			req.Header.Set("Content-Encoding", "gzip")
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+
+			middleware(handler).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantCode == http.StatusOK, handlerCalled)
+			if tt.wantCode == http.StatusBadRequest {
+				assert.Equal(t, "Invalid Content-Type for gzip request\n", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestNewGzipMiddleware_ForceGzip(t *testing.T) {
+	large := strings.Repeat("test data ", 200)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		body := large
+		if r.URL.Query().Get("small") != "" {
+			body = "{}"
+		}
+		_, _ = w.Write([]byte(body))
+	})
+	h := NewGzipMiddleware(WithForceGzip("/api/internal/"))(handler)
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding []string
+		wantGzip       bool
+	}{
+		{name: "Internal route without Accept-Encoding", path: "/api/internal/resolve", wantGzip: true},
+		{name: "Internal route with explicit identity", path: "/api/internal/resolve", acceptEncoding: []string{"identity"}},
+		{name: "Small internal response stays plain", path: "/api/internal/resolve?small=1"},
+		{name: "Public route without Accept-Encoding", path: "/api/user/urls"},
+		{name: "Public route with gzip", path: "/api/user/urls", acceptEncoding: []string{"gzip"}, wantGzip: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			for _, v := range tt.acceptEncoding {
+				req.Header.Add("Accept-Encoding", v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if !tt.wantGzip {
+				assert.Empty(t, w.Header().Get("Content-Encoding"))
+				return
+			}
+			assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+			gz, err := gzip.NewReader(w.Body)
+			assert.NoError(t, err)
+			body, err := io.ReadAll(gz)
+			assert.NoError(t, err)
+			assert.Equal(t, large, string(body))
+		})
+	}
+}
+
 func TestGzipResponseWriter_WriteHeader(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	gw := &gzipResponseWriter{ResponseWriter: w}
 
 	gw.WriteHeader(http.StatusNotFound)
+	// Статус отложен до решения о сжатии и уходит при закрытии ответа без тела
+	assert.False(t, w.Flushed)
+	assert.NoError(t, gw.Close())
 
 	assert.Equal(t, http.StatusNotFound, w.Code)
 }
 
+// TestGzipMiddleware_EndToEndHeaders проверяет заголовки, которые действительно получает клиент настоящего сервера
+func TestGzipMiddleware_EndToEndHeaders(t *testing.T) {
+	large := strings.Repeat("test data ", 200)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Query().Get("mode") {
+		case "small":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte("{}"))
+		case "empty":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(large))
+		}
+	})
+	srv := httptest.NewServer(NewGzipMiddleware(WithForceGzip("/api/internal/"))(handler))
+	defer srv.Close()
+	// Транспорт не распаковывает ответ сам, поэтому видны исходные заголовки и тело
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+
+	tests := []struct {
+		name           string
+		path           string
+		acceptEncoding string
+		wantStatus     int
+		wantGzip       bool
+	}{
+		{name: "Accept-Encoding gzip", path: "/api/user/urls", acceptEncoding: "gzip", wantStatus: http.StatusCreated, wantGzip: true},
+		{name: "Forced without Accept-Encoding", path: "/api/internal/resolve", wantStatus: http.StatusCreated, wantGzip: true},
+		{name: "Small response", path: "/api/internal/resolve?mode=small", wantStatus: http.StatusCreated},
+		{name: "No body", path: "/api/internal/resolve?mode=empty", wantStatus: http.StatusNoContent},
+		{name: "Not accepted", path: "/api/user/urls", wantStatus: http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, srv.URL+tt.path, nil)
+			assert.NoError(t, err)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			resp, err := client.Do(req)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() { _ = resp.Body.Close() }()
+			raw, err := io.ReadAll(resp.Body)
+			assert.NoError(t, err)
+
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			if !tt.wantGzip {
+				assert.Empty(t, resp.Header.Get("Content-Encoding"))
+				return
+			}
+			assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+			gz, err := gzip.NewReader(strings.NewReader(string(raw)))
+			if assert.NoError(t, err) {
+				body, err := io.ReadAll(gz)
+				assert.NoError(t, err)
+				assert.Equal(t, large, string(body))
+			}
+		})
+	}
+}
+
 func TestGzipResponseWriter_Close(t *testing.T) {
 	w := httptest.NewRecorder()
 
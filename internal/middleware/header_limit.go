@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// HeaderBytes оценивает размер строки запроса и заголовков так, как они были переданы по сети:
+// "METHOD URI PROTO\r\n", "Host: host\r\n" и "Key: value\r\n" для каждого значения заголовка
+func HeaderBytes(r *http.Request) int {
+	size := len(r.Method) + len(r.RequestURI) + len(r.Proto) + 4
+	if r.Host != "" {
+		size += len("Host: ") + len(r.Host) + 2
+	}
+	for key, values := range r.Header {
+		for _, value := range values {
+			size += len(key) + len(value) + 4
+		}
+	}
+	return size
+}
+
+// MaxHeaderBytesMiddleware отклоняет запросы, строка запроса и заголовки которых превышают limit байт,
+// ответом 431 и записывает отказ в журнал
+// net/http отклоняет слишком большие заголовки сам, не вызывая обработчик и не сообщая об этом,
+// поэтому http.Server.MaxHeaderBytes следует задавать с запасом относительно limit, чтобы отказы доходили сюда
+func MaxHeaderBytesMiddleware(limit int, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if size := HeaderBytes(r); size > limit {
+				logger.Warn("Request rejected: headers too large",
+					zap.String("method", r.Method),
+					zap.String("path", r.URL.Path),
+					zap.Int("header_bytes", size),
+					zap.Int("limit", limit),
+					zap.String("remote_addr", r.RemoteAddr))
+				http.Error(w, "Request header fields too large", http.StatusRequestHeaderFieldsTooLarge)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
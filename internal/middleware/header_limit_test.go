@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestMaxHeaderBytesMiddleware(t *testing.T) {
+	const limit = 1024
+	core, logs := observer.New(zap.InfoLevel)
+	handler := MaxHeaderBytesMiddleware(limit, zap.New(core))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name       string
+		target     string
+		header     string
+		wantStatus int
+	}{
+		{name: "Small request", target: "/abc", header: "bot", wantStatus: http.StatusOK},
+		{name: "Oversized header", target: "/abc", header: strings.Repeat("a", limit), wantStatus: http.StatusRequestHeaderFieldsTooLarge},
+		{name: "Oversized request line", target: "/abc?q=" + strings.Repeat("a", limit), header: "bot", wantStatus: http.StatusRequestHeaderFieldsTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.Header.Set("User-Agent", tt.header)
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			assert.Equal(t, tt.wantStatus, rr.Code)
+		})
+	}
+
+	// Каждый отказ записывается в журнал
+	rejected := logs.FilterMessage("Request rejected: headers too large").All()
+	assert.Len(t, rejected, 2)
+	assert.Equal(t, int64(limit), rejected[0].ContextMap()["limit"])
+}
+
+func TestMaxHeaderBytesMiddleware_Server(t *testing.T) {
+	const limit = 4096
+	core, logs := observer.New(zap.InfoLevel)
+	server := httptest.NewUnstartedServer(MaxHeaderBytesMiddleware(limit, zap.New(core))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+	server.Config.MaxHeaderBytes = 2 * limit
+	server.Start()
+	defer server.Close()
+
+	send := func(value string) int {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/abc", nil)
+		assert.NoError(t, err)
+		req.Header.Set("X-Padding", value)
+		resp, err := server.Client().Do(req)
+		assert.NoError(t, err)
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, send("small"))
+	// Превышение лимита в пределах запаса сервера отклоняет middleware с записью в журнал
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, send(strings.Repeat("a", limit+1)))
+	assert.Equal(t, 1, logs.FilterMessage("Request rejected: headers too large").Len())
+	// Заголовки сверх предела сервера отклоняет net/http, не вызывая обработчик
+	assert.Equal(t, http.StatusRequestHeaderFieldsTooLarge, send(strings.Repeat("a", 4*limit)))
+	assert.Equal(t, 1, logs.FilterMessage("Request rejected: headers too large").Len())
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import "crypto/subtle"
+
+// InternalTokenHeader — заголовок с общим секретом, который требуется от запросов к внутренним API вместе с доверенной подсетью
+const InternalTokenHeader = "X-Internal-Token"
+
+// ValidInternalToken сообщает, совпадает ли presented с одним из действующих токенов
+// Токенов может быть несколько (старый и новый на время ротации); сравнение выполняется за постоянное время,
+// и все токены проверяются без досрочного выхода, чтобы время ответа не выдавало, какой из них совпал
+func ValidInternalToken(presented string, tokens []string) bool {
+	match := 0
+	for _, token := range tokens {
+		if token == "" {
+			continue
+		}
+		match |= subtle.ConstantTimeCompare([]byte(presented), []byte(token))
+	}
+	return match == 1
+}
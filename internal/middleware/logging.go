@@ -1,12 +1,54 @@
 package middleware
 
 import (
+	"context"
+	"errors"
+	"expvar"
 	"net/http"
 	"time"
 
+	"github.com/go-chi/chi/v5"
 	"go.uber.org/zap"
 )
 
+// StatusClientClosedRequest — условный код статуса для запросов, прерванных клиентом (по аналогии с nginx)
+const StatusClientClosedRequest = 499
+
+// clientDisconnects считает запросы, клиент которых закрыл соединение до завершения обработки
+var clientDisconnects = expvar.NewInt("http_client_disconnects")
+
+// requestsByRoute считает запросы по методу и шаблону маршрута chi, например "GET /{id}":
+// по сырому пути каждая короткая ссылка давала бы отдельный ключ
+var requestsByRoute = expvar.NewMap("http_requests_by_route")
+
+// unmatchedRoute — метка запросов, для которых не нашёлся маршрут
+const unmatchedRoute = "unmatched"
+
+// routeLabel возвращает шаблон маршрута chi, обработавшего запрос, или unmatchedRoute
+// Шаблон известен только после маршрутизации, поэтому вызывается после обработки запроса
+func routeLabel(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			return pattern
+		}
+	}
+	return unmatchedRoute
+}
+
+// otherMethod — метка запросов с нестандартным методом: метод задаёт клиент, и без неё каждый
+// выдуманный метод давал бы отдельный ключ метрики
+const otherMethod = "OTHER"
+
+// methodLabel возвращает метод запроса для метрик, сводя нестандартные методы к otherMethod
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return otherMethod
+}
+
 // loggingResponseWriter оборачивает http.ResponseWriter для отслеживания статуса и размера ответа
 type loggingResponseWriter struct {
 	http.ResponseWriter
@@ -27,10 +69,33 @@ func (w *loggingResponseWriter) Write(b []byte) (int, error) {
 	return n, err
 }
 
+// Flush передаёт буферизованные данные клиенту, если исходный ResponseWriter это поддерживает
+func (w *loggingResponseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap возвращает исходный http.ResponseWriter для http.ResponseController
+func (w *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 // LoggingMiddleware создаёт middleware для логирования запросов и ответов
-func LoggingMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
+// Запросы к путям из skipPaths (например, /favicon.ico) не попадают в журнал
+func LoggingMiddleware(logger *zap.Logger, skipPaths ...string) func(http.Handler) http.Handler {
+	skip := make(map[string]struct{}, len(skipPaths))
+	for _, path := range skipPaths {
+		skip[path] = struct{}{}
+	}
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := skip[r.URL.Path]; ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			start := time.Now()
 
 			// Оборачиваем ResponseWriter
@@ -41,13 +106,23 @@ func LoggingMiddleware(logger *zap.Logger) func(http.Handler) http.Handler {
 
 			// Логируем запрос и ответ
 			duration := time.Since(start)
-			logger.Info("HTTP request",
+			route := routeLabel(r)
+			requestsByRoute.Add(methodLabel(r.Method)+" "+route, 1)
+			fields := []zap.Field{
 				zap.String("method", r.Method),
 				zap.String("uri", r.RequestURI),
 				zap.Int("status", lw.statusCode),
 				zap.Int("size", lw.size),
 				zap.Duration("duration_ms", duration/time.Millisecond),
-			)
+				zap.String("route", route),
+			}
+			// Клиент закрыл соединение: фактический статус не дошёл до него
+			if errors.Is(r.Context().Err(), context.Canceled) {
+				clientDisconnects.Add(1)
+				fields[2] = zap.Int("status", StatusClientClosedRequest)
+				fields = append(fields, zap.Bool("client_closed", true))
+			}
+			logger.Info("HTTP request", fields...)
 		})
 	}
 }
@@ -1,12 +1,16 @@
 package middleware
 
 import (
+	"context"
+	"expvar"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestLoggingMiddleware(t *testing.T) {
@@ -123,3 +127,88 @@ func TestLoggingResponseWriter_Write(t *testing.T) {
 	assert.Equal(t, len(data)+len(moreData), lw.size)
 	assert.Equal(t, string(data)+string(moreData), w.Body.String())
 }
+
+func TestLoggingMiddleware_SkipPaths(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	middleware := LoggingMiddleware(zap.New(core), "/favicon.ico")
+
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/favicon.ico", nil))
+	assert.Equal(t, 0, logs.Len(), "Skipped path should not be logged")
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/abc", nil))
+	assert.Equal(t, 1, logs.Len(), "Other paths should be logged")
+}
+
+func TestLoggingMiddleware_ClientClosed(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	middleware := LoggingMiddleware(zap.New(core))
+
+	// Обработчик, во время работы которого клиент закрывает соединение
+	ctx, cancel := context.WithCancel(context.Background())
+	handler := middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	before := clientDisconnects.Value()
+	req := httptest.NewRequest("POST", "/api/shorten/batch", nil).WithContext(ctx)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, 1, logs.Len())
+	fields := logs.All()[0].ContextMap()
+	assert.Equal(t, true, fields["client_closed"])
+	assert.Equal(t, int64(StatusClientClosedRequest), fields["status"])
+	assert.Equal(t, before+1, clientDisconnects.Value())
+
+	// Обычный запрос не помечается как прерванный
+	middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/abc", nil))
+	_, closed := logs.All()[1].ContextMap()["client_closed"]
+	assert.False(t, closed)
+}
+
+func TestLoggingMiddleware_RouteLabel(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	r := chi.NewRouter()
+	r.Use(LoggingMiddleware(zap.New(core)))
+	r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTemporaryRedirect)
+	})
+
+	routeCount := func(key string) int64 {
+		if v, ok := requestsByRoute.Get(key).(*expvar.Int); ok {
+			return v.Value()
+		}
+		return 0
+	}
+	before := routeCount("GET /{id}")
+	beforeUnmatched := routeCount("GET " + unmatchedRoute)
+
+	// Разные ID попадают в один ряд с шаблоном маршрута, а не с сырым путём
+	for _, path := range []string{"/abc123", "/def456"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+	assert.Equal(t, before+2, routeCount("GET /{id}"))
+	assert.Nil(t, requestsByRoute.Get("GET /abc123"))
+	assert.Nil(t, requestsByRoute.Get("GET /def456"))
+	for _, entry := range logs.All() {
+		assert.Equal(t, "/{id}", entry.ContextMap()["route"])
+	}
+
+	// Запросы без маршрута объединяются под одной меткой
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/a/b/c", nil))
+	assert.Equal(t, beforeUnmatched+1, routeCount("GET "+unmatchedRoute))
+
+	// Метод задаёт клиент: нестандартные методы сводятся к одной метке
+	beforeOther := routeCount(otherMethod + " " + unmatchedRoute)
+	for _, method := range []string{"FOOBAR", "X-RANDOM-1"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/abc123", nil))
+		assert.Nil(t, requestsByRoute.Get(method+" "+unmatchedRoute))
+		assert.Nil(t, requestsByRoute.Get(method+" /{id}"))
+	}
+	assert.Equal(t, beforeOther+2, routeCount(otherMethod+" "+unmatchedRoute))
+}
@@ -0,0 +1,112 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// streamingHandler пишет первую часть ответа, сбрасывает её клиенту и дописывает вторую после release
+func streamingHandler(t *testing.T, first, second string, release <-chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		// SetWriteDeadline доступен только через Unwrap до исходного ResponseWriter
+		assert.NoError(t, rc.SetWriteDeadline(time.Now().Add(time.Minute)))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, err := io.WriteString(w, first)
+		assert.NoError(t, err)
+		assert.NoError(t, rc.Flush())
+
+		select {
+		case <-release:
+		case <-time.After(5 * time.Second):
+		}
+		_, err = io.WriteString(w, second)
+		assert.NoError(t, err)
+	})
+}
+
+// assertStreamed проверяет, что клиент получает первую часть до завершения обработчика
+func assertStreamed(t *testing.T, body io.Reader, first, second string, release chan<- struct{}) {
+	received := make(chan string, 1)
+	go func() {
+		buf := make([]byte, len(first))
+		n, _ := io.ReadFull(body, buf)
+		received <- string(buf[:n])
+	}()
+
+	select {
+	case got := <-received:
+		assert.Equal(t, first, got)
+	case <-time.After(2 * time.Second):
+		t.Fatal("First chunk was not delivered before the handler completed")
+	}
+	close(release)
+
+	rest, err := io.ReadAll(body)
+	assert.NoError(t, err)
+	assert.Equal(t, second, string(rest))
+}
+
+func TestLoggingMiddleware_Flush(t *testing.T) {
+	first, second := `{"part":1}`, `{"part":2}`
+	release := make(chan struct{})
+	server := httptest.NewServer(LoggingMiddleware(zap.NewNop())(streamingHandler(t, first, second, release)))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	assert.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+
+	assertStreamed(t, resp.Body, first, second, release)
+}
+
+func TestGzipMiddleware_Flush(t *testing.T) {
+	first := `{"data":"` + strings.Repeat("a", 2000) + `"}`
+	second := `{"part":2}`
+	release := make(chan struct{})
+	handler := LoggingMiddleware(zap.NewNop())(GzipMiddleware(streamingHandler(t, first, second, release)))
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	assert.NoError(t, err)
+	// Явный Accept-Encoding отключает автоматическую распаковку в http.Transport
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer func() { _ = resp.Body.Close() }()
+	assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+
+	zr, err := gzip.NewReader(resp.Body)
+	assert.NoError(t, err)
+	assertStreamed(t, zr, first, second, release)
+}
+
+func TestGzipMiddleware_FlushBeforeWrite(t *testing.T) {
+	body := `{"data":"` + strings.Repeat("a", 2000) + `"}`
+	handler := GzipMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// Заголовки уходят при Flush, поэтому большое тело после него не сжимается
+		assert.NoError(t, http.NewResponseController(w).Flush())
+		_, err := io.WriteString(w, body)
+		assert.NoError(t, err)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, body, rec.Body.String())
+}
@@ -9,9 +9,81 @@ import (
 	"go.uber.org/zap"
 )
 
+// TrustedSubnetOption настраивает TrustedSubnetMiddleware
+type TrustedSubnetOption func(*trustedSubnetSettings)
+
+// trustedSubnetSettings содержит настройки TrustedSubnetMiddleware
+type trustedSubnetSettings struct {
+	tokens         []string // Действующие токены InternalTokenHeader; пустой список — достаточно подсети
+	ignoreIPHeader bool     // Брать IP клиента из адреса соединения, а не из X-Real-IP
+}
+
+// WithInternalTokens требует от запроса один из tokens в заголовке InternalTokenHeader вдобавок к доверенной подсети
+// Несколько токенов позволяют сменить секрет без простоя; пустые значения игнорируются
+func WithInternalTokens(tokens ...string) TrustedSubnetOption {
+	return func(s *trustedSubnetSettings) {
+		s.tokens = append(s.tokens, tokens...)
+	}
+}
+
+// WithClientIPHeader задаёт, доверять ли заголовку X-Real-IP (по умолчанию доверять)
+// Без прокси перед сервисом клиент может подделать заголовок, поэтому при trust = false
+// проверяется только адрес соединения RemoteAddr
+func WithClientIPHeader(trust bool) TrustedSubnetOption {
+	return func(s *trustedSubnetSettings) {
+		s.ignoreIPHeader = !trust
+	}
+}
+
+// clientIP возвращает IP клиента из X-Real-IP или, если заголовку не доверяют, из адреса соединения
+func (s trustedSubnetSettings) clientIP(r *http.Request) string {
+	if !s.ignoreIPHeader {
+		return r.Header.Get("X-Real-IP")
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// ClientIP возвращает IP клиента по тем же правилам, что и TrustedSubnetMiddleware с теми же opts
+func ClientIP(r *http.Request, opts ...TrustedSubnetOption) string {
+	var settings trustedSubnetSettings
+	for _, opt := range opts {
+		opt(&settings)
+	}
+	return settings.clientIP(r)
+}
+
+// TrustedRequest сообщает, пропустил бы запрос TrustedSubnetMiddleware с теми же trustedSubnet и opts,
+// включая проверку токена в строгом режиме. Нужна обработчикам, которые доверенным запросам отвечают подробнее
+func TrustedRequest(r *http.Request, trustedSubnet string, opts ...TrustedSubnetOption) bool {
+	var settings trustedSubnetSettings
+	for _, opt := range opts {
+		opt(&settings)
+	}
+	_, network, err := net.ParseCIDR(trustedSubnet)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(settings.clientIP(r))
+	if ip == nil || !network.Contains(ip) {
+		return false
+	}
+	return len(settings.tokens) == 0 || ValidInternalToken(r.Header.Get(InternalTokenHeader), settings.tokens)
+}
+
 // TrustedSubnetMiddleware создаёт middleware для проверки IP-адреса в доверенной подсети
-// Проверяет заголовок X-Real-IP и сравнивает с CIDR-нотацией trusted_subnet
-func TrustedSubnetMiddleware(trustedSubnet string, logger *zap.Logger) func(http.Handler) http.Handler {
+// Проверяет заголовок X-Real-IP (или адрес соединения, см. WithClientIPHeader) и сравнивает с CIDR-нотацией trusted_subnet.
+// С WithInternalTokens запрос дополнительно должен передать один из токенов в заголовке InternalTokenHeader
+func TrustedSubnetMiddleware(trustedSubnet string, logger *zap.Logger, opts ...TrustedSubnetOption) func(http.Handler) http.Handler {
+	var settings trustedSubnetSettings
+	for _, opt := range opts {
+		opt(&settings)
+	}
+	tokens := settings.tokens
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Если trusted_subnet пустой, запрещаем доступ
@@ -24,8 +96,8 @@ func TrustedSubnetMiddleware(trustedSubnet string, logger *zap.Logger) func(http
 				return
 			}
 
-			// Получаем IP-адрес из заголовка X-Real-IP
-			clientIP := r.Header.Get("X-Real-IP")
+			// Получаем IP-адрес из заголовка X-Real-IP или адреса соединения
+			clientIP := settings.clientIP(r)
 			if clientIP == "" {
 				logger.Warn("Access denied: X-Real-IP header is missing",
 					zap.String("method", r.Method),
@@ -69,6 +141,18 @@ func TrustedSubnetMiddleware(trustedSubnet string, logger *zap.Logger) func(http
 				return
 			}
 
+			// В строгом режиме одной подсети недостаточно; сам переданный токен не логируется
+			if len(tokens) > 0 && !ValidInternalToken(r.Header.Get(InternalTokenHeader), tokens) {
+				logger.Warn("Access denied: internal token is missing or invalid",
+					zap.String("method", r.Method),
+					zap.String("uri", r.RequestURI),
+					zap.String("client_ip", clientIP),
+					zap.Bool("token_present", r.Header.Get(InternalTokenHeader) != ""),
+					zap.String("remote_addr", r.RemoteAddr))
+				http.Error(w, "Access denied", http.StatusForbidden)
+				return
+			}
+
 			// IP входит в доверенную подсеть, разрешаем доступ
 			logger.Info("Access granted: IP in trusted subnet",
 				zap.String("method", r.Method),
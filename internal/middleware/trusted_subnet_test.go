@@ -205,3 +205,77 @@ func TestTrustedSubnetMiddleware_IPv6(t *testing.T) {
 		})
 	}
 }
+
+func TestTrustedSubnetMiddleware_InternalToken(t *testing.T) {
+	tests := []struct {
+		name           string
+		tokens         []string
+		clientIP       string
+		token          string
+		expectedStatus int
+	}{
+		{name: "Subnet ok, token missing", tokens: []string{"current"}, clientIP: "192.168.1.10", expectedStatus: http.StatusForbidden},
+		{name: "Subnet ok, token wrong", tokens: []string{"current"}, clientIP: "192.168.1.10", token: "guess", expectedStatus: http.StatusForbidden},
+		{name: "Subnet bad, token ok", tokens: []string{"current"}, clientIP: "10.0.0.1", token: "current", expectedStatus: http.StatusForbidden},
+		{name: "Both ok", tokens: []string{"current"}, clientIP: "192.168.1.10", token: "current", expectedStatus: http.StatusOK},
+		{name: "Rotation accepts old token", tokens: []string{"old", "new"}, clientIP: "192.168.1.10", token: "old", expectedStatus: http.StatusOK},
+		{name: "Rotation accepts new token", tokens: []string{"old", "new"}, clientIP: "192.168.1.10", token: "new", expectedStatus: http.StatusOK},
+		{name: "No tokens configured", clientIP: "192.168.1.10", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := TrustedSubnetMiddleware("192.168.1.0/24", zap.NewNop(), WithInternalTokens(tt.tokens...))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/api/internal/stats", nil)
+			req.Header.Set("X-Real-IP", tt.clientIP)
+			if tt.token != "" {
+				req.Header.Set(InternalTokenHeader, tt.token)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+func TestTrustedSubnetMiddleware_IgnoreClientIPHeader(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustHeader    bool
+		remoteAddr     string
+		realIP         string
+		expectedStatus int
+	}{
+		{name: "Spoofed header ignored", remoteAddr: "203.0.113.5:41000", realIP: "192.168.1.10", expectedStatus: http.StatusForbidden},
+		{name: "Trusted connection without header", remoteAddr: "192.168.1.20:41000", expectedStatus: http.StatusOK},
+		{name: "Trusted connection with untrusted header", remoteAddr: "192.168.1.20:41000", realIP: "10.0.0.1", expectedStatus: http.StatusOK},
+		{name: "Header trusted by default", trustHeader: true, remoteAddr: "203.0.113.5:41000", realIP: "192.168.1.10", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := TrustedSubnetMiddleware("192.168.1.0/24", zap.NewNop(), WithClientIPHeader(tt.trustHeader))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/api/internal/stats", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.5:41000"
+	req.Header.Set("X-Real-IP", "192.168.1.10")
+
+	assert.Equal(t, "192.168.1.10", ClientIP(req))
+	assert.Equal(t, "203.0.113.5", ClientIP(req, WithClientIPHeader(false)))
+}
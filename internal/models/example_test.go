@@ -29,6 +29,7 @@ func ExampleBatchResponse() {
 	resp := models.BatchResponse{
 		CorrelationID: "req-1",
 		ShortURL:      "http://localhost:8080/abc123",
+		ShortID:       "abc123",
 	}
 
 	// Сериализуем в JSON
@@ -36,7 +37,7 @@ func ExampleBatchResponse() {
 	fmt.Printf("JSON ответ: %s\n", jsonData)
 
 	// Output:
-	// JSON ответ: {"correlation_id":"req-1","short_url":"http://localhost:8080/abc123"}
+	// JSON ответ: {"correlation_id":"req-1","short_url":"http://localhost:8080/abc123","short_id":"abc123"}
 }
 
 // ExampleURL демонстрирует создание структуры URL
@@ -67,6 +68,7 @@ func ExampleShortURLResponse() {
 	resp := models.ShortURLResponse{
 		ShortURL:    "http://localhost:8080/abc123",
 		OriginalURL: "https://example.com/very-long-url",
+		ShortID:     "abc123",
 	}
 
 	// Сериализуем в JSON
@@ -74,5 +76,5 @@ func ExampleShortURLResponse() {
 	fmt.Printf("JSON ответ: %s\n", jsonData)
 
 	// Output:
-	// JSON ответ: {"short_url":"http://localhost:8080/abc123","original_url":"https://example.com/very-long-url"}
+	// JSON ответ: {"short_url":"http://localhost:8080/abc123","original_url":"https://example.com/very-long-url","short_id":"abc123"}
 }
@@ -0,0 +1,85 @@
+package models_test
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/models"
+)
+
+// updateGolden перезаписывает эталоны: go test ./internal/models -run TestResponseJSON -update
+var updateGolden = flag.Bool("update", false, "rewrite testdata/*.golden files with the current JSON encoding")
+
+// TestResponseJSON закрепляет JSON каждого ответа API: набор полей, их порядок и omitempty
+// Каждый тип проверяется полностью заполненным и с одними обязательными полями
+func TestResponseJSON(t *testing.T) {
+	owned := true
+	tests := []struct {
+		name  string
+		value any
+	}{
+		{name: "shorten_response_full", value: models.ShortenResponse{Result: "http://localhost:8080/abc123", ClaimToken: "token"}},
+		{name: "shorten_response_minimal", value: models.ShortenResponse{Result: "http://localhost:8080/abc123"}},
+		{name: "shorten_id_response_full", value: models.ShortenIDResponse{ID: "abc123", ClaimToken: "token"}},
+		{name: "shorten_id_response_minimal", value: models.ShortenIDResponse{ID: "abc123"}},
+		{name: "expand_response_full", value: models.ExpandResponse{URL: "https://example.com", NSFW: true, Owned: &owned}},
+		{name: "expand_response_minimal", value: models.ExpandResponse{URL: "https://example.com"}},
+		{name: "batch_response_full", value: []models.BatchResponse{{CorrelationID: "1", ShortURL: "http://localhost:8080/abc123", ShortID: "abc123"}}},
+		{name: "batch_response_minimal", value: []models.BatchResponse{{CorrelationID: "1", ShortID: "abc123"}}},
+		{name: "user_urls_full", value: []models.ShortURLResponse{{ShortURL: "http://localhost:8080/abc123", OriginalURL: "https://example.com", ShortID: "abc123", Description: "note",
+			CreatedAt: time.Date(2024, time.January, 2, 3, 4, 5, 0, time.UTC)}}},
+		{name: "user_urls_minimal", value: []models.ShortURLResponse{{ShortURL: "http://localhost:8080/abc123", OriginalURL: "https://example.com", ShortID: "abc123"}}},
+		{name: "resolve_result_full", value: []models.ResolveResult{{ID: "abc123", Status: models.ResolveStatusOK, URL: "https://example.com"}}},
+		{name: "resolve_result_minimal", value: []models.ResolveResult{{ID: "abc123", Status: models.ResolveStatusNotFound}}},
+		{name: "user_stats_full", value: models.UserStats{URLs: 2, Deleted: 1, ClicksTotal: 5, CreatedLast30d: 2, TopReferrers: []models.LinkReferrers{
+			{ShortID: "abc123", Referrers: []models.ReferrerCount{{Referrer: "mail.example.com", Clicks: 3}}},
+		}}},
+		{name: "user_stats_minimal", value: models.UserStats{}},
+		{name: "top_users", value: []models.UserURLCount{{UserID: "user1", URLs: 2, Deleted: 1}}},
+		{name: "hot_links", value: []models.HotLink{{ShortID: "abc123", Clicks: 100, Recorded: 10, SampleFactor: 10}}},
+		{name: "stats_response_full", value: models.StatsResponse{URLs: 2, Users: 1, Backend: "memory", UptimeSeconds: 60, GoVersion: "go1.24", PID: 1,
+			Indexes: []models.IndexStats{{Name: "store", Entries: 2, Bytes: 128}}}},
+		{name: "stats_response_minimal", value: models.StatsResponse{Backend: "postgres", GoVersion: "go1.24"}},
+		{name: "validation_error", value: []models.FieldError{{Field: "url", Error: "must not be empty"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.MarshalIndent(tt.value, "", "  ")
+			assert.NoError(t, err)
+			got = append(got, '\n')
+
+			path := filepath.Join("testdata", tt.name+".golden")
+			if *updateGolden {
+				assert.NoError(t, os.MkdirAll("testdata", 0755))
+				assert.NoError(t, os.WriteFile(path, got, 0644))
+			}
+			want, err := os.ReadFile(path)
+			assert.NoError(t, err, "Missing golden file; run with -update and review the diff")
+			assert.Equal(t, string(want), string(got), "JSON of %s changed; run with -update if intended", tt.name)
+		})
+	}
+}
+
+// TestURLNotSerialized проверяет, что внутренняя модель URL не раскрывает поля в JSON
+func TestURLNotSerialized(t *testing.T) {
+	data, err := json.Marshal(models.URL{
+		ShortID:        "abc123",
+		OriginalURL:    "https://example.com",
+		UserID:         "user1",
+		DeletedFlag:    true,
+		Tags:           []string{"a"},
+		CreatedAt:      time.Unix(0, 0),
+		NSFW:           true,
+		Reserved:       true,
+		Description:    "note",
+		ClaimTokenHash: "hash",
+	})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{}`, string(data))
+}
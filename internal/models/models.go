@@ -1,7 +1,46 @@
 // Package models содержит структуры данных для сервиса сокращения URL.
 // Определяет модели для запросов и ответов API, включая пакетные операции и пользовательские URL.
+//
+// URL — внутренняя модель хранилища и в JSON не сериализуется: ответы API строятся из отдельных структур
+// (ShortURLResponse, ExpandResponse и т.д.), чтобы владелец и служебные флаги не попадали в них случайно.
+// Политика omitempty в ответах: поля, которые есть у каждого ответа, передаются всегда, даже пустыми;
+// omitempty ставится только у необязательных атрибутов, которых у ссылки может не быть (метки, описание,
+// пометка NSFW, токен владения), и у полей, которые заполняются лишь в отдельных режимах ответа.
+// Формат каждого ответа закреплён эталонными файлами testdata/*.golden: изменение JSON требует обновить эталон
 package models
 
+import "time"
+
+// ShortenRequest представляет запрос на сокращение URL в JSON формате
+type ShortenRequest struct {
+	URL  string   `json:"url"`            // Оригинальный URL для сокращения
+	Tags []string `json:"tags,omitempty"` // Необязательные метки для группировки ссылок
+
+	Description string `json:"description,omitempty"` // Необязательная заметка о ссылке
+}
+
+// ShortenResponse представляет ответ с сокращённым URL в JSON формате
+type ShortenResponse struct {
+	Result     string `json:"result"`                // Сокращённый URL
+	ClaimToken string `json:"claim_token,omitempty"` // Одноразовый токен владения; выдаётся только анонимным пользователям
+	Error      string `json:"error,omitempty"`       // Код ошибки, например already_exists_create_only
+}
+
+// ShortenIDResponse представляет ответ на сокращение в режиме ?response=id: только короткий ID без базового URL
+type ShortenIDResponse struct {
+	ID         string `json:"id"`                    // Короткий ID
+	ClaimToken string `json:"claim_token,omitempty"` // Одноразовый токен владения; выдаётся только анонимным пользователям
+	Error      string `json:"error,omitempty"`       // Код ошибки, например already_exists_create_only
+}
+
+// ExpandResponse представляет ответ с оригинальным URL в JSON формате
+type ExpandResponse struct {
+	URL  string `json:"url"`            // Оригинальный URL
+	NSFW bool   `json:"nsfw,omitempty"` // Ссылка помечена модерацией как NSFW
+
+	Owned *bool `json:"owned,omitempty"` // Ссылка создана пользователем запроса; не выводится для анонимных запросов
+}
+
 // BatchRequest представляет запрос на пакетное сокращение URL
 type BatchRequest struct {
 	CorrelationID string `json:"correlation_id"` // Уникальный идентификатор для связи запроса и ответа
@@ -10,26 +49,121 @@ type BatchRequest struct {
 
 // BatchResponse представляет ответ на пакетное сокращение URL
 type BatchResponse struct {
-	CorrelationID string `json:"correlation_id"` // Уникальный идентификатор для связи запроса и ответа
-	ShortURL      string `json:"short_url"`      // Сокращённый URL
+	CorrelationID string `json:"correlation_id"`      // Уникальный идентификатор для связи запроса и ответа
+	ShortURL      string `json:"short_url,omitempty"` // Сокращённый URL; не передаётся в режиме ответа ?response=id
+	ShortID       string `json:"short_id"`            // Короткий ID без базового URL
+}
+
+// BatchItem представляет пару короткий ID — оригинальный URL в пакетном сохранении
+// Пакет передаётся срезом, чтобы порядок сохранения совпадал с порядком запросов
+type BatchItem struct {
+	ShortID     string    // Короткий идентификатор URL
+	OriginalURL string    // Оригинальный URL
+	CreatedAt   time.Time // Время создания URL; нулевое заменяется временем сохранения
 }
 
 // URL представляет структуру URL в системе
+// Это внутренняя модель хранилища: все поля исключены из JSON, ответы API используют отдельные структуры
 type URL struct {
-	ShortID     string `json:"short_id"`                   // Короткий идентификатор URL
-	OriginalURL string `json:"original_url"`               // Оригинальный URL
-	UserID      string `json:"user_id"`                    // Идентификатор пользователя, создавшего URL
-	DeletedFlag bool   `json:"is_deleted" db:"is_deleted"` // Флаг удаления URL
+	ShortID     string    `json:"-"`                 // Короткий идентификатор URL
+	OriginalURL string    `json:"-"`                 // Оригинальный URL
+	UserID      string    `json:"-"`                 // Идентификатор пользователя, создавшего URL
+	DeletedFlag bool      `json:"-" db:"is_deleted"` // Флаг удаления URL
+	Tags        []string  `json:"-"`                 // Метки для группировки ссылок пользователя
+	CreatedAt   time.Time `json:"-"`                 // Время создания URL
+	NSFW        bool      `json:"-"`                 // Ссылка помечена модерацией: вместо редиректа показывается предупреждение
+	Reserved    bool      `json:"-"`                 // Код зарезервирован заранее, адрес назначения ещё не задан
+	Description string    `json:"-"`                 // Заметка пользователя о ссылке
+
+	ClaimTokenHash string `json:"-"` // SHA-256 токена владения анонимной ссылки; пустой, если передать ссылку нельзя
+}
+
+// HasTag проверяет, помечен ли URL указанной меткой
+func (u URL) HasTag(tag string) bool {
+	for _, t := range u.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
 }
 
 // ShortURLResponse представляет ответ с информацией о сокращённом URL
 type ShortURLResponse struct {
 	ShortURL    string `json:"short_url"`    // Сокращённый URL
 	OriginalURL string `json:"original_url"` // Оригинальный URL
+	ShortID     string `json:"short_id"`     // Короткий ID без базового URL
+
+	Description string    `json:"description,omitempty"` // Заметка пользователя о ссылке
+	CreatedAt   time.Time `json:"created_at,omitzero"`   // Время создания; нулевое, если хранилище его не знает
+}
+
+// Статусы разрешения короткого ID в ResolveResult
+const (
+	ResolveStatusOK       = "ok"        // ссылка активна
+	ResolveStatusDeleted  = "deleted"   // ссылка удалена
+	ResolveStatusNotFound = "not_found" // ссылка не найдена
+)
+
+// ResolveResult представляет результат проверки разрешения короткого ID
+type ResolveResult struct {
+	ID     string `json:"id"`            // Короткий идентификатор URL
+	Status string `json:"status"`        // Статус разрешения: ok, deleted или not_found
+	URL    string `json:"url,omitempty"` // Оригинальный URL, если ссылка найдена
+}
+
+// UserStats представляет статистику использования сервиса отдельным пользователем
+type UserStats struct {
+	URLs           int `json:"urls"`             // количество активных URL пользователя
+	Deleted        int `json:"deleted"`          // количество удалённых URL пользователя
+	ClicksTotal    int `json:"clicks_total"`     // суммарное количество переходов по активным URL (0, если учёт переходов выключен)
+	CreatedLast30d int `json:"created_last_30d"` // количество URL, созданных за последние 30 дней
+
+	TopReferrers []LinkReferrers `json:"top_referrers,omitempty"` // основные источники переходов по ссылкам; пусто, если учёт выключен
+}
+
+// ReferrerCount представляет число переходов с одного источника
+type ReferrerCount struct {
+	Referrer string `json:"referrer"` // хост из заголовка Referer
+	Clicks   int    `json:"clicks"`   // количество переходов
+}
+
+// LinkReferrers представляет самые частые источники переходов по одной ссылке
+type LinkReferrers struct {
+	ShortID   string          `json:"short_id"`  // короткий ID
+	Referrers []ReferrerCount `json:"referrers"` // источники по убыванию числа переходов
+}
+
+// UserURLCount представляет количество URL пользователя в рейтинге самых активных пользователей
+type UserURLCount struct {
+	UserID  string `json:"user_id"` // идентификатор пользователя (или его хеш)
+	URLs    int    `json:"urls"`    // количество активных URL пользователя
+	Deleted int    `json:"deleted"` // количество удалённых URL пользователя
+}
+
+// HotLink представляет ссылку, переходы по которой записываются выборочно из-за превышения лимита
+type HotLink struct {
+	ShortID      string  `json:"short_id"`      // короткий ID
+	Clicks       int64   `json:"clicks"`        // переходов с момента попадания ссылки в ограничитель
+	Recorded     int64   `json:"recorded"`      // из них записано
+	SampleFactor float64 `json:"sample_factor"` // во сколько раз переходов больше, чем записей
 }
 
 // StatsResponse представляет ответ с статистикой сервиса
 type StatsResponse struct {
-	URLs  int `json:"urls"`  // количество сокращённых URL в сервисе
-	Users int `json:"users"` // количество пользователей в сервисе
+	URLs          int    `json:"urls"`           // количество сокращённых URL в сервисе
+	Users         int    `json:"users"`          // количество пользователей в сервисе
+	Backend       string `json:"backend"`        // имя используемого хранилища
+	UptimeSeconds int64  `json:"uptime_seconds"` // время работы процесса в секундах
+	GoVersion     string `json:"go_version"`     // версия Go, которой собран сервис
+	PID           int    `json:"pid"`            // идентификатор процесса
+
+	Indexes []IndexStats `json:"indexes,omitempty"` // размеры индексов хранилища в памяти; пусто для PostgreSQL
+}
+
+// IndexStats представляет размер одного индекса хранилища в памяти
+type IndexStats struct {
+	Name    string `json:"name"`    // имя индекса
+	Entries int    `json:"entries"` // количество записей
+	Bytes   int64  `json:"bytes"`   // приблизительный объём в байтах
 }
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Ограничения тела запроса на сокращение URL
+const (
+	MaxURLLength = 8192 // Максимальная длина оригинального URL в байтах
+	MaxTags      = 32   // Максимальное число меток одной ссылки
+	MaxTagLength = 64   // Максимальная длина метки в байтах
+)
+
+// FieldError описывает ошибку в отдельном поле тела запроса
+type FieldError struct {
+	Field string `json:"field"` // Путь к полю, например "[2].original_url"; пустой путь означает тело целиком
+	Error string `json:"error"` // Описание ошибки
+}
+
+// ValidationError перечисляет некорректные поля запроса
+// HTTP-обработчики отдают поля клиенту как есть, gRPC-сервер — одной строкой в статусе InvalidArgument
+type ValidationError struct {
+	Fields []FieldError
+}
+
+// Error реализует интерфейс error
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		parts[i] = f.Field + ": " + f.Error
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+// CheckURL проверяет оригинальный URL и возвращает описание ошибки; пустая строка означает корректный URL
+func CheckURL(value string) string {
+	if value == "" {
+		return "required"
+	}
+	if len(value) > MaxURLLength {
+		return "too long"
+	}
+	if _, err := url.ParseRequestURI(value); err != nil {
+		return "invalid URL"
+	}
+	return ""
+}
+
+// Validate проверяет запрос на сокращение одного URL до обращения к сервису
+func (r ShortenRequest) Validate() error {
+	var fields []FieldError
+	if problem := CheckURL(r.URL); problem != "" {
+		fields = append(fields, FieldError{Field: "url", Error: problem})
+	}
+	if len(r.Tags) > MaxTags {
+		fields = append(fields, FieldError{Field: "tags", Error: "too many tags"})
+	}
+	for i, tag := range r.Tags {
+		if len(tag) > MaxTagLength {
+			fields = append(fields, FieldError{Field: "tags[" + strconv.Itoa(i) + "]", Error: "too long"})
+		}
+	}
+	if len(fields) > 0 {
+		return &ValidationError{Fields: fields}
+	}
+	return nil
+}
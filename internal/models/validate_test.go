@@ -0,0 +1,48 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShortenRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        ShortenRequest
+		wantFields []FieldError
+	}{
+		{name: "Valid", req: ShortenRequest{URL: "https://example.com", Tags: []string{"news"}}},
+		{name: "Empty URL", req: ShortenRequest{}, wantFields: []FieldError{{Field: "url", Error: "required"}}},
+		{name: "Invalid URL", req: ShortenRequest{URL: "not a url"}, wantFields: []FieldError{{Field: "url", Error: "invalid URL"}}},
+		{
+			name:       "URL too long",
+			req:        ShortenRequest{URL: "https://example.com/" + strings.Repeat("a", MaxURLLength)},
+			wantFields: []FieldError{{Field: "url", Error: "too long"}},
+		},
+		{
+			name:       "Too many tags",
+			req:        ShortenRequest{URL: "https://example.com", Tags: make([]string, MaxTags+1)},
+			wantFields: []FieldError{{Field: "tags", Error: "too many tags"}},
+		},
+		{
+			name:       "Tag too long",
+			req:        ShortenRequest{URL: "https://example.com", Tags: []string{"ok", strings.Repeat("t", MaxTagLength+1)}},
+			wantFields: []FieldError{{Field: "tags[1]", Error: "too long"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.req.Validate()
+			if tt.wantFields == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var validationErr *ValidationError
+			assert.ErrorAs(t, err, &validationErr)
+			assert.Equal(t, tt.wantFields, validationErr.Fields)
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultClickFlushInterval — как часто ClickBuffer записывает накопленные переходы в хранилище
+const DefaultClickFlushInterval = 5 * time.Second
+
+// maxPendingClicks ограничивает число пар ссылка-метка, переходы по которым копятся между записями
+// Переходы по новым парам сверх лимита до следующей записи не учитываются
+const maxPendingClicks = 10000
+
+// recordClicksIn добавляет переходы в хранилище, если оно ведёт их учёт
+func recordClicksIn(repo Repository, id, ref string, n int) error {
+	if store, ok := repo.(ClickStore); ok {
+		return store.RecordClicks(id, ref, n)
+	}
+	return nil
+}
+
+// clickCountsOf возвращает переходы из хранилища, если оно ведёт их учёт
+func clickCountsOf(repo Repository, ids []string) (map[string]map[string]int, error) {
+	if store, ok := repo.(ClickStore); ok {
+		return store.ClickCounts(ids)
+	}
+	return nil, nil
+}
+
+// clickKey — ссылка и метка кампании, по которым считаются переходы
+type clickKey struct {
+	id  string
+	ref string
+}
+
+// ClickBuffer копит переходы в памяти и записывает их в ClickStore пачкой (Flush, Run), чтобы редирект не ждал хранилище
+// Реализует service.ClickRecorder
+type ClickBuffer struct {
+	store   ClickStore
+	logger  *zap.Logger
+	mu      sync.Mutex
+	pending map[clickKey]int
+	dropped int // Переходов не учтено с последней записи из-за maxPendingClicks
+}
+
+// NewClickBuffer создаёт буфер переходов, записываемых в store
+func NewClickBuffer(store ClickStore, logger *zap.Logger) *ClickBuffer {
+	return &ClickBuffer{store: store, logger: logger, pending: make(map[clickKey]int)}
+}
+
+// RecordClick учитывает weight переходов по id с меткой ref до следующей записи в хранилище
+func (b *ClickBuffer) RecordClick(id, ref string, weight int) {
+	key := clickKey{id: id, ref: ref}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.pending[key]; !ok && len(b.pending) >= maxPendingClicks {
+		b.dropped += weight
+		return
+	}
+	b.pending[key] += weight
+}
+
+// Flush записывает накопленные переходы в хранилище
+// Ошибка записи одной ссылки не мешает остальным; переходы, которые не удалось записать, не повторяются
+func (b *ClickBuffer) Flush() {
+	b.mu.Lock()
+	pending, dropped := b.pending, b.dropped
+	b.pending, b.dropped = make(map[clickKey]int), 0
+	b.mu.Unlock()
+
+	if dropped > 0 {
+		b.logger.Warn("Clicks dropped: too many links between flushes", zap.Int("clicks", dropped))
+	}
+	for key, n := range pending {
+		if err := b.store.RecordClicks(key.id, key.ref, n); err != nil {
+			b.logger.Warn("Failed to record clicks", zap.String("short_id", key.id), zap.Int("clicks", n), zap.Error(err))
+		}
+	}
+}
+
+// Run записывает накопленные переходы каждые interval до отмены ctx
+// Переходы после отмены не записываются: перед закрытием хранилища нужно вызвать Flush
+func (b *ClickBuffer) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			b.Flush()
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestClickBuffer_Memory(t *testing.T) {
+	repo := NewMemoryRepository()
+	_, err := repo.Save("id1", "https://example.com/1", "user1")
+	assert.NoError(t, err)
+	_, err = repo.Save("id2", "https://example.com/2", "user1")
+	assert.NoError(t, err)
+
+	buffer := NewClickBuffer(repo, zap.NewNop())
+	buffer.RecordClick("id1", "", 1)
+	buffer.RecordClick("id1", "", 3)
+	buffer.RecordClick("missing", "", 1)
+
+	// До записи переходы копятся только в буфере
+	counts, err := repo.ClickCounts([]string{"id1"})
+	assert.NoError(t, err)
+	assert.Empty(t, counts)
+
+	buffer.Flush()
+	counts, err = repo.ClickCounts([]string{"id1", "id2", "missing"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]map[string]int{"id1": {"": 4}}, counts)
+
+	// Переходы удалённой ссылки забываются, и новые переходы по ней не учитываются
+	assert.NoError(t, repo.BatchDelete("user1", []string{"id1"}))
+	buffer.RecordClick("id1", "", 1)
+	buffer.Flush()
+	counts, err = repo.ClickCounts([]string{"id1"})
+	assert.NoError(t, err)
+	assert.Empty(t, counts)
+}
+
+func TestClickBuffer_PendingCap(t *testing.T) {
+	repo := NewMemoryRepository()
+	buffer := NewClickBuffer(repo, zap.NewNop())
+	for i := 0; i < maxPendingClicks; i++ {
+		buffer.RecordClick(fmt.Sprintf("id%d", i), "", 1)
+	}
+	buffer.RecordClick("overflow", "", 2)
+	buffer.RecordClick("id0", "", 1)
+
+	assert.Len(t, buffer.pending, maxPendingClicks)
+	assert.Equal(t, 2, buffer.pending[clickKey{id: "id0"}])
+	assert.Equal(t, 2, buffer.dropped)
+
+	buffer.Flush()
+	assert.Empty(t, buffer.pending)
+	assert.Zero(t, buffer.dropped)
+}
+
+func TestClickBuffer_Run(t *testing.T) {
+	repo := NewMemoryRepository()
+	_, err := repo.Save("id1", "https://example.com/1", "user1")
+	assert.NoError(t, err)
+
+	buffer := NewClickBuffer(Instrument(repo), zap.NewNop())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		buffer.Run(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+
+	buffer.RecordClick("id1", "", 1)
+	assert.Eventually(t, func() bool {
+		counts, err := repo.ClickCounts([]string{"id1"})
+		return err == nil && counts["id1"][""] == 1
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
+
+func TestPostgresRepository_Clicks(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(arrayConverter{}))
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	repo := &PostgresRepository{db: db, logger: zap.NewNop()}
+
+	mock.ExpectExec("INSERT INTO url_clicks \\(short_id, ref, clicks\\)\\s+SELECT short_id,.*COUNT\\(\\*\\) FROM url_clicks WHERE short_id = \\$1\\) < \\$4\\s+THEN \\$2 ELSE \\$5 END, \\$3\\s+FROM urls WHERE short_id = \\$1 AND is_deleted = FALSE\\s+ON CONFLICT \\(short_id, ref\\) DO UPDATE SET clicks = url_clicks.clicks \\+ EXCLUDED.clicks").
+		WithArgs("id1", "", 3, maxReferrersPerLink, referrerOther).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, repo.RecordClicks("id1", "", 3))
+
+	mock.ExpectQuery("SELECT short_id, ref, clicks FROM url_clicks WHERE short_id = ANY\\(\\$1\\)").
+		WithArgs([]string{"id1", "id2"}).
+		WillReturnRows(sqlmock.NewRows([]string{"short_id", "ref", "clicks"}).
+			AddRow("id1", "", 3).
+			AddRow("id1", "newsletter", 2))
+	counts, err := repo.ClickCounts([]string{"id1", "id2"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]map[string]int{"id1": {"": 3, "newsletter": 2}}, counts)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/models"
+	"go.uber.org/zap"
+)
+
+// Данные сценария RepositoryConformance
+const (
+	confUser1 = "conf-user-1"
+	confUser2 = "conf-user-2"
+	confURL1  = "https://conformance.example/1"
+	confURL3  = "https://conformance.example/3"
+	confURL4  = "https://conformance.example/4"
+	confURL5  = "https://conformance.example/5"
+)
+
+// RepositoryConformance проверяет контракт интерфейса Repository одним сценарием:
+// сохранение, дедупликация, чтение, пакетные операции, удаление, статистика и закрытие
+// newRepo вызывается один раз и должен вернуть пустое хранилище; шаги выполняются по порядку
+// и зависят от предыдущих, поэтому сценарий с заранее записанными ответами (sqlmock) повторяет их в том же порядке
+func RepositoryConformance(t *testing.T, newRepo func() Repository) {
+	repo := newRepo()
+
+	t.Run("Save", func(t *testing.T) {
+		id, err := repo.Save("conf1", confURL1, confUser1)
+		assert.NoError(t, err)
+		assert.Equal(t, "conf1", id)
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		u, exists, err := repo.Get("conf1")
+		assert.NoError(t, err)
+		assert.True(t, exists)
+		assert.Equal(t, "conf1", u.ShortID)
+		assert.Equal(t, confURL1, u.OriginalURL)
+		assert.Equal(t, confUser1, u.UserID)
+		assert.False(t, u.DeletedFlag)
+
+		_, exists, err = repo.Get("conf-missing")
+		assert.NoError(t, err, "A missing URL is not a storage failure")
+		assert.False(t, exists)
+	})
+
+	t.Run("Dedup", func(t *testing.T) {
+		id, err := repo.Save("conf2", confURL1, confUser2)
+		assert.ErrorIs(t, err, ErrURLExists)
+		assert.Equal(t, "conf1", id, "Dedup should return the existing short ID")
+		_, exists, err := repo.Get("conf2")
+		assert.NoError(t, err)
+		assert.False(t, exists)
+	})
+
+	t.Run("BatchSave", func(t *testing.T) {
+		assert.NoError(t, repo.BatchSave([]models.BatchItem{
+			{ShortID: "conf3", OriginalURL: confURL3},
+			{ShortID: "conf4", OriginalURL: confURL4},
+		}, confUser1))
+
+		urls, err := repo.BatchGet([]string{"conf1", "conf3", "conf4", "conf-missing"})
+		assert.NoError(t, err)
+		assert.Len(t, urls, 3)
+		assert.Equal(t, confURL3, urls["conf3"].OriginalURL)
+		assert.Equal(t, confUser1, urls["conf4"].UserID)
+	})
+
+	t.Run("BatchSave conflicts are atomic", func(t *testing.T) {
+		err := repo.BatchSave([]models.BatchItem{
+			{ShortID: "conf5", OriginalURL: confURL5},
+			{ShortID: "conf1", OriginalURL: "https://conformance.example/6"},
+		}, confUser1)
+		assert.ErrorIs(t, err, ErrIDExists)
+
+		err = repo.BatchSave([]models.BatchItem{
+			{ShortID: "conf5", OriginalURL: confURL5},
+			{ShortID: "conf6", OriginalURL: confURL3},
+		}, confUser1)
+		assert.ErrorIs(t, err, ErrURLExists)
+
+		_, exists, err := repo.Get("conf5")
+		assert.NoError(t, err)
+		assert.False(t, exists, "A rejected batch should not save any of its items")
+	})
+
+	t.Run("GetURLsByUserID", func(t *testing.T) {
+		urls, err := repo.GetURLsByUserID(confUser1)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"conf1", "conf3", "conf4"}, conformanceIDs(urls, false))
+
+		urls, err = repo.GetURLsByUserID(confUser2)
+		assert.NoError(t, err)
+		assert.Empty(t, urls)
+	})
+
+	t.Run("BatchDelete", func(t *testing.T) {
+		// Чужие URL не удаляются
+		assert.NoError(t, repo.BatchDelete(confUser2, []string{"conf1"}))
+		u, _, err := repo.Get("conf1")
+		assert.NoError(t, err)
+		assert.False(t, u.DeletedFlag)
+
+		assert.NoError(t, repo.BatchDelete(confUser1, []string{"conf1", "conf3"}))
+		u, exists, err := repo.Get("conf1")
+		assert.NoError(t, err)
+		assert.True(t, exists, "Deletion is soft: the short ID stays taken")
+		assert.True(t, u.DeletedFlag)
+
+		// PostgreSQL не возвращает удалённые URL в выборке по пользователю, memory и file возвращают их с флагом,
+		// поэтому контракт ограничивается активными URL
+		urls, err := repo.GetURLsByUserID(confUser1)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"conf4"}, conformanceIDs(urls, true))
+	})
+
+	t.Run("GetStats", func(t *testing.T) {
+		urlCount, userCount, err := repo.GetStats()
+		assert.NoError(t, err)
+		assert.Equal(t, 1, urlCount, "Deleted URLs are not counted")
+		assert.Equal(t, 1, userCount, "Users without active URLs are not counted")
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		assert.NoError(t, repo.Close())
+	})
+}
+
+// conformanceIDs возвращает отсортированные короткие ID; activeOnly отбрасывает удалённые URL
+func conformanceIDs(urls []models.URL, activeOnly bool) []string {
+	ids := make([]string, 0, len(urls))
+	for _, u := range urls {
+		if activeOnly && u.DeletedFlag {
+			continue
+		}
+		ids = append(ids, u.ShortID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestMemoryRepository_Conformance(t *testing.T) {
+	RepositoryConformance(t, func() Repository {
+		return NewMemoryRepository()
+	})
+}
+
+func TestFileRepository_Conformance(t *testing.T) {
+	RepositoryConformance(t, func() Repository {
+		repo, err := NewFileRepository(filepath.Join(t.TempDir(), "storage.json"), zap.NewNop())
+		assert.NoError(t, err)
+		return repo
+	})
+}
+
+func TestPostgresRepository_Conformance(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(arrayConverter{}))
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+
+	const (
+		getQuery    = "SELECT short_id, original_url, user_id, is_deleted, COALESCE\\(nsfw, FALSE\\), FALSE FROM urls WHERE short_id = \\$1 UNION ALL SELECT .* FROM url_reservations WHERE short_id = \\$1"
+		dedupQuery  = "SELECT short_id FROM urls WHERE original_url = \\$1"
+		insertQuery = "INSERT INTO urls \\(short_id, original_url, user_id\\)"
+		byUserQuery = "SELECT short_id, original_url, user_id, is_deleted, COALESCE\\(description, ''\\), created_at FROM urls WHERE user_id = \\$1 AND is_deleted = FALSE"
+		deleteQuery = "UPDATE urls SET is_deleted = TRUE WHERE short_id = ANY\\(\\$1\\) AND user_id = \\$2"
+	)
+	urlColumns := []string{"short_id", "original_url", "user_id", "is_deleted", "nsfw", "reserved"}
+	userColumns := []string{"short_id", "original_url", "user_id", "is_deleted", "description", "created_at"}
+	createdAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	returningIDs := []string{"short_id"}
+	rows := sqlmock.NewRows
+
+	// Save
+	mock.ExpectQuery(dedupQuery).WithArgs(confURL1).WillReturnRows(rows(returningIDs))
+	mock.ExpectQuery(insertQuery).WithArgs("conf1", confURL1, confUser1).WillReturnRows(rows(returningIDs).AddRow("conf1"))
+	// Get
+	mock.ExpectQuery(getQuery).WithArgs("conf1").WillReturnRows(rows(urlColumns).AddRow("conf1", confURL1, confUser1, false, false, false))
+	mock.ExpectQuery(getQuery).WithArgs("conf-missing").WillReturnRows(rows(urlColumns))
+	// Dedup
+	mock.ExpectQuery(dedupQuery).WithArgs(confURL1).WillReturnRows(rows(returningIDs).AddRow("conf1"))
+	mock.ExpectQuery(getQuery).WithArgs("conf2").WillReturnRows(rows(urlColumns))
+	// BatchSave
+	mock.ExpectBegin()
+	mock.ExpectQuery(insertQuery).WithArgs("conf3", confURL3, confUser1).WillReturnRows(rows(returningIDs).AddRow("conf3"))
+	mock.ExpectQuery(insertQuery).WithArgs("conf4", confURL4, confUser1).WillReturnRows(rows(returningIDs).AddRow("conf4"))
+	mock.ExpectCommit()
+	mock.ExpectQuery("SELECT .* FROM urls WHERE short_id = ANY\\(\\$1\\)").
+		WithArgs([]string{"conf1", "conf3", "conf4", "conf-missing"}).
+		WillReturnRows(rows(urlColumns).
+			AddRow("conf1", confURL1, confUser1, false, false, false).
+			AddRow("conf3", confURL3, confUser1, false, false, false).
+			AddRow("conf4", confURL4, confUser1, false, false, false))
+	// BatchSave conflicts are atomic
+	mock.ExpectBegin()
+	mock.ExpectQuery(insertQuery).WithArgs("conf5", confURL5, confUser1).WillReturnRows(rows(returningIDs).AddRow("conf5"))
+	mock.ExpectQuery(insertQuery).WithArgs("conf1", "https://conformance.example/6", confUser1).WillReturnError(&pgconn.PgError{Code: uniqueViolationCode})
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectQuery(insertQuery).WithArgs("conf5", confURL5, confUser1).WillReturnRows(rows(returningIDs).AddRow("conf5"))
+	mock.ExpectQuery(insertQuery).WithArgs("conf6", confURL3, confUser1).WillReturnRows(rows(returningIDs).AddRow("conf3"))
+	mock.ExpectRollback()
+	mock.ExpectQuery(getQuery).WithArgs("conf5").WillReturnRows(rows(urlColumns))
+	// GetURLsByUserID
+	mock.ExpectQuery(byUserQuery).WithArgs(confUser1).WillReturnRows(rows(userColumns).
+		AddRow("conf1", confURL1, confUser1, false, "", createdAt).
+		AddRow("conf3", confURL3, confUser1, false, "", createdAt).
+		AddRow("conf4", confURL4, confUser1, false, "", createdAt))
+	mock.ExpectQuery(byUserQuery).WithArgs(confUser2).WillReturnRows(rows(userColumns))
+	// BatchDelete
+	mock.ExpectExec(deleteQuery).WithArgs([]string{"conf1"}, confUser2).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(getQuery).WithArgs("conf1").WillReturnRows(rows(urlColumns).AddRow("conf1", confURL1, confUser1, false, false, false))
+	mock.ExpectExec(deleteQuery).WithArgs([]string{"conf1", "conf3"}, confUser1).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery(getQuery).WithArgs("conf1").WillReturnRows(rows(urlColumns).AddRow("conf1", confURL1, confUser1, true, false, false))
+	mock.ExpectQuery(byUserQuery).WithArgs(confUser1).WillReturnRows(rows(userColumns).AddRow("conf4", confURL4, confUser1, false, "", createdAt))
+	// GetStats
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM urls WHERE is_deleted = FALSE").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM \\(SELECT user_id FROM urls").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	// Close
+	mock.ExpectClose()
+
+	RepositoryConformance(t, func() Repository {
+		return &PostgresRepository{db: db, logger: zap.NewNop()}
+	})
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
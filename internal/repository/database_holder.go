@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"sync/atomic"
+)
+
+// unavailableConnector — подключение, которое всегда отвечает ErrUnavailable
+type unavailableConnector struct{}
+
+func (unavailableConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, ErrUnavailable
+}
+
+func (unavailableConnector) Driver() driver.Driver {
+	return unavailableDriver{}
+}
+
+// unavailableDriver — драйвер unavailableConnector
+type unavailableDriver struct{}
+
+func (unavailableDriver) Open(string) (driver.Conn, error) {
+	return nil, ErrUnavailable
+}
+
+// unavailableDB отвечает ErrUnavailable на любой запрос, включая QueryRow; используется DatabaseHolder без подключения
+var unavailableDB = sql.OpenDB(unavailableConnector{})
+
+// databaseRef хранит подключение в DatabaseHolder
+type databaseRef struct {
+	db Database
+}
+
+// DatabaseHolder — подключение к базе данных, которое можно заменить на ходу (Set)
+// Нужно, когда база недоступна при старте: приложение и gRPC-сервер получают DatabaseHolder сразу,
+// а подключение появляется в нём после восстановления (см. OfflineRepository.Run). Без подключения
+// все вызовы возвращают ErrUnavailable
+type DatabaseHolder struct {
+	current atomic.Pointer[databaseRef]
+}
+
+// NewDatabaseHolder создаёт держатель с подключением db; db может быть nil
+func NewDatabaseHolder(db Database) *DatabaseHolder {
+	h := &DatabaseHolder{}
+	h.Set(db)
+	return h
+}
+
+// Set заменяет подключение; прежнее не закрывается
+func (h *DatabaseHolder) Set(db Database) {
+	if db == nil {
+		h.current.Store(nil)
+		return
+	}
+	h.current.Store(&databaseRef{db: db})
+}
+
+// get возвращает текущее подключение или unavailableDB
+func (h *DatabaseHolder) get() Database {
+	if ref := h.current.Load(); ref != nil {
+		return ref.db
+	}
+	return unavailableDB
+}
+
+// Ping проверяет текущее подключение
+func (h *DatabaseHolder) Ping() error {
+	return h.get().Ping()
+}
+
+// Close закрывает текущее подключение, если оно есть
+func (h *DatabaseHolder) Close() error {
+	if ref := h.current.Swap(nil); ref != nil {
+		return ref.db.Close()
+	}
+	return nil
+}
+
+// Exec выполняет SQL-команду в текущем подключении
+func (h *DatabaseHolder) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return h.get().Exec(query, args...)
+}
+
+// Query выполняет SQL-запрос в текущем подключении
+func (h *DatabaseHolder) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return h.get().Query(query, args...)
+}
+
+// QueryRow выполняет SQL-запрос в текущем подключении и возвращает одну строку
+func (h *DatabaseHolder) QueryRow(query string, args ...interface{}) *sql.Row {
+	return h.get().QueryRow(query, args...)
+}
+
+// Begin начинает транзакцию в текущем подключении
+func (h *DatabaseHolder) Begin() (*sql.Tx, error) {
+	return h.get().Begin()
+}
+
+// ResetConnections сбрасывает простаивающие соединения текущего подключения, если оно это поддерживает
+func (h *DatabaseHolder) ResetConnections() {
+	if resetter, ok := h.get().(interface{ ResetConnections() }); ok {
+		resetter.ResetConnections()
+	}
+}
@@ -0,0 +1,37 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatabaseHolder(t *testing.T) {
+	holder := NewDatabaseHolder(nil)
+
+	// Без подключения все вызовы завершаются ErrUnavailable
+	assert.ErrorIs(t, holder.Ping(), ErrUnavailable)
+	_, err := holder.Exec("SELECT 1")
+	assert.ErrorIs(t, err, ErrUnavailable)
+	var n int
+	assert.ErrorIs(t, holder.QueryRow("SELECT 1").Scan(&n), ErrUnavailable)
+	holder.ResetConnections()
+	assert.NoError(t, holder.Close())
+
+	// После Set вызовы идут в новое подключение
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	holder.Set(db)
+	assert.NoError(t, holder.Ping())
+	mock.ExpectQuery("SELECT 1").WillReturnRows(sqlmock.NewRows([]string{"n"}).AddRow(1))
+	assert.NoError(t, holder.QueryRow("SELECT 1").Scan(&n))
+	assert.Equal(t, 1, n)
+
+	mock.ExpectClose()
+	assert.NoError(t, holder.Close())
+	assert.ErrorIs(t, holder.Ping(), ErrUnavailable)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
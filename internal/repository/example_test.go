@@ -3,6 +3,7 @@ package repository_test
 import (
 	"fmt"
 
+	"github.com/tempizhere/goshorty/internal/models"
 	"github.com/tempizhere/goshorty/internal/repository"
 )
 
@@ -36,7 +37,7 @@ func ExampleMemoryRepository_Get() {
 	}
 
 	// Получаем URL
-	url, exists := repo.Get("abc123")
+	url, exists, _ := repo.Get("abc123")
 	if !exists {
 		fmt.Println("URL не найден")
 		return
@@ -58,10 +59,10 @@ func ExampleMemoryRepository_BatchSave() {
 	repo := repository.NewMemoryRepository()
 
 	// Создаём пакет URL для сохранения
-	urls := map[string]string{
-		"abc123": "https://example.com/url1",
-		"def456": "https://example.com/url2",
-		"ghi789": "https://example.com/url3",
+	urls := []models.BatchItem{
+		{ShortID: "abc123", OriginalURL: "https://example.com/url1"},
+		{ShortID: "def456", OriginalURL: "https://example.com/url2"},
+		{ShortID: "ghi789", OriginalURL: "https://example.com/url3"},
 	}
 
 	userID := "user-123"
@@ -77,8 +78,8 @@ func ExampleMemoryRepository_BatchSave() {
 
 	// Проверяем сохранение
 	count := 0
-	for shortID := range urls {
-		_, exists := repo.Get(shortID)
+	for _, item := range urls {
+		_, exists, _ := repo.Get(item.ShortID)
 		if exists {
 			count++
 		}
@@ -162,7 +163,7 @@ func ExampleMemoryRepository_BatchDelete() {
 
 	// Проверяем статус URL
 	for _, id := range idsToDelete {
-		url, exists := repo.Get(id)
+		url, exists, _ := repo.Get(id)
 		if exists {
 			fmt.Printf("URL %s удалён: %t\n", id, url.DeletedFlag)
 		}
@@ -190,16 +191,16 @@ func ExampleMemoryRepository_Clear() {
 	}
 
 	// Проверяем количество URL
-	_, exists1 := repo.Get("abc123")
-	_, exists2 := repo.Get("def456")
+	_, exists1, _ := repo.Get("abc123")
+	_, exists2, _ := repo.Get("def456")
 	fmt.Printf("До очистки: abc123=%t, def456=%t\n", exists1, exists2)
 
 	// Очищаем репозиторий
 	repo.Clear()
 
 	// Проверяем после очистки
-	_, exists1 = repo.Get("abc123")
-	_, exists2 = repo.Get("def456")
+	_, exists1, _ = repo.Get("abc123")
+	_, exists2, _ = repo.Get("def456")
 	fmt.Printf("После очистки: abc123=%t, def456=%t\n", exists1, exists2)
 
 	// Output:
@@ -0,0 +1,359 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/tempizhere/goshorty/internal/models"
+)
+
+// ErrInjectedFault возвращается методами хранилища, в которые внедрён сбой
+var ErrInjectedFault = errors.New("injected storage fault")
+
+// ErrInvalidFaultConfig возвращается при некорректных настройках внедрения сбоев
+var ErrInvalidFaultConfig = errors.New("invalid fault config")
+
+// AllMethods — ключ FaultConfig.Methods, правило которого применяется к методам без собственного правила
+const AllMethods = "*"
+
+// faultMethods содержит методы Repository, в которые можно внедрять сбои
+var faultMethods = map[string]struct{}{
+	AllMethods:            {},
+	"Save":                {},
+	"SaveURL":             {},
+	"Get":                 {},
+	"BatchGet":            {},
+	"BatchSave":           {},
+	"GetURLsByUserID":     {},
+	"GetURLsByUserAndTag": {},
+	"BatchDelete":         {},
+	"DeleteByUserAndHost": {},
+	"ReassignUser":        {},
+	"ClaimURL":            {},
+	"SetNSFW":             {},
+	"ReserveIDs":          {},
+	"ActivateReserved":    {},
+	"GetUserIDsByURL":     {},
+	"SaveUser":            {},
+	"Count":               {},
+	"GetStats":            {},
+	"GetUserStats":        {},
+	"TopUsers":            {},
+	"RecordReferrer":      {},
+	"TopReferrers":        {},
+	"RecordClicks":        {},
+	"ClickCounts":         {},
+}
+
+// FaultRule описывает сбои одного метода хранилища
+type FaultRule struct {
+	ErrorRate  float64       // Вероятность вернуть ErrInjectedFault, от 0 до 1
+	ExistsRate float64       // Вероятность вернуть ErrURLExists из Save и SaveURL, от 0 до 1
+	Latency    time.Duration // Задержка перед каждым вызовом
+}
+
+// FaultConfig задаёт сбои по именам методов Repository
+type FaultConfig struct {
+	Methods map[string]FaultRule // Правила по именам методов; AllMethods задаёт правило по умолчанию
+	Seed    int64                // Начальное значение генератора; 0 — случайное
+}
+
+// Validate проверяет имена методов и вероятности
+func (c FaultConfig) Validate() error {
+	for method, rule := range c.Methods {
+		if _, ok := faultMethods[method]; !ok {
+			return fmt.Errorf("%w: unknown method %q", ErrInvalidFaultConfig, method)
+		}
+		if rule.ErrorRate < 0 || rule.ErrorRate > 1 || rule.ExistsRate < 0 || rule.ExistsRate > 1 {
+			return fmt.Errorf("%w: %s: rates must be between 0 and 1", ErrInvalidFaultConfig, method)
+		}
+		if rule.Latency < 0 {
+			return fmt.Errorf("%w: %s: negative latency", ErrInvalidFaultConfig, method)
+		}
+	}
+	return nil
+}
+
+// FaultRepository внедряет сбои и задержки в вызовы основного хранилища
+// Используется для проверки поведения сервиса при нестабильном хранилище; настройки меняются на лету через SetConfig
+type FaultRepository struct {
+	Repository // Основное хранилище
+
+	cfg   FaultConfig
+	rng   *rand.Rand
+	sleep func(time.Duration)
+	mutex sync.Mutex
+}
+
+// WithFaults оборачивает inner внедрением сбоев по cfg
+// Некорректная конфигурация заменяется пустой, то есть хранилище работает без сбоев
+func WithFaults(inner Repository, cfg FaultConfig) *FaultRepository {
+	r := &FaultRepository{Repository: inner, sleep: time.Sleep}
+	if err := r.SetConfig(cfg); err != nil {
+		_ = r.SetConfig(FaultConfig{})
+	}
+	return r
+}
+
+// SetConfig заменяет настройки сбоев и пересоздаёт генератор случайных чисел с cfg.Seed
+func (r *FaultRepository) SetConfig(cfg FaultConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	methods := make(map[string]FaultRule, len(cfg.Methods))
+	for method, rule := range cfg.Methods {
+		methods[method] = rule
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.cfg = FaultConfig{Methods: methods, Seed: cfg.Seed}
+	r.rng = rand.New(rand.NewSource(seed))
+	return nil
+}
+
+// Config возвращает текущие настройки сбоев
+func (r *FaultRepository) Config() FaultConfig {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	methods := make(map[string]FaultRule, len(r.cfg.Methods))
+	for method, rule := range r.cfg.Methods {
+		methods[method] = rule
+	}
+	return FaultConfig{Methods: methods, Seed: r.cfg.Seed}
+}
+
+// inject выдерживает задержку метода и определяет, какой сбой вернуть
+func (r *FaultRepository) inject(method string) (fail, exists bool) {
+	r.mutex.Lock()
+	rule, ok := r.cfg.Methods[method]
+	if !ok {
+		rule = r.cfg.Methods[AllMethods]
+	}
+	fail = rule.ErrorRate > 0 && r.rng.Float64() < rule.ErrorRate
+	exists = !fail && rule.ExistsRate > 0 && r.rng.Float64() < rule.ExistsRate
+	r.mutex.Unlock()
+
+	if rule.Latency > 0 {
+		r.sleep(rule.Latency)
+	}
+	return fail, exists
+}
+
+// Save сохраняет URL или возвращает внедрённый сбой
+func (r *FaultRepository) Save(id, url, userID string) (string, error) {
+	fail, exists := r.inject("Save")
+	if fail {
+		return "", ErrInjectedFault
+	}
+	if exists {
+		return id, ErrURLExists
+	}
+	return r.Repository.Save(id, url, userID)
+}
+
+// SaveURL сохраняет URL или возвращает внедрённый сбой
+func (r *FaultRepository) SaveURL(u models.URL) (string, error) {
+	fail, exists := r.inject("SaveURL")
+	if fail {
+		return "", ErrInjectedFault
+	}
+	if exists {
+		return u.ShortID, ErrURLExists
+	}
+	return r.Repository.SaveURL(u)
+}
+
+// Get возвращает URL или внедрённый сбой
+func (r *FaultRepository) Get(id string) (models.URL, bool, error) {
+	if fail, _ := r.inject("Get"); fail {
+		return models.URL{}, false, ErrInjectedFault
+	}
+	return r.Repository.Get(id)
+}
+
+// BatchGet возвращает URL или внедрённый сбой
+func (r *FaultRepository) BatchGet(ids []string) (map[string]models.URL, error) {
+	if fail, _ := r.inject("BatchGet"); fail {
+		return nil, ErrInjectedFault
+	}
+	return r.Repository.BatchGet(ids)
+}
+
+// BatchSave сохраняет URL или возвращает внедрённый сбой
+func (r *FaultRepository) BatchSave(items []models.BatchItem, userID string) error {
+	if fail, _ := r.inject("BatchSave"); fail {
+		return ErrInjectedFault
+	}
+	return r.Repository.BatchSave(items, userID)
+}
+
+// GetURLsByUserID возвращает URL пользователя или внедрённый сбой
+func (r *FaultRepository) GetURLsByUserID(userID string) ([]models.URL, error) {
+	if fail, _ := r.inject("GetURLsByUserID"); fail {
+		return nil, ErrInjectedFault
+	}
+	return r.Repository.GetURLsByUserID(userID)
+}
+
+// GetURLsByUserAndTag возвращает URL пользователя с меткой или внедрённый сбой
+func (r *FaultRepository) GetURLsByUserAndTag(userID, tag string) ([]models.URL, error) {
+	if fail, _ := r.inject("GetURLsByUserAndTag"); fail {
+		return nil, ErrInjectedFault
+	}
+	return r.Repository.GetURLsByUserAndTag(userID, tag)
+}
+
+// BatchDelete удаляет URL или возвращает внедрённый сбой
+func (r *FaultRepository) BatchDelete(userID string, ids []string) error {
+	if fail, _ := r.inject("BatchDelete"); fail {
+		return ErrInjectedFault
+	}
+	return r.Repository.BatchDelete(userID, ids)
+}
+
+// DeleteByUserAndHost удаляет URL пользователя по хосту или возвращает внедрённый сбой
+func (r *FaultRepository) DeleteByUserAndHost(userID, host string) (int, error) {
+	if fail, _ := r.inject("DeleteByUserAndHost"); fail {
+		return 0, ErrInjectedFault
+	}
+	return r.Repository.DeleteByUserAndHost(userID, host)
+}
+
+// ReassignUser передаёт URL пользователя или возвращает внедрённый сбой
+func (r *FaultRepository) ReassignUser(fromUserID, toUserID string) (int, error) {
+	if fail, _ := r.inject("ReassignUser"); fail {
+		return 0, ErrInjectedFault
+	}
+	return r.Repository.ReassignUser(fromUserID, toUserID)
+}
+
+// ClaimURL передаёт URL новому владельцу или возвращает внедрённый сбой
+func (r *FaultRepository) ClaimURL(id, tokenHash, userID string) error {
+	if fail, _ := r.inject("ClaimURL"); fail {
+		return ErrInjectedFault
+	}
+	return r.Repository.ClaimURL(id, tokenHash, userID)
+}
+
+// SetNSFW меняет пометку URL или возвращает внедрённый сбой
+func (r *FaultRepository) SetNSFW(id string, nsfw bool) error {
+	if fail, _ := r.inject("SetNSFW"); fail {
+		return ErrInjectedFault
+	}
+	return r.Repository.SetNSFW(id, nsfw)
+}
+
+// ReserveIDs резервирует короткие ID или возвращает внедрённый сбой
+func (r *FaultRepository) ReserveIDs(ids []string, userID string, createdAt time.Time) error {
+	if fail, _ := r.inject("ReserveIDs"); fail {
+		return ErrInjectedFault
+	}
+	return r.Repository.ReserveIDs(ids, userID, createdAt)
+}
+
+// ActivateReserved задаёт адрес назначения зарезервированного ID или возвращает внедрённый сбой
+func (r *FaultRepository) ActivateReserved(id, userID, originalURL string) error {
+	if fail, _ := r.inject("ActivateReserved"); fail {
+		return ErrInjectedFault
+	}
+	return r.Repository.ActivateReserved(id, userID, originalURL)
+}
+
+// GetUserIDsByURL возвращает владельцев URL или внедрённый сбой
+func (r *FaultRepository) GetUserIDsByURL(originalURL string) ([]string, error) {
+	if fail, _ := r.inject("GetUserIDsByURL"); fail {
+		return nil, ErrInjectedFault
+	}
+	return r.Repository.GetUserIDsByURL(originalURL)
+}
+
+// SaveUser записывает выданного пользователя или возвращает внедрённый сбой
+func (r *FaultRepository) SaveUser(userID string, firstSeen time.Time) error {
+	if fail, _ := r.inject("SaveUser"); fail {
+		return ErrInjectedFault
+	}
+	return r.Repository.SaveUser(userID, firstSeen)
+}
+
+// Count возвращает количество занятых коротких ID или внедрённый сбой
+func (r *FaultRepository) Count() (int, error) {
+	if fail, _ := r.inject("Count"); fail {
+		return 0, ErrInjectedFault
+	}
+	return r.Repository.Count()
+}
+
+// IndexStats возвращает размеры индексов основного хранилища; сбои в отчёт не внедряются
+func (r *FaultRepository) IndexStats() []models.IndexStats {
+	return indexStatsOf(r.Repository)
+}
+
+// UserRevision возвращает ревизию ссылок пользователя в основном хранилище; сбои не внедряются
+func (r *FaultRepository) UserRevision(userID string) (string, bool) {
+	return userRevisionOf(r.Repository, userID)
+}
+
+// RecordReferrer учитывает источник перехода в основном хранилище или возвращает внедрённый сбой
+func (r *FaultRepository) RecordReferrer(id, referrer string) error {
+	if fail, _ := r.inject("RecordReferrer"); fail {
+		return ErrInjectedFault
+	}
+	return recordReferrerIn(r.Repository, id, referrer)
+}
+
+// TopReferrers возвращает источники переходов из основного хранилища или внедрённый сбой
+func (r *FaultRepository) TopReferrers(ids []string, limit int) (map[string][]models.ReferrerCount, error) {
+	if fail, _ := r.inject("TopReferrers"); fail {
+		return nil, ErrInjectedFault
+	}
+	return topReferrersOf(r.Repository, ids, limit)
+}
+
+// RecordClicks учитывает переходы в основном хранилище или возвращает внедрённый сбой
+func (r *FaultRepository) RecordClicks(id, ref string, n int) error {
+	if fail, _ := r.inject("RecordClicks"); fail {
+		return ErrInjectedFault
+	}
+	return recordClicksIn(r.Repository, id, ref, n)
+}
+
+// ClickCounts возвращает переходы из основного хранилища или внедрённый сбой
+func (r *FaultRepository) ClickCounts(ids []string) (map[string]map[string]int, error) {
+	if fail, _ := r.inject("ClickCounts"); fail {
+		return nil, ErrInjectedFault
+	}
+	return clickCountsOf(r.Repository, ids)
+}
+
+// GetStats возвращает статистику или внедрённый сбой
+func (r *FaultRepository) GetStats() (int, int, error) {
+	if fail, _ := r.inject("GetStats"); fail {
+		return 0, 0, ErrInjectedFault
+	}
+	return r.Repository.GetStats()
+}
+
+// GetUserStats возвращает статистику пользователя или внедрённый сбой
+func (r *FaultRepository) GetUserStats(userID string, now time.Time) (models.UserStats, error) {
+	if fail, _ := r.inject("GetUserStats"); fail {
+		return models.UserStats{}, ErrInjectedFault
+	}
+	return r.Repository.GetUserStats(userID, now)
+}
+
+// TopUsers возвращает рейтинг пользователей или внедрённый сбой
+func (r *FaultRepository) TopUsers(limit int) ([]models.UserURLCount, error) {
+	if fail, _ := r.inject("TopUsers"); fail {
+		return nil, ErrInjectedFault
+	}
+	return r.Repository.TopUsers(limit)
+}
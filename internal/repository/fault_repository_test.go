@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/models"
+)
+
+func TestFaultRepository(t *testing.T) {
+	repo := WithFaults(NewMemoryRepository(), FaultConfig{Methods: map[string]FaultRule{"Save": {ErrorRate: 1}}})
+
+	// Сбой внедряется только в указанный метод
+	_, err := repo.Save("id1", "https://example.com", "user1")
+	assert.ErrorIs(t, err, ErrInjectedFault)
+	_, err = repo.SaveURL(models.URL{ShortID: "id1", OriginalURL: "https://example.com", UserID: "user1"})
+	assert.NoError(t, err)
+	_, exists, _ := repo.Get("id1")
+	assert.True(t, exists)
+
+	// Правило "*" применяется к методам без собственного правила
+	assert.NoError(t, repo.SetConfig(FaultConfig{Methods: map[string]FaultRule{AllMethods: {ErrorRate: 1}, "GetStats": {}}}))
+	_, exists, err = repo.Get("id1")
+	assert.ErrorIs(t, err, ErrInjectedFault)
+	assert.False(t, exists)
+	_, err = repo.GetURLsByUserID("user1")
+	assert.ErrorIs(t, err, ErrInjectedFault)
+	count, _, err := repo.GetStats()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	assert.NoError(t, repo.SetConfig(FaultConfig{Methods: map[string]FaultRule{"SaveURL": {ExistsRate: 1}}}))
+	id, err := repo.SaveURL(models.URL{ShortID: "id2", OriginalURL: "https://example.org"})
+	assert.ErrorIs(t, err, ErrURLExists)
+	assert.Equal(t, "id2", id)
+
+	// Пустая конфигурация отключает сбои
+	assert.NoError(t, repo.SetConfig(FaultConfig{}))
+	_, err = repo.Save("id3", "https://example.net", "user1")
+	assert.NoError(t, err)
+}
+
+func TestFaultRepository_Seed(t *testing.T) {
+	cfg := FaultConfig{Seed: 42, Methods: map[string]FaultRule{"BatchDelete": {ErrorRate: 0.5}}}
+	run := func() []bool {
+		repo := WithFaults(NewMemoryRepository(), cfg)
+		results := make([]bool, 20)
+		for i := range results {
+			results[i] = errors.Is(repo.BatchDelete("user1", nil), ErrInjectedFault)
+		}
+		return results
+	}
+
+	first := run()
+	assert.Equal(t, first, run(), "Same seed should produce the same faults")
+	assert.Contains(t, first, true)
+	assert.Contains(t, first, false)
+}
+
+func TestFaultRepository_Latency(t *testing.T) {
+	repo := WithFaults(NewMemoryRepository(), FaultConfig{Methods: map[string]FaultRule{"Get": {Latency: 150 * time.Millisecond}}})
+	var slept []time.Duration
+	repo.sleep = func(d time.Duration) { slept = append(slept, d) }
+
+	repo.Get("id1")
+	_, _, _ = repo.GetStats()
+	assert.Equal(t, []time.Duration{150 * time.Millisecond}, slept)
+}
+
+func TestFaultConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     FaultConfig
+		wantErr bool
+	}{
+		{name: "Empty", cfg: FaultConfig{}},
+		{name: "Valid", cfg: FaultConfig{Methods: map[string]FaultRule{"*": {ErrorRate: 0.1}, "Save": {ExistsRate: 1, Latency: time.Second}}}},
+		{name: "Unknown method", cfg: FaultConfig{Methods: map[string]FaultRule{"Drop": {ErrorRate: 1}}}, wantErr: true},
+		{name: "Rate above one", cfg: FaultConfig{Methods: map[string]FaultRule{"Save": {ErrorRate: 1.5}}}, wantErr: true},
+		{name: "Negative rate", cfg: FaultConfig{Methods: map[string]FaultRule{"Save": {ExistsRate: -0.1}}}, wantErr: true},
+		{name: "Negative latency", cfg: FaultConfig{Methods: map[string]FaultRule{"Save": {Latency: -time.Second}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidFaultConfig)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
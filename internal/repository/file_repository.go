@@ -2,10 +2,19 @@ package repository
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
 
 	"github.com/tempizhere/goshorty/internal/models"
 	"go.uber.org/zap"
@@ -13,29 +22,91 @@ import (
 
 // URLRecord представляет запись в JSON-файле
 type URLRecord struct {
-	UUID        string `json:"uuid"`
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
-	UserID      string `json:"user_id,omitempty"`
-	DeletedFlag bool   `json:"is_deleted"`
+	UUID        string   `json:"uuid"`
+	ShortURL    string   `json:"short_url"`
+	OriginalURL string   `json:"original_url"`
+	UserID      string   `json:"user_id,omitempty"`
+	DeletedFlag bool     `json:"is_deleted"`
+	Tags        []string `json:"tags,omitempty"`
+	Tombstone   bool     `json:"tombstone,omitempty"`  // Запись-надгробие: помечает ShortURL удалённым до компакции
+	CreatedAt   int64    `json:"created_at,omitempty"` // Время создания в секундах Unix
+
+	ClaimTokenHash string `json:"claim_token_hash,omitempty"` // SHA-256 токена владения анонимной ссылки
+	NSFW           bool   `json:"nsfw,omitempty"`             // Ссылка помечена модерацией как NSFW
+	Reserved       bool   `json:"reserved,omitempty"`         // Зарезервированный код без адреса назначения
+	Description    string `json:"description,omitempty"`      // Заметка пользователя о ссылке
+
+	// Запись передачи: с этого места файла ShortURL принадлежит UserID, а хеш токена владения — ClaimTokenHash
+	Transfer bool `json:"transfer,omitempty"`
+	// Запись активации: зарезервированный ShortURL пользователя UserID получает адрес OriginalURL
+	Activation bool `json:"activation,omitempty"`
+	// Запись модерации: с этого места файла пометка NSFW у ShortURL равна NSFW
+	Moderation bool `json:"moderation,omitempty"`
+}
+
+// recordMeta хранит поля записи, которые читаются из файла, а в памяти нужны только
+// для его восстановления после удаления каталога (healStorageDir)
+type recordMeta struct {
+	tags        []string
+	description string
+	createdAt   int64 // Время создания в секундах Unix
+}
+
+// userRecord представляет строку файла выданных пользователей
+type userRecord struct {
+	UserID    string `json:"user_id"`
+	FirstSeen int64  `json:"first_seen"` // Время первого появления в секундах Unix
+}
+
+// overlay сообщает, что запись не описывает URL, а меняет состояние ранее записанного
+// (надгробие, передача, активация или модерация)
+func (rec URLRecord) overlay() bool {
+	return rec.Tombstone || rec.Transfer || rec.Activation || rec.Moderation
+}
+
+// createdAt возвращает время создания записи или нулевое время для старых записей
+func (rec URLRecord) createdAt() time.Time {
+	if rec.CreatedAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(rec.CreatedAt, 0)
 }
 
 // FileRepository реализует интерфейс Repository с использованием файла
 type FileRepository struct {
 	store        map[string]string // short_id -> original_url
-	urlToShortID map[string]string // original_url -> short_id
+	urlToShortID map[string]string // original_url -> short_id; nil, если обратный индекс отключён
+	owners       map[string]string // short_id -> user_id
+	byUser       userIndex         // user_id -> short_id в порядке записей файла
+	claims       map[string]string // short_id -> хеш токена владения
+	deleted      map[string]struct{}
+	reserved     map[string]struct{}
+	nsfw         map[string]struct{}
+	meta         map[string]recordMeta
+	users        map[string]time.Time
+	revs         userRevisions
+	tombstones   int         // Количество надгробий и других записей-наложений в файле, ожидающих компакции
+	duplicates   int         // Записи с повторным short_id, пропущенные при последней загрузке
+	fileInfo     os.FileInfo // Состояние файла после последней собственной записи
+	stale        atomic.Bool // Файл заменён или усечён извне, данные в памяти расходятся с файлом
+	reverseIndex bool        // Поддерживать urlToShortID для дедупликации URL
+	selfHeal     bool        // Пересоздавать каталог хранилища, если его удалили во время работы
+	writeRetry   writeRetry
 	filePath     string
 	logger       *zap.Logger
 	mutex        sync.RWMutex
 }
 
 // NewFileRepository создаёт новый экземпляр FileRepository
-func NewFileRepository(filePath string, logger *zap.Logger) (*FileRepository, error) {
+func NewFileRepository(filePath string, logger *zap.Logger, opts ...Option) (*FileRepository, error) {
+	o := applyOptions(opts)
 	repo := &FileRepository{
-		store:        make(map[string]string),
-		urlToShortID: make(map[string]string),
 		filePath:     filePath,
 		logger:       logger,
+		revs:         newUserRevisions(),
+		reverseIndex: !o.disableReverseIndex,
+		selfHeal:     !o.disableSelfHeal,
+		writeRetry:   writeRetry{attempts: o.writeAttempts, backoff: o.writeBackoff, sleep: time.Sleep},
 	}
 
 	// Создаём директорию, если не существует
@@ -43,53 +114,478 @@ func NewFileRepository(filePath string, logger *zap.Logger) (*FileRepository, er
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, err
 	}
+	repo.removeStaleTempFiles(dir, o.tempFileMaxAge)
+
+	repo.mutex.Lock()
+	defer repo.mutex.Unlock()
+	if err := repo.load(); err != nil {
+		return nil, err
+	}
+	if err := repo.loadUsers(); err != nil {
+		return nil, err
+	}
+	if o.repairOnLoad && repo.duplicates > 0 {
+		if err := repo.rewrite(firstRecordOnly()); err != nil {
+			return nil, err
+		}
+		repo.logger.Info("Removed duplicate short IDs from file", zap.String("file_path", filePath), zap.Int("records", repo.duplicates))
+		if err := repo.load(); err != nil {
+			return nil, err
+		}
+	}
+	return repo, nil
+}
+
+// tempFilePattern — шаблон имени временного файла, через который rewrite атомарно заменяет файл хранилища
+const tempFilePattern = "temp_*.json"
+
+// removeStaleTempFiles удаляет из dir временные файлы rewrite старше maxAge, оставшиеся после аварийного
+// завершения между созданием и переименованием. Более свежие файлы могут принадлежать другому процессу и не трогаются
+func (r *FileRepository) removeStaleTempFiles(dir string, maxAge time.Duration) {
+	paths, err := filepath.Glob(filepath.Join(dir, tempFilePattern))
+	if err != nil {
+		return
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || time.Since(info.ModTime()) < maxAge {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			r.logger.Warn("Failed to remove stale temporary file", zap.String("path", path), zap.Error(err))
+			continue
+		}
+		r.logger.Info("Removed stale temporary file", zap.String("path", path))
+	}
+}
+
+// firstRecordOnly возвращает фильтр для rewrite, оставляющий только первую запись каждого short_id
+func firstRecordOnly() func(*URLRecord) bool {
+	seen := make(map[string]struct{})
+	return func(record *URLRecord) bool {
+		if _, exists := seen[record.ShortURL]; exists {
+			return false
+		}
+		seen[record.ShortURL] = struct{}{}
+		return true
+	}
+}
+
+// newReverseIndex создаёт обратный индекс или возвращает nil, если он отключён
+func (r *FileRepository) newReverseIndex() map[string]string {
+	if !r.reverseIndex {
+		return nil
+	}
+	return make(map[string]string)
+}
+
+// indexURL добавляет original_url в обратный индекс, если он включён
+func (r *FileRepository) indexURL(url, id string) {
+	if r.urlToShortID != nil {
+		r.urlToShortID[url] = id
+	}
+}
+
+// load заполняет карты из файла, создавая пустой файл при его отсутствии
+// Вызывающий должен удерживать r.mutex на запись
+func (r *FileRepository) load() error {
+	r.store = make(map[string]string)
+	r.urlToShortID = r.newReverseIndex()
+	r.owners = make(map[string]string)
+	r.byUser = make(userIndex)
+	r.deleted = make(map[string]struct{})
+	r.reserved = make(map[string]struct{})
+	r.nsfw = make(map[string]struct{})
+	r.meta = make(map[string]recordMeta)
+	r.claims = make(map[string]string)
+	r.revs.bumpAll()
+	r.tombstones = 0
+	r.duplicates = 0
 
 	// Читаем существующий файл, если он есть
-	file, err := os.Open(filePath)
+	file, err := os.Open(r.filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// Файл не существует, создадим пустой
-			newFile, createErr := os.Create(filePath)
+			newFile, createErr := os.Create(r.filePath)
 			if createErr != nil {
-				return nil, createErr
+				return createErr
 			}
 			if closeErr := newFile.Close(); closeErr != nil {
-				return nil, closeErr
+				return closeErr
 			}
-			return repo, nil
+			r.resetFileInfo()
+			return nil
 		}
-		return nil, err
+		return err
 	}
 	defer func() {
 		if closeErr := file.Close(); closeErr != nil {
-			repo.logger.Error("Failed to close file", zap.Error(closeErr))
+			r.logger.Error("Failed to close file", zap.Error(closeErr))
 		}
 	}()
 
-	// Читаем файл построчно
-	scanner := bufio.NewScanner(file)
+	// Читаем файл построчно; записи-наложения применяем после всех записей в порядке файла,
+	// а индекс пользователей строим по итоговым владельцам
+	var overlays []URLRecord
+	var ids []string
+	scanner := newFileScan(context.Background(), bufio.NewScanner(file), r.logger, "load")
 	for scanner.Scan() {
 		var record URLRecord
 		if unmarshalErr := json.Unmarshal(scanner.Bytes(), &record); unmarshalErr != nil {
-			repo.logger.Warn("Skipping invalid JSON line", zap.String("line", string(scanner.Bytes())), zap.Error(err))
+			scanner.Skip(unmarshalErr)
+			continue
+		}
+		if record.overlay() {
+			overlays = append(overlays, record)
 			continue
 		}
-		repo.mutex.Lock()
-		repo.store[record.ShortURL] = record.OriginalURL
-		repo.urlToShortID[record.OriginalURL] = record.ShortURL
-		repo.mutex.Unlock()
+		// При повторах побеждает первая запись, чтобы состояние не зависело от хвоста файла
+		if _, exists := r.store[record.ShortURL]; exists {
+			r.duplicates++
+			r.logger.Warn("Skipping duplicate short ID in file",
+				zap.String("short_id", record.ShortURL), zap.String("original_url", record.OriginalURL))
+			continue
+		}
+		r.store[record.ShortURL] = record.OriginalURL
+		if record.Reserved {
+			r.reserved[record.ShortURL] = struct{}{}
+		} else if shortID, indexed := r.urlToShortID[record.OriginalURL]; indexed {
+			r.logger.Warn("Duplicate original URL in file, keeping first short ID in index",
+				zap.String("short_id", record.ShortURL), zap.String("indexed_short_id", shortID))
+		} else {
+			r.indexURL(record.OriginalURL, record.ShortURL)
+		}
+		r.owners[record.ShortURL] = record.UserID
+		r.meta[record.ShortURL] = recordMeta{tags: record.Tags, description: record.Description, createdAt: record.CreatedAt}
+		ids = append(ids, record.ShortURL)
+		if record.DeletedFlag {
+			r.deleted[record.ShortURL] = struct{}{}
+		}
+		if record.ClaimTokenHash != "" {
+			r.claims[record.ShortURL] = record.ClaimTokenHash
+		}
+		if record.NSFW {
+			r.nsfw[record.ShortURL] = struct{}{}
+		}
 	}
 	if err := scanner.Err(); err != nil {
-		return nil, err
+		return err
 	}
 
-	return repo, nil
+	for _, overlay := range overlays {
+		owner, exists := r.owners[overlay.ShortURL]
+		switch {
+		case !exists:
+		case overlay.Transfer:
+			r.owners[overlay.ShortURL] = overlay.UserID
+			if overlay.ClaimTokenHash == "" {
+				delete(r.claims, overlay.ShortURL)
+			} else {
+				r.claims[overlay.ShortURL] = overlay.ClaimTokenHash
+			}
+		case overlay.Activation:
+			if _, reserved := r.reserved[overlay.ShortURL]; reserved && owner == overlay.UserID {
+				r.store[overlay.ShortURL] = overlay.OriginalURL
+				r.indexURL(overlay.OriginalURL, overlay.ShortURL)
+				delete(r.reserved, overlay.ShortURL)
+			}
+		case overlay.Moderation:
+			if overlay.NSFW {
+				r.nsfw[overlay.ShortURL] = struct{}{}
+			} else {
+				delete(r.nsfw, overlay.ShortURL)
+			}
+		case owner == overlay.UserID:
+			r.deleted[overlay.ShortURL] = struct{}{}
+		}
+	}
+	r.tombstones = len(overlays)
+	for _, id := range ids {
+		r.byUser.add(r.owners[id], id)
+	}
+
+	if info, statErr := file.Stat(); statErr == nil {
+		r.fileInfo = info
+	}
+	return nil
+}
+
+// resetFileInfo запоминает текущее состояние файла после его пересоздания самим репозиторием
+// Вызывающий должен удерживать r.mutex на запись
+func (r *FileRepository) resetFileInfo() {
+	info, err := os.Stat(r.filePath)
+	if err != nil {
+		r.logger.Error("Failed to stat file", zap.Error(err))
+		r.fileInfo = nil
+		return
+	}
+	r.fileInfo = info
+}
+
+// trackAppend обновляет запомненное состояние файла после дозаписи written байт
+// Если файл успели заменить или усечь извне, состояние не обновляется, чтобы это обнаружил наблюдатель
+// Вызывающий должен удерживать r.mutex на запись
+func (r *FileRepository) trackAppend(written int) {
+	info, err := os.Stat(r.filePath)
+	if err != nil {
+		return
+	}
+	if r.fileInfo != nil && (!os.SameFile(r.fileInfo, info) || info.Size() != r.fileInfo.Size()+int64(written)) {
+		return
+	}
+	r.fileInfo = info
+}
+
+// healStorageDir пересоздаёт каталог хранилища, если его удалили во время работы, и восстанавливает
+// файлы хранилища и пользователей из состояния в памяти со всеми полями записей, чтобы ссылки не пропали вместе с каталогом
+// При DisableSelfHeal ничего не делает, и последующая запись возвращает ошибку
+// Вызывающий должен удерживать r.mutex на запись
+func (r *FileRepository) healStorageDir() error {
+	if !r.selfHeal {
+		return nil
+	}
+	dir := filepath.Dir(r.filePath)
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := r.replaceFile(r.filePath, r.writeMemoryRecords); err != nil {
+		return err
+	}
+	r.resetFileInfo()
+	r.tombstones = 0
+	if err := r.replaceFile(r.usersPath(), r.writeMemoryUsers); err != nil {
+		return err
+	}
+	r.stale.Store(false)
+	r.logger.Warn("Storage directory was removed at runtime, recreated it from memory",
+		zap.String("dir", dir), zap.String("file_path", r.filePath), zap.Int("urls", len(r.store)), zap.Int("users", len(r.users)))
+	return nil
+}
+
+// writeMemoryRecords пишет в w записи всех коротких ID из памяти в порядке ID
+// Вызывающий должен удерживать r.mutex на запись
+func (r *FileRepository) writeMemoryRecords(w *bufio.Writer) error {
+	ids := make([]string, 0, len(r.store))
+	for id := range r.store {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		_, deleted := r.deleted[id]
+		_, reserved := r.reserved[id]
+		_, nsfw := r.nsfw[id]
+		meta := r.meta[id]
+		if err := writeJSONLine(w, URLRecord{
+			UUID:        id,
+			ShortURL:    id,
+			OriginalURL: r.store[id],
+			UserID:      r.owners[id],
+			DeletedFlag: deleted,
+			Tags:        meta.tags,
+			CreatedAt:   meta.createdAt,
+
+			ClaimTokenHash: r.claims[id],
+			NSFW:           nsfw,
+			Reserved:       reserved,
+			Description:    meta.description,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMemoryUsers пишет в w выданных пользователей из памяти в порядке ID
+// Вызывающий должен удерживать r.mutex на запись
+func (r *FileRepository) writeMemoryUsers(w *bufio.Writer) error {
+	userIDs := make([]string, 0, len(r.users))
+	for userID := range r.users {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Strings(userIDs)
+	for _, userID := range userIDs {
+		if err := writeJSONLine(w, userRecord{UserID: userID, FirstSeen: r.users[userID].Unix()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeJSONLine пишет v в w одной строкой JSON
+func writeJSONLine(w *bufio.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	_, err = w.Write(data)
+	return err
+}
+
+// ErrWriteRetriesExhausted возвращается, если дозапись в файл не удалась после всех попыток
+var ErrWriteRetriesExhausted = errors.New("file write retries exhausted")
+
+// writeRetry повторяет операции записи в файл при временных ошибках с удваивающейся паузой
+type writeRetry struct {
+	attempts int
+	backoff  time.Duration
+	sleep    func(time.Duration)
+}
+
+// transientWriteError сообщает, может ли повтор записи после ошибки err завершиться успешно
+// Нехватка места и прерванные системные вызовы считаются временными, остальные ошибки (например, нет прав) — нет
+func transientWriteError(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EAGAIN)
+}
+
+// appendTarget — файл, открытый на дозапись; частичную запись можно отменить, обрезав его
+type appendTarget interface {
+	io.Writer
+	Seek(offset int64, whence int) (int64, error)
+	Truncate(size int64) error
+}
+
+// write дописывает data в f целиком или не дописывает ничего: при ошибке файл обрезается до прежнего размера,
+// чтобы в нём не осталось половины строки. Повтор выполняет retryWrite
+func (r *FileRepository) write(f appendTarget, data []byte) error {
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		return nil
+	}
+	if truncErr := f.Truncate(offset); truncErr != nil {
+		r.logger.Error("Failed to truncate partial write", zap.String("file_path", r.filePath), zap.Int64("offset", offset), zap.Error(truncErr))
+	}
+	return err
+}
+
+// retryWrite выполняет операцию записи op и повторяет её при временных ошибках с удваивающейся паузой
+// op сама берёт и отпускает r.mutex, поэтому пауза проходит без блокировки, а повтор заново проверяет состояние
+func (r *FileRepository) retryWrite(op func() error) error {
+	backoff := r.writeRetry.backoff
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || !transientWriteError(err) {
+			return err
+		}
+		if attempt >= r.writeRetry.attempts {
+			return fmt.Errorf("%w after %d attempts: %w", ErrWriteRetriesExhausted, attempt, err)
+		}
+		r.logger.Warn("Retrying file write", zap.String("file_path", r.filePath), zap.Int("attempt", attempt), zap.Error(err))
+		r.writeRetry.sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// fileChanged сообщает, был ли файл заменён, удалён или изменён в обход репозитория
+// Вызывающий должен удерживать r.mutex
+func (r *FileRepository) fileChanged() (bool, string) {
+	info, err := os.Stat(r.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, "removed"
+		}
+		r.logger.Error("Failed to stat file", zap.Error(err))
+		return false, ""
+	}
+	switch {
+	case r.fileInfo == nil:
+		return false, ""
+	case !os.SameFile(r.fileInfo, info):
+		return true, "replaced"
+	case info.Size() < r.fileInfo.Size():
+		return true, "truncated"
+	case info.Size() != r.fileInfo.Size() || !info.ModTime().Equal(r.fileInfo.ModTime()):
+		return true, "modified"
+	}
+	return false, ""
+}
+
+// Healthy сообщает, соответствуют ли данные в памяти файлу хранилища
+func (r *FileRepository) Healthy() bool {
+	return !r.stale.Load()
+}
+
+// checkFile проверяет файл хранилища и при обнаружении внешнего изменения помечает репозиторий устаревшим,
+// а при reload перечитывает карты из нового файла под блокировкой на запись
+func (r *FileRepository) checkFile(reload bool) {
+	r.mutex.RLock()
+	changed, reason := r.fileChanged()
+	r.mutex.RUnlock()
+	if !changed {
+		return
+	}
+
+	if !r.stale.Swap(true) {
+		r.logger.Error("Storage file changed outside of the repository, in-memory data is stale",
+			zap.String("file_path", r.filePath), zap.String("reason", reason))
+	}
+	if !reload {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.load(); err != nil {
+		r.logger.Error("Failed to reload storage file", zap.String("file_path", r.filePath), zap.Error(err))
+		return
+	}
+	r.stale.Store(false)
+	r.logger.Info("Reloaded storage file", zap.String("file_path", r.filePath), zap.Int("urls", len(r.store)))
+}
+
+// Watch раз в interval проверяет, не заменён ли файл хранилища извне, до отмены контекста
+// При reloadOnChange данные перечитываются из нового файла, иначе репозиторий остаётся помеченным как устаревший
+func (r *FileRepository) Watch(ctx context.Context, interval time.Duration, reloadOnChange bool) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.checkFile(reloadOnChange)
+		}
+	}
 }
 
 // Save сохраняет пару ID-URL в хранилище и файл
 func (r *FileRepository) Save(id, url, userID string) (string, error) {
+	return r.SaveURL(models.URL{
+		ShortID:     id,
+		OriginalURL: url,
+		UserID:      userID,
+	})
+}
+
+// SaveURL сохраняет URL со всеми атрибутами в хранилище и файл
+func (r *FileRepository) SaveURL(u models.URL) (string, error) {
+	var id string
+	err := r.retryWrite(func() (err error) {
+		id, err = r.saveURL(u)
+		return err
+	})
+	return id, err
+}
+
+// saveURL выполняет одну попытку SaveURL; данные в памяти меняются только после успешной записи в файл
+func (r *FileRepository) saveURL(u models.URL) (string, error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
+	if err := r.healStorageDir(); err != nil {
+		return "", err
+	}
+
+	id, url := u.ShortID, u.OriginalURL
 
 	// Проверяем, существует ли original_url
 	if shortID, exists := r.urlToShortID[url]; exists {
@@ -97,16 +593,23 @@ func (r *FileRepository) Save(id, url, userID string) (string, error) {
 		return shortID, ErrURLExists
 	}
 
-	r.store[id] = url
-	r.urlToShortID[url] = id
+	createdAt := u.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
 
 	// Создаём запись для файла
 	record := URLRecord{
 		UUID:        id,
 		ShortURL:    id,
 		OriginalURL: url,
-		UserID:      userID,
+		UserID:      u.UserID,
 		DeletedFlag: false,
+		Tags:        u.Tags,
+		CreatedAt:   createdAt.Unix(),
+
+		ClaimTokenHash: u.ClaimTokenHash,
+		Description:    u.Description,
 	}
 	data, err := json.Marshal(record)
 	if err != nil {
@@ -120,6 +623,8 @@ func (r *FileRepository) Save(id, url, userID string) (string, error) {
 			if removeErr := os.Remove(r.filePath); removeErr != nil {
 				return "", removeErr
 			}
+			// Файл будет создан заново самим репозиторием
+			r.fileInfo = nil
 		}
 	}
 
@@ -134,27 +639,42 @@ func (r *FileRepository) Save(id, url, userID string) (string, error) {
 		}
 	}()
 
-	if _, err = file.Write(data); err != nil {
+	if err = r.write(file, data); err != nil {
 		return "", err
 	}
+	r.trackAppend(len(data))
+
+	if owner, exists := r.owners[id]; exists {
+		r.byUser.remove(owner, id)
+		r.revs.bump(owner)
+	}
+	r.store[id] = url
+	r.indexURL(url, id)
+	r.owners[id] = u.UserID
+	r.meta[id] = recordMeta{tags: u.Tags, description: u.Description, createdAt: record.CreatedAt}
+	r.byUser.add(u.UserID, id)
+	r.revs.bump(u.UserID)
+	if u.ClaimTokenHash != "" {
+		r.claims[id] = u.ClaimTokenHash
+	}
 	return id, nil
 }
 
 // Get возвращает URL по ID, если он существует
-func (r *FileRepository) Get(id string) (models.URL, bool) {
+func (r *FileRepository) Get(id string) (models.URL, bool, error) {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
 	url, exists := r.store[id]
 	if !exists {
-		return models.URL{}, false
+		return models.URL{}, false, nil
 	}
 
 	// Читаем файл для получения UserID и DeletedFlag
 	file, err := os.Open(r.filePath)
 	if err != nil {
 		r.logger.Error("Failed to open file", zap.Error(err))
-		return models.URL{}, false
+		return models.URL{}, false, fmt.Errorf("%w: %v", ErrUnavailable, err)
 	}
 	defer func() {
 		if err := file.Close(); err != nil {
@@ -162,22 +682,98 @@ func (r *FileRepository) Get(id string) (models.URL, bool) {
 		}
 	}()
 
-	var record URLRecord
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
+		// Запись объявляется заново для каждой строки: поля с omitempty (tombstone, reserved)
+		// иначе сохранились бы от предыдущей строки
+		var record URLRecord
 		if unmarshalErr := json.Unmarshal(scanner.Bytes(), &record); unmarshalErr != nil {
 			continue
 		}
-		if record.ShortURL == id {
+		if record.ShortURL == id && !record.overlay() {
+			_, deleted := r.deleted[id]
+			_, reserved := r.reserved[id]
+			_, nsfw := r.nsfw[id]
 			return models.URL{
 				ShortID:     id,
 				OriginalURL: url,
-				UserID:      record.UserID,
-				DeletedFlag: record.DeletedFlag,
-			}, true
+				UserID:      r.owners[id],
+				DeletedFlag: record.DeletedFlag || deleted,
+				Tags:        record.Tags,
+				NSFW:        nsfw,
+				Reserved:    reserved,
+				Description: record.Description,
+			}, true, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return models.URL{}, false, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return models.URL{}, false, nil
+}
+
+// BatchGet возвращает найденные URL по списку ID за один проход по файлу
+func (r *FileRepository) BatchGet(ids []string) (map[string]models.URL, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	result := make(map[string]models.URL, len(ids))
+	wanted := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		if _, exists := r.store[id]; exists {
+			wanted[id] = struct{}{}
+		}
+	}
+	if len(wanted) == 0 {
+		return result, nil
+	}
+
+	file, err := os.Open(r.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, nil
+		}
+		return nil, err
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil {
+			r.logger.Error("Failed to close file", zap.Error(closeErr))
+		}
+	}()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() && len(result) < len(wanted) {
+		var record URLRecord
+		if unmarshalErr := json.Unmarshal(scanner.Bytes(), &record); unmarshalErr != nil {
+			continue
+		}
+		if record.overlay() {
+			continue
+		}
+		if _, ok := wanted[record.ShortURL]; !ok {
+			continue
+		}
+		if _, seen := result[record.ShortURL]; seen {
+			continue
+		}
+		_, deleted := r.deleted[record.ShortURL]
+		_, reserved := r.reserved[record.ShortURL]
+		_, nsfw := r.nsfw[record.ShortURL]
+		result[record.ShortURL] = models.URL{
+			ShortID:     record.ShortURL,
+			OriginalURL: r.store[record.ShortURL],
+			UserID:      r.owners[record.ShortURL],
+			DeletedFlag: record.DeletedFlag || deleted,
+			Tags:        record.Tags,
+			NSFW:        nsfw,
+			Reserved:    reserved,
+			Description: record.Description,
 		}
 	}
-	return models.URL{}, false
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
 // Clear очищает хранилище и файл
@@ -186,32 +782,75 @@ func (r *FileRepository) Clear() {
 	defer r.mutex.Unlock()
 
 	r.store = make(map[string]string)
-	r.urlToShortID = make(map[string]string)
+	r.urlToShortID = r.newReverseIndex()
+	r.owners = make(map[string]string)
+	r.byUser = make(userIndex)
+	r.deleted = make(map[string]struct{})
+	r.reserved = make(map[string]struct{})
+	r.nsfw = make(map[string]struct{})
+	r.meta = make(map[string]recordMeta)
+	r.claims = make(map[string]string)
+	r.users = make(map[string]time.Time)
+	r.revs.bumpAll()
+	r.tombstones = 0
 	if err := os.Remove(r.filePath); err != nil {
 		r.logger.Error("Failed to remove file", zap.Error(err))
 	}
+	if err := os.Remove(r.usersPath()); err != nil && !os.IsNotExist(err) {
+		r.logger.Error("Failed to remove users file", zap.Error(err))
+	}
 	newFile, err := os.Create(r.filePath)
 	if err == nil {
 		if err := newFile.Close(); err != nil {
 			r.logger.Error("Failed to close file", zap.Error(err))
 		}
 	}
+	r.resetFileInfo()
+	r.stale.Store(false)
+}
+
+// BatchSave сохраняет множество пар ID-URL в хранилище и файл в порядке элементов
+func (r *FileRepository) BatchSave(items []models.BatchItem, userID string) error {
+	return r.retryWrite(func() error {
+		return r.batchSave(items, userID)
+	})
 }
 
-// BatchSave сохраняет множество пар ID-URL в хранилище и файл
-func (r *FileRepository) BatchSave(urls map[string]string, userID string) error {
+// batchSave выполняет одну попытку BatchSave: пакет дописывается одной записью и применяется в памяти после неё
+func (r *FileRepository) batchSave(items []models.BatchItem, userID string) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
+	if err := r.healStorageDir(); err != nil {
+		return err
+	}
 
-	for id, url := range urls {
-		if shortID, exists := r.urlToShortID[url]; exists {
-			r.logger.Info("URL already exists in batch", zap.String("original_url", url), zap.String("short_id", shortID))
-			return ErrURLExists
+	// Проверяем занятость ID под той же блокировкой, что и сохранение
+	if !uniqueBatchIDs(items) {
+		r.logger.Info("Short ID repeated in batch")
+		return ErrIDExists
+	}
+	for _, item := range items {
+		if _, exists := r.store[item.ShortID]; exists {
+			r.logger.Info("Short ID already exists in batch", zap.String("short_id", item.ShortID))
+			return ErrIDExists
 		}
-		r.store[id] = url
-		r.urlToShortID[url] = id
 	}
 
+	// Повтор URL отклоняет пакет целиком до изменения данных в памяти, иначе они разойдутся с файлом
+	if r.urlToShortID != nil {
+		batchURLs := make(map[string]string, len(items))
+		for _, item := range items {
+			shortID, exists := r.urlToShortID[item.OriginalURL]
+			if !exists {
+				shortID, exists = batchURLs[item.OriginalURL]
+			}
+			if exists {
+				r.logger.Info("URL already exists in batch", zap.String("original_url", item.OriginalURL), zap.String("short_id", shortID))
+				return ErrURLExists
+			}
+			batchURLs[item.OriginalURL] = item.ShortID
+		}
+	}
 	file, err := os.OpenFile(r.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
 		return err
@@ -222,32 +861,78 @@ func (r *FileRepository) BatchSave(urls map[string]string, userID string) error
 		}
 	}()
 
-	for id, url := range urls {
+	var data []byte
+	now := time.Now()
+	createdAt := make([]int64, len(items))
+	for i, item := range items {
+		created := item.CreatedAt
+		if created.IsZero() {
+			created = now
+		}
+		createdAt[i] = created.Unix()
 		record := URLRecord{
-			UUID:        id,
-			ShortURL:    id,
-			OriginalURL: url,
+			UUID:        item.ShortID,
+			ShortURL:    item.ShortID,
+			OriginalURL: item.OriginalURL,
 			UserID:      userID,
 			DeletedFlag: false,
+			CreatedAt:   createdAt[i],
 		}
-		data, err := json.Marshal(record)
+		line, err := json.Marshal(record)
 		if err != nil {
 			return err
 		}
+		data = append(data, line...)
 		data = append(data, '\n')
-		if _, err := file.Write(data); err != nil {
-			return err
-		}
 	}
+	if err := r.write(file, data); err != nil {
+		return err
+	}
+	r.trackAppend(len(data))
+
+	for i, item := range items {
+		r.store[item.ShortID] = item.OriginalURL
+		r.indexURL(item.OriginalURL, item.ShortID)
+		r.owners[item.ShortID] = userID
+		r.meta[item.ShortID] = recordMeta{createdAt: createdAt[i]}
+		r.byUser.add(userID, item.ShortID)
+	}
+	r.revs.bump(userID)
 	return nil
 }
 
 // GetURLsByUserID возвращает все URL, связанные с пользователем
 func (r *FileRepository) GetURLsByUserID(userID string) ([]models.URL, error) {
+	return r.readUserURLs(context.Background(), userID, "")
+}
+
+// GetURLsByUserIDContext работает как GetURLsByUserID, но прекращает чтение файла при отмене контекста
+func (r *FileRepository) GetURLsByUserIDContext(ctx context.Context, userID string) ([]models.URL, error) {
+	return r.readUserURLs(ctx, userID, "")
+}
+
+// GetURLsByUserAndTag возвращает URL пользователя, помеченные указанной меткой
+func (r *FileRepository) GetURLsByUserAndTag(userID, tag string) ([]models.URL, error) {
+	return r.readUserURLs(context.Background(), userID, tag)
+}
+
+// readUserURLs читает из файла URL пользователя, при непустом tag оставляя только помеченные им
+// Индекс пользователей задаёт искомые ID: без ссылок файл не читается, а чтение прекращается на последней из них
+func (r *FileRepository) readUserURLs(ctx context.Context, userID, tag string) ([]models.URL, error) {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
 	var urls []models.URL
+	wanted := make(map[string]struct{}, len(r.byUser[userID]))
+	for _, id := range r.byUser[userID] {
+		if _, reserved := r.reserved[id]; !reserved {
+			wanted[id] = struct{}{}
+		}
+	}
+	if len(wanted) == 0 {
+		return urls, nil
+	}
+
 	file, err := os.Open(r.filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -261,21 +946,35 @@ func (r *FileRepository) GetURLsByUserID(userID string) ([]models.URL, error) {
 		}
 	}()
 
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
+	// Как и при загрузке, из повторов short_id учитывается только первая запись
+	scanner := newFileScan(ctx, bufio.NewScanner(file), r.logger, "user_urls")
+	for len(wanted) > 0 && scanner.Scan() {
 		var record URLRecord
 		if unmarshalErr := json.Unmarshal(scanner.Bytes(), &record); unmarshalErr != nil {
-			r.logger.Warn("Skipping invalid JSON line", zap.String("line", string(scanner.Bytes())), zap.Error(unmarshalErr))
+			scanner.Skip(unmarshalErr)
+			continue
+		}
+		if record.overlay() {
+			continue
+		}
+		if _, ok := wanted[record.ShortURL]; !ok {
 			continue
 		}
-		if record.UserID == userID {
-			urls = append(urls, models.URL{
-				ShortID:     record.ShortURL,
-				OriginalURL: record.OriginalURL,
-				UserID:      record.UserID,
-				DeletedFlag: record.DeletedFlag,
-			})
+		delete(wanted, record.ShortURL)
+		_, deleted := r.deleted[record.ShortURL]
+		u := models.URL{
+			ShortID:     record.ShortURL,
+			OriginalURL: r.store[record.ShortURL],
+			UserID:      userID,
+			DeletedFlag: record.DeletedFlag || deleted,
+			Tags:        record.Tags,
+			CreatedAt:   record.createdAt(),
+			Description: record.Description,
+		}
+		if tag != "" && !u.HasTag(tag) {
+			continue
 		}
+		urls = append(urls, u)
 	}
 	if err := scanner.Err(); err != nil {
 		return nil, err
@@ -284,10 +983,597 @@ func (r *FileRepository) GetURLsByUserID(userID string) ([]models.URL, error) {
 }
 
 // BatchDelete помечает указанные URL как удалённые
+// Удаление сразу применяется в памяти, а в файл дописываются записи-надгробия;
+// физическая перезапись файла откладывается до компакции (RunCompaction, Compact или Close)
 func (r *FileRepository) BatchDelete(userID string, ids []string) error {
+	return r.BatchDeleteContext(context.Background(), userID, ids)
+}
+
+// BatchDeleteContext работает как BatchDelete, но не начинает удаление, если контекст отменён,
+// в том числе пока запрос ждал блокировку хранилища за долгим чтением файла
+func (r *FileRepository) BatchDeleteContext(ctx context.Context, userID string, ids []string) error {
+	return r.retryWrite(func() error {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		_, err := r.markDeleted(userID, ids)
+		return err
+	})
+}
+
+// DeleteByUserAndHost помечает удалёнными все URL пользователя с указанным хостом
+func (r *FileRepository) DeleteByUserAndHost(userID, host string) (int, error) {
+	var deleted int
+	err := r.retryWrite(func() (err error) {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		var ids []string
+		for _, id := range r.byUser[userID] {
+			if hostMatches(r.store[id], host) {
+				ids = append(ids, id)
+			}
+		}
+		deleted, err = r.markDeleted(userID, ids)
+		return err
+	})
+	return deleted, err
+}
+
+// markDeleted дописывает надгробия для неудалённых URL пользователя и возвращает их количество
+// Вызывающий должен удерживать r.mutex на запись
+func (r *FileRepository) markDeleted(userID string, ids []string) (int, error) {
+	var data []byte
+	var marked []string
+	for _, id := range ids {
+		if owner, exists := r.owners[id]; !exists || owner != userID {
+			continue
+		}
+		if _, deleted := r.deleted[id]; deleted {
+			continue
+		}
+		line, err := json.Marshal(URLRecord{
+			UUID:        id,
+			ShortURL:    id,
+			UserID:      userID,
+			DeletedFlag: true,
+			Tombstone:   true,
+		})
+		if err != nil {
+			return 0, err
+		}
+		data = append(data, line...)
+		data = append(data, '\n')
+		marked = append(marked, id)
+	}
+	if len(marked) == 0 {
+		return 0, nil
+	}
+	if err := r.appendOverlays(data); err != nil {
+		return 0, err
+	}
+
+	for _, id := range marked {
+		r.deleted[id] = struct{}{}
+		r.logger.Info("Marked URL as deleted", zap.String("short_id", id), zap.String("user_id", userID))
+	}
+	r.revs.bump(userID)
+	r.tombstones += len(marked)
+	return len(marked), nil
+}
+
+// Verify проверяет файл хранилища: уникальность коротких ID и original_url, принадлежность надгробий
+// и соответствие данных в памяти содержимому файла
+// При repair повторы записей, битые строки, записи без ID и лишние надгробия отбрасываются при перезаписи файла,
+// после чего данные в памяти перечитываются; конфликтующие записи остаются для ручного разбора
+func (r *FileRepository) Verify(repair bool) (VerifyReport, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	report := VerifyReport{Backend: r.Name()}
+	file, err := os.Open(r.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return report, nil
+		}
+		return report, err
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil {
+			r.logger.Error("Failed to close file", zap.Error(closeErr))
+		}
+	}()
+
+	add := func(v Violation) {
+		report.Violations = append(report.Violations, v)
+	}
+	entries := make(map[string]URLRecord)  // short_id -> первая запись в файле
+	urlIDs := make(map[string]string)      // original_url -> short_id
+	conflicts := make(map[string]struct{}) // ID с конфликтующими записями
+	duplicateURLs := make(map[string]struct{})
+	deleted := make(map[string]struct{})
+	var overlays []URLRecord
+	var overlayLines []int
+
+	line := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line++
+		var record URLRecord
+		if unmarshalErr := json.Unmarshal(scanner.Bytes(), &record); unmarshalErr != nil {
+			add(Violation{Kind: ViolationInvalidLine, Line: line, Detail: unmarshalErr.Error(), Repairable: true})
+			continue
+		}
+		if record.overlay() {
+			overlays = append(overlays, record)
+			overlayLines = append(overlayLines, line)
+			continue
+		}
+		report.Records++
+		if record.ShortURL == "" {
+			add(Violation{Kind: ViolationEmptyShortID, Line: line, Detail: record.OriginalURL, Repairable: true})
+			continue
+		}
+		if record.DeletedFlag {
+			deleted[record.ShortURL] = struct{}{}
+		}
+		if prev, exists := entries[record.ShortURL]; exists {
+			if prev.OriginalURL == record.OriginalURL && prev.UserID == record.UserID {
+				add(Violation{Kind: ViolationDuplicateShortID, ShortID: record.ShortURL, Line: line, Repairable: true})
+			} else {
+				conflicts[record.ShortURL] = struct{}{}
+				add(Violation{
+					Kind:    ViolationConflictingShortID,
+					ShortID: record.ShortURL,
+					Line:    line,
+					Detail:  fmt.Sprintf("%s (user %q) conflicts with %s (user %q)", record.OriginalURL, record.UserID, prev.OriginalURL, prev.UserID),
+				})
+			}
+			continue
+		}
+		entries[record.ShortURL] = record
+		if !r.reverseIndex || record.Reserved {
+			continue
+		}
+		if other, exists := urlIDs[record.OriginalURL]; exists {
+			duplicateURLs[record.OriginalURL] = struct{}{}
+			add(Violation{Kind: ViolationDuplicateOriginalURL, ShortID: record.ShortURL, Line: line, Detail: "also used by " + other})
+			continue
+		}
+		urlIDs[record.OriginalURL] = record.ShortURL
+	}
+	if scanErr := scanner.Err(); scanErr != nil {
+		return report, scanErr
+	}
+
+	// Записи-наложения применяются в порядке файла к владельцам из первых записей
+	owners := make(map[string]string, len(entries))
+	for id, record := range entries {
+		owners[id] = record.UserID
+	}
+	activated := make(map[string]string) // short_id -> адрес из записи активации
+	for i, overlay := range overlays {
+		owner, exists := owners[overlay.ShortURL]
+		switch {
+		case overlay.Transfer && !exists:
+			add(Violation{Kind: ViolationOrphanTransfer, ShortID: overlay.ShortURL, Line: overlayLines[i], Repairable: true})
+		case overlay.Transfer:
+			owners[overlay.ShortURL] = overlay.UserID
+		case overlay.Activation:
+			if _, done := activated[overlay.ShortURL]; exists && !done && entries[overlay.ShortURL].Reserved && owner == overlay.UserID {
+				activated[overlay.ShortURL] = overlay.OriginalURL
+				continue
+			}
+			add(Violation{Kind: ViolationOrphanActivation, ShortID: overlay.ShortURL, Line: overlayLines[i], Repairable: true})
+		case overlay.Moderation && !exists:
+			add(Violation{Kind: ViolationOrphanModeration, ShortID: overlay.ShortURL, Line: overlayLines[i], Repairable: true})
+		case overlay.Moderation:
+			// Пометка NSFW не затрагивает проверяемые владельцев и индексы
+		case !exists || owner != overlay.UserID:
+			add(Violation{Kind: ViolationOrphanTombstone, ShortID: overlay.ShortURL, Line: overlayLines[i], Repairable: true})
+		default:
+			deleted[overlay.ShortURL] = struct{}{}
+		}
+	}
+
+	// Данные в памяти должны совпадать с файлом; конфликтующие записи уже отмечены выше
+	for id, record := range entries {
+		if _, conflict := conflicts[id]; conflict {
+			continue
+		}
+		_, memDeleted := r.deleted[id]
+		_, fileDeleted := deleted[id]
+		url, reserved := record.OriginalURL, record.Reserved
+		if activatedURL, ok := activated[id]; ok {
+			url, reserved = activatedURL, false
+		}
+		if r.store[id] != url || r.owners[id] != owners[id] || memDeleted != fileDeleted {
+			add(Violation{Kind: ViolationIndexMismatch, ShortID: id, Detail: "record in memory differs from file", Repairable: true})
+			continue
+		}
+		if _, duplicate := duplicateURLs[url]; r.urlToShortID != nil && !reserved && !duplicate && r.urlToShortID[url] != id {
+			add(Violation{Kind: ViolationIndexMismatch, ShortID: id, Detail: "reverse index points to " + r.urlToShortID[url], Repairable: true})
+		}
+	}
+	for id := range r.store {
+		if _, exists := entries[id]; !exists && id != "" {
+			add(Violation{Kind: ViolationIndexMismatch, ShortID: id, Detail: "record in memory is missing from file", Repairable: true})
+		}
+	}
+
+	if !repair {
+		return report, nil
+	}
+	repairable := 0
+	for _, v := range report.Violations {
+		if v.Repairable {
+			repairable++
+		}
+	}
+	if repairable == 0 {
+		return report, nil
+	}
+
+	// Сначала синхронизируем память с файлом, чтобы перезапись перенесла в записи только действительные удаления
+	if err := r.load(); err != nil {
+		return report, err
+	}
+	kept := make(map[string]struct{})
+	err = r.rewrite(func(record *URLRecord) bool {
+		if record.ShortURL == "" {
+			return false
+		}
+		if _, seen := kept[record.ShortURL]; seen {
+			first := entries[record.ShortURL]
+			return first.OriginalURL != record.OriginalURL || first.UserID != record.UserID
+		}
+		kept[record.ShortURL] = struct{}{}
+		return true
+	})
+	if err != nil {
+		return report, err
+	}
+	if err := r.load(); err != nil {
+		return report, err
+	}
+	for i := range report.Violations {
+		if report.Violations[i].Repairable {
+			report.Violations[i].Repaired = true
+		}
+	}
+	r.logger.Info("Repaired storage file", zap.String("file_path", r.filePath), zap.Int("violations", repairable))
+	return report, nil
+}
+
+// Параметры фоновой компакции файла хранилища (RunCompaction)
+const (
+	DefaultCompactInterval = time.Minute // Как часто проверяется, пора ли переписать файл
+	compactMinTombstones   = 1000        // Меньше надгробий файл не переписывается: перезапись дороже их чтения при загрузке
+	compactRatio           = 0.25        // Доля надгробий относительно записей, после которой файл переписывается
+)
+
+// needsCompaction сообщает, накопилось ли достаточно надгробий для перезаписи файла
+// Вызывающий должен удерживать r.mutex
+func (r *FileRepository) needsCompaction() bool {
+	return r.tombstones >= compactMinTombstones && float64(r.tombstones) >= compactRatio*float64(len(r.store))
+}
+
+// compactIfNeeded переписывает файл, если надгробий накопилось больше порога
+func (r *FileRepository) compactIfNeeded() error {
+	r.mutex.RLock()
+	needed := r.needsCompaction()
+	r.mutex.RUnlock()
+	if !needed {
+		return nil
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if !r.needsCompaction() {
+		return nil
+	}
+	return r.compact()
+}
+
+// RunCompaction раз в interval переписывает файл, если надгробий и записей передачи стало не меньше
+// compactMinTombstones и доли compactRatio от записей, до отмены контекста
+// Так файл долго работающего процесса не растёт от удалений, а перезапись не попадает в обработку запросов
+func (r *FileRepository) RunCompaction(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.compactIfNeeded(); err != nil {
+				r.logger.Error("Failed to compact file", zap.String("file_path", r.filePath), zap.Error(err))
+			}
+		}
+	}
+}
+
+// Compact переписывает файл, перенося удаления в сами записи и отбрасывая надгробия
+func (r *FileRepository) Compact() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.compact()
+}
+
+// compact выполняет компакцию; вызывающий должен удерживать r.mutex
+func (r *FileRepository) compact() error {
+	if r.tombstones == 0 {
+		return nil
+	}
+	if err := r.rewrite(nil); err != nil {
+		return err
+	}
+	r.logger.Info("Compacted storage file", zap.String("file_path", r.filePath), zap.Int("tombstones", r.tombstones))
+	r.tombstones = 0
+	return nil
+}
+
+// ReassignUser передаёт все URL пользователя fromUserID пользователю toUserID
+// В файл дописываются записи передачи, как надгробия при удалении; перенос в сами записи откладывается до Compact
+func (r *FileRepository) ReassignUser(fromUserID, toUserID string) (int, error) {
+	var moved int
+	err := r.retryWrite(func() (err error) {
+		moved, err = r.reassignUser(fromUserID, toUserID)
+		return err
+	})
+	return moved, err
+}
+
+// reassignUser выполняет одну попытку ReassignUser
+func (r *FileRepository) reassignUser(fromUserID, toUserID string) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ids := r.byUser[fromUserID]
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	var data []byte
+	for _, id := range ids {
+		line, err := json.Marshal(URLRecord{
+			UUID:           id,
+			ShortURL:       id,
+			UserID:         toUserID,
+			ClaimTokenHash: r.claims[id],
+			Transfer:       true,
+		})
+		if err != nil {
+			return 0, err
+		}
+		data = append(data, line...)
+		data = append(data, '\n')
+	}
+	if err := r.appendOverlays(data); err != nil {
+		return 0, err
+	}
+
+	for _, id := range r.byUser.move(fromUserID, toUserID) {
+		r.owners[id] = toUserID
+	}
+	r.revs.bump(fromUserID, toUserID)
+	r.tombstones += len(ids)
+	r.logger.Info("Reassigned URLs", zap.String("from_user_id", fromUserID), zap.String("to_user_id", toUserID), zap.Int("urls", len(ids)))
+	return len(ids), nil
+}
+
+// appendOverlays дописывает в файл подготовленные строки записей-наложений
+// Вызывающий должен удерживать r.mutex на запись
+func (r *FileRepository) appendOverlays(data []byte) error {
+	file, err := os.OpenFile(r.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil {
+			r.logger.Error("Failed to close file", zap.Error(closeErr))
+		}
+	}()
+
+	if err := r.write(file, data); err != nil {
+		return err
+	}
+	r.trackAppend(len(data))
+	return nil
+}
+
+// ClaimURL передаёт URL пользователю userID по хешу токена владения и гасит токен
+// В файл дописывается запись передачи без хеша токена, как при ReassignUser; перенос в саму запись откладывается до компакции
+func (r *FileRepository) ClaimURL(id, tokenHash, userID string) error {
+	return r.retryWrite(func() error {
+		return r.claimURL(id, tokenHash, userID)
+	})
+}
+
+// claimURL выполняет одну попытку ClaimURL
+func (r *FileRepository) claimURL(id, tokenHash, userID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	_, deleted := r.deleted[id]
+	if hash, ok := r.claims[id]; !ok || deleted || hash != tokenHash {
+		return ErrClaimRejected
+	}
+	line, err := json.Marshal(URLRecord{
+		UUID:     id,
+		ShortURL: id,
+		UserID:   userID,
+		Transfer: true,
+	})
+	if err != nil {
+		return err
+	}
+	if err := r.appendOverlays(append(line, '\n')); err != nil {
+		return err
+	}
+	r.byUser.remove(r.owners[id], id)
+	r.byUser.add(userID, id)
+	r.revs.bump(r.owners[id], userID)
+	r.owners[id] = userID
+	delete(r.claims, id)
+	r.tombstones++
+	return nil
+}
+
+// SetNSFW помечает URL как NSFW или снимает пометку
+// В файл дописывается запись модерации; перенос пометки в саму запись откладывается до компакции
+func (r *FileRepository) SetNSFW(id string, nsfw bool) error {
+	return r.retryWrite(func() error {
+		return r.setNSFW(id, nsfw)
+	})
+}
+
+// setNSFW выполняет одну попытку SetNSFW
+func (r *FileRepository) setNSFW(id string, nsfw bool) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, exists := r.store[id]; !exists {
+		return ErrURLNotFound
+	}
+	line, err := json.Marshal(URLRecord{
+		UUID:       id,
+		ShortURL:   id,
+		NSFW:       nsfw,
+		Moderation: true,
+	})
+	if err != nil {
+		return err
+	}
+	if err := r.appendOverlays(append(line, '\n')); err != nil {
+		return err
+	}
+	if nsfw {
+		r.nsfw[id] = struct{}{}
+	} else {
+		delete(r.nsfw, id)
+	}
+	r.revs.bump(r.owners[id])
+	r.tombstones++
+	return nil
+}
+
+// ReserveIDs резервирует короткие ID за пользователем, дописывая записи без адреса назначения в файл
+func (r *FileRepository) ReserveIDs(ids []string, userID string, createdAt time.Time) error {
+	return r.retryWrite(func() error {
+		return r.reserveIDs(ids, userID, createdAt)
+	})
+}
+
+// reserveIDs выполняет одну попытку ReserveIDs: резерв дописывается одной записью и применяется в памяти после неё
+func (r *FileRepository) reserveIDs(ids []string, userID string, createdAt time.Time) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
+	if err := r.healStorageDir(); err != nil {
+		return err
+	}
+
+	// Проверяем занятость ID под той же блокировкой, что и резервирование
+	for _, id := range ids {
+		if _, exists := r.store[id]; exists {
+			r.logger.Info("Short ID already exists in reservation", zap.String("short_id", id))
+			return ErrIDExists
+		}
+	}
 
+	file, err := os.OpenFile(r.filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			r.logger.Error("Failed to close file", zap.Error(err))
+		}
+	}()
+
+	var data []byte
+	for _, id := range ids {
+		line, err := json.Marshal(URLRecord{
+			UUID:      id,
+			ShortURL:  id,
+			UserID:    userID,
+			CreatedAt: createdAt.Unix(),
+			Reserved:  true,
+		})
+		if err != nil {
+			return err
+		}
+		data = append(data, line...)
+		data = append(data, '\n')
+	}
+	if err := r.write(file, data); err != nil {
+		return err
+	}
+	r.trackAppend(len(data))
+
+	for _, id := range ids {
+		r.store[id] = ""
+		r.owners[id] = userID
+		r.meta[id] = recordMeta{createdAt: createdAt.Unix()}
+		r.byUser.add(userID, id)
+		r.reserved[id] = struct{}{}
+	}
+	r.revs.bump(userID)
+	return nil
+}
+
+// ActivateReserved задаёт адрес назначения зарезервированного ID
+// В файл дописывается запись активации; перенос адреса в саму запись откладывается до компакции
+func (r *FileRepository) ActivateReserved(id, userID, originalURL string) error {
+	return r.retryWrite(func() error {
+		return r.activateReserved(id, userID, originalURL)
+	})
+}
+
+// activateReserved выполняет одну попытку ActivateReserved
+func (r *FileRepository) activateReserved(id, userID, originalURL string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if _, reserved := r.reserved[id]; !reserved || r.owners[id] != userID {
+		return ErrNotReserved
+	}
+	if shortID, exists := r.urlToShortID[originalURL]; exists {
+		r.logger.Info("URL already exists", zap.String("original_url", originalURL), zap.String("short_id", shortID))
+		return ErrURLExists
+	}
+	line, err := json.Marshal(URLRecord{
+		UUID:        id,
+		ShortURL:    id,
+		OriginalURL: originalURL,
+		UserID:      userID,
+		Activation:  true,
+	})
+	if err != nil {
+		return err
+	}
+	if err := r.appendOverlays(append(line, '\n')); err != nil {
+		return err
+	}
+	r.store[id] = originalURL
+	r.indexURL(originalURL, id)
+	delete(r.reserved, id)
+	r.revs.bump(userID)
+	r.tombstones++
+	return nil
+}
+
+// rewrite переписывает файл без записей-наложений, перенося удаления, передачи, активации и пометки NSFW в сами записи
+// и применяя transform к каждой записи;
+// записи, для которых transform возвращает false, отбрасываются
+// Вызывающий должен удерживать r.mutex на запись
+func (r *FileRepository) rewrite(transform func(*URLRecord) bool) error {
 	// Читаем существующие записи
 	file, err := os.Open(r.filePath)
 	if err != nil {
@@ -303,20 +1589,36 @@ func (r *FileRepository) BatchDelete(userID string, ids []string) error {
 	}()
 
 	var records []URLRecord
-	scanner := bufio.NewScanner(file)
+	seen := make(map[string]struct{})
+	scanner := newFileScan(context.Background(), bufio.NewScanner(file), r.logger, "rewrite")
 	for scanner.Scan() {
 		var record URLRecord
 		if unmarshalErr := json.Unmarshal(scanner.Bytes(), &record); unmarshalErr != nil {
-			r.logger.Warn("Skipping invalid JSON line", zap.String("line", string(scanner.Bytes())), zap.Error(unmarshalErr))
+			scanner.Skip(unmarshalErr)
+			continue
+		}
+		if record.overlay() {
 			continue
 		}
-		// Помечаем как удалённые только подходящие записи
-		for _, id := range ids {
-			if record.ShortURL == id && record.UserID == userID {
-				record.DeletedFlag = true
-				r.logger.Info("Marked URL as deleted", zap.String("short_id", id), zap.String("user_id", userID))
+		if _, deleted := r.deleted[record.ShortURL]; deleted {
+			record.DeletedFlag = true
+		}
+		// Передачи, активации и пометки NSFW переносятся в первую запись ID, которая и загружается в память
+		if _, duplicate := seen[record.ShortURL]; !duplicate {
+			seen[record.ShortURL] = struct{}{}
+			if owner, exists := r.owners[record.ShortURL]; exists {
+				record.UserID = owner
+				record.ClaimTokenHash = r.claims[record.ShortURL]
+				_, record.NSFW = r.nsfw[record.ShortURL]
+				if _, reserved := r.reserved[record.ShortURL]; record.Reserved && !reserved {
+					record.OriginalURL = r.store[record.ShortURL]
+					record.Reserved = false
+				}
 			}
 		}
+		if transform != nil && !transform(&record) {
+			continue
+		}
 		records = append(records, record)
 	}
 	if scanErr := scanner.Err(); scanErr != nil {
@@ -324,37 +1626,67 @@ func (r *FileRepository) BatchDelete(userID string, ids []string) error {
 	}
 
 	// Переписываем файл
-	tmpFile, err := os.CreateTemp(filepath.Dir(r.filePath), "temp_*.json")
+	err = r.replaceFile(r.filePath, func(w *bufio.Writer) error {
+		for _, record := range records {
+			if err := writeJSONLine(w, record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.resetFileInfo()
+	return nil
+}
+
+// replaceFile атомарно заменяет файл path содержимым, которое пишет fill, через временный файл в том же каталоге
+func (r *FileRepository) replaceFile(path string, fill func(w *bufio.Writer) error) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), tempFilePattern)
 	if err != nil {
 		return err
 	}
+	tmpPath := tmpFile.Name()
 	defer func() {
+		if tmpFile == nil {
+			return
+		}
 		if err := tmpFile.Close(); err != nil {
 			r.logger.Error("Failed to close temporary file", zap.Error(err))
 		}
+		if err := os.Remove(tmpPath); err != nil {
+			r.logger.Error("Failed to remove temporary file", zap.String("path", tmpPath), zap.Error(err))
+		}
 	}()
 
-	for _, record := range records {
-		data, err := json.Marshal(record)
-		if err != nil {
-			return err
-		}
-		data = append(data, '\n')
-		if _, err := tmpFile.Write(data); err != nil {
-			return err
-		}
+	writer := bufio.NewWriter(tmpFile)
+	if err := fill(writer); err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
 	}
+	tmpFile = nil
 
 	// Заменяем исходный файл
-	if err := os.Rename(tmpFile.Name(), r.filePath); err != nil {
+	if err := os.Rename(tmpPath, path); err != nil {
+		_ = os.Remove(tmpPath)
 		return err
 	}
-
 	return nil
 }
 
 // GetStats возвращает статистику сервиса: количество URL и пользователей
 func (r *FileRepository) GetStats() (int, int, error) {
+	return r.GetStatsContext(context.Background())
+}
+
+// GetStatsContext работает как GetStats, но прекращает чтение файла при отмене контекста
+func (r *FileRepository) GetStatsContext(ctx context.Context) (int, int, error) {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
@@ -373,18 +1705,27 @@ func (r *FileRepository) GetStats() (int, int, error) {
 
 	urlCount := 0
 	userSet := make(map[string]struct{})
+	seen := make(map[string]struct{})
 
-	scanner := bufio.NewScanner(file)
+	scanner := newFileScan(ctx, bufio.NewScanner(file), r.logger, "stats")
 	for scanner.Scan() {
 		var record URLRecord
 		if unmarshalErr := json.Unmarshal(scanner.Bytes(), &record); unmarshalErr != nil {
-			r.logger.Warn("Skipping invalid JSON line", zap.String("line", string(scanner.Bytes())), zap.Error(unmarshalErr))
+			scanner.Skip(unmarshalErr)
+			continue
+		}
+		if record.overlay() {
+			continue
+		}
+		if _, duplicate := seen[record.ShortURL]; duplicate {
 			continue
 		}
-		if !record.DeletedFlag {
+		seen[record.ShortURL] = struct{}{}
+		_, deleted := r.deleted[record.ShortURL]
+		if _, reserved := r.reserved[record.ShortURL]; !record.DeletedFlag && !deleted && !reserved {
 			urlCount++
-			if record.UserID != "" {
-				userSet[record.UserID] = struct{}{}
+			if owner := r.owners[record.ShortURL]; owner != "" {
+				userSet[owner] = struct{}{}
 			}
 		}
 	}
@@ -392,17 +1733,187 @@ func (r *FileRepository) GetStats() (int, int, error) {
 	if scanErr := scanner.Err(); scanErr != nil {
 		return 0, 0, scanErr
 	}
+	for userID := range r.users {
+		userSet[userID] = struct{}{}
+	}
 
 	return urlCount, len(userSet), nil
 }
 
+// usersPath возвращает путь файла выданных пользователей рядом с файлом хранилища
+func (r *FileRepository) usersPath() string {
+	return r.filePath + ".users"
+}
+
+// loadUsers читает выданных пользователей; отсутствие файла не ошибка
+// Вызывающий должен удерживать r.mutex на запись
+func (r *FileRepository) loadUsers() error {
+	r.users = make(map[string]time.Time)
+	file, err := os.Open(r.usersPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer func() {
+		if closeErr := file.Close(); closeErr != nil {
+			r.logger.Error("Failed to close users file", zap.Error(closeErr))
+		}
+	}()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record userRecord
+		if unmarshalErr := json.Unmarshal(scanner.Bytes(), &record); unmarshalErr != nil || record.UserID == "" {
+			r.logger.Warn("Skipping invalid user line", zap.String("line", string(scanner.Bytes())), zap.Error(unmarshalErr))
+			continue
+		}
+		if _, exists := r.users[record.UserID]; !exists {
+			r.users[record.UserID] = time.Unix(record.FirstSeen, 0)
+		}
+	}
+	return scanner.Err()
+}
+
+// SaveUser дописывает выданного пользователя в файл пользователей, если он ещё не записан
+func (r *FileRepository) SaveUser(userID string, firstSeen time.Time) error {
+	return r.retryWrite(func() error {
+		return r.saveUser(userID, firstSeen)
+	})
+}
+
+// saveUser выполняет одну попытку SaveUser
+func (r *FileRepository) saveUser(userID string, firstSeen time.Time) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.healStorageDir(); err != nil {
+		return err
+	}
+	if _, exists := r.users[userID]; exists {
+		return nil
+	}
+
+	data, err := json.Marshal(userRecord{UserID: userID, FirstSeen: firstSeen.Unix()})
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(r.usersPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			r.logger.Error("Failed to close users file", zap.Error(err))
+		}
+	}()
+	if err := r.write(file, append(data, '\n')); err != nil {
+		return err
+	}
+	r.users[userID] = firstSeen
+	return nil
+}
+
+// Count возвращает количество занятых коротких ID, включая удалённые и зарезервированные
+func (r *FileRepository) Count() (int, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return len(r.store), nil
+}
+
+// GetUserStats возвращает статистику использования сервиса пользователем
+func (r *FileRepository) GetUserStats(userID string, now time.Time) (models.UserStats, error) {
+	urls, err := r.GetURLsByUserID(userID)
+	if err != nil {
+		return models.UserStats{}, err
+	}
+	return aggregateUserStats(urls, now), nil
+}
+
+// GetUserIDsByURL возвращает пользователей, создавших ссылки на originalURL, по данным в памяти
+func (r *FileRepository) GetUserIDsByURL(originalURL string) ([]string, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	owners := make(map[string]struct{})
+	for id, url := range r.store {
+		if owner := r.owners[id]; url == originalURL && owner != "" {
+			owners[owner] = struct{}{}
+		}
+	}
+	return sortedUserIDs(owners), nil
+}
+
+// TopUsers возвращает пользователей с наибольшим числом активных URL по данным в памяти
+func (r *FileRepository) TopUsers(limit int) ([]models.UserURLCount, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	counts := make(map[string]*models.UserURLCount)
+	for id, owner := range r.owners {
+		if _, reserved := r.reserved[id]; reserved {
+			continue
+		}
+		_, deleted := r.deleted[id]
+		countUser(counts, owner, deleted)
+	}
+	return rankUsers(counts, limit), nil
+}
+
+// recordMetaBytes — объём значения map полей записи
+func recordMetaBytes(m recordMeta) int64 {
+	size := int64(unsafe.Sizeof(m)) + int64(len(m.description))
+	for _, tag := range m.tags {
+		size += stringHeaderBytes + int64(len(tag))
+	}
+	return size
+}
+
+// IndexStats возвращает размеры карт и индексов, которые репозиторий держит в памяти
+func (r *FileRepository) IndexStats() []models.IndexStats {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	stats := []models.IndexStats{
+		mapStats("store", r.store, stringValueBytes),
+		mapStats("owners", r.owners, stringValueBytes),
+		r.byUser.stats("user_index"),
+		mapStats("claims", r.claims, stringValueBytes),
+		mapStats("deleted", r.deleted, emptyValueBytes),
+		mapStats("reserved", r.reserved, emptyValueBytes),
+		mapStats("nsfw", r.nsfw, emptyValueBytes),
+		mapStats("meta", r.meta, recordMetaBytes),
+		mapStats("users", r.users, func(t time.Time) int64 { return int64(unsafe.Sizeof(t)) }),
+	}
+	if r.urlToShortID != nil {
+		stats = append(stats, mapStats("url_index", r.urlToShortID, stringValueBytes))
+	}
+	return stats
+}
+
+// UserRevision возвращает ревизию ссылок пользователя
+func (r *FileRepository) UserRevision(userID string) (string, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.revs.revision(userID), true
+}
+
 // Close закрывает ресурсы репозитория (убеждается, что все данные записаны в файл)
 func (r *FileRepository) Close() error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
 	// FileRepository сохраняет данные при каждой операции,
-	// поэтому здесь просто логируем закрытие
+	// поэтому здесь остаётся только компакция накопленных надгробий
+	if err := r.compact(); err != nil {
+		r.logger.Error("Failed to compact file", zap.Error(err))
+		return err
+	}
 	r.logger.Info("FileRepository closed", zap.String("file_path", r.filePath))
 	return nil
 }
+
+// Name возвращает имя хранилища
+func (r *FileRepository) Name() string {
+	return "file"
+}
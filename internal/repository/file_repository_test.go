@@ -1,16 +1,39 @@
 package repository
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/models"
 	"go.uber.org/zap"
 )
 
+// newTestFileRepo создаёт FileRepository в собственной временной директории теста или бенчмарка,
+// поэтому такие тесты можно запускать параллельно; путь к файлу доступен через repo.filePath
+func newTestFileRepo(tb testing.TB, opts ...Option) *FileRepository {
+	tb.Helper()
+	repo, err := NewFileRepository(filepath.Join(tb.TempDir(), "storage.json"), zap.NewNop(), opts...)
+	if err != nil {
+		tb.Fatalf("Failed to create file repository: %v", err)
+	}
+	return repo
+}
+
 // TestFileRepository тестирует основные операции FileRepository
 func TestFileRepository(t *testing.T) {
+	t.Parallel()
 	tempDir := t.TempDir()
 	tempFile := filepath.Join(tempDir, "storage.json")
 
@@ -19,7 +42,7 @@ func TestFileRepository(t *testing.T) {
 	shortID, err := repo.Save("testID", "https://example.com", "user1")
 	assert.NoError(t, err, "Failed to save URL")
 	assert.Equal(t, "testID", shortID, "Returned short_id should match")
-	url, exists := repo.Get("testID")
+	url, exists, _ := repo.Get("testID")
 	assert.True(t, exists, "URL should exist")
 	assert.Equal(t, "https://example.com", url.OriginalURL, "URL should match")
 
@@ -27,20 +50,20 @@ func TestFileRepository(t *testing.T) {
 	existingID, err := repo.Save("newID", "https://example.com", "user1")
 	assert.ErrorIs(t, err, ErrURLExists, "Expected ErrURLExists for duplicate URL")
 	assert.Equal(t, "testID", existingID, "Should return existing short_id")
-	url, exists = repo.Get("testID")
+	url, exists, _ = repo.Get("testID")
 	assert.True(t, exists, "Original URL should still exist")
 	assert.Equal(t, "https://example.com", url.OriginalURL, "URL should match")
 
 	// Тест 3: Восстановление данных
 	repo2, err := NewFileRepository(tempFile, zap.NewNop())
 	assert.NoError(t, err, "Failed to create second file repository")
-	url, exists = repo2.Get("testID")
+	url, exists, _ = repo2.Get("testID")
 	assert.True(t, exists, "URL should be restored")
 	assert.Equal(t, "https://example.com", url.OriginalURL, "Restored URL mismatch")
 
 	// Тест 4: Очистка хранилища
 	repo.Clear()
-	_, exists = repo.Get("testID")
+	_, exists, _ = repo.Get("testID")
 	assert.False(t, exists, "URL should be cleared")
 	_, err = os.Stat(tempFile)
 	assert.NoError(t, err, "File should exist after clear")
@@ -50,12 +73,13 @@ func TestFileRepository(t *testing.T) {
 	assert.NoError(t, err, "Failed to write invalid JSON")
 	repo3, err := NewFileRepository(tempFile, zap.NewNop())
 	assert.NoError(t, err, "Should handle invalid JSON lines")
-	_, exists = repo3.Get("testID")
+	_, exists, _ = repo3.Get("testID")
 	assert.False(t, exists, "No URLs should be loaded from invalid JSON")
 }
 
 // TestFileRepository_NonExistentDir тестирует создание репозитория в несуществующей директории
 func TestFileRepository_NonExistentDir(t *testing.T) {
+	t.Parallel()
 	tempDir := t.TempDir()
 	tempFile := filepath.Join(tempDir, "subdir/storage.json")
 
@@ -67,6 +91,7 @@ func TestFileRepository_NonExistentDir(t *testing.T) {
 
 // TestFileRepository_FilePermissionError тестирует обработку ошибок прав доступа к файлу
 func TestFileRepository_FilePermissionError(t *testing.T) {
+	t.Parallel()
 	tempDir := t.TempDir()
 	tempFile := filepath.Join(tempDir, "storage.json")
 
@@ -81,43 +106,89 @@ func TestFileRepository_FilePermissionError(t *testing.T) {
 
 // TestFileRepository_BatchSave тестирует пакетное сохранение URL
 func TestFileRepository_BatchSave(t *testing.T) {
+	t.Parallel()
 	tempDir := t.TempDir()
 	tempFile := filepath.Join(tempDir, "storage_batch.json")
 
 	repo, err := NewFileRepository(tempFile, zap.NewNop())
 	assert.NoError(t, err, "Failed to create file repository")
-	urls := map[string]string{
-		"id1": "https://example1.com",
-		"id2": "https://example2.com",
-		"id3": "https://example3.com",
+	items := []models.BatchItem{
+		{ShortID: "id1", OriginalURL: "https://example1.com"},
+		{ShortID: "id2", OriginalURL: "https://example2.com"},
+		{ShortID: "id3", OriginalURL: "https://example3.com"},
 	}
-	err = repo.BatchSave(urls, "user1")
+	err = repo.BatchSave(items, "user1")
 	assert.NoError(t, err, "BatchSave should succeed")
 
 	// Проверяем, что все URL сохранены
-	for id, expectedURL := range urls {
-		url, exists := repo.Get(id)
+	for _, item := range items {
+		url, exists, _ := repo.Get(item.ShortID)
 		assert.True(t, exists, "URL should exist")
-		assert.Equal(t, expectedURL, url.OriginalURL, "URL should match")
+		assert.Equal(t, item.OriginalURL, url.OriginalURL, "URL should match")
 		assert.Equal(t, "user1", url.UserID, "UserID should match")
 	}
 
+	// Записи добавляются в файл в порядке элементов пакета
+	data, err := os.ReadFile(tempFile)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if assert.Len(t, lines, len(items)) {
+		for i, item := range items {
+			assert.Contains(t, lines[i], `"short_url":"`+item.ShortID+`"`)
+		}
+	}
+
 	// Тест 2: Попытка пакетного сохранения с дублирующимся URL
-	duplicateURLs := map[string]string{
-		"id4": "https://example1.com", // Дублирующийся URL
-		"id5": "https://example4.com",
+	duplicateURLs := []models.BatchItem{
+		{ShortID: "id4", OriginalURL: "https://example1.com"}, // Дублирующийся URL
+		{ShortID: "id5", OriginalURL: "https://example4.com"},
 	}
 	err = repo.BatchSave(duplicateURLs, "user1")
 	assert.ErrorIs(t, err, ErrURLExists, "Expected ErrURLExists for duplicate URL")
 
 	// Проверяем, что новые URL не были добавлены
-	_, exists := repo.Get("id4")
+	_, exists, _ := repo.Get("id4")
 	assert.False(t, exists, "Duplicate URL should not be saved")
-	_, exists = repo.Get("id5")
+	_, exists, _ = repo.Get("id5")
 	assert.False(t, exists, "URL after duplicate should not be saved")
 }
 
+func TestFileRepository_GetAfterTombstone(t *testing.T) {
+	t.Parallel()
+	repo := newTestFileRepo(t)
+	_, err := repo.Save("id1", "https://example.com/1", "user1")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.BatchDelete("user1", []string{"id1"}))
+	_, err = repo.Save("id2", "https://example.com/2", "user1")
+	assert.NoError(t, err)
+
+	// Запись после надгробия не принимается за надгробие
+	u, exists, err := repo.Get("id2")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.False(t, u.DeletedFlag)
+}
+
+func TestFileRepository_BatchGet(t *testing.T) {
+	t.Parallel()
+	repo := newTestFileRepo(t)
+
+	_, err := repo.Save("id1", "https://example1.com", "user1")
+	assert.NoError(t, err)
+	_, err = repo.Save("id2", "https://example2.com", "user2")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.BatchDelete("user2", []string{"id2"}))
+
+	urls, err := repo.BatchGet([]string{"id1", "id2", "unknown"})
+	assert.NoError(t, err)
+	assert.Len(t, urls, 2, "Should return only existing URLs")
+	assert.Equal(t, "user1", urls["id1"].UserID)
+	assert.False(t, urls["id1"].DeletedFlag)
+	assert.True(t, urls["id2"].DeletedFlag, "Deleted flag should be read from file")
+}
+
 func TestFileRepository_GetURLsByUserID(t *testing.T) {
+	t.Parallel()
 	// Создаём временную директорию для теста
 	tempDir := t.TempDir()
 	tempFile := filepath.Join(tempDir, "storage_user.json")
@@ -159,7 +230,596 @@ func TestFileRepository_GetURLsByUserID(t *testing.T) {
 	assert.Len(t, urls, 0, "Should return empty slice for non-existent user")
 }
 
+func TestFileRepository_GetURLsByUserAndTag(t *testing.T) {
+	t.Parallel()
+	tempDir := t.TempDir()
+	tempFile := filepath.Join(tempDir, "storage_tags.json")
+
+	repo, err := NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err, "Failed to create file repository")
+
+	// Сохраняем URL с метками и без
+	_, err = repo.SaveURL(models.URL{ShortID: "id1", OriginalURL: "https://example1.com", UserID: "user1", Tags: []string{"work"}})
+	assert.NoError(t, err)
+	_, err = repo.Save("id2", "https://example2.com", "user1")
+	assert.NoError(t, err)
+
+	urls, err := repo.GetURLsByUserAndTag("user1", "work")
+	assert.NoError(t, err)
+	assert.Len(t, urls, 1, "Should return only tagged URL")
+	assert.Equal(t, "id1", urls[0].ShortID)
+
+	// Метки должны сохраняться в файле и быть доступны после перезапуска
+	reopened, err := NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err, "Failed to reopen file repository")
+	u, exists, _ := reopened.Get("id1")
+	assert.True(t, exists)
+	assert.Equal(t, []string{"work"}, u.Tags)
+	urls, err = reopened.GetURLsByUserAndTag("user1", "work")
+	assert.NoError(t, err)
+	assert.Len(t, urls, 1, "Tagged URL should survive reload")
+}
+
+// countLines возвращает количество строк в файле
+func countLines(t *testing.T, path string) int {
+	file, err := os.Open(path)
+	assert.NoError(t, err)
+	defer func() {
+		_ = file.Close()
+	}()
+	lines := 0
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines++
+	}
+	assert.NoError(t, scanner.Err())
+	return lines
+}
+
+func TestFileRepository_BatchDeleteTombstones(t *testing.T) {
+	t.Parallel()
+	tempDir := t.TempDir()
+	tempFile := filepath.Join(tempDir, "storage_large.json")
+
+	// Готовим файл на 100k записей
+	const total = 100000
+	file, err := os.Create(tempFile)
+	assert.NoError(t, err)
+	writer := bufio.NewWriter(file)
+	for i := 0; i < total; i++ {
+		id := fmt.Sprintf("id%d", i)
+		data, marshalErr := json.Marshal(URLRecord{
+			UUID:        id,
+			ShortURL:    id,
+			OriginalURL: fmt.Sprintf("https://example.com/%d", i),
+			UserID:      "user1",
+		})
+		assert.NoError(t, marshalErr)
+		_, _ = writer.Write(append(data, '\n'))
+	}
+	assert.NoError(t, writer.Flush())
+	assert.NoError(t, file.Close())
+
+	repo, err := NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err, "Failed to create file repository")
+
+	ids := make([]string, 0, 10)
+	for i := 0; i < 10; i++ {
+		ids = append(ids, fmt.Sprintf("id%d", i*1000))
+	}
+
+	// BatchDelete не должен переписывать файл целиком
+	start := time.Now()
+	err = repo.BatchDelete("user1", ids)
+	elapsed := time.Since(start)
+	assert.NoError(t, err)
+	assert.Less(t, elapsed, 100*time.Millisecond, "BatchDelete should not rewrite the whole file")
+	assert.Equal(t, total+len(ids), countLines(t, tempFile), "Only tombstones should be appended")
+
+	// Удаление видно сразу
+	u, exists, _ := repo.Get("id0")
+	assert.True(t, exists)
+	assert.True(t, u.DeletedFlag, "Deletion should be visible immediately")
+	u, exists, _ = repo.Get("id1")
+	assert.True(t, exists)
+	assert.False(t, u.DeletedFlag, "Other URLs should stay intact")
+
+	// Чужие URL не удаляются
+	assert.NoError(t, repo.BatchDelete("user2", []string{"id1"}))
+	u, _, _ = repo.Get("id1")
+	assert.False(t, u.DeletedFlag, "Foreign user must not delete URL")
+
+	// Удаления переживают перезапуск до компакции
+	reopened, err := NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err, "Failed to reopen file repository")
+	for _, id := range ids {
+		u, exists, _ = reopened.Get(id)
+		assert.True(t, exists)
+		assert.True(t, u.DeletedFlag, "Deletion of %s should persist across reload", id)
+	}
+	urlCount, _, err := reopened.GetStats()
+	assert.NoError(t, err)
+	assert.Equal(t, total-len(ids), urlCount, "Tombstones should not be counted as URLs")
+
+	// Компакция отбрасывает надгробия и сохраняет удаления в самих записях
+	assert.NoError(t, reopened.Compact())
+	assert.Equal(t, total, countLines(t, tempFile), "Compaction should drop tombstones")
+	compacted, err := NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+	u, _, _ = compacted.Get(ids[0])
+	assert.True(t, u.DeletedFlag, "Deletion should survive compaction")
+}
+
+func TestFileRepository_RunCompaction(t *testing.T) {
+	t.Parallel()
+	tempFile := filepath.Join(t.TempDir(), "storage_compaction.json")
+	repo, err := NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err, "Failed to create file repository")
+
+	const total = 2 * compactMinTombstones
+	items := make([]models.BatchItem, 0, total)
+	for i := 0; i < total; i++ {
+		items = append(items, models.BatchItem{ShortID: fmt.Sprintf("id%d", i), OriginalURL: fmt.Sprintf("https://example.com/%d", i)})
+	}
+	assert.NoError(t, repo.BatchSave(items, "user1"))
+
+	// Ниже порога надгробия остаются в файле
+	assert.NoError(t, repo.BatchDelete("user1", []string{"id0"}))
+	assert.NoError(t, repo.compactIfNeeded())
+	assert.Equal(t, total+1, countLines(t, tempFile), "Compaction must wait for the threshold")
+
+	// После порога файл переписывается в фоне без закрытия хранилища
+	ids := make([]string, 0, compactMinTombstones)
+	for i := 1; i <= compactMinTombstones; i++ {
+		ids = append(ids, fmt.Sprintf("id%d", i))
+	}
+	assert.NoError(t, repo.BatchDelete("user1", ids))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		repo.RunCompaction(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	assert.Eventually(t, func() bool {
+		return countLines(t, tempFile) == total
+	}, time.Second, 10*time.Millisecond, "Tombstones should be compacted in the background")
+
+	reopened, err := NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err, "Failed to reopen file repository")
+	u, exists, _ := reopened.Get("id1")
+	assert.True(t, exists)
+	assert.True(t, u.DeletedFlag, "Compaction must keep deletions")
+}
+
+// replaceFile подменяет файл хранилища новым файлом с указанными записями, как при восстановлении из бэкапа
+func replaceFile(t *testing.T, path string, records ...URLRecord) {
+	tmp := path + ".restore"
+	var data []byte
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		assert.NoError(t, err)
+		data = append(data, line...)
+		data = append(data, '\n')
+	}
+	assert.NoError(t, os.WriteFile(tmp, data, 0644))
+	assert.NoError(t, os.Rename(tmp, path))
+}
+
+func TestFileRepository_DeleteByUserAndHost(t *testing.T) {
+	t.Parallel()
+	tempFile := filepath.Join(t.TempDir(), "storage.json")
+	repo, err := NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+
+	_, err = repo.Save("id1", "https://old.example.com/a", "user1")
+	assert.NoError(t, err)
+	_, err = repo.Save("id2", "https://Old.Example.com/b", "user1")
+	assert.NoError(t, err)
+	_, err = repo.Save("id3", "https://new.example.com/c", "user1")
+	assert.NoError(t, err)
+	_, err = repo.Save("id4", "https://old.example.com/d", "user2")
+	assert.NoError(t, err)
+
+	deleted, err := repo.DeleteByUserAndHost("user1", "old.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+
+	deleted, err = repo.DeleteByUserAndHost("user1", "old.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, deleted, "Already deleted URLs should not be counted")
+	assert.NoError(t, repo.Close())
+
+	// Удаление сохраняется в файле
+	repo, err = NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+	for id, wantDeleted := range map[string]bool{"id1": true, "id2": true, "id3": false, "id4": false} {
+		u, exists, _ := repo.Get(id)
+		assert.True(t, exists)
+		assert.Equal(t, wantDeleted, u.DeletedFlag, id)
+	}
+	assert.NoError(t, repo.Close())
+}
+
+func TestFileRepository_ReassignUser(t *testing.T) {
+	t.Parallel()
+	tempFile := filepath.Join(t.TempDir(), "storage.json")
+	repo, err := NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+
+	_, err = repo.Save("id1", "https://example.com/1", "old")
+	assert.NoError(t, err)
+	_, err = repo.Save("id2", "https://example.com/2", "old")
+	assert.NoError(t, err)
+	_, err = repo.Save("id3", "https://example.com/3", "other")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.BatchDelete("old", []string{"id2"}))
+	before, err := os.ReadFile(tempFile)
+	assert.NoError(t, err)
+
+	moved, err := repo.ReassignUser("old", "new")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, moved)
+
+	// Передача дописывается в файл, а не переписывает его
+	after, err := os.ReadFile(tempFile)
+	assert.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(after, before))
+	assert.Equal(t, 2, bytes.Count(after[len(before):], []byte(`"transfer":true`)))
+
+	moved, err = repo.ReassignUser("missing", "new")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, moved)
+	assert.NoError(t, repo.Close())
+
+	// Передача и удаление сохраняются в файле
+	repo, err = NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+	urls, err := repo.GetURLsByUserID("old")
+	assert.NoError(t, err)
+	assert.Empty(t, urls)
+	urls, err = repo.GetURLsByUserID("new")
+	assert.NoError(t, err)
+	assert.Len(t, urls, 2)
+	for _, u := range urls {
+		assert.Equal(t, u.ShortID == "id2", u.DeletedFlag, u.ShortID)
+	}
+
+	report, err := repo.Verify(false)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Violations)
+
+	// Новый владелец может удалять переданные URL, и надгробие после передачи применяется при загрузке
+	assert.NoError(t, repo.BatchDelete("new", []string{"id1"}))
+	u, _, _ := repo.Get("id1")
+	assert.True(t, u.DeletedFlag)
+	assert.Equal(t, "new", u.UserID)
+	assert.NoError(t, repo.Close())
+
+	repo, err = NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+	u, _, _ = repo.Get("id1")
+	assert.True(t, u.DeletedFlag)
+
+	// Компакция переносит передачи в сами записи
+	assert.NoError(t, repo.Compact())
+	data, err := os.ReadFile(tempFile)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), `"transfer"`)
+	assert.NoError(t, repo.Close())
+	repo, err = NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+	urls, err = repo.GetURLsByUserID("new")
+	assert.NoError(t, err)
+	assert.Len(t, urls, 2)
+	assert.NoError(t, repo.Close())
+}
+
+func TestFileRepository_ClaimURL(t *testing.T) {
+	t.Parallel()
+	tempFile := filepath.Join(t.TempDir(), "storage.json")
+	repo, err := NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+
+	_, err = repo.SaveURL(models.URL{ShortID: "id1", OriginalURL: "https://example.com/1", UserID: "anon", ClaimTokenHash: "hash"})
+	assert.NoError(t, err)
+	_, err = repo.SaveURL(models.URL{ShortID: "id2", OriginalURL: "https://example.com/2", UserID: "anon", ClaimTokenHash: "hash2"})
+	assert.NoError(t, err)
+	assert.NoError(t, repo.Close())
+
+	// Хеш токена переживает перезагрузку
+	repo, err = NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+	assert.ErrorIs(t, repo.ClaimURL("id1", "hash2", "new"), ErrClaimRejected)
+	lines := countLines(t, tempFile)
+	assert.NoError(t, repo.ClaimURL("id1", "hash", "new"))
+	assert.ErrorIs(t, repo.ClaimURL("id1", "hash", "third"), ErrClaimRejected, "Token must be single-use")
+	assert.Equal(t, lines+1, countLines(t, tempFile), "Claim should append a transfer record instead of rewriting the file")
+
+	// Передача видна при загрузке ещё до компакции
+	reopened, err := NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+	u, ok, err := reopened.Get("id1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "new", u.UserID)
+	assert.ErrorIs(t, reopened.ClaimURL("id1", "hash", "third"), ErrClaimRejected)
+	assert.NoError(t, repo.BatchDelete("anon", []string{"id2"}))
+	assert.ErrorIs(t, repo.ClaimURL("id2", "hash2", "new"), ErrClaimRejected, "Deleted URL cannot be claimed")
+	assert.NoError(t, repo.Close())
+
+	// Передача и погашенный токен сохраняются в файле
+	repo, err = NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+	urls, err := repo.GetURLsByUserID("new")
+	assert.NoError(t, err)
+	assert.Len(t, urls, 1)
+	assert.ErrorIs(t, repo.ClaimURL("id1", "hash", "third"), ErrClaimRejected)
+	data, err := os.ReadFile(tempFile)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), `"claim_token_hash":"hash"`)
+	assert.NoError(t, repo.Close())
+}
+
+func TestFileRepository_SetNSFW(t *testing.T) {
+	t.Parallel()
+	tempFile := filepath.Join(t.TempDir(), "storage.json")
+	repo, err := NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+
+	_, err = repo.Save("id1", "https://example.com/1", "user1")
+	assert.NoError(t, err)
+	_, err = repo.Save("id2", "https://example.com/2", "user1")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.SetNSFW("id1", true))
+	assert.ErrorIs(t, repo.SetNSFW("missing", true), ErrURLNotFound)
+	assert.NoError(t, repo.Close())
+
+	// Пометка сохраняется в файле и переживает перезагрузку
+	repo, err = NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+	u, ok, _ := repo.Get("id1")
+	assert.True(t, ok)
+	assert.True(t, u.NSFW)
+	urls, err := repo.BatchGet([]string{"id1", "id2"})
+	assert.NoError(t, err)
+	assert.True(t, urls["id1"].NSFW)
+	assert.False(t, urls["id2"].NSFW)
+
+	lines := countLines(t, tempFile)
+	assert.NoError(t, repo.SetNSFW("id1", false))
+	u, _, _ = repo.Get("id1")
+	assert.False(t, u.NSFW)
+	assert.Equal(t, lines+1, countLines(t, tempFile), "Moderation should append a record instead of rewriting the file")
+	report, err := repo.Verify(false)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Violations)
+
+	// Снятие пометки видно при загрузке ещё до компакции
+	reopened, err := NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+	u, _, _ = reopened.Get("id1")
+	assert.False(t, u.NSFW)
+	assert.NoError(t, repo.Close())
+
+	// После компакции пометка перенесена в саму запись
+	repo, err = NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+	u, _, _ = repo.Get("id1")
+	assert.False(t, u.NSFW)
+	assert.NoError(t, repo.Close())
+}
+
+func TestFileRepository_GetUserIDsByURL(t *testing.T) {
+	t.Parallel()
+	tempFile := filepath.Join(t.TempDir(), "storage.json")
+	repo, err := NewFileRepository(tempFile, zap.NewNop(), DisableReverseIndex())
+	assert.NoError(t, err)
+
+	_, err = repo.Save("id1", "https://example.com", "user2")
+	assert.NoError(t, err)
+	_, err = repo.Save("id2", "https://example.com", "user1")
+	assert.NoError(t, err)
+	_, err = repo.Save("id3", "https://example.com", "user2")
+	assert.NoError(t, err)
+	_, err = repo.Save("id4", "https://other.com", "user3")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.BatchDelete("user1", []string{"id2"}))
+
+	userIDs, err := repo.GetUserIDsByURL("https://example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"user1", "user2"}, userIDs)
+	userIDs, err = repo.GetUserIDsByURL("https://missing.com")
+	assert.NoError(t, err)
+	assert.Empty(t, userIDs)
+	assert.NoError(t, repo.Close())
+}
+
+func TestFileRepository_TopUsers(t *testing.T) {
+	t.Parallel()
+	tempFile := filepath.Join(t.TempDir(), "storage.json")
+	repo, err := NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+
+	assert.NoError(t, repo.BatchSave([]models.BatchItem{{ShortID: "id1", OriginalURL: "https://a.example.com"}, {ShortID: "id2", OriginalURL: "https://b.example.com"}}, "user2"))
+	assert.NoError(t, repo.BatchSave([]models.BatchItem{{ShortID: "id3", OriginalURL: "https://c.example.com"}, {ShortID: "id4", OriginalURL: "https://d.example.com"}, {ShortID: "id5", OriginalURL: "https://e.example.com"}}, "user1"))
+	_, err = repo.Save("id6", "https://f.example.com", "user3")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.BatchDelete("user1", []string{"id3"}))
+	assert.NoError(t, repo.Close())
+
+	// Счётчики восстанавливаются из файла вместе с удалениями
+	repo, err = NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+	users, err := repo.TopUsers(2)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.UserURLCount{
+		{UserID: "user1", URLs: 2, Deleted: 1},
+		{UserID: "user2", URLs: 2},
+	}, users)
+	assert.NoError(t, repo.Close())
+}
+
+func TestFileRepository_DisableReverseIndex(t *testing.T) {
+	t.Parallel()
+	tempFile := filepath.Join(t.TempDir(), "storage.json")
+
+	repo, err := NewFileRepository(tempFile, zap.NewNop(), DisableReverseIndex())
+	assert.NoError(t, err)
+	assert.Nil(t, repo.urlToShortID, "Reverse index should not be built")
+
+	// Без индекса повторный URL сохраняется под новым ID
+	id, err := repo.Save("id1", "https://example.com", "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, "id1", id)
+	id, err = repo.Save("id2", "https://example.com", "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, "id2", id)
+	assert.NoError(t, repo.BatchSave([]models.BatchItem{{ShortID: "id3", OriginalURL: "https://example.com"}}, "user1"))
+
+	for _, id := range []string{"id1", "id2", "id3"} {
+		u, exists, _ := repo.Get(id)
+		assert.True(t, exists, "URL %s should exist", id)
+		assert.Equal(t, "https://example.com", u.OriginalURL)
+	}
+
+	// Занятость ID по-прежнему проверяется
+	assert.ErrorIs(t, repo.BatchSave([]models.BatchItem{{ShortID: "id1", OriginalURL: "https://other.com"}}, "user1"), ErrIDExists)
+
+	// Записи переживают перезагрузку файла
+	reopened, err := NewFileRepository(tempFile, zap.NewNop(), DisableReverseIndex())
+	assert.NoError(t, err)
+	urls, err := reopened.GetURLsByUserID("user1")
+	assert.NoError(t, err)
+	assert.Len(t, urls, 3)
+	reopened.Clear()
+	assert.Nil(t, reopened.urlToShortID, "Clear should not rebuild the reverse index")
+}
+
+func TestFileRepository_DisableReverseIndexMemory(t *testing.T) {
+	tempFile := filepath.Join(t.TempDir(), "storage.json")
+	records := make([]URLRecord, 0, 20000)
+	for i := 0; i < cap(records); i++ {
+		id := fmt.Sprintf("id%d", i)
+		records = append(records, URLRecord{UUID: id, ShortURL: id, OriginalURL: fmt.Sprintf("https://example.com/some/long/path/%d", i), UserID: "user1"})
+	}
+	replaceFile(t, tempFile, records...)
+
+	// loadAlloc возвращает объём памяти, выделенной при загрузке файла
+	loadAlloc := func(opts ...Option) uint64 {
+		var before, after runtime.MemStats
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+		repo, err := NewFileRepository(tempFile, zap.NewNop(), opts...)
+		runtime.ReadMemStats(&after)
+		assert.NoError(t, err)
+		assert.Len(t, repo.store, len(records))
+		return after.TotalAlloc - before.TotalAlloc
+	}
+
+	withIndex := loadAlloc()
+	withoutIndex := loadAlloc(DisableReverseIndex())
+	t.Logf("load allocations: with index %d bytes, without index %d bytes", withIndex, withoutIndex)
+	assert.Less(t, withoutIndex, withIndex, "Disabling the reverse index should reduce memory usage")
+}
+
+func TestFileRepository_DetectsReplacedFile(t *testing.T) {
+	t.Parallel()
+	tempDir := t.TempDir()
+	tempFile := filepath.Join(tempDir, "storage_watch.json")
+
+	repo, err := NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+	_, err = repo.Save("old", "https://old.example.com", "user1")
+	assert.NoError(t, err)
+
+	// Собственные записи не считаются внешним изменением
+	repo.checkFile(false)
+	assert.True(t, repo.Healthy(), "Own writes must not mark repository stale")
+
+	replaceFile(t, tempFile, URLRecord{UUID: "restored", ShortURL: "restored", OriginalURL: "https://restored.example.com", UserID: "user1"})
+
+	// Без перезагрузки репозиторий помечается устаревшим и продолжает отдавать старые карты
+	repo.checkFile(false)
+	assert.False(t, repo.Healthy(), "Replaced file should mark repository stale")
+	_, exists, _ := repo.Get("restored")
+	assert.False(t, exists, "Data should not be reloaded without reload flag")
+
+	// С перезагрузкой данные перечитываются из нового файла
+	repo.checkFile(true)
+	assert.True(t, repo.Healthy(), "Repository should be healthy after reload")
+	u, exists, _ := repo.Get("restored")
+	assert.True(t, exists, "Restored URL should be visible after reload")
+	assert.Equal(t, "https://restored.example.com", u.OriginalURL)
+	_, exists, _ = repo.Get("old")
+	assert.False(t, exists, "URL missing from restored file should be gone")
+}
+
+func TestFileRepository_DetectsTruncatedFile(t *testing.T) {
+	t.Parallel()
+	tempDir := t.TempDir()
+	tempFile := filepath.Join(tempDir, "storage_truncate.json")
+
+	repo, err := NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+	_, err = repo.Save("id1", "https://example1.com", "user1")
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.Truncate(tempFile, 0))
+	repo.checkFile(false)
+	assert.False(t, repo.Healthy(), "Truncated file should mark repository stale")
+}
+
+func TestFileRepository_WatchReloadsWithConcurrentSaves(t *testing.T) {
+	tempDir := t.TempDir()
+	tempFile := filepath.Join(tempDir, "storage_reload.json")
+
+	repo, err := NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+
+	// Наблюдатель должен завершиться до удаления временного каталога: перезагрузка может создать файл заново
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		repo.Watch(ctx, 5*time.Millisecond, true)
+	}()
+	defer func() {
+		cancel()
+		<-stopped
+	}()
+
+	replaceFile(t, tempFile, URLRecord{UUID: "restored", ShortURL: "restored", OriginalURL: "https://restored.example.com", UserID: "user1"})
+
+	// Сохранения во время перезагрузки сериализуются с ней и не теряются
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("new%d", i)
+			_, saveErr := repo.Save(id, fmt.Sprintf("https://new.example.com/%d", i), "user1")
+			assert.NoError(t, saveErr)
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Eventually(t, func() bool {
+		_, exists, _ := repo.Get("restored")
+		return exists && repo.Healthy()
+	}, time.Second, 5*time.Millisecond, "Watcher should reload replaced file")
+
+	for i := 0; i < 20; i++ {
+		_, exists, _ := repo.Get(fmt.Sprintf("new%d", i))
+		assert.True(t, exists, "URL saved during reload should not be lost")
+	}
+}
+
 func TestFileRepository_Close(t *testing.T) {
+	t.Parallel()
 	tempDir := t.TempDir()
 	tempFile := filepath.Join(tempDir, "storage_close.json")
 
@@ -177,7 +837,7 @@ func TestFileRepository_Close(t *testing.T) {
 	assert.NoError(t, err, "Close should not return error")
 
 	// Проверяем, что данные все еще доступны после Close
-	url, exists := repo.Get("id1")
+	url, exists, _ := repo.Get("id1")
 	assert.True(t, exists, "URL should still exist after Close")
 	assert.Equal(t, "https://example1.com", url.OriginalURL)
 
@@ -185,3 +845,465 @@ func TestFileRepository_Close(t *testing.T) {
 	_, err = os.Stat(tempFile)
 	assert.NoError(t, err, "File should still exist after Close")
 }
+
+func TestFileRepository_Verify(t *testing.T) {
+	t.Parallel()
+	tempFile := filepath.Join(t.TempDir(), "test.json")
+	fixture := strings.Join([]string{
+		`{"uuid":"1","short_url":"aaa","original_url":"https://a.example","user_id":"u1","is_deleted":false}`,
+		`{"uuid":"2","short_url":`,
+		`{"uuid":"3","short_url":"","original_url":"https://empty.example","user_id":"u1","is_deleted":false}`,
+		`{"uuid":"4","short_url":"aaa","original_url":"https://a.example","user_id":"u1","is_deleted":false}`,
+		`{"uuid":"5","short_url":"bbb","original_url":"https://b.example","user_id":"u2","is_deleted":false}`,
+		`{"uuid":"6","short_url":"bbb","original_url":"https://other.example","user_id":"u2","is_deleted":false}`,
+		`{"uuid":"7","short_url":"ccc","original_url":"https://a.example","user_id":"u3","is_deleted":false}`,
+		`{"uuid":"","short_url":"zzz","original_url":"","user_id":"u1","is_deleted":false,"tombstone":true}`,
+		`{"uuid":"","short_url":"ccc","original_url":"","user_id":"u1","is_deleted":false,"tombstone":true}`,
+		`{"uuid":"","short_url":"ccc","original_url":"","user_id":"u3","is_deleted":false,"tombstone":true}`,
+	}, "\n") + "\n"
+	assert.NoError(t, os.WriteFile(tempFile, []byte(fixture), 0644))
+
+	repo, err := NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+
+	// Запись, добавленная в файл в обход хранилища, расходится с данными в памяти
+	file, err := os.OpenFile(tempFile, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = file.WriteString(`{"uuid":"8","short_url":"ddd","original_url":"https://d.example","user_id":"u4","is_deleted":false}` + "\n")
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+	corrupted, err := os.ReadFile(tempFile)
+	assert.NoError(t, err)
+
+	kinds := func(report VerifyReport) []string {
+		var result []string
+		for _, v := range report.Violations {
+			result = append(result, v.Kind)
+		}
+		return result
+	}
+
+	report, err := repo.Verify(false)
+	assert.NoError(t, err)
+	assert.Equal(t, "file", report.Backend)
+	assert.Equal(t, 7, report.Records)
+	assert.ElementsMatch(t, []string{
+		ViolationInvalidLine,
+		ViolationEmptyShortID,
+		ViolationDuplicateShortID,
+		ViolationConflictingShortID,
+		ViolationDuplicateOriginalURL,
+		ViolationOrphanTombstone,
+		ViolationOrphanTombstone,
+		ViolationIndexMismatch,
+	}, kinds(report))
+	for _, v := range report.Violations {
+		assert.False(t, v.Repaired)
+		if v.Kind == ViolationIndexMismatch {
+			assert.Equal(t, "ddd", v.ShortID)
+		}
+		if v.Kind == ViolationInvalidLine {
+			assert.Equal(t, 2, v.Line)
+		}
+	}
+	assert.True(t, report.Failed())
+
+	// Проверка без исправления не трогает файл
+	unchanged, err := os.ReadFile(tempFile)
+	assert.NoError(t, err)
+	assert.Equal(t, string(corrupted), string(unchanged))
+
+	report, err = repo.Verify(true)
+	assert.NoError(t, err)
+	for _, v := range report.Violations {
+		assert.Equal(t, v.Repairable, v.Repaired, v.Kind)
+	}
+	assert.True(t, report.Failed(), "Conflicting records must be left for manual review")
+
+	// Остаются только нарушения, которые нельзя исправить без потери данных
+	report, err = repo.Verify(false)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{ViolationConflictingShortID, ViolationDuplicateOriginalURL}, kinds(report))
+	assert.Equal(t, 5, countLines(t, tempFile))
+
+	url, exists, _ := repo.Get("ddd")
+	assert.True(t, exists)
+	assert.Equal(t, "https://d.example", url.OriginalURL)
+	url, exists, _ = repo.Get("ccc")
+	assert.True(t, exists)
+	assert.True(t, url.DeletedFlag)
+}
+
+func TestFileRepository_LoadDuplicates(t *testing.T) {
+	t.Parallel()
+	tempFile := filepath.Join(t.TempDir(), "test.json")
+	fixture := strings.Join([]string{
+		`{"uuid":"1","short_url":"aaa","original_url":"https://a.example","user_id":"u1","is_deleted":false}`,
+		`{"uuid":"2","short_url":"aaa","original_url":"https://other.example","user_id":"u2","is_deleted":true}`,
+		`{"uuid":"3","short_url":"bbb","original_url":"https://a.example","user_id":"u3","is_deleted":false}`,
+	}, "\n") + "\n"
+	assert.NoError(t, os.WriteFile(tempFile, []byte(fixture), 0644))
+
+	assertState := func(t *testing.T, repo *FileRepository) {
+		// Повтор short_id пропускается целиком: URL, владелец и флаг удаления берутся из первой записи
+		url, exists, _ := repo.Get("aaa")
+		assert.True(t, exists)
+		assert.Equal(t, "https://a.example", url.OriginalURL)
+		assert.Equal(t, "u1", url.UserID)
+		assert.False(t, url.DeletedFlag)
+		urls, err := repo.GetURLsByUserID("u2")
+		assert.NoError(t, err)
+		assert.Empty(t, urls)
+
+		// Повтор original_url остаётся доступным по своему ID, но обратный индекс указывает на первый
+		url, exists, _ = repo.Get("bbb")
+		assert.True(t, exists)
+		assert.Equal(t, "https://a.example", url.OriginalURL)
+		id, err := repo.Save("ccc", "https://a.example", "u4")
+		assert.ErrorIs(t, err, ErrURLExists)
+		assert.Equal(t, "aaa", id)
+	}
+
+	repo, err := NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+	assertState(t, repo)
+	assert.Equal(t, 3, countLines(t, tempFile), "File must not be modified without RepairOnLoad")
+
+	repaired, err := NewFileRepository(tempFile, zap.NewNop(), RepairOnLoad())
+	assert.NoError(t, err)
+	assertState(t, repaired)
+	assert.Equal(t, 2, countLines(t, tempFile))
+	assert.Equal(t, 0, repaired.duplicates)
+}
+
+// flakyWriter возвращает заданные ошибки при первых записях, успевая записать половину данных
+type flakyWriter struct {
+	errs  []error
+	calls int
+	buf   bytes.Buffer
+}
+
+func (w *flakyWriter) Write(p []byte) (int, error) {
+	w.calls++
+	if len(w.errs) > 0 {
+		err := w.errs[0]
+		w.errs = w.errs[1:]
+		n, _ := w.buf.Write(p[:len(p)/2])
+		return n, err
+	}
+	return w.buf.Write(p)
+}
+
+func (w *flakyWriter) Seek(offset int64, whence int) (int64, error) {
+	return int64(w.buf.Len()), nil
+}
+
+func (w *flakyWriter) Truncate(size int64) error {
+	w.buf.Truncate(int(size))
+	return nil
+}
+
+func TestFileRepository_WriteRetry(t *testing.T) {
+	t.Parallel()
+	repo := newTestFileRepo(t, WithWriteRetry(3, time.Millisecond))
+	var sleeps []time.Duration
+	repo.writeRetry.sleep = func(d time.Duration) {
+		// Пауза проходит без блокировки хранилища
+		assert.True(t, repo.mutex.TryLock())
+		repo.mutex.Unlock()
+		sleeps = append(sleeps, d)
+	}
+	prefix := `{"short_url":"id0"}` + "\n"
+	data := []byte(`{"short_url":"id1"}` + "\n")
+	writeOp := func(w *flakyWriter) func() error {
+		return func() error {
+			repo.mutex.Lock()
+			defer repo.mutex.Unlock()
+			return repo.write(w, data)
+		}
+	}
+
+	// Временная ошибка: половина строки обрезается, повтор дописывает строку целиком
+	w := &flakyWriter{errs: []error{syscall.ENOSPC}}
+	w.buf.WriteString(prefix)
+	assert.NoError(t, repo.retryWrite(writeOp(w)))
+	assert.Equal(t, 2, w.calls)
+	assert.Equal(t, prefix+string(data), w.buf.String())
+	assert.Equal(t, []time.Duration{time.Millisecond}, sleeps)
+
+	// Фатальная ошибка не повторяется
+	sleeps = nil
+	w = &flakyWriter{errs: []error{&os.PathError{Op: "write", Path: "storage.json", Err: syscall.EACCES}}}
+	err := repo.retryWrite(writeOp(w))
+	assert.ErrorIs(t, err, syscall.EACCES)
+	assert.NotErrorIs(t, err, ErrWriteRetriesExhausted)
+	assert.Equal(t, 1, w.calls)
+	assert.Empty(t, w.buf.String())
+	assert.Empty(t, sleeps)
+
+	// После исчерпания попыток возвращается понятная ошибка с исходной причиной, а файл остаётся прежним
+	w = &flakyWriter{errs: []error{syscall.EINTR, syscall.ENOSPC, syscall.ENOSPC, syscall.ENOSPC}}
+	w.buf.WriteString(prefix)
+	err = repo.retryWrite(writeOp(w))
+	assert.ErrorIs(t, err, ErrWriteRetriesExhausted)
+	assert.ErrorIs(t, err, syscall.ENOSPC)
+	assert.Equal(t, 3, w.calls)
+	assert.Equal(t, prefix, w.buf.String())
+	assert.Equal(t, []time.Duration{time.Millisecond, 2 * time.Millisecond}, sleeps)
+}
+
+func TestFileRepository_SaveUser(t *testing.T) {
+	t.Parallel()
+	tempFile := filepath.Join(t.TempDir(), "storage.json")
+	repo, err := NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+
+	_, err = repo.Save("id1", "https://example.com", "user1")
+	assert.NoError(t, err)
+	firstSeen := time.Unix(1700000000, 0)
+	assert.NoError(t, repo.SaveUser("user1", firstSeen))
+	assert.NoError(t, repo.SaveUser("user2", firstSeen))
+	assert.NoError(t, repo.SaveUser("user2", firstSeen.Add(time.Hour)))
+	assert.NoError(t, repo.Close())
+
+	// Пользователи хранятся в отдельном файле и переживают перезагрузку, не мешая проверке хранилища
+	repo, err = NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+	assert.Equal(t, firstSeen, repo.users["user2"])
+	_, userCount, err := repo.GetStats()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, userCount)
+	report, err := repo.Verify(false)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Violations)
+
+	repo.Clear()
+	_, err = os.Stat(tempFile + ".users")
+	assert.True(t, os.IsNotExist(err))
+	_, userCount, err = repo.GetStats()
+	assert.NoError(t, err)
+	assert.Zero(t, userCount)
+}
+
+func TestFileRepository_UserStatsClock(t *testing.T) {
+	t.Parallel()
+	repo := newTestFileRepo(t)
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Время создания и окно статистики задаёт вызывающий, а не часы хранилища
+	assert.NoError(t, repo.BatchSave([]models.BatchItem{{ShortID: "id1", OriginalURL: "https://example.com/1", CreatedAt: created}}, "user1"))
+	assert.NoError(t, repo.ReserveIDs([]string{"r1"}, "user1", created))
+	urls, err := repo.GetURLsByUserID("user1")
+	assert.NoError(t, err)
+	if assert.Len(t, urls, 1) {
+		assert.True(t, created.Equal(urls[0].CreatedAt))
+	}
+	data, err := os.ReadFile(repo.filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(data), fmt.Sprintf(`"created_at":%d`, created.Unix())))
+
+	stats, err := repo.GetUserStats("user1", created.Add(24*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats.CreatedLast30d)
+	stats, err = repo.GetUserStats("user1", created.Add(userStatsWindow+time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stats.CreatedLast30d)
+}
+
+func TestFileRepository_ReserveIDs(t *testing.T) {
+	t.Parallel()
+	tempFile := filepath.Join(t.TempDir(), "storage.json")
+	repo, err := NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+
+	_, err = repo.Save("taken", "https://example.com/taken", "user1")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, repo.ReserveIDs([]string{"r1", "taken"}, "printer", time.Now()), ErrIDExists)
+	assert.NoError(t, repo.ReserveIDs([]string{"r1", "r2"}, "printer", time.Now()))
+	assert.NoError(t, repo.Close())
+
+	// Резерв сохраняется в файле и переживает перезагрузку
+	repo, err = NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+	u, ok, _ := repo.Get("r1")
+	assert.True(t, ok)
+	assert.True(t, u.Reserved)
+	urlCount, userCount, err := repo.GetStats()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, urlCount)
+	assert.Equal(t, 1, userCount)
+	urls, err := repo.GetURLsByUserID("printer")
+	assert.NoError(t, err)
+	assert.Empty(t, urls)
+	count, err := repo.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+	report, err := repo.Verify(false)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Violations)
+
+	assert.ErrorIs(t, repo.ActivateReserved("r1", "stranger", "https://example.com/r1"), ErrNotReserved)
+	assert.ErrorIs(t, repo.ActivateReserved("r1", "printer", "https://example.com/taken"), ErrURLExists)
+	lines := countLines(t, tempFile)
+	assert.NoError(t, repo.ActivateReserved("r1", "printer", "https://example.com/r1"))
+	assert.ErrorIs(t, repo.ActivateReserved("r1", "printer", "https://example.com/again"), ErrNotReserved)
+	assert.Equal(t, lines+1, countLines(t, tempFile), "Activation should append a record instead of rewriting the file")
+	report, err = repo.Verify(false)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Violations)
+
+	// Активация видна при загрузке ещё до компакции
+	reopened, err := NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+	u, ok, _ = reopened.Get("r1")
+	assert.True(t, ok)
+	assert.False(t, u.Reserved)
+	assert.Equal(t, "https://example.com/r1", u.OriginalURL)
+	urls, err = reopened.GetURLsByUserID("printer")
+	assert.NoError(t, err)
+	assert.Len(t, urls, 1)
+	urlCount, _, err = reopened.GetStats()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, urlCount)
+	assert.NoError(t, repo.Close())
+
+	repo, err = NewFileRepository(tempFile, zap.NewNop())
+	assert.NoError(t, err)
+	u, ok, _ = repo.Get("r1")
+	assert.True(t, ok)
+	assert.False(t, u.Reserved)
+	assert.Equal(t, "https://example.com/r1", u.OriginalURL)
+	urls, err = repo.GetURLsByUserID("printer")
+	assert.NoError(t, err)
+	assert.Len(t, urls, 1)
+	_, err = repo.Save("r3", "https://example.com/r1", "user1")
+	assert.ErrorIs(t, err, ErrURLExists)
+	assert.NoError(t, repo.Close())
+}
+
+func TestFileRepository_DescriptionPersists(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "storage.json")
+	repo, err := NewFileRepository(path, zap.NewNop())
+	assert.NoError(t, err)
+	_, err = repo.SaveURL(models.URL{ShortID: "id1", OriginalURL: "https://example.com", UserID: "user1", Description: "Landing page"})
+	assert.NoError(t, err)
+	assert.NoError(t, repo.Close())
+
+	// Описание переживает перезапуск и возвращается в списке ссылок пользователя
+	reopened, err := NewFileRepository(path, zap.NewNop())
+	assert.NoError(t, err)
+	urls, err := reopened.GetURLsByUserID("user1")
+	assert.NoError(t, err)
+	assert.Len(t, urls, 1)
+	assert.Equal(t, "Landing page", urls[0].Description)
+	u, ok, err := reopened.Get("id1")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "Landing page", u.Description)
+}
+
+func TestFileRepository_RemovesStaleTempFiles(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "temp_123.json")
+	fresh := filepath.Join(dir, "temp_456.json")
+	other := filepath.Join(dir, "backup.json")
+	old := time.Now().Add(-2 * DefaultTempFileMaxAge)
+	for _, path := range []string{stale, fresh, other} {
+		assert.NoError(t, os.WriteFile(path, []byte("{}\n"), 0644))
+	}
+	assert.NoError(t, os.Chtimes(stale, old, old))
+	assert.NoError(t, os.Chtimes(other, old, old))
+
+	repo, err := NewFileRepository(filepath.Join(dir, "storage.json"), zap.NewNop())
+	assert.NoError(t, err)
+	assert.NoFileExists(t, stale)
+	assert.FileExists(t, fresh, "Recent temp file may belong to another process")
+	assert.FileExists(t, other)
+
+	// Перезапись файла не оставляет временных файлов
+	_, err = repo.Save("abc", "https://example.com", "user1")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.BatchDelete("user1", []string{"abc"}))
+	assert.NoError(t, repo.Compact())
+	left, err := filepath.Glob(filepath.Join(dir, "temp_*.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{fresh}, left)
+
+	_, err = NewFileRepository(filepath.Join(dir, "storage.json"), zap.NewNop(), WithTempFileMaxAge(time.Nanosecond))
+	assert.NoError(t, err)
+	assert.NoFileExists(t, fresh)
+}
+
+func TestFileRepository_SelfHealRemovedDir(t *testing.T) {
+	t.Parallel()
+	dir := filepath.Join(t.TempDir(), "data")
+	repo, err := NewFileRepository(filepath.Join(dir, "storage.json"), zap.NewNop())
+	assert.NoError(t, err)
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	_, err = repo.SaveURL(models.URL{ShortID: "aaa", OriginalURL: "https://a.example", UserID: "user1",
+		Tags: []string{"promo"}, Description: "Landing page", CreatedAt: created})
+	assert.NoError(t, err)
+	assert.NoError(t, repo.SetNSFW("aaa", true))
+	_, err = repo.Save("ccc", "https://c.example", "user2")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.BatchDelete("user2", []string{"ccc"}))
+	assert.NoError(t, repo.SaveUser("user1", time.Now()))
+
+	assert.NoError(t, os.RemoveAll(dir))
+	_, err = repo.Save("bbb", "https://b.example", "user1")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.SaveUser("user2", time.Now()))
+	assert.FileExists(t, filepath.Join(dir, "storage.json"))
+	assert.Equal(t, 3, countLines(t, filepath.Join(dir, "storage.json")))
+	assert.False(t, repo.stale.Load())
+
+	// Ссылки, сделанные до удаления каталога, восстановлены из памяти вместе с владельцем и удалением
+	u, exists, err := repo.Get("aaa")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, "https://a.example", u.OriginalURL)
+	assert.Equal(t, "user1", u.UserID)
+	u, exists, err = repo.Get("ccc")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.True(t, u.DeletedFlag)
+	_, err = repo.Save("ddd", "https://a.example", "user1")
+	assert.ErrorIs(t, err, ErrURLExists)
+
+	reloaded, err := NewFileRepository(filepath.Join(dir, "storage.json"), zap.NewNop())
+	assert.NoError(t, err)
+	for _, id := range []string{"aaa", "bbb", "ccc"} {
+		_, exists, _ = reloaded.Get(id)
+		assert.True(t, exists, id)
+	}
+	urls, users, err := reloaded.GetStats()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, urls)
+	assert.Equal(t, 2, users)
+
+	// Метки, описание, пометка NSFW и время создания тоже восстановлены
+	u, _, err = reloaded.Get("aaa")
+	assert.NoError(t, err)
+	assert.True(t, u.NSFW)
+	assert.Equal(t, []string{"promo"}, u.Tags)
+	assert.Equal(t, "Landing page", u.Description)
+	userURLs, err := reloaded.GetURLsByUserAndTag("user1", "promo")
+	assert.NoError(t, err)
+	if assert.Len(t, userURLs, 1) {
+		assert.True(t, created.Equal(userURLs[0].CreatedAt))
+	}
+}
+
+func TestFileRepository_SelfHealDisabled(t *testing.T) {
+	t.Parallel()
+	dir := filepath.Join(t.TempDir(), "data")
+	repo, err := NewFileRepository(filepath.Join(dir, "storage.json"), zap.NewNop(), DisableSelfHeal())
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.RemoveAll(dir))
+	_, err = repo.Save("aaa", "https://a.example", "user1")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.NoDirExists(t, dir)
+}
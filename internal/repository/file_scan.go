@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// scanCheckInterval — через сколько строк сканирование файла проверяет отмену контекста
+const scanCheckInterval = 1024
+
+// fileScan построчно читает файл хранилища, прерываясь при отмене контекста
+// и сводя предупреждения о битых строках к одной подробной записи и итогу в конце сканирования,
+// чтобы файл с миллионами битых строк не заваливал журнал
+type fileScan struct {
+	ctx     context.Context
+	scanner *bufio.Scanner
+	logger  *zap.Logger
+	op      string // Операция, от имени которой читается файл, для журнала
+	lines   int    // Прочитано строк
+	invalid int    // Пропущено битых строк
+	err     error  // Ошибка контекста, прервавшая сканирование
+}
+
+// newFileScan создаёт сканирование scanner от имени операции op
+func newFileScan(ctx context.Context, scanner *bufio.Scanner, logger *zap.Logger, op string) *fileScan {
+	return &fileScan{ctx: ctx, scanner: scanner, logger: logger, op: op}
+}
+
+// Scan переходит к следующей строке; возвращает false в конце файла, при ошибке чтения или отмене контекста
+func (s *fileScan) Scan() bool {
+	if s.lines%scanCheckInterval == 0 {
+		if err := s.ctx.Err(); err != nil {
+			s.err = err
+			return false
+		}
+	}
+	if !s.scanner.Scan() {
+		return false
+	}
+	s.lines++
+	return true
+}
+
+// Bytes возвращает текущую строку
+func (s *fileScan) Bytes() []byte {
+	return s.scanner.Bytes()
+}
+
+// Skip учитывает текущую строку как битую; подробно журналируется только первая такая строка сканирования
+func (s *fileScan) Skip(err error) {
+	s.invalid++
+	if s.invalid == 1 {
+		s.logger.Warn("Skipping invalid JSON line", zap.String("op", s.op), zap.Int("line_number", s.lines),
+			zap.String("line", string(s.scanner.Bytes())), zap.Error(err))
+	}
+}
+
+// Err завершает сканирование: журналирует итог по битым строкам и возвращает ошибку контекста или чтения
+func (s *fileScan) Err() error {
+	if s.invalid > 1 {
+		s.logger.Warn("Skipped invalid JSON lines", zap.String("op", s.op),
+			zap.Int("invalid_lines", s.invalid), zap.Int("lines", s.lines))
+	}
+	if s.err != nil {
+		return s.err
+	}
+	return s.scanner.Err()
+}
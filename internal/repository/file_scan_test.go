@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// writeLargeStorage создаёт файл хранилища с records записями пользователя user1
+func writeLargeStorage(t *testing.T, records int) string {
+	path := filepath.Join(t.TempDir(), "storage.json")
+	file, err := os.Create(path)
+	assert.NoError(t, err)
+	writer := bufio.NewWriter(file)
+	for i := range records {
+		_, err = fmt.Fprintf(writer, `{"uuid":"%d","short_url":"id%d","original_url":"https://example.com/%d","user_id":"user1"}`+"\n", i, i, i)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, writer.Flush())
+	assert.NoError(t, file.Close())
+	return path
+}
+
+func TestFileRepository_ScansRespectContext(t *testing.T) {
+	const records = 200000
+	repo, err := NewFileRepository(writeLargeStorage(t, records), zap.NewNop())
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	urls, err := repo.GetURLsByUserIDContext(ctx, "user1")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Empty(t, urls)
+
+	_, _, err = repo.GetStatsContext(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	err = repo.BatchDeleteContext(ctx, "user1", []string{"id1"})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), 100*time.Millisecond, "Cancelled scans must not read the whole file")
+
+	u, _, err := repo.Get("id1")
+	assert.NoError(t, err)
+	assert.False(t, u.DeletedFlag, "Cancelled delete must not be applied")
+
+	// Истёкший во время чтения срок тоже прерывает сканирование
+	deadlineCtx, deadlineCancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer deadlineCancel()
+	<-deadlineCtx.Done()
+	_, err = repo.GetURLsByUserIDContext(deadlineCtx, "user1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// Без отмены результат тот же, что и у вызова без контекста
+	urls, err = repo.GetURLsByUserIDContext(context.Background(), "user1")
+	assert.NoError(t, err)
+	assert.Len(t, urls, records)
+	count, users, err := repo.GetStatsContext(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, records, count)
+	assert.Equal(t, 1, users)
+}
+
+func TestFileRepository_InvalidLinesSummarized(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.json")
+	// Запись пользователя в конце, чтобы выборка по пользователю прочитала все битые строки
+	var lines string
+	for range 1000 {
+		lines += "not json\n"
+	}
+	lines += `{"uuid":"1","short_url":"aaa","original_url":"https://a.example","user_id":"user1"}` + "\n"
+	assert.NoError(t, os.WriteFile(path, []byte(lines), 0644))
+
+	core, logs := observer.New(zapcore.WarnLevel)
+	repo, err := NewFileRepository(path, zap.New(core))
+	assert.NoError(t, err)
+
+	for _, op := range []string{"load", "user_urls", "stats"} {
+		switch op {
+		case "user_urls":
+			urls, err := repo.GetURLsByUserID("user1")
+			assert.NoError(t, err)
+			assert.Len(t, urls, 1)
+		case "stats":
+			count, _, err := repo.GetStats()
+			assert.NoError(t, err)
+			assert.Equal(t, 1, count)
+		}
+
+		entries := logs.TakeAll()
+		assert.Len(t, entries, 2, "op %s: one detailed warning and one summary per scan", op)
+		if len(entries) != 2 {
+			continue
+		}
+		assert.Equal(t, "Skipping invalid JSON line", entries[0].Message)
+		assert.Equal(t, int64(1), entries[0].ContextMap()["line_number"])
+		assert.Equal(t, "Skipped invalid JSON lines", entries[1].Message)
+		assert.Equal(t, int64(1000), entries[1].ContextMap()["invalid_lines"])
+		assert.Equal(t, int64(1001), entries[1].ContextMap()["lines"])
+		assert.Equal(t, op, entries[1].ContextMap()["op"])
+	}
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"unsafe"
+
+	"github.com/tempizhere/goshorty/internal/models"
+)
+
+// Оценка объёма индексов: заголовки строк и срезов плюс служебные данные map на запись
+const (
+	stringHeaderBytes = int64(unsafe.Sizeof(""))
+	sliceHeaderBytes  = int64(unsafe.Sizeof([]string(nil)))
+	mapEntryOverhead  = 8 // байт tophash и доля заголовка корзины, приблизительно
+)
+
+// userIndex хранит короткие ID каждого пользователя в порядке добавления,
+// чтобы выборки по пользователю не перебирали всё хранилище
+// Мягкое удаление индекс не меняет: удалённые URL по-прежнему принадлежат пользователю
+type userIndex map[string][]string
+
+// add добавляет id в список пользователя
+func (idx userIndex) add(userID, id string) {
+	idx[userID] = append(idx[userID], id)
+}
+
+// remove убирает id из списка пользователя с сохранением порядка; пустой список удаляется
+func (idx userIndex) remove(userID, id string) {
+	ids := idx[userID]
+	for i, existing := range ids {
+		if existing != id {
+			continue
+		}
+		if len(ids) == 1 {
+			delete(idx, userID)
+			return
+		}
+		idx[userID] = append(ids[:i], ids[i+1:]...)
+		return
+	}
+}
+
+// move передаёт все ID пользователя from пользователю to и возвращает их
+func (idx userIndex) move(from, to string) []string {
+	ids := idx[from]
+	if len(ids) == 0 || from == to {
+		return ids
+	}
+	delete(idx, from)
+	idx[to] = append(idx[to], ids...)
+	return ids
+}
+
+// stats оценивает размер индекса
+func (idx userIndex) stats(name string) models.IndexStats {
+	return mapStats(name, idx, func(ids []string) int64 {
+		size := sliceHeaderBytes + int64(cap(ids))*stringHeaderBytes
+		for _, id := range ids {
+			size += int64(len(id))
+		}
+		return size
+	})
+}
+
+// mapStats оценивает размер map со строковыми ключами; valueBytes возвращает объём значения вместе с его заголовком
+// Строки, общие для нескольких индексов, учитываются в каждом из них
+func mapStats[V any](name string, m map[string]V, valueBytes func(V) int64) models.IndexStats {
+	stats := models.IndexStats{Name: name, Entries: len(m)}
+	for key, value := range m {
+		stats.Bytes += mapEntryOverhead + stringHeaderBytes + int64(len(key)) + valueBytes(value)
+	}
+	return stats
+}
+
+// stringValueBytes — объём строкового значения map
+func stringValueBytes(s string) int64 {
+	return stringHeaderBytes + int64(len(s))
+}
+
+// emptyValueBytes — объём значения множества map[string]struct{}
+func emptyValueBytes(struct{}) int64 {
+	return 0
+}
+
+// indexStatsOf возвращает размеры индексов хранилища, если оно их сообщает
+func indexStatsOf(repo Repository) []models.IndexStats {
+	if reporter, ok := repo.(IndexReporter); ok {
+		return reporter.IndexStats()
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/models"
+	"go.uber.org/zap"
+)
+
+// assertUserIndex проверяет, что индекс пользователей содержит каждый ID ровно один раз у его владельца
+func assertUserIndex(t *testing.T, idx userIndex, owners map[string]string) {
+	t.Helper()
+	total := 0
+	for userID, ids := range idx {
+		assert.NotEmpty(t, ids, "Empty list for user %q should be removed", userID)
+		for _, id := range ids {
+			owner, exists := owners[id]
+			assert.True(t, exists, "Indexed ID %q is missing in the store", id)
+			assert.Equal(t, owner, userID, "ID %q is indexed under the wrong user", id)
+		}
+		total += len(ids)
+	}
+	assert.Equal(t, len(owners), total, "Index and store disagree on the number of IDs")
+}
+
+// runRandomOperations выполняет над репозиторием случайную, но воспроизводимую последовательность операций
+// Как и сервис, одиночное сохранение не перезаписывает занятый ID
+func runRandomOperations(repo Repository, seed int64, steps int) {
+	rng := rand.New(rand.NewSource(seed))
+	users := []string{"", "user1", "user2", "user3", "user4"}
+	user := func() string { return users[rng.Intn(len(users))] }
+	id := func() string { return fmt.Sprintf("id%d", rng.Intn(150)) }
+	freeID := func() (string, bool) {
+		shortID := id()
+		_, exists, _ := repo.Get(shortID)
+		return shortID, !exists
+	}
+	url := func() string { return fmt.Sprintf("https://host%d.example/%d", rng.Intn(3), rng.Intn(1000)) }
+
+	for i := 0; i < steps; i++ {
+		switch rng.Intn(9) {
+		case 0, 1:
+			if shortID, free := freeID(); free {
+				_, _ = repo.Save(shortID, url(), user())
+			}
+		case 2:
+			if shortID, free := freeID(); free {
+				_, _ = repo.SaveURL(models.URL{ShortID: shortID, OriginalURL: url(), UserID: user(), ClaimTokenHash: "hash-" + shortID})
+			}
+		case 3:
+			items := make([]models.BatchItem, 1+rng.Intn(4))
+			for j := range items {
+				items[j] = models.BatchItem{ShortID: id(), OriginalURL: url()}
+			}
+			_ = repo.BatchSave(items, user())
+		case 4:
+			_ = repo.BatchDelete(user(), []string{id(), id()})
+		case 5:
+			_, _ = repo.ReassignUser(user(), user())
+		case 6:
+			shortID := id()
+			_ = repo.ClaimURL(shortID, "hash-"+shortID, user())
+		case 7:
+			owner := user()
+			shortID := id()
+			if repo.ReserveIDs([]string{shortID}, owner, time.Now()) == nil && rng.Intn(2) == 0 {
+				_ = repo.ActivateReserved(shortID, owner, url())
+			}
+		case 8:
+			_, _ = repo.DeleteByUserAndHost(user(), fmt.Sprintf("host%d.example", rng.Intn(3)))
+		}
+	}
+}
+
+func memoryOwners(repo *MemoryRepository) map[string]string {
+	owners := make(map[string]string, len(repo.store))
+	for id, e := range repo.store {
+		owners[id] = e.UserID
+	}
+	return owners
+}
+
+// sortedShortIDs возвращает ID выборки по пользователю в порядке возрастания
+func sortedShortIDs(urls []models.URL) []string {
+	ids := make([]string, 0, len(urls))
+	for _, u := range urls {
+		ids = append(ids, u.ShortID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestMemoryRepository_UserIndexConsistency(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithMaxURLs(40, EvictionLRU)}} {
+		for seed := int64(1); seed <= 20; seed++ {
+			repo := NewMemoryRepository(opts...)
+			runRandomOperations(repo, seed, 300)
+			assertUserIndex(t, repo.byUser, memoryOwners(repo))
+
+			// Выборка по индексу совпадает с полным перебором хранилища
+			for _, userID := range []string{"", "user1", "user2", "user3", "user4"} {
+				var scanned []models.URL
+				for _, e := range repo.store {
+					if e.UserID == userID && !e.Reserved {
+						scanned = append(scanned, e.URL)
+					}
+				}
+				urls, err := repo.GetURLsByUserID(userID)
+				assert.NoError(t, err)
+				assert.Equal(t, sortedShortIDs(scanned), sortedShortIDs(urls), "seed %d, user %q", seed, userID)
+			}
+		}
+	}
+}
+
+func TestFileRepository_UserIndexConsistency(t *testing.T) {
+	for seed := int64(1); seed <= 10; seed++ {
+		path := filepath.Join(t.TempDir(), "storage.json")
+		repo, err := NewFileRepository(path, zap.NewNop())
+		assert.NoError(t, err)
+		runRandomOperations(repo, seed, 200)
+		assertUserIndex(t, repo.byUser, repo.owners)
+
+		// После перезагрузки индекс строится из файла так же, как поддерживался в памяти
+		reloaded, err := NewFileRepository(path, zap.NewNop())
+		assert.NoError(t, err)
+		assertUserIndex(t, reloaded.byUser, reloaded.owners)
+		assert.Equal(t, repo.owners, reloaded.owners, "seed %d", seed)
+		for _, userID := range []string{"", "user1", "user2", "user3", "user4"} {
+			before, err := repo.GetURLsByUserID(userID)
+			assert.NoError(t, err)
+			after, err := reloaded.GetURLsByUserID(userID)
+			assert.NoError(t, err)
+			assert.Equal(t, sortedShortIDs(before), sortedShortIDs(after), "seed %d, user %q", seed, userID)
+		}
+	}
+}
+
+func TestUserIndex(t *testing.T) {
+	idx := make(userIndex)
+	idx.add("user1", "a")
+	idx.add("user1", "b")
+	idx.add("user1", "c")
+	idx.remove("user1", "b")
+	assert.Equal(t, []string{"a", "c"}, idx["user1"])
+
+	assert.Equal(t, []string{"a", "c"}, idx.move("user1", "user2"))
+	assert.NotContains(t, idx, "user1")
+	idx.remove("user2", "a")
+	idx.remove("user2", "c")
+	assert.Empty(t, idx)
+}
+
+func TestIndexStats(t *testing.T) {
+	memory := NewMemoryRepository()
+	_, err := memory.Save("id1", "https://example.com", "user1")
+	assert.NoError(t, err)
+	_, err = memory.Save("id2", "https://example.org", "user1")
+	assert.NoError(t, err)
+
+	stats := memory.IndexStats()
+	assert.Equal(t, "store", stats[0].Name)
+	assert.Equal(t, 2, stats[0].Entries)
+	assert.Equal(t, "user_index", stats[1].Name)
+	assert.Equal(t, 1, stats[1].Entries)
+	for _, s := range stats[:2] {
+		assert.Positive(t, s.Bytes, s.Name)
+	}
+
+	file, err := NewFileRepository(filepath.Join(t.TempDir(), "storage.json"), zap.NewNop())
+	assert.NoError(t, err)
+	_, err = file.Save("id1", "https://example.com", "user1")
+	assert.NoError(t, err)
+	names := make(map[string]int)
+	for _, s := range file.IndexStats() {
+		names[s.Name] = s.Entries
+	}
+	assert.Equal(t, map[string]int{"store": 1, "owners": 1, "user_index": 1, "claims": 0, "deleted": 0, "reserved": 0, "nsfw": 0, "meta": 1, "users": 0, "url_index": 1}, names)
+
+	// Обёртки передают отчёт основного хранилища
+	assert.Equal(t, memory.IndexStats(), WithFaults(memory, FaultConfig{}).IndexStats())
+}
@@ -0,0 +1,312 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/tempizhere/goshorty/internal/models"
+)
+
+// expectedErrors — штатные исходы операций хранилища, которые не считаются сбоями
+var expectedErrors = []error{ErrURLExists, ErrIDExists, ErrClaimRejected, ErrURLNotFound, ErrNotReserved, ErrDuplicatesUnsupported, context.Canceled}
+
+// InstrumentedRepository запоминает последние неудачные вызовы основного хранилища (см. RecentErrors),
+// чтобы при жалобах на периодические сбои не искать их в журналах всех экземпляров
+// Успешный вызов обходится замером времени без выделений памяти
+type InstrumentedRepository struct {
+	Repository // Основное хранилище
+
+	recent *errorRing
+	now    func() time.Time
+}
+
+// Instrument оборачивает inner журналом последних RecentErrorsCapacity ошибок
+func Instrument(inner Repository) *InstrumentedRepository {
+	return &InstrumentedRepository{Repository: inner, recent: newErrorRing(RecentErrorsCapacity), now: time.Now}
+}
+
+// RecentErrors возвращает последние ошибки хранилища от новых к старым
+func (r *InstrumentedRepository) RecentErrors() []OperationError {
+	return r.recent.list()
+}
+
+// ClearRecentErrors очищает журнал последних ошибок
+func (r *InstrumentedRepository) ClearRecentErrors() {
+	r.recent.clear()
+}
+
+// observe записывает вызов method, начатый в start, если он завершился сбоем
+func (r *InstrumentedRepository) observe(method string, start time.Time, err error) {
+	if err == nil {
+		return
+	}
+	for _, expected := range expectedErrors {
+		if errors.Is(err, expected) {
+			return
+		}
+	}
+	end := r.now()
+	r.recent.add(OperationError{Time: end, Method: method, Error: SanitizeError(err), Duration: end.Sub(start)})
+}
+
+// Save сохраняет URL в основном хранилище
+func (r *InstrumentedRepository) Save(id, url, userID string) (string, error) {
+	start := r.now()
+	shortID, err := r.Repository.Save(id, url, userID)
+	r.observe("Save", start, err)
+	return shortID, err
+}
+
+// SaveURL сохраняет URL со всеми атрибутами в основном хранилище
+func (r *InstrumentedRepository) SaveURL(u models.URL) (string, error) {
+	start := r.now()
+	shortID, err := r.Repository.SaveURL(u)
+	r.observe("SaveURL", start, err)
+	return shortID, err
+}
+
+// SaveDuplicateURL сохраняет URL без поиска существующей ссылки, если основное хранилище это допускает
+func (r *InstrumentedRepository) SaveDuplicateURL(u models.URL) (string, error) {
+	saver, ok := r.Repository.(DuplicateSaver)
+	if !ok {
+		return "", ErrDuplicatesUnsupported
+	}
+	start := r.now()
+	shortID, err := saver.SaveDuplicateURL(u)
+	r.observe("SaveDuplicateURL", start, err)
+	return shortID, err
+}
+
+// Get возвращает URL из основного хранилища
+func (r *InstrumentedRepository) Get(id string) (models.URL, bool, error) {
+	start := r.now()
+	u, ok, err := r.Repository.Get(id)
+	r.observe("Get", start, err)
+	return u, ok, err
+}
+
+// BatchGet возвращает URL из основного хранилища
+func (r *InstrumentedRepository) BatchGet(ids []string) (map[string]models.URL, error) {
+	start := r.now()
+	urls, err := r.Repository.BatchGet(ids)
+	r.observe("BatchGet", start, err)
+	return urls, err
+}
+
+// BatchSave сохраняет пакет URL в основном хранилище
+func (r *InstrumentedRepository) BatchSave(items []models.BatchItem, userID string) error {
+	start := r.now()
+	err := r.Repository.BatchSave(items, userID)
+	r.observe("BatchSave", start, err)
+	return err
+}
+
+// GetURLsByUserID возвращает URL пользователя из основного хранилища
+func (r *InstrumentedRepository) GetURLsByUserID(userID string) ([]models.URL, error) {
+	start := r.now()
+	urls, err := r.Repository.GetURLsByUserID(userID)
+	r.observe("GetURLsByUserID", start, err)
+	return urls, err
+}
+
+// GetURLsByUserIDContext работает как GetURLsByUserID, прерывая выборку при отмене контекста,
+// если основное хранилище это поддерживает (см. ContextScanner)
+func (r *InstrumentedRepository) GetURLsByUserIDContext(ctx context.Context, userID string) ([]models.URL, error) {
+	scanner, ok := r.Repository.(ContextScanner)
+	if !ok {
+		return r.GetURLsByUserID(userID)
+	}
+	start := r.now()
+	urls, err := scanner.GetURLsByUserIDContext(ctx, userID)
+	r.observe("GetURLsByUserID", start, err)
+	return urls, err
+}
+
+// GetURLsByUserAndTag возвращает URL пользователя с меткой из основного хранилища
+func (r *InstrumentedRepository) GetURLsByUserAndTag(userID, tag string) ([]models.URL, error) {
+	start := r.now()
+	urls, err := r.Repository.GetURLsByUserAndTag(userID, tag)
+	r.observe("GetURLsByUserAndTag", start, err)
+	return urls, err
+}
+
+// BatchDelete помечает URL удалёнными в основном хранилище
+func (r *InstrumentedRepository) BatchDelete(userID string, ids []string) error {
+	start := r.now()
+	err := r.Repository.BatchDelete(userID, ids)
+	r.observe("BatchDelete", start, err)
+	return err
+}
+
+// BatchDeleteContext работает как BatchDelete, прерывая удаление при отмене контекста,
+// если основное хранилище это поддерживает (см. ContextScanner)
+func (r *InstrumentedRepository) BatchDeleteContext(ctx context.Context, userID string, ids []string) error {
+	scanner, ok := r.Repository.(ContextScanner)
+	if !ok {
+		return r.BatchDelete(userID, ids)
+	}
+	start := r.now()
+	err := scanner.BatchDeleteContext(ctx, userID, ids)
+	r.observe("BatchDelete", start, err)
+	return err
+}
+
+// DeleteByUserAndHost помечает удалёнными URL пользователя на хосте в основном хранилище
+func (r *InstrumentedRepository) DeleteByUserAndHost(userID, host string) (int, error) {
+	start := r.now()
+	deleted, err := r.Repository.DeleteByUserAndHost(userID, host)
+	r.observe("DeleteByUserAndHost", start, err)
+	return deleted, err
+}
+
+// ReassignUser передаёт URL пользователя в основном хранилище
+func (r *InstrumentedRepository) ReassignUser(fromUserID, toUserID string) (int, error) {
+	start := r.now()
+	moved, err := r.Repository.ReassignUser(fromUserID, toUserID)
+	r.observe("ReassignUser", start, err)
+	return moved, err
+}
+
+// ClaimURL передаёт URL по токену владения в основном хранилище
+func (r *InstrumentedRepository) ClaimURL(id, tokenHash, userID string) error {
+	start := r.now()
+	err := r.Repository.ClaimURL(id, tokenHash, userID)
+	r.observe("ClaimURL", start, err)
+	return err
+}
+
+// SetNSFW меняет пометку NSFW в основном хранилище
+func (r *InstrumentedRepository) SetNSFW(id string, nsfw bool) error {
+	start := r.now()
+	err := r.Repository.SetNSFW(id, nsfw)
+	r.observe("SetNSFW", start, err)
+	return err
+}
+
+// ReserveIDs резервирует короткие ID в основном хранилище
+func (r *InstrumentedRepository) ReserveIDs(ids []string, userID string, createdAt time.Time) error {
+	start := r.now()
+	err := r.Repository.ReserveIDs(ids, userID, createdAt)
+	r.observe("ReserveIDs", start, err)
+	return err
+}
+
+// ActivateReserved задаёт адрес зарезервированного ID в основном хранилище
+func (r *InstrumentedRepository) ActivateReserved(id, userID, originalURL string) error {
+	start := r.now()
+	err := r.Repository.ActivateReserved(id, userID, originalURL)
+	r.observe("ActivateReserved", start, err)
+	return err
+}
+
+// GetUserIDsByURL возвращает пользователей, сокративших URL, из основного хранилища
+func (r *InstrumentedRepository) GetUserIDsByURL(originalURL string) ([]string, error) {
+	start := r.now()
+	userIDs, err := r.Repository.GetUserIDsByURL(originalURL)
+	r.observe("GetUserIDsByURL", start, err)
+	return userIDs, err
+}
+
+// SaveUser запоминает выданного пользователя в основном хранилище
+func (r *InstrumentedRepository) SaveUser(userID string, firstSeen time.Time) error {
+	start := r.now()
+	err := r.Repository.SaveUser(userID, firstSeen)
+	r.observe("SaveUser", start, err)
+	return err
+}
+
+// Count возвращает количество URL в основном хранилище
+func (r *InstrumentedRepository) Count() (int, error) {
+	start := r.now()
+	count, err := r.Repository.Count()
+	r.observe("Count", start, err)
+	return count, err
+}
+
+// GetStats возвращает статистику основного хранилища
+func (r *InstrumentedRepository) GetStats() (int, int, error) {
+	start := r.now()
+	urls, users, err := r.Repository.GetStats()
+	r.observe("GetStats", start, err)
+	return urls, users, err
+}
+
+// GetStatsContext работает как GetStats, прерывая подсчёт при отмене контекста,
+// если основное хранилище это поддерживает (см. ContextScanner)
+func (r *InstrumentedRepository) GetStatsContext(ctx context.Context) (int, int, error) {
+	scanner, ok := r.Repository.(ContextScanner)
+	if !ok {
+		return r.GetStats()
+	}
+	start := r.now()
+	urls, users, err := scanner.GetStatsContext(ctx)
+	r.observe("GetStats", start, err)
+	return urls, users, err
+}
+
+// GetUserStats возвращает статистику пользователя из основного хранилища
+func (r *InstrumentedRepository) GetUserStats(userID string, now time.Time) (models.UserStats, error) {
+	start := r.now()
+	stats, err := r.Repository.GetUserStats(userID, now)
+	r.observe("GetUserStats", start, err)
+	return stats, err
+}
+
+// TopUsers возвращает пользователей с наибольшим числом URL из основного хранилища
+func (r *InstrumentedRepository) TopUsers(limit int) ([]models.UserURLCount, error) {
+	start := r.now()
+	users, err := r.Repository.TopUsers(limit)
+	r.observe("TopUsers", start, err)
+	return users, err
+}
+
+// RecordReferrer учитывает источник перехода в основном хранилище
+func (r *InstrumentedRepository) RecordReferrer(id, referrer string) error {
+	start := r.now()
+	err := recordReferrerIn(r.Repository, id, referrer)
+	r.observe("RecordReferrer", start, err)
+	return err
+}
+
+// TopReferrers возвращает источники переходов из основного хранилища
+func (r *InstrumentedRepository) TopReferrers(ids []string, limit int) (map[string][]models.ReferrerCount, error) {
+	start := r.now()
+	referrers, err := topReferrersOf(r.Repository, ids, limit)
+	r.observe("TopReferrers", start, err)
+	return referrers, err
+}
+
+// RecordClicks учитывает переходы в основном хранилище
+func (r *InstrumentedRepository) RecordClicks(id, ref string, n int) error {
+	start := r.now()
+	err := recordClicksIn(r.Repository, id, ref, n)
+	r.observe("RecordClicks", start, err)
+	return err
+}
+
+// ClickCounts возвращает переходы из основного хранилища
+func (r *InstrumentedRepository) ClickCounts(ids []string) (map[string]map[string]int, error) {
+	start := r.now()
+	counts, err := clickCountsOf(r.Repository, ids)
+	r.observe("ClickCounts", start, err)
+	return counts, err
+}
+
+// IndexStats возвращает размеры индексов основного хранилища
+func (r *InstrumentedRepository) IndexStats() []models.IndexStats {
+	return indexStatsOf(r.Repository)
+}
+
+// UserRevision возвращает ревизию ссылок пользователя в основном хранилище
+func (r *InstrumentedRepository) UserRevision(userID string) (string, bool) {
+	return userRevisionOf(r.Repository, userID)
+}
+
+// Healthy сообщает, согласованы ли данные основного хранилища; хранилища без проверки считаются исправными
+func (r *InstrumentedRepository) Healthy() bool {
+	if checker, ok := r.Repository.(interface{ Healthy() bool }); ok {
+		return checker.Healthy()
+	}
+	return true
+}
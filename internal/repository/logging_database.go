@@ -0,0 +1,96 @@
+package repository
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// maxQueryLabelLength ограничивает длину метки запроса в логе
+const maxQueryLabelLength = 120
+
+// stringLiteralPattern находит строковые литералы SQL, которые не должны попадать в лог
+var stringLiteralPattern = regexp.MustCompile(`'(?:[^']|'')*'`)
+
+// LoggingDatabase замеряет время Exec, Query и QueryRow и пишет его в лог
+// Запросы дольше порога пишутся с уровнем warn, остальные — с уровнем debug; аргументы запросов не логируются
+type LoggingDatabase struct {
+	Database // Основное подключение; Ping, Close и Begin вызываются без замера
+
+	threshold time.Duration
+	now       func() time.Time
+	logger    *zap.Logger
+}
+
+// NewLoggingDatabase оборачивает next логированием медленных запросов
+func NewLoggingDatabase(next Database, threshold time.Duration, logger *zap.Logger) *LoggingDatabase {
+	return &LoggingDatabase{
+		Database:  next,
+		threshold: threshold,
+		now:       time.Now,
+		logger:    logger.Named("db"),
+	}
+}
+
+// Exec выполняет SQL-команду и логирует время выполнения
+func (d *LoggingDatabase) Exec(query string, args ...interface{}) (sql.Result, error) {
+	start := d.now()
+	result, err := d.Database.Exec(query, args...)
+	d.log("exec", query, start, err)
+	return result, err
+}
+
+// Query выполняет SQL-запрос и логирует время до получения первых результатов
+func (d *LoggingDatabase) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	start := d.now()
+	rows, err := d.Database.Query(query, args...)
+	d.log("query", query, start, err)
+	return rows, err
+}
+
+// QueryRow выполняет SQL-запрос и логирует время выполнения
+// Ошибка запроса возвращается только при Scan, поэтому в лог не попадает
+func (d *LoggingDatabase) QueryRow(query string, args ...interface{}) *sql.Row {
+	start := d.now()
+	row := d.Database.QueryRow(query, args...)
+	d.log("query_row", query, start, nil)
+	return row
+}
+
+// log пишет длительность запроса с уровнем, зависящим от порога
+func (d *LoggingDatabase) log(op, query string, start time.Time, err error) {
+	duration := d.now().Sub(start)
+	level := zap.DebugLevel
+	msg := "DB query"
+	if duration >= d.threshold {
+		level = zap.WarnLevel
+		msg = "Slow DB query"
+	}
+	ce := d.logger.Check(level, msg)
+	if ce == nil {
+		return
+	}
+	fields := []zap.Field{
+		zap.String("op", op),
+		zap.String("query", QueryLabel(query)),
+		zap.Duration("duration", duration),
+	}
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+	ce.Write(fields...)
+}
+
+// QueryLabel возвращает однострочную метку запроса для лога
+// Пробелы схлопываются, строковые литералы заменяются на '?', длинные запросы обрезаются
+func QueryLabel(query string) string {
+	label := strings.Join(strings.Fields(query), " ")
+	label = stringLiteralPattern.ReplaceAllString(label, "'?'")
+	if len(label) > maxQueryLabelLength {
+		label = label[:maxQueryLabelLength] + "..."
+	}
+	return label
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLoggingDatabase(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("Failed to close database: %v", closeErr)
+		}
+	}()
+
+	core, logs := observer.New(zap.DebugLevel)
+	loggingDB := NewLoggingDatabase(db, 50*time.Millisecond, zap.New(core))
+
+	// Быстрый запрос пишется с уровнем debug
+	mock.ExpectExec("UPDATE urls").WithArgs("secret-user").WillReturnResult(sqlmock.NewResult(0, 1))
+	_, err = loggingDB.Exec("UPDATE urls SET is_deleted = TRUE\n\t\tWHERE user_id = $1", "secret-user")
+	assert.NoError(t, err)
+
+	// Медленный запрос пишется с уровнем warn
+	mock.ExpectQuery("SELECT short_id").WillDelayFor(100 * time.Millisecond).
+		WillReturnRows(sqlmock.NewRows([]string{"short_id"}).AddRow("abc"))
+	rows, err := loggingDB.Query("SELECT short_id FROM urls WHERE original_url = 'https://private.example.com'")
+	assert.NoError(t, err)
+	assert.NoError(t, rows.Close())
+
+	mock.ExpectQuery("SELECT 1").WillReturnError(errors.New("connection refused"))
+	_, err = loggingDB.Query("SELECT 1")
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	entries := logs.All()
+	assert.Len(t, entries, 3)
+	for _, e := range entries {
+		assert.Equal(t, "db", e.LoggerName)
+		assert.NotContains(t, e.ContextMap(), "args")
+	}
+
+	assert.Equal(t, zapcore.DebugLevel, entries[0].Level)
+	assert.Equal(t, "UPDATE urls SET is_deleted = TRUE WHERE user_id = $1", entries[0].ContextMap()["query"])
+	assert.Equal(t, "exec", entries[0].ContextMap()["op"])
+
+	slow := logs.FilterMessage("Slow DB query").All()
+	assert.Len(t, slow, 1)
+	assert.Equal(t, zapcore.WarnLevel, slow[0].Level)
+	fields := slow[0].ContextMap()
+	assert.Equal(t, "SELECT short_id FROM urls WHERE original_url = '?'", fields["query"])
+	assert.GreaterOrEqual(t, fields["duration"], 50*time.Millisecond)
+
+	assert.Equal(t, "connection refused", entries[2].ContextMap()["error"])
+}
+
+func TestQueryLabel(t *testing.T) {
+	assert.Equal(t, "SELECT 1", QueryLabel("  SELECT\n\t1  "))
+	assert.Equal(t, "SELECT * FROM urls WHERE tags ? '?' AND user_id = '?'", QueryLabel("SELECT * FROM urls WHERE tags ? 'promo' AND user_id = 'it''s'"))
+
+	label := QueryLabel("SELECT " + strings.Repeat("x", 200))
+	assert.Len(t, label, maxQueryLabelLength+len("..."))
+}
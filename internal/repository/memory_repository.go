@@ -1,53 +1,239 @@
 package repository
 
 import (
+	"context"
+	"expvar"
 	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
 
 	"github.com/tempizhere/goshorty/internal/models"
+	"go.uber.org/zap"
 )
 
+// memoryEvictions считает записи, вытесненные из in-memory хранилища при достижении лимита
+var memoryEvictions = expvar.NewInt("memory_evictions")
+
+// memoryEntry хранит URL вместе с признаком недавнего обращения для вытеснения
+type memoryEntry struct {
+	models.URL
+	ref *atomic.Bool // Признак обращения с последнего прохода стрелки; nil, если вытеснение отключено
+}
+
 // MemoryRepository реализует интерфейс Repository с использованием map
 type MemoryRepository struct {
-	store map[string]models.URL
-	mutex sync.RWMutex
+	store    map[string]memoryEntry
+	byUser   userIndex
+	users    map[string]time.Time
+	refs     referrerCounts
+	clicks   referrerCounts // Переходы по меткам кампаний
+	revs     userRevisions
+	dedup    bool // Искать существующий original_url при сохранении
+	maxURLs  int  // Лимит записей; 0 — без ограничения
+	eviction EvictionPolicy
+	ring     []string // Кольцо ID для алгоритма clock; пустая строка — свободная ячейка
+	free     []int    // Свободные ячейки кольца
+	hand     int      // Позиция стрелки clock
+	logger   *zap.Logger
+	mutex    sync.RWMutex
 }
 
 // NewMemoryRepository создаёт новый экземпляр MemoryRepository
-func NewMemoryRepository() *MemoryRepository {
+func NewMemoryRepository(opts ...Option) *MemoryRepository {
+	o := applyOptions(opts)
 	return &MemoryRepository{
-		store: make(map[string]models.URL, 1000), // Предварительно выделяем память
-		mutex: sync.RWMutex{},
+		store:    make(map[string]memoryEntry, 1000), // Предварительно выделяем память
+		byUser:   make(userIndex),
+		users:    make(map[string]time.Time),
+		refs:     make(referrerCounts),
+		clicks:   make(referrerCounts),
+		revs:     newUserRevisions(),
+		dedup:    !o.disableReverseIndex,
+		maxURLs:  o.maxURLs,
+		eviction: o.eviction,
+		logger:   o.logger,
+		mutex:    sync.RWMutex{},
+	}
+}
+
+// tracksAccess сообщает, отслеживаются ли обращения к записям для вытеснения
+func (r *MemoryRepository) tracksAccess() bool {
+	return r.maxURLs > 0 && r.eviction == EvictionLRU
+}
+
+// touch отмечает обращение к записи; дешёвая операция, допустимая под блокировкой на чтение
+func touch(e memoryEntry) {
+	if e.ref != nil && !e.ref.Load() {
+		e.ref.Store(true)
 	}
 }
 
+// reserve освобождает место под n новых записей согласно политике вытеснения
+// Вызывающий должен удерживать r.mutex на запись
+func (r *MemoryRepository) reserve(n int) error {
+	if r.maxURLs == 0 {
+		return nil
+	}
+	excess := len(r.store) + n - r.maxURLs
+	if excess <= 0 {
+		return nil
+	}
+	if !r.tracksAccess() || n > r.maxURLs {
+		return ErrStorageFull
+	}
+	for i := 0; i < excess; i++ {
+		r.evictOne()
+	}
+	memoryEvictions.Add(int64(excess))
+	r.logger.Info("Evicted URLs from memory storage", zap.Int("evicted", excess), zap.Int("max_urls", r.maxURLs))
+	return nil
+}
+
+// evictOne вытесняет одну запись алгоритмом clock: запись с признаком обращения получает второй шанс,
+// удалённые записи вытесняются в первую очередь
+// Вызывающий должен удерживать r.mutex на запись, хранилище не должно быть пустым
+func (r *MemoryRepository) evictOne() {
+	for {
+		slot := r.hand
+		r.hand = (r.hand + 1) % len(r.ring)
+		id := r.ring[slot]
+		if id == "" {
+			continue
+		}
+		e := r.store[id]
+		if e.ref.Swap(false) && !e.DeletedFlag {
+			continue
+		}
+		delete(r.store, id)
+		delete(r.refs, id)
+		delete(r.clicks, id)
+		r.byUser.remove(e.UserID, id)
+		r.revs.bump(e.UserID)
+		r.ring[slot] = ""
+		r.free = append(r.free, slot)
+		return
+	}
+}
+
+// put сохраняет запись и при включённом вытеснении ставит её в кольцо
+// Вызывающий должен удерживать r.mutex на запись
+func (r *MemoryRepository) put(u models.URL) {
+	if existing, exists := r.store[u.ShortID]; exists {
+		if existing.UserID != u.UserID {
+			r.byUser.remove(existing.UserID, u.ShortID)
+			r.byUser.add(u.UserID, u.ShortID)
+			r.revs.bump(existing.UserID)
+		}
+		r.revs.bump(u.UserID)
+		existing.URL = u
+		r.store[u.ShortID] = existing
+		return
+	}
+	e := memoryEntry{URL: u}
+	if r.tracksAccess() {
+		e.ref = new(atomic.Bool)
+		if n := len(r.free); n > 0 {
+			r.ring[r.free[n-1]] = u.ShortID
+			r.free = r.free[:n-1]
+		} else {
+			r.ring = append(r.ring, u.ShortID)
+		}
+	}
+	r.store[u.ShortID] = e
+	r.byUser.add(u.UserID, u.ShortID)
+	r.revs.bump(u.UserID)
+}
+
 // Save сохраняет пару ID-URL в хранилище
 func (r *MemoryRepository) Save(id, url, userID string) (string, error) {
+	return r.SaveURL(models.URL{
+		ShortID:     id,
+		OriginalURL: url,
+		UserID:      userID,
+	})
+}
+
+// SaveURL сохраняет URL со всеми атрибутами в хранилище
+func (r *MemoryRepository) SaveURL(u models.URL) (string, error) {
+	return r.saveURL(u, r.dedup)
+}
+
+// SaveDuplicateURL сохраняет URL, даже если original_url уже сокращён
+func (r *MemoryRepository) SaveDuplicateURL(u models.URL) (string, error) {
+	return r.saveURL(u, false)
+}
+
+// saveURL сохраняет URL; при dedup возвращает ID существующей ссылки на тот же original_url и ErrURLExists
+func (r *MemoryRepository) saveURL(u models.URL, dedup bool) (string, error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
 	// Проверяем, существует ли original_url
-	for shortID, u := range r.store {
-		if u.OriginalURL == url {
-			return shortID, ErrURLExists
+	if dedup {
+		for shortID, existing := range r.store {
+			if existing.OriginalURL == u.OriginalURL {
+				return shortID, ErrURLExists
+			}
 		}
 	}
 
-	r.store[id] = models.URL{
-		ShortID:     id,
-		OriginalURL: url,
-		UserID:      userID,
-		DeletedFlag: false,
+	if _, exists := r.store[u.ShortID]; !exists {
+		if err := r.reserve(1); err != nil {
+			return "", err
+		}
 	}
-	return id, nil
+
+	u.DeletedFlag = false
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now()
+	}
+	r.put(u)
+	return u.ShortID, nil
 }
 
 // Get возвращает URL по ID, если он существует
-func (r *MemoryRepository) Get(id string) (models.URL, bool) {
+func (r *MemoryRepository) Get(id string) (models.URL, bool, error) {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
-	u, exists := r.store[id]
-	return u, exists
+	e, exists := r.store[id]
+	touch(e)
+	return e.URL, exists, nil
+}
+
+// BatchGet возвращает найденные URL по списку ID
+func (r *MemoryRepository) BatchGet(ids []string) (map[string]models.URL, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	result := make(map[string]models.URL, len(ids))
+	for _, id := range ids {
+		if e, exists := r.store[id]; exists {
+			touch(e)
+			result[id] = e.URL
+		}
+	}
+	return result, nil
+}
+
+// List перечисляет неудалённые URL; fn вызывается под блокировкой на чтение и не должна обращаться к хранилищу
+func (r *MemoryRepository) List(ctx context.Context, fn func(models.URL) error) error {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, e := range r.store {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if e.DeletedFlag || e.Reserved {
+			continue
+		}
+		if err := fn(e.URL); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Clear очищает хранилище
@@ -55,47 +241,93 @@ func (r *MemoryRepository) Clear() {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	r.store = make(map[string]models.URL)
+	r.store = make(map[string]memoryEntry)
+	r.byUser = make(userIndex)
+	r.users = make(map[string]time.Time)
+	r.refs = make(referrerCounts)
+	r.clicks = make(referrerCounts)
+	r.revs.bumpAll()
+	r.ring = nil
+	r.free = nil
+	r.hand = 0
 }
 
-// BatchSave сохраняет множество пар ID-URL в хранилище
-func (r *MemoryRepository) BatchSave(urls map[string]string, userID string) error {
+// BatchSave сохраняет множество пар ID-URL в хранилище в порядке элементов
+func (r *MemoryRepository) BatchSave(items []models.BatchItem, userID string) error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
-	for id, url := range urls {
+	// Проверяем занятость ID под той же блокировкой, что и сохранение
+	if !uniqueBatchIDs(items) {
+		return ErrIDExists
+	}
+	for _, item := range items {
+		if _, exists := r.store[item.ShortID]; exists {
+			return ErrIDExists
+		}
+	}
+
+	// Повтор URL отклоняет пакет целиком до изменения хранилища, как откат транзакции в PostgreSQL
+	if r.dedup {
+		batchURLs := make(map[string]struct{}, len(items))
+		for _, item := range items {
+			if _, repeated := batchURLs[item.OriginalURL]; repeated {
+				return ErrURLExists
+			}
+			batchURLs[item.OriginalURL] = struct{}{}
+		}
 		for _, u := range r.store {
-			if u.OriginalURL == url {
+			if _, exists := batchURLs[u.OriginalURL]; exists {
 				return ErrURLExists
 			}
 		}
-		r.store[id] = models.URL{
-			ShortID:     id,
-			OriginalURL: url,
+	}
+
+	if err := r.reserve(len(items)); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, item := range items {
+		createdAt := item.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = now
+		}
+		r.put(models.URL{
+			ShortID:     item.ShortID,
+			OriginalURL: item.OriginalURL,
 			UserID:      userID,
 			DeletedFlag: false,
-		}
+			CreatedAt:   createdAt,
+		})
 	}
 	return nil
 }
 
-// GetURLsByUserID возвращает все URL, связанные с пользователем
+// GetURLsByUserID возвращает все URL, связанные с пользователем, по индексу пользователей
 func (r *MemoryRepository) GetURLsByUserID(userID string) ([]models.URL, error) {
 	r.mutex.RLock()
 	defer r.mutex.RUnlock()
 
-	// Подсчитываем количество URL для пользователя
-	count := 0
-	for _, u := range r.store {
-		if u.UserID == userID {
-			count++
+	ids := r.byUser[userID]
+	urls := make([]models.URL, 0, len(ids))
+	for _, id := range ids {
+		if u := r.store[id]; !u.Reserved {
+			urls = append(urls, u.URL)
 		}
 	}
+	return urls, nil
+}
 
-	urls := make([]models.URL, 0, count)
-	for _, u := range r.store {
-		if u.UserID == userID {
-			urls = append(urls, u)
+// GetURLsByUserAndTag возвращает URL пользователя, помеченные указанной меткой
+func (r *MemoryRepository) GetURLsByUserAndTag(userID, tag string) ([]models.URL, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var urls []models.URL
+	for _, id := range r.byUser[userID] {
+		if u := r.store[id]; u.HasTag(tag) {
+			urls = append(urls, u.URL)
 		}
 	}
 	return urls, nil
@@ -110,11 +342,148 @@ func (r *MemoryRepository) BatchDelete(userID string, ids []string) error {
 		if u, exists := r.store[id]; exists && u.UserID == userID {
 			u.DeletedFlag = true
 			r.store[id] = u
+			delete(r.refs, id)
+			delete(r.clicks, id)
 		}
 	}
+	r.revs.bump(userID)
 	return nil
 }
 
+// DeleteByUserAndHost помечает удалёнными все URL пользователя с указанным хостом
+func (r *MemoryRepository) DeleteByUserAndHost(userID, host string) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	deleted := 0
+	for _, id := range r.byUser[userID] {
+		if u := r.store[id]; !u.DeletedFlag && hostMatches(u.OriginalURL, host) {
+			u.DeletedFlag = true
+			r.store[id] = u
+			delete(r.refs, id)
+			delete(r.clicks, id)
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		r.revs.bump(userID)
+	}
+	return deleted, nil
+}
+
+// ReassignUser передаёт все URL пользователя fromUserID пользователю toUserID
+func (r *MemoryRepository) ReassignUser(fromUserID, toUserID string) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	ids := r.byUser.move(fromUserID, toUserID)
+	for _, id := range ids {
+		u := r.store[id]
+		u.UserID = toUserID
+		r.store[id] = u
+	}
+	if len(ids) > 0 {
+		r.revs.bump(fromUserID, toUserID)
+	}
+	return len(ids), nil
+}
+
+// ClaimURL передаёт URL пользователю userID по хешу токена владения и гасит токен
+func (r *MemoryRepository) ClaimURL(id, tokenHash, userID string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	e, exists := r.store[id]
+	if !exists || e.DeletedFlag || e.ClaimTokenHash == "" || e.ClaimTokenHash != tokenHash {
+		return ErrClaimRejected
+	}
+	r.byUser.remove(e.UserID, id)
+	r.byUser.add(userID, id)
+	r.revs.bump(e.UserID, userID)
+	e.UserID = userID
+	e.ClaimTokenHash = ""
+	r.store[id] = e
+	return nil
+}
+
+// SetNSFW помечает URL как NSFW или снимает пометку
+func (r *MemoryRepository) SetNSFW(id string, nsfw bool) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	e, exists := r.store[id]
+	if !exists {
+		return ErrURLNotFound
+	}
+	e.NSFW = nsfw
+	r.store[id] = e
+	r.revs.bump(e.UserID)
+	return nil
+}
+
+// ReserveIDs резервирует короткие ID за пользователем
+func (r *MemoryRepository) ReserveIDs(ids []string, userID string, createdAt time.Time) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, id := range ids {
+		if _, exists := r.store[id]; exists {
+			return ErrIDExists
+		}
+	}
+
+	if err := r.reserve(len(ids)); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		r.put(models.URL{
+			ShortID:   id,
+			UserID:    userID,
+			CreatedAt: createdAt,
+			Reserved:  true,
+		})
+	}
+	return nil
+}
+
+// ActivateReserved задаёт адрес назначения зарезервированного ID
+func (r *MemoryRepository) ActivateReserved(id, userID, originalURL string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	e, exists := r.store[id]
+	if !exists || !e.Reserved || e.UserID != userID {
+		return ErrNotReserved
+	}
+	if r.dedup {
+		for _, existing := range r.store {
+			if existing.OriginalURL == originalURL {
+				return ErrURLExists
+			}
+		}
+	}
+	e.OriginalURL = originalURL
+	e.Reserved = false
+	r.store[id] = e
+	r.revs.bump(userID)
+	return nil
+}
+
+// GetUserIDsByURL возвращает пользователей, создавших ссылки на originalURL
+func (r *MemoryRepository) GetUserIDsByURL(originalURL string) ([]string, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	owners := make(map[string]struct{})
+	for _, u := range r.store {
+		if u.OriginalURL == originalURL && u.UserID != "" {
+			owners[u.UserID] = struct{}{}
+		}
+	}
+	return sortedUserIDs(owners), nil
+}
+
 // GetStats возвращает статистику сервиса: количество URL и пользователей
 func (r *MemoryRepository) GetStats() (int, int, error) {
 	r.mutex.RLock()
@@ -125,7 +494,7 @@ func (r *MemoryRepository) GetStats() (int, int, error) {
 	userSet := make(map[string]struct{})
 
 	for _, u := range r.store {
-		if !u.DeletedFlag {
+		if !u.DeletedFlag && !u.Reserved {
 			urlCount++
 			if u.UserID != "" {
 				userSet[u.UserID] = struct{}{}
@@ -133,11 +502,135 @@ func (r *MemoryRepository) GetStats() (int, int, error) {
 		}
 	}
 
+	for userID := range r.users {
+		userSet[userID] = struct{}{}
+	}
+
 	return urlCount, len(userSet), nil
 }
 
+// RecordReferrer учитывает переход по id с источника referrer; переход по отсутствующему или удалённому id не учитывается
+func (r *MemoryRepository) RecordReferrer(id, referrer string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if u, exists := r.store[id]; !exists || u.DeletedFlag {
+		return nil
+	}
+	r.refs.record(id, referrer)
+	return nil
+}
+
+// TopReferrers возвращает самые частые источники переходов по ссылкам ids
+func (r *MemoryRepository) TopReferrers(ids []string, limit int) (map[string][]models.ReferrerCount, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.refs.top(ids, limit), nil
+}
+
+// RecordClicks добавляет n переходов по id с меткой ref; переходы по отсутствующему или удалённому id не учитываются
+func (r *MemoryRepository) RecordClicks(id, ref string, n int) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if u, exists := r.store[id]; !exists || u.DeletedFlag {
+		return nil
+	}
+	r.clicks.add(id, ref, n)
+	return nil
+}
+
+// ClickCounts возвращает переходы по меткам для ссылок ids
+func (r *MemoryRepository) ClickCounts(ids []string) (map[string]map[string]int, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.clicks.copyOf(ids), nil
+}
+
+// SaveUser записывает выданного пользователя, если он ещё не записан
+func (r *MemoryRepository) SaveUser(userID string, firstSeen time.Time) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, exists := r.users[userID]; !exists {
+		r.users[userID] = firstSeen
+	}
+	return nil
+}
+
+// Count возвращает количество занятых коротких ID, включая удалённые и зарезервированные
+func (r *MemoryRepository) Count() (int, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return len(r.store), nil
+}
+
+// GetUserStats возвращает статистику использования сервиса пользователем
+// ClicksTotal складывается из переходов, записанных через RecordClicks
+func (r *MemoryRepository) GetUserStats(userID string, now time.Time) (models.UserStats, error) {
+	urls, err := r.GetURLsByUserID(userID)
+	if err != nil {
+		return models.UserStats{}, err
+	}
+	stats := aggregateUserStats(urls, now)
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for _, u := range urls {
+		for _, n := range r.clicks[u.ShortID] {
+			stats.ClicksTotal += n
+		}
+	}
+	return stats, nil
+}
+
+// TopUsers возвращает пользователей с наибольшим числом активных URL
+func (r *MemoryRepository) TopUsers(limit int) ([]models.UserURLCount, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	counts := make(map[string]*models.UserURLCount)
+	for _, u := range r.store {
+		if !u.Reserved {
+			countUser(counts, u.UserID, u.DeletedFlag)
+		}
+	}
+	return rankUsers(counts, limit), nil
+}
+
+// IndexStats возвращает размеры основного хранилища, индекса пользователей и выданных пользователей
+func (r *MemoryRepository) IndexStats() []models.IndexStats {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return []models.IndexStats{
+		mapStats("store", r.store, func(e memoryEntry) int64 {
+			size := int64(unsafe.Sizeof(e)) + int64(len(e.OriginalURL)+len(e.UserID)+len(e.ClaimTokenHash))
+			for _, tag := range e.Tags {
+				size += stringHeaderBytes + int64(len(tag))
+			}
+			return size
+		}),
+		r.byUser.stats("user_index"),
+		mapStats("users", r.users, func(t time.Time) int64 { return int64(unsafe.Sizeof(t)) }),
+		r.refs.stats("referrers"),
+		r.clicks.stats("clicks"),
+	}
+}
+
+// UserRevision возвращает ревизию ссылок пользователя
+func (r *MemoryRepository) UserRevision(userID string) (string, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.revs.revision(userID), true
+}
+
 // Close закрывает ресурсы репозитория (для MemoryRepository ничего не делает)
 func (r *MemoryRepository) Close() error {
 	// MemoryRepository не имеет ресурсов для закрытия
 	return nil
 }
+
+// Name возвращает имя хранилища
+func (r *MemoryRepository) Name() string {
+	return "memory"
+}
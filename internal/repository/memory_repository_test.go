@@ -1,7 +1,10 @@
 package repository
 
 import (
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/tempizhere/goshorty/internal/models"
@@ -17,7 +20,7 @@ func TestMemoryRepository(t *testing.T) {
 	shortID, err := repo.Save("id1", "https://example.com", "user1")
 	assert.NoError(t, err, "Save should not return error")
 	assert.Equal(t, "id1", shortID, "Returned short_id should match")
-	url, exists := repo.Get("id1")
+	url, exists, _ := repo.Get("id1")
 	assert.True(t, exists, "URL should exist")
 	assert.Equal(t, "https://example.com", url.OriginalURL, "URL should match")
 
@@ -25,25 +28,25 @@ func TestMemoryRepository(t *testing.T) {
 	existingID, err := repo.Save("id2", "https://example.com", "user1")
 	assert.ErrorIs(t, err, ErrURLExists, "Expected ErrURLExists for duplicate URL")
 	assert.Equal(t, "id1", existingID, "Should return existing short_id")
-	url, exists = repo.Get("id1")
+	url, exists, _ = repo.Get("id1")
 	assert.True(t, exists, "Original URL should still exist")
 	assert.Equal(t, "https://example.com", url.OriginalURL, "URL should match")
 
 	// Тест 3: Перезапись существующего ID
 	_, err = repo.Save("id1", "https://new-example.com", "user1")
 	assert.NoError(t, err, "Save should not return error for overwrite")
-	url, exists = repo.Get("id1")
+	url, exists, _ = repo.Get("id1")
 	assert.True(t, exists, "URL should still exist")
 	assert.Equal(t, "https://new-example.com", url.OriginalURL, "URL should be updated")
 
 	// Тест 4: Получение несуществующего ID
-	url, exists = repo.Get("id3")
+	url, exists, _ = repo.Get("id3")
 	assert.False(t, exists, "URL should not exist")
 	assert.Equal(t, models.URL{}, url, "Should return empty URL struct")
 
 	// Тест 5: Очистка хранилища
 	repo.Clear()
-	_, exists = repo.Get("id1")
+	_, exists, _ = repo.Get("id1")
 	assert.False(t, exists, "URL should be cleared")
 }
 
@@ -51,33 +54,223 @@ func TestMemoryRepository_BatchSave(t *testing.T) {
 	repo := NewMemoryRepository()
 
 	// Тест 1: Успешное пакетное сохранение
-	urls := map[string]string{
-		"id1": "https://example1.com",
-		"id2": "https://example2.com",
-		"id3": "https://example3.com",
+	items := []models.BatchItem{
+		{ShortID: "id1", OriginalURL: "https://example1.com"},
+		{ShortID: "id2", OriginalURL: "https://example2.com"},
+		{ShortID: "id3", OriginalURL: "https://example3.com"},
 	}
-	err := repo.BatchSave(urls, "user1")
+	err := repo.BatchSave(items, "user1")
 	assert.NoError(t, err, "BatchSave should succeed")
 
 	// Проверяем, что все URL сохранены
-	for id, expectedURL := range urls {
-		url, exists := repo.Get(id)
+	for _, item := range items {
+		url, exists, _ := repo.Get(item.ShortID)
 		assert.True(t, exists, "URL should exist")
-		assert.Equal(t, expectedURL, url.OriginalURL, "URL should match")
+		assert.Equal(t, item.OriginalURL, url.OriginalURL, "URL should match")
 		assert.Equal(t, "user1", url.UserID, "UserID should match")
 	}
 
 	// Тест 2: Попытка пакетного сохранения с дублирующимся URL
-	duplicateURLs := map[string]string{
-		"id4": "https://example1.com", // Дублирующийся URL
-		"id5": "https://example4.com",
+	duplicateURLs := []models.BatchItem{
+		{ShortID: "id4", OriginalURL: "https://example1.com"}, // Дублирующийся URL
+		{ShortID: "id5", OriginalURL: "https://example4.com"},
 	}
 	err = repo.BatchSave(duplicateURLs, "user1")
 	assert.ErrorIs(t, err, ErrURLExists, "Expected ErrURLExists for duplicate URL")
 
 	// Проверяем, что новые URL не были добавлены
-	_, exists := repo.Get("id4")
+	_, exists, _ := repo.Get("id4")
 	assert.False(t, exists, "Duplicate URL should not be saved")
+
+	// Тест 3: Повтор ID внутри пакета
+	repeated := []models.BatchItem{
+		{ShortID: "id6", OriginalURL: "https://example6.com"},
+		{ShortID: "id6", OriginalURL: "https://example7.com"},
+	}
+	assert.ErrorIs(t, repo.BatchSave(repeated, "user1"), ErrIDExists)
+	_, exists, _ = repo.Get("id6")
+	assert.False(t, exists, "Batch with repeated ID should not be saved")
+}
+
+func TestMemoryRepository_BatchSaveConcurrentIDCollision(t *testing.T) {
+	repo := NewMemoryRepository()
+
+	// Два пакета претендуют на одни и те же ID
+	batches := make([][]models.BatchItem, 2)
+	for i := 0; i < 50; i++ {
+		id := fmt.Sprintf("id%d", i)
+		batches[0] = append(batches[0], models.BatchItem{ShortID: id, OriginalURL: fmt.Sprintf("https://first.example.com/%d", i)})
+		batches[1] = append(batches[1], models.BatchItem{ShortID: id, OriginalURL: fmt.Sprintf("https://second.example.com/%d", i)})
+	}
+
+	errs := make([]error, len(batches))
+	var wg sync.WaitGroup
+	for i := range batches {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = repo.BatchSave(batches[i], fmt.Sprintf("user%d", i))
+		}(i)
+	}
+	wg.Wait()
+
+	// Ровно один пакет сохраняется, второй получает ErrIDExists без перезаписи
+	winner := -1
+	for i, err := range errs {
+		if err == nil {
+			assert.Equal(t, -1, winner, "Only one batch should succeed")
+			winner = i
+		} else {
+			assert.ErrorIs(t, err, ErrIDExists)
+		}
+	}
+	assert.NotEqual(t, -1, winner, "One batch should succeed")
+	if winner == -1 {
+		return
+	}
+	for _, item := range batches[winner] {
+		u, exists, _ := repo.Get(item.ShortID)
+		assert.True(t, exists)
+		assert.Equal(t, item.OriginalURL, u.OriginalURL, "Stored URL must not be overwritten")
+	}
+}
+
+func TestMemoryRepository_DisableReverseIndex(t *testing.T) {
+	repo := NewMemoryRepository(DisableReverseIndex())
+
+	// Без дедупликации повторный URL сохраняется под новым ID
+	id, err := repo.Save("id1", "https://example.com", "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, "id1", id)
+	id, err = repo.Save("id2", "https://example.com", "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, "id2", id)
+	assert.NoError(t, repo.BatchSave([]models.BatchItem{{ShortID: "id3", OriginalURL: "https://example.com"}}, "user1"))
+	assert.ErrorIs(t, repo.BatchSave([]models.BatchItem{{ShortID: "id1", OriginalURL: "https://other.com"}}, "user1"), ErrIDExists)
+
+	urls, err := repo.GetURLsByUserID("user1")
+	assert.NoError(t, err)
+	assert.Len(t, urls, 3)
+}
+
+func TestMemoryRepository_MaxURLsReject(t *testing.T) {
+	repo := NewMemoryRepository(WithMaxURLs(2, ""))
+
+	_, err := repo.Save("id1", "https://a.com", "user1")
+	assert.NoError(t, err)
+	_, err = repo.Save("id2", "https://b.com", "user1")
+	assert.NoError(t, err)
+
+	// На границе лимита новые записи отклоняются, существующие не затрагиваются
+	_, err = repo.Save("id3", "https://c.com", "user1")
+	assert.ErrorIs(t, err, ErrStorageFull)
+	assert.ErrorIs(t, repo.BatchSave([]models.BatchItem{{ShortID: "id4", OriginalURL: "https://d.com"}}, "user1"), ErrStorageFull)
+	_, exists, _ := repo.Get("id3")
+	assert.False(t, exists)
+	for _, id := range []string{"id1", "id2"} {
+		_, exists, _ := repo.Get(id)
+		assert.True(t, exists, "URL %s should be kept", id)
+	}
+
+	// Повтор существующего URL по-прежнему возвращает ErrURLExists
+	id, err := repo.Save("id5", "https://a.com", "user1")
+	assert.ErrorIs(t, err, ErrURLExists)
+	assert.Equal(t, "id1", id)
+
+	// После очистки место снова доступно
+	repo.Clear()
+	assert.NoError(t, repo.BatchSave([]models.BatchItem{{ShortID: "id1", OriginalURL: "https://a.com"}, {ShortID: "id2", OriginalURL: "https://b.com"}}, "user1"))
+}
+
+func TestMemoryRepository_MaxURLsLRU(t *testing.T) {
+	repo := NewMemoryRepository(WithMaxURLs(3, EvictionLRU))
+	before := memoryEvictions.Value()
+
+	for i := 1; i <= 3; i++ {
+		_, err := repo.Save(fmt.Sprintf("id%d", i), fmt.Sprintf("https://example.com/%d", i), "user1")
+		assert.NoError(t, err)
+	}
+
+	// id1 и id3 запрашивались, поэтому вытесняется id2
+	repo.Get("id1")
+	repo.Get("id3")
+	_, err := repo.Save("id4", "https://example.com/4", "user1")
+	assert.NoError(t, err)
+	_, exists, _ := repo.Get("id2")
+	assert.False(t, exists, "Least recently accessed URL should be evicted")
+	for _, id := range []string{"id1", "id3", "id4"} {
+		_, exists, _ := repo.Get(id)
+		assert.True(t, exists, "URL %s should be kept", id)
+	}
+	assert.Equal(t, before+1, memoryEvictions.Value())
+
+	// Удалённые записи вытесняются в первую очередь, даже если к ним обращались
+	assert.NoError(t, repo.BatchDelete("user1", []string{"id3"}))
+	repo.Get("id3")
+	assert.NoError(t, repo.BatchSave([]models.BatchItem{{ShortID: "id5", OriginalURL: "https://example.com/5"}}, "user1"))
+	_, exists, _ = repo.Get("id3")
+	assert.False(t, exists, "Deleted URL should be evicted first")
+	assert.Equal(t, before+2, memoryEvictions.Value())
+
+	// Пакет больше лимита не помещается даже с вытеснением
+	batch := []models.BatchItem{
+		{ShortID: "b1", OriginalURL: "https://b.com/1"},
+		{ShortID: "b2", OriginalURL: "https://b.com/2"},
+		{ShortID: "b3", OriginalURL: "https://b.com/3"},
+		{ShortID: "b4", OriginalURL: "https://b.com/4"},
+	}
+	assert.ErrorIs(t, repo.BatchSave(batch, "user1"), ErrStorageFull)
+
+	// Пакет в пределах лимита вытесняет нужное число записей
+	batch = batch[:3]
+	assert.NoError(t, repo.BatchSave(batch, "user1"))
+	urls, err := repo.GetURLsByUserID("user1")
+	assert.NoError(t, err)
+	assert.Len(t, urls, 3)
+	for _, item := range batch {
+		_, exists, _ := repo.Get(item.ShortID)
+		assert.True(t, exists, "Batch URL %s should be stored", item.ShortID)
+	}
+}
+
+func TestMemoryRepository_MaxURLsLRUConcurrent(t *testing.T) {
+	const maxURLs = 50
+	repo := NewMemoryRepository(WithMaxURLs(maxURLs, EvictionLRU))
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				id := fmt.Sprintf("w%d-%d", w, i)
+				_, err := repo.Save(id, "https://example.com/"+id, "user1")
+				assert.NoError(t, err)
+				repo.Get(id)
+				repo.Get(fmt.Sprintf("w%d-%d", (w+1)%4, i))
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	count, _, err := repo.GetStats()
+	assert.NoError(t, err)
+	assert.Equal(t, maxURLs, count, "Storage should stay at the limit")
+}
+
+func TestMemoryRepository_BatchGet(t *testing.T) {
+	repo := NewMemoryRepository()
+
+	_, err := repo.Save("id1", "https://example1.com", "user1")
+	assert.NoError(t, err)
+	_, err = repo.Save("id2", "https://example2.com", "user1")
+	assert.NoError(t, err)
+
+	urls, err := repo.BatchGet([]string{"id1", "unknown", "id2"})
+	assert.NoError(t, err)
+	assert.Len(t, urls, 2, "Should return only existing URLs")
+	assert.Equal(t, "https://example1.com", urls["id1"].OriginalURL)
+	assert.Equal(t, "https://example2.com", urls["id2"].OriginalURL)
 }
 
 func TestMemoryRepository_GetURLsByUserID(t *testing.T) {
@@ -116,6 +309,30 @@ func TestMemoryRepository_GetURLsByUserID(t *testing.T) {
 	assert.Len(t, urls, 0, "Should return empty slice for non-existent user")
 }
 
+func TestMemoryRepository_GetURLsByUserAndTag(t *testing.T) {
+	repo := NewMemoryRepository()
+
+	// Сохраняем URL с метками для разных пользователей
+	_, err := repo.SaveURL(models.URL{ShortID: "id1", OriginalURL: "https://example1.com", UserID: "user1", Tags: []string{"work", "docs"}})
+	assert.NoError(t, err)
+	_, err = repo.SaveURL(models.URL{ShortID: "id2", OriginalURL: "https://example2.com", UserID: "user1", Tags: []string{"personal"}})
+	assert.NoError(t, err)
+	_, err = repo.SaveURL(models.URL{ShortID: "id3", OriginalURL: "https://example3.com", UserID: "user2", Tags: []string{"work"}})
+	assert.NoError(t, err)
+
+	// Тест 1: Фильтрация по метке учитывает пользователя
+	urls, err := repo.GetURLsByUserAndTag("user1", "work")
+	assert.NoError(t, err)
+	assert.Len(t, urls, 1, "Should return only user1 URLs tagged work")
+	assert.Equal(t, "id1", urls[0].ShortID)
+	assert.Equal(t, []string{"work", "docs"}, urls[0].Tags)
+
+	// Тест 2: Метка, которой нет у пользователя
+	urls, err = repo.GetURLsByUserAndTag("user2", "personal")
+	assert.NoError(t, err)
+	assert.Len(t, urls, 0, "Should return empty result for unknown tag")
+}
+
 func TestMemoryRepository_BatchDelete(t *testing.T) {
 	repo := NewMemoryRepository()
 
@@ -134,21 +351,21 @@ func TestMemoryRepository_BatchDelete(t *testing.T) {
 	assert.NoError(t, err, "BatchDelete should succeed")
 
 	// Проверяем, что URL помечены как удалённые
-	url, exists := repo.Get("id1")
+	url, exists, _ := repo.Get("id1")
 	assert.True(t, exists, "URL should still exist")
 	assert.True(t, url.DeletedFlag, "URL should be marked as deleted")
 
-	url, exists = repo.Get("id2")
+	url, exists, _ = repo.Get("id2")
 	assert.True(t, exists, "URL should still exist")
 	assert.True(t, url.DeletedFlag, "URL should be marked as deleted")
 
 	// Проверяем, что id3 не затронут
-	url, exists = repo.Get("id3")
+	url, exists, _ = repo.Get("id3")
 	assert.True(t, exists, "URL should still exist")
 	assert.False(t, url.DeletedFlag, "URL should not be marked as deleted")
 
 	// Проверяем, что URL другого пользователя не затронут
-	url, exists = repo.Get("id4")
+	url, exists, _ = repo.Get("id4")
 	assert.True(t, exists, "URL should still exist")
 	assert.False(t, url.DeletedFlag, "URL should not be marked as deleted")
 
@@ -161,11 +378,129 @@ func TestMemoryRepository_BatchDelete(t *testing.T) {
 	assert.NoError(t, err, "BatchDelete should succeed")
 
 	// Проверяем, что URL другого пользователя не затронут
-	url, exists = repo.Get("id4")
+	url, exists, _ = repo.Get("id4")
 	assert.True(t, exists, "URL should still exist")
 	assert.False(t, url.DeletedFlag, "URL should not be marked as deleted")
 }
 
+func TestMemoryRepository_DeleteByUserAndHost(t *testing.T) {
+	repo := NewMemoryRepository()
+
+	for id, u := range map[string][2]string{
+		"id1": {"https://old.example.com/a", "user1"},
+		"id2": {"http://OLD.example.com:8080/b?x=1", "user1"},
+		"id3": {"https://sub.old.example.com/c", "user1"},
+		"id4": {"https://new.example.com/d", "user1"},
+		"id5": {"https://old.example.com/e", "user2"},
+	} {
+		_, err := repo.Save(id, u[0], u[1])
+		assert.NoError(t, err)
+	}
+
+	deleted, err := repo.DeleteByUserAndHost("user1", "old.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+
+	for id, wantDeleted := range map[string]bool{"id1": true, "id2": true, "id3": false, "id4": false, "id5": false} {
+		u, exists, _ := repo.Get(id)
+		assert.True(t, exists)
+		assert.Equal(t, wantDeleted, u.DeletedFlag, id)
+	}
+
+	// Повторное удаление не учитывает уже удалённые URL
+	deleted, err = repo.DeleteByUserAndHost("user1", "old.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+}
+
+func TestMemoryRepository_ReassignUser(t *testing.T) {
+	repo := NewMemoryRepository()
+	_, err := repo.Save("id1", "https://example.com/1", "old")
+	assert.NoError(t, err)
+	_, err = repo.Save("id2", "https://example.com/2", "old")
+	assert.NoError(t, err)
+	_, err = repo.Save("id3", "https://example.com/3", "other")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.BatchDelete("old", []string{"id2"}))
+
+	moved, err := repo.ReassignUser("old", "new")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, moved, "Deleted URLs should be reassigned too")
+
+	urls, err := repo.GetURLsByUserID("old")
+	assert.NoError(t, err)
+	assert.Empty(t, urls)
+	urls, err = repo.GetURLsByUserID("new")
+	assert.NoError(t, err)
+	assert.Len(t, urls, 2)
+	u, _, _ := repo.Get("id2")
+	assert.True(t, u.DeletedFlag)
+	u, _, _ = repo.Get("id3")
+	assert.Equal(t, "other", u.UserID)
+}
+
+func TestMemoryRepository_ClaimURL(t *testing.T) {
+	repo := NewMemoryRepository()
+	_, err := repo.SaveURL(models.URL{ShortID: "id1", OriginalURL: "https://example.com/1", UserID: "anon", ClaimTokenHash: "hash"})
+	assert.NoError(t, err)
+	_, err = repo.Save("id2", "https://example.com/2", "anon")
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, repo.ClaimURL("id1", "other", "new"), ErrClaimRejected)
+	assert.ErrorIs(t, repo.ClaimURL("id2", "", "new"), ErrClaimRejected, "URL without token cannot be claimed")
+	assert.ErrorIs(t, repo.ClaimURL("missing", "hash", "new"), ErrClaimRejected)
+
+	assert.NoError(t, repo.ClaimURL("id1", "hash", "new"))
+	u, _, _ := repo.Get("id1")
+	assert.Equal(t, "new", u.UserID)
+	assert.Empty(t, u.ClaimTokenHash)
+	assert.ErrorIs(t, repo.ClaimURL("id1", "hash", "third"), ErrClaimRejected, "Token must be single-use")
+}
+
+func TestMemoryRepository_SetNSFW(t *testing.T) {
+	repo := NewMemoryRepository()
+	_, err := repo.Save("id1", "https://example.com/1", "user1")
+	assert.NoError(t, err)
+
+	assert.NoError(t, repo.SetNSFW("id1", true))
+	u, _, _ := repo.Get("id1")
+	assert.True(t, u.NSFW)
+	assert.NoError(t, repo.SetNSFW("id1", false))
+	u, _, _ = repo.Get("id1")
+	assert.False(t, u.NSFW)
+	assert.ErrorIs(t, repo.SetNSFW("missing", true), ErrURLNotFound)
+}
+
+func TestMemoryRepository_TopUsers(t *testing.T) {
+	repo := NewMemoryRepository()
+
+	for id, userID := range map[string]string{
+		"id1": "carol", "id2": "carol", "id3": "carol",
+		"id4": "bob", "id5": "bob",
+		"id6": "alice", "id7": "alice", "id8": "alice",
+		"id9": "dave", "id10": "",
+	} {
+		_, err := repo.Save(id, "https://example.com/"+id, userID)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, repo.BatchDelete("alice", []string{"id6"}))
+
+	users, err := repo.TopUsers(10)
+	assert.NoError(t, err)
+	// carol и bob делят второе место по активным URL и упорядочены по user_id; URL без пользователя не учитываются
+	assert.Equal(t, []models.UserURLCount{
+		{UserID: "carol", URLs: 3},
+		{UserID: "alice", URLs: 2, Deleted: 1},
+		{UserID: "bob", URLs: 2},
+		{UserID: "dave", URLs: 1},
+	}, users)
+
+	users, err = repo.TopUsers(2)
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
+	assert.Equal(t, "alice", users[1].UserID)
+}
+
 func TestMemoryRepository_Close(t *testing.T) {
 	repo := NewMemoryRepository()
 
@@ -180,7 +515,96 @@ func TestMemoryRepository_Close(t *testing.T) {
 	assert.NoError(t, err, "Close should not return error")
 
 	// Проверяем, что данные все еще доступны после Close (MemoryRepository не очищает данные)
-	url, exists := repo.Get("id1")
+	url, exists, _ := repo.Get("id1")
 	assert.True(t, exists, "URL should still exist after Close")
 	assert.Equal(t, "https://example1.com", url.OriginalURL)
 }
+
+func TestMemoryRepository_SaveUser(t *testing.T) {
+	repo := NewMemoryRepository()
+	_, err := repo.Save("id1", "https://example.com", "user1")
+	assert.NoError(t, err)
+
+	firstSeen := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	assert.NoError(t, repo.SaveUser("user1", firstSeen))
+	assert.NoError(t, repo.SaveUser("user2", firstSeen))
+	assert.NoError(t, repo.SaveUser("user2", firstSeen.Add(time.Hour)))
+	assert.Equal(t, firstSeen, repo.users["user2"], "first-seen time must not be overwritten")
+
+	// Владелец ссылки и записанный пользователь без ссылок учитываются по одному разу
+	urlCount, userCount, err := repo.GetStats()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, urlCount)
+	assert.Equal(t, 2, userCount)
+
+	repo.Clear()
+	_, userCount, err = repo.GetStats()
+	assert.NoError(t, err)
+	assert.Zero(t, userCount)
+}
+
+func TestMemoryRepository_UserStatsClock(t *testing.T) {
+	repo := NewMemoryRepository()
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Время создания и окно статистики задаёт вызывающий, а не часы хранилища
+	assert.NoError(t, repo.BatchSave([]models.BatchItem{{ShortID: "id1", OriginalURL: "https://example.com/1", CreatedAt: created}}, "user1"))
+	assert.NoError(t, repo.ReserveIDs([]string{"r1"}, "user1", created))
+	u, _, _ := repo.Get("id1")
+	assert.Equal(t, created, u.CreatedAt)
+	u, _, _ = repo.Get("r1")
+	assert.Equal(t, created, u.CreatedAt)
+
+	stats, err := repo.GetUserStats("user1", created.Add(24*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats.CreatedLast30d)
+	stats, err = repo.GetUserStats("user1", created.Add(userStatsWindow+time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stats.CreatedLast30d)
+}
+
+func TestMemoryRepository_ReserveIDs(t *testing.T) {
+	repo := NewMemoryRepository()
+	_, err := repo.Save("taken", "https://example.com/taken", "user1")
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, repo.ReserveIDs([]string{"r1", "taken"}, "printer", time.Now()), ErrIDExists)
+	_, exists, _ := repo.Get("r1")
+	assert.False(t, exists)
+
+	assert.NoError(t, repo.ReserveIDs([]string{"r1", "r2"}, "printer", time.Now()))
+	u, exists, _ := repo.Get("r1")
+	assert.True(t, exists)
+	assert.True(t, u.Reserved)
+	assert.Empty(t, u.OriginalURL)
+
+	// Зарезервированные коды не учитываются в статистике и списках пользователя
+	urlCount, userCount, err := repo.GetStats()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, urlCount)
+	assert.Equal(t, 1, userCount)
+	urls, err := repo.GetURLsByUserID("printer")
+	assert.NoError(t, err)
+	assert.Empty(t, urls)
+	top, err := repo.TopUsers(10)
+	assert.NoError(t, err)
+	assert.Len(t, top, 1)
+	// Но занимают пространство коротких ID
+	count, err := repo.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	assert.ErrorIs(t, repo.ActivateReserved("r1", "stranger", "https://example.com/r1"), ErrNotReserved)
+	assert.ErrorIs(t, repo.ActivateReserved("taken", "user1", "https://example.com/r1"), ErrNotReserved)
+	assert.ErrorIs(t, repo.ActivateReserved("r1", "printer", "https://example.com/taken"), ErrURLExists)
+	assert.NoError(t, repo.ActivateReserved("r1", "printer", "https://example.com/r1"))
+	assert.ErrorIs(t, repo.ActivateReserved("r1", "printer", "https://example.com/again"), ErrNotReserved)
+
+	u, _, _ = repo.Get("r1")
+	assert.False(t, u.Reserved)
+	assert.Equal(t, "https://example.com/r1", u.OriginalURL)
+	assert.Equal(t, "printer", u.UserID)
+	urlCount, _, err = repo.GetStats()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, urlCount)
+}
@@ -0,0 +1,325 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/tempizhere/goshorty/internal/models"
+	"go.uber.org/zap"
+)
+
+// DefaultOfflineRetryInterval — как часто OfflineRepository по умолчанию пробует подключиться к основному хранилищу
+const DefaultOfflineRetryInterval = 5 * time.Second
+
+// OfflineRepository заменяет хранилище, к которому не удалось подключиться при старте
+// Пока подключения нет, все операции завершаются ErrUnavailable; вместе со SnapshotRepository позволяет обслуживать
+// редиректы из снимка, пока база недоступна. Run периодически пробует подключиться, и после успеха
+// все операции выполняются в основном хранилище
+type OfflineRepository struct {
+	name    string
+	cause   error
+	mu      sync.RWMutex
+	primary Repository // Основное хранилище после восстановления; nil — хранилище недоступно
+}
+
+// NewOfflineRepository создаёт недоступное хранилище с именем name; cause — причина недоступности
+func NewOfflineRepository(name string, cause error) *OfflineRepository {
+	return &OfflineRepository{name: name, cause: cause}
+}
+
+// err возвращает ошибку недоступности с причиной
+func (r *OfflineRepository) err() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return fmt.Errorf("%w: %v", ErrUnavailable, r.cause)
+}
+
+// next возвращает основное хранилище, если подключение восстановлено
+func (r *OfflineRepository) next() Repository {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.primary
+}
+
+// Online сообщает, восстановлено ли подключение к основному хранилищу
+func (r *OfflineRepository) Online() bool {
+	return r.next() != nil
+}
+
+// reconnect пробует подключиться к основному хранилищу через connect
+// Хранилище, сообщающее о несогласованных данных (Healthy), не принимается и закрывается
+func (r *OfflineRepository) reconnect(connect func() (Repository, error)) error {
+	primary, err := connect()
+	if err != nil {
+		return err
+	}
+	if checker, ok := primary.(interface{ Healthy() bool }); ok && !checker.Healthy() {
+		_ = primary.Close()
+		return fmt.Errorf("%s storage is not healthy", r.name)
+	}
+	r.mu.Lock()
+	r.primary = primary
+	r.mu.Unlock()
+	return nil
+}
+
+// Run раз в interval пробует подключиться к основному хранилищу через connect, пока не подключится или не отменится ctx
+// Возвращает true, если подключение восстановлено
+func (r *OfflineRepository) Run(ctx context.Context, interval time.Duration, connect func() (Repository, error), logger *zap.Logger) bool {
+	if interval <= 0 {
+		return false
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+			err := r.reconnect(connect)
+			if err == nil {
+				logger.Info("Storage is available again, leaving offline mode", zap.String("storage", r.name), zap.Int("attempts", attempt))
+				return true
+			}
+			r.mu.Lock()
+			r.cause = err
+			r.mu.Unlock()
+			logger.Warn("Storage is still unavailable", zap.String("storage", r.name), zap.Int("attempts", attempt), zap.Error(err))
+		}
+	}
+}
+
+// Save выполняется в основном хранилище или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) Save(id, url, userID string) (string, error) {
+	if next := r.next(); next != nil {
+		return next.Save(id, url, userID)
+	}
+	return "", r.err()
+}
+
+// SaveURL выполняется в основном хранилище или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) SaveURL(u models.URL) (string, error) {
+	if next := r.next(); next != nil {
+		return next.SaveURL(u)
+	}
+	return "", r.err()
+}
+
+// Get выполняется в основном хранилище или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) Get(id string) (models.URL, bool, error) {
+	if next := r.next(); next != nil {
+		return next.Get(id)
+	}
+	return models.URL{}, false, r.err()
+}
+
+// BatchGet выполняется в основном хранилище или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) BatchGet(ids []string) (map[string]models.URL, error) {
+	if next := r.next(); next != nil {
+		return next.BatchGet(ids)
+	}
+	return nil, r.err()
+}
+
+// Clear очищает основное хранилище, если подключение восстановлено
+func (r *OfflineRepository) Clear() {
+	if next := r.next(); next != nil {
+		next.Clear()
+	}
+}
+
+// BatchSave выполняется в основном хранилище или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) BatchSave(items []models.BatchItem, userID string) error {
+	if next := r.next(); next != nil {
+		return next.BatchSave(items, userID)
+	}
+	return r.err()
+}
+
+// GetURLsByUserID выполняется в основном хранилище или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) GetURLsByUserID(userID string) ([]models.URL, error) {
+	if next := r.next(); next != nil {
+		return next.GetURLsByUserID(userID)
+	}
+	return nil, r.err()
+}
+
+// GetURLsByUserAndTag выполняется в основном хранилище или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) GetURLsByUserAndTag(userID, tag string) ([]models.URL, error) {
+	if next := r.next(); next != nil {
+		return next.GetURLsByUserAndTag(userID, tag)
+	}
+	return nil, r.err()
+}
+
+// BatchDelete выполняется в основном хранилище или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) BatchDelete(userID string, ids []string) error {
+	if next := r.next(); next != nil {
+		return next.BatchDelete(userID, ids)
+	}
+	return r.err()
+}
+
+// DeleteByUserAndHost выполняется в основном хранилище или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) DeleteByUserAndHost(userID, host string) (int, error) {
+	if next := r.next(); next != nil {
+		return next.DeleteByUserAndHost(userID, host)
+	}
+	return 0, r.err()
+}
+
+// ReassignUser выполняется в основном хранилище или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) ReassignUser(fromUserID, toUserID string) (int, error) {
+	if next := r.next(); next != nil {
+		return next.ReassignUser(fromUserID, toUserID)
+	}
+	return 0, r.err()
+}
+
+// ClaimURL выполняется в основном хранилище или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) ClaimURL(id, tokenHash, userID string) error {
+	if next := r.next(); next != nil {
+		return next.ClaimURL(id, tokenHash, userID)
+	}
+	return r.err()
+}
+
+// SetNSFW выполняется в основном хранилище или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) SetNSFW(id string, nsfw bool) error {
+	if next := r.next(); next != nil {
+		return next.SetNSFW(id, nsfw)
+	}
+	return r.err()
+}
+
+// ReserveIDs выполняется в основном хранилище или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) ReserveIDs(ids []string, userID string, createdAt time.Time) error {
+	if next := r.next(); next != nil {
+		return next.ReserveIDs(ids, userID, createdAt)
+	}
+	return r.err()
+}
+
+// ActivateReserved выполняется в основном хранилище или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) ActivateReserved(id, userID, originalURL string) error {
+	if next := r.next(); next != nil {
+		return next.ActivateReserved(id, userID, originalURL)
+	}
+	return r.err()
+}
+
+// GetUserIDsByURL выполняется в основном хранилище или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) GetUserIDsByURL(originalURL string) ([]string, error) {
+	if next := r.next(); next != nil {
+		return next.GetUserIDsByURL(originalURL)
+	}
+	return nil, r.err()
+}
+
+// SaveUser выполняется в основном хранилище или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) SaveUser(userID string, firstSeen time.Time) error {
+	if next := r.next(); next != nil {
+		return next.SaveUser(userID, firstSeen)
+	}
+	return r.err()
+}
+
+// Count выполняется в основном хранилище или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) Count() (int, error) {
+	if next := r.next(); next != nil {
+		return next.Count()
+	}
+	return 0, r.err()
+}
+
+// GetStats выполняется в основном хранилище или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) GetStats() (int, int, error) {
+	if next := r.next(); next != nil {
+		return next.GetStats()
+	}
+	return 0, 0, r.err()
+}
+
+// GetUserStats выполняется в основном хранилище или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) GetUserStats(userID string, now time.Time) (models.UserStats, error) {
+	if next := r.next(); next != nil {
+		return next.GetUserStats(userID, now)
+	}
+	return models.UserStats{}, r.err()
+}
+
+// TopUsers выполняется в основном хранилище или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) TopUsers(limit int) ([]models.UserURLCount, error) {
+	if next := r.next(); next != nil {
+		return next.TopUsers(limit)
+	}
+	return nil, r.err()
+}
+
+// Close закрывает основное хранилище, если подключение восстановлено
+func (r *OfflineRepository) Close() error {
+	if next := r.next(); next != nil {
+		return next.Close()
+	}
+	return nil
+}
+
+// Name возвращает имя недоступного хранилища
+func (r *OfflineRepository) Name() string {
+	return r.name
+}
+
+// List перечисляет URL основного хранилища или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) List(ctx context.Context, fn func(models.URL) error) error {
+	next := r.next()
+	if next == nil {
+		return r.err()
+	}
+	lister, ok := next.(URLLister)
+	if !ok {
+		return ErrListUnsupported
+	}
+	return lister.List(ctx, fn)
+}
+
+// UserRevision возвращает ревизию ссылок пользователя в основном хранилище; пока оно недоступно — ревизии нет
+func (r *OfflineRepository) UserRevision(userID string) (string, bool) {
+	if next := r.next(); next != nil {
+		return userRevisionOf(next, userID)
+	}
+	return "", false
+}
+
+// RecordReferrer учитывает источник перехода в основном хранилище или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) RecordReferrer(id, referrer string) error {
+	if next := r.next(); next != nil {
+		return recordReferrerIn(next, id, referrer)
+	}
+	return r.err()
+}
+
+// TopReferrers возвращает источники переходов из основного хранилища или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) TopReferrers(ids []string, limit int) (map[string][]models.ReferrerCount, error) {
+	if next := r.next(); next != nil {
+		return topReferrersOf(next, ids, limit)
+	}
+	return nil, r.err()
+}
+
+// RecordClicks учитывает переходы в основном хранилище или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) RecordClicks(id, ref string, n int) error {
+	if next := r.next(); next != nil {
+		return recordClicksIn(next, id, ref, n)
+	}
+	return r.err()
+}
+
+// ClickCounts возвращает переходы из основного хранилища или завершается ErrUnavailable, пока оно недоступно
+func (r *OfflineRepository) ClickCounts(ids []string) (map[string]map[string]int, error) {
+	if next := r.next(); next != nil {
+		return clickCountsOf(next, ids)
+	}
+	return nil, r.err()
+}
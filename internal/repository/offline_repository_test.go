@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/models"
+	"go.uber.org/zap"
+)
+
+// unhealthyRepository — хранилище, сообщающее о несогласованных данных
+type unhealthyRepository struct {
+	*MemoryRepository
+}
+
+func (r unhealthyRepository) Healthy() bool {
+	return false
+}
+
+func TestOfflineRepository_Recovery(t *testing.T) {
+	repo := NewOfflineRepository("postgres", errors.New("connection refused"))
+	_, _, err := repo.Get("id1")
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.False(t, repo.Online())
+
+	primary := NewMemoryRepository()
+	_, err = primary.Save("id1", "https://example.com", "user1")
+	assert.NoError(t, err)
+
+	var attempts atomic.Int32
+	connect := func() (Repository, error) {
+		switch attempts.Add(1) {
+		case 1:
+			return nil, errors.New("still refused")
+		case 2:
+			return unhealthyRepository{NewMemoryRepository()}, nil
+		default:
+			return primary, nil
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.True(t, repo.Run(ctx, time.Millisecond, connect, zap.NewNop()))
+	assert.Equal(t, int32(3), attempts.Load())
+	assert.True(t, repo.Online())
+
+	// После восстановления операции выполняются в основном хранилище
+	u, found, err := repo.Get("id1")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "https://example.com", u.OriginalURL)
+
+	_, err = repo.Save("id2", "https://example.com/2", "user1")
+	assert.NoError(t, err)
+	_, found, err = primary.Get("id2")
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	// Снимок после восстановления перечисляет URL основного хранилища
+	var listed []string
+	assert.NoError(t, repo.List(ctx, func(u models.URL) error {
+		listed = append(listed, u.ShortID)
+		return nil
+	}))
+	assert.ElementsMatch(t, []string{"id1", "id2"}, listed)
+}
+
+func TestOfflineRepository_RunCanceled(t *testing.T) {
+	repo := NewOfflineRepository("postgres", errors.New("connection refused"))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, repo.Run(ctx, time.Millisecond, func() (Repository, error) {
+		return nil, errors.New("refused")
+	}, zap.NewNop()))
+	assert.False(t, repo.Online())
+}
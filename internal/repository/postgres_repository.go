@@ -1,13 +1,22 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/tempizhere/goshorty/internal/models"
 	"go.uber.org/zap"
 )
 
+// uniqueViolationCode — код ошибки PostgreSQL при нарушении ограничения уникальности
+const uniqueViolationCode = "23505"
+
 // PostgresRepository реализует интерфейс Repository с использованием PostgreSQL
 type PostgresRepository struct {
 	db     Database
@@ -38,11 +47,78 @@ func NewPostgresRepository(db Database, logger *zap.Logger) (*PostgresRepository
 		return nil, err
 	}
 
+	// Добавляем столбец tags, если он не существует
+	_, err = db.Exec("ALTER TABLE urls ADD COLUMN IF NOT EXISTS tags JSONB")
+	if err != nil {
+		logger.Error("Failed to add tags column", zap.Error(err))
+		return nil, err
+	}
+
+	// Добавляем столбец claim_token_hash, если он не существует
+	_, err = db.Exec("ALTER TABLE urls ADD COLUMN IF NOT EXISTS claim_token_hash VARCHAR(64)")
+	if err != nil {
+		logger.Error("Failed to add claim_token_hash column", zap.Error(err))
+		return nil, err
+	}
+
+	// Добавляем столбец nsfw, если он не существует
+	_, err = db.Exec("ALTER TABLE urls ADD COLUMN IF NOT EXISTS nsfw BOOLEAN DEFAULT FALSE")
+	if err != nil {
+		logger.Error("Failed to add nsfw column", zap.Error(err))
+		return nil, err
+	}
+
+	// Добавляем столбец description, если он не существует
+	_, err = db.Exec("ALTER TABLE urls ADD COLUMN IF NOT EXISTS description TEXT")
+	if err != nil {
+		logger.Error("Failed to add description column", zap.Error(err))
+		return nil, err
+	}
+
+	// Зарезервированные коды ещё без адреса назначения; в urls строка появляется при активации
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS url_reservations (short_id VARCHAR(10) PRIMARY KEY, user_id VARCHAR, created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)")
+	if err != nil {
+		logger.Error("Failed to create url_reservations table", zap.Error(err))
+		return nil, err
+	}
+
+	// Выданные пользователи, ещё не создавшие ни одной ссылки
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS users (user_id VARCHAR PRIMARY KEY, first_seen TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)")
+	if err != nil {
+		logger.Error("Failed to create users table", zap.Error(err))
+		return nil, err
+	}
+
+	// Переходы по ссылкам, сгруппированные по источнику
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS url_referrers (short_id VARCHAR NOT NULL, referrer VARCHAR NOT NULL, clicks BIGINT NOT NULL DEFAULT 0, PRIMARY KEY (short_id, referrer))")
+	if err != nil {
+		logger.Error("Failed to create url_referrers table", zap.Error(err))
+		return nil, err
+	}
+
+	// Переходы по ссылкам, сгруппированные по метке кампании
+	_, err = db.Exec("CREATE TABLE IF NOT EXISTS url_clicks (short_id VARCHAR NOT NULL, ref VARCHAR NOT NULL, clicks BIGINT NOT NULL DEFAULT 0, PRIMARY KEY (short_id, ref))")
+	if err != nil {
+		logger.Error("Failed to create url_clicks table", zap.Error(err))
+		return nil, err
+	}
+
 	return repo, nil
 }
 
 // Save сохраняет пару ID-URL в базе данных
 func (r *PostgresRepository) Save(id, url, userID string) (string, error) {
+	return r.SaveURL(models.URL{
+		ShortID:     id,
+		OriginalURL: url,
+		UserID:      userID,
+	})
+}
+
+// SaveURL сохраняет URL со всеми атрибутами в базе данных
+func (r *PostgresRepository) SaveURL(u models.URL) (string, error) {
+	id, url, userID := u.ShortID, u.OriginalURL, u.UserID
+
 	// Сначала проверяем, существует ли original_url
 	var existingID string
 	err := r.db.QueryRow("SELECT short_id FROM urls WHERE original_url = $1", url).Scan(&existingID)
@@ -61,20 +137,43 @@ func (r *PostgresRepository) Save(id, url, userID string) (string, error) {
 
 	// Если URL не существует, выполняем INSERT
 	var shortID string
-	query := `
-		INSERT INTO urls (short_id, original_url, user_id)
-		VALUES ($1, $2, $3)
-		ON CONFLICT (original_url)
-		DO UPDATE SET short_id = urls.short_id
-		RETURNING short_id
-	`
 	var userIDValue interface{}
 	if userID == "" {
 		userIDValue = nil
 	} else {
 		userIDValue = userID
 	}
-	err = r.db.QueryRow(query, id, url, userIDValue).Scan(&shortID)
+	columns := []string{"short_id", "original_url", "user_id"}
+	args := []interface{}{id, url, userIDValue}
+	// Необязательные столбцы добавляем только при наличии значений
+	if len(u.Tags) > 0 {
+		tagsJSON, marshalErr := json.Marshal(u.Tags)
+		if marshalErr != nil {
+			return "", marshalErr
+		}
+		columns = append(columns, "tags")
+		args = append(args, string(tagsJSON))
+	}
+	if u.ClaimTokenHash != "" {
+		columns = append(columns, "claim_token_hash")
+		args = append(args, u.ClaimTokenHash)
+	}
+	if u.Description != "" {
+		columns = append(columns, "description")
+		args = append(args, u.Description)
+	}
+	placeholders := make([]string, len(args))
+	for i := range args {
+		placeholders[i] = fmt.Sprintf("$%d", i+1)
+	}
+	query := fmt.Sprintf(`
+		INSERT INTO urls (%s)
+		VALUES (%s)
+		ON CONFLICT (original_url)
+		DO UPDATE SET short_id = urls.short_id
+		RETURNING short_id
+	`, strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+	err = r.db.QueryRow(query, args...).Scan(&shortID)
 	if err != nil {
 		r.logger.Error("Failed to execute INSERT with ON CONFLICT",
 			zap.String("short_id", id),
@@ -100,39 +199,118 @@ func (r *PostgresRepository) Save(id, url, userID string) (string, error) {
 	return id, nil
 }
 
-// Get возвращает URL по ID, если он существует
-func (r *PostgresRepository) Get(id string) (models.URL, bool) {
+// reservedUnion дополняет выборку из urls зарезервированными кодами из url_reservations с Reserved = true
+const reservedUnion = "SELECT short_id, '', user_id, FALSE, FALSE, TRUE FROM url_reservations WHERE short_id "
+
+// Get возвращает URL по ID, если он существует; ошибка запроса возвращается как ErrUnavailable
+// Зарезервированный код возвращается с Reserved = true
+func (r *PostgresRepository) Get(id string) (models.URL, bool, error) {
 	var u models.URL
 	var userID sql.NullString
-	err := r.db.QueryRow("SELECT short_id, original_url, user_id, is_deleted FROM urls WHERE short_id = $1", id).
-		Scan(&u.ShortID, &u.OriginalURL, &userID, &u.DeletedFlag)
+	err := r.db.QueryRow("SELECT short_id, original_url, user_id, is_deleted, COALESCE(nsfw, FALSE), FALSE FROM urls WHERE short_id = $1 UNION ALL "+reservedUnion+"= $1", id).
+		Scan(&u.ShortID, &u.OriginalURL, &userID, &u.DeletedFlag, &u.NSFW, &u.Reserved)
 	if err == sql.ErrNoRows {
-		return models.URL{}, false
+		return models.URL{}, false, nil
 	}
 	if err != nil {
 		r.logger.Error("Failed to get URL from database", zap.String("short_id", id), zap.Error(err))
-		return models.URL{}, false
+		return models.URL{}, false, fmt.Errorf("%w: %v", ErrUnavailable, err)
 	}
 	u.UserID = userID.String
-	return u, true
+	return u, true, nil
+}
+
+// List построчно перечисляет неудалённые URL, не загружая результат запроса целиком
+func (r *PostgresRepository) List(ctx context.Context, fn func(models.URL) error) error {
+	rows, err := r.db.Query("SELECT short_id, original_url, user_id, COALESCE(nsfw, FALSE), tags, created_at, COALESCE(description, '') FROM urls WHERE is_deleted = FALSE")
+	if err != nil {
+		r.logger.Error("Failed to list URLs", zap.Error(err))
+		return err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			r.logger.Error("Failed to close rows", zap.Error(err))
+		}
+	}()
+
+	for rows.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var u models.URL
+		var userID sql.NullString
+		var tagsValue []byte
+		var createdAt sql.NullTime
+		if err := rows.Scan(&u.ShortID, &u.OriginalURL, &userID, &u.NSFW, &tagsValue, &createdAt, &u.Description); err != nil {
+			r.logger.Error("Failed to scan URL row", zap.Error(err))
+			return err
+		}
+		u.UserID = userID.String
+		u.CreatedAt = createdAt.Time
+		if len(tagsValue) > 0 {
+			if err := json.Unmarshal(tagsValue, &u.Tags); err != nil {
+				r.logger.Error("Failed to decode tags", zap.String("short_id", u.ShortID), zap.Error(err))
+				return err
+			}
+		}
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// BatchGet возвращает найденные URL и зарезервированные коды по списку ID одним запросом
+func (r *PostgresRepository) BatchGet(ids []string) (map[string]models.URL, error) {
+	result := make(map[string]models.URL, len(ids))
+	if len(ids) == 0 {
+		return result, nil
+	}
+	rows, err := r.db.Query("SELECT short_id, original_url, user_id, is_deleted, COALESCE(nsfw, FALSE), FALSE FROM urls WHERE short_id = ANY($1) UNION ALL "+reservedUnion+"= ANY($1)", ids)
+	if err != nil {
+		r.logger.Error("Failed to batch get URLs", zap.Strings("ids", ids), zap.Error(err))
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			r.logger.Error("Failed to close rows", zap.Error(err))
+		}
+	}()
+
+	for rows.Next() {
+		var u models.URL
+		var userIDValue sql.NullString
+		if err := rows.Scan(&u.ShortID, &u.OriginalURL, &userIDValue, &u.DeletedFlag, &u.NSFW, &u.Reserved); err != nil {
+			r.logger.Error("Failed to scan URL row", zap.Error(err))
+			return nil, err
+		}
+		u.UserID = userIDValue.String
+		result[u.ShortID] = u
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating URL rows", zap.Error(err))
+		return nil, err
+	}
+	return result, nil
 }
 
 // Clear очищает все записи в таблице urls
 func (r *PostgresRepository) Clear() {
-	_, err := r.db.Exec("TRUNCATE TABLE urls RESTART IDENTITY")
+	_, err := r.db.Exec("TRUNCATE TABLE urls, url_reservations RESTART IDENTITY")
 	if err != nil {
 		r.logger.Error("Failed to clear database", zap.Error(err))
 	}
 }
 
-// BatchSave сохраняет множество пар ID-URL в базе данных
-func (r *PostgresRepository) BatchSave(urls map[string]string, userID string) error {
+// BatchSave сохраняет множество пар ID-URL в базе данных в порядке элементов
+func (r *PostgresRepository) BatchSave(items []models.BatchItem, userID string) error {
 	tx, err := r.db.Begin()
 	if err != nil {
 		r.logger.Error("Failed to start transaction", zap.Error(err))
 		return err
 	}
-	for id, url := range urls {
+	for _, item := range items {
+		id, url := item.ShortID, item.OriginalURL
 		var shortID string
 		query := `
 			INSERT INTO urls (short_id, original_url, user_id)
@@ -148,6 +326,15 @@ func (r *PostgresRepository) BatchSave(urls map[string]string, userID string) er
 			userIDValue = userID
 		}
 		err := tx.QueryRow(query, id, url, userIDValue).Scan(&shortID)
+		// Конфликт по original_url обрабатывается ON CONFLICT, поэтому нарушение уникальности здесь означает занятый short_id
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode {
+			r.logger.Info("Short ID already exists in transaction", zap.String("short_id", id))
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				r.logger.Error("Failed to rollback transaction", zap.Error(rollbackErr))
+			}
+			return ErrIDExists
+		}
 		if err != nil {
 			r.logger.Error("Failed to save URL in transaction",
 				zap.String("short_id", id),
@@ -186,7 +373,7 @@ func (r *PostgresRepository) Close() error {
 
 // GetURLsByUserID возвращает все URL, связанные с пользователем
 func (r *PostgresRepository) GetURLsByUserID(userID string) ([]models.URL, error) {
-	rows, err := r.db.Query("SELECT short_id, original_url, user_id, is_deleted FROM urls WHERE user_id = $1 AND is_deleted = FALSE", userID)
+	rows, err := r.db.Query("SELECT short_id, original_url, user_id, is_deleted, COALESCE(description, ''), created_at FROM urls WHERE user_id = $1 AND is_deleted = FALSE", userID)
 	if err != nil {
 		r.logger.Error("Failed to query URLs by user_id", zap.String("user_id", userID), zap.Error(err))
 		return nil, err
@@ -201,11 +388,57 @@ func (r *PostgresRepository) GetURLsByUserID(userID string) ([]models.URL, error
 	for rows.Next() {
 		var u models.URL
 		var userIDValue sql.NullString
-		if err := rows.Scan(&u.ShortID, &u.OriginalURL, &userIDValue, &u.DeletedFlag); err != nil {
+		var createdAt sql.NullTime
+		if err := rows.Scan(&u.ShortID, &u.OriginalURL, &userIDValue, &u.DeletedFlag, &u.Description, &createdAt); err != nil {
+			r.logger.Error("Failed to scan URL row", zap.Error(err))
+			return nil, err
+		}
+		u.UserID = userIDValue.String
+		u.CreatedAt = createdAt.Time
+		urls = append(urls, u)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating URL rows", zap.Error(err))
+		return nil, err
+	}
+	return urls, nil
+}
+
+// GetURLsByUserAndTag возвращает URL пользователя, помеченные указанной меткой
+func (r *PostgresRepository) GetURLsByUserAndTag(userID, tag string) ([]models.URL, error) {
+	tagJSON, err := json.Marshal([]string{tag})
+	if err != nil {
+		return nil, err
+	}
+	rows, err := r.db.Query("SELECT short_id, original_url, user_id, is_deleted, tags, COALESCE(description, ''), created_at FROM urls WHERE user_id = $1 AND is_deleted = FALSE AND tags @> $2::jsonb", userID, string(tagJSON))
+	if err != nil {
+		r.logger.Error("Failed to query URLs by user_id and tag", zap.String("user_id", userID), zap.String("tag", tag), zap.Error(err))
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			r.logger.Error("Failed to close rows", zap.Error(err))
+		}
+	}()
+
+	var urls []models.URL
+	for rows.Next() {
+		var u models.URL
+		var userIDValue sql.NullString
+		var tagsValue []byte
+		var createdAt sql.NullTime
+		if err := rows.Scan(&u.ShortID, &u.OriginalURL, &userIDValue, &u.DeletedFlag, &tagsValue, &u.Description, &createdAt); err != nil {
 			r.logger.Error("Failed to scan URL row", zap.Error(err))
 			return nil, err
 		}
 		u.UserID = userIDValue.String
+		u.CreatedAt = createdAt.Time
+		if len(tagsValue) > 0 {
+			if err := json.Unmarshal(tagsValue, &u.Tags); err != nil {
+				r.logger.Error("Failed to decode tags", zap.String("short_id", u.ShortID), zap.Error(err))
+				return nil, err
+			}
+		}
 		urls = append(urls, u)
 	}
 	if err := rows.Err(); err != nil {
@@ -217,7 +450,13 @@ func (r *PostgresRepository) GetURLsByUserID(userID string) ([]models.URL, error
 
 // BatchDelete помечает указанные URL как удалённые
 func (r *PostgresRepository) BatchDelete(userID string, ids []string) error {
-	query := "UPDATE urls SET is_deleted = TRUE WHERE short_id = ANY($1) AND user_id = $2"
+	// Источники и переходы удалённых ссылок больше не показываются и удаляются тем же запросом
+	query := `WITH cleared AS (
+			DELETE FROM url_referrers WHERE short_id IN (SELECT short_id FROM urls WHERE short_id = ANY($1) AND user_id = $2)
+		), cleared_clicks AS (
+			DELETE FROM url_clicks WHERE short_id IN (SELECT short_id FROM urls WHERE short_id = ANY($1) AND user_id = $2)
+		)
+		UPDATE urls SET is_deleted = TRUE WHERE short_id = ANY($1) AND user_id = $2`
 	result, err := r.db.Exec(query, ids, userID)
 	if err != nil {
 		r.logger.Error("Failed to batch delete URLs",
@@ -237,6 +476,64 @@ func (r *PostgresRepository) BatchDelete(userID string, ids []string) error {
 	return nil
 }
 
+// DeleteByUserAndHost помечает удалёнными все URL пользователя с указанным хостом
+// Хост извлекается из original_url на стороне приложения, чтобы правила сравнения совпадали с другими хранилищами
+func (r *PostgresRepository) DeleteByUserAndHost(userID, host string) (int, error) {
+	rows, err := r.db.Query("SELECT short_id, original_url FROM urls WHERE user_id = $1 AND is_deleted = FALSE", userID)
+	if err != nil {
+		r.logger.Error("Failed to query URLs by user_id", zap.String("user_id", userID), zap.Error(err))
+		return 0, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			r.logger.Error("Failed to close rows", zap.Error(err))
+		}
+	}()
+
+	var ids []string
+	for rows.Next() {
+		var shortID, originalURL string
+		if err := rows.Scan(&shortID, &originalURL); err != nil {
+			r.logger.Error("Failed to scan URL row", zap.Error(err))
+			return 0, err
+		}
+		if hostMatches(originalURL, host) {
+			ids = append(ids, shortID)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating URL rows", zap.Error(err))
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	result, err := r.db.Exec(`WITH cleared AS (
+			DELETE FROM url_referrers WHERE short_id IN (SELECT short_id FROM urls WHERE short_id = ANY($1) AND user_id = $2)
+		), cleared_clicks AS (
+			DELETE FROM url_clicks WHERE short_id IN (SELECT short_id FROM urls WHERE short_id = ANY($1) AND user_id = $2)
+		)
+		UPDATE urls SET is_deleted = TRUE WHERE short_id = ANY($1) AND user_id = $2 AND is_deleted = FALSE`, ids, userID)
+	if err != nil {
+		r.logger.Error("Failed to delete URLs by host",
+			zap.String("user_id", userID),
+			zap.String("host", host),
+			zap.Error(err))
+		return 0, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		r.logger.Error("Failed to get rows affected", zap.Error(err))
+		return 0, err
+	}
+	r.logger.Info("Delete by host completed",
+		zap.String("user_id", userID),
+		zap.String("host", host),
+		zap.Int64("rows_affected", rowsAffected))
+	return int(rowsAffected), nil
+}
+
 // GetStats возвращает статистику сервиса: количество URL и пользователей
 func (r *PostgresRepository) GetStats() (int, int, error) {
 	// Подсчитываем количество не удаленных URL
@@ -247,9 +544,9 @@ func (r *PostgresRepository) GetStats() (int, int, error) {
 		return 0, 0, err
 	}
 
-	// Подсчитываем количество уникальных пользователей
+	// Подсчитываем количество уникальных пользователей, включая записанных выданных
 	var userCount int
-	err = r.db.QueryRow("SELECT COUNT(DISTINCT user_id) FROM urls WHERE is_deleted = FALSE AND user_id IS NOT NULL AND user_id != ''").Scan(&userCount)
+	err = r.db.QueryRow("SELECT COUNT(*) FROM (SELECT user_id FROM urls WHERE is_deleted = FALSE AND user_id IS NOT NULL AND user_id != '' UNION SELECT user_id FROM users) AS active_users").Scan(&userCount)
 	if err != nil {
 		r.logger.Error("Failed to count users", zap.Error(err))
 		return 0, 0, err
@@ -257,3 +554,431 @@ func (r *PostgresRepository) GetStats() (int, int, error) {
 
 	return urlCount, userCount, nil
 }
+
+// SaveUser записывает выданного пользователя; повторная запись игнорируется
+func (r *PostgresRepository) SaveUser(userID string, firstSeen time.Time) error {
+	_, err := r.db.Exec("INSERT INTO users (user_id, first_seen) VALUES ($1, $2) ON CONFLICT (user_id) DO NOTHING", userID, firstSeen)
+	if err != nil {
+		r.logger.Error("Failed to save user", zap.String("user_id", userID), zap.Error(err))
+	}
+	return err
+}
+
+// Count возвращает количество занятых коротких ID, включая удалённые и зарезервированные
+func (r *PostgresRepository) Count() (int, error) {
+	var count int
+	if err := r.db.QueryRow("SELECT (SELECT COUNT(*) FROM urls) + (SELECT COUNT(*) FROM url_reservations)").Scan(&count); err != nil {
+		r.logger.Error("Failed to count short IDs", zap.Error(err))
+		return 0, err
+	}
+	return count, nil
+}
+
+// RecordReferrer учитывает переход по id с источника referrer; переход по отсутствующему или удалённому id не учитывается
+// Как и в памяти, новые источники сверх maxReferrersPerLink учитываются под referrerOther;
+// при одновременных переходах с разных новых источников лимит может быть немного превышен
+func (r *PostgresRepository) RecordReferrer(id, referrer string) error {
+	query := `INSERT INTO url_referrers (short_id, referrer, clicks)
+		SELECT short_id,
+			CASE WHEN EXISTS (SELECT 1 FROM url_referrers WHERE short_id = $1 AND referrer = $2)
+				OR (SELECT COUNT(*) FROM url_referrers WHERE short_id = $1) < $3
+			THEN $2 ELSE $4 END, 1
+		FROM urls WHERE short_id = $1 AND is_deleted = FALSE
+		ON CONFLICT (short_id, referrer) DO UPDATE SET clicks = url_referrers.clicks + 1`
+	if _, err := r.db.Exec(query, id, referrer, maxReferrersPerLink, referrerOther); err != nil {
+		r.logger.Error("Failed to record referrer", zap.String("short_id", id), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// TopReferrers возвращает не более limit самых частых источников для каждой ссылки из ids
+func (r *PostgresRepository) TopReferrers(ids []string, limit int) (map[string][]models.ReferrerCount, error) {
+	query := `SELECT short_id, referrer, clicks FROM (
+			SELECT short_id, referrer, clicks,
+				ROW_NUMBER() OVER (PARTITION BY short_id ORDER BY clicks DESC, referrer) AS rank
+			FROM url_referrers WHERE short_id = ANY($1)
+		) AS ranked WHERE rank <= $2 ORDER BY short_id, rank`
+	rows, err := r.db.Query(query, ids, limit)
+	if err != nil {
+		r.logger.Error("Failed to query top referrers", zap.Error(err))
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			r.logger.Error("Failed to close rows", zap.Error(err))
+		}
+	}()
+
+	result := make(map[string][]models.ReferrerCount)
+	for rows.Next() {
+		var id string
+		var ref models.ReferrerCount
+		if err := rows.Scan(&id, &ref.Referrer, &ref.Clicks); err != nil {
+			return nil, err
+		}
+		result[id] = append(result[id], ref)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// RecordClicks добавляет n переходов по id с меткой ref; переходы по отсутствующему или удалённому id не учитываются
+// Как и в памяти, новые метки сверх maxReferrersPerLink учитываются под referrerOther
+func (r *PostgresRepository) RecordClicks(id, ref string, n int) error {
+	query := `INSERT INTO url_clicks (short_id, ref, clicks)
+		SELECT short_id,
+			CASE WHEN EXISTS (SELECT 1 FROM url_clicks WHERE short_id = $1 AND ref = $2)
+				OR (SELECT COUNT(*) FROM url_clicks WHERE short_id = $1) < $4
+			THEN $2 ELSE $5 END, $3
+		FROM urls WHERE short_id = $1 AND is_deleted = FALSE
+		ON CONFLICT (short_id, ref) DO UPDATE SET clicks = url_clicks.clicks + EXCLUDED.clicks`
+	if _, err := r.db.Exec(query, id, ref, n, maxReferrersPerLink, referrerOther); err != nil {
+		r.logger.Error("Failed to record clicks", zap.String("short_id", id), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// ClickCounts возвращает переходы по меткам для ссылок ids
+func (r *PostgresRepository) ClickCounts(ids []string) (map[string]map[string]int, error) {
+	rows, err := r.db.Query("SELECT short_id, ref, clicks FROM url_clicks WHERE short_id = ANY($1)", ids)
+	if err != nil {
+		r.logger.Error("Failed to query clicks", zap.Error(err))
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			r.logger.Error("Failed to close rows", zap.Error(err))
+		}
+	}()
+
+	result := make(map[string]map[string]int)
+	for rows.Next() {
+		var id, ref string
+		var clicks int
+		if err := rows.Scan(&id, &ref, &clicks); err != nil {
+			return nil, err
+		}
+		if result[id] == nil {
+			result[id] = make(map[string]int)
+		}
+		result[id][ref] = clicks
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetUserStats возвращает статистику использования сервиса пользователем одним агрегирующим запросом
+// ClicksTotal складывается из переходов, записанных через RecordClicks
+// created_at проставляет сама база, поэтому окно недавних URL считается по её часам, а не от now
+func (r *PostgresRepository) GetUserStats(userID string, _ time.Time) (models.UserStats, error) {
+	var stats models.UserStats
+	err := r.db.QueryRow(`SELECT
+			COUNT(*) FILTER (WHERE NOT COALESCE(is_deleted, FALSE)),
+			COUNT(*) FILTER (WHERE is_deleted),
+			COUNT(*) FILTER (WHERE created_at >= NOW() - INTERVAL '30 days'),
+			(SELECT COALESCE(SUM(c.clicks), 0) FROM url_clicks c JOIN urls u ON u.short_id = c.short_id WHERE u.user_id = $1)
+		FROM urls WHERE user_id = $1`, userID).Scan(&stats.URLs, &stats.Deleted, &stats.CreatedLast30d, &stats.ClicksTotal)
+	if err != nil {
+		r.logger.Error("Failed to get user stats", zap.String("user_id", userID), zap.Error(err))
+		return models.UserStats{}, err
+	}
+	return stats, nil
+}
+
+// ReassignUser передаёт все URL пользователя fromUserID пользователю toUserID одним запросом
+func (r *PostgresRepository) ReassignUser(fromUserID, toUserID string) (int, error) {
+	result, err := r.db.Exec("UPDATE urls SET user_id = $1 WHERE user_id = $2", toUserID, fromUserID)
+	if err != nil {
+		r.logger.Error("Failed to reassign URLs", zap.String("from_user_id", fromUserID), zap.Error(err))
+		return 0, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		r.logger.Error("Failed to get rows affected", zap.Error(err))
+		return 0, err
+	}
+	r.logger.Info("Reassign user completed",
+		zap.String("from_user_id", fromUserID),
+		zap.String("to_user_id", toUserID),
+		zap.Int64("rows_affected", rowsAffected))
+	return int(rowsAffected), nil
+}
+
+// ClaimURL передаёт URL пользователю userID по хешу токена владения и гасит токен одним запросом
+func (r *PostgresRepository) ClaimURL(id, tokenHash, userID string) error {
+	result, err := r.db.Exec(`
+		UPDATE urls SET user_id = $1, claim_token_hash = NULL
+		WHERE short_id = $2 AND claim_token_hash = $3 AND NOT COALESCE(is_deleted, FALSE)
+	`, userID, id, tokenHash)
+	if err != nil {
+		r.logger.Error("Failed to claim URL", zap.String("short_id", id), zap.Error(err))
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		r.logger.Error("Failed to get rows affected", zap.Error(err))
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrClaimRejected
+	}
+	return nil
+}
+
+// SetNSFW помечает URL как NSFW или снимает пометку
+func (r *PostgresRepository) SetNSFW(id string, nsfw bool) error {
+	result, err := r.db.Exec("UPDATE urls SET nsfw = $1 WHERE short_id = $2", nsfw, id)
+	if err != nil {
+		r.logger.Error("Failed to set NSFW flag", zap.String("short_id", id), zap.Error(err))
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		r.logger.Error("Failed to get rows affected", zap.Error(err))
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrURLNotFound
+	}
+	return nil
+}
+
+// ReserveIDs резервирует короткие ID за пользователем в одной транзакции, записывая их в url_reservations
+// ID, уже занятый ссылкой или другим резервом, отклоняет резервирование целиком с ErrIDExists
+// Время резерва, как и created_at ссылок, проставляет сама база
+func (r *PostgresRepository) ReserveIDs(ids []string, userID string, _ time.Time) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logger.Error("Failed to start transaction", zap.Error(err))
+		return err
+	}
+	var userIDValue interface{}
+	if userID != "" {
+		userIDValue = userID
+	}
+	for _, id := range ids {
+		result, err := tx.Exec(`INSERT INTO url_reservations (short_id, user_id)
+			SELECT $1, $2 WHERE NOT EXISTS (SELECT 1 FROM urls WHERE short_id = $1)`, id, userIDValue)
+		var rowsAffected int64
+		if err == nil {
+			rowsAffected, err = result.RowsAffected()
+		}
+		if err == nil && rowsAffected > 0 {
+			continue
+		}
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			r.logger.Error("Failed to rollback transaction", zap.Error(rollbackErr))
+		}
+		var pgErr *pgconn.PgError
+		if err == nil || errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode {
+			r.logger.Info("Short ID already exists in reservation", zap.String("short_id", id))
+			return ErrIDExists
+		}
+		r.logger.Error("Failed to reserve short ID", zap.String("short_id", id), zap.Error(err))
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		r.logger.Error("Failed to commit transaction", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// ActivateReserved задаёт адрес назначения зарезервированного ID: в одной транзакции снимает резерв
+// и создаёт ссылку в urls
+func (r *PostgresRepository) ActivateReserved(id, userID, originalURL string) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		r.logger.Error("Failed to start transaction", zap.Error(err))
+		return err
+	}
+	rollback := func() {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			r.logger.Error("Failed to rollback transaction", zap.Error(rollbackErr))
+		}
+	}
+
+	result, err := tx.Exec("DELETE FROM url_reservations WHERE short_id = $1 AND user_id = $2", id, userID)
+	if err != nil {
+		rollback()
+		r.logger.Error("Failed to release reserved short ID", zap.String("short_id", id), zap.Error(err))
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		rollback()
+		r.logger.Error("Failed to get rows affected", zap.Error(err))
+		return err
+	}
+	if rowsAffected == 0 {
+		rollback()
+		return ErrNotReserved
+	}
+
+	_, err = tx.Exec("INSERT INTO urls (short_id, original_url, user_id) VALUES ($1, $2, $3)", id, originalURL, userID)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode {
+		rollback()
+		r.logger.Info("URL already exists", zap.String("original_url", originalURL))
+		return ErrURLExists
+	}
+	if err != nil {
+		rollback()
+		r.logger.Error("Failed to activate reserved short ID", zap.String("short_id", id), zap.Error(err))
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		r.logger.Error("Failed to commit transaction", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// GetUserIDsByURL возвращает пользователей, создавших ссылки на originalURL
+func (r *PostgresRepository) GetUserIDsByURL(originalURL string) ([]string, error) {
+	rows, err := r.db.Query(`SELECT DISTINCT user_id FROM urls
+		WHERE original_url = $1 AND user_id IS NOT NULL AND user_id != ''
+		ORDER BY user_id`, originalURL)
+	if err != nil {
+		r.logger.Error("Failed to query URL owners", zap.Error(err))
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			r.logger.Error("Failed to close rows", zap.Error(err))
+		}
+	}()
+
+	userIDs := []string{}
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			r.logger.Error("Failed to scan URL owner row", zap.Error(err))
+			return nil, err
+		}
+		userIDs = append(userIDs, userID)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating URL owner rows", zap.Error(err))
+		return nil, err
+	}
+	return userIDs, nil
+}
+
+// TopUsers возвращает пользователей с наибольшим числом активных URL, агрегируя их в базе
+func (r *PostgresRepository) TopUsers(limit int) ([]models.UserURLCount, error) {
+	rows, err := r.db.Query(`SELECT user_id,
+			COUNT(*) FILTER (WHERE NOT COALESCE(is_deleted, FALSE)) AS urls,
+			COUNT(*) FILTER (WHERE is_deleted) AS deleted
+		FROM urls WHERE user_id IS NOT NULL AND user_id != ''
+		GROUP BY user_id
+		ORDER BY urls DESC, user_id ASC
+		LIMIT $1`, limit)
+	if err != nil {
+		r.logger.Error("Failed to query top users", zap.Error(err))
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			r.logger.Error("Failed to close rows", zap.Error(err))
+		}
+	}()
+
+	var users []models.UserURLCount
+	for rows.Next() {
+		var u models.UserURLCount
+		if err := rows.Scan(&u.UserID, &u.URLs, &u.Deleted); err != nil {
+			r.logger.Error("Failed to scan top user row", zap.Error(err))
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating top user rows", zap.Error(err))
+		return nil, err
+	}
+	return users, nil
+}
+
+// Verify проверяет таблицу urls: записи без short_id и повторы original_url, если уникальный индекс отсутствует
+// При repair записи без short_id удаляются; повторы original_url требуют ручного разбора
+func (r *PostgresRepository) Verify(repair bool) (VerifyReport, error) {
+	report := VerifyReport{Backend: r.Name()}
+	if err := r.db.QueryRow("SELECT COUNT(*) FROM urls").Scan(&report.Records); err != nil {
+		r.logger.Error("Failed to count URLs", zap.Error(err))
+		return report, err
+	}
+
+	var emptyIDs int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM urls WHERE short_id IS NULL OR short_id = ''").Scan(&emptyIDs)
+	if err != nil {
+		r.logger.Error("Failed to count URLs without short ID", zap.Error(err))
+		return report, err
+	}
+	if emptyIDs > 0 {
+		violation := Violation{Kind: ViolationEmptyShortID, Detail: fmt.Sprintf("%d rows", emptyIDs), Repairable: true}
+		if repair {
+			if _, err := r.db.Exec("DELETE FROM urls WHERE short_id IS NULL OR short_id = ''"); err != nil {
+				r.logger.Error("Failed to delete URLs without short ID", zap.Error(err))
+				return report, err
+			}
+			violation.Repaired = true
+		}
+		report.Violations = append(report.Violations, violation)
+	}
+
+	// При уникальном индексе повторы original_url невозможны, и полный проход по таблице не нужен
+	var indexExists bool
+	err = r.db.QueryRow(`SELECT EXISTS (
+			SELECT 1 FROM pg_indexes
+			WHERE schemaname = 'public' AND tablename = 'urls' AND indexname = 'urls_original_url_key'
+		)`).Scan(&indexExists)
+	if err != nil {
+		r.logger.Error("Failed to check original_url index", zap.Error(err))
+		return report, err
+	}
+	if indexExists {
+		return report, nil
+	}
+
+	rows, err := r.db.Query(`SELECT original_url, COUNT(*) FROM urls
+		GROUP BY original_url HAVING COUNT(*) > 1
+		ORDER BY original_url LIMIT 100`)
+	if err != nil {
+		r.logger.Error("Failed to query duplicate original URLs", zap.Error(err))
+		return report, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			r.logger.Error("Failed to close rows", zap.Error(err))
+		}
+	}()
+	for rows.Next() {
+		var originalURL string
+		var count int
+		if err := rows.Scan(&originalURL, &count); err != nil {
+			r.logger.Error("Failed to scan duplicate original URL row", zap.Error(err))
+			return report, err
+		}
+		report.Violations = append(report.Violations, Violation{
+			Kind:   ViolationDuplicateOriginalURL,
+			Detail: fmt.Sprintf("%s used by %d rows", originalURL, count),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		r.logger.Error("Error iterating duplicate original URL rows", zap.Error(err))
+		return report, err
+	}
+	return report, nil
+}
+
+// Name возвращает имя хранилища
+func (r *PostgresRepository) Name() string {
+	return "postgres"
+}
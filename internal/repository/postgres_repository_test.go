@@ -1,11 +1,15 @@
 package repository
 
 import (
+	"context"
 	sql "database/sql"
+	"database/sql/driver"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/stretchr/testify/assert"
 	"github.com/tempizhere/goshorty/internal/models"
 	"go.uber.org/zap"
@@ -85,7 +89,7 @@ func TestPostgresRepository(t *testing.T) {
 		{
 			name: "Get not found",
 			setup: func() {
-				mock.ExpectQuery("SELECT short_id, original_url, user_id, is_deleted FROM urls WHERE short_id = \\$1").
+				mock.ExpectQuery("SELECT short_id, original_url, user_id, is_deleted, COALESCE\\(nsfw, FALSE\\), FALSE FROM urls WHERE short_id = \\$1 UNION ALL SELECT .* FROM url_reservations WHERE short_id = \\$1").
 					WithArgs("nonexistent").
 					WillReturnError(sql.ErrNoRows)
 			},
@@ -97,7 +101,7 @@ func TestPostgresRepository(t *testing.T) {
 		{
 			name: "Clear success",
 			setup: func() {
-				mock.ExpectExec("TRUNCATE TABLE urls RESTART IDENTITY").
+				mock.ExpectExec("TRUNCATE TABLE urls, url_reservations RESTART IDENTITY").
 					WillReturnResult(sqlmock.NewResult(0, 0))
 			},
 		},
@@ -115,7 +119,7 @@ func TestPostgresRepository(t *testing.T) {
 					assert.Equal(t, tt.expectedShortID, shortID)
 				} else {
 					// Тестируем Get
-					url, exists := repo.Get(tt.id)
+					url, exists, _ := repo.Get(tt.id)
 					assert.False(t, exists)
 					assert.Equal(t, models.URL{}, url)
 				}
@@ -148,21 +152,54 @@ func TestPostgresRepository_BatchSave(t *testing.T) {
 		logger: logger,
 	}
 
-	// Тест успешного пакетного сохранения
+	// Тест успешного пакетного сохранения: вставки идут в порядке элементов пакета
+	items := []models.BatchItem{
+		{ShortID: "id3", OriginalURL: "https://example3.com"},
+		{ShortID: "id1", OriginalURL: "https://example1.com"},
+		{ShortID: "id2", OriginalURL: "https://example2.com"},
+	}
 	mock.ExpectBegin()
-	mock.ExpectQuery("INSERT INTO urls \\(short_id, original_url, user_id\\) VALUES \\(\\$1, \\$2, \\$3\\) ON CONFLICT \\(original_url\\) DO UPDATE SET short_id = urls.short_id RETURNING short_id").
-		WithArgs("id1", "https://example1.com", "user1").
-		WillReturnRows(sqlmock.NewRows([]string{"short_id"}).AddRow("id1"))
+	for _, item := range items {
+		mock.ExpectQuery("INSERT INTO urls \\(short_id, original_url, user_id\\) VALUES \\(\\$1, \\$2, \\$3\\) ON CONFLICT \\(original_url\\) DO UPDATE SET short_id = urls.short_id RETURNING short_id").
+			WithArgs(item.ShortID, item.OriginalURL, "user1").
+			WillReturnRows(sqlmock.NewRows([]string{"short_id"}).AddRow(item.ShortID))
+	}
 	mock.ExpectCommit()
 
-	urls := map[string]string{
-		"id1": "https://example1.com",
-	}
-	err = repo.BatchSave(urls, "user1")
+	err = repo.BatchSave(items, "user1")
 	assert.NoError(t, err)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
+func TestPostgresRepository_BatchSaveIDConflict(t *testing.T) {
+	logger := zap.NewNop()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("Failed to close database: %v", closeErr)
+		}
+	}()
+
+	repo := &PostgresRepository{
+		db:     db,
+		logger: logger,
+	}
+
+	// Нарушение уникальности short_id внутри транзакции откатывает пакет
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO urls").
+		WithArgs("id1", "https://example1.com", "user1").
+		WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "urls_short_id_key"})
+	mock.ExpectRollback()
+
+	err = repo.BatchSave([]models.BatchItem{{ShortID: "id1", OriginalURL: "https://example1.com"}}, "user1")
+	assert.ErrorIs(t, err, ErrIDExists)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestPostgresRepository_GetURLsByUserID(t *testing.T) {
 	logger := zap.NewNop()
 	db, mock, err := sqlmock.New()
@@ -181,9 +218,10 @@ func TestPostgresRepository_GetURLsByUserID(t *testing.T) {
 	}
 
 	// Тест успешного получения URL
-	rows := sqlmock.NewRows([]string{"short_id", "original_url", "user_id", "is_deleted"}).
-		AddRow("id1", "https://example1.com", "user1", false)
-	mock.ExpectQuery("SELECT short_id, original_url, user_id, is_deleted FROM urls WHERE user_id = \\$1 AND is_deleted = FALSE").
+	createdAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	rows := sqlmock.NewRows([]string{"short_id", "original_url", "user_id", "is_deleted", "description", "created_at"}).
+		AddRow("id1", "https://example1.com", "user1", false, "Landing page", createdAt)
+	mock.ExpectQuery("SELECT short_id, original_url, user_id, is_deleted, COALESCE\\(description, ''\\), created_at FROM urls WHERE user_id = \\$1 AND is_deleted = FALSE").
 		WithArgs("user1").
 		WillReturnRows(rows)
 
@@ -192,6 +230,471 @@ func TestPostgresRepository_GetURLsByUserID(t *testing.T) {
 	assert.Len(t, urls, 1)
 	assert.Equal(t, "id1", urls[0].ShortID)
 	assert.Equal(t, "https://example1.com", urls[0].OriginalURL)
+	assert.Equal(t, "Landing page", urls[0].Description)
+	assert.Equal(t, createdAt, urls[0].CreatedAt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresRepository_SaveURLWithTags(t *testing.T) {
+	logger := zap.NewNop()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("Failed to close database: %v", closeErr)
+		}
+	}()
+
+	repo := &PostgresRepository{
+		db:     db,
+		logger: logger,
+	}
+
+	mock.ExpectQuery("SELECT short_id FROM urls WHERE original_url = \\$1").
+		WithArgs("https://example.com").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("INSERT INTO urls \\(short_id, original_url, user_id, tags\\) VALUES \\(\\$1, \\$2, \\$3, \\$4\\)").
+		WithArgs("id1", "https://example.com", "user1", `["work","docs"]`).
+		WillReturnRows(sqlmock.NewRows([]string{"short_id"}).AddRow("id1"))
+
+	shortID, err := repo.SaveURL(models.URL{ShortID: "id1", OriginalURL: "https://example.com", UserID: "user1", Tags: []string{"work", "docs"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "id1", shortID)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresRepository_GetURLsByUserAndTag(t *testing.T) {
+	logger := zap.NewNop()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("Failed to close database: %v", closeErr)
+		}
+	}()
+
+	repo := &PostgresRepository{
+		db:     db,
+		logger: logger,
+	}
+
+	rows := sqlmock.NewRows([]string{"short_id", "original_url", "user_id", "is_deleted", "tags", "description", "created_at"}).
+		AddRow("id1", "https://example1.com", "user1", false, []byte(`["work"]`), "", nil)
+	mock.ExpectQuery("SELECT short_id, original_url, user_id, is_deleted, tags, COALESCE\\(description, ''\\), created_at FROM urls WHERE user_id = \\$1 AND is_deleted = FALSE AND tags @> \\$2::jsonb").
+		WithArgs("user1", `["work"]`).
+		WillReturnRows(rows)
+
+	urls, err := repo.GetURLsByUserAndTag("user1", "work")
+	assert.NoError(t, err)
+	assert.Len(t, urls, 1)
+	assert.Equal(t, "id1", urls[0].ShortID)
+	assert.Equal(t, []string{"work"}, urls[0].Tags)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresRepository_GetUserStats(t *testing.T) {
+	logger := zap.NewNop()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("Failed to close database: %v", closeErr)
+		}
+	}()
+
+	repo := &PostgresRepository{
+		db:     db,
+		logger: logger,
+	}
+
+	mock.ExpectQuery("SELECT .*COUNT\\(\\*\\) FILTER .* FROM urls WHERE user_id = \\$1").
+		WithArgs("user1").
+		WillReturnRows(sqlmock.NewRows([]string{"urls", "deleted", "created_last_30d", "clicks_total"}).AddRow(2, 1, 3, 7))
+
+	stats, err := repo.GetUserStats("user1", time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, models.UserStats{URLs: 2, Deleted: 1, CreatedLast30d: 3, ClicksTotal: 7}, stats)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresRepository_ReassignUser(t *testing.T) {
+	logger := zap.NewNop()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("Failed to close database: %v", closeErr)
+		}
+	}()
+
+	repo := &PostgresRepository{
+		db:     db,
+		logger: logger,
+	}
+
+	mock.ExpectExec("UPDATE urls SET user_id = \\$1 WHERE user_id = \\$2").
+		WithArgs("new", "old").
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	moved, err := repo.ReassignUser("old", "new")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, moved)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresRepository_ClaimURL(t *testing.T) {
+	logger := zap.NewNop()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("Failed to close database: %v", closeErr)
+		}
+	}()
+
+	repo := &PostgresRepository{
+		db:     db,
+		logger: logger,
+	}
+
+	query := "UPDATE urls SET user_id = \\$1, claim_token_hash = NULL\\s+WHERE short_id = \\$2 AND claim_token_hash = \\$3"
+	mock.ExpectExec(query).WithArgs("new", "id1", "hash").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(query).WithArgs("new", "id1", "hash").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, repo.ClaimURL("id1", "hash", "new"))
+	assert.ErrorIs(t, repo.ClaimURL("id1", "hash", "new"), ErrClaimRejected)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresRepository_SetNSFW(t *testing.T) {
+	logger := zap.NewNop()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("Failed to close database: %v", closeErr)
+		}
+	}()
+
+	repo := &PostgresRepository{
+		db:     db,
+		logger: logger,
+	}
+
+	mock.ExpectExec("UPDATE urls SET nsfw = \\$1 WHERE short_id = \\$2").WithArgs(true, "id1").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE urls SET nsfw = \\$1 WHERE short_id = \\$2").WithArgs(true, "missing").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT short_id, original_url, user_id, is_deleted, COALESCE\\(nsfw, FALSE\\), FALSE FROM urls WHERE short_id = \\$1 UNION ALL SELECT .* FROM url_reservations WHERE short_id = \\$1").
+		WithArgs("id1").
+		WillReturnRows(sqlmock.NewRows([]string{"short_id", "original_url", "user_id", "is_deleted", "nsfw", "reserved"}).
+			AddRow("id1", "https://example.com", "user1", false, true, false))
+
+	assert.NoError(t, repo.SetNSFW("id1", true))
+	assert.ErrorIs(t, repo.SetNSFW("missing", true), ErrURLNotFound)
+	u, ok, _ := repo.Get("id1")
+	assert.True(t, ok)
+	assert.True(t, u.NSFW)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresRepository_GetUnavailable(t *testing.T) {
+	logger := zap.NewNop()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("Failed to close database: %v", closeErr)
+		}
+	}()
+
+	repo := &PostgresRepository{
+		db:     db,
+		logger: logger,
+	}
+
+	mock.ExpectQuery("SELECT short_id, original_url, user_id, is_deleted, COALESCE\\(nsfw, FALSE\\), FALSE FROM urls WHERE short_id = \\$1 UNION ALL SELECT .* FROM url_reservations WHERE short_id = \\$1").
+		WithArgs("id1").
+		WillReturnError(errors.New("connection refused"))
+	mock.ExpectQuery("SELECT short_id, original_url, user_id, is_deleted, COALESCE\\(nsfw, FALSE\\), FALSE FROM urls WHERE short_id = \\$1 UNION ALL SELECT .* FROM url_reservations WHERE short_id = \\$1").
+		WithArgs("missing").
+		WillReturnRows(sqlmock.NewRows([]string{"short_id", "original_url", "user_id", "is_deleted", "nsfw", "reserved"}))
+
+	// Сбой соединения не выдаётся за отсутствие URL
+	_, exists, err := repo.Get("id1")
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.False(t, exists)
+
+	_, exists, err = repo.Get("missing")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresRepository_ReserveIDs(t *testing.T) {
+	logger := zap.NewNop()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("Failed to close database: %v", closeErr)
+		}
+	}()
+
+	repo := &PostgresRepository{
+		db:     db,
+		logger: logger,
+	}
+
+	const (
+		reserveQuery  = "INSERT INTO url_reservations \\(short_id, user_id\\)\\s+SELECT \\$1, \\$2 WHERE NOT EXISTS \\(SELECT 1 FROM urls WHERE short_id = \\$1\\)"
+		releaseQuery  = "DELETE FROM url_reservations WHERE short_id = \\$1 AND user_id = \\$2"
+		activateQuery = "INSERT INTO urls \\(short_id, original_url, user_id\\) VALUES \\(\\$1, \\$2, \\$3\\)"
+	)
+	mock.ExpectBegin()
+	mock.ExpectExec(reserveQuery).WithArgs("r1", "printer").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(reserveQuery).WithArgs("taken", "printer").WillReturnError(&pgconn.PgError{Code: uniqueViolationCode})
+	mock.ExpectRollback()
+	// ID уже занят ссылкой: строка резерва не вставляется
+	mock.ExpectBegin()
+	mock.ExpectExec(reserveQuery).WithArgs("used", "printer").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	mock.ExpectBegin()
+	mock.ExpectExec(releaseQuery).WithArgs("r1", "printer").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(activateQuery).WithArgs("r1", "https://example.com/r1", "printer").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(releaseQuery).WithArgs("r1", "printer").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+	// Адрес уже сокращён: резерв возвращается откатом
+	mock.ExpectBegin()
+	mock.ExpectExec(releaseQuery).WithArgs("r2", "printer").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(activateQuery).WithArgs("r2", "https://example.com/taken", "printer").WillReturnError(&pgconn.PgError{Code: uniqueViolationCode})
+	mock.ExpectRollback()
+
+	assert.ErrorIs(t, repo.ReserveIDs([]string{"r1", "taken"}, "printer", time.Now()), ErrIDExists)
+	assert.ErrorIs(t, repo.ReserveIDs([]string{"used"}, "printer", time.Now()), ErrIDExists)
+	assert.NoError(t, repo.ActivateReserved("r1", "printer", "https://example.com/r1"))
+	assert.ErrorIs(t, repo.ActivateReserved("r1", "printer", "https://example.com/r1"), ErrNotReserved)
+	assert.ErrorIs(t, repo.ActivateReserved("r2", "printer", "https://example.com/taken"), ErrURLExists)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresRepository_SaveUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("Failed to close database: %v", closeErr)
+		}
+	}()
+
+	repo := &PostgresRepository{
+		db:     db,
+		logger: zap.NewNop(),
+	}
+
+	firstSeen := time.Unix(1700000000, 0)
+	mock.ExpectExec("INSERT INTO users \\(user_id, first_seen\\) VALUES \\(\\$1, \\$2\\) ON CONFLICT \\(user_id\\) DO NOTHING").
+		WithArgs("user1", firstSeen).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM urls WHERE is_deleted = FALSE").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM \\(SELECT user_id FROM urls .* UNION SELECT user_id FROM users\\) AS active_users").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	assert.NoError(t, repo.SaveUser("user1", firstSeen))
+	urlCount, userCount, err := repo.GetStats()
+	assert.NoError(t, err)
+	assert.Zero(t, urlCount)
+	assert.Equal(t, 1, userCount)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresRepository_Count(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("Failed to close database: %v", closeErr)
+		}
+	}()
+
+	repo := &PostgresRepository{
+		db:     db,
+		logger: zap.NewNop(),
+	}
+
+	mock.ExpectQuery("SELECT \\(SELECT COUNT\\(\\*\\) FROM urls\\) \\+ \\(SELECT COUNT\\(\\*\\) FROM url_reservations\\)").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
+	mock.ExpectQuery("SELECT \\(SELECT COUNT\\(\\*\\) FROM urls\\) \\+ \\(SELECT COUNT\\(\\*\\) FROM url_reservations\\)").WillReturnError(errors.New("connection lost"))
+
+	count, err := repo.Count()
+	assert.NoError(t, err)
+	assert.Equal(t, 42, count)
+	_, err = repo.Count()
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresRepository_GetUserIDsByURL(t *testing.T) {
+	logger := zap.NewNop()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("Failed to close database: %v", closeErr)
+		}
+	}()
+
+	repo := &PostgresRepository{
+		db:     db,
+		logger: logger,
+	}
+
+	mock.ExpectQuery("SELECT DISTINCT user_id FROM urls\\s+WHERE original_url = \\$1").
+		WithArgs("https://example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow("user1").AddRow("user2"))
+
+	userIDs, err := repo.GetUserIDsByURL("https://example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"user1", "user2"}, userIDs)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresRepository_TopUsers(t *testing.T) {
+	logger := zap.NewNop()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("Failed to close database: %v", closeErr)
+		}
+	}()
+
+	repo := &PostgresRepository{
+		db:     db,
+		logger: logger,
+	}
+
+	mock.ExpectQuery("SELECT user_id,.* GROUP BY user_id\\s+ORDER BY urls DESC, user_id ASC\\s+LIMIT \\$1").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "urls", "deleted"}).
+			AddRow("user1", 3, 0).
+			AddRow("user2", 3, 1))
+
+	users, err := repo.TopUsers(2)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.UserURLCount{
+		{UserID: "user1", URLs: 3},
+		{UserID: "user2", URLs: 3, Deleted: 1},
+	}, users)
+
+	mock.ExpectQuery("SELECT user_id,").WithArgs(5).WillReturnError(errors.New("connection refused"))
+	_, err = repo.TopUsers(5)
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostgresRepository_List(t *testing.T) {
+	logger := zap.NewNop()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("Failed to close database: %v", closeErr)
+		}
+	}()
+
+	repo := &PostgresRepository{
+		db:     db,
+		logger: logger,
+	}
+
+	// Снимок строится из List, поэтому в URL попадают все атрибуты ссылки
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT short_id, original_url, user_id, COALESCE\\(nsfw, FALSE\\), tags, created_at, COALESCE\\(description, ''\\) FROM urls").
+		WillReturnRows(sqlmock.NewRows([]string{"short_id", "original_url", "user_id", "nsfw", "tags", "created_at", "description"}).
+			AddRow("id1", "https://example1.com", "user1", true, []byte(`["news","go"]`), created, "Example").
+			AddRow("id2", "https://example2.com", nil, false, nil, nil, ""))
+
+	var urls []models.URL
+	err = repo.List(context.Background(), func(u models.URL) error {
+		urls = append(urls, u)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []models.URL{
+		{ShortID: "id1", OriginalURL: "https://example1.com", UserID: "user1", NSFW: true, Tags: []string{"news", "go"}, CreatedAt: created, Description: "Example"},
+		{ShortID: "id2", OriginalURL: "https://example2.com"},
+	}, urls)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// arrayConverter передаёт срезы строк в sqlmock без преобразования, как драйвер pgx передаёт их в массивы PostgreSQL
+type arrayConverter struct{}
+
+func (arrayConverter) ConvertValue(v interface{}) (driver.Value, error) {
+	if ids, ok := v.([]string); ok {
+		return ids, nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+func TestPostgresRepository_DeleteByUserAndHost(t *testing.T) {
+	logger := zap.NewNop()
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(arrayConverter{}))
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("Failed to close database: %v", closeErr)
+		}
+	}()
+
+	repo := &PostgresRepository{
+		db:     db,
+		logger: logger,
+	}
+
+	rows := sqlmock.NewRows([]string{"short_id", "original_url"}).
+		AddRow("id1", "https://old.example.com/a").
+		AddRow("id2", "https://new.example.com/b").
+		AddRow("id3", "http://OLD.example.com:8080/c")
+	mock.ExpectQuery("SELECT short_id, original_url FROM urls WHERE user_id = \\$1 AND is_deleted = FALSE").
+		WithArgs("user1").
+		WillReturnRows(rows)
+	mock.ExpectExec("UPDATE urls SET is_deleted = TRUE WHERE short_id = ANY\\(\\$1\\) AND user_id = \\$2 AND is_deleted = FALSE").
+		WithArgs([]string{"id1", "id3"}, "user1").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	deleted, err := repo.DeleteByUserAndHost("user1", "old.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, deleted)
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
@@ -214,3 +717,61 @@ func TestPostgresRepository_Close(t *testing.T) {
 	assert.NoError(t, err, "Close should not return error")
 	assert.NoError(t, mock.ExpectationsWereMet(), "Expected Close() to be called on database")
 }
+
+func TestPostgresRepository_Verify(t *testing.T) {
+	logger := zap.NewNop()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil {
+			t.Logf("Failed to close database: %v", closeErr)
+		}
+	}()
+
+	repo := &PostgresRepository{
+		db:     db,
+		logger: logger,
+	}
+
+	// Без уникального индекса проверяются повторы original_url; записи без short_id удаляются
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM urls$").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(10))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM urls WHERE short_id IS NULL OR short_id = ''").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	mock.ExpectExec("DELETE FROM urls WHERE short_id IS NULL OR short_id = ''").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery("SELECT EXISTS").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery("SELECT original_url, COUNT\\(\\*\\) FROM urls\\s+GROUP BY original_url HAVING COUNT\\(\\*\\) > 1").
+		WillReturnRows(sqlmock.NewRows([]string{"original_url", "count"}).AddRow("https://example.com", 3))
+
+	report, err := repo.Verify(true)
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres", report.Backend)
+	assert.Equal(t, 10, report.Records)
+	assert.Len(t, report.Violations, 2)
+	if len(report.Violations) == 2 {
+		assert.Equal(t, ViolationEmptyShortID, report.Violations[0].Kind)
+		assert.True(t, report.Violations[0].Repaired)
+		assert.Equal(t, ViolationDuplicateOriginalURL, report.Violations[1].Kind)
+		assert.False(t, report.Violations[1].Repairable)
+	}
+	assert.True(t, report.Failed())
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// С уникальным индексом и без пустых ID нарушений нет
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM urls$").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(8))
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM urls WHERE short_id IS NULL").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("SELECT EXISTS").
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	report, err = repo.Verify(false)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Violations)
+	assert.False(t, report.Failed())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"sort"
+
+	"github.com/tempizhere/goshorty/internal/models"
+)
+
+// maxReferrersPerLink ограничивает число различных источников, которые in-memory хранилище помнит для одной ссылки
+// Переходы с новых источников сверх лимита учитываются под referrerOther
+const maxReferrersPerLink = 100
+
+// referrerOther — источник, под которым учитываются переходы сверх maxReferrersPerLink
+const referrerOther = "other"
+
+// referrerCounts хранит число переходов по каждому источнику для каждой ссылки
+type referrerCounts map[string]map[string]int
+
+// record учитывает переход по id с источника referrer
+func (c referrerCounts) record(id, referrer string) {
+	c.add(id, referrer, 1)
+}
+
+// add учитывает n переходов по id с ключом key; новые ключи сверх maxReferrersPerLink учитываются под referrerOther
+func (c referrerCounts) add(id, key string, n int) {
+	counts, ok := c[id]
+	if !ok {
+		counts = make(map[string]int)
+		c[id] = counts
+	}
+	if _, known := counts[key]; !known && len(counts) >= maxReferrersPerLink {
+		key = referrerOther
+	}
+	counts[key] += n
+}
+
+// copyOf возвращает копию счётчиков ссылок из ids; ссылки без переходов не попадают в результат
+func (c referrerCounts) copyOf(ids []string) map[string]map[string]int {
+	result := make(map[string]map[string]int)
+	for _, id := range ids {
+		counts := c[id]
+		if len(counts) == 0 {
+			continue
+		}
+		cp := make(map[string]int, len(counts))
+		for key, n := range counts {
+			cp[key] = n
+		}
+		result[id] = cp
+	}
+	return result
+}
+
+// top возвращает не более limit самых частых источников для каждой ссылки из ids
+func (c referrerCounts) top(ids []string, limit int) map[string][]models.ReferrerCount {
+	result := make(map[string][]models.ReferrerCount)
+	for _, id := range ids {
+		counts := c[id]
+		if len(counts) == 0 {
+			continue
+		}
+		result[id] = rankReferrers(counts, limit)
+	}
+	return result
+}
+
+// rankReferrers сортирует источники по убыванию переходов, при равенстве — по имени, и возвращает не более limit первых
+func rankReferrers(counts map[string]int, limit int) []models.ReferrerCount {
+	referrers := make([]models.ReferrerCount, 0, len(counts))
+	for referrer, clicks := range counts {
+		referrers = append(referrers, models.ReferrerCount{Referrer: referrer, Clicks: clicks})
+	}
+	sort.Slice(referrers, func(i, j int) bool {
+		if referrers[i].Clicks != referrers[j].Clicks {
+			return referrers[i].Clicks > referrers[j].Clicks
+		}
+		return referrers[i].Referrer < referrers[j].Referrer
+	})
+	if limit >= 0 && len(referrers) > limit {
+		referrers = referrers[:limit]
+	}
+	return referrers
+}
+
+// stats оценивает размер счётчиков источников
+func (c referrerCounts) stats(name string) models.IndexStats {
+	return mapStats(name, c, func(counts map[string]int) int64 {
+		return mapStats("", counts, func(int) int64 { return 8 }).Bytes
+	})
+}
+
+// recordReferrerIn учитывает переход в хранилище, если оно ведёт учёт источников
+func recordReferrerIn(repo Repository, id, referrer string) error {
+	if store, ok := repo.(ReferrerStore); ok {
+		return store.RecordReferrer(id, referrer)
+	}
+	return nil
+}
+
+// topReferrersOf возвращает источники переходов из хранилища, если оно ведёт их учёт
+func topReferrersOf(repo Repository, ids []string, limit int) (map[string][]models.ReferrerCount, error) {
+	if store, ok := repo.(ReferrerStore); ok {
+		return store.TopReferrers(ids, limit)
+	}
+	return nil, nil
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/models"
+	"go.uber.org/zap"
+)
+
+func TestMemoryRepository_Referrers(t *testing.T) {
+	repo := NewMemoryRepository()
+	_, err := repo.Save("id1", "https://example.com/1", "user1")
+	assert.NoError(t, err)
+	_, err = repo.Save("id2", "https://example.com/2", "user1")
+	assert.NoError(t, err)
+
+	for _, ref := range []string{"news.example", "blog.example", "news.example", "chat.example", "blog.example", "news.example"} {
+		assert.NoError(t, repo.RecordReferrer("id1", ref))
+	}
+	// Переход по неизвестному ID не учитывается
+	assert.NoError(t, repo.RecordReferrer("missing", "news.example"))
+
+	top, err := repo.TopReferrers([]string{"id1", "id2", "missing"}, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]models.ReferrerCount{
+		"id1": {{Referrer: "news.example", Clicks: 3}, {Referrer: "blog.example", Clicks: 2}},
+	}, top)
+
+	// Источники удалённой ссылки забываются, и новые переходы по ней не учитываются
+	assert.NoError(t, repo.BatchDelete("user1", []string{"id1"}))
+	assert.NoError(t, repo.RecordReferrer("id1", "news.example"))
+	top, err = repo.TopReferrers([]string{"id1"}, 2)
+	assert.NoError(t, err)
+	assert.Empty(t, top)
+
+	assert.NoError(t, repo.RecordReferrer("id2", "news.example"))
+	repo.Clear()
+	top, err = repo.TopReferrers([]string{"id2"}, 2)
+	assert.NoError(t, err)
+	assert.Empty(t, top)
+}
+
+func TestReferrerCounts_Cap(t *testing.T) {
+	counts := make(referrerCounts)
+	for i := 0; i < maxReferrersPerLink+5; i++ {
+		counts.record("id1", fmt.Sprintf("site%d.example", i))
+	}
+	counts.record("id1", "site0.example")
+
+	assert.Len(t, counts["id1"], maxReferrersPerLink+1)
+	assert.Equal(t, 5, counts["id1"][referrerOther])
+	assert.Equal(t, []models.ReferrerCount{{Referrer: referrerOther, Clicks: 5}, {Referrer: "site0.example", Clicks: 2}},
+		counts.top([]string{"id1"}, 2)["id1"])
+}
+
+func TestFaultRepository_ReferrersForwarded(t *testing.T) {
+	memory := NewMemoryRepository()
+	_, err := memory.Save("id1", "https://example.com/1", "user1")
+	assert.NoError(t, err)
+	repo := WithFaults(memory, FaultConfig{})
+
+	assert.NoError(t, repo.RecordReferrer("id1", "news.example"))
+	top, err := repo.TopReferrers([]string{"id1"}, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, []models.ReferrerCount{{Referrer: "news.example", Clicks: 1}}, top["id1"])
+
+	// Хранилище без учёта источников молча пропускает запись
+	file, err := NewFileRepository(t.TempDir()+"/storage.json", zap.NewNop())
+	assert.NoError(t, err)
+	assert.NoError(t, WithFaults(file, FaultConfig{}).RecordReferrer("id1", "news.example"))
+}
+
+func TestPostgresRepository_Referrers(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(arrayConverter{}))
+	if err != nil {
+		t.Fatalf("Failed to create sqlmock: %v", err)
+	}
+	defer func() {
+		_ = db.Close()
+	}()
+	repo := &PostgresRepository{db: db, logger: zap.NewNop()}
+
+	// Новые источники сверх лимита учитываются под referrerOther, удалённые ссылки не учитываются
+	mock.ExpectExec("INSERT INTO url_referrers \\(short_id, referrer, clicks\\)\\s+SELECT short_id,.*COUNT\\(\\*\\) FROM url_referrers WHERE short_id = \\$1\\) < \\$3\\s+THEN \\$2 ELSE \\$4 END, 1\\s+FROM urls WHERE short_id = \\$1 AND is_deleted = FALSE\\s+ON CONFLICT \\(short_id, referrer\\) DO UPDATE SET clicks = url_referrers.clicks \\+ 1").
+		WithArgs("id1", "news.example", maxReferrersPerLink, referrerOther).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, repo.RecordReferrer("id1", "news.example"))
+
+	mock.ExpectQuery("SELECT short_id, referrer, clicks FROM .* FROM url_referrers WHERE short_id = ANY\\(\\$1\\)\\s+\\) AS ranked WHERE rank <= \\$2").
+		WithArgs([]string{"id1", "id2"}, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"short_id", "referrer", "clicks"}).
+			AddRow("id1", "news.example", 3).
+			AddRow("id1", "blog.example", 2).
+			AddRow("id2", "chat.example", 1))
+	top, err := repo.TopReferrers([]string{"id1", "id2"}, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]models.ReferrerCount{
+		"id1": {{Referrer: "news.example", Clicks: 3}, {Referrer: "blog.example", Clicks: 2}},
+		"id2": {{Referrer: "chat.example", Clicks: 1}},
+	}, top)
+
+	// Удаление ссылок тем же запросом забывает их источники и переходы
+	mock.ExpectExec("WITH cleared AS \\(\\s+DELETE FROM url_referrers WHERE short_id IN \\(SELECT short_id FROM urls WHERE short_id = ANY\\(\\$1\\) AND user_id = \\$2\\)\\s+\\), cleared_clicks AS \\(\\s+DELETE FROM url_clicks .*\\)\\s+UPDATE urls SET is_deleted = TRUE").
+		WithArgs([]string{"id1"}, "user1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	assert.NoError(t, repo.BatchDelete("user1", []string{"id1"}))
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -1,33 +1,356 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/tempizhere/goshorty/internal/models"
+	"go.uber.org/zap"
 )
 
 // ErrURLExists возвращается при попытке сохранить URL, который уже существует
 var ErrURLExists = errors.New("URL already exists")
 
+// ErrIDExists возвращается, если при пакетном сохранении короткий ID уже занят
+var ErrIDExists = errors.New("short ID already exists")
+
+// ErrClaimRejected возвращается, если URL нельзя передать по токену владения:
+// URL не найден или удалён, токен не совпадает или уже использован
+var ErrClaimRejected = errors.New("claim rejected")
+
+// ErrURLNotFound возвращается, если изменяемый URL отсутствует в хранилище
+var ErrURLNotFound = errors.New("URL not found")
+
+// ErrNotReserved возвращается, если короткий ID не зарезервирован пользователем или уже активирован
+var ErrNotReserved = errors.New("short ID is not reserved")
+
+// ErrUnavailable возвращается, если хранилище не ответило; в отличие от отсутствия записи это временный сбой
+var ErrUnavailable = errors.New("storage unavailable")
+
+// ErrStorageFull возвращается, если хранилище достигло лимита записей и вытеснение отключено
+var ErrStorageFull = errors.New("storage is full")
+
+// ErrDuplicatesUnsupported возвращается, если хранилище не допускает нескольких ссылок на один URL (см. DuplicateSaver)
+var ErrDuplicatesUnsupported = errors.New("storage does not support duplicate URLs")
+
+// EvictionPolicy определяет поведение in-memory хранилища при достижении лимита записей
+type EvictionPolicy string
+
+const (
+	// EvictionReject отклоняет новые записи с ErrStorageFull
+	EvictionReject EvictionPolicy = "reject"
+	// EvictionLRU вытесняет давно не запрашивавшиеся записи (приближение LRU алгоритмом clock)
+	EvictionLRU EvictionPolicy = "lru"
+)
+
+// Option настраивает in-memory и файловое хранилища
+type Option func(*options)
+
+// options содержит общие параметры in-memory и файлового хранилищ
+type options struct {
+	disableReverseIndex bool
+	disableSelfHeal     bool
+	repairOnLoad        bool
+	tempFileMaxAge      time.Duration
+	writeAttempts       int
+	writeBackoff        time.Duration
+	maxURLs             int
+	eviction            EvictionPolicy
+	logger              *zap.Logger
+}
+
+// DisableReverseIndex отключает обратный индекс original_url -> short_id
+// Экономит память для нагрузки без повторов; Save при этом не выполняет дедупликацию URL
+// Поддерживается только in-memory и файловым хранилищами: в PostgreSQL original_url уникален по схеме
+func DisableReverseIndex() Option {
+	return func(o *options) {
+		o.disableReverseIndex = true
+	}
+}
+
+// WithMaxURLs ограничивает число записей in-memory хранилища; 0 снимает ограничение
+// Поведение при достижении лимита задаёт policy; пустое значение означает EvictionReject
+func WithMaxURLs(maxURLs int, policy EvictionPolicy) Option {
+	return func(o *options) {
+		o.maxURLs = maxURLs
+		if policy != "" {
+			o.eviction = policy
+		}
+	}
+}
+
+// WithLogger задаёт логгер для событий in-memory хранилища (например, вытеснения записей)
+func WithLogger(logger *zap.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// DisableSelfHeal отключает пересоздание каталога файлового хранилища, удалённого во время работы:
+// запись в отсутствующий каталог возвращает ошибку
+func DisableSelfHeal() Option {
+	return func(o *options) {
+		o.disableSelfHeal = true
+	}
+}
+
+// RepairOnLoad включает перезапись файла хранилища при загрузке, если в нём есть повторы short_id
+// В файле остаётся первая запись каждого ID — та же, что используется при загрузке
+func RepairOnLoad() Option {
+	return func(o *options) {
+		o.repairOnLoad = true
+	}
+}
+
+// DefaultTempFileMaxAge — возраст, после которого временный файл перезаписи считается брошенным
+const DefaultTempFileMaxAge = time.Hour
+
+// WithTempFileMaxAge задаёт возраст, после которого временные файлы temp_*.json в каталоге файла хранилища
+// удаляются при запуске; неположительное значение оставляет DefaultTempFileMaxAge
+func WithTempFileMaxAge(maxAge time.Duration) Option {
+	return func(o *options) {
+		if maxAge > 0 {
+			o.tempFileMaxAge = maxAge
+		}
+	}
+}
+
+// Параметры повтора дозаписи в файл хранилища по умолчанию
+const (
+	DefaultWriteAttempts = 3
+	DefaultWriteBackoff  = 10 * time.Millisecond
+)
+
+// WithWriteRetry задаёт число попыток дозаписи в файл хранилища и начальную паузу между ними
+// Пауза удваивается после каждой неудачи; повторяются только временные ошибки (ENOSPC, EINTR, EAGAIN).
+// Неположительные значения оставляют DefaultWriteAttempts и DefaultWriteBackoff; attempts = 1 отключает повторы
+func WithWriteRetry(attempts int, backoff time.Duration) Option {
+	return func(o *options) {
+		if attempts > 0 {
+			o.writeAttempts = attempts
+		}
+		if backoff > 0 {
+			o.writeBackoff = backoff
+		}
+	}
+}
+
+// applyOptions собирает параметры хранилища из опций
+func applyOptions(opts []Option) options {
+	o := options{
+		eviction:      EvictionReject,
+		writeAttempts: DefaultWriteAttempts,
+		writeBackoff:  DefaultWriteBackoff,
+		logger:        zap.NewNop(),
+
+		tempFileMaxAge: DefaultTempFileMaxAge,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// userStatsWindow задаёт период, за который считаются недавно созданные URL
+const userStatsWindow = 30 * 24 * time.Hour
+
+// aggregateUserStats считает статистику пользователя по списку его URL
+func aggregateUserStats(urls []models.URL, now time.Time) models.UserStats {
+	var stats models.UserStats
+	since := now.Add(-userStatsWindow)
+	for _, u := range urls {
+		if u.DeletedFlag {
+			stats.Deleted++
+		} else {
+			stats.URLs++
+		}
+		if !u.CreatedAt.IsZero() && !u.CreatedAt.Before(since) {
+			stats.CreatedLast30d++
+		}
+	}
+	return stats
+}
+
+// rankUsers сортирует счётчики пользователей по убыванию активных URL и возвращает не более limit первых
+// При равенстве пользователи упорядочиваются по user_id, чтобы рейтинг был одинаковым во всех хранилищах
+func rankUsers(counts map[string]*models.UserURLCount, limit int) []models.UserURLCount {
+	users := make([]models.UserURLCount, 0, len(counts))
+	for _, c := range counts {
+		users = append(users, *c)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].URLs != users[j].URLs {
+			return users[i].URLs > users[j].URLs
+		}
+		return users[i].UserID < users[j].UserID
+	})
+	if limit >= 0 && len(users) > limit {
+		users = users[:limit]
+	}
+	return users
+}
+
+// countUser учитывает URL пользователя в счётчиках для rankUsers; URL без пользователя не учитываются
+func countUser(counts map[string]*models.UserURLCount, userID string, deleted bool) {
+	if userID == "" {
+		return
+	}
+	c, ok := counts[userID]
+	if !ok {
+		c = &models.UserURLCount{UserID: userID}
+		counts[userID] = c
+	}
+	if deleted {
+		c.Deleted++
+	} else {
+		c.URLs++
+	}
+}
+
+// uniqueBatchIDs сообщает, что короткие ID в пакете не повторяются
+func uniqueBatchIDs(items []models.BatchItem) bool {
+	seen := make(map[string]struct{}, len(items))
+	for _, item := range items {
+		if _, dup := seen[item.ShortID]; dup {
+			return false
+		}
+		seen[item.ShortID] = struct{}{}
+	}
+	return true
+}
+
+// sortedUserIDs возвращает идентификаторы пользователей из множества в порядке возрастания
+func sortedUserIDs(set map[string]struct{}) []string {
+	userIDs := make([]string, 0, len(set))
+	for userID := range set {
+		userIDs = append(userIDs, userID)
+	}
+	sort.Strings(userIDs)
+	return userIDs
+}
+
+// hostMatches сообщает, указывает ли URL на хост host; регистр и порт не учитываются
+func hostMatches(rawURL, host string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Hostname(), host)
+}
+
 // Repository определяет интерфейс для работы с хранилищем URL
 type Repository interface {
 	// Save сохраняет URL с заданным ID и возвращает короткий ID или ошибку
 	Save(id, url, userID string) (string, error)
+	// SaveURL сохраняет URL со всеми атрибутами (метки и т.д.) и возвращает короткий ID или ошибку
+	SaveURL(u models.URL) (string, error)
 	// Get возвращает URL по короткому ID и флаг существования
-	Get(id string) (models.URL, bool)
+	// Ошибка означает сбой хранилища (ErrUnavailable), а не отсутствие URL: тогда флаг не имеет смысла
+	Get(id string) (models.URL, bool, error)
+	// BatchGet возвращает найденные URL по списку коротких ID одним обращением к хранилищу
+	BatchGet(ids []string) (map[string]models.URL, error)
 	// Clear очищает все данные в хранилище
 	Clear()
-	// BatchSave сохраняет несколько URL для одного пользователя
-	BatchSave(urls map[string]string, userID string) error
+	// BatchSave сохраняет несколько URL для одного пользователя в порядке элементов items
+	// Занятость коротких ID проверяется атомарно с сохранением; при конфликте, в том числе
+	// с повторным ID внутри пакета, возвращается ErrIDExists
+	BatchSave(items []models.BatchItem, userID string) error
 	// GetURLsByUserID возвращает все URL, созданные пользователем
 	GetURLsByUserID(userID string) ([]models.URL, error)
+	// GetURLsByUserAndTag возвращает URL пользователя, помеченные указанной меткой
+	GetURLsByUserAndTag(userID, tag string) ([]models.URL, error)
 	// BatchDelete помечает URL как удалённые для указанного пользователя
 	BatchDelete(userID string, ids []string) error
+	// DeleteByUserAndHost помечает удалёнными все URL пользователя с указанным хостом и возвращает их количество
+	DeleteByUserAndHost(userID, host string) (int, error)
+	// ReassignUser передаёт все URL пользователя fromUserID, включая удалённые, пользователю toUserID
+	// и возвращает количество переданных URL
+	ReassignUser(fromUserID, toUserID string) (int, error)
+	// ClaimURL атомарно передаёт URL id пользователю userID, если tokenHash совпадает с хешем токена владения,
+	// и гасит токен; иначе возвращает ErrClaimRejected
+	ClaimURL(id, tokenHash, userID string) error
+	// SetNSFW помечает URL как NSFW или снимает пометку; для отсутствующего URL возвращает ErrURLNotFound
+	SetNSFW(id string, nsfw bool) error
+	// ReserveIDs резервирует короткие ID за пользователем без адреса назначения
+	// Занятость ID проверяется атомарно с резервированием; при конфликте возвращается ErrIDExists
+	// createdAt — время создания резерва по часам сервиса
+	ReserveIDs(ids []string, userID string, createdAt time.Time) error
+	// ActivateReserved задаёт адрес назначения зарезервированного ID пользователя userID
+	// Если ID не зарезервирован этим пользователем, возвращается ErrNotReserved
+	ActivateReserved(id, userID, originalURL string) error
+	// GetUserIDsByURL возвращает отсортированный список пользователей, создавших ссылки на originalURL, включая удалённые
+	// При дедупликации по original_url у URL не больше одного владельца
+	GetUserIDsByURL(originalURL string) ([]string, error)
+	// SaveUser записывает выданный идентификатор пользователя со временем первого появления
+	// Повторная запись того же пользователя ничего не меняет; записанные пользователи учитываются в GetStats
+	SaveUser(userID string, firstSeen time.Time) error
+	// Count возвращает количество занятых коротких ID, включая удалённые и зарезервированные
+	Count() (int, error)
 	// GetStats возвращает статистику сервиса: количество URL и пользователей
 	GetStats() (int, int, error)
+	// GetUserStats возвращает статистику использования сервиса пользователем;
+	// недавно созданные URL отсчитываются от now по часам сервиса
+	GetUserStats(userID string, now time.Time) (models.UserStats, error)
+	// TopUsers возвращает не более limit пользователей с наибольшим числом активных URL
+	// Пользователи упорядочены по убыванию активных URL, при равенстве — по user_id
+	TopUsers(limit int) ([]models.UserURLCount, error)
 	// Close закрывает ресурсы репозитория (соединения, файлы и т.д.)
 	Close() error
+	// Name возвращает имя хранилища ("postgres", "file", "memory")
+	Name() string
+}
+
+// IndexReporter сообщает размеры индексов, которые хранилище держит в памяти
+type IndexReporter interface {
+	// IndexStats возвращает количество записей и приблизительный объём каждого индекса
+	IndexStats() []models.IndexStats
+}
+
+// ReferrerStore учитывает источники переходов по ссылкам; хранилище реализует его по желанию
+type ReferrerStore interface {
+	// RecordReferrer учитывает переход по id с источника referrer; переход по неизвестному или удалённому id не учитывается
+	// Источники удалённых ссылок забываются вместе с удалением
+	RecordReferrer(id, referrer string) error
+	// TopReferrers возвращает не более limit самых частых источников для каждой ссылки из ids;
+	// ссылки без учтённых переходов в результат не попадают
+	TopReferrers(ids []string, limit int) (map[string][]models.ReferrerCount, error)
+}
+
+// ClickStore хранит число переходов по ссылкам с разбивкой по метке кампании; хранилище реализует его по желанию
+type ClickStore interface {
+	// RecordClicks добавляет n переходов по id с меткой ref ("" — без метки); переходы по неизвестному или удалённому id не учитываются
+	// Переходы удалённых ссылок забываются вместе с удалением
+	RecordClicks(id, ref string, n int) error
+	// ClickCounts возвращает число переходов по каждой метке для ссылок из ids; ссылки без переходов в результат не попадают
+	ClickCounts(ids []string) (map[string]map[string]int, error)
+}
+
+// URLLister перечисляет активные URL хранилища, не загружая их в память целиком
+type URLLister interface {
+	// List вызывает fn для каждого неудалённого URL; ошибка fn или отмена контекста прерывает перечисление
+	List(ctx context.Context, fn func(models.URL) error) error
+}
+
+// ContextScanner реализуется хранилищами, долгие выборки которых можно прервать отменой контекста
+// (например, файловое хранилище читает файл целиком); при отмене возвращается ошибка контекста
+type ContextScanner interface {
+	// GetURLsByUserIDContext работает как Repository.GetURLsByUserID
+	GetURLsByUserIDContext(ctx context.Context, userID string) ([]models.URL, error)
+	// GetStatsContext работает как Repository.GetStats
+	GetStatsContext(ctx context.Context) (int, int, error)
+	// BatchDeleteContext работает как Repository.BatchDelete
+	BatchDeleteContext(ctx context.Context, userID string, ids []string) error
+}
+
+// DuplicateSaver реализуется хранилищами, которые допускают несколько ссылок на один original_url
+type DuplicateSaver interface {
+	// SaveDuplicateURL работает как Repository.SaveURL, но не ищет существующий original_url и не возвращает ErrURLExists
+	SaveDuplicateURL(u models.URL) (string, error)
 }
 
 // Database определяет интерфейс для работы с базой данных
@@ -1,10 +1,13 @@
 package repository
 
 import (
+	"context"
+	"path/filepath"
 	"strconv"
 	"sync/atomic"
 	"testing"
 
+	"github.com/tempizhere/goshorty/internal/models"
 	"go.uber.org/zap"
 )
 
@@ -36,24 +39,60 @@ func BenchmarkMemoryRepository_Get(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, exists := repo.Get(id)
+		_, exists, _ := repo.Get(id)
 		if !exists {
 			b.Fatal("URL not found")
 		}
 	}
 }
 
+// BenchmarkMemoryRepository_GetEviction сравнивает скорость Get без лимита и с отслеживанием обращений для вытеснения
+func BenchmarkMemoryRepository_GetEviction(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "Unlimited"},
+		{name: "LRU", opts: []Option{WithMaxURLs(20000, EvictionLRU)}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			repo := NewMemoryRepository(bc.opts...)
+			urls := make([]models.BatchItem, 0, 10000)
+			ids := make([]string, 0, 10000)
+			for i := 0; i < 10000; i++ {
+				id := "get-id-" + strconv.Itoa(i)
+				urls = append(urls, models.BatchItem{ShortID: id, OriginalURL: "https://example.com/get/" + strconv.Itoa(i)})
+				ids = append(ids, id)
+			}
+			if err := repo.BatchSave(urls, "test-user"); err != nil {
+				b.Fatal(err)
+			}
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if _, exists, _ := repo.Get(ids[i%len(ids)]); !exists {
+						b.Fatal("URL not found")
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
 // BenchmarkMemoryRepository_BatchSave измеряет производительность пакетного сохранения в memory репозитории
 func BenchmarkMemoryRepository_BatchSave(b *testing.B) {
 	repo := NewMemoryRepository()
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		urls := make(map[string]string)
+		urls := make([]models.BatchItem, 0)
 		for j := 0; j < 10; j++ {
 			id := "batch-id-" + strconv.Itoa(i) + "-" + strconv.Itoa(j)
 			url := "https://example.com/batch/" + strconv.Itoa(i) + "-" + strconv.Itoa(j)
-			urls[id] = url
+			urls = append(urls, models.BatchItem{ShortID: id, OriginalURL: url})
 		}
 		err := repo.BatchSave(urls, "test-user")
 		if err != nil {
@@ -112,12 +151,7 @@ func BenchmarkMemoryRepository_BatchDelete(b *testing.B) {
 
 // BenchmarkFileRepository_Save измеряет производительность сохранения в file репозитории
 func BenchmarkFileRepository_Save(b *testing.B) {
-	logger, _ := zap.NewDevelopment()
-	repo, err := NewFileRepository("benchmark_test.json", logger)
-	if err != nil {
-		b.Fatal(err)
-	}
-	defer repo.Clear()
+	repo := newTestFileRepo(b)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
@@ -132,12 +166,7 @@ func BenchmarkFileRepository_Save(b *testing.B) {
 
 // BenchmarkFileRepository_Get измеряет производительность получения из file репозитория
 func BenchmarkFileRepository_Get(b *testing.B) {
-	logger, _ := zap.NewDevelopment()
-	repo, err := NewFileRepository("benchmark_test.json", logger)
-	if err != nil {
-		b.Fatal(err)
-	}
-	defer repo.Clear()
+	repo := newTestFileRepo(b)
 
 	// Подготавливаем данные
 	id := "file-test-id"
@@ -148,7 +177,7 @@ func BenchmarkFileRepository_Get(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, exists := repo.Get(id)
+		_, exists, _ := repo.Get(id)
 		if !exists {
 			b.Fatal("URL not found")
 		}
@@ -157,20 +186,15 @@ func BenchmarkFileRepository_Get(b *testing.B) {
 
 // BenchmarkFileRepository_BatchSave измеряет производительность пакетного сохранения в file репозитории
 func BenchmarkFileRepository_BatchSave(b *testing.B) {
-	logger, _ := zap.NewDevelopment()
-	repo, err := NewFileRepository("benchmark_test.json", logger)
-	if err != nil {
-		b.Fatal(err)
-	}
-	defer repo.Clear()
+	repo := newTestFileRepo(b)
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		urls := make(map[string]string)
+		urls := make([]models.BatchItem, 0)
 		for j := 0; j < 5; j++ {
 			id := "file-batch-id-" + strconv.Itoa(i) + "-" + strconv.Itoa(j)
 			url := "https://example.com/file-batch/" + strconv.Itoa(i) + "-" + strconv.Itoa(j)
-			urls[id] = url
+			urls = append(urls, models.BatchItem{ShortID: id, OriginalURL: url})
 		}
 		err := repo.BatchSave(urls, "test-user")
 		if err != nil {
@@ -179,6 +203,39 @@ func BenchmarkFileRepository_BatchSave(b *testing.B) {
 	}
 }
 
+// BenchmarkFileRepository_Load измеряет память, выделяемую при загрузке файла с обратным индексом и без него
+func BenchmarkFileRepository_Load(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "storage.json")
+	repo, err := NewFileRepository(path, zap.NewNop())
+	if err != nil {
+		b.Fatal(err)
+	}
+	urls := make([]models.BatchItem, 0, 10000)
+	for i := 0; i < 10000; i++ {
+		urls = append(urls, models.BatchItem{ShortID: "load-id-" + strconv.Itoa(i), OriginalURL: "https://example.com/load/" + strconv.Itoa(i)})
+	}
+	if err := repo.BatchSave(urls, "test-user"); err != nil {
+		b.Fatal(err)
+	}
+
+	for _, bc := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "WithIndex"},
+		{name: "WithoutIndex", opts: []Option{DisableReverseIndex()}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := NewFileRepository(path, zap.NewNop(), bc.opts...); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 // BenchmarkConcurrentMemoryRepository_Save измеряет производительность конкурентного сохранения в memory репозитории
 func BenchmarkConcurrentMemoryRepository_Save(b *testing.B) {
 	repo := NewMemoryRepository()
@@ -216,7 +273,7 @@ func BenchmarkConcurrentMemoryRepository_Get(b *testing.B) {
 		i := 0
 		for pb.Next() {
 			id := "concurrent-get-id-" + strconv.Itoa(i%100)
-			_, exists := repo.Get(id)
+			_, exists, _ := repo.Get(id)
 			if !exists {
 				b.Fatal("URL not found")
 			}
@@ -241,9 +298,74 @@ func BenchmarkMemoryRepository_LargeDataset(b *testing.B) {
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		id := "large-id-" + strconv.Itoa(i%1000)
-		_, exists := repo.Get(id)
+		_, exists, _ := repo.Get(id)
 		if !exists {
 			b.Fatal("URL not found")
 		}
 	}
 }
+
+// userIndexBenchRecords — размер хранилища в бенчмарках выборки по пользователю
+const userIndexBenchRecords = 1_000_000
+
+// fillUserIndexBench сохраняет userIndexBenchRecords URL: у каждого из 100 пользователей по 10000 URL подряд
+func fillUserIndexBench(b *testing.B, repo Repository) {
+	b.Helper()
+	const batchSize = 10000
+	items := make([]models.BatchItem, 0, batchSize)
+	for start := 0; start < userIndexBenchRecords; start += batchSize {
+		items = items[:0]
+		for i := start; i < start+batchSize; i++ {
+			items = append(items, models.BatchItem{ShortID: "id-" + strconv.Itoa(i), OriginalURL: "https://example.com/" + strconv.Itoa(i)})
+		}
+		if err := repo.BatchSave(items, "user-"+strconv.Itoa(start/batchSize)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkMemoryRepository_GetURLsByUserIDLarge сравнивает выборку по индексу пользователей
+// с полным перебором хранилища, которым она выполнялась до появления индекса
+func BenchmarkMemoryRepository_GetURLsByUserIDLarge(b *testing.B) {
+	repo := NewMemoryRepository(DisableReverseIndex())
+	fillUserIndexBench(b, repo)
+
+	b.Run("Index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := repo.GetURLsByUserID("user-42"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var urls []models.URL
+			err := repo.List(context.Background(), func(u models.URL) error {
+				if u.UserID == "user-42" {
+					urls = append(urls, u)
+				}
+				return nil
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkFileRepository_GetURLsByUserIDLarge измеряет выборку по пользователю из файла на 1M записей:
+// без ссылок файл не читается, а чтение прекращается на последней ссылке пользователя
+func BenchmarkFileRepository_GetURLsByUserIDLarge(b *testing.B) {
+	repo := newTestFileRepo(b)
+	fillUserIndexBench(b, repo)
+
+	for _, userID := range []string{"user-0", "user-99", "user-none"} {
+		b.Run(userID, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := repo.GetURLsByUserID(userID); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
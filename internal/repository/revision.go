@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"strconv"
+	"time"
+)
+
+// UserRevisioner реализуется хранилищами, которые ведут ревизию ссылок каждого пользователя
+// Ревизия меняется при любом изменении ссылок пользователя и не меняется от записей других пользователей,
+// поэтому по ней можно строить ETag списка ссылок
+type UserRevisioner interface {
+	// UserRevision возвращает текущую ревизию ссылок userID; false, если хранилище не ведёт ревизий
+	UserRevision(userID string) (string, bool)
+}
+
+// userRevisions хранит счётчики изменений ссылок по пользователям
+// Доступ защищается мьютексом хранилища-владельца
+type userRevisions struct {
+	epoch      string            // Отличает ревизии разных запусков процесса
+	generation uint64            // Увеличивается, когда меняются ссылки сразу всех пользователей
+	revs       map[string]uint64 // user_id -> число изменений в текущем поколении
+}
+
+// newUserRevisions создаёт счётчики ревизий для нового экземпляра хранилища
+func newUserRevisions() userRevisions {
+	return userRevisions{
+		epoch: strconv.FormatInt(time.Now().UnixNano(), 36),
+		revs:  make(map[string]uint64),
+	}
+}
+
+// bump отмечает изменение ссылок пользователей userIDs
+func (v *userRevisions) bump(userIDs ...string) {
+	for _, userID := range userIDs {
+		v.revs[userID]++
+	}
+}
+
+// bumpAll отмечает изменение ссылок всех пользователей, например после очистки или перезагрузки хранилища
+func (v *userRevisions) bumpAll() {
+	v.generation++
+	v.revs = make(map[string]uint64)
+}
+
+// revision возвращает ревизию ссылок userID
+func (v *userRevisions) revision(userID string) string {
+	return v.epoch + "." + strconv.FormatUint(v.generation, 36) + "." + strconv.FormatUint(v.revs[userID], 36)
+}
+
+// userRevisionOf возвращает ревизию ссылок пользователя, если хранилище её ведёт
+func userRevisionOf(repo Repository, userID string) (string, bool) {
+	if revisioner, ok := repo.(UserRevisioner); ok {
+		return revisioner.UserRevision(userID)
+	}
+	return "", false
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/models"
+	"go.uber.org/zap"
+)
+
+// TestUserRevision_IsolatedPerUser проверяет, что записи одного пользователя не меняют ревизию другого
+func TestUserRevision_IsolatedPerUser(t *testing.T) {
+	t.Parallel()
+	repos := map[string]func(t *testing.T) Repository{
+		"memory": func(*testing.T) Repository { return NewMemoryRepository() },
+		"file":   func(t *testing.T) Repository { return newTestFileRepo(t) },
+		"snapshot": func(t *testing.T) Repository {
+			return NewSnapshotRepository(NewMemoryRepository(), filepath.Join(t.TempDir(), "snapshot.json"), 0, 0, zap.NewNop())
+		},
+	}
+
+	for name, newRepo := range repos {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			repo := newRepo(t)
+			revision := func(userID string) string {
+				rev, ok := userRevisionOf(repo, userID)
+				assert.True(t, ok)
+				return rev
+			}
+
+			_, err := repo.SaveURL(models.URL{ShortID: "b1", OriginalURL: "https://b.example/1", UserID: "userB"})
+			assert.NoError(t, err)
+			revA, revB := revision("userA"), revision("userB")
+
+			_, err = repo.SaveURL(models.URL{ShortID: "a1", OriginalURL: "https://a.example/1", UserID: "userA"})
+			assert.NoError(t, err)
+			assert.NoError(t, repo.BatchSave([]models.BatchItem{{ShortID: "a2", OriginalURL: "https://a.example/2"}}, "userA"))
+			assert.NotEqual(t, revA, revision("userA"))
+			assert.Equal(t, revB, revision("userB"))
+
+			revA = revision("userA")
+			assert.NoError(t, repo.BatchDelete("userA", []string{"a1"}))
+			assert.NotEqual(t, revA, revision("userA"))
+			assert.Equal(t, revB, revision("userB"))
+
+			// Чужой ID в запросе на удаление не меняет ни ссылок, ни ревизии владельца
+			assert.NoError(t, repo.BatchDelete("userA", []string{"b1"}))
+			assert.Equal(t, revB, revision("userB"))
+
+			revA, revC := revision("userA"), revision("userC")
+			_, err = repo.ReassignUser("userA", "userC")
+			assert.NoError(t, err)
+			assert.NotEqual(t, revA, revision("userA"))
+			assert.NotEqual(t, revC, revision("userC"))
+			assert.Equal(t, revB, revision("userB"))
+
+			repo.Clear()
+			assert.NotEqual(t, revB, revision("userB"))
+		})
+	}
+}
@@ -0,0 +1,469 @@
+package repository
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/tempizhere/goshorty/internal/models"
+	"go.uber.org/zap"
+)
+
+// ErrListUnsupported возвращается, если основное хранилище не умеет перечислять URL для снимка
+var ErrListUnsupported = errors.New("storage does not support listing URLs")
+
+// snapshotHeader — первая строка файла снимка
+type snapshotHeader struct {
+	WrittenAt time.Time `json:"written_at"` // Время начала записи снимка
+}
+
+// snapshotEntry хранит URL в кеше вместе со временем, на которое он актуален
+type snapshotEntry struct {
+	url      models.URL
+	loadedAt time.Time
+}
+
+// SnapshotRepository кеширует чтения основного хранилища и прогревает кеш из файла снимка
+// Снимок периодически пишется в фоне (Run), а при старте загружается до первых запросов,
+// поэтому после рестарта редиректы обслуживаются из памяти, а промахи читаются из основного хранилища
+// Кеш хранит не больше maxURLs записей и вытесняет давно не читавшиеся (LRU)
+type SnapshotRepository struct {
+	Repository // Основное хранилище; запись и выборки по пользователю выполняются в нём
+
+	path    string
+	maxAge  time.Duration // Записи кеша старше этого окна не используются
+	maxURLs int           // Предел записей кеша; 0 — без ограничения
+	now     func() time.Time
+	cache   map[string]*list.Element // short_id -> элемент order со snapshotEntry
+	order   *list.List               // Записи от недавно прочитанных к давно прочитанным
+	version uint64                   // Увеличивается при каждой инвалидации, чтобы не кешировать прочитанное до записи
+	logger  *zap.Logger
+	mutex   sync.Mutex
+}
+
+// NewSnapshotRepository оборачивает next кешем не больше чем на maxURLs записей и загружает в него снимок из path
+// Отсутствующий, повреждённый или устаревший снимок не мешает старту: кеш остаётся пустым
+func NewSnapshotRepository(next Repository, path string, maxAge time.Duration, maxURLs int, logger *zap.Logger) *SnapshotRepository {
+	r := &SnapshotRepository{
+		Repository: next,
+		path:       path,
+		maxAge:     maxAge,
+		maxURLs:    maxURLs,
+		now:        time.Now,
+		cache:      make(map[string]*list.Element),
+		order:      list.New(),
+		logger:     logger,
+	}
+	if err := r.load(); err != nil && !os.IsNotExist(err) {
+		logger.Warn("Failed to load URL snapshot", zap.String("path", path), zap.Error(err))
+	}
+	return r
+}
+
+// load читает файл снимка в кеш
+func (r *SnapshotRepository) load() error {
+	file, err := os.Open(r.path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			r.logger.Error("Failed to close snapshot file", zap.Error(err))
+		}
+	}()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return scanner.Err()
+	}
+	var header snapshotHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return err
+	}
+	if !r.fresh(header.WrittenAt) {
+		r.logger.Info("Ignoring stale URL snapshot", zap.String("path", r.path), zap.Time("written_at", header.WrittenAt))
+		return nil
+	}
+
+	cache := make(map[string]*list.Element)
+	order := list.New()
+	for scanner.Scan() {
+		if r.maxURLs > 0 && order.Len() >= r.maxURLs {
+			break
+		}
+		var record URLRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		if _, exists := cache[record.ShortURL]; exists {
+			continue
+		}
+		cache[record.ShortURL] = order.PushBack(snapshotEntry{
+			url: models.URL{
+				ShortID:     record.ShortURL,
+				OriginalURL: record.OriginalURL,
+				UserID:      record.UserID,
+				Tags:        record.Tags,
+				CreatedAt:   record.createdAt(),
+				NSFW:        record.NSFW,
+				Description: record.Description,
+			},
+			loadedAt: header.WrittenAt,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	r.cache = cache
+	r.order = order
+	r.mutex.Unlock()
+	r.logger.Info("Loaded URL snapshot", zap.String("path", r.path), zap.Int("urls", len(cache)), zap.Time("written_at", header.WrittenAt))
+	return nil
+}
+
+// fresh сообщает, укладывается ли момент t в окно актуальности
+func (r *SnapshotRepository) fresh(t time.Time) bool {
+	return r.now().Sub(t) <= r.maxAge
+}
+
+// cached возвращает актуальную запись кеша и текущую версию кеша
+func (r *SnapshotRepository) cached(id string) (models.URL, bool, uint64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	el, exists := r.cache[id]
+	if !exists {
+		return models.URL{}, false, r.version
+	}
+	e := el.Value.(snapshotEntry)
+	if !r.fresh(e.loadedAt) {
+		r.remove(id)
+		return models.URL{}, false, r.version
+	}
+	r.order.MoveToFront(el)
+	return e.url, true, r.version
+}
+
+// put кладёт запись в кеш и вытесняет давно не читавшиеся записи сверх maxURLs
+// Вызывается под мьютексом
+func (r *SnapshotRepository) put(e snapshotEntry) {
+	if el, exists := r.cache[e.url.ShortID]; exists {
+		el.Value = e
+		r.order.MoveToFront(el)
+		return
+	}
+	r.cache[e.url.ShortID] = r.order.PushFront(e)
+	for r.maxURLs > 0 && r.order.Len() > r.maxURLs {
+		r.remove(r.order.Back().Value.(snapshotEntry).url.ShortID)
+	}
+}
+
+// remove удаляет запись из кеша
+// Вызывается под мьютексом
+func (r *SnapshotRepository) remove(id string) {
+	if el, exists := r.cache[id]; exists {
+		r.order.Remove(el)
+		delete(r.cache, id)
+	}
+}
+
+// fill кладёт прочитанные из основного хранилища URL в кеш, если с момента чтения не было инвалидаций
+func (r *SnapshotRepository) fill(version uint64, urls ...models.URL) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.version != version {
+		return
+	}
+	now := r.now()
+	for _, u := range urls {
+		r.put(snapshotEntry{url: u, loadedAt: now})
+	}
+}
+
+// invalidate удаляет из кеша записи с указанными ID
+func (r *SnapshotRepository) invalidate(ids ...string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.version++
+	for _, id := range ids {
+		r.remove(id)
+	}
+}
+
+// Get возвращает URL из кеша, а при промахе читает его из основного хранилища
+func (r *SnapshotRepository) Get(id string) (models.URL, bool, error) {
+	u, ok, version := r.cached(id)
+	if ok {
+		return u, true, nil
+	}
+	u, exists, err := r.Repository.Get(id)
+	if err != nil {
+		return models.URL{}, false, err
+	}
+	if exists {
+		r.fill(version, u)
+	}
+	return u, exists, nil
+}
+
+// BatchGet возвращает URL из кеша и дочитывает промахи из основного хранилища одним запросом
+func (r *SnapshotRepository) BatchGet(ids []string) (map[string]models.URL, error) {
+	result := make(map[string]models.URL, len(ids))
+	var misses []string
+	var version uint64
+	for _, id := range ids {
+		u, ok, v := r.cached(id)
+		if ok {
+			result[id] = u
+			continue
+		}
+		if len(misses) == 0 {
+			version = v
+		}
+		misses = append(misses, id)
+	}
+	if len(misses) == 0 {
+		return result, nil
+	}
+
+	found, err := r.Repository.BatchGet(misses)
+	if err != nil {
+		return nil, err
+	}
+	urls := make([]models.URL, 0, len(found))
+	for id, u := range found {
+		result[id] = u
+		urls = append(urls, u)
+	}
+	r.fill(version, urls...)
+	return result, nil
+}
+
+// Save сохраняет URL в основном хранилище и сбрасывает его запись в кеше
+func (r *SnapshotRepository) Save(id, url, userID string) (string, error) {
+	defer r.invalidate(id)
+	return r.Repository.Save(id, url, userID)
+}
+
+// SaveURL сохраняет URL в основном хранилище и сбрасывает его запись в кеше
+func (r *SnapshotRepository) SaveURL(u models.URL) (string, error) {
+	defer r.invalidate(u.ShortID)
+	return r.Repository.SaveURL(u)
+}
+
+// BatchSave сохраняет URL в основном хранилище и сбрасывает их записи в кеше
+func (r *SnapshotRepository) BatchSave(items []models.BatchItem, userID string) error {
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ShortID)
+	}
+	defer r.invalidate(ids...)
+	return r.Repository.BatchSave(items, userID)
+}
+
+// BatchDelete помечает URL удалёнными в основном хранилище и сбрасывает их записи в кеше
+func (r *SnapshotRepository) BatchDelete(userID string, ids []string) error {
+	defer r.invalidate(ids...)
+	return r.Repository.BatchDelete(userID, ids)
+}
+
+// DeleteByUserAndHost помечает удалёнными URL пользователя с указанным хостом и сбрасывает их записи в кеше
+func (r *SnapshotRepository) DeleteByUserAndHost(userID, host string) (int, error) {
+	defer func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		r.version++
+		for id, el := range r.cache {
+			if u := el.Value.(snapshotEntry).url; u.UserID == userID && hostMatches(u.OriginalURL, host) {
+				r.remove(id)
+			}
+		}
+	}()
+	return r.Repository.DeleteByUserAndHost(userID, host)
+}
+
+// ReassignUser передаёт URL пользователя в основном хранилище и сбрасывает их записи в кеше
+func (r *SnapshotRepository) ReassignUser(fromUserID, toUserID string) (int, error) {
+	defer func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+
+		r.version++
+		for id, el := range r.cache {
+			if el.Value.(snapshotEntry).url.UserID == fromUserID {
+				r.remove(id)
+			}
+		}
+	}()
+	return r.Repository.ReassignUser(fromUserID, toUserID)
+}
+
+// ClaimURL передаёт URL новому владельцу в основном хранилище и сбрасывает его запись в кеше
+func (r *SnapshotRepository) ClaimURL(id, tokenHash, userID string) error {
+	defer r.invalidate(id)
+	return r.Repository.ClaimURL(id, tokenHash, userID)
+}
+
+// SetNSFW меняет пометку URL в основном хранилище и сбрасывает его запись в кеше
+func (r *SnapshotRepository) SetNSFW(id string, nsfw bool) error {
+	defer r.invalidate(id)
+	return r.Repository.SetNSFW(id, nsfw)
+}
+
+// ReserveIDs резервирует короткие ID в основном хранилище и сбрасывает их записи в кеше
+func (r *SnapshotRepository) ReserveIDs(ids []string, userID string, createdAt time.Time) error {
+	defer r.invalidate(ids...)
+	return r.Repository.ReserveIDs(ids, userID, createdAt)
+}
+
+// ActivateReserved задаёт адрес назначения в основном хранилище и сбрасывает запись в кеше
+func (r *SnapshotRepository) ActivateReserved(id, userID, originalURL string) error {
+	defer r.invalidate(id)
+	return r.Repository.ActivateReserved(id, userID, originalURL)
+}
+
+// Clear очищает основное хранилище и кеш
+func (r *SnapshotRepository) Clear() {
+	r.Repository.Clear()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.version++
+	r.cache = make(map[string]*list.Element)
+	r.order = list.New()
+}
+
+// IndexStats возвращает размеры индексов основного хранилища и кеша снимка
+func (r *SnapshotRepository) IndexStats() []models.IndexStats {
+	stats := indexStatsOf(r.Repository)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append(stats, mapStats("snapshot_cache", r.cache, func(el *list.Element) int64 {
+		e := el.Value.(snapshotEntry)
+		return int64(unsafe.Sizeof(*el)+unsafe.Sizeof(e)) + int64(len(e.url.ShortID)+len(e.url.OriginalURL)+len(e.url.UserID))
+	}))
+}
+
+// UserRevision возвращает ревизию ссылок пользователя в основном хранилище
+func (r *SnapshotRepository) UserRevision(userID string) (string, bool) {
+	return userRevisionOf(r.Repository, userID)
+}
+
+// RecordReferrer учитывает источник перехода в основном хранилище
+func (r *SnapshotRepository) RecordReferrer(id, referrer string) error {
+	return recordReferrerIn(r.Repository, id, referrer)
+}
+
+// TopReferrers возвращает источники переходов из основного хранилища
+func (r *SnapshotRepository) TopReferrers(ids []string, limit int) (map[string][]models.ReferrerCount, error) {
+	return topReferrersOf(r.Repository, ids, limit)
+}
+
+// RecordClicks учитывает переходы в основном хранилище
+func (r *SnapshotRepository) RecordClicks(id, ref string, n int) error {
+	return recordClicksIn(r.Repository, id, ref, n)
+}
+
+// ClickCounts возвращает переходы из основного хранилища
+func (r *SnapshotRepository) ClickCounts(ids []string) (map[string]map[string]int, error) {
+	return clickCountsOf(r.Repository, ids)
+}
+
+// WriteSnapshot потоково записывает активные URL основного хранилища в файл снимка
+// Снимок пишется во временный файл и атомарно заменяет предыдущий
+func (r *SnapshotRepository) WriteSnapshot(ctx context.Context) error {
+	lister, ok := r.Repository.(URLLister)
+	if !ok {
+		return ErrListUnsupported
+	}
+
+	dir := filepath.Dir(r.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(r.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer func() {
+		if tmp != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmpPath)
+		}
+	}()
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	if err := encoder.Encode(snapshotHeader{WrittenAt: r.now()}); err != nil {
+		return err
+	}
+	count := 0
+	err = lister.List(ctx, func(u models.URL) error {
+		count++
+		record := URLRecord{
+			UUID:        u.ShortID,
+			ShortURL:    u.ShortID,
+			OriginalURL: u.OriginalURL,
+			UserID:      u.UserID,
+			Tags:        u.Tags,
+			NSFW:        u.NSFW,
+			Description: u.Description,
+		}
+		if !u.CreatedAt.IsZero() {
+			record.CreatedAt = u.CreatedAt.Unix()
+		}
+		return encoder.Encode(record)
+	})
+	if err != nil {
+		return err
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	tmp = nil
+	if err := os.Rename(tmpPath, r.path); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	r.logger.Debug("Wrote URL snapshot", zap.String("path", r.path), zap.Int("urls", count))
+	return nil
+}
+
+// Run раз в interval записывает снимок до отмены контекста
+func (r *SnapshotRepository) Run(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.WriteSnapshot(ctx); err != nil && ctx.Err() == nil {
+				r.logger.Error("Failed to write URL snapshot", zap.String("path", r.path), zap.Error(err))
+			}
+		}
+	}
+}
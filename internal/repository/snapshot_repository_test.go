@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/models"
+	"go.uber.org/zap"
+)
+
+// unavailableRepository имитирует недоступную базу данных
+type unavailableRepository struct {
+	Repository
+	gets int
+}
+
+func (r *unavailableRepository) Get(id string) (models.URL, bool, error) {
+	r.gets++
+	return models.URL{}, false, errors.New("database is unavailable")
+}
+
+func (r *unavailableRepository) BatchGet(ids []string) (map[string]models.URL, error) {
+	return nil, errors.New("database is unavailable")
+}
+
+// writeTestSnapshot сохраняет URL в in-memory хранилище и записывает их снимок в path
+func writeTestSnapshot(t *testing.T, path string, urls map[string]string) *MemoryRepository {
+	source := NewMemoryRepository()
+	for id, url := range urls {
+		_, err := source.Save(id, url, "user1")
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, NewSnapshotRepository(source, path, time.Hour, 0, zap.NewNop()).WriteSnapshot(context.Background()))
+	return source
+}
+
+func TestSnapshotRepository_Restart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	source := writeTestSnapshot(t, path, map[string]string{
+		"id1": "https://example1.com",
+		"id2": "https://example2.com",
+		"id3": "https://example3.com",
+	})
+	assert.NoError(t, source.BatchDelete("user1", []string{"id3"}))
+	assert.NoError(t, NewSnapshotRepository(source, path, time.Hour, 0, zap.NewNop()).WriteSnapshot(context.Background()))
+
+	// После рестарта база ещё недоступна, но URL из снимка разрешаются
+	db := &unavailableRepository{}
+	repo := NewSnapshotRepository(db, path, time.Hour, 0, zap.NewNop())
+
+	u, exists, _ := repo.Get("id1")
+	assert.True(t, exists)
+	assert.Equal(t, "https://example1.com", u.OriginalURL)
+	assert.Equal(t, "user1", u.UserID)
+	assert.Equal(t, 0, db.gets, "Snapshot hit should not query the database")
+
+	found, err := repo.BatchGet([]string{"id1", "id2"})
+	assert.NoError(t, err)
+	assert.Len(t, found, 2)
+
+	// Удалённые URL в снимок не попадают, промах уходит в базу
+	_, exists, _ = repo.Get("id3")
+	assert.False(t, exists)
+	assert.Equal(t, 1, db.gets)
+}
+
+func TestSnapshotRepository_StaleSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	writeTestSnapshot(t, path, map[string]string{"id1": "https://example1.com"})
+
+	// Снимок старше окна актуальности не используется
+	stale := NewSnapshotRepository(&unavailableRepository{}, path, time.Nanosecond, 0, zap.NewNop())
+	_, exists, _ := stale.Get("id1")
+	assert.False(t, exists)
+
+	// Записи устаревают и во время работы
+	repo := NewSnapshotRepository(&unavailableRepository{}, path, time.Hour, 0, zap.NewNop())
+	_, exists, _ = repo.Get("id1")
+	assert.True(t, exists)
+	repo.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, exists, _ = repo.Get("id1")
+	assert.False(t, exists)
+}
+
+func TestSnapshotRepository_MissingOrCorruptSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	db := NewMemoryRepository()
+	_, err := db.Save("id1", "https://example1.com", "user1")
+	assert.NoError(t, err)
+
+	corrupt := filepath.Join(dir, "corrupt.json")
+	assert.NoError(t, os.WriteFile(corrupt, []byte("not json\n"), 0644))
+
+	for _, path := range []string{filepath.Join(dir, "missing.json"), corrupt} {
+		repo := NewSnapshotRepository(db, path, time.Hour, 0, zap.NewNop())
+		u, exists, _ := repo.Get("id1")
+		assert.True(t, exists, "Miss should fall back to the database")
+		assert.Equal(t, "https://example1.com", u.OriginalURL)
+	}
+}
+
+func TestSnapshotRepository_InvalidateOnWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	db := writeTestSnapshot(t, path, map[string]string{
+		"id1": "https://old.example.com/a",
+		"id2": "https://example2.com",
+	})
+	repo := NewSnapshotRepository(db, path, time.Hour, 0, zap.NewNop())
+
+	// Удаление сбрасывает запись кеша, и следующее чтение видит флаг из базы
+	assert.NoError(t, repo.BatchDelete("user1", []string{"id2"}))
+	u, exists, _ := repo.Get("id2")
+	assert.True(t, exists)
+	assert.True(t, u.DeletedFlag)
+
+	deleted, err := repo.DeleteByUserAndHost("user1", "old.example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	u, exists, _ = repo.Get("id1")
+	assert.True(t, exists)
+	assert.True(t, u.DeletedFlag)
+
+	// Новый URL читается из базы и кешируется
+	_, err = repo.Save("id3", "https://example3.com", "user1")
+	assert.NoError(t, err)
+	_, exists, _ = repo.Get("id3")
+	assert.True(t, exists)
+	db.Clear()
+	u, exists, _ = repo.Get("id3")
+	assert.True(t, exists, "URL read from the database should be cached")
+	assert.Equal(t, "https://example3.com", u.OriginalURL)
+
+	repo.Clear()
+	_, exists, _ = repo.Get("id3")
+	assert.False(t, exists)
+}
+
+func TestSnapshotRepository_WriteSnapshotUnsupported(t *testing.T) {
+	repo := NewSnapshotRepository(&unavailableRepository{}, filepath.Join(t.TempDir(), "snapshot.json"), time.Hour, 0, zap.NewNop())
+	assert.ErrorIs(t, repo.WriteSnapshot(context.Background()), ErrListUnsupported)
+}
+
+func TestSnapshotRepository_MaxURLs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	db := writeTestSnapshot(t, path, map[string]string{
+		"id1": "https://example1.com",
+		"id2": "https://example2.com",
+		"id3": "https://example3.com",
+	})
+
+	// Из снимка загружается не больше maxURLs записей
+	loaded := NewSnapshotRepository(&unavailableRepository{}, path, time.Hour, 2, zap.NewNop())
+	stats := loaded.IndexStats()
+	assert.Equal(t, 2, stats[len(stats)-1].Entries)
+
+	// Дочитанные из базы записи вытесняют давно не читавшиеся
+	repo := NewSnapshotRepository(db, filepath.Join(t.TempDir(), "missing.json"), time.Hour, 2, zap.NewNop())
+	for _, id := range []string{"id1", "id2", "id1", "id3"} {
+		_, exists, err := repo.Get(id)
+		assert.NoError(t, err)
+		assert.True(t, exists)
+	}
+	stats = repo.IndexStats()
+	assert.Equal(t, 2, stats[len(stats)-1].Entries)
+
+	db.Clear()
+	_, exists, _ := repo.Get("id1")
+	assert.True(t, exists, "Recently read URL should stay cached")
+	_, exists, _ = repo.Get("id3")
+	assert.True(t, exists)
+	_, exists, _ = repo.Get("id2")
+	assert.False(t, exists, "Least recently read URL should be evicted")
+}
+
+func TestSnapshotRepository_OfflineStart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	source := NewMemoryRepository()
+	created := time.Now().Add(-time.Hour).Truncate(time.Second)
+	_, err := source.SaveURL(models.URL{
+		ShortID:     "id1",
+		OriginalURL: "https://example1.com",
+		UserID:      "user1",
+		Tags:        []string{"news"},
+		CreatedAt:   created,
+		Description: "Example",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, NewSnapshotRepository(source, path, time.Hour, 0, zap.NewNop()).WriteSnapshot(context.Background()))
+	before, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	// База не поднялась к старту: редиректы обслуживаются из снимка со всеми атрибутами
+	repo := NewSnapshotRepository(NewOfflineRepository("postgres", errors.New("connection refused")), path, time.Hour, 0, zap.NewNop())
+	u, exists, err := repo.Get("id1")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, []string{"news"}, u.Tags)
+	assert.True(t, created.Equal(u.CreatedAt))
+	assert.Equal(t, "Example", u.Description)
+
+	// Промахи и записи завершаются ErrUnavailable, а снимок не перезаписывается
+	_, _, err = repo.Get("id2")
+	assert.ErrorIs(t, err, ErrUnavailable)
+	_, err = repo.Save("id2", "https://example2.com", "user1")
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.ErrorIs(t, repo.WriteSnapshot(context.Background()), ErrUnavailable)
+	after, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, before, after)
+}
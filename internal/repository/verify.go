@@ -0,0 +1,48 @@
+package repository
+
+// Виды нарушений, которые находит проверка хранилища
+const (
+	ViolationInvalidLine          = "invalid_line"           // Строка файла не разбирается как JSON
+	ViolationEmptyShortID         = "empty_short_id"         // Запись без короткого ID
+	ViolationDuplicateShortID     = "duplicate_short_id"     // Повтор записи с тем же ID, URL и владельцем
+	ViolationConflictingShortID   = "conflicting_short_id"   // Один короткий ID у разных URL или владельцев
+	ViolationDuplicateOriginalURL = "duplicate_original_url" // Один original_url у нескольких коротких ID
+	ViolationOrphanTombstone      = "orphan_tombstone"       // Надгробие для неизвестного ID или чужого пользователя
+	ViolationOrphanTransfer       = "orphan_transfer"        // Запись передачи для неизвестного ID
+	ViolationOrphanActivation     = "orphan_activation"      // Запись активации для ID, который не зарезервирован этим пользователем
+	ViolationOrphanModeration     = "orphan_moderation"      // Запись модерации для неизвестного ID
+	ViolationIndexMismatch        = "index_mismatch"         // Данные в памяти расходятся с файлом
+)
+
+// Violation описывает одно нарушение целостности хранилища
+type Violation struct {
+	Kind       string `json:"kind"`               // Вид нарушения (константы Violation*)
+	ShortID    string `json:"short_id,omitempty"` // Короткий ID, к которому относится нарушение
+	Line       int    `json:"line,omitempty"`     // Номер строки файла, начиная с 1
+	Detail     string `json:"detail,omitempty"`   // Подробности
+	Repairable bool   `json:"repairable"`         // Нарушение исправляется без потери данных
+	Repaired   bool   `json:"repaired"`           // Нарушение исправлено
+}
+
+// VerifyReport содержит результат проверки хранилища
+type VerifyReport struct {
+	Backend    string      `json:"backend"`    // Имя хранилища
+	Records    int         `json:"records"`    // Количество проверенных записей
+	Violations []Violation `json:"violations"` // Найденные нарушения
+}
+
+// Failed сообщает, остались ли неисправленные нарушения
+func (r VerifyReport) Failed() bool {
+	for _, v := range r.Violations {
+		if !v.Repaired {
+			return true
+		}
+	}
+	return false
+}
+
+// Verifier проверяет целостность хранилища
+type Verifier interface {
+	// Verify проверяет инварианты хранилища; при repair исправляет нарушения с Repairable
+	Verify(repair bool) (VerifyReport, error)
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"errors"
+)
+
+// BatchLimitPolicy задаёт поведение пакетного сокращения, когда все слоты одновременных пакетов заняты
+type BatchLimitPolicy string
+
+const (
+	// BatchLimitQueue — ждать освобождения слота, пока контекст запроса не отменён (по умолчанию)
+	BatchLimitQueue BatchLimitPolicy = "queue"
+	// BatchLimitReject — сразу возвращать ErrBatchLimit
+	BatchLimitReject BatchLimitPolicy = "reject"
+)
+
+// ErrBatchLimit возвращается, если одновременно выполняется максимальное число пакетов и политика — BatchLimitReject
+var ErrBatchLimit = errors.New("too many concurrent batch operations")
+
+// WithBatchConcurrency ограничивает число одновременно выполняемых пакетных сокращений,
+// чтобы поток больших пакетов не перегружал хранилище. Неположительный limit снимает ограничение
+func WithBatchConcurrency(limit int, policy BatchLimitPolicy) Option {
+	return func(s *Service) {
+		if limit <= 0 {
+			s.batchSlots = nil
+			return
+		}
+		s.batchSlots = make(chan struct{}, limit)
+		s.batchReject = policy == BatchLimitReject
+	}
+}
+
+// acquireBatch занимает слот пакета и возвращает функцию его освобождения
+// При заполненных слотах ждёт или возвращает ErrBatchLimit в зависимости от политики
+func (s *Service) acquireBatch(ctx context.Context) (func(), error) {
+	if s.batchSlots == nil {
+		return func() {}, nil
+	}
+	release := func() { <-s.batchSlots }
+	select {
+	case s.batchSlots <- struct{}{}:
+		return release, nil
+	default:
+	}
+	if s.batchReject {
+		return nil, ErrBatchLimit
+	}
+	select {
+	case s.batchSlots <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+
+	"github.com/tempizhere/goshorty/internal/events"
+	"github.com/tempizhere/goshorty/internal/models"
+	"github.com/tempizhere/goshorty/internal/repository"
+)
+
+// claimTokenBytes — длина токена владения в байтах до кодирования
+const claimTokenBytes = 32
+
+// hashClaimToken возвращает SHA-256 токена владения; в хранилище попадает только хеш
+func hashClaimToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// newClaimToken генерирует одноразовый токен владения в base64url без дополнения
+func newClaimToken() (string, error) {
+	b := make([]byte, claimTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CreateClaimableShortURL создаёт короткий URL для анонимного пользователя и выдаёт одноразовый токен владения
+// Токен возвращается только здесь: хранилище знает лишь его хеш. Для уже существующего URL токен не выдаётся
+// Возвращает ID, короткий URL и токен
+func (s *Service) CreateClaimableShortURL(originalURL, userID string, tags []string, description string) (string, string, string, error) {
+	description, err := s.normalizeDescription(description)
+	if err != nil {
+		return "", "", "", err
+	}
+	token, err := newClaimToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	id, shortURL, err := s.saveWithGeneratedID(models.URL{
+		OriginalURL:    originalURL,
+		UserID:         userID,
+		Tags:           normalizeTags(tags),
+		Description:    description,
+		ClaimTokenHash: hashClaimToken(token),
+	}, s.repo.SaveURL)
+	if err != nil {
+		return id, shortURL, "", err
+	}
+	return id, shortURL, token, nil
+}
+
+// ClaimURL передаёт URL с идентификатором id пользователю userID по токену владения
+// Токен одноразовый: после успешной передачи он гасится. Неверный или использованный токен даёт ErrClaimRejected
+func (s *Service) ClaimURL(id, token, userID string) (models.ShortURLResponse, error) {
+	if token == "" {
+		return models.ShortURLResponse{}, repository.ErrClaimRejected
+	}
+	if err := s.repo.ClaimURL(id, hashClaimToken(token), userID); err != nil {
+		return models.ShortURLResponse{}, err
+	}
+
+	s.userStatsMu.Lock()
+	delete(s.userStatsCache, userID)
+	s.userStatsMu.Unlock()
+	s.publish(events.Updated, id)
+
+	u, ok, err := s.repo.Get(id)
+	if err != nil {
+		return models.ShortURLResponse{}, err
+	}
+	if !ok {
+		return models.ShortURLResponse{}, errors.New("claimed URL not found")
+	}
+	return s.toShortURLResponses([]models.URL{u})[0], nil
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"container/list"
+	"hash/fnv"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tempizhere/goshorty/internal/models"
+)
+
+// ClickRecorder сохраняет переходы по коротким ссылкам для аналитики
+type ClickRecorder interface {
+	// RecordClick учитывает переход по id с меткой кампании ref ("" — без метки);
+	// weight — число реальных переходов, которые представляет запись
+	RecordClick(id, ref string, weight int)
+}
+
+// DefaultHotLinksCapacity — число ссылок, для которых по умолчанию хранится состояние ограничителя переходов
+const DefaultHotLinksCapacity = 1000
+
+// DefaultHitCountsCapacity — число ссылок, для которых хранятся счётчики переходов с момента запуска
+const DefaultHitCountsCapacity = 100000
+
+// hitShards — число частей счётчиков переходов со своими блокировками
+const hitShards = 16
+
+// hitEntry — счётчик переходов одной ссылки
+type hitEntry struct {
+	id   string
+	hits int64
+}
+
+// hitShard — часть счётчиков переходов со своей блокировкой и очередью вытеснения
+type hitShard struct {
+	mu      sync.Mutex
+	order   *list.List // Счётчики от недавно использованных к давно использованным
+	entries map[string]*list.Element
+}
+
+// hitCounter считает переходы по ссылкам с момента запуска. Счётчики разбиты на hitShards частей, чтобы
+// переходы по разным ссылкам не ждали одну блокировку; каждая часть хранит не более capacity/hitShards
+// недавно открытых ссылок, давно не открывавшиеся вытесняются (LRU), и их счёт начинается заново
+type hitCounter struct {
+	perShard int
+	shards   [hitShards]hitShard
+}
+
+// newHitCounter создаёт счётчики переходов не более чем для capacity ссылок
+func newHitCounter(capacity int) *hitCounter {
+	c := &hitCounter{perShard: max(capacity/hitShards, 1)}
+	for i := range c.shards {
+		c.shards[i].order = list.New()
+		c.shards[i].entries = make(map[string]*list.Element)
+	}
+	return c
+}
+
+// shard возвращает часть, в которой хранится счётчик id
+func (c *hitCounter) shard(id string) *hitShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+	return &c.shards[h.Sum32()%hitShards]
+}
+
+// add учитывает переход по id
+func (c *hitCounter) add(id string) {
+	sh := c.shard(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if el, ok := sh.entries[id]; ok {
+		sh.order.MoveToFront(el)
+		el.Value.(*hitEntry).hits++
+		return
+	}
+	sh.entries[id] = sh.order.PushFront(&hitEntry{id: id, hits: 1})
+	if sh.order.Len() > c.perShard {
+		oldest := sh.order.Back()
+		sh.order.Remove(oldest)
+		delete(sh.entries, oldest.Value.(*hitEntry).id)
+	}
+}
+
+// get возвращает число переходов по id; для вытесненной или не открывавшейся ссылки — 0
+func (c *hitCounter) get(id string) int64 {
+	sh := c.shard(id)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if el, ok := sh.entries[id]; ok {
+		return el.Value.(*hitEntry).hits
+	}
+	return 0
+}
+
+// clickBucket хранит маркерную корзину и счётчики переходов одной ссылки
+type clickBucket struct {
+	id       string
+	tokens   float64
+	updated  time.Time
+	clicks   int64 // Переходов с момента попадания ссылки в ограничитель
+	recorded int64 // Из них записано
+	skipped  int   // Пропущено после последней записи; добавляется к весу следующей
+}
+
+// clickLimiter ограничивает запись переходов по каждой ссылке маркерной корзиной
+// Состояние хранится только для capacity недавно открытых ссылок: давно не открывавшиеся вытесняются (LRU)
+type clickLimiter struct {
+	rate     float64 // Переходов в секунду, записываемых по одной ссылке
+	burst    float64 // Ёмкость корзины
+	capacity int
+	mu       sync.Mutex
+	order    *list.List // Корзины от недавно использованных к давно использованным
+	buckets  map[string]*list.Element
+}
+
+// newClickLimiter создаёт ограничитель на rate записей в секунду для каждой из не более чем capacity ссылок
+func newClickLimiter(rate float64, capacity int) *clickLimiter {
+	if capacity <= 0 {
+		capacity = DefaultHotLinksCapacity
+	}
+	return &clickLimiter{
+		rate:     rate,
+		burst:    math.Max(rate, 1),
+		capacity: capacity,
+		order:    list.New(),
+		buckets:  make(map[string]*list.Element),
+	}
+}
+
+// take учитывает переход по id и возвращает вес его записи; 0 означает, что переход не записывается
+func (l *clickLimiter) take(id string, now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var b *clickBucket
+	if el, ok := l.buckets[id]; ok {
+		l.order.MoveToFront(el)
+		b = el.Value.(*clickBucket)
+	} else {
+		b = &clickBucket{id: id, tokens: l.burst, updated: now}
+		l.buckets[id] = l.order.PushFront(b)
+		if l.order.Len() > l.capacity {
+			oldest := l.order.Back()
+			l.order.Remove(oldest)
+			delete(l.buckets, oldest.Value.(*clickBucket).id)
+		}
+	}
+
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed.Seconds()*l.rate)
+		b.updated = now
+	}
+	b.clicks++
+	if b.tokens < 1 {
+		b.skipped++
+		return 0
+	}
+	b.tokens--
+	b.recorded++
+	weight := 1 + b.skipped
+	b.skipped = 0
+	return weight
+}
+
+// hot возвращает ссылки, переходы по которым записывались выборочно, по убыванию числа переходов
+func (l *clickLimiter) hot() []models.HotLink {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var links []models.HotLink
+	for el := l.order.Front(); el != nil; el = el.Next() {
+		b := el.Value.(*clickBucket)
+		if b.recorded == b.clicks {
+			continue
+		}
+		links = append(links, models.HotLink{
+			ShortID:      b.id,
+			Clicks:       b.clicks,
+			Recorded:     b.recorded,
+			SampleFactor: float64(b.clicks) / float64(b.recorded),
+		})
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].Clicks != links[j].Clicks {
+			return links[i].Clicks > links[j].Clicks
+		}
+		return links[i].ShortID < links[j].ShortID
+	})
+	return links
+}
+
+// WithClickRecorder задаёт получателя переходов по коротким ссылкам; без него переходы не записываются
+// Переходы в хранилище записывает repository.ClickBuffer
+func WithClickRecorder(recorder ClickRecorder) Option {
+	return func(s *Service) {
+		s.clickRecorder = recorder
+	}
+}
+
+// WithClickRateLimit ограничивает запись переходов по одной ссылке perSecond переходами в секунду
+// Состояние ограничителя хранится для capacity недавно открытых ссылок (по умолчанию DefaultHotLinksCapacity)
+// Неположительный perSecond отключает ограничение
+func WithClickRateLimit(perSecond float64, capacity int) Option {
+	return func(s *Service) {
+		if perSecond > 0 {
+			s.clicks = newClickLimiter(perSecond, capacity)
+		}
+	}
+}
+
+// TrackClick учитывает переход по короткой ссылке с меткой кампании ref ("" — без метки) в аналитике;
+// редирект от результата не зависит
+// Переходы сверх лимита WithClickRateLimit не записываются, а их число добавляется к весу следующей записи,
+// поэтому сумма весов восстанавливает реальное число переходов
+func (s *Service) TrackClick(id, ref string) {
+	s.hits.add(id)
+
+	weight := 1
+	if s.clicks != nil {
+		weight = s.clicks.take(id, s.now())
+		if weight == 0 {
+			return
+		}
+	}
+	if s.clickRecorder != nil {
+		s.clickRecorder.RecordClick(id, ref, weight)
+	}
+}
+
+// Hits возвращает число переходов по ссылке с момента запуска сервиса, включая не записанные из-за лимита
+// Счётчики хранятся для DefaultHitCountsCapacity недавно открытых ссылок; для вытесненных счёт начинается заново
+func (s *Service) Hits(id string) int64 {
+	return s.hits.get(id)
+}
+
+// HotLinks возвращает ссылки, переходы по которым сейчас записываются выборочно
+func (s *Service) HotLinks() []models.HotLink {
+	if s.clicks == nil {
+		return nil
+	}
+	return s.clicks.hot()
+}
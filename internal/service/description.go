@@ -0,0 +1,50 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/tempizhere/goshorty/internal/models"
+)
+
+// DefaultMaxDescriptionLength — максимальная длина описания ссылки в символах по умолчанию
+const DefaultMaxDescriptionLength = 500
+
+// ErrDescriptionTooLong возвращается, если описание ссылки длиннее настроенного предела
+var ErrDescriptionTooLong = errors.New("description too long")
+
+// WithMaxDescriptionLength задаёт максимальную длину описания ссылки в символах
+// Неположительное значение оставляет DefaultMaxDescriptionLength
+func WithMaxDescriptionLength(maxLength int) Option {
+	return func(s *Service) {
+		s.maxDescription = maxLength
+	}
+}
+
+// normalizeDescription убирает пробелы по краям описания и проверяет его длину
+func (s *Service) normalizeDescription(description string) (string, error) {
+	description = strings.TrimSpace(description)
+	limit := s.maxDescription
+	if limit <= 0 {
+		limit = DefaultMaxDescriptionLength
+	}
+	if utf8.RuneCountInString(description) > limit {
+		return "", ErrDescriptionTooLong
+	}
+	return description, nil
+}
+
+// CreateShortURLWithDetails создаёт короткий URL с метками и описанием для указанного пользователя
+func (s *Service) CreateShortURLWithDetails(originalURL, userID string, tags []string, description string) (string, string, error) {
+	description, err := s.normalizeDescription(description)
+	if err != nil {
+		return "", "", err
+	}
+	return s.saveWithGeneratedID(models.URL{
+		OriginalURL: originalURL,
+		UserID:      userID,
+		Tags:        normalizeTags(tags),
+		Description: description,
+	}, s.repo.SaveURL)
+}
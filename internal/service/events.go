@@ -0,0 +1,41 @@
+package service
+
+import (
+	"github.com/tempizhere/goshorty/internal/events"
+)
+
+// WithNotifier включает рассылку событий о создании, удалении и изменении ссылок через notifier
+func WithNotifier(notifier *events.Notifier) Option {
+	return func(s *Service) {
+		s.notifier = notifier
+	}
+}
+
+// Events возвращает получатель событий об изменении ссылок; nil, если рассылка не включена
+func (s *Service) Events() *events.Notifier {
+	return s.notifier
+}
+
+// publish рассылает событие typ для каждого из коротких ID
+func (s *Service) publish(typ events.Type, ids ...string) {
+	for _, id := range ids {
+		s.notifier.Publish(events.Event{Type: typ, ShortID: id, Time: s.now()})
+	}
+}
+
+// deletableIDs возвращает ID из списка, которые принадлежат пользователю и ещё не удалены,
+// чтобы рассылать события только о действительно удаляемых ссылках
+func (s *Service) deletableIDs(userID string, ids []string) []string {
+	found, err := s.repo.BatchGet(ids)
+	if err != nil {
+		return nil
+	}
+	deletable := make([]string, 0, len(found))
+	for _, id := range ids {
+		if u, ok := found[id]; ok && u.UserID == userID && !u.DeletedFlag && !u.Reserved {
+			deletable = append(deletable, id)
+			delete(found, id)
+		}
+	}
+	return deletable
+}
@@ -46,7 +46,7 @@ func ExampleService_CreateShortURL() {
 	originalURL := "https://example.com/very-long-url"
 	userID := "user-123"
 
-	shortURL, err := svc.CreateShortURL(originalURL, userID)
+	_, shortURL, err := svc.CreateShortURL(originalURL, userID)
 	if err != nil {
 		fmt.Printf("Ошибка создания URL: %v\n", err)
 		return
@@ -72,13 +72,13 @@ func ExampleService_GetOriginalURL() {
 	originalURL := "https://example.com/very-long-url"
 	userID := "user-123"
 
-	shortURL, _ := svc.CreateShortURL(originalURL, userID)
+	_, shortURL, _ := svc.CreateShortURL(originalURL, userID)
 
 	// Извлекаем ID из короткого URL
 	shortID := shortURL[len("http://localhost:8080/"):]
 
 	// Получаем оригинальный URL
-	retrievedURL, exists := svc.GetOriginalURL(shortID)
+	retrievedURL, exists, _ := svc.GetOriginalURL(shortID)
 	if !exists {
 		fmt.Println("URL не найден")
 		return
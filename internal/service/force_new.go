@@ -0,0 +1,41 @@
+package service
+
+import (
+	"github.com/tempizhere/goshorty/internal/models"
+	"github.com/tempizhere/goshorty/internal/repository"
+)
+
+// ErrDuplicatesUnsupported возвращается, если хранилище не допускает нескольких ссылок на один URL
+// (см. repository.DuplicateSaver): например, в PostgreSQL original_url уникален
+var ErrDuplicatesUnsupported = repository.ErrDuplicatesUnsupported
+
+// CreateShortURLForceNew создаёт новый короткий URL, даже если originalURL уже сокращён, минуя поиск существующей ссылки
+// Если claimable, выдаётся одноразовый токен владения, как в CreateClaimableShortURL
+func (s *Service) CreateShortURLForceNew(originalURL, userID string, tags []string, description string, claimable bool) (string, string, string, error) {
+	saver, ok := s.repo.(repository.DuplicateSaver)
+	if !ok {
+		return "", "", "", ErrDuplicatesUnsupported
+	}
+	description, err := s.normalizeDescription(description)
+	if err != nil {
+		return "", "", "", err
+	}
+	u := models.URL{
+		OriginalURL: originalURL,
+		UserID:      userID,
+		Tags:        normalizeTags(tags),
+		Description: description,
+	}
+	var token string
+	if claimable {
+		if token, err = newClaimToken(); err != nil {
+			return "", "", "", err
+		}
+		u.ClaimTokenHash = hashClaimToken(token)
+	}
+	id, shortURL, err := s.saveWithGeneratedID(u, saver.SaveDuplicateURL)
+	if err != nil {
+		return "", "", "", err
+	}
+	return id, shortURL, token, nil
+}
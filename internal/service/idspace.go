@@ -0,0 +1,36 @@
+package service
+
+import (
+	"expvar"
+	"math"
+)
+
+// idGenerationRetries считает повторные генерации коротких ID из-за коллизий с занятыми ID
+// Рост счётчика раньше доли занятых ID (IDSpaceFillRatio) показывает, что длину ID пора увеличить
+var idGenerationRetries = expvar.NewInt("id_generation_retries")
+
+// WithShortIDLength задаёт длину генерируемых коротких ID; идентификаторы пользователей не затрагиваются
+// Неположительное значение оставляет длину по умолчанию (8 символов)
+func WithShortIDLength(length int) Option {
+	return func(s *Service) {
+		if length > 0 {
+			s.idLength = length
+		}
+	}
+}
+
+// ShortIDLength возвращает длину генерируемых коротких ID
+func (s *Service) ShortIDLength() int {
+	return s.idLength
+}
+
+// IDSpaceFillRatio оценивает долю занятых коротких ID: число ID в хранилище, включая удалённые
+// и зарезервированные, к числу возможных ID (alphabet^length). С ростом доли растёт число
+// повторных генераций при коллизиях
+func (s *Service) IDSpaceFillRatio() (float64, error) {
+	count, err := s.repo.Count()
+	if err != nil {
+		return 0, err
+	}
+	return float64(count) / math.Pow(float64(s.idAlphabetSize), float64(s.idLength)), nil
+}
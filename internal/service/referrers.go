@@ -0,0 +1,96 @@
+package service
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/tempizhere/goshorty/internal/models"
+	"github.com/tempizhere/goshorty/internal/repository"
+)
+
+// topReferrersLimit — число источников каждой ссылки в статистике пользователя
+const topReferrersLimit = 5
+
+// WithReferrerTracking включает учёт источников переходов (RecordReferrer) в хранилищах, которые его поддерживают
+// По умолчанию выключено: каждый переход с заголовком Referer стоит записи в хранилище
+func WithReferrerTracking(enabled bool) Option {
+	return func(s *Service) {
+		s.trackReferrers = enabled
+	}
+}
+
+// TracksReferrers сообщает, включён ли учёт источников переходов
+func (s *Service) TracksReferrers() bool {
+	return s.trackReferrers
+}
+
+// normalizeReferrer сводит значение заголовка Referer к хосту источника в нижнем регистре
+// Путь и query не сохраняются: они могут содержать персональные данные и дробят статистику
+// Пустая строка означает, что источник не определён
+func normalizeReferrer(referrer string) string {
+	u, err := url.Parse(strings.TrimSpace(referrer))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// RecordReferrer учитывает переход по ссылке id с источника из заголовка Referer
+// Без WithReferrerTracking, с неразборчивым источником или в хранилище без учёта источников ничего не делает
+func (s *Service) RecordReferrer(id, referrer string) error {
+	if !s.trackReferrers {
+		return nil
+	}
+	store, ok := s.repo.(repository.ReferrerStore)
+	if !ok {
+		return nil
+	}
+	host := normalizeReferrer(referrer)
+	if host == "" {
+		return nil
+	}
+	return store.RecordReferrer(id, host)
+}
+
+// topReferrers возвращает основные источники переходов по активным ссылкам пользователя,
+// начиная со ссылок с наибольшим числом переходов с этих источников
+func (s *Service) topReferrers(userID string) ([]models.LinkReferrers, error) {
+	store, ok := s.repo.(repository.ReferrerStore)
+	if !ok {
+		return nil, nil
+	}
+	urls, err := s.repo.GetURLsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(urls))
+	for _, u := range urls {
+		if !u.DeletedFlag {
+			ids = append(ids, u.ShortID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	byID, err := store.TopReferrers(ids, topReferrersLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	links := make([]models.LinkReferrers, 0, len(byID))
+	totals := make(map[string]int, len(byID))
+	for id, referrers := range byID {
+		links = append(links, models.LinkReferrers{ShortID: id, Referrers: referrers})
+		for _, ref := range referrers {
+			totals[id] += ref.Clicks
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		if totals[links[i].ShortID] != totals[links[j].ShortID] {
+			return totals[links[i].ShortID] > totals[links[j].ShortID]
+		}
+		return links[i].ShortID < links[j].ShortID
+	})
+	return links, nil
+}
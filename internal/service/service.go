@@ -4,13 +4,21 @@
 package service
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"os"
+	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/tempizhere/goshorty/internal/events"
 	"github.com/tempizhere/goshorty/internal/models"
 	"github.com/tempizhere/goshorty/internal/repository"
 )
@@ -18,6 +26,9 @@ import (
 // ErrEmptyURL возвращается при попытке создать короткий URL из пустой строки
 var ErrEmptyURL = errors.New("empty URL")
 
+// ErrInvalidURL возвращается, если сокращаемая строка не является абсолютным URL
+var ErrInvalidURL = errors.New("invalid URL")
+
 // ErrEmptyID возвращается при попытке создать URL с пустым ID
 var ErrEmptyID = errors.New("empty ID")
 
@@ -36,50 +47,324 @@ var ErrUniqueIDFailed = errors.New("failed to generate unique ID")
 // ErrInvalidToken возвращается при неверном или истёкшем JWT токене
 var ErrInvalidToken = errors.New("invalid token")
 
+// ErrExpiredToken — частный случай ErrInvalidToken: подпись JWT верна, истёк только срок действия
+var ErrExpiredToken = fmt.Errorf("%w: expired", ErrInvalidToken)
+
+// ExpiredTokenError возвращается ParseJWT вместе с user_id, если у токена с верной подписью истёк срок действия
+type ExpiredTokenError struct {
+	Expired time.Duration // Сколько времени прошло с истечения срока по часам сервиса
+}
+
+// Error возвращает текст ErrExpiredToken
+func (e *ExpiredTokenError) Error() string {
+	return ErrExpiredToken.Error()
+}
+
+// Unwrap позволяет сравнивать ошибку с ErrExpiredToken и ErrInvalidToken через errors.Is
+func (e *ExpiredTokenError) Unwrap() error {
+	return ErrExpiredToken
+}
+
+// ExpiredFor возвращает, сколько времени прошло с истечения срока действия токена
+func (e *ExpiredTokenError) ExpiredFor() time.Duration {
+	return e.Expired
+}
+
+// ErrReservedID возвращается при попытке создать URL с зарезервированным ID
+var ErrReservedID = errors.New("reserved ID")
+
+// ErrInvalidHost возвращается, если хост для удаления URL пуст или содержит схему, порт или путь
+var ErrInvalidHost = errors.New("invalid host")
+
+// reservedIDs содержит ID, совпадающие со служебными путями сервиса
+var reservedIDs = map[string]struct{}{
+	"favicon.ico": {},
+	"robots.txt":  {},
+	"ping":        {},
+	"readyz":      {},
+	"api":         {},
+}
+
+// IsReservedID проверяет, зарезервирован ли ID под служебный путь
+func IsReservedID(id string) bool {
+	_, ok := reservedIDs[id]
+	return ok
+}
+
+// userStatsCacheTTL задаёт время кеширования статистики пользователя
+const userStatsCacheTTL = 30 * time.Second
+
+// userStatsCacheMax ограничивает число пользователей в кеше статистики; сверх лимита статистика не кешируется
+const userStatsCacheMax = 10000
+
+// cachedUserStats хранит закешированную статистику пользователя
+type cachedUserStats struct {
+	stats     models.UserStats
+	expiresAt time.Time
+}
+
 // Service реализует бизнес-логику работы с короткими URL
 type Service struct {
-	repo      repository.Repository // Репозиторий для работы с данными
-	baseURL   string                // Базовый URL для генерации коротких ссылок
-	jwtSecret string                // Секретный ключ для подписи JWT токенов
+	repo           repository.Repository      // Репозиторий для работы с данными
+	urls           URLBuilder                 // Построитель коротких URL из базового URL и шаблона
+	jwtSecret      string                     // Секретный ключ для подписи JWT токенов
+	startedAt      time.Time                  // Время создания сервиса для расчёта uptime
+	now            func() time.Time           // Источник текущего времени
+	generateID     func(int) (string, error)  // Генератор случайных ID заданной длины
+	generateUserID func(int) (string, error)  // Генератор идентификаторов пользователей из WithIDGenerator; nil — по userIDEncoding
+	idLength       int                        // Длина генерируемых коротких ID
+	idAlphabetSize int                        // Число символов в алфавите коротких ID
+	userIDEncoding UserIDEncoding             // Кодировка идентификаторов пользователей
+	piiMode        PIIMode                    // Режим выдачи идентификаторов пользователей во внутренних отчётах
+	recordUsers    bool                       // Записывать выданных пользователей в хранилище
+	userStatsMu    sync.Mutex                 // Защищает userStatsCache и userStatsSwept
+	userStatsCache map[string]cachedUserStats // Кеш статистики по пользователям
+	userStatsSwept time.Time                  // Время последнего удаления устаревших записей userStatsCache
+	clicks         *clickLimiter              // Ограничитель записи переходов; nil — переходы записываются все
+	clickRecorder  ClickRecorder              // Получатель переходов; nil — переходы не записываются
+	hits           *hitCounter                // Переходы по недавно открытым ссылкам с момента запуска сервиса
+	notifier       *events.Notifier           // Получатель событий об изменении ссылок; nil — события не рассылаются
+
+	trackReferrers bool // Учитывать источники переходов в хранилище
+	maxDescription int  // Максимальная длина описания ссылки в символах; 0 — DefaultMaxDescriptionLength
+
+	batchSlots  chan struct{} // Слоты одновременных пакетных сокращений; nil — без ограничения
+	batchReject bool          // Отклонять пакет при занятых слотах вместо ожидания
+}
+
+// shortIDLength задаёт длину идентификаторов пользователей и длину коротких ID по умолчанию
+const shortIDLength = 8
+
+// jwtTTL задаёт срок действия выдаваемых JWT токенов
+const jwtTTL = 24 * time.Hour
+
+// UserIDEncoding задаёт алфавит идентификаторов пользователей
+type UserIDEncoding string
+
+const (
+	// UserIDBase64URL — 8 символов base64url, как у коротких ID (по умолчанию)
+	UserIDBase64URL UserIDEncoding = "base64url"
+	// UserIDHex — 12 шестнадцатеричных символов в нижнем регистре
+	UserIDHex UserIDEncoding = "hex"
+	// UserIDBase62 — 8 символов из цифр и латинских букв, без '-' и '_'
+	UserIDBase62 UserIDEncoding = "base62"
+)
+
+// base62Alphabet содержит символы кодировки UserIDBase62
+const base62Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// DefaultIDAlphabet — алфавит коротких ID по умолчанию (base64url)
+const DefaultIDAlphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+// minIDAlphabetSize — минимальный размер алфавита коротких ID: 8 символов из 16 дают 2^32 вариантов
+const minIDAlphabetSize = 16
+
+// idAlphabetChars содержит символы, допустимые в алфавите коротких ID без экранирования в пути URL
+const idAlphabetChars = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_.~"
+
+// ErrInvalidIDAlphabet возвращается, если алфавит коротких ID слишком мал, содержит повторы или недопустимые символы
+var ErrInvalidIDAlphabet = errors.New("invalid ID alphabet")
+
+// ValidateIDAlphabet проверяет алфавит коротких ID: не менее 16 различных символов из A-Z, a-z, 0-9 и "-_.~"
+func ValidateIDAlphabet(alphabet string) error {
+	if len(alphabet) < minIDAlphabetSize {
+		return fmt.Errorf("%w: need at least %d characters, got %d", ErrInvalidIDAlphabet, minIDAlphabetSize, len(alphabet))
+	}
+	seen := make(map[rune]struct{}, len(alphabet))
+	for _, c := range alphabet {
+		if !strings.ContainsRune(idAlphabetChars, c) {
+			return fmt.Errorf("%w: character %q is not allowed", ErrInvalidIDAlphabet, c)
+		}
+		if _, dup := seen[c]; dup {
+			return fmt.Errorf("%w: duplicate character %q", ErrInvalidIDAlphabet, c)
+		}
+		seen[c] = struct{}{}
+	}
+	return nil
+}
+
+// Option настраивает Service
+type Option func(*Service)
+
+// WithClock задаёт источник текущего времени для срока действия JWT, времени создания URL,
+// uptime и кеша статистики; по умолчанию используется time.Now
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+// WithIDGenerator задаёт генератор коротких ID и идентификаторов пользователей;
+// по умолчанию используется crypto/rand
+// Идентификаторы пользователей генерируются им при любой кодировке WithUserIDEncoding, с длиной этой кодировки
+func WithIDGenerator(generate func(length int) (string, error)) Option {
+	return func(s *Service) {
+		s.generateID = generate
+		s.generateUserID = generate
+	}
+}
+
+// WithUserIDEncoding задаёт кодировку идентификаторов пользователей; короткие ID не затрагиваются
+// Пустое значение оставляет UserIDBase64URL. Генератор из WithIDGenerator должен сам выдавать символы кодировки
+func WithUserIDEncoding(encoding UserIDEncoding) Option {
+	return func(s *Service) {
+		if encoding != "" {
+			s.userIDEncoding = encoding
+		}
+	}
+}
+
+// WithIDAlphabet задаёт алфавит коротких ID; длина ID не меняется
+// Пустой, стандартный или не прошедший ValidateIDAlphabet алфавит оставляет генератор по умолчанию
+func WithIDAlphabet(alphabet string) Option {
+	return func(s *Service) {
+		if alphabet == "" || alphabet == DefaultIDAlphabet || ValidateIDAlphabet(alphabet) != nil {
+			return
+		}
+		s.generateID = func(length int) (string, error) {
+			return randomFromAlphabet(alphabet, length)
+		}
+		s.idAlphabetSize = len(alphabet)
+	}
+}
+
+// PIIMode задаёт, как идентификаторы пользователей попадают во внутренние отчёты
+type PIIMode string
+
+const (
+	// PIIModePlain — идентификаторы выдаются как есть (по умолчанию)
+	PIIModePlain PIIMode = "plain"
+	// PIIModeHashed — вместо идентификаторов выдаётся их хеш
+	PIIModeHashed PIIMode = "hashed"
+)
+
+// WithPIIMode задаёт режим выдачи идентификаторов пользователей во внутренних отчётах (например, TopUsers)
+// Пустое значение оставляет PIIModePlain
+func WithPIIMode(mode PIIMode) Option {
+	return func(s *Service) {
+		if mode != "" {
+			s.piiMode = mode
+		}
+	}
+}
+
+// WithIssuedUserPersistence включает запись выданных идентификаторов пользователей в хранилище (RecordIssuedUser)
+// По умолчанию выключено: каждый новый анонимный клиент иначе стоит записи в хранилище
+func WithIssuedUserPersistence(enabled bool) Option {
+	return func(s *Service) {
+		s.recordUsers = enabled
+	}
 }
 
 // NewService создаёт новый экземпляр сервиса с указанным репозиторием, базовым URL и секретным ключом JWT
-func NewService(repo repository.Repository, baseURL, jwtSecret string) *Service {
-	return &Service{
-		repo:      repo,
-		baseURL:   baseURL,
-		jwtSecret: jwtSecret,
+func NewService(repo repository.Repository, baseURL, jwtSecret string, opts ...Option) *Service {
+	s := &Service{
+		repo:           repo,
+		urls:           newURLBuilder(baseURL),
+		jwtSecret:      jwtSecret,
+		now:            time.Now,
+		generateID:     randomID,
+		idLength:       shortIDLength,
+		idAlphabetSize: len(DefaultIDAlphabet),
+		userIDEncoding: UserIDBase64URL,
+		piiMode:        PIIModePlain,
+		userStatsCache: make(map[string]cachedUserStats),
+		hits:           newHitCounter(DefaultHitCountsCapacity),
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.startedAt = s.now()
+	return s
 }
 
-// GenerateShortID генерирует случайный короткий ID длиной 8 символов в base64url кодировке
-func (s *Service) GenerateShortID() (string, error) {
-	bytes := make([]byte, 8)
+// BaseURL возвращает базовый URL коротких ссылок без завершающего слэша
+func (s *Service) BaseURL() string {
+	return s.urls.Base()
+}
+
+// randomID генерирует случайный ID заданной длины в base64url кодировке
+func randomID(length int) (string, error) {
+	bytes := make([]byte, length)
 	_, err := rand.Read(bytes)
 	if err != nil {
 		return "", err
 	}
 	encoded := base64.URLEncoding.EncodeToString(bytes)
-	return encoded[:8], nil
+	return encoded[:length], nil
+}
+
+// GenerateShortID генерирует случайный короткий ID; длину задаёт WithShortIDLength (по умолчанию 8 символов),
+// алфавит — WithIDAlphabet (по умолчанию base64url)
+func (s *Service) GenerateShortID() (string, error) {
+	return s.generateID(s.idLength)
 }
 
-// GenerateUserID генерирует уникальный идентификатор пользователя, используя тот же алгоритм, что и для коротких ID
+// hexUserIDLength — длина идентификатора пользователя в кодировке UserIDHex (6 случайных байт)
+const hexUserIDLength = 12
+
+// GenerateUserID генерирует уникальный идентификатор пользователя в кодировке, заданной WithUserIDEncoding
+// По умолчанию используется тот же алгоритм, что и для коротких ID; генератор из WithIDGenerator используется в любой кодировке
 func (s *Service) GenerateUserID() (string, error) {
-	return s.GenerateShortID()
+	length := shortIDLength
+	if s.userIDEncoding == UserIDHex {
+		length = hexUserIDLength
+	}
+	if s.generateUserID != nil {
+		return s.generateUserID(length)
+	}
+	switch s.userIDEncoding {
+	case UserIDHex:
+		bytes := make([]byte, hexUserIDLength/2)
+		if _, err := rand.Read(bytes); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(bytes), nil
+	case UserIDBase62:
+		return randomFromAlphabet(base62Alphabet, length)
+	default:
+		return s.generateID(length)
+	}
+}
+
+// randomFromAlphabet генерирует случайную строку заданной длины из символов alphabet (не длиннее 256)
+// Байты вне диапазона кратного длине алфавита отбрасываются, чтобы символы были равновероятны
+func randomFromAlphabet(alphabet string, length int) (string, error) {
+	limit := 256 - 256%len(alphabet)
+	result := make([]byte, 0, length)
+	buf := make([]byte, length*2)
+	for len(result) < length {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		for _, b := range buf {
+			if int(b) >= limit {
+				continue
+			}
+			result = append(result, alphabet[int(b)%len(alphabet)])
+			if len(result) == length {
+				break
+			}
+		}
+	}
+	return string(result), nil
 }
 
 // GenerateJWT генерирует JWT токен с указанным UserID и сроком действия 24 часа
 func (s *Service) GenerateJWT(userID string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"user_id": userID,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
+		"exp":     s.now().Add(jwtTTL).Unix(),
 	})
 	return token.SignedString([]byte(s.jwtSecret))
 }
 
-// ParseJWT проверяет подпись JWT токена и извлекает UserID из payload
+// ParseJWT проверяет подпись и срок действия JWT токена и извлекает UserID из payload
+// Срок действия сверяется с часами сервиса, а не с jwt.TimeFunc. Если истёк только срок действия,
+// возвращается UserID вместе с *ExpiredTokenError, чтобы вызывающий мог восстановить идентификатор
 func (s *Service) ParseJWT(tokenString string) (string, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
+	token, err := parser.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, ErrInvalidToken
 		}
@@ -92,72 +377,145 @@ func (s *Service) ParseJWT(tokenString string) (string, error) {
 	if !ok {
 		return "", ErrInvalidToken
 	}
+	now := s.now().Unix()
+	if !claims.VerifyIssuedAt(now, false) || !claims.VerifyNotBefore(now, false) {
+		return "", ErrInvalidToken
+	}
 	userID, ok := claims["user_id"].(string)
 	if !ok {
 		return "", ErrInvalidToken
 	}
+	if !claims.VerifyExpiresAt(now, false) {
+		exp, ok := claims["exp"].(float64)
+		if !ok {
+			return "", ErrInvalidToken
+		}
+		return userID, &ExpiredTokenError{Expired: s.now().Sub(time.Unix(int64(exp), 0))}
+	}
 	return userID, nil
 }
 
 // CreateShortURLWithID создаёт короткий URL с заданным ID для указанного пользователя
-func (s *Service) CreateShortURLWithID(originalURL, id, userID string) (string, error) {
-	if originalURL == "" {
-		return "", ErrEmptyURL
+// Возвращает ID и короткий URL; если URL уже сокращён, это ID существующей ссылки вместе с ErrURLExists
+func (s *Service) CreateShortURLWithID(originalURL, id, userID string) (string, string, error) {
+	return s.saveShortURL(models.URL{
+		ShortID:     id,
+		OriginalURL: originalURL,
+		UserID:      userID,
+	}, s.repo.SaveURL)
+}
+
+// saveFunc сохраняет URL в хранилище: Repository.SaveURL или DuplicateSaver.SaveDuplicateURL
+type saveFunc func(models.URL) (string, error)
+
+// saveShortURL проверяет и сохраняет URL функцией save, возвращая ID и полный короткий URL
+func (s *Service) saveShortURL(u models.URL, save saveFunc) (string, string, error) {
+	if u.OriginalURL == "" {
+		return "", "", ErrEmptyURL
 	}
-	if id == "" {
-		return "", ErrEmptyID
+	if u.ShortID == "" {
+		return "", "", ErrEmptyID
+	}
+	if IsReservedID(u.ShortID) {
+		return "", "", ErrReservedID
+	}
+	_, exists, err := s.repo.Get(u.ShortID)
+	if err != nil {
+		return "", "", err
+	}
+	if exists {
+		return "", "", ErrIDAlreadyExists
 	}
-	if _, exists := s.repo.Get(id); exists {
-		return "", ErrIDAlreadyExists
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = s.now()
 	}
-	shortID, err := s.repo.Save(id, originalURL, userID)
+	shortID, err := save(u)
 	if err != nil {
 		if errors.Is(err, repository.ErrURLExists) {
-			return strings.TrimRight(s.baseURL, "/") + "/" + shortID, repository.ErrURLExists
+			return shortID, s.urls.Build(shortID), repository.ErrURLExists
 		}
-		return "", err
+		return "", "", err
 	}
-	// Используем простое конкатенацию вместо strings.Builder для коротких строк
-	return strings.TrimRight(s.baseURL, "/") + "/" + shortID, nil
+	s.publish(events.Created, shortID)
+	return shortID, s.urls.Build(shortID), nil
 }
 
 // CreateShortURL создаёт короткий URL с автоматически сгенерированным ID для указанного пользователя
-func (s *Service) CreateShortURL(originalURL, userID string) (string, error) {
-	var id string
-	var err error
+// Возвращает ID и короткий URL, как CreateShortURLWithID
+func (s *Service) CreateShortURL(originalURL, userID string) (string, string, error) {
+	return s.CreateShortURLWithTags(originalURL, userID, nil)
+}
+
+// CreateShortURLWithTags создаёт короткий URL с автоматически сгенерированным ID и метками для указанного пользователя
+func (s *Service) CreateShortURLWithTags(originalURL, userID string, tags []string) (string, string, error) {
+	return s.CreateShortURLWithDetails(originalURL, userID, tags, "")
+}
+
+// saveWithGeneratedID сохраняет URL под сгенерированным ID, повторяя генерацию при коллизиях
+func (s *Service) saveWithGeneratedID(u models.URL, save saveFunc) (string, string, error) {
 	for i := 0; i < 5; i++ {
-		id, err = s.GenerateShortID()
+		id, err := s.GenerateShortID()
 		if err != nil {
-			return "", err
+			return "", "", err
 		}
-		shortURL, err := s.CreateShortURLWithID(originalURL, id, userID)
+		u.ShortID = id
+		shortID, shortURL, err := s.saveShortURL(u, save)
 		if err == nil {
-			return shortURL, nil
+			return shortID, shortURL, nil
 		}
 		if errors.Is(err, repository.ErrURLExists) {
-			return shortURL, repository.ErrURLExists
+			return shortID, shortURL, repository.ErrURLExists
 		}
 		if errors.Is(err, ErrIDAlreadyExists) {
+			idGenerationRetries.Add(1)
 			continue
 		}
-		return "", err
+		return "", "", err
 	}
-	return "", errors.New("failed to generate unique ID")
+	return "", "", errors.New("failed to generate unique ID")
 }
 
+// normalizeTags убирает пробелы по краям, пустые и повторяющиеся метки
+func normalizeTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	result := make([]string, 0, len(tags))
+	seen := make(map[string]struct{}, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if _, exists := seen[tag]; exists {
+			continue
+		}
+		seen[tag] = struct{}{}
+		result = append(result, tag)
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// batchSaveAttempts задаёт число попыток сохранить пакет при конфликте сгенерированных ID
+const batchSaveAttempts = 5
+
 // BatchShorten создаёт короткие URL для списка запросов в пакетном режиме для указанного пользователя
+// Ответы идут в порядке запросов: i-й ответ относится к i-му запросу и несёт его correlation_id
+// Уникальность ID гарантирует репозиторий при сохранении; при конфликте ID генерируются заново
 func (s *Service) BatchShorten(reqs []models.BatchRequest, userID string) ([]models.BatchResponse, error) {
+	return s.BatchShortenContext(context.Background(), reqs, userID)
+}
+
+// BatchShortenContext работает как BatchShorten, но прерывает обработку, если контекст отменён
+// (например, клиент закрыл соединение), и возвращает ошибку контекста
+func (s *Service) BatchShortenContext(ctx context.Context, reqs []models.BatchRequest, userID string) ([]models.BatchResponse, error) {
 	if len(reqs) == 0 {
 		return nil, ErrEmptyBatch
 	}
-	urls := make(map[string]string, len(reqs))
-	resp := make([]models.BatchResponse, 0, len(reqs))
 	corrIDs := make(map[string]struct{}, len(reqs))
-
-	// Предварительно вычисляем базовый URL
-	baseURL := strings.TrimRight(s.baseURL, "/")
-	baseURLLen := len(baseURL)
-
 	for _, req := range reqs {
 		if _, exists := corrIDs[req.CorrelationID]; exists {
 			return nil, ErrDuplicateCorrID
@@ -166,95 +524,526 @@ func (s *Service) BatchShorten(reqs []models.BatchRequest, userID string) ([]mod
 		if req.OriginalURL == "" {
 			return nil, ErrEmptyURL
 		}
+	}
+
+	release, err := s.acquireBatch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	for attempt := 0; attempt < batchSaveAttempts; attempt++ {
+		items, resp, err := s.prepareBatch(ctx, reqs)
+		if err != nil {
+			return nil, err
+		}
+		// Не сохраняем пакет, если клиент уже не ждёт ответа
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		err = s.repo.BatchSave(items, userID)
+		switch {
+		case err == nil:
+			for _, item := range items {
+				s.publish(events.Created, item.ShortID)
+			}
+			return resp, nil
+		case errors.Is(err, repository.ErrIDExists):
+			// Параллельный запрос занял один из ID между генерацией и сохранением: весь пакет генерируется заново
+			idGenerationRetries.Add(int64(len(items)))
+			continue
+		case errors.Is(err, repository.ErrURLExists):
+			return resp, repository.ErrURLExists
+		default:
+			return nil, err
+		}
+	}
+	return nil, ErrUniqueIDFailed
+}
+
+// prepareBatch генерирует уникальные в пределах пакета ID и формирует элементы для сохранения и ответы;
+// i-й элемент и i-й ответ соответствуют i-му запросу
+func (s *Service) prepareBatch(ctx context.Context, reqs []models.BatchRequest) ([]models.BatchItem, []models.BatchResponse, error) {
+	items := make([]models.BatchItem, 0, len(reqs))
+	inBatch := make(map[string]struct{}, len(reqs))
+	now := s.now()
+	resp := make([]models.BatchResponse, 0, len(reqs))
+
+	for _, req := range reqs {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
 		var id string
 		var err error
 		for j := 0; j < 5; j++ {
 			id, err = s.GenerateShortID()
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
-			if _, exists := s.repo.Get(id); !exists {
-				urls[id] = req.OriginalURL
-				// Формирование URL с использованием append для экономии памяти
-				shortURL := make([]byte, 0, baseURLLen+9) // baseURL + "/" + 8-char id
-				shortURL = append(shortURL, baseURL...)
-				shortURL = append(shortURL, '/')
-				shortURL = append(shortURL, id...)
+			_, taken := inBatch[id]
+			_, exists, err := s.repo.Get(id)
+			if err != nil {
+				return nil, nil, err
+			}
+			if !exists && !taken {
+				inBatch[id] = struct{}{}
+				items = append(items, models.BatchItem{ShortID: id, OriginalURL: req.OriginalURL, CreatedAt: now})
 				resp = append(resp, models.BatchResponse{
 					CorrelationID: req.CorrelationID,
-					ShortURL:      string(shortURL),
+					ShortURL:      s.urls.Build(id),
+					ShortID:       id,
 				})
 				break
 			}
 			if j == 4 {
-				return nil, ErrUniqueIDFailed
+				return nil, nil, ErrUniqueIDFailed
 			}
+			idGenerationRetries.Add(1)
 		}
 	}
-	if err := s.repo.BatchSave(urls, userID); err != nil {
-		if errors.Is(err, repository.ErrURLExists) {
-			return resp, repository.ErrURLExists
-		}
-		return nil, err
-	}
-	return resp, nil
+	return items, resp, nil
 }
 
 // GetOriginalURL возвращает оригинальный URL по короткому ID, учитывая флаг удаления
-func (s *Service) GetOriginalURL(id string) (string, bool) {
-	u, exists := s.repo.Get(id)
-	if !exists || u.DeletedFlag {
-		return "", false
+// Ошибка означает сбой хранилища, а не отсутствие URL
+func (s *Service) GetOriginalURL(id string) (string, bool, error) {
+	u, exists, err := s.repo.Get(id)
+	if err != nil {
+		return "", false, err
 	}
-	return u.OriginalURL, true
+	if !exists || u.Reserved || u.DeletedFlag {
+		return "", false, nil
+	}
+	return u.OriginalURL, true, nil
+}
+
+// Resolve проверяет разрешение списка коротких ID одним обращением к репозиторию
+// Результаты возвращаются в порядке входного списка
+func (s *Service) Resolve(ids []string) ([]models.ResolveResult, error) {
+	if len(ids) == 0 {
+		return nil, ErrEmptyBatch
+	}
+	found, err := s.repo.BatchGet(ids)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]models.ResolveResult, 0, len(ids))
+	for _, id := range ids {
+		u, exists := found[id]
+		switch {
+		case !exists || u.Reserved:
+			results = append(results, models.ResolveResult{ID: id, Status: models.ResolveStatusNotFound})
+		case u.DeletedFlag:
+			results = append(results, models.ResolveResult{ID: id, Status: models.ResolveStatusDeleted, URL: u.OriginalURL})
+		default:
+			results = append(results, models.ResolveResult{ID: id, Status: models.ResolveStatusOK, URL: u.OriginalURL})
+		}
+	}
+	return results, nil
 }
 
 // Get возвращает полную информацию об URL по короткому ID
-func (s *Service) Get(id string) (models.URL, bool) {
-	return s.repo.Get(id)
+// Зарезервированный код без адреса назначения считается отсутствующим; ошибка означает сбой хранилища
+func (s *Service) Get(id string) (models.URL, bool, error) {
+	u, exists, err := s.repo.Get(id)
+	if err != nil {
+		return models.URL{}, false, err
+	}
+	if !exists || u.Reserved {
+		return models.URL{}, false, nil
+	}
+	return u, true, nil
+}
+
+// ReserveShortIDs резервирует count свободных коротких ID за пользователем userID без адреса назначения,
+// например для заранее напечатанных QR-кодов; адрес задаётся позже через ActivateReservedURL
+// Уникальность ID гарантирует репозиторий при резервировании; при конфликте ID генерируются заново
+func (s *Service) ReserveShortIDs(count int, userID string) ([]string, error) {
+	if count <= 0 {
+		return nil, ErrEmptyBatch
+	}
+	for attempt := 0; attempt < batchSaveAttempts; attempt++ {
+		ids, err := s.generateFreeIDs(count)
+		if err != nil {
+			return nil, err
+		}
+		err = s.repo.ReserveIDs(ids, userID, s.now())
+		switch {
+		case err == nil:
+			return ids, nil
+		case errors.Is(err, repository.ErrIDExists):
+			// Параллельный запрос занял один из ID между генерацией и резервированием
+			idGenerationRetries.Add(int64(len(ids)))
+			continue
+		default:
+			return nil, err
+		}
+	}
+	return nil, ErrUniqueIDFailed
+}
+
+// generateFreeIDs генерирует count ID, не занятых в хранилище и не повторяющихся между собой
+// Занятость проверяется одним BatchGet на раунд: занятые ID генерируются заново, не более batchSaveAttempts раундов
+func (s *Service) generateFreeIDs(count int) ([]string, error) {
+	ids := make([]string, 0, count)
+	seen := make(map[string]struct{}, count)
+	for round := 0; round < batchSaveAttempts; round++ {
+		candidates := make([]string, 0, count-len(ids))
+		for misses := 0; len(ids)+len(candidates) < count; {
+			id, err := s.GenerateShortID()
+			if err != nil {
+				return nil, err
+			}
+			if _, dup := seen[id]; dup {
+				// Пространство ID почти исчерпано: повторы внутри пакета не прекращаются
+				if misses++; misses > batchSaveAttempts*count {
+					return nil, ErrUniqueIDFailed
+				}
+				idGenerationRetries.Add(1)
+				continue
+			}
+			seen[id] = struct{}{}
+			candidates = append(candidates, id)
+		}
+		taken, err := s.repo.BatchGet(candidates)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range candidates {
+			if _, exists := taken[id]; exists {
+				idGenerationRetries.Add(1)
+				continue
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) == count {
+			return ids, nil
+		}
+	}
+	return nil, ErrUniqueIDFailed
+}
+
+// ActivateReservedURL задаёт адрес назначения зарезервированного пользователем кода и возвращает короткий URL
+// Чужой или отсутствующий код даёт repository.ErrURLNotFound, уже активированный — repository.ErrNotReserved
+func (s *Service) ActivateReservedURL(id, originalURL, userID string) (string, error) {
+	if originalURL == "" {
+		return "", ErrEmptyURL
+	}
+	if id == "" {
+		return "", ErrEmptyID
+	}
+	u, exists, err := s.repo.Get(id)
+	if err != nil {
+		return "", err
+	}
+	if !exists || u.UserID != userID {
+		return "", repository.ErrURLNotFound
+	}
+	if !u.Reserved {
+		return "", repository.ErrNotReserved
+	}
+	if err := s.repo.ActivateReserved(id, userID, originalURL); err != nil {
+		return "", err
+	}
+	s.publish(events.Updated, id)
+	return s.urls.Build(id), nil
+}
+
+// SetNSFW помечает ссылку как NSFW или снимает пометку по решению модерации
+func (s *Service) SetNSFW(id string, nsfw bool) error {
+	if id == "" {
+		return ErrEmptyID
+	}
+	if err := s.repo.SetNSFW(id, nsfw); err != nil {
+		return err
+	}
+	s.publish(events.Updated, id)
+	return nil
 }
 
 // GetURLsByUserID возвращает все URL, созданные указанным пользователем, в формате для API ответа
 func (s *Service) GetURLsByUserID(userID string) ([]models.ShortURLResponse, error) {
-	urls, err := s.repo.GetURLsByUserID(userID)
+	return s.GetURLsByUserIDContext(context.Background(), userID)
+}
+
+// GetURLsByUserIDContext работает как GetURLsByUserID, но прерывает долгую выборку хранилища
+// (см. repository.ContextScanner) при отмене контекста и возвращает ошибку контекста
+func (s *Service) GetURLsByUserIDContext(ctx context.Context, userID string) ([]models.ShortURLResponse, error) {
+	var urls []models.URL
+	var err error
+	if scanner, ok := s.repo.(repository.ContextScanner); ok {
+		urls, err = scanner.GetURLsByUserIDContext(ctx, userID)
+	} else {
+		urls, err = s.repo.GetURLsByUserID(userID)
+	}
 	if err != nil {
 		return nil, err
 	}
-	resp := make([]models.ShortURLResponse, 0, len(urls))
+	return s.toShortURLResponses(urls), nil
+}
+
+// UserURLsRevision возвращает ревизию ссылок пользователя (см. repository.UserRevisioner); ревизия меняется
+// только при изменении ссылок этого пользователя. false, если хранилище не ведёт ревизий
+func (s *Service) UserURLsRevision(userID string) (string, bool) {
+	if revisioner, ok := s.repo.(repository.UserRevisioner); ok {
+		return revisioner.UserRevision(userID)
+	}
+	return "", false
+}
 
-	// Предварительно вычисляем базовый URL
-	baseURL := strings.TrimRight(s.baseURL, "/")
-	baseURLLen := len(baseURL)
+// GetURLsByUserAndTag возвращает URL пользователя, помеченные указанной меткой, в формате для API ответа
+func (s *Service) GetURLsByUserAndTag(userID, tag string) ([]models.ShortURLResponse, error) {
+	urls, err := s.repo.GetURLsByUserAndTag(userID, strings.TrimSpace(tag))
+	if err != nil {
+		return nil, err
+	}
+	return s.toShortURLResponses(urls), nil
+}
 
+// createdAtOf возвращает время создания URL для ответа API: в UTC с точностью до секунды, как его хранит файл,
+// чтобы ответ не зависел от хранилища
+func createdAtOf(u models.URL) time.Time {
+	if u.CreatedAt.IsZero() {
+		return time.Time{}
+	}
+	return u.CreatedAt.UTC().Truncate(time.Second)
+}
+
+// toShortURLResponses преобразует URL из репозитория в формат для API ответа
+func (s *Service) toShortURLResponses(urls []models.URL) []models.ShortURLResponse {
+	resp := make([]models.ShortURLResponse, 0, len(urls))
 	for _, u := range urls {
-		// Формирование URL с использованием append для экономии памяти
-		shortURL := make([]byte, 0, baseURLLen+len(u.ShortID)+1)
-		shortURL = append(shortURL, baseURL...)
-		shortURL = append(shortURL, '/')
-		shortURL = append(shortURL, u.ShortID...)
 		resp = append(resp, models.ShortURLResponse{
-			ShortURL:    string(shortURL),
+			ShortURL:    s.urls.Build(u.ShortID),
 			OriginalURL: u.OriginalURL,
+			ShortID:     u.ShortID,
+			Description: u.Description,
+			CreatedAt:   createdAtOf(u),
 		})
 	}
-	return resp, nil
+	return resp
 }
 
 // BatchDelete помечает указанные URL как удалённые для указанного пользователя
 func (s *Service) BatchDelete(userID string, ids []string) error {
-	return s.repo.BatchDelete(userID, ids)
+	var deleted []string
+	if s.notifier != nil {
+		deleted = s.deletableIDs(userID, ids)
+	}
+	if err := s.repo.BatchDelete(userID, ids); err != nil {
+		return err
+	}
+	s.publish(events.Deleted, deleted...)
+	return nil
 }
 
 // BatchDeleteAsync асинхронно помечает указанные URL как удалённые для указанного пользователя
+// Результат удаления не отслеживается; чтобы узнать его, используйте BatchDeleteAsyncResult
 func (s *Service) BatchDeleteAsync(userID string, ids []string) {
+	s.BatchDeleteAsyncResult(userID, ids)
+}
+
+// BatchDeleteAsyncResult асинхронно помечает указанные URL как удалённые и возвращает канал с результатом
+// Канал буферизован и закрывается после отправки результата, поэтому читать его необязательно
+func (s *Service) BatchDeleteAsyncResult(userID string, ids []string) <-chan error {
+	result := make(chan error, 1)
 	go func() {
-		if err := s.BatchDelete(userID, ids); err != nil {
-			_ = err
-		}
+		defer close(result)
+		result <- s.BatchDelete(userID, ids)
 	}()
+	return result
+}
+
+// DeleteByHost помечает удалёнными все URL пользователя, ведущие на указанный хост, и возвращает их количество
+// Хост сравнивается без учёта регистра; поддомены не затрагиваются
+func (s *Service) DeleteByHost(userID, host string) (int, error) {
+	host = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+	if host == "" || strings.ContainsAny(host, "/:@?# ") {
+		return 0, ErrInvalidHost
+	}
+	deleted, err := s.repo.DeleteByUserAndHost(userID, host)
+	if err != nil {
+		return 0, err
+	}
+	if deleted > 0 {
+		s.notifier.Publish(events.Event{Type: events.Deleted, Host: host, Count: deleted, Time: s.now()})
+	}
+	return deleted, nil
+}
+
+// RecordIssuedUser записывает только что выданный идентификатор пользователя со временем первого появления,
+// чтобы пользователи без ссылок учитывались в статистике; без WithIssuedUserPersistence ничего не делает
+func (s *Service) RecordIssuedUser(userID string) error {
+	if !s.recordUsers {
+		return nil
+	}
+	return s.repo.SaveUser(userID, s.now())
+}
+
+// RotateUserID выдаёт пользователю новый идентификатор и передаёт ему все URL пользователя userID
+// Возвращает новый идентификатор и количество переданных URL; прежний идентификатор остаётся без URL
+func (s *Service) RotateUserID(userID string) (string, int, error) {
+	newUserID, err := s.GenerateUserID()
+	if err != nil {
+		return "", 0, err
+	}
+	moved, err := s.repo.ReassignUser(userID, newUserID)
+	if err != nil {
+		return "", 0, err
+	}
+
+	s.userStatsMu.Lock()
+	delete(s.userStatsCache, userID)
+	s.userStatsMu.Unlock()
+	return newUserID, moved, nil
+}
+
+// StorageHealthy сообщает, согласованы ли данные хранилища
+// Хранилища без проверки состояния считаются исправными
+func (s *Service) StorageHealthy() bool {
+	if checker, ok := s.repo.(interface{ Healthy() bool }); ok {
+		return checker.Healthy()
+	}
+	return true
 }
 
 // GetStats возвращает статистику сервиса: количество URL и пользователей
 func (s *Service) GetStats() (int, int, error) {
 	return s.repo.GetStats()
 }
+
+// GetDetailedStats возвращает статистику сервиса вместе с именем хранилища и сведениями о процессе
+func (s *Service) GetDetailedStats() (models.StatsResponse, error) {
+	return s.GetDetailedStatsContext(context.Background())
+}
+
+// GetDetailedStatsContext работает как GetDetailedStats, но прерывает подсчёт в хранилище
+// (см. repository.ContextScanner) при отмене контекста и возвращает ошибку контекста
+func (s *Service) GetDetailedStatsContext(ctx context.Context) (models.StatsResponse, error) {
+	var urls, users int
+	var err error
+	if scanner, ok := s.repo.(repository.ContextScanner); ok {
+		urls, users, err = scanner.GetStatsContext(ctx)
+	} else {
+		urls, users, err = s.repo.GetStats()
+	}
+	if err != nil {
+		return models.StatsResponse{}, err
+	}
+	return models.StatsResponse{
+		URLs:          urls,
+		Users:         users,
+		Backend:       s.repo.Name(),
+		UptimeSeconds: int64(s.now().Sub(s.startedAt).Seconds()),
+		GoVersion:     runtime.Version(),
+		PID:           os.Getpid(),
+		Indexes:       s.indexStats(),
+	}, nil
+}
+
+// indexStats возвращает размеры индексов хранилища в памяти или nil, если хранилище их не держит
+func (s *Service) indexStats() []models.IndexStats {
+	if reporter, ok := s.repo.(repository.IndexReporter); ok {
+		return reporter.IndexStats()
+	}
+	return nil
+}
+
+// Ограничения размера рейтинга пользователей TopUsers
+const (
+	DefaultTopUsersLimit = 50
+	MaxTopUsersLimit     = 1000
+)
+
+// TopUsers возвращает пользователей с наибольшим числом активных URL
+// Неположительный limit заменяется DefaultTopUsersLimit, слишком большой ограничивается MaxTopUsersLimit;
+// в режиме PIIModeHashed идентификаторы пользователей заменяются хешами
+func (s *Service) TopUsers(limit int) ([]models.UserURLCount, error) {
+	if limit <= 0 {
+		limit = DefaultTopUsersLimit
+	}
+	if limit > MaxTopUsersLimit {
+		limit = MaxTopUsersLimit
+	}
+	users, err := s.repo.TopUsers(limit)
+	if err != nil {
+		return nil, err
+	}
+	if s.piiMode == PIIModeHashed {
+		for i := range users {
+			users[i].UserID = HashUserID(users[i].UserID)
+		}
+	}
+	return users, nil
+}
+
+// URLOwners возвращает пользователей, создавших ссылки на originalURL, для расследования злоупотреблений
+// При дедупликации URL владелец не больше одного; в режиме PIIModeHashed идентификаторы заменяются хешами
+func (s *Service) URLOwners(originalURL string) ([]string, error) {
+	if originalURL == "" {
+		return nil, ErrEmptyURL
+	}
+	userIDs, err := s.repo.GetUserIDsByURL(originalURL)
+	if err != nil {
+		return nil, err
+	}
+	if s.piiMode == PIIModeHashed {
+		for i := range userIDs {
+			userIDs[i] = HashUserID(userIDs[i])
+		}
+	}
+	return userIDs, nil
+}
+
+// HashUserID возвращает стабильный хеш идентификатора пользователя для отчётов без персональных данных
+func HashUserID(userID string) string {
+	sum := sha256.Sum256([]byte(userID))
+	return hex.EncodeToString(sum[:8])
+}
+
+// GetUserStats возвращает статистику пользователя, кешируя результат на userStatsCacheTTL
+// ClicksTotal заполняется хранилищем из переходов, записанных получателем WithClickRecorder; без него он равен 0
+// С WithReferrerTracking статистика включает основные источники переходов по ссылкам пользователя
+func (s *Service) GetUserStats(userID string) (models.UserStats, error) {
+	now := s.now()
+
+	s.userStatsMu.Lock()
+	if cached, ok := s.userStatsCache[userID]; ok && now.Before(cached.expiresAt) {
+		s.userStatsMu.Unlock()
+		return cached.stats, nil
+	}
+	s.userStatsMu.Unlock()
+
+	stats, err := s.repo.GetUserStats(userID, now)
+	if err != nil {
+		return models.UserStats{}, err
+	}
+	if s.trackReferrers {
+		stats.TopReferrers, err = s.topReferrers(userID)
+		if err != nil {
+			return models.UserStats{}, err
+		}
+	}
+
+	s.userStatsMu.Lock()
+	s.cacheUserStats(userID, stats, now)
+	s.userStatsMu.Unlock()
+	return stats, nil
+}
+
+// cacheUserStats запоминает статистику пользователя; вызывается под userStatsMu
+// Не чаще раза в userStatsCacheTTL устаревшие записи удаляются, а при userStatsCacheMax записей новые не добавляются
+func (s *Service) cacheUserStats(userID string, stats models.UserStats, now time.Time) {
+	if now.Sub(s.userStatsSwept) >= userStatsCacheTTL {
+		for id, cached := range s.userStatsCache {
+			if !now.Before(cached.expiresAt) {
+				delete(s.userStatsCache, id)
+			}
+		}
+		s.userStatsSwept = now
+	}
+	if _, ok := s.userStatsCache[userID]; !ok && len(s.userStatsCache) >= userStatsCacheMax {
+		return
+	}
+	s.userStatsCache[userID] = cachedUserStats{stats: stats, expiresAt: now.Add(userStatsCacheTTL)}
+}
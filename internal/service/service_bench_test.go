@@ -3,6 +3,7 @@ package service
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/tempizhere/goshorty/internal/models"
 )
@@ -27,20 +28,41 @@ func (m *benchmarkRepository) Save(id, url, userID string) (string, error) {
 	return id, nil
 }
 
-func (m *benchmarkRepository) Get(id string) (models.URL, bool) {
+func (m *benchmarkRepository) SaveURL(u models.URL) (string, error) {
+	id, err := m.Save(u.ShortID, u.OriginalURL, u.UserID)
+	if err != nil {
+		return id, err
+	}
+	stored := m.urls[id]
+	stored.Tags = u.Tags
+	m.urls[id] = stored
+	return id, nil
+}
+
+func (m *benchmarkRepository) Get(id string) (models.URL, bool, error) {
 	url, exists := m.urls[id]
-	return url, exists
+	return url, exists, nil
+}
+
+func (m *benchmarkRepository) BatchGet(ids []string) (map[string]models.URL, error) {
+	result := make(map[string]models.URL, len(ids))
+	for _, id := range ids {
+		if u, exists := m.urls[id]; exists {
+			result[id] = u
+		}
+	}
+	return result, nil
 }
 
 func (m *benchmarkRepository) Clear() {
 	m.urls = make(map[string]models.URL)
 }
 
-func (m *benchmarkRepository) BatchSave(urls map[string]string, userID string) error {
-	for id, url := range urls {
-		m.urls[id] = models.URL{
-			ShortID:     id,
-			OriginalURL: url,
+func (m *benchmarkRepository) BatchSave(items []models.BatchItem, userID string) error {
+	for _, item := range items {
+		m.urls[item.ShortID] = models.URL{
+			ShortID:     item.ShortID,
+			OriginalURL: item.OriginalURL,
 			UserID:      userID,
 		}
 	}
@@ -57,10 +79,56 @@ func (m *benchmarkRepository) GetURLsByUserID(userID string) ([]models.URL, erro
 	return result, nil
 }
 
+func (m *benchmarkRepository) GetURLsByUserAndTag(userID, tag string) ([]models.URL, error) {
+	var urls []models.URL
+	for _, u := range m.urls {
+		if u.UserID == userID && u.HasTag(tag) {
+			urls = append(urls, u)
+		}
+	}
+	return urls, nil
+}
+
 func (m *benchmarkRepository) BatchDelete(userID string, ids []string) error {
 	return nil
 }
 
+func (m *benchmarkRepository) DeleteByUserAndHost(userID, host string) (int, error) {
+	return 0, nil
+}
+
+func (m *benchmarkRepository) ReassignUser(fromUserID, toUserID string) (int, error) {
+	return 0, nil
+}
+
+func (m *benchmarkRepository) ClaimURL(id, tokenHash, userID string) error {
+	return nil
+}
+
+func (m *benchmarkRepository) SetNSFW(id string, nsfw bool) error {
+	return nil
+}
+
+func (m *benchmarkRepository) ReserveIDs(ids []string, userID string, createdAt time.Time) error {
+	return nil
+}
+
+func (m *benchmarkRepository) ActivateReserved(id, userID, originalURL string) error {
+	return nil
+}
+
+func (m *benchmarkRepository) GetUserIDsByURL(originalURL string) ([]string, error) {
+	return nil, nil
+}
+
+func (m *benchmarkRepository) SaveUser(userID string, firstSeen time.Time) error {
+	return nil
+}
+
+func (m *benchmarkRepository) Count() (int, error) {
+	return len(m.urls), nil
+}
+
 func (m *benchmarkRepository) GetStats() (int, int, error) {
 	urlCount := 0
 	userSet := make(map[string]struct{})
@@ -77,11 +145,23 @@ func (m *benchmarkRepository) GetStats() (int, int, error) {
 	return urlCount, len(userSet), nil
 }
 
+func (m *benchmarkRepository) GetUserStats(userID string, now time.Time) (models.UserStats, error) {
+	return models.UserStats{}, nil
+}
+
+func (m *benchmarkRepository) TopUsers(limit int) ([]models.UserURLCount, error) {
+	return nil, nil
+}
+
 func (m *benchmarkRepository) Close() error {
 	// Benchmark repository не имеет ресурсов для закрытия
 	return nil
 }
 
+func (m *benchmarkRepository) Name() string {
+	return "benchmark"
+}
+
 // Бенчмарки для генерации коротких ID
 func BenchmarkGenerateShortID(b *testing.B) {
 	svc := NewService(newBenchmarkRepository(), "http://localhost:8080", "secret")
@@ -101,7 +181,7 @@ func BenchmarkCreateShortURL(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, err := svc.CreateShortURL("https://example.com/very/long/url/that/needs/to/be/shortened", "user123")
+		_, _, err := svc.CreateShortURL("https://example.com/very/long/url/that/needs/to/be/shortened", "user123")
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -116,7 +196,7 @@ func BenchmarkCreateShortURLWithID(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		// Используем уникальный ID для каждой итерации
 		id := fmt.Sprintf("test%d", i)
-		_, err := svc.CreateShortURLWithID("https://example.com/very/long/url/that/needs/to/be/shortened", id, "user123")
+		_, _, err := svc.CreateShortURLWithID("https://example.com/very/long/url/that/needs/to/be/shortened", id, "user123")
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -128,14 +208,14 @@ func BenchmarkGetOriginalURL(b *testing.B) {
 	svc := NewService(newBenchmarkRepository(), "http://localhost:8080", "secret")
 
 	// Подготавливаем данные
-	_, err := svc.CreateShortURLWithID("https://example.com/very/long/url/that/needs/to/be/shortened", "test123", "user123")
+	_, _, err := svc.CreateShortURLWithID("https://example.com/very/long/url/that/needs/to/be/shortened", "test123", "user123")
 	if err != nil {
 		b.Fatal(err)
 	}
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, exists := svc.GetOriginalURL("test123")
+		_, exists, _ := svc.GetOriginalURL("test123")
 		if !exists {
 			b.Fatal("URL not found")
 		}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/models"
+)
+
+// clickLog запоминает записанные переходы
+type clickLog struct {
+	mu      sync.Mutex
+	weights map[string][]int
+}
+
+func (l *clickLog) RecordClick(id, _ string, weight int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.weights == nil {
+		l.weights = make(map[string][]int)
+	}
+	l.weights[id] = append(l.weights[id], weight)
+}
+
+func TestService_TrackClick(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	log := &clickLog{}
+	svc := NewService(&mockRepository{store: make(map[string]models.URL)}, "http://localhost:8080", "secret",
+		WithClock(func() time.Time { return now }),
+		WithClickRecorder(log),
+		WithClickRateLimit(2, 0),
+	)
+
+	// Сверх лимита переходы не записываются, а учитываются в весе следующей записи
+	for i := 0; i < 5; i++ {
+		svc.TrackClick("viral", "")
+	}
+	svc.TrackClick("calm", "")
+	assert.Equal(t, []int{1, 1}, log.weights["viral"])
+	assert.Equal(t, []int{1}, log.weights["calm"])
+	assert.Equal(t, []models.HotLink{{ShortID: "viral", Clicks: 5, Recorded: 2, SampleFactor: 2.5}}, svc.HotLinks())
+
+	now = now.Add(time.Second)
+	svc.TrackClick("viral", "")
+	assert.Equal(t, []int{1, 1, 4}, log.weights["viral"], "Skipped clicks must be carried into the next record")
+
+	total := 0
+	for _, w := range log.weights["viral"] {
+		total += w
+	}
+	assert.Equal(t, 6, total)
+}
+
+func TestService_TrackClick_Unlimited(t *testing.T) {
+	log := &clickLog{}
+	svc := NewService(&mockRepository{store: make(map[string]models.URL)}, "http://localhost:8080", "secret",
+		WithClickRecorder(log))
+	for i := 0; i < 3; i++ {
+		svc.TrackClick("id", "")
+	}
+	assert.Equal(t, []int{1, 1, 1}, log.weights["id"])
+	assert.Nil(t, svc.HotLinks())
+}
+
+func TestClickLimiter_Capacity(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := newClickLimiter(1, 2)
+
+	assert.Equal(t, 1, limiter.take("a", now))
+	assert.Equal(t, 0, limiter.take("a", now))
+	assert.Equal(t, 1, limiter.take("b", now))
+	assert.Equal(t, 1, limiter.take("c", now))
+	assert.Len(t, limiter.buckets, 2)
+
+	// Ссылка a вытеснена вместе с корзиной и снова записывается
+	assert.Empty(t, limiter.hot())
+	assert.Equal(t, 1, limiter.take("a", now))
+	_, tracked := limiter.buckets["b"]
+	assert.False(t, tracked, "Least recently used link should be evicted")
+}
+
+func TestHitCounter_Capacity(t *testing.T) {
+	counter := newHitCounter(2 * hitShards)
+	counter.add("a")
+	counter.add("a")
+	assert.Equal(t, int64(2), counter.get("a"))
+
+	for i := 0; i < 1000; i++ {
+		counter.add(strconv.Itoa(i))
+	}
+	total := 0
+	for i := range counter.shards {
+		assert.LessOrEqual(t, counter.shards[i].order.Len(), 2)
+		total += len(counter.shards[i].entries)
+	}
+	assert.LessOrEqual(t, total, 2*hitShards)
+	// Последняя открытая ссылка не вытесняется, давно не открывавшаяся начинает счёт заново
+	assert.Equal(t, int64(1), counter.get("999"))
+	assert.Equal(t, int64(0), counter.get("a"))
+}
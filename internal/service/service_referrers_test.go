@@ -0,0 +1,59 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tempizhere/goshorty/internal/models"
+	"github.com/tempizhere/goshorty/internal/repository"
+)
+
+func TestNormalizeReferrer(t *testing.T) {
+	tests := []struct {
+		referrer string
+		want     string
+	}{
+		{referrer: "https://News.Example.com/article?id=42", want: "news.example.com"},
+		{referrer: "http://blog.example:8080/post", want: "blog.example"},
+		{referrer: " https://chat.example/ ", want: "chat.example"},
+		{referrer: "android-app://com.example.app", want: ""},
+		{referrer: "not a url", want: ""},
+		{referrer: "", want: ""},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, normalizeReferrer(tt.referrer), tt.referrer)
+	}
+}
+
+func TestService_Referrers(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	for _, id := range []string{"id1", "id2", "id3"} {
+		_, err := repo.Save(id, "https://example.com/"+id, "user1")
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, repo.BatchDelete("user1", []string{"id3"}))
+
+	// Без WithReferrerTracking источники не записываются и не попадают в статистику
+	disabled := NewService(repo, "http://localhost:8080", "secret")
+	assert.False(t, disabled.TracksReferrers())
+	assert.NoError(t, disabled.RecordReferrer("id1", "https://news.example/a"))
+	stats, err := disabled.GetUserStats("user1")
+	assert.NoError(t, err)
+	assert.Nil(t, stats.TopReferrers)
+
+	svc := NewService(repo, "http://localhost:8080", "secret", WithReferrerTracking(true))
+	assert.True(t, svc.TracksReferrers())
+	for _, ref := range []string{"https://news.example/a", "https://news.example/b", "https://blog.example/", "", "garbage"} {
+		assert.NoError(t, svc.RecordReferrer("id2", ref))
+	}
+	assert.NoError(t, svc.RecordReferrer("id1", "https://chat.example/room"))
+	assert.NoError(t, svc.RecordReferrer("id3", "https://news.example/a"))
+
+	stats, err = svc.GetUserStats("user1")
+	assert.NoError(t, err)
+	// Ссылки упорядочены по числу переходов; удалённые ссылки не показываются
+	assert.Equal(t, []models.LinkReferrers{
+		{ShortID: "id2", Referrers: []models.ReferrerCount{{Referrer: "news.example", Clicks: 2}, {Referrer: "blog.example", Clicks: 1}}},
+		{ShortID: "id1", Referrers: []models.ReferrerCount{{Referrer: "chat.example", Clicks: 1}}},
+	}, stats.TopReferrers)
+}
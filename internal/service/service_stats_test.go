@@ -1,6 +1,7 @@
 package service
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -48,3 +49,68 @@ func TestService_GetStats(t *testing.T) {
 		assert.Equal(t, 0, users)
 	})
 }
+
+func TestService_TopUsers(t *testing.T) {
+	mockRepo := &mockRepository{store: make(map[string]models.URL)}
+	for i := 0; i < 3; i++ {
+		_, err := mockRepo.Save(fmt.Sprintf("a%d", i), fmt.Sprintf("https://a.example.com/%d", i), "user-a")
+		assert.NoError(t, err)
+	}
+	_, err := mockRepo.Save("b0", "https://b.example.com", "user-b")
+	assert.NoError(t, err)
+
+	t.Run("Plain user IDs", func(t *testing.T) {
+		svc := NewService(mockRepo, "http://localhost:8080", "test_secret")
+		users, err := svc.TopUsers(0)
+		assert.NoError(t, err)
+		assert.Equal(t, []models.UserURLCount{{UserID: "user-a", URLs: 3}, {UserID: "user-b", URLs: 1}}, users)
+
+		users, err = svc.TopUsers(1)
+		assert.NoError(t, err)
+		assert.Len(t, users, 1)
+	})
+
+	t.Run("Hashed user IDs", func(t *testing.T) {
+		svc := NewService(mockRepo, "http://localhost:8080", "test_secret", WithPIIMode(PIIModeHashed))
+		users, err := svc.TopUsers(10)
+		assert.NoError(t, err)
+		assert.Len(t, users, 2)
+		assert.Equal(t, HashUserID("user-a"), users[0].UserID)
+		assert.Len(t, users[0].UserID, 16)
+		assert.NotContains(t, users[0].UserID, "user-a")
+		assert.Equal(t, 3, users[0].URLs)
+	})
+}
+
+func TestService_TopUsers_Limit(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		want  int
+	}{
+		{name: "Default", limit: 0, want: DefaultTopUsersLimit},
+		{name: "Negative", limit: -5, want: DefaultTopUsersLimit},
+		{name: "Explicit", limit: 7, want: 7},
+		{name: "Capped", limit: MaxTopUsersLimit + 1, want: MaxTopUsersLimit},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := &limitRecordingRepository{}
+			svc := NewService(repo, "http://localhost:8080", "test_secret")
+			_, err := svc.TopUsers(tt.limit)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, repo.limit)
+		})
+	}
+}
+
+// limitRecordingRepository запоминает limit, переданный в TopUsers
+type limitRecordingRepository struct {
+	mockRepository
+	limit int
+}
+
+func (r *limitRecordingRepository) TopUsers(limit int) ([]models.UserURLCount, error) {
+	r.limit = limit
+	return nil, nil
+}
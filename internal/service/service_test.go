@@ -1,14 +1,24 @@
 package service
 
 import (
+	"context"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"math/rand/v2"
+	neturl "net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/tempizhere/goshorty/internal/models"
 	"github.com/tempizhere/goshorty/internal/repository"
+	"go.uber.org/zap"
 )
 
 // mockRepository для тестов
@@ -34,32 +44,55 @@ func (m *mockRepository) Save(id, url, userID string) (string, error) {
 	return id, nil
 }
 
-func (m *mockRepository) Get(id string) (models.URL, bool) {
+func (m *mockRepository) SaveURL(u models.URL) (string, error) {
+	id, err := m.Save(u.ShortID, u.OriginalURL, u.UserID)
+	if err != nil {
+		return id, err
+	}
+	stored := m.store[id]
+	stored.Tags = u.Tags
+	stored.CreatedAt = u.CreatedAt
+	m.store[id] = stored
+	return id, nil
+}
+
+func (m *mockRepository) Get(id string) (models.URL, bool, error) {
 	url, exists := m.store[id]
-	return url, exists
+	return url, exists, nil
+}
+
+func (m *mockRepository) BatchGet(ids []string) (map[string]models.URL, error) {
+	result := make(map[string]models.URL, len(ids))
+	for _, id := range ids {
+		if u, exists := m.store[id]; exists {
+			result[id] = u
+		}
+	}
+	return result, nil
 }
 
 func (m *mockRepository) Clear() {
 	m.store = make(map[string]models.URL)
 }
 
-func (m *mockRepository) BatchSave(urls map[string]string, userID string) error {
-	for _, url := range urls {
-		if url == "https://fail.com" {
+func (m *mockRepository) BatchSave(items []models.BatchItem, userID string) error {
+	for _, item := range items {
+		if item.OriginalURL == "https://fail.com" {
 			return errors.New("batch save failed")
 		}
 	}
-	for id, url := range urls {
+	for _, item := range items {
 		for _, existingURL := range m.store {
-			if existingURL.OriginalURL == url {
+			if existingURL.OriginalURL == item.OriginalURL {
 				return repository.ErrURLExists
 			}
 		}
-		m.store[id] = models.URL{
-			ShortID:     id,
-			OriginalURL: url,
+		m.store[item.ShortID] = models.URL{
+			ShortID:     item.ShortID,
+			OriginalURL: item.OriginalURL,
 			UserID:      userID,
 			DeletedFlag: false,
+			CreatedAt:   item.CreatedAt,
 		}
 	}
 	return nil
@@ -75,6 +108,16 @@ func (m *mockRepository) GetURLsByUserID(userID string) ([]models.URL, error) {
 	return urls, nil
 }
 
+func (m *mockRepository) GetURLsByUserAndTag(userID, tag string) ([]models.URL, error) {
+	var urls []models.URL
+	for _, u := range m.store {
+		if u.UserID == userID && u.HasTag(tag) {
+			urls = append(urls, u)
+		}
+	}
+	return urls, nil
+}
+
 func (m *mockRepository) BatchDelete(userID string, ids []string) error {
 	for _, id := range ids {
 		if u, exists := m.store[id]; exists && u.UserID == userID {
@@ -85,6 +128,93 @@ func (m *mockRepository) BatchDelete(userID string, ids []string) error {
 	return nil
 }
 
+func (m *mockRepository) DeleteByUserAndHost(userID, host string) (int, error) {
+	deleted := 0
+	for id, u := range m.store {
+		if parsed, err := neturl.Parse(u.OriginalURL); err == nil && u.UserID == userID && !u.DeletedFlag && parsed.Hostname() == host {
+			u.DeletedFlag = true
+			m.store[id] = u
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (m *mockRepository) ReassignUser(fromUserID, toUserID string) (int, error) {
+	moved := 0
+	for id, u := range m.store {
+		if u.UserID == fromUserID {
+			u.UserID = toUserID
+			m.store[id] = u
+			moved++
+		}
+	}
+	return moved, nil
+}
+
+func (m *mockRepository) ClaimURL(id, tokenHash, userID string) error {
+	u, ok := m.store[id]
+	if !ok || u.DeletedFlag || u.ClaimTokenHash == "" || u.ClaimTokenHash != tokenHash {
+		return repository.ErrClaimRejected
+	}
+	u.UserID = userID
+	u.ClaimTokenHash = ""
+	m.store[id] = u
+	return nil
+}
+
+func (m *mockRepository) SetNSFW(id string, nsfw bool) error {
+	u, ok := m.store[id]
+	if !ok {
+		return repository.ErrURLNotFound
+	}
+	u.NSFW = nsfw
+	m.store[id] = u
+	return nil
+}
+
+func (m *mockRepository) ReserveIDs(ids []string, userID string, createdAt time.Time) error {
+	for _, id := range ids {
+		if _, exists := m.store[id]; exists {
+			return repository.ErrIDExists
+		}
+	}
+	for _, id := range ids {
+		m.store[id] = models.URL{ShortID: id, UserID: userID, CreatedAt: createdAt, Reserved: true}
+	}
+	return nil
+}
+
+func (m *mockRepository) ActivateReserved(id, userID, originalURL string) error {
+	u, ok := m.store[id]
+	if !ok || !u.Reserved || u.UserID != userID {
+		return repository.ErrNotReserved
+	}
+	u.OriginalURL = originalURL
+	u.Reserved = false
+	m.store[id] = u
+	return nil
+}
+
+func (m *mockRepository) GetUserIDsByURL(originalURL string) ([]string, error) {
+	var userIDs []string
+	for _, u := range m.store {
+		if u.OriginalURL == originalURL && u.UserID != "" {
+			userIDs = append(userIDs, u.UserID)
+		}
+	}
+	sort.Strings(userIDs)
+	return userIDs, nil
+}
+
+func (m *mockRepository) SaveUser(userID string, firstSeen time.Time) error {
+	return nil
+}
+
+func (m *mockRepository) Count() (int, error) {
+	return len(m.store), nil
+}
+
 func (m *mockRepository) GetStats() (int, int, error) {
 	urlCount := 0
 	userSet := make(map[string]struct{})
@@ -101,54 +231,148 @@ func (m *mockRepository) GetStats() (int, int, error) {
 	return urlCount, len(userSet), nil
 }
 
+func (m *mockRepository) GetUserStats(userID string, now time.Time) (models.UserStats, error) {
+	var stats models.UserStats
+	for _, u := range m.store {
+		if u.UserID != userID {
+			continue
+		}
+		if u.DeletedFlag {
+			stats.Deleted++
+		} else {
+			stats.URLs++
+		}
+	}
+	return stats, nil
+}
+
+func (m *mockRepository) TopUsers(limit int) ([]models.UserURLCount, error) {
+	counts := make(map[string]*models.UserURLCount)
+	for _, u := range m.store {
+		c, ok := counts[u.UserID]
+		if !ok {
+			c = &models.UserURLCount{UserID: u.UserID}
+			counts[u.UserID] = c
+		}
+		if u.DeletedFlag {
+			c.Deleted++
+		} else {
+			c.URLs++
+		}
+	}
+	users := make([]models.UserURLCount, 0, len(counts))
+	for _, c := range counts {
+		users = append(users, *c)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		if users[i].URLs != users[j].URLs {
+			return users[i].URLs > users[j].URLs
+		}
+		return users[i].UserID < users[j].UserID
+	})
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
 func (m *mockRepository) Close() error {
 	// Mock repository не имеет ресурсов для закрытия
 	return nil
 }
 
+func (m *mockRepository) Name() string {
+	return "mock"
+}
+
+// notifyingRepository сообщает о завершении BatchDelete, позволяя дождаться асинхронного удаления
+type notifyingRepository struct {
+	*mockRepository
+	deleted chan struct{}
+}
+
+func (n *notifyingRepository) BatchDelete(userID string, ids []string) error {
+	defer close(n.deleted)
+	return n.mockRepository.BatchDelete(userID, ids)
+}
+
+// fakeClock — управляемые тестом часы для WithClock
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// sequenceIDs возвращает генератор, выдающий ID из списка по порядку
+func sequenceIDs(ids ...string) func(int) (string, error) {
+	var mu sync.Mutex
+	return func(int) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(ids) == 0 {
+			return "", errors.New("no more IDs")
+		}
+		id := ids[0]
+		ids = ids[1:]
+		return id, nil
+	}
+}
+
 func TestService(t *testing.T) {
 	const testUserID = "test_user"
 	repo := &mockRepository{store: make(map[string]models.URL)}
 	svc := NewService(repo, "http://localhost:8080", "secret")
 
 	// Тест 1: CreateShortURL успех
-	shortURL, err := svc.CreateShortURL("https://example.com", testUserID)
+	id, shortURL, err := svc.CreateShortURL("https://example.com", testUserID)
 	assert.NoError(t, err, "CreateShortURL should not return error")
-	assert.True(t, strings.HasPrefix(shortURL, "http://localhost:8080/"), "Short URL should start with baseURL")
-	id := shortURL[strings.LastIndex(shortURL, "/")+1:]
+	assert.Equal(t, "http://localhost:8080/"+id, shortURL, "Short URL should be built from the returned ID")
 	assert.Len(t, id, 8, "ID should be 8 characters long")
 
 	// Тест 2: CreateShortURL с дублирующимся URL
-	duplicateURL, err := svc.CreateShortURL("https://example.com", testUserID)
+	duplicateID, duplicateURL, err := svc.CreateShortURL("https://example.com", testUserID)
 	assert.ErrorIs(t, err, repository.ErrURLExists, "CreateShortURL should return ErrURLExists for duplicate URL")
+	assert.Equal(t, id, duplicateID, "Should return existing ID")
 	assert.Equal(t, shortURL, duplicateURL, "Should return existing short URL")
 
 	// Тест 3: CreateShortURL с пустым URL
-	_, err = svc.CreateShortURL("", testUserID)
+	_, _, err = svc.CreateShortURL("", testUserID)
 	assert.EqualError(t, err, "empty URL", "CreateShortURL should return empty URL error")
 
 	// Тест 4: CreateShortURLWithID с ошибкой сохранения
-	_, err = svc.CreateShortURLWithID("https://fail.com", "fail", testUserID)
+	_, _, err = svc.CreateShortURLWithID("https://fail.com", "fail", testUserID)
 	assert.EqualError(t, err, "save failed", "CreateShortURLWithID should return save error")
 
 	// Тест 5: CreateShortURLWithID с существующим ID
-	_, err = svc.CreateShortURLWithID("https://another.com", id, testUserID)
+	_, _, err = svc.CreateShortURLWithID("https://another.com", id, testUserID)
 	assert.ErrorIs(t, err, ErrIDAlreadyExists, "CreateShortURLWithID should return ID already exists error")
 
 	// Тест 6: CreateShortURLWithID с дублирующимся URL
 	_, err = repo.Save("existingID", "https://another.com", testUserID)
 	assert.NoError(t, err, "Save should not return error")
-	duplicateShortURL, err := svc.CreateShortURLWithID("https://another.com", "newID", testUserID)
+	duplicateShortID, duplicateShortURL, err := svc.CreateShortURLWithID("https://another.com", "newID", testUserID)
 	assert.ErrorIs(t, err, repository.ErrURLExists, "CreateShortURLWithID should return ErrURLExists for duplicate URL")
+	assert.Equal(t, "existingID", duplicateShortID, "Should return existing ID")
 	assert.Equal(t, "http://localhost:8080/existingID", duplicateShortURL, "Should return existing short URL")
 
 	// Тест 7: GetOriginalURL
-	url, exists := svc.GetOriginalURL(id)
+	url, exists, _ := svc.GetOriginalURL(id)
 	assert.True(t, exists, "URL should exist")
 	assert.Equal(t, "https://example.com", url, "URL should match")
 
 	// Тест 8: GetOriginalURL для несуществующего ID
-	_, exists = svc.GetOriginalURL("unknown")
+	_, exists, _ = svc.GetOriginalURL("unknown")
 	assert.False(t, exists, "URL should not exist")
 
 	// Тест 10: GetURLsByUserID успех
@@ -178,10 +402,10 @@ func TestService(t *testing.T) {
 	// Тест 12: BatchDelete успех
 	err = svc.BatchDelete(testUserID, []string{id, "existingID"})
 	assert.NoError(t, err, "BatchDelete should not return error")
-	u, exists := repo.Get(id)
+	u, exists, _ := repo.Get(id)
 	assert.True(t, exists, "URL should still exist")
 	assert.True(t, u.DeletedFlag, "URL should be marked as deleted")
-	_, exists = svc.GetOriginalURL(id)
+	_, exists, _ = svc.GetOriginalURL(id)
 	assert.False(t, exists, "GetOriginalURL should return false for deleted URL")
 
 	// Тест 13: BatchDelete для несуществующих ID
@@ -189,18 +413,53 @@ func TestService(t *testing.T) {
 	assert.NoError(t, err, "BatchDelete should not return error")
 
 	// Тест 14: BatchDeleteAsync успех
-	repo = &mockRepository{store: make(map[string]models.URL)}
-	svc = NewService(repo, "http://localhost:8080", "secret")
-	_, err = repo.Save("testID", "https://test.com", testUserID)
+	notifying := &notifyingRepository{mockRepository: &mockRepository{store: make(map[string]models.URL)}, deleted: make(chan struct{})}
+	svc = NewService(notifying, "http://localhost:8080", "secret")
+	_, err = notifying.Save("testID", "https://test.com", testUserID)
 	assert.NoError(t, err, "Save should not return error")
 	svc.BatchDeleteAsync(testUserID, []string{"testID"})
-	// Поскольку асинхронный вызов, проверяем через небольшой таймер
-	time.Sleep(100 * time.Millisecond)
-	u, exists = repo.Get("testID")
+	// Дожидаемся завершения асинхронного удаления
+	select {
+	case <-notifying.deleted:
+	case <-time.After(time.Second):
+		t.Fatal("BatchDeleteAsync did not complete")
+	}
+	u, exists, _ = notifying.Get("testID")
 	assert.True(t, exists, "URL should still exist")
 	assert.True(t, u.DeletedFlag, "URL should be marked as deleted")
 }
 
+func TestBatchDeleteAsyncResult(t *testing.T) {
+	const testUserID = "test_user"
+	repo := &mockRepository{store: make(map[string]models.URL)}
+	svc := NewService(repo, "http://localhost:8080", "secret")
+	_, err := repo.Save("testID", "https://test.com", testUserID)
+	assert.NoError(t, err)
+
+	select {
+	case err := <-svc.BatchDeleteAsyncResult(testUserID, []string{"testID"}):
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("BatchDeleteAsyncResult did not deliver a result")
+	}
+	u, _, _ := repo.Get("testID")
+	assert.True(t, u.DeletedFlag, "URL should be marked as deleted")
+
+	faulty := repository.WithFaults(repository.NewMemoryRepository(), repository.FaultConfig{
+		Methods: map[string]repository.FaultRule{"BatchDelete": {ErrorRate: 1}},
+	})
+	svc = NewService(faulty, "http://localhost:8080", "secret")
+	result := svc.BatchDeleteAsyncResult(testUserID, []string{"testID"})
+	select {
+	case err := <-result:
+		assert.ErrorIs(t, err, repository.ErrInjectedFault)
+	case <-time.After(time.Second):
+		t.Fatal("BatchDeleteAsyncResult did not deliver a result")
+	}
+	_, open := <-result
+	assert.False(t, open, "Result channel should be closed after delivering the outcome")
+}
+
 func TestBatchShorten(t *testing.T) {
 	const testUserID = "test_user"
 	tests := []struct {
@@ -295,7 +554,7 @@ func TestBatchShorten(t *testing.T) {
 
 				// Проверяем, что URL сохранен в хранилище
 				id := r.ShortURL[strings.LastIndex(r.ShortURL, "/")+1:]
-				originalURL, exists := repo.Get(id)
+				originalURL, exists, _ := repo.Get(id)
 				assert.True(t, exists)
 				assert.Equal(t, tt.reqs[i].OriginalURL, originalURL.OriginalURL)
 			}
@@ -303,6 +562,83 @@ func TestBatchShorten(t *testing.T) {
 	}
 }
 
+func TestBatchShorten_ConcurrentBatches(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	svc := NewService(repo, "http://localhost:8080", "secret")
+
+	const batchSize = 100
+	results := make([][]models.BatchResponse, 2)
+	var wg sync.WaitGroup
+	for b := range results {
+		wg.Add(1)
+		go func(b int) {
+			defer wg.Done()
+			reqs := make([]models.BatchRequest, batchSize)
+			for i := range reqs {
+				reqs[i] = models.BatchRequest{
+					CorrelationID: fmt.Sprintf("%d", i),
+					OriginalURL:   fmt.Sprintf("https://batch%d.example.com/%d", b, i),
+				}
+			}
+			resp, err := svc.BatchShorten(reqs, fmt.Sprintf("user%d", b))
+			assert.NoError(t, err)
+			results[b] = resp
+		}(b)
+	}
+	wg.Wait()
+
+	// Все ID уникальны и указывают на URL своего пакета
+	seen := make(map[string]struct{})
+	for b, resp := range results {
+		assert.Len(t, resp, batchSize)
+		for i, r := range resp {
+			id := strings.TrimPrefix(r.ShortURL, "http://localhost:8080/")
+			_, dup := seen[id]
+			assert.False(t, dup, "ID collision between batches: %s", id)
+			seen[id] = struct{}{}
+			u, exists, _ := svc.Get(id)
+			assert.True(t, exists)
+			assert.Equal(t, fmt.Sprintf("https://batch%d.example.com/%d", b, i), u.OriginalURL, "URL must not be overwritten")
+		}
+	}
+}
+
+func TestBatchShorten_PreservesOrder(t *testing.T) {
+	fileRepo, err := repository.NewFileRepository(filepath.Join(t.TempDir(), "storage.json"), zap.NewNop())
+	assert.NoError(t, err)
+	defer func() { assert.NoError(t, fileRepo.Close()) }()
+	repos := map[string]repository.Repository{
+		"memory": repository.NewMemoryRepository(),
+		"file":   fileRepo,
+	}
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			svc := NewService(repo, "http://localhost:8080", "secret")
+
+			// correlation_id не совпадают с позицией, чтобы соответствие проверялось по обоим признакам
+			const batchSize = 1000
+			reqs := make([]models.BatchRequest, batchSize)
+			for i := range reqs {
+				reqs[i] = models.BatchRequest{
+					CorrelationID: fmt.Sprintf("corr-%d", (i*7919)%batchSize),
+					OriginalURL:   fmt.Sprintf("https://order.example.com/%d", i),
+				}
+			}
+			resp, err := svc.BatchShorten(reqs, "user1")
+			assert.NoError(t, err)
+			if !assert.Len(t, resp, batchSize) {
+				return
+			}
+			for i, r := range resp {
+				assert.Equal(t, reqs[i].CorrelationID, r.CorrelationID, "response %d is out of order", i)
+				u, exists, _ := svc.Get(strings.TrimPrefix(r.ShortURL, "http://localhost:8080/"))
+				assert.True(t, exists)
+				assert.Equal(t, reqs[i].OriginalURL, u.OriginalURL, "response %d points to another request's URL", i)
+			}
+		})
+	}
+}
+
 func TestJWT(t *testing.T) {
 	svc := NewService(&mockRepository{store: make(map[string]models.URL)}, "http://localhost:8080", "secret")
 
@@ -327,3 +663,648 @@ func TestJWT(t *testing.T) {
 	_, err = svcWrongSecret.ParseJWT(token)
 	assert.ErrorIs(t, err, ErrInvalidToken, "ParseJWT should return ErrInvalidToken with wrong secret")
 }
+
+func TestService_CreateShortURLWithTags(t *testing.T) {
+	const testUserID = "test_user"
+	repo := &mockRepository{store: make(map[string]models.URL)}
+	svc := NewService(repo, "http://localhost:8080", "secret")
+
+	// Метки нормализуются: пробелы по краям, пустые и повторяющиеся значения отбрасываются
+	_, shortURL, err := svc.CreateShortURLWithTags("https://example.com", testUserID, []string{" work ", "", "work", "docs"})
+	assert.NoError(t, err)
+	id := shortURL[strings.LastIndex(shortURL, "/")+1:]
+	u, exists, _ := repo.Get(id)
+	assert.True(t, exists)
+	assert.Equal(t, []string{"work", "docs"}, u.Tags)
+
+	_, _, err = svc.CreateShortURL("https://untagged.com", testUserID)
+	assert.NoError(t, err)
+
+	// Фильтрация по метке возвращает только помеченные ссылки
+	urls, err := svc.GetURLsByUserAndTag(testUserID, "work")
+	assert.NoError(t, err)
+	assert.Len(t, urls, 1)
+	assert.Equal(t, shortURL, urls[0].ShortURL)
+	assert.Equal(t, "https://example.com", urls[0].OriginalURL)
+
+	urls, err = svc.GetURLsByUserAndTag(testUserID, "unknown")
+	assert.NoError(t, err)
+	assert.Len(t, urls, 0)
+}
+
+func TestService_GetUserStats(t *testing.T) {
+	repo := &mockRepository{store: make(map[string]models.URL)}
+	svc := NewService(repo, "http://localhost:8080", "secret")
+
+	repo.store["id1"] = models.URL{ShortID: "id1", OriginalURL: "https://a.com", UserID: "user1"}
+	repo.store["id2"] = models.URL{ShortID: "id2", OriginalURL: "https://b.com", UserID: "user1", DeletedFlag: true}
+
+	stats, err := svc.GetUserStats("user1")
+	assert.NoError(t, err)
+	assert.Equal(t, models.UserStats{URLs: 1, Deleted: 1}, stats)
+
+	// Новый пользователь получает нули
+	stats, err = svc.GetUserStats("new_user")
+	assert.NoError(t, err)
+	assert.Equal(t, models.UserStats{}, stats)
+
+	// Повторный запрос в пределах TTL обслуживается из кеша
+	repo.store["id3"] = models.URL{ShortID: "id3", OriginalURL: "https://c.com", UserID: "user1"}
+	stats, err = svc.GetUserStats("user1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats.URLs, "Stats should be served from cache")
+}
+
+func TestService_GetUserStatsCacheBounded(t *testing.T) {
+	repo := &mockRepository{store: make(map[string]models.URL)}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	svc := NewService(repo, "http://localhost:8080", "secret", WithClock(func() time.Time { return now }))
+
+	for i := 0; i < userStatsCacheMax+10; i++ {
+		_, err := svc.GetUserStats(fmt.Sprintf("user%d", i))
+		assert.NoError(t, err)
+	}
+	assert.Len(t, svc.userStatsCache, userStatsCacheMax)
+
+	// Устаревшие записи удаляются при следующем добавлении
+	now = now.Add(userStatsCacheTTL)
+	_, err := svc.GetUserStats("late_user")
+	assert.NoError(t, err)
+	assert.Len(t, svc.userStatsCache, 1)
+}
+
+func TestService_GetUserStatsClicks(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	svc := NewService(repo, "http://localhost:8080", "secret")
+	_, err := repo.Save("id1", "https://a.com", "user1")
+	assert.NoError(t, err)
+	_, err = repo.Save("id2", "https://b.com", "user1")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.RecordClicks("id1", "", 3))
+	assert.NoError(t, repo.RecordClicks("id2", "", 2))
+
+	stats, err := svc.GetUserStats("user1")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, stats.ClicksTotal)
+}
+
+func TestService_DeleteByHost(t *testing.T) {
+	repo := &mockRepository{store: make(map[string]models.URL)}
+	svc := NewService(repo, "http://localhost:8080", "secret")
+
+	repo.store["id1"] = models.URL{ShortID: "id1", OriginalURL: "https://old.example.com/a", UserID: "user1"}
+	repo.store["id2"] = models.URL{ShortID: "id2", OriginalURL: "https://new.example.com/b", UserID: "user1"}
+	repo.store["id3"] = models.URL{ShortID: "id3", OriginalURL: "https://old.example.com/c", UserID: "user2"}
+
+	for _, host := range []string{"", "  ", "https://old.example.com", "old.example.com:443", "old.example.com/a"} {
+		_, err := svc.DeleteByHost("user1", host)
+		assert.ErrorIs(t, err, ErrInvalidHost, host)
+	}
+
+	// Хост приводится к нижнему регистру, завершающая точка отбрасывается
+	deleted, err := svc.DeleteByHost("user1", " Old.Example.COM. ")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+	assert.True(t, repo.store["id1"].DeletedFlag)
+	assert.False(t, repo.store["id2"].DeletedFlag)
+	assert.False(t, repo.store["id3"].DeletedFlag)
+}
+
+func TestService_RotateUserID(t *testing.T) {
+	repo := &mockRepository{store: make(map[string]models.URL)}
+	svc := NewService(repo, "http://localhost:8080", "secret")
+
+	repo.store["id1"] = models.URL{ShortID: "id1", OriginalURL: "https://example.com/a", UserID: "user1"}
+	repo.store["id2"] = models.URL{ShortID: "id2", OriginalURL: "https://example.com/b", UserID: "user1", DeletedFlag: true}
+	repo.store["id3"] = models.URL{ShortID: "id3", OriginalURL: "https://example.com/c", UserID: "user2"}
+
+	// Статистика прежнего идентификатора не остаётся в кеше после ротации
+	stats, err := svc.GetUserStats("user1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats.URLs)
+
+	newUserID, moved, err := svc.RotateUserID("user1")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, moved)
+	assert.NotEmpty(t, newUserID)
+	assert.NotEqual(t, "user1", newUserID)
+	assert.Equal(t, newUserID, repo.store["id1"].UserID)
+	assert.Equal(t, newUserID, repo.store["id2"].UserID)
+	assert.Equal(t, "user2", repo.store["id3"].UserID)
+
+	stats, err = svc.GetUserStats("user1")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, stats.URLs)
+}
+
+func TestService_ReservedIDs(t *testing.T) {
+	repo := &mockRepository{store: make(map[string]models.URL)}
+	svc := NewService(repo, "http://localhost:8080", "secret")
+
+	for _, id := range []string{"favicon.ico", "robots.txt"} {
+		assert.True(t, IsReservedID(id))
+		_, _, err := svc.CreateShortURLWithID("https://example.com/"+id, id, "user1")
+		assert.ErrorIs(t, err, ErrReservedID)
+	}
+	assert.False(t, IsReservedID("abc123"))
+}
+
+func TestBatchShortenContext_Canceled(t *testing.T) {
+	repo := &mockRepository{store: make(map[string]models.URL)}
+	svc := NewService(repo, "http://localhost:8080", "secret")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	reqs := []models.BatchRequest{
+		{CorrelationID: "1", OriginalURL: "https://example.com/1"},
+		{CorrelationID: "2", OriginalURL: "https://example.com/2"},
+	}
+	resp, err := svc.BatchShortenContext(ctx, reqs, "user1")
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, resp)
+	assert.Empty(t, repo.store, "Canceled batch should not be saved")
+}
+
+// blockingBatchRepository задерживает BatchSave до закрытия release, сообщая о начале каждого сохранения
+type blockingBatchRepository struct {
+	repository.Repository
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingBatchRepository) BatchSave(items []models.BatchItem, userID string) error {
+	b.started <- struct{}{}
+	<-b.release
+	return b.Repository.BatchSave(items, userID)
+}
+
+func TestBatchShorten_ConcurrencyLimit(t *testing.T) {
+	const limit = 2
+	batch := func(n int) []models.BatchRequest {
+		return []models.BatchRequest{{CorrelationID: "1", OriginalURL: fmt.Sprintf("https://limit.example.com/%d", n)}}
+	}
+
+	for _, policy := range []BatchLimitPolicy{BatchLimitReject, BatchLimitQueue} {
+		t.Run(string(policy), func(t *testing.T) {
+			repo := &blockingBatchRepository{
+				Repository: repository.NewMemoryRepository(),
+				started:    make(chan struct{}, limit+1),
+				release:    make(chan struct{}),
+			}
+			svc := NewService(repo, "http://localhost:8080", "secret", WithBatchConcurrency(limit, policy))
+
+			var wg sync.WaitGroup
+			for i := range limit {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := svc.BatchShorten(batch(i), "user1")
+					assert.NoError(t, err)
+				}()
+			}
+			for range limit {
+				<-repo.started
+			}
+
+			if policy == BatchLimitReject {
+				_, err := svc.BatchShorten(batch(limit), "user1")
+				assert.ErrorIs(t, err, ErrBatchLimit)
+			} else {
+				// В очереди пакет ждёт слот не дольше, чем живёт контекст запроса
+				ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+				_, err := svc.BatchShortenContext(ctx, batch(limit), "user1")
+				cancel()
+				assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+				queued := make(chan error, 1)
+				go func() {
+					_, err := svc.BatchShorten(batch(limit), "user1")
+					queued <- err
+				}()
+				select {
+				case <-repo.started:
+					t.Fatal("Queued batch must wait for a free slot")
+				case <-time.After(20 * time.Millisecond):
+				}
+				close(repo.release)
+				assert.NoError(t, <-queued)
+			}
+
+			if policy == BatchLimitReject {
+				close(repo.release)
+			}
+			wg.Wait()
+
+			// Освободившиеся слоты снова доступны
+			_, err := svc.BatchShorten(batch(limit+1), "user1")
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestService_WithClock(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	repo := &mockRepository{store: make(map[string]models.URL)}
+	svc := NewService(repo, "http://localhost:8080", "secret", WithClock(clock.Now))
+
+	// JWT действует 24 часа по часам сервиса
+	token, err := svc.GenerateJWT("user1")
+	assert.NoError(t, err)
+	clock.Advance(23 * time.Hour)
+	userID, err := svc.ParseJWT(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "user1", userID)
+	clock.Advance(2 * time.Hour)
+	userID, err = svc.ParseJWT(token)
+	assert.ErrorIs(t, err, ErrInvalidToken, "Expired token should be rejected")
+	// Для истёкшего токена с верной подписью идентификатор возвращается вместе с ошибкой
+	assert.ErrorIs(t, err, ErrExpiredToken)
+	assert.Equal(t, "user1", userID)
+	var expired *ExpiredTokenError
+	if assert.ErrorAs(t, err, &expired) {
+		assert.Equal(t, time.Hour, expired.ExpiredFor())
+	}
+	userID, err = svc.ParseJWT(token[:len(token)-2] + "xx")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	assert.NotErrorIs(t, err, ErrExpiredToken, "Tampered token must not look merely expired")
+	assert.Empty(t, userID)
+
+	// Время создания URL берётся из часов сервиса
+	_, _, err = svc.CreateShortURLWithID("https://example.com", "id1", "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, clock.Now(), repo.store["id1"].CreatedAt)
+	batch, err := svc.BatchShorten([]models.BatchRequest{{CorrelationID: "1", OriginalURL: "https://batch.com"}}, "user2")
+	assert.NoError(t, err)
+	assert.Equal(t, clock.Now(), repo.store[batch[0].ShortID].CreatedAt)
+	reserved, err := svc.ReserveShortIDs(1, "user2")
+	assert.NoError(t, err)
+	assert.Equal(t, clock.Now(), repo.store[reserved[0]].CreatedAt)
+
+	// Кеш статистики истекает по часам сервиса
+	stats, err := svc.GetUserStats("user1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, stats.URLs)
+	repo.store["id2"] = models.URL{ShortID: "id2", OriginalURL: "https://b.com", UserID: "user1"}
+	clock.Advance(userStatsCacheTTL - time.Second)
+	stats, _ = svc.GetUserStats("user1")
+	assert.Equal(t, 1, stats.URLs, "Stats should be served from cache")
+	clock.Advance(time.Second)
+	stats, _ = svc.GetUserStats("user1")
+	assert.Equal(t, 2, stats.URLs, "Stats should be refreshed after TTL")
+
+	detailed, err := svc.GetDetailedStats()
+	assert.NoError(t, err)
+	assert.Equal(t, int64((25*time.Hour + userStatsCacheTTL).Seconds()), detailed.UptimeSeconds)
+}
+
+func TestService_WithIDGenerator(t *testing.T) {
+	repo := &mockRepository{store: make(map[string]models.URL)}
+	repo.store["taken"] = models.URL{ShortID: "taken", OriginalURL: "https://taken.com"}
+	svc := NewService(repo, "http://localhost:8080", "secret",
+		WithIDGenerator(sequenceIDs("taken", "first", "first", "taken", "second", "third")))
+	retries := idGenerationRetries.Value()
+
+	// Занятый ID пропускается, создаётся следующий
+	_, shortURL, err := svc.CreateShortURL("https://example.com", "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/first", shortURL)
+	assert.Equal(t, int64(1), idGenerationRetries.Value()-retries, "Each regeneration is counted")
+
+	// В пакете повторяющиеся и занятые ID генерируются заново
+	resp, err := svc.BatchShorten([]models.BatchRequest{
+		{CorrelationID: "1", OriginalURL: "https://a.com"},
+		{CorrelationID: "2", OriginalURL: "https://b.com"},
+	}, "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.BatchResponse{
+		{CorrelationID: "1", ShortURL: "http://localhost:8080/second", ShortID: "second"},
+		{CorrelationID: "2", ShortURL: "http://localhost:8080/third", ShortID: "third"},
+	}, resp)
+	assert.Equal(t, int64(3), idGenerationRetries.Value()-retries)
+
+	// Ошибка генератора возвращается вызывающему
+	_, err = svc.GenerateUserID()
+	assert.EqualError(t, err, "no more IDs")
+}
+
+// batchGetCounter считает обращения к хранилищу за проверкой занятости ID
+type batchGetCounter struct {
+	*mockRepository
+	gets      int
+	batchGets int
+}
+
+func (r *batchGetCounter) Get(id string) (models.URL, bool, error) {
+	r.gets++
+	return r.mockRepository.Get(id)
+}
+
+func (r *batchGetCounter) BatchGet(ids []string) (map[string]models.URL, error) {
+	r.batchGets++
+	return r.mockRepository.BatchGet(ids)
+}
+
+func TestService_ReserveShortIDs_BatchGet(t *testing.T) {
+	repo := &batchGetCounter{mockRepository: &mockRepository{store: make(map[string]models.URL)}}
+	repo.store["taken"] = models.URL{ShortID: "taken", OriginalURL: "https://taken.com"}
+	svc := NewService(repo, "http://localhost:8080", "secret",
+		WithIDGenerator(sequenceIDs("a", "taken", "a", "b", "c")))
+
+	// Занятость всего пакета проверяется одним запросом, занятый ID заменяется во втором раунде
+	ids, err := svc.ReserveShortIDs(3, "printer")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, ids)
+	assert.Equal(t, 0, repo.gets)
+	assert.Equal(t, 2, repo.batchGets)
+}
+
+func TestService_UserIDEncoding(t *testing.T) {
+	tests := []struct {
+		encoding UserIDEncoding
+		pattern  string
+	}{
+		{encoding: "", pattern: `^[A-Za-z0-9_-]{8}$`},
+		{encoding: UserIDBase64URL, pattern: `^[A-Za-z0-9_-]{8}$`},
+		{encoding: UserIDHex, pattern: `^[0-9a-f]{12}$`},
+		{encoding: UserIDBase62, pattern: `^[A-Za-z0-9]{8}$`},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.encoding), func(t *testing.T) {
+			svc := NewService(&mockRepository{store: make(map[string]models.URL)}, "http://localhost:8080", "secret",
+				WithUserIDEncoding(tt.encoding))
+			re := regexp.MustCompile(tt.pattern)
+
+			for i := 0; i < 100; i++ {
+				userID, err := svc.GenerateUserID()
+				assert.NoError(t, err)
+				assert.Regexp(t, re, userID)
+
+				// Идентификатор переживает выдачу и разбор JWT без изменений
+				token, err := svc.GenerateJWT(userID)
+				assert.NoError(t, err)
+				parsed, err := svc.ParseJWT(token)
+				assert.NoError(t, err)
+				assert.Equal(t, userID, parsed)
+			}
+			if tt.encoding == UserIDHex {
+				userID, _ := svc.GenerateUserID()
+				_, err := hex.DecodeString(userID)
+				assert.NoError(t, err)
+			}
+
+			// Короткие ID не зависят от кодировки идентификаторов пользователей
+			shortID, err := svc.GenerateShortID()
+			assert.NoError(t, err)
+			assert.Regexp(t, `^[A-Za-z0-9_-]{8}$`, shortID)
+		})
+	}
+}
+
+func TestService_UserIDEncodingWithIDGenerator(t *testing.T) {
+	for _, tt := range []struct {
+		encoding UserIDEncoding
+		length   int
+	}{
+		{encoding: UserIDBase64URL, length: 8},
+		{encoding: UserIDHex, length: 12},
+		{encoding: UserIDBase62, length: 8},
+	} {
+		t.Run(string(tt.encoding), func(t *testing.T) {
+			var lengths []int
+			svc := NewService(&mockRepository{store: make(map[string]models.URL)}, "http://localhost:8080", "secret",
+				WithUserIDEncoding(tt.encoding),
+				WithIDGenerator(func(length int) (string, error) {
+					lengths = append(lengths, length)
+					return strings.Repeat("a", length), nil
+				}))
+
+			// Заданный генератор выдаёт идентификаторы пользователей в любой кодировке
+			userID, err := svc.GenerateUserID()
+			assert.NoError(t, err)
+			assert.Equal(t, strings.Repeat("a", tt.length), userID)
+			assert.Equal(t, []int{tt.length}, lengths)
+		})
+	}
+}
+
+func TestValidateIDAlphabet(t *testing.T) {
+	tests := []struct {
+		name     string
+		alphabet string
+		wantErr  bool
+	}{
+		{name: "Default", alphabet: DefaultIDAlphabet},
+		{name: "Human readable", alphabet: "23456789abcdefghijkmnpqrstuvwxyz"},
+		{name: "Too short", alphabet: "abcdef", wantErr: true},
+		{name: "Duplicate", alphabet: "abcdefghijklmnoa", wantErr: true},
+		{name: "Reserved character", alphabet: "abcdefghijklmno+", wantErr: true},
+		{name: "Non-ASCII", alphabet: "abcdefghijklmnoя", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateIDAlphabet(tt.alphabet)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidIDAlphabet)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestService_IDSpaceFillRatio(t *testing.T) {
+	svc := NewService(&mockRepository{store: make(map[string]models.URL)}, "http://localhost:8080", "secret",
+		WithIDAlphabet("0123456789abcdef"), WithShortIDLength(2))
+	assert.Equal(t, 2, svc.ShortIDLength())
+
+	id, err := svc.GenerateShortID()
+	assert.NoError(t, err)
+	assert.Regexp(t, `^[0-9a-f]{2}$`, id)
+	// Длина идентификаторов пользователей не меняется
+	userID, err := svc.GenerateUserID()
+	assert.NoError(t, err)
+	assert.Len(t, userID, shortIDLength)
+
+	for i := 0; i < 64; i++ {
+		_, _, err := svc.CreateShortURLWithID(fmt.Sprintf("https://example.com/%d", i), fmt.Sprintf("%02x", i), "user1")
+		assert.NoError(t, err)
+	}
+	ratio, err := svc.IDSpaceFillRatio()
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.25, ratio, 1e-9)
+
+	// Длина по умолчанию даёт ничтожную долю
+	svc = NewService(&mockRepository{store: make(map[string]models.URL)}, "http://localhost:8080", "secret",
+		WithShortIDLength(0))
+	assert.Equal(t, shortIDLength, svc.ShortIDLength())
+	_, _, err = svc.CreateShortURL("https://example.com", "user1")
+	assert.NoError(t, err)
+	ratio, err = svc.IDSpaceFillRatio()
+	assert.NoError(t, err)
+	assert.Less(t, ratio, 1e-12)
+}
+
+func TestService_WithIDAlphabet(t *testing.T) {
+	// Алфавит без легко путаемых символов 0/O/1/l/I
+	const alphabet = "23456789ABCDEFGHJKMNPQRSTUVWXYZabcdefghijkmnpqrstuvwxyz"
+	svc := NewService(&mockRepository{store: make(map[string]models.URL)}, "http://localhost:8080", "secret",
+		WithIDAlphabet(alphabet))
+
+	counts := make(map[rune]int)
+	for i := 0; i < 2000; i++ {
+		id, err := svc.GenerateShortID()
+		assert.NoError(t, err)
+		assert.Len(t, id, shortIDLength)
+		for _, c := range id {
+			assert.True(t, strings.ContainsRune(alphabet, c), "unexpected character %q in %s", c, id)
+			counts[c]++
+		}
+	}
+	// Все символы алфавита используются: 16000 символов на 55 вариантов
+	assert.Len(t, counts, len(alphabet))
+
+	// Созданные URL получают ID из заданного алфавита
+	_, shortURL, err := svc.CreateShortURL("https://example.com", "user1")
+	assert.NoError(t, err)
+	id := strings.TrimPrefix(shortURL, "http://localhost:8080/")
+	assert.Len(t, id, shortIDLength)
+	assert.Empty(t, strings.Trim(id, alphabet))
+
+	// Некорректный алфавит не применяется
+	svc = NewService(&mockRepository{store: make(map[string]models.URL)}, "http://localhost:8080", "secret",
+		WithIDAlphabet("abc"))
+	id, err = svc.GenerateShortID()
+	assert.NoError(t, err)
+	assert.Regexp(t, `^[A-Za-z0-9_-]{8}$`, id)
+}
+
+func TestValidateShortURLTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		valid    bool
+	}{
+		{template: DefaultShortURLTemplate, valid: true},
+		{template: "{base}/go/{id}", valid: true},
+		{template: "{base}/{id}.html", valid: true},
+		{template: "{base}/l/x-{id}", valid: true},
+		{template: "{base}/go/", valid: false},
+		{template: "{base}/{id}/{id}", valid: false},
+		{template: "https://example.com/{id}", valid: false},
+		{template: "{base}{id}", valid: false},
+		{template: "{base}/{id}/info", valid: false},
+		{template: "{base}/{id}?x=1", valid: false},
+		{template: "{base}//{id}", valid: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template, func(t *testing.T) {
+			err := ValidateShortURLTemplate(tt.template)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidShortURLTemplate)
+			}
+		})
+	}
+}
+
+func TestService_WithShortURLTemplate(t *testing.T) {
+	repo := &mockRepository{store: make(map[string]models.URL)}
+	svc := NewService(repo, "http://localhost:8080/", "secret",
+		WithShortURLTemplate("{base}/go/{id}.html"), WithIDGenerator(sequenceIDs("abc", "def")))
+
+	_, shortURL, err := svc.CreateShortURL("https://example.com", "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/go/abc.html", shortURL)
+
+	resp, err := svc.BatchShorten([]models.BatchRequest{{CorrelationID: "1", OriginalURL: "https://example.org"}}, "user1")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/go/def.html", resp[0].ShortURL)
+
+	urls, err := svc.GetURLsByUserID("user1")
+	assert.NoError(t, err)
+	for _, u := range urls {
+		id, err := svc.URLBuilder().Parse(u.ShortURL)
+		assert.NoError(t, err)
+		assert.Equal(t, u.ShortID, id)
+	}
+
+	for _, foreign := range []string{"http://localhost:8080/abc", "http://localhost:8080/go/abc", "http://localhost:8080/go/.html"} {
+		_, err := svc.URLBuilder().Parse(foreign)
+		assert.ErrorIs(t, err, ErrNotShortURL, foreign)
+	}
+
+	// Некорректный шаблон оставляет шаблон по умолчанию
+	svc = NewService(repo, "http://localhost:8080", "secret", WithShortURLTemplate("{base}/go"))
+	assert.Equal(t, "http://localhost:8080/xyz", svc.URLBuilder().Build("xyz"))
+}
+
+func TestURLBuilder(t *testing.T) {
+	b, err := NewURLBuilder("http://localhost:8080/", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/abc", b.Build("abc"))
+	assert.Equal(t, "https://short.example/abc", b.WithBase("https://short.example").Build("abc"))
+
+	ns, err := b.WithNamespace("team")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/team/abc", ns.Build("abc"))
+	prefix, suffix := ns.Path()
+	assert.Equal(t, "/team/", prefix)
+	assert.Empty(t, suffix)
+	_, err = ns.Parse("http://localhost:8080/abc")
+	assert.ErrorIs(t, err, ErrNotShortURL)
+	_, err = b.WithNamespace("a/b")
+	assert.ErrorIs(t, err, ErrInvalidNamespace)
+
+	_, err = NewURLBuilder("http://localhost:8080", "{base}/go")
+	assert.ErrorIs(t, err, ErrInvalidShortURLTemplate)
+}
+
+func TestURLBuilder_ParseBuildRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	randomID := func() string {
+		id := make([]byte, 1+rng.IntN(16))
+		for i := range id {
+			id[i] = DefaultIDAlphabet[rng.IntN(len(DefaultIDAlphabet))]
+		}
+		return string(id)
+	}
+
+	for _, base := range []string{"http://localhost:8080", "https://short.example/links/"} {
+		for _, template := range []string{"", "{base}/go/{id}", "{base}/{id}.html", "{base}/l/x-{id}"} {
+			for _, namespace := range []string{"", "team"} {
+				b, err := NewURLBuilder(base, template)
+				assert.NoError(t, err)
+				b, err = b.WithNamespace(namespace)
+				assert.NoError(t, err)
+				for i := 0; i < 200; i++ {
+					id := randomID()
+					got, err := b.Parse(b.Build(id))
+					if !assert.NoError(t, err, "%s %s %s %s", base, template, namespace, id) {
+						return
+					}
+					assert.Equal(t, id, got)
+				}
+			}
+		}
+	}
+}
+
+func TestService_CreateShortURLForceNew(t *testing.T) {
+	repo := repository.NewMemoryRepository()
+	svc := NewService(repo, "http://localhost:8080", "secret", WithIDGenerator(sequenceIDs("abc", "def")))
+
+	_, first, err := svc.CreateShortURL("https://example.com", "user1")
+	assert.NoError(t, err)
+	_, second, token, err := svc.CreateShortURLForceNew("https://example.com", "user1", nil, "", true)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/abc", first)
+	assert.Equal(t, "http://localhost:8080/def", second)
+	assert.NotEmpty(t, token)
+
+	// Хранилище без DuplicateSaver не создаёт повторную ссылку
+	svc = NewService(&mockRepository{store: make(map[string]models.URL)}, "http://localhost:8080", "secret")
+	_, _, _, err = svc.CreateShortURLForceNew("https://example.com", "user1", nil, "", false)
+	assert.ErrorIs(t, err, ErrDuplicatesUnsupported)
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DefaultShortURLTemplate — шаблон коротких URL по умолчанию: базовый URL и ID через слэш
+const DefaultShortURLTemplate = "{base}/{id}"
+
+// Подстановки шаблона коротких URL
+const (
+	templateBase = "{base}" // Базовый URL без завершающего слэша
+	templateID   = "{id}"   // Короткий ID
+)
+
+// ErrInvalidShortURLTemplate возвращается, если шаблон коротких URL не подходит для построения и разбора адресов
+var ErrInvalidShortURLTemplate = errors.New("invalid short URL template")
+
+// ValidateShortURLTemplate проверяет шаблон коротких URL: он начинается с "{base}/", содержит ровно один "{id}"
+// в последнем сегменте пути, а остальной путь не содержит других подстановок, запроса и фрагмента
+func ValidateShortURLTemplate(template string) error {
+	path, ok := strings.CutPrefix(template, templateBase+"/")
+	if !ok {
+		return fmt.Errorf("%w: %q must start with %s/", ErrInvalidShortURLTemplate, template, templateBase)
+	}
+	if strings.Count(path, templateID) != 1 {
+		return fmt.Errorf("%w: %q must contain %s exactly once", ErrInvalidShortURLTemplate, template, templateID)
+	}
+	prefix, suffix, _ := strings.Cut(path, templateID)
+	if strings.ContainsAny(prefix+suffix, "{}?#*") || strings.Contains("/"+prefix, "//") {
+		return fmt.Errorf("%w: %q must be a plain path around %s", ErrInvalidShortURLTemplate, template, templateID)
+	}
+	if strings.Contains(suffix, "/") {
+		return fmt.Errorf("%w: %q must have %s in the last path segment", ErrInvalidShortURLTemplate, template, templateID)
+	}
+	return nil
+}
+
+// WithShortURLTemplate задаёт шаблон коротких URL, например "{base}/go/{id}" или "{base}/{id}.html"
+// Шаблон должен пройти ValidateShortURLTemplate; пустой или некорректный шаблон оставляет DefaultShortURLTemplate
+func WithShortURLTemplate(template string) Option {
+	return func(s *Service) {
+		if urls, err := NewURLBuilder(s.urls.Base(), template); err == nil {
+			s.urls = urls
+		}
+	}
+}
+
+// URLBuilder возвращает построитель коротких URL сервиса (см. WithShortURLTemplate)
+func (s *Service) URLBuilder() URLBuilder {
+	return s.urls
+}
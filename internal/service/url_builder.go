@@ -0,0 +1,91 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNotShortURL возвращается, если URL построен не этим URLBuilder
+var ErrNotShortURL = errors.New("not a short URL")
+
+// ErrInvalidNamespace возвращается, если пространство имён не является одним сегментом пути
+var ErrInvalidNamespace = errors.New("invalid short URL namespace")
+
+// URLBuilder строит короткие URL из ID и выделяет ID из коротких URL.
+// Адрес имеет вид base + prefix + [namespace + "/"] + id + suffix, где prefix и suffix задаются шаблоном
+// (см. ValidateShortURLTemplate). Значение неизменяемо: With-методы возвращают изменённую копию,
+// поэтому построитель сервиса можно перенастроить для отдельного запроса, например на другой домен
+type URLBuilder struct {
+	base      string // Базовый URL без завершающего слэша
+	prefix    string // Часть пути между базовым URL и ID (или пространством имён), по умолчанию "/"
+	namespace string // Сегмент пути перед ID; пустая строка — без пространства имён
+	suffix    string // Часть пути после ID
+}
+
+// newURLBuilder создаёт построитель с шаблоном DefaultShortURLTemplate
+func newURLBuilder(baseURL string) URLBuilder {
+	return URLBuilder{base: strings.TrimRight(baseURL, "/"), prefix: "/"}
+}
+
+// NewURLBuilder создаёт построитель коротких URL с базовым URL и шаблоном; пустой шаблон — DefaultShortURLTemplate
+func NewURLBuilder(baseURL, template string) (URLBuilder, error) {
+	b := newURLBuilder(baseURL)
+	if template == "" {
+		return b, nil
+	}
+	if err := ValidateShortURLTemplate(template); err != nil {
+		return URLBuilder{}, err
+	}
+	b.prefix, b.suffix, _ = strings.Cut(strings.TrimPrefix(template, templateBase), templateID)
+	return b, nil
+}
+
+// WithBase возвращает копию построителя с другим базовым URL, например с доменом из запроса
+func (b URLBuilder) WithBase(baseURL string) URLBuilder {
+	b.base = strings.TrimRight(baseURL, "/")
+	return b
+}
+
+// WithNamespace возвращает копию построителя, добавляющего перед ID сегмент пути namespace
+// Пустая строка убирает пространство имён; сегмент не должен содержать "/" и подстановок шаблона
+func (b URLBuilder) WithNamespace(namespace string) (URLBuilder, error) {
+	if strings.ContainsAny(namespace, "/{}?#*") {
+		return URLBuilder{}, fmt.Errorf("%w: %q", ErrInvalidNamespace, namespace)
+	}
+	b.namespace = namespace
+	return b, nil
+}
+
+// Base возвращает базовый URL без завершающего слэша
+func (b URLBuilder) Base() string {
+	return b.base
+}
+
+// Path возвращает путь коротких URL относительно базового URL: части до и после ID, например "/go/" и ""
+func (b URLBuilder) Path() (prefix, suffix string) {
+	if b.namespace == "" {
+		return b.prefix, b.suffix
+	}
+	return b.prefix + b.namespace + "/", b.suffix
+}
+
+// Build строит короткий URL для ID
+func (b URLBuilder) Build(id string) string {
+	prefix, suffix := b.Path()
+	return b.base + prefix + id + suffix
+}
+
+// Parse возвращает ID из короткого URL, построенного Build; ErrNotShortURL, если URL не соответствует построителю
+func (b URLBuilder) Parse(raw string) (string, error) {
+	prefix, suffix := b.Path()
+	rest, ok := strings.CutPrefix(raw, b.base+prefix)
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrNotShortURL, raw)
+	}
+	id, ok := strings.CutSuffix(rest, suffix)
+	if !ok || id == "" {
+		return "", fmt.Errorf("%w: %q", ErrNotShortURL, raw)
+	}
+	return id, nil
+}
@@ -0,0 +1,124 @@
+// Package ui содержит HTML-страницы сервиса и их локализацию
+package ui
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed locales/*.json
+var localesFS embed.FS
+
+// Catalogs содержит каталоги сообщений по языкам
+type Catalogs struct {
+	messages    map[string]map[string]string // Язык -> ключ -> сообщение
+	defaultLang string
+}
+
+// LoadCatalogs загружает каталоги сообщений из файлов <язык>.json в fsys
+// Ключ, отсутствующий хотя бы в одном каталоге, считается ошибкой, чтобы страница не показывала пустой текст
+func LoadCatalogs(fsys fs.FS, defaultLang string) (*Catalogs, error) {
+	files, err := fs.Glob(fsys, "*.json")
+	if err != nil {
+		return nil, err
+	}
+	c := &Catalogs{messages: make(map[string]map[string]string, len(files)), defaultLang: defaultLang}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		var catalog map[string]string
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			return nil, fmt.Errorf("catalog %s: %w", file, err)
+		}
+		c.messages[strings.TrimSuffix(path.Base(file), ".json")] = catalog
+	}
+	if _, ok := c.messages[defaultLang]; !ok {
+		return nil, fmt.Errorf("no catalog for default language %q", defaultLang)
+	}
+
+	var missing []string
+	for _, key := range c.Keys() {
+		for _, lang := range c.Languages() {
+			if c.messages[lang][key] == "" {
+				missing = append(missing, lang+":"+key)
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing messages: %s", strings.Join(missing, ", "))
+	}
+	return c, nil
+}
+
+// NewCatalogs загружает встроенные каталоги en и ru
+func NewCatalogs(defaultLang string) (*Catalogs, error) {
+	sub, err := fs.Sub(localesFS, "locales")
+	if err != nil {
+		return nil, err
+	}
+	return LoadCatalogs(sub, defaultLang)
+}
+
+// Languages возвращает отсортированный список языков
+func (c *Catalogs) Languages() []string {
+	langs := make([]string, 0, len(c.messages))
+	for lang := range c.messages {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Keys возвращает отсортированное объединение ключей всех каталогов
+func (c *Catalogs) Keys() []string {
+	set := make(map[string]struct{})
+	for _, catalog := range c.messages {
+		for key := range catalog {
+			set[key] = struct{}{}
+		}
+	}
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Message возвращает сообщение по ключу на указанном языке
+func (c *Catalogs) Message(lang, key string) string {
+	if msg, ok := c.messages[lang][key]; ok {
+		return msg
+	}
+	return c.messages[c.defaultLang][key]
+}
+
+// Negotiate выбирает язык по заголовку Accept-Language с учётом весов q
+// Региональные варианты (ru-RU) сопоставляются с основным языком; без совпадений возвращается язык по умолчанию
+func (c *Catalogs) Negotiate(acceptLanguage string) string {
+	best, bestQ := c.defaultLang, 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if _, ok := c.messages[primary]; ok && q > bestQ {
+			best, bestQ = primary, q
+		}
+	}
+	return best
+}
@@ -0,0 +1,119 @@
+package ui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCatalogs_AllKeysTranslated(t *testing.T) {
+	c, err := NewCatalogs("en")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"en", "ru"}, c.Languages())
+
+	for _, key := range c.Keys() {
+		for _, lang := range c.Languages() {
+			assert.NotEmpty(t, c.messages[lang][key], "%s: %s", lang, key)
+		}
+	}
+	// Каждый ключ страниц ошибок присутствует в каталогах
+	for _, prefix := range errorPageKeys {
+		assert.Contains(t, c.Keys(), prefix+".title")
+		assert.Contains(t, c.Keys(), prefix+".message")
+	}
+}
+
+func TestLoadCatalogs_MissingKey(t *testing.T) {
+	fsys := fstest.MapFS{
+		"en.json": {Data: []byte(`{"a": "A", "b": "B"}`)},
+		"ru.json": {Data: []byte(`{"a": "А", "c": ""}`)},
+	}
+	_, err := LoadCatalogs(fsys, "en")
+	assert.EqualError(t, err, "missing messages: ru:b, en:c, ru:c")
+
+	_, err = LoadCatalogs(fstest.MapFS{"ru.json": {Data: []byte(`{}`)}}, "en")
+	assert.Error(t, err, "Default language without catalog should fail")
+
+	_, err = LoadCatalogs(fstest.MapFS{"en.json": {Data: []byte(`{`)}}, "en")
+	assert.Error(t, err)
+}
+
+func TestCatalogs_Negotiate(t *testing.T) {
+	c, err := NewCatalogs("en")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{header: "", want: "en"},
+		{header: "ru", want: "ru"},
+		{header: "ru-RU,ru;q=0.9,en-US;q=0.8", want: "ru"},
+		{header: "en-US,en;q=0.9,ru;q=0.8", want: "en"},
+		{header: "de-DE,ru;q=0.5,en;q=0.4", want: "ru"},
+		{header: "fr, de", want: "en"},
+		{header: "ru;q=bad, en;q=0.1", want: "en"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, c.Negotiate(tt.header), tt.header)
+	}
+
+	ruDefault, err := NewCatalogs("ru")
+	assert.NoError(t, err)
+	assert.Equal(t, "ru", ruDefault.Negotiate("fr"))
+}
+
+func TestPages_WriteError(t *testing.T) {
+	pages, err := NewPages("en")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name           string
+		status         int
+		acceptLanguage string
+		wantLang       string
+		wantText       string
+	}{
+		{name: "Not found en", status: http.StatusNotFound, acceptLanguage: "en-US", wantLang: "en", wantText: "Link not found"},
+		{name: "Not found ru", status: http.StatusNotFound, acceptLanguage: "ru-RU,ru;q=0.9", wantLang: "ru", wantText: "Ссылка не найдена"},
+		{name: "Gone ru", status: http.StatusGone, acceptLanguage: "ru", wantLang: "ru", wantText: "Ссылка удалена"},
+		{name: "Gone default", status: http.StatusGone, acceptLanguage: "de", wantLang: "en", wantText: "Link removed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+			req.Header.Set("Accept-Language", tt.acceptLanguage)
+			rr := httptest.NewRecorder()
+			assert.True(t, pages.WriteError(rr, req, tt.status))
+			assert.Equal(t, tt.status, rr.Code)
+			assert.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+			assert.Equal(t, tt.wantLang, rr.Header().Get("Content-Language"))
+			assert.Contains(t, rr.Body.String(), `<html lang="`+tt.wantLang+`">`)
+			assert.Contains(t, rr.Body.String(), "<h1>"+tt.wantText+"</h1>")
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	assert.False(t, pages.WriteError(rr, httptest.NewRequest(http.MethodGet, "/", nil), http.StatusBadRequest))
+	assert.Equal(t, 0, rr.Body.Len())
+}
+
+func TestPages_WriteNSFWInterstitial(t *testing.T) {
+	pages, err := NewPages("en")
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/abc", nil)
+	req.Header.Set("Accept-Language", "ru")
+	rr := httptest.NewRecorder()
+	assert.NoError(t, pages.WriteNSFWInterstitial(rr, req, `https://example.com/?q="x"&y=1`))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "ru", rr.Header().Get("Content-Language"))
+	assert.Equal(t, "noindex, nofollow", rr.Header().Get("X-Robots-Tag"))
+	assert.Contains(t, rr.Body.String(), "<h1>Предупреждение о содержимом</h1>")
+	assert.Contains(t, rr.Body.String(), "Перейти по ссылке")
+	// Адрес экранируется шаблоном
+	assert.NotContains(t, rr.Body.String(), `q="x"`)
+}
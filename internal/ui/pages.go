@@ -0,0 +1,117 @@
+package ui
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+//go:embed templates/*.html
+var templatesFS embed.FS
+
+// errorPageKeys задаёт ключи каталога для страниц ошибок по коду ответа
+var errorPageKeys = map[int]string{
+	http.StatusNotFound: "error.not_found",
+	http.StatusGone:     "error.gone",
+}
+
+// errorPageData содержит данные шаблона страницы ошибки
+type errorPageData struct {
+	Lang    string
+	Title   string
+	Message string
+	Home    string
+}
+
+// interstitialData содержит данные шаблона страницы-предупреждения перед переходом по ссылке
+type interstitialData struct {
+	Lang     string
+	Title    string
+	Message  string
+	Target   string
+	Continue string
+	Home     string
+}
+
+// Pages отрисовывает HTML-страницы на языке клиента
+type Pages struct {
+	catalogs     *Catalogs
+	errorPage    *template.Template
+	interstitial *template.Template
+}
+
+// NewPages загружает каталоги сообщений и шаблоны страниц
+// Ошибка в каталогах (например, непереведённый ключ) возвращается сразу, чтобы сервис не стартовал с неполной локализацией
+func NewPages(defaultLang string) (*Pages, error) {
+	catalogs, err := NewCatalogs(defaultLang)
+	if err != nil {
+		return nil, err
+	}
+	errorPage, err := template.ParseFS(templatesFS, "templates/error.html")
+	if err != nil {
+		return nil, err
+	}
+	interstitial, err := template.ParseFS(templatesFS, "templates/interstitial.html")
+	if err != nil {
+		return nil, err
+	}
+	return &Pages{catalogs: catalogs, errorPage: errorPage, interstitial: interstitial}, nil
+}
+
+// AcceptsHTML сообщает, ожидает ли клиент HTML (например, браузер)
+func AcceptsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// WriteError отвечает страницей ошибки для кода status на языке из Accept-Language
+// Для кодов без страницы возвращает false, и ответ остаётся за вызывающим
+func (p *Pages) WriteError(w http.ResponseWriter, r *http.Request, status int) bool {
+	key, ok := errorPageKeys[status]
+	if !ok {
+		return false
+	}
+	lang := p.catalogs.Negotiate(r.Header.Get("Accept-Language"))
+	var buf bytes.Buffer
+	err := p.errorPage.Execute(&buf, errorPageData{
+		Lang:    lang,
+		Title:   p.catalogs.Message(lang, key+".title"),
+		Message: p.catalogs.Message(lang, key+".message"),
+		Home:    p.catalogs.Message(lang, "page.home"),
+	})
+	if err != nil {
+		return false
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Language", lang)
+	w.Header().Add("Vary", "Accept, Accept-Language")
+	w.WriteHeader(status)
+	_, _ = w.Write(buf.Bytes())
+	return true
+}
+
+// WriteNSFWInterstitial отвечает страницей с предупреждением о NSFW-содержимом и кнопкой перехода на target
+// Страница не индексируется поисковиками: кроме meta robots выставляется заголовок X-Robots-Tag
+func (p *Pages) WriteNSFWInterstitial(w http.ResponseWriter, r *http.Request, target string) error {
+	lang := p.catalogs.Negotiate(r.Header.Get("Accept-Language"))
+	var buf bytes.Buffer
+	err := p.interstitial.Execute(&buf, interstitialData{
+		Lang:     lang,
+		Title:    p.catalogs.Message(lang, "nsfw.title"),
+		Message:  p.catalogs.Message(lang, "nsfw.message"),
+		Target:   target,
+		Continue: p.catalogs.Message(lang, "nsfw.continue"),
+		Home:     p.catalogs.Message(lang, "page.home"),
+	})
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Language", lang)
+	w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+	w.Header().Add("Vary", "Accept-Language")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+	return nil
+}